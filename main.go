@@ -18,13 +18,18 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/logger"
 
 	"github.com/leehayford/des/pkg"
-	"github.com/leehayford/des/pkg/c001v001"
+
+	/* DEVICE CLASSES; EACH REGISTERS ITSELF WITH pkg.RegisterDeviceClass */
+	_ "github.com/leehayford/des/pkg/c001v001"
 )
 
 func main() {
@@ -35,8 +40,44 @@ func main() {
 
 	cleanDB := flag.Bool("clean", false, "Drop and recreate databases")
 	sim := flag.Bool("sim", false, "Run as device simulator only")
+	broker := flag.Bool("broker", false, "Run an embedded MQTT broker ( standalone / test deployments )")
+	brokerAddr := flag.String("broker_addr", ":1883", "Embedded MQTT broker listen address")
+	brokerACL := flag.Bool("broker_acl", false, "Enforce per-device topic ACLs on the embedded MQTT broker")
+	mqttV5 := flag.Bool("mqtt_v5", false, "Connect MQTT clients using MQTT 5 ( falls back to 3.1.1 where the broker refuses it )")
+	brokerTLSAddr := flag.String("broker_tls_addr", "", "Embedded MQTT broker TLS listen address ( requires -ca )")
+	ca := flag.Bool("ca", false, "Issue per-device X.509 certificates from the DES CA")
+	mqttCA := flag.String("mqtt_ca", "", "PEM CA bundle used to verify the MQTT broker ( enables TLS )")
+	mqttCert := flag.String("mqtt_cert", "", "PEM client certificate presented to the MQTT broker ( enables TLS )")
+	mqttKey := flag.String("mqtt_key", "", "PEM client key for -mqtt_cert")
+	mqttServerName := flag.String("mqtt_server_name", "", "Name verified against the MQTT broker certificate")
+	mqttTLSMin := flag.String("mqtt_tls_min", "1.2", "Minimum TLS version for MQTT connections ( 1.2, 1.3 )")
+	jobStore := flag.String("job_store", pkg.JOB_STORE_SQLITE, "Where job databases are kept ( sqlite, postgres, timescale )")
+	jobStoreConn := flag.String("job_store_conn", "", "Postgres connection string of the job store ( default: des_jobs on the DES database server )")
+	migrateJobs := flag.Bool("migrate_jobs", false, "Move all SQLite job databases into the -job_store, then exit")
+	upgradeJobs := flag.Bool("upgrade_jobs", false, "Upgrade every job database to the latest schema version, then exit")
 	flag.Parse()
 
+	/* MQTT 5 - APPLIES TO ALL DES MQTT CLIENTS */
+	pkg.MQTTPreferV5 = *mqttV5
+
+	/* MQTT TLS - APPLIES TO ALL DES MQTT CLIENTS */
+	if *mqttCA != "" || *mqttCert != "" {
+		pkg.MQTTTLS = &pkg.MQTTTLSConfig{
+			CAFile:     *mqttCA,
+			CertFile:   *mqttCert,
+			KeyFile:    *mqttKey,
+			ServerName: *mqttServerName,
+			MinVersion: *mqttTLSMin,
+		}
+	}
+
+	/* DES CA - MUST BE LOADED BEFORE THE EMBEDDED BROKER TLS LISTENER STARTS */
+	if *ca {
+		if err := pkg.LoadDESCA(); err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	if *cleanDB {
 
 		/* ARCHIVE ALL DEVICE / JOB DIRECTORIES */
@@ -58,6 +99,37 @@ func main() {
 	pkg.DES.Connect()
 	defer pkg.DES.Disconnect()
 
+	/* JOB STORE - MUST BE SELECTED BEFORE ANY JOB DATABASE IS OPENED */
+	if err := pkg.ConfigureJobStore(*jobStore, *jobStoreConn); err != nil {
+		log.Fatal(err)
+	}
+	defer pkg.JOB_POOL.CloseAll()
+	if *migrateJobs {
+		migs, err := pkg.MigrateJobDBs()
+		if err != nil {
+			log.Fatal(err)
+		}
+		pkg.Json("MIGRATED JOB DATABASES", migs)
+		return
+	}
+	if *upgradeJobs {
+		upgs, err := pkg.UpgradeJobDBs()
+		if err != nil {
+			log.Fatal(err)
+		}
+		pkg.Json("UPGRADED JOB DATABASES", upgs)
+		return
+	}
+
+	/* EMBEDDED MQTT BROKER - AFTER THE DES DATABASE, WHICH HOLDS DEVICE BROKER SECRETS,
+	AND BEFORE ANY MQTT CLIENT CONNECTS */
+	if *broker {
+		if err := pkg.StartEmbeddedBroker(*brokerAddr, *brokerACL, *brokerTLSAddr); err != nil {
+			log.Fatal(err)
+		}
+		defer pkg.StopEmbeddedBroker()
+	}
+
 	/* MAIN SERVER */
 	app := fiber.New()
 	api := fiber.New()
@@ -65,18 +137,17 @@ func main() {
 	if *sim {
 		/********************************************************************************************/
 		/* DEMO DEVICES -> NOT FOR PRODUCTION */
-		fmt.Println("\n\nConnecting all C001V001 MQTT DemoDevice Clients...")
-		c001v001.DemoDeviceClient_ConnectAll()
-		defer c001v001.DemoDeviceClient_DisconnectAll()
+		pkg.DeviceClasses_ConnectDemos()
+		defer pkg.DeviceClasses_DisconnectDemos()
 		/********************************************************************************************/
 
 	} else {
 
-		/* MQTT - C001V001 - SUBSCRIBE TO ALL REGISTERED DEVICES */
-		/* DATABASE - C001V001 - CONNECT ALL DEVICES TO JOB DATABASES */
-		fmt.Println("\n\nConnecting all C001V001 Device Clients...")
-		c001v001.DeviceClient_ConnectAll()
-		defer c001v001.DeviceClient_DisconnectAll()
+		/* MQTT - ALL CLASSES - SUBSCRIBE TO ALL REGISTERED DEVICES */
+		/* DATABASE - ALL CLASSES - CONNECT ALL DEVICES TO JOB DATABASES */
+		/* RESUME WORK ( IE: DEVICE TRANSFERS ) INTERRUPTED BY A RESTART */
+		pkg.DeviceClasses_ConnectAll()
+		defer pkg.DeviceClasses_DisconnectAll()
 
 		/* MAIN SERVER - LOGGING AND CORS */
 		app.Use(logger.New())
@@ -97,16 +168,20 @@ func main() {
 		/* DES DEVICE ROUTES */
 		pkg.InitializeDESDeviceRoutes(app, api)
 
-		/****************************************************************************************************/
+		/* DES BROKER ( EMQX ) ROUTES */
+		pkg.InitializeDESBrokerRoutes(app, api)
+
+		/* DES JOB ROUTES */
+		pkg.InitializeDESJobRoutes(app, api)
 
-		/* C001V001 ROUTES ******************************************************************************/
 		/****************************************************************************************************/
 
-		/* C001V001 DEVICE ROUTES */
-		c001v001.InitializeDeviceRoutes(app, api)
+		/* DEVICE CLASS ROUTES ( IE: /001/001/... ) ******************************************************/
+		/****************************************************************************************************/
 
-		/* C001V001 JOB / REPORTING ROUTES */
-		c001v001.InitializeJobRoutes(app, api)
+		if err := pkg.DeviceClasses_InitializeRoutes(app, api); err != nil {
+			log.Fatal(err)
+		}
 
 		/****************************************************************************************************/
 
@@ -123,5 +198,19 @@ func main() {
 		})
 	})
 
-	log.Fatal(app.Listen(pkg.APP_HOST))
+	/* SHUT DOWN ON SIGINT / SIGTERM; Listen RETURNS AND THE DEFERRED CLOSES ( SAMPLE WRITERS, JOB DATABASES... ) RUN */
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
+		fmt.Printf("\nShutting down...\n")
+		if err := app.Shutdown(); err != nil {
+			pkg.LogErr(err)
+		}
+	}()
+
+	/* NOT log.Fatal; IT WOULD EXIT WITHOUT RUNNING THE DEFERRED CLOSES */
+	if err := app.Listen(pkg.APP_HOST); err != nil {
+		pkg.LogErr(err)
+	}
 }
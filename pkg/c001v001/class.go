@@ -0,0 +1,237 @@
+package c001v001
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/leehayford/des/pkg"
+)
+
+/*
+	C001V001 DEVICE CLASS
+
+REGISTERS THIS PACKAGE WITH THE DES DEVICE CLASS REGISTRY ( pkg.DeviceClass );
+THE DES DISPATCHES TO IT BY des_devs.des_dev_class / des_devs.des_dev_version
+*/
+type C001V001 struct{}
+
+func init() {
+	if err := pkg.RegisterDeviceClass(C001V001{}); err != nil {
+		pkg.LogErr(err)
+	}
+}
+
+func (C001V001) Class() string   { return DEVICE_CLASS }
+func (C001V001) Version() string { return DEVICE_VERSION }
+
+/* CONNECTIONS ************************************************************************************/
+
+func (C001V001) RegisterDevice(dev pkg.DESDev, src string) (reg pkg.DESRegistration, err error) {
+	device := Device{}
+	device.DESDev = dev
+	if err = device.RegisterDevice(src); err != nil {
+		return
+	}
+	return device.DESRegistration, nil
+}
+
+func (C001V001) ConnectAll()      { DeviceClient_ConnectAll() }
+func (C001V001) DisconnectAll()   { DeviceClient_DisconnectAll() }
+func (C001V001) ConnectDemos()    { DemoDeviceClient_ConnectAll() }
+func (C001V001) DisconnectDemos() { DemoDeviceClient_DisconnectAll() }
+
+/*
+	WORK INTERRUPTED BY A RESTART ( IE: DEVICE TRANSFERS )
+
+EACH FEATURE REGISTERS ITS OWN RESUME FUNCTION IN ITS init( ):
+
+	func init() { RegisterResume(ResumeDeviceTransfers) }
+
+RESUME FUNCTIONS RUN IN THE ORDER REGISTERED, AFTER ConnectAll
+*/
+var resumeFuncs = []func(){}
+
+func RegisterResume(fn func()) { resumeFuncs = append(resumeFuncs, fn) }
+
+func (C001V001) Resume() {
+	for _, fn := range resumeFuncs {
+		fn()
+	}
+}
+
+/* HTTP *******************************************************************************************/
+
+func (C001V001) InitializeRoutes(app, api *fiber.App) (err error) {
+
+	/* C001V001 DEVICE ROUTES */
+	InitializeDeviceRoutes(app, api)
+
+	/* C001V001 JOB / REPORTING ROUTES */
+	if err = InitializeJobRoutes(app, api); err != nil {
+		return
+	}
+
+	/* C001V001 FIRMWARE ROUTES */
+	if err = InitializeFirmwareRoutes(app, api); err != nil {
+		return
+	}
+
+	/* C001V001 DEVICE TRANSFER ROUTES */
+	if err = InitializeTransferRoutes(app, api); err != nil {
+		return
+	}
+
+	/* C001V001 TEST PROGRAM ROUTES */
+	if err = InitializeProgramRoutes(app, api); err != nil {
+		return
+	}
+
+	/* C001V001 BULK COMMAND ROUTES */
+	if err = InitializeBulkRoutes(app, api); err != nil {
+		return
+	}
+
+	/* C001V001 CONFIGURATION TEMPLATE ROUTES */
+	if err = InitializeTemplateRoutes(app, api); err != nil {
+		return
+	}
+
+	/* C001V001 LOCATION / GEOFENCE ROUTES */
+	if err = InitializeLocationRoutes(app, api); err != nil {
+		return
+	}
+
+	/* C001V001 PAYLOAD ENCODING ROUTES */
+	if err = InitializeEncodingRoutes(app, api); err != nil {
+		return
+	}
+
+	/* C001V001 SAMPLE WRITER ROUTES */
+	return InitializeSampleWriterRoutes(app, api)
+}
+
+/* MQTT *******************************************************************************************/
+
+func (C001V001) MQTTTopicRoot(serial string) string {
+	device := Device{}
+	device.DESDevClass = DEVICE_CLASS
+	device.DESDevVersion = DEVICE_VERSION
+	device.DESDevSerial = serial
+	return device.MQTTTopic_DeviceRoot()
+}
+
+func (C001V001) MQTTBrokerACL(serial string) pkg.MQTTBrokerACL {
+	device := Device{}
+	device.DESDevClass = DEVICE_CLASS
+	device.DESDevVersion = DEVICE_VERSION
+	device.DESDevSerial = serial
+	return device.MQTTBrokerACL()
+}
+
+/* PASS A DEAD LETTER TO THE DES DEVICE CLIENT SUBSCRIPTION HANDLER OF ITS TOPIC */
+func (C001V001) ReplayMessage(serial string, msg *pkg.DESReplayMessage) (err error) {
+	device := DevicesMapRead(serial)
+	if device.DESDevSerial == "" {
+		return fmt.Errorf("Device %s is not connected to this DES", serial)
+	}
+	for _, sub := range device.MQTTSubscriptions_DeviceClient() {
+		if sub.Topic == msg.Topic() {
+			sub.Handler(nil, msg)
+			return
+		}
+	}
+	return fmt.Errorf("Device %s has no subscription to %s", serial, msg.Topic())
+}
+
+/* MODELS / CODECS ********************************************************************************/
+
+/* CREATES AND SEEDS THE TABLES OF A NEW JOB DATABASE */
+func (C001V001) CreateJobDBTables(jdbc *pkg.JobDBClient) error {
+	return CreateJobDBTables(jdbc)
+}
+
+/* JOB DATABASE SCHEMA VERSIONS ( SEE controller.job.go ) */
+func (C001V001) JobDBSchemaMigrations() []pkg.JobDBSchemaMigration {
+	return JOB_DB_MIGRATIONS
+}
+
+/* TABLES CREATED IN EACH JOB DATABASE BY CreateJobDBTables */
+func (C001V001) JobDBModels() []interface{} {
+	return []interface{}{
+		&Admin{},
+		&State{},
+		&Header{},
+		&Config{},
+		&EventTyp{},
+		&Event{},
+		&Sample{},
+		&Report{},
+		&RepSection{},
+		&SecDataset{},
+		&SecAnnotation{},
+	}
+}
+
+func (C001V001) RecordTypes() []string { return FLASH_TYPES }
+
+/* RETURNS THE DECODED RECORDS AS A SLICE OF THE TYPE'S MODEL; ie: []Admin */
+func (C001V001) DecodeRecords(typ string, b []byte) (recs interface{}, err error) {
+
+	flash := FlashRecords{}
+	if err = flash.ParseFlash(typ, b); err != nil {
+		return
+	}
+
+	switch typ {
+	case FLASH_TYPE_ADM:
+		recs = flash.ADMs
+	case FLASH_TYPE_STA:
+		recs = flash.STAs
+	case FLASH_TYPE_HDR:
+		recs = flash.HDRs
+	case FLASH_TYPE_CFG:
+		recs = flash.CFGs
+	case FLASH_TYPE_EVT:
+		recs = flash.EVTs
+	case FLASH_TYPE_SMP:
+		recs = flash.SMPs
+	}
+	return
+}
+
+func (C001V001) EncodeRecord(rec interface{}) (b []byte, err error) {
+
+	switch rec.(type) {
+	case Admin:
+		b, err = FLASH_ADM_LAYOUT.Encode(rec)
+	case State:
+		b, err = FLASH_STA_LAYOUT.Encode(rec)
+	case Header:
+		b, err = FLASH_HDR_LAYOUT.Encode(rec)
+	case Config:
+		b, err = FLASH_CFG_LAYOUT.Encode(rec)
+	case Event:
+		b, err = FLASH_EVT_LAYOUT.Encode(rec)
+	case Sample:
+		b, err = FLASH_SMP_LAYOUT.Encode(rec)
+	default:
+		err = fmt.Errorf("Unknown C%sV%s record type: %T", DEVICE_CLASS, DEVICE_VERSION, rec)
+	}
+	return
+}
+
+/* REPORTS ****************************************************************************************/
+
+/* GENERATES THE DEFAULT REPORT ( SECTIONS BY CONFIG ) IN THE JOB DATABASE; RETURNS THE Report */
+func (C001V001) GenerateReport(reg pkg.DESRegistration, uid, title string) (rep interface{}, err error) {
+
+	job := Job{DESRegistration: reg}
+	if err = job.ConnectDBC(); err != nil {
+		return
+	}
+	defer job.DBC.Disconnect()
+
+	r := Report{RepUserID: uid, RepTitle: title, DESRegistration: reg}
+	job.GenerateReport(&r)
+	return r, nil
+}
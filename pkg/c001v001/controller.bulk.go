@@ -0,0 +1,481 @@
+package c001v001
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/leehayford/des/pkg"
+)
+
+/*
+FLEET-WIDE BULK COMMANDS
+
+A BulkPatch ( PARTIAL ADM / CFG / HDR ) IS SENT TO EVERY DEVICE MATCHED BY A BulkSelector
+  - EACH DEVICE'S MAPPED RECORD IS PATCHED AND SENT THROUGH SetAdminRequest / SetConfigRequest / SetHeaderRequest
+  - THE DEVICE ACKNOWLEDGES BY ECHOING THE RECORD ON ITS SIGNAL TOPIC ( CheckBulkAck )
+  - PROGRESS IS KEPT PER DEVICE IN pkg.DESBulkCmdDevice; SEE pkg.DESBulkCmd.Progress
+*/
+
+/* DEVICES ARE SELECTED BY ANY COMBINATION OF SERIALS, SEARCH TOKEN AND GROUP */
+type BulkSelector struct {
+	Serials []string `json:"serials,omitempty"`
+	Token   string   `json:"token,omitempty"` // Matches des_job_searches.des_job_token of the device's active job
+	Group   string   `json:"group,omitempty"` // pkg.BULK_GROUP_ALL
+}
+
+/* ONLY THE FIELDS PRESENT ARE CHANGED; ie: { "cfg": { "cfg_op_sample": 2000 } } */
+type BulkPatch struct {
+	ADM json.RawMessage `json:"adm,omitempty"`
+	CFG json.RawMessage `json:"cfg,omitempty"`
+	HDR json.RawMessage `json:"hdr,omitempty"`
+}
+
+type BulkRequest struct {
+	Selector BulkSelector `json:"selector"`
+	Patch    BulkPatch    `json:"patch"`
+}
+
+type BulkIDRequest struct {
+	DESBulkID int64 `json:"des_bulk_id"`
+}
+
+/* RETURNS THE PATCH FOR EACH RECORD TYPE PRESENT, KEYED BY FLASH_TYPE_... */
+func (patch BulkPatch) Types() (types map[string]json.RawMessage) {
+	types = make(map[string]json.RawMessage)
+	if len(patch.ADM) > 0 {
+		types[FLASH_TYPE_ADM] = patch.ADM
+	}
+	if len(patch.CFG) > 0 {
+		types[FLASH_TYPE_CFG] = patch.CFG
+	}
+	if len(patch.HDR) > 0 {
+		types[FLASH_TYPE_HDR] = patch.HDR
+	}
+	return
+}
+
+/* RETURNS AN ERROR WHERE THE PATCH IS EMPTY OR NAMES FIELDS ITS RECORD DOES NOT HAVE */
+func (patch BulkPatch) Validate() (err error) {
+
+	types := patch.Types()
+	if len(types) == 0 {
+		return fmt.Errorf("Patch must include adm, cfg or hdr")
+	}
+
+	for typ, raw := range types {
+
+		fields := make(map[string]interface{})
+		if err = json.Unmarshal(raw, &fields); err != nil {
+			return fmt.Errorf("Patch %s: %s", typ, err.Error())
+		}
+		if len(fields) == 0 {
+			return fmt.Errorf("Patch %s is empty", typ)
+		}
+
+		rec, err := bulkRecordFields(typ, BulkRecord(typ, Device{}))
+		if err != nil {
+			return err
+		}
+		for k := range fields {
+			if _, ok := rec[k]; !ok {
+				return fmt.Errorf("Patch %s: unknown field %s", typ, k)
+			}
+			if IsReqMetaField(k) {
+				return fmt.Errorf("Patch %s: %s can not be patched", typ, k)
+			}
+		}
+
+		/* ENSURE THE VALUES FIT THE RECORD */
+		if err = json.Unmarshal(raw, BulkRecord(typ, Device{})); err != nil {
+			return fmt.Errorf("Patch %s: %s", typ, err.Error())
+		}
+	}
+	return
+}
+
+/* RETURNS A POINTER TO THE DEVICE'S RECORD OF THE GIVEN TYPE */
+func BulkRecord(typ string, d Device) interface{} {
+	switch typ {
+	case FLASH_TYPE_ADM:
+		return &d.ADM
+	case FLASH_TYPE_CFG:
+		return &d.CFG
+	case FLASH_TYPE_HDR:
+		return &d.HDR
+	}
+	return nil
+}
+
+func bulkRecordFields(typ string, rec interface{}) (fields map[string]interface{}, err error) {
+	if rec == nil {
+		return nil, fmt.Errorf("Unknown bulk record type: %s", typ)
+	}
+	js, err := json.Marshal(rec)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(js, &fields)
+	return
+}
+
+/* RETURNS THE PATCHED FIELDS WHOSE VALUES DIFFER IN rec */
+func BulkPatchDiffs(typ string, patch json.RawMessage, rec interface{}) (diffs []string, err error) {
+
+	want := make(map[string]interface{})
+	if err = json.Unmarshal(patch, &want); err != nil {
+		return
+	}
+	got, err := bulkRecordFields(typ, rec)
+	if err != nil {
+		return
+	}
+	for k, v := range want {
+		if !reflect.DeepEqual(got[k], v) {
+			diffs = append(diffs, fmt.Sprintf("%s: %v", k, got[k]))
+		}
+	}
+	sort.Strings(diffs)
+	return
+}
+
+/* RETURNS THE SELECTED SERIALS OF CLASS 001 VERSION 001 DEVICES, SORTED */
+func (sel BulkSelector) Resolve() (serials []string, err error) {
+
+	set := make(map[string]bool)
+	for _, s := range sel.Serials {
+		if s = strings.TrimSpace(s); s != "" {
+			set[s] = true
+		}
+	}
+
+	if strings.TrimSpace(sel.Group) == pkg.BULK_GROUP_ALL {
+		regs, err := GetDeviceList()
+		if err != nil {
+			return nil, err
+		}
+		for _, reg := range regs {
+			set[reg.DESDevSerial] = true
+		}
+	} else if sel.Group != "" {
+		return nil, fmt.Errorf("Unknown device group: %s", sel.Group)
+	}
+
+	if sel.Token != "" {
+		regs, err := pkg.SearchDESDevices(pkg.DESSearchParam{Token: sel.Token, LngMin: -180, LngMax: 180, LatMin: -90, LatMax: 90})
+		if err != nil {
+			return nil, err
+		}
+		for _, reg := range regs {
+			if reg.DESDevClass == DEVICE_CLASS && reg.DESDevVersion == DEVICE_VERSION {
+				set[reg.DESDevSerial] = true
+			}
+		}
+	}
+
+	for s := range set {
+		serials = append(serials, s)
+	}
+	sort.Strings(serials)
+	return
+}
+
+/* ACKNOWLEDGEMENTS *******************************************************************************/
+
+/* A DEVICE RECORD WAITING FOR THE DEVICE TO ECHO THE PATCHED VALUES */
+type BulkAck struct {
+	pkg.DESBulkCmdDevice
+	Patch json.RawMessage
+}
+
+/* PENDING ACKNOWLEDGEMENTS BY <serial>/<type> */
+var BulkAcks = make(map[string][]BulkAck)
+var BulkAcksRWMutex = sync.RWMutex{}
+
+var bulkTicker sync.Once
+
+func bulkAckKey(serial, typ string) string {
+	return fmt.Sprintf("%s/%s", serial, typ)
+}
+func BulkAcksMapAdd(ack BulkAck) {
+	key := bulkAckKey(ack.DESBulkDevSerial, ack.DESBulkDevType)
+	BulkAcksRWMutex.Lock()
+	BulkAcks[key] = append(BulkAcks[key], ack)
+	BulkAcksRWMutex.Unlock()
+}
+func BulkAcksMapRead(serial, typ string) (acks []BulkAck) {
+	BulkAcksRWMutex.Lock()
+	acks = append(acks, BulkAcks[bulkAckKey(serial, typ)]...)
+	BulkAcksRWMutex.Unlock()
+	return
+}
+func BulkAcksMapRemove(serial, typ string, devID int64) {
+	key := bulkAckKey(serial, typ)
+	BulkAcksRWMutex.Lock()
+	acks := []BulkAck{}
+	for _, ack := range BulkAcks[key] {
+		if ack.DESBulkDevID != devID {
+			acks = append(acks, ack)
+		}
+	}
+	if len(acks) == 0 {
+		delete(BulkAcks, key)
+	} else {
+		BulkAcks[key] = acks
+	}
+	BulkAcksRWMutex.Unlock()
+}
+
+/*
+	CALLED WHEN THE DEVICE SENDS AN ADM / CFG / HDR ( rec )
+
+ACKNOWLEDGES EVERY PENDING BULK COMMAND WHOSE PATCHED VALUES rec CARRIES
+A REPLY WITH OTHER VALUES IS NOTED; THE COMMAND IS REJECTED IF NO MATCHING REPLY ARRIVES IN TIME
+*/
+func (device *Device) CheckBulkAck(typ string, rec interface{}) {
+
+	for _, ack := range BulkAcksMapRead(device.DESDevSerial, typ) {
+
+		diffs, err := BulkPatchDiffs(typ, ack.Patch, rec)
+		if err != nil {
+			pkg.LogErr(err)
+			continue
+		}
+
+		dev := ack.DESBulkCmdDevice
+		if len(diffs) > 0 {
+			dev.DESBulkDevMsg = fmt.Sprintf("Device replied with %s", strings.Join(diffs, ", "))
+			if err = pkg.WriteDESBulkCmdDevice(&dev); err != nil {
+				pkg.LogErr(err)
+			}
+			continue
+		}
+
+		BulkAcksMapRemove(dev.DESBulkDevSerial, typ, dev.DESBulkDevID)
+		dev.DESBulkDevStatus = pkg.BULK_DEV_ACKED
+		dev.DESBulkDevAcked = time.Now().UTC().UnixMilli()
+		dev.DESBulkDevMsg = ""
+		if err = pkg.WriteDESBulkCmdDevice(&dev); err != nil {
+			pkg.LogErr(err)
+		}
+		CheckBulkComplete(dev.DESBulkDevBulkID)
+	}
+}
+
+/* MARK THE BULK COMMAND COMPLETE WHERE NO DEVICE RECORD IS PENDING OR SENT */
+func CheckBulkComplete(id int64) {
+
+	bulk, err := pkg.GetDESBulkCmd(id)
+	if err != nil || bulk.DESBulkStatus == pkg.BULK_STATUS_COMPLETE {
+		return
+	}
+	prog, err := bulk.Progress()
+	if err != nil {
+		pkg.LogErr(err)
+		return
+	}
+	if prog.Done {
+		bulk.DESBulkStatus = pkg.BULK_STATUS_COMPLETE
+		if err = pkg.WriteDESBulkCmd(&bulk); err != nil {
+			pkg.LogErr(err)
+		}
+	}
+}
+
+/* TIME OUT / REJECT SENT DEVICE RECORDS THAT HAVE NOT BEEN ACKNOWLEDGED IN BULK_ACK_TIMEOUT_SEC */
+func CheckBulkTimeouts() {
+
+	devs, err := pkg.GetDESBulkCmdDevicesByStatus(pkg.BULK_DEV_SENT)
+	if err != nil {
+		pkg.LogErr(err)
+		return
+	}
+
+	limit := time.Now().UTC().UnixMilli() - pkg.BULK_ACK_TIMEOUT_SEC*1000
+	bulks := make(map[int64]bool)
+	for _, dev := range devs {
+		if dev.DESBulkDevSent > limit {
+			continue
+		}
+		BulkAcksMapRemove(dev.DESBulkDevSerial, dev.DESBulkDevType, dev.DESBulkDevID)
+		dev.DESBulkDevStatus = pkg.BULK_DEV_TIMEOUT
+		if dev.DESBulkDevMsg != "" {
+			dev.DESBulkDevStatus = pkg.BULK_DEV_REJECTED
+		}
+		if err = pkg.WriteDESBulkCmdDevice(&dev); err != nil {
+			pkg.LogErr(err)
+		}
+		bulks[dev.DESBulkDevBulkID] = true
+	}
+	for id := range bulks {
+		CheckBulkComplete(id)
+	}
+}
+
+/* BULK COMMANDS **********************************************************************************/
+
+/* RECORD THE BULK COMMAND AND ITS DEVICES, THEN SEND IT IN THE BACKGROUND */
+func StartBulkCommand(req BulkRequest, src, uid string) (bulk pkg.DESBulkCmd, err error) {
+
+	if err = req.Patch.Validate(); err != nil {
+		return
+	}
+	serials, err := req.Selector.Resolve()
+	if err != nil {
+		return
+	}
+	if len(serials) == 0 {
+		return bulk, fmt.Errorf("No devices match the selector")
+	}
+
+	sel, err := json.Marshal(req.Selector)
+	if err != nil {
+		return
+	}
+	patch, err := json.Marshal(req.Patch)
+	if err != nil {
+		return
+	}
+
+	bulk = pkg.DESBulkCmd{
+		DESBulkRegTime:   time.Now().UTC().UnixMilli(),
+		DESBulkRegAddr:   src,
+		DESBulkRegUserID: uid,
+		DESBulkClass:     DEVICE_CLASS,
+		DESBulkVersion:   DEVICE_VERSION,
+		DESBulkSelector:  string(sel),
+		DESBulkPatch:     string(patch),
+		DESBulkDevices:   len(serials),
+		DESBulkStatus:    pkg.BULK_STATUS_RUNNING,
+	}
+	if err = pkg.WriteDESBulkCmd(&bulk); err != nil {
+		return
+	}
+
+	devs := []pkg.DESBulkCmdDevice{}
+	for _, serial := range serials {
+		for _, typ := range []string{FLASH_TYPE_ADM, FLASH_TYPE_HDR, FLASH_TYPE_CFG} {
+			if _, ok := req.Patch.Types()[typ]; !ok {
+				continue
+			}
+			dev := pkg.DESBulkCmdDevice{
+				DESBulkDevBulkID: bulk.DESBulkID,
+				DESBulkDevSerial: serial,
+				DESBulkDevType:   typ,
+				DESBulkDevStatus: pkg.BULK_DEV_PENDING,
+			}
+			if err = pkg.WriteDESBulkCmdDevice(&dev); err != nil {
+				return
+			}
+			devs = append(devs, dev)
+		}
+	}
+
+	go SendBulkCommand(bulk, req.Patch, devs, src, uid)
+	return
+}
+
+/* SEND THE PATCH TO EACH DEVICE THROUGH THE MATCHING Set*Request */
+func SendBulkCommand(bulk pkg.DESBulkCmd, patch BulkPatch, devs []pkg.DESBulkCmdDevice, src, uid string) {
+
+	types := patch.Types()
+	for _, dev := range devs {
+
+		/* RECORD AS SENT BEFORE SENDING; THE DEVICE MAY REPLY BEFORE SendBulkRecord RETURNS */
+		dev.DESBulkDevStatus = pkg.BULK_DEV_SENT
+		dev.DESBulkDevSent = time.Now().UTC().UnixMilli()
+		if err := pkg.WriteDESBulkCmdDevice(&dev); err != nil {
+			pkg.LogErr(err)
+		}
+		BulkAcksMapAdd(BulkAck{DESBulkCmdDevice: dev, Patch: types[dev.DESBulkDevType]})
+
+		if err := SendBulkRecord(dev.DESBulkDevSerial, dev.DESBulkDevType, types[dev.DESBulkDevType], src, uid); err != nil {
+			BulkAcksMapRemove(dev.DESBulkDevSerial, dev.DESBulkDevType, dev.DESBulkDevID)
+			dev.DESBulkDevStatus = pkg.BULK_DEV_FAILED
+			dev.DESBulkDevMsg = err.Error()
+			if err := pkg.WriteDESBulkCmdDevice(&dev); err != nil {
+				pkg.LogErr(err)
+			}
+		}
+	}
+	CheckBulkComplete(bulk.DESBulkID)
+}
+
+/* PATCH THE DEVICE'S MAPPED RECORD AND SEND IT */
+func SendBulkRecord(serial, typ string, patch json.RawMessage, src, uid string) (err error) {
+
+	d := DevicesMapRead(serial)
+	if d.DESDevSerial == "" {
+		return fmt.Errorf("Device %s is not connected to this DES", serial)
+	}
+	if ok := DevicePingsMapRead(serial).OK; !ok {
+		return fmt.Errorf("%s", pkg.ERR_MQTT_DEVICE_CONN)
+	}
+
+	switch typ {
+	case FLASH_TYPE_ADM:
+		if err = json.Unmarshal(patch, &d.ADM); err != nil {
+			return
+		}
+		d.ADM.AdmUserID = uid
+		d.ADM.AdmApp = pkg.DES_APP
+		return d.SetAdminRequest(src)
+
+	case FLASH_TYPE_CFG:
+		if err = json.Unmarshal(patch, &d.CFG); err != nil {
+			return
+		}
+		d.CFG.CfgUserID = uid
+		d.CFG.CfgApp = pkg.DES_APP
+		return d.SetConfigRequest(src)
+
+	case FLASH_TYPE_HDR:
+		if err = json.Unmarshal(patch, &d.HDR); err != nil {
+			return
+		}
+		d.HDR.HdrUserID = uid
+		d.HDR.HdrApp = pkg.DES_APP
+		return d.SetHeaderRequest(src)
+	}
+	return fmt.Errorf("Unknown bulk record type: %s", typ)
+}
+
+func init() { RegisterResume(ResumeBulkCommands) }
+
+/* RELOAD PENDING ACKNOWLEDGEMENTS AND START CHECKING TIMEOUTS; CALLED ON STARTUP */
+func ResumeBulkCommands() {
+
+	devs, err := pkg.GetDESBulkCmdDevicesByStatus(pkg.BULK_DEV_SENT)
+	if err != nil {
+		pkg.LogErr(err)
+	}
+
+	patches := make(map[int64]BulkPatch)
+	for _, dev := range devs {
+		patch, ok := patches[dev.DESBulkDevBulkID]
+		if !ok {
+			bulk, err := pkg.GetDESBulkCmd(dev.DESBulkDevBulkID)
+			if err != nil || bulk.DESBulkClass != DEVICE_CLASS || bulk.DESBulkVersion != DEVICE_VERSION {
+				continue
+			}
+			if err = json.Unmarshal([]byte(bulk.DESBulkPatch), &patch); err != nil {
+				pkg.LogErr(err)
+				continue
+			}
+			patches[dev.DESBulkDevBulkID] = patch
+		}
+		BulkAcksMapAdd(BulkAck{DESBulkCmdDevice: dev, Patch: patch.Types()[dev.DESBulkDevType]})
+	}
+
+	bulkTicker.Do(func() {
+		go func() {
+			for range time.Tick(time.Millisecond * pkg.BULK_TICK_MS) {
+				CheckBulkTimeouts()
+			}
+		}()
+	})
+}
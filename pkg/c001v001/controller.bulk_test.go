@@ -0,0 +1,150 @@
+package c001v001
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/leehayford/des/pkg"
+)
+
+/* A RUNNING BULK COMMAND WITH ONE SENT CFG RECORD PER SERIAL, WAITING FOR ITS ACK */
+func testBulkCommand(t *testing.T, patch string, sent int64, serials ...string) (bulk pkg.DESBulkCmd, devs []pkg.DESBulkCmdDevice) {
+	t.Helper()
+	bulk = pkg.DESBulkCmd{
+		DESBulkRegTime:   time.Now().UTC().UnixMilli(),
+		DESBulkRegUserID: "user",
+		DESBulkClass:     DEVICE_CLASS,
+		DESBulkVersion:   DEVICE_VERSION,
+		DESBulkPatch:     `{"cfg":` + patch + `}`,
+		DESBulkDevices:   len(serials),
+		DESBulkStatus:    pkg.BULK_STATUS_RUNNING,
+	}
+	if err := pkg.WriteDESBulkCmd(&bulk); err != nil {
+		t.Fatal(err)
+	}
+	for _, serial := range serials {
+		dev := pkg.DESBulkCmdDevice{
+			DESBulkDevBulkID: bulk.DESBulkID,
+			DESBulkDevSerial: serial,
+			DESBulkDevType:   FLASH_TYPE_CFG,
+			DESBulkDevStatus: pkg.BULK_DEV_SENT,
+			DESBulkDevSent:   sent,
+		}
+		if err := pkg.WriteDESBulkCmdDevice(&dev); err != nil {
+			t.Fatal(err)
+		}
+		BulkAcksMapAdd(BulkAck{DESBulkCmdDevice: dev, Patch: json.RawMessage(patch)})
+		devs = append(devs, dev)
+	}
+	t.Cleanup(func() {
+		for _, dev := range devs {
+			BulkAcksMapRemove(dev.DESBulkDevSerial, dev.DESBulkDevType, dev.DESBulkDevID)
+		}
+	})
+	return
+}
+
+func testBulkStatus(t *testing.T, dev pkg.DESBulkCmdDevice) pkg.DESBulkCmdDevice {
+	t.Helper()
+	got := pkg.DESBulkCmdDevice{}
+	if res := pkg.DES.DB.First(&got, dev.DESBulkDevID); res.Error != nil {
+		t.Fatal(res.Error)
+	}
+	return got
+}
+
+func TestBulkAckCompletesCommand(t *testing.T) {
+	testDESDB(t, &pkg.DESBulkCmd{}, &pkg.DESBulkCmdDevice{}, &pkg.DESError{})
+	bulk, devs := testBulkCommand(t, `{"cfg_op_sample": 2000}`, time.Now().UTC().UnixMilli(), "SN0001", "SN0002")
+
+	d1 := testDevice("SN0001")
+	d1.CheckBulkAck(FLASH_TYPE_CFG, Config{CfgOpSample: 2000})
+	if got := testBulkStatus(t, devs[0]); got.DESBulkDevStatus != pkg.BULK_DEV_ACKED || got.DESBulkDevAcked == 0 {
+		t.Fatalf("SN0001 %s; want %s", got.DESBulkDevStatus, pkg.BULK_DEV_ACKED)
+	}
+	if len(BulkAcksMapRead("SN0001", FLASH_TYPE_CFG)) != 0 {
+		t.Fatal("acknowledged record still waiting for an ack")
+	}
+	if got, _ := pkg.GetDESBulkCmd(bulk.DESBulkID); got.DESBulkStatus != pkg.BULK_STATUS_RUNNING {
+		t.Fatalf("bulk command %s with a device still waiting", got.DESBulkStatus)
+	}
+
+	/* ONLY THE PATCHED FIELDS ARE COMPARED */
+	d2 := testDevice("SN0002")
+	d2.CheckBulkAck(FLASH_TYPE_CFG, Config{CfgOpSample: 2000, CfgOpLog: 1000, CfgAddr: "SN0002"})
+	if got := testBulkStatus(t, devs[1]); got.DESBulkDevStatus != pkg.BULK_DEV_ACKED {
+		t.Fatalf("SN0002 %s; want %s", got.DESBulkDevStatus, pkg.BULK_DEV_ACKED)
+	}
+	if got, _ := pkg.GetDESBulkCmd(bulk.DESBulkID); got.DESBulkStatus != pkg.BULK_STATUS_COMPLETE {
+		t.Fatalf("bulk command %s; want %s", got.DESBulkStatus, pkg.BULK_STATUS_COMPLETE)
+	}
+}
+
+func TestBulkAckOtherValuesRejectedAtTimeout(t *testing.T) {
+	testDESDB(t, &pkg.DESBulkCmd{}, &pkg.DESBulkCmdDevice{}, &pkg.DESError{})
+	sent := time.Now().UTC().UnixMilli() - pkg.BULK_ACK_TIMEOUT_SEC*1000 - 1
+	bulk, devs := testBulkCommand(t, `{"cfg_op_sample": 2000}`, sent, "SN0001", "SN0002")
+
+	/* THE DEVICE CLAMPED THE VALUE; NOTED, STILL WAITING FOR A MATCHING REPLY */
+	d1 := testDevice("SN0001")
+	d1.CheckBulkAck(FLASH_TYPE_CFG, Config{CfgOpSample: 1000})
+	got := testBulkStatus(t, devs[0])
+	if got.DESBulkDevStatus != pkg.BULK_DEV_SENT || got.DESBulkDevMsg == "" {
+		t.Fatalf("SN0001 %s: %q; want %s with the device's values noted", got.DESBulkDevStatus, got.DESBulkDevMsg, pkg.BULK_DEV_SENT)
+	}
+	if len(BulkAcksMapRead("SN0001", FLASH_TYPE_CFG)) != 1 {
+		t.Fatal("record with other values no longer waiting for an ack")
+	}
+
+	CheckBulkTimeouts()
+	if got = testBulkStatus(t, devs[0]); got.DESBulkDevStatus != pkg.BULK_DEV_REJECTED {
+		t.Errorf("SN0001 %s; want %s", got.DESBulkDevStatus, pkg.BULK_DEV_REJECTED)
+	}
+	if got = testBulkStatus(t, devs[1]); got.DESBulkDevStatus != pkg.BULK_DEV_TIMEOUT {
+		t.Errorf("SN0002 %s; want %s", got.DESBulkDevStatus, pkg.BULK_DEV_TIMEOUT)
+	}
+	if len(BulkAcksMapRead("SN0001", FLASH_TYPE_CFG))+len(BulkAcksMapRead("SN0002", FLASH_TYPE_CFG)) != 0 {
+		t.Error("timed out records still waiting for an ack")
+	}
+	if got, _ := pkg.GetDESBulkCmd(bulk.DESBulkID); got.DESBulkStatus != pkg.BULK_STATUS_COMPLETE {
+		t.Errorf("bulk command %s; want %s", got.DESBulkStatus, pkg.BULK_STATUS_COMPLETE)
+	}
+}
+
+func TestSendBulkCommandFailsDisconnectedDevices(t *testing.T) {
+	testDESDB(t, &pkg.DESBulkCmd{}, &pkg.DESBulkCmdDevice{}, &pkg.DESError{})
+	bulk, devs := testBulkCommand(t, `{"cfg_op_sample": 2000}`, 0, "SN0001")
+	BulkAcksMapRemove("SN0001", FLASH_TYPE_CFG, devs[0].DESBulkDevID)
+
+	SendBulkCommand(bulk, BulkPatch{CFG: json.RawMessage(`{"cfg_op_sample": 2000}`)}, devs, "", "user")
+
+	if got := testBulkStatus(t, devs[0]); got.DESBulkDevStatus != pkg.BULK_DEV_FAILED || got.DESBulkDevMsg == "" {
+		t.Fatalf("SN0001 %s: %q; want %s with the reason", got.DESBulkDevStatus, got.DESBulkDevMsg, pkg.BULK_DEV_FAILED)
+	}
+	if len(BulkAcksMapRead("SN0001", FLASH_TYPE_CFG)) != 0 {
+		t.Fatal("failed record waiting for an ack")
+	}
+	if got, _ := pkg.GetDESBulkCmd(bulk.DESBulkID); got.DESBulkStatus != pkg.BULK_STATUS_COMPLETE {
+		t.Fatalf("bulk command %s; want %s", got.DESBulkStatus, pkg.BULK_STATUS_COMPLETE)
+	}
+}
+
+func TestBulkPatchValidate(t *testing.T) {
+	for _, c := range []struct {
+		patch BulkPatch
+		ok    bool
+	}{
+		{BulkPatch{CFG: json.RawMessage(`{"cfg_op_sample": 2000}`)}, true},
+		{BulkPatch{}, false},
+		{BulkPatch{CFG: json.RawMessage(`{}`)}, false},
+		{BulkPatch{CFG: json.RawMessage(`{"cfg_nope": 1}`)}, false},
+		{BulkPatch{CFG: json.RawMessage(`{"cfg_user_id": "x"}`)}, false},
+		{BulkPatch{ADM: json.RawMessage(`{"adm_time": 1}`)}, false},
+		{BulkPatch{CFG: json.RawMessage(`{"cfg_op_sample": "fast"}`)}, false},
+	} {
+		if err := c.patch.Validate(); (err == nil) != c.ok {
+			t.Errorf("%+v: error %v; want ok = %t", c.patch, err, c.ok)
+		}
+	}
+}
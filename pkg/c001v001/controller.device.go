@@ -3,6 +3,7 @@ package c001v001
 import (
 	"fmt"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/leehayford/des/pkg"
@@ -130,6 +131,18 @@ func (device *Device) RegisterDevice(src string) (err error) {
 	device.WriteSMPToHEXFile(device.DESJobName, device.SMP)
 	device.WriteEvtToJSONFile(device.DESJobName, device.EVT)
 
+	/* ISSUE THIS DEVICE'S BROKER CERTIFICATE */
+	if pkg.DESCA != nil {
+		if _, err = device.IssueDeviceCert(); err != nil {
+			return err
+		}
+	}
+
+	/* ISSUE THIS DEVICE'S MESSAGE SIGNING KEY */
+	if _, err = device.IssueSigningKey(); err != nil {
+		return err
+	}
+
 	/* CREATE PERMANENT DES DEVICE CLIENT CONNECTIONS */
 	device.DESMQTTClient = pkg.DESMQTTClient{}
 	device.DeviceClient_Connect()
@@ -192,6 +205,93 @@ func (device *Device) GetDeviceIntitializationFiles() (err error) {
 
 	return
 }
+
+/* ISSUES A DEVICE CERTIFICATE FROM THE DES CA AND WRITES IT TO ~/device_files/XXXXXXXXXX_CMDARCHIVE/ */
+func (device *Device) IssueDeviceCert() (files pkg.DESDevCertFiles, err error) {
+
+	if pkg.DESCA == nil {
+		return files, fmt.Errorf(pkg.ERR_CA_NOT_LOADED)
+	}
+
+	if files, err = pkg.DESCA.IssueDeviceCert(device.DESDevSerial); err != nil {
+		return files, pkg.LogErr(err)
+	}
+
+	err = pkg.WriteDeviceCertFiles(device.CmdArchiveName(), files)
+	return
+}
+
+/* RETURNS THE DEVICE CERTIFICATE FILES; ISSUES A CERTIFICATE WHERE THE DEVICE WAS REGISTERED WITHOUT ONE */
+func (device *Device) GetDeviceCertFiles() (files pkg.DESDevCertFiles, err error) {
+
+	if files, err = pkg.ReadDeviceCertFiles(device.CmdArchiveName()); err == nil {
+		return
+	}
+	return device.IssueDeviceCert()
+}
+
+/* ISSUES A MESSAGE SIGNING KEY AND WRITES THE PRIVATE KEY TO ~/device_files/XXXXXXXXXX_CMDARCHIVE/ */
+func (device *Device) IssueSigningKey() (keyPEM string, err error) {
+
+	key, err := pkg.IssueDeviceSigningKey(device.DESDevSerial)
+	if err != nil {
+		return keyPEM, pkg.LogErr(err)
+	}
+
+	if err = pkg.WriteDeviceSigningKeyFile(device.CmdArchiveName(), key); err != nil {
+		return
+	}
+	return pkg.DeviceSigningKeyPEM(key)
+}
+
+/* RETURNS THE DEVICE'S PRIVATE SIGNING KEY ( PEM ); ISSUES A KEY WHERE THE DEVICE WAS REGISTERED WITHOUT ONE */
+func (device *Device) GetSigningKeyPEM() (keyPEM string, err error) {
+
+	if pkg.DeviceSigningKeyIssued(device.DESDevSerial) {
+		if key, err := pkg.ReadDeviceSigningKeyFile(device.CmdArchiveName()); err == nil {
+			return pkg.DeviceSigningKeyPEM(key)
+		}
+	}
+	return device.IssueSigningKey()
+}
+
+/*
+	REVOKES ALL CERTIFICATES ISSUED TO THIS DEVICE AND ISSUES A REPLACEMENT
+
+- THE REPLACEMENT IS DELIVERED WITH THE NEXT DEVICE INITIALIZATION FILES
+- EMBEDDED BROKER CONNECTIONS USING THE REVOKED CERTIFICATE ARE CLOSED
+*/
+func (device *Device) RevokeDeviceCerts(reason string) (count int64, files pkg.DESDevCertFiles, err error) {
+
+	if count, err = pkg.RevokeDeviceCerts(device.DESDevSerial, reason); err != nil {
+		return
+	}
+
+	if pkg.EmbeddedBroker != nil {
+		pkg.EmbeddedBroker.DisconnectUser(device.DESDevSerial, fmt.Errorf("certificate revoked: %s", reason))
+	}
+
+	files, err = device.IssueDeviceCert()
+	return
+}
+
+/*
+	ISSUES ( REPLACES ) THE DEVICE'S EMBEDDED BROKER SECRET
+
+ONLY A HASH IS KEPT, SO THE SECRET CAN BE DELIVERED ONCE; THE DEVICE MUST BE GIVEN THE NEW SECRET
+*/
+func (device *Device) IssueBrokerSecret() (secret string, err error) {
+	if secret, err = pkg.IssueDeviceBrokerSecret(device.DESDevSerial); err != nil {
+		return secret, pkg.LogErr(err)
+	}
+	return
+}
+
+/* THE MESSAGE TIME POLICY OF THIS DEVICE CLASS / VERSION */
+func (device *Device) TimePolicy() pkg.DESTimePolicy {
+	return pkg.GetTimePolicy(DEVICE_CLASS, DEVICE_VERSION)
+}
+
 func (device *Device) ReferenceSRC() (src pkg.DESMessageSource) {
 	src.Time = time.Now().UTC().UnixMilli()
 	src.Addr = device.DESDevSerial
@@ -250,6 +350,9 @@ func (device *Device) DeviceClient_Connect() (err error) {
 		return pkg.LogErr(res.Error)
 	}
 
+	/* ALLOW THE DEVICE ONTO ITS OWN TOPICS WHERE THE EMBEDDED BROKER ENFORCES ACLs */
+	pkg.MQTTBrokerACLsMapWrite(device.DESDevSerial, device.MQTTBrokerACL())
+
 	if err := device.MQTTDeviceClient_Connect(); err != nil {
 		return pkg.LogErr(err)
 	}
@@ -310,6 +413,14 @@ func (device *Device) DeviceClient_Disconnect() (err error) {
 		return pkg.LogErr(err)
 	}
 
+	/* COMMIT ANY SAMPLES STILL QUEUED FOR THE CMDARCHIVE OR ACTIVE JOB */
+	if err := CloseSampleWriter(&device.CmdDBC); err != nil {
+		pkg.LogErr(err)
+	}
+	if err := CloseSampleWriter(&device.JobDBC); err != nil {
+		pkg.LogErr(err)
+	}
+
 	// fmt.Printf("\n\n(*Device) DeviceClient_Disconnect() -> %s -> disconnecting CmdDBC... \n", device.DESDevSerial)
 	if err := device.CmdDBC.Disconnect(); err != nil {
 		return pkg.LogErr(err)
@@ -329,6 +440,15 @@ func (device *Device) DeviceClient_Disconnect() (err error) {
 	/* REMOVE DEVICE FROM DevicePings MAP */
 	DevicePingsMapRemove(device.DESDevSerial)
 
+	/* REMOVE DEVICE FROM StableMonitors MAP */
+	StableMonitorsMapRemove(device.DESDevSerial)
+
+	/* STOP CHECKING THE DEVICE'S LOCATIONS ONCE THOSE QUEUED ARE CHECKED */
+	LocationQueuesMapRemove(device.DESDevSerial)
+
+	/* REMOVE DEVICE FROM MQTTBrokerACLs MAP */
+	pkg.MQTTBrokerACLsMapRemove(device.DESDevSerial)
+
 	fmt.Printf("\n\n(*Device) DeviceClient_Disconnect() -> %s -> COMPLETE\n", device.DESDevSerial)
 	return
 }
@@ -374,8 +494,9 @@ func (device Device) GetCmdArchiveDESRegistration() (cmd Job) {
 	return
 }
 
-/* CONNECTS THE CMDARCHIVE DBClient TO THE CMDARCHIVE DATABASE */
+/* CONNECTS THE CMDARCHIVE DBClient TO THE CMDARCHIVE DATABASE, UPGRADING ITS SCHEMA WHERE NECESSARY */
 func (device *Device) ConnectCmdDBC() (err error) {
+	pkg.EnsureJobDBSchema(device.CmdArchiveName())
 	device.CmdDBC, err = pkg.GetJobDBClient(device.CmdArchiveName())
 	return device.CmdDBC.Connect()
 }
@@ -408,8 +529,9 @@ func (device *Device) GetCurrentJob() {
 
 /* DEVICE CLIENT ACTIVE JOB ***********************************************************************/
 
-/* CONNECTS THE ACTIVE JOB DBClient TO THE ACTIVE JOB DATABASE */
+/* CONNECTS THE ACTIVE JOB DBClient TO THE ACTIVE JOB DATABASE, UPGRADING ITS SCHEMA WHERE NECESSARY */
 func (device *Device) ConnectJobDBC() (err error) {
+	pkg.EnsureJobDBSchema(device.DESJobName)
 	device.JobDBC, err = pkg.GetJobDBClient(device.DESJobName)
 	return device.JobDBC.Connect()
 }
@@ -487,28 +609,28 @@ UPON MQTT MESSAGE AT '.../CMD/EVENT, DEVICE CLIENT PERFORMS
 	CLASS/VERSION SPECIFIC JOB START ACTIONS
 */
 type StartJob struct {
-	ADM Admin  `json:"adm"`
-	STA State  `json:"sta"`
-	HDR Header `json:"hdr"`
-	CFG Config `json:"cfg"`
-	EVT Event  `json:"evt"`
+	ADM Admin  `json:"adm" tlv:"1"`
+	STA State  `json:"sta" tlv:"2"`
+	HDR Header `json:"hdr" tlv:"3"`
+	CFG Config `json:"cfg" tlv:"4"`
+	EVT Event  `json:"evt" tlv:"5"`
 }
 
-func (start *StartJob) SIGValidate(device *Device) (err error) {
+func (start *StartJob) SIGValidate(device *Device, req *pkg.MQTTPendingRequest) (err error) {
 
-	if err = start.ADM.SIGValidate(device); err != nil {
+	if err = start.ADM.SIGValidate(device, req); err != nil {
 		return
 	}
-	if err = start.STA.SIGValidate(device); err != nil {
+	if err = start.STA.SIGValidate(device, req); err != nil {
 		return
 	}
-	if err = start.HDR.SIGValidate(device); err != nil {
+	if err = start.HDR.SIGValidate(device, req); err != nil {
 		return
 	}
-	if err = start.CFG.SIGValidate(device); err != nil {
+	if err = start.CFG.SIGValidate(device, req); err != nil {
 		return
 	}
-	if err = start.EVT.SIGValidate(device); err != nil {
+	if err = start.EVT.SIGValidate(device, req); err != nil {
 		return
 	}
 
@@ -523,6 +645,13 @@ func (start *StartJob) SIGValidate(device *Device) (err error) {
 */
 func (device *Device) StartJobRequest(src, uid string) (err error) {
 
+	/* REJECT INVALID SETTINGS BEFORE ANYTHING IS LOGGED OR PUBLISHED */
+	for _, mod := range []interface{}{device.ADM, device.HDR, device.CFG} {
+		if err = pkg.ValidateModel(mod); err != nil {
+			return
+		}
+	}
+
 	/* SYNC DEVICE WITH DevicesMap */
 	device.GetMappedClients()
 	device.GetDeviceDESU()
@@ -623,7 +752,8 @@ func (device *Device) StartJob(start StartJob) (err error) {
 	go WriteCFG(start.CFG, &device.CmdDBC)
 	go WriteEVT(start.EVT, &device.CmdDBC)
 
-	/* CLEAR THE ACTIVE JOB DATABASE CONNECTION */
+	/* COMMIT ANY SAMPLES STILL QUEUED FOR THE PREVIOUS JOB AND CLEAR THE ACTIVE JOB DATABASE CONNECTION */
+	CloseSampleWriter(&device.JobDBC)
 	device.JobDBC.Disconnect()
 
 	device.DESJobRegTime = start.EVT.EvtTime
@@ -756,8 +886,8 @@ func (device *Device) OfflineJobStart(smp Sample) {
 	)
 
 	/* LOG smp TO JOB DATABASE */
-	go WriteSMP(smp, &device.JobDBC)
-	fmt.Printf("\n(*Device) OfflineJobStart( ) -> WriteSMP(): OK \n")
+	WriteSample(smp, &device.JobDBC)
+	fmt.Printf("\n(*Device) OfflineJobStart( ) -> WriteSample(): OK \n")
 
 	/* AQUIRE THE LATES ADM, STA, HDR, CFG, EVT FROM THE DEVICE */
 	go device.MQTTPublication_DeviceClient_CMDReport()
@@ -868,7 +998,10 @@ func (device *Device) EndJob(sta State) {
 	// device.JobDBC.Last(&d.EVT)
 	d.SMP = Sample{SmpTime: d.STA.StaTime, SmpJobName: d.STA.StaJobName}
 
-	/* CLEAR THE ACTIVE JOB DATABASE CONNECTION */
+	/* COMMIT ANY SAMPLES STILL QUEUED AND CLEAR THE ACTIVE JOB DATABASE CONNECTION */
+	if err := CloseSampleWriter(&device.JobDBC); err != nil {
+		pkg.LogErr(err)
+	}
 	device.JobDBC.Disconnect()
 
 	/* UPDATE DESJobSearch RECORD USING RETRIEVED RECORDS
@@ -1010,7 +1143,7 @@ func (device *Device) DeviceReportRequest(uid string) (err error) {
 - UNKNOWN JOB NAME ( DATABASE DOES NOT EXIST )
 - OPERATIONAL ALARMS / NOTIFICATIONS ( SSP / SCVF )
 */
-func (device *Device) HandleMQTTSample(mqtts MQTT_Sample) {
+func (device *Device) HandleMQTTSample(mqtts MQTT_Sample) (err error) {
 
 	device.GetMappedSTA()
 	sta := device.STA
@@ -1020,12 +1153,14 @@ func (device *Device) HandleMQTTSample(mqtts MQTT_Sample) {
 	smp := Sample{SmpJobName: mqtts.DesJobName}
 
 	/* DECODE BASE64URL STRING ( DATA ) */
-	if err := smp.DecodeMQTTSample(mqtts.Data); err != nil {
-		pkg.LogErr(err)
-		// return
+	if err = smp.DecodeMQTTSample(mqtts.Data); err != nil {
+		return
 	}
 
-	/* TODO: VALIDATE */
+	/* VALIDATE THE SAMPLE TIME ( SEE pkg.DESTimePolicy ) */
+	if smp.SmpTime, err = device.TimePolicy().Apply(smp.SmpTime); err != nil {
+		return
+	}
 	valid := true
 	if valid {
 		/* CHECK SAMPLE JOB NAME */
@@ -1034,7 +1169,7 @@ func (device *Device) HandleMQTTSample(mqtts MQTT_Sample) {
 			- SOMETHING HAS GONE WRONG WITH THE DEVICE
 			- OR WE ARE TESTING THE DEVICE
 			*/
-			go WriteSMP(smp, &device.CmdDBC)
+			WriteSample(smp, &device.CmdDBC)
 
 			/* TODO: TEST ?... DO NOTHING ...?
 			case OP_CODE_DES_REG_REQ:
@@ -1047,12 +1182,14 @@ func (device *Device) HandleMQTTSample(mqtts MQTT_Sample) {
 		} else if smp.SmpJobName == device.DESJobName && sta.StaLogging > OP_CODE_JOB_START_REQ {
 
 			/* WE'RE LOGGING; WRITE TO JOB DATABASE */
-			go WriteSMP(smp, &device.JobDBC)
+			WriteSample(smp, &device.JobDBC)
 
 			device.CheckSSPCondition(smp)
 
 			device.CheckSCVFCondition(smp)
 
+			device.CheckProgramPressure(smp)
+
 		} else if sta.StaLogging == OP_CODE_JOB_ENDED {
 
 			/* DEVICE STARTED A JOB WITHOUT OUR KNOWLEDGE - WE'RE NOT CURRENTLY LOGGING */
@@ -1074,17 +1211,87 @@ func (device *Device) HandleMQTTSample(mqtts MQTT_Sample) {
 		// 	smp = Sample{}
 	}
 	// fmt.Printf("\n(*Device) HandleMQTTSample( ): COMPLETE.\n")
-	// return
+	return
 }
 
-/* ??? JOB/REPORT ??? USED WHEN A SAMPLE IS RECEIVED, TO CHECK FOR STABILIZED SHUT-IN PRESSURE ( BUILD-MODE )*/
+/*
+	USED WHEN A SAMPLE IS RECEIVED, TO CHECK FOR STABILIZED SHUT-IN PRESSURE ( BUILD-MODE )
+
+- THE DEVICE'S SSP StableMonitor IS RESET WHENEVER THE DEVICE LEAVES MODE_BUILD OR STARTS A NEW JOB
+- WHEN SSP IS REACHED, AN SSP EVENT IS LOGGED AND SENT THROUGH THE SAME PATH AS USER EVENTS
+*/
 func (device *Device) CheckSSPCondition(smp Sample) {
-	/* TODO */
+
+	device.GetMappedCFG()
+	if device.CFG.CfgVlvTgt != MODE_BUILD {
+		StableMonitorsMapRemove(device.DESDevSerial, SSP_STABLE)
+		return
+	}
+
+	mon := device.StableMonitor(SSP_STABLE, smp)
+	res, ok := mon.AppendSample(smp, device.CFG)
+	StableMonitorsMapWrite(device.DESDevSerial, mon)
+
+	if ok {
+		fmt.Printf("\n(*Device) CheckSSPCondition( ) -> %s -> %s\n", device.DESDevSerial, res.Message())
+		device.EVT = device.StableEvent(res)
+		if err := device.SetDESEventRequest(pkg.DES_ADDR); err != nil {
+			pkg.LogErr(err)
+		}
+		device.CheckProgramCondition(PROG_END_SSP)
+	}
 }
 
-/* ??? JOB/REPORT ??? USED WHEN A SAMPLE IS RECEIVED, TO CHECK FOR STABILIZED FLOW ( FLOW-MODE )*/
+/*
+	USED WHEN A SAMPLE IS RECEIVED, TO CHECK FOR STABILIZED FLOW ( FLOW-MODE )
+
+- THE DEVICE'S SCVF StableMonitor IS RESET WHENEVER THE FLOW MODE CHANGES OR THE DEVICE STARTS A NEW JOB
+- WHEN SCVF IS REACHED, AN SSCVF EVENT IS LOGGED AND SENT THROUGH THE SAME PATH AS USER EVENTS
+- WHERE FLOW CROSSES Config.CfgFlowTog, A SET CONFIG REQUEST SWITCHES THE DEVICE TO THE OTHER FLOW SENSOR
+  - NOT WHILE A RUNNING PROGRAM HOLDS THE DEVICE'S MODE; THE PROGRAM STEP DECIDES WHICH SENSOR IS USED
+*/
 func (device *Device) CheckSCVFCondition(smp Sample) {
-	/* TODO */
+
+	device.GetMappedCFG()
+	if device.CFG.CfgVlvTgt != MODE_HI_FLOW && device.CFG.CfgVlvTgt != MODE_LO_FLOW {
+		StableMonitorsMapRemove(device.DESDevSerial, SCVF_STABLE)
+		return
+	}
+
+	mon := device.StableMonitor(SCVF_STABLE, smp)
+
+	res, ok := mon.AppendSample(smp, device.CFG)
+	tgt, toggle := mon.FlowToggle(smp, device.CFG)
+	if toggle && device.ProgramHoldsMode() {
+		toggle = false
+	}
+	if toggle {
+		mon.ToggleTime = smp.SmpTime
+	}
+	StableMonitorsMapWrite(device.DESDevSerial, mon)
+
+	if ok {
+		fmt.Printf("\n(*Device) CheckSCVFCondition( ) -> %s -> %s\n", device.DESDevSerial, res.Message())
+		device.EVT = device.StableEvent(res)
+		if err := device.SetDESEventRequest(pkg.DES_ADDR); err != nil {
+			pkg.LogErr(err)
+		}
+	}
+
+	if toggle {
+		fmt.Printf("\n(*Device) CheckSCVFCondition( ) -> %s -> FLOW SENSOR CHANGE: %d -> %d\n", device.DESDevSerial, device.CFG.CfgVlvTgt, tgt)
+		device.CFG.CfgVlvTgt = tgt
+		device.CFG.CfgUserID = device.DESU.GetUUIDString()
+		device.CFG.CfgApp = pkg.DES_APP
+		if err := device.SetConfigRequest(pkg.DES_ADDR); err != nil {
+			pkg.LogErr(err)
+		}
+	}
+
+	/* AFTER ANY FLOW SENSOR CHANGE, SO THE NEXT PROGRAM STEP'S CONFIG IS SENT LAST */
+	if ok {
+		device.CheckProgramCondition(PROG_END_SCVF)
+	}
 }
 
 /* DEVICE SNAPSHOT *************************************************************************************/
@@ -1142,12 +1349,31 @@ func (device *Device) Update_DESJobSearch(reg pkg.DESRegistration) (err error) {
 
 /* SET / GET JOB PARAMS *********************************************************************************/
 
+/* JSON FIELD SUFFIXES OF THE WHO / WHEN / WHERE FIELDS SET BY EACH Set*Request ( ie: adm_time, cfg_user_id ) */
+var REQ_META_FIELDS = []string{"_time", "_addr", "_user_id", "_app"}
+
+/* RETURNS TRUE WHERE THE JSON FIELD NAME IS ONE OF REQ_META_FIELDS */
+func IsReqMetaField(field string) bool {
+	for _, m := range REQ_META_FIELDS {
+		if strings.HasSuffix(field, m) {
+			return true
+		}
+	}
+	return false
+}
+
 /* PREPARE, LOG, AND SEND A SET ADMIN REQUEST TO THE DEVICE */
 func (device *Device) SetAdminRequest(src string) (err error) {
 
 	adm := device.ADM
 	adm.AdmTime = time.Now().UTC().UnixMilli()
 	adm.AdmAddr = src
+	adm.AdmReqID = pkg.NewMQTTCorrelation()
+
+	/* REJECT INVALID SETTINGS BEFORE ANYTHING IS LOGGED OR PUBLISHED */
+	if err = pkg.ValidateModel(adm); err != nil {
+		return
+	}
 	adm.Validate()
 
 	/* SYNC DEVICE WITH DevicesMap */
@@ -1220,6 +1446,12 @@ func (device *Device) SetHeaderRequest(src string) (err error) {
 	hdr := device.HDR
 	hdr.HdrTime = time.Now().UTC().UnixMilli()
 	hdr.HdrAddr = src
+	hdr.HdrReqID = pkg.NewMQTTCorrelation()
+
+	/* REJECT INVALID SETTINGS BEFORE ANYTHING IS LOGGED OR PUBLISHED */
+	if err = pkg.ValidateModel(hdr); err != nil {
+		return
+	}
 	hdr.Validate()
 
 	/* SYNC DEVICE WITH DevicesMap */
@@ -1255,6 +1487,12 @@ func (device *Device) SetConfigRequest(src string) (err error) {
 	cfg := device.CFG
 	cfg.CfgTime = time.Now().UTC().UnixMilli()
 	cfg.CfgAddr = src
+	cfg.CfgReqID = pkg.NewMQTTCorrelation()
+
+	/* REJECT INVALID SETTINGS BEFORE ANYTHING IS LOGGED OR PUBLISHED */
+	if err = pkg.ValidateModel(cfg); err != nil {
+		return
+	}
 	cfg.Validate()
 
 	/* SYNC DEVICE WITH DevicesMap */
@@ -1284,11 +1522,24 @@ func (device *Device) SetConfigRequest(src string) (err error) {
 	return
 }
 
-/* PREPARE, LOG, AND SEND A SET EVENT REQUEST TO THE DEVICE */
+/* PREPARE, LOG, AND SEND A SET EVENT REQUEST TO THE DEVICE; THE EVENT IS STAMPED WITH THE SERVER TIME */
 func (device *Device) SetEventRequest(src string) (err error) {
+	device.EVT.EvtTime = time.Now().UTC().UnixMilli()
+	return device.SetDESEventRequest(src)
+}
+
+/*
+	AS SetEventRequest, BUT KEEPS device.EVT.EvtTime ( THE SERVER TIME WHERE IT IS NOT SET )
+
+FOR EVENTS RAISED BY THE DES ITSELF ( EX: THE SAMPLE TIME AT WHICH SSP WAS REACHED );
+NEVER CALLED WITH AN EVENT TAKEN FROM A REQUEST BODY
+*/
+func (device *Device) SetDESEventRequest(src string) (err error) {
 
 	evt := device.EVT
-	evt.EvtTime = time.Now().UTC().UnixMilli()
+	if evt.EvtTime == 0 {
+		evt.EvtTime = time.Now().UTC().UnixMilli()
+	}
 	evt.EvtAddr = src
 	evt.Validate()
 
@@ -0,0 +1,129 @@
+package c001v001
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/leehayford/des/pkg"
+)
+
+/*
+PAYLOAD ENCODING
+
+SIG / CMD MESSAGES ARE SENT AS JSON ( ENCODING_JSON ) OR COMPACT BINARY ( ENCODING_BIN, SEE pkg.EncodeBinaryPayload )
+  - THE DEVICE DECLARES THE HIGHEST ENCODING ITS FIRMWARE SUPPORTS IN State.StaEncoding
+  - COMMANDS ARE SENT IN THAT ENCODING UNLESS JSON IS FORCED FOR THE DEVICE ( DEBUGGING )
+  - RECEIVED PAYLOADS ARE DECODED ACCORDING TO THEIR FIRST BYTE; A DEVICE MAY ALWAYS SEND JSON
+  - BOTH ARE STORED IN des_dev_encodings ( pkg.DESDevEncoding ) AND RELOADED BY LoadEncodings BEFORE THE DEVICES CONNECT
+*/
+const ENCODING_JSON int32 = 0
+const ENCODING_BIN int32 = 1
+
+/* THE BINARY SCHEMA OF THIS CLASS / VERSION'S MODELS; MUST CHANGE WHENEVER THE MEANING OF A MODEL'S tlv TAG DOES */
+const BIN_SCHEMA byte = 1
+
+type PayloadEncoding struct {
+	Device    int32 `json:"device"`     // Declared in the last State received from the device
+	ForceJSON bool  `json:"force_json"` // Set by an administrator
+}
+
+type EncodingRequest struct {
+	DESDevSerial string `json:"des_dev_serial"`
+	ForceJSON    bool   `json:"force_json"`
+}
+
+var Encodings = make(map[string]PayloadEncoding)
+var EncodingsRWMutex = sync.RWMutex{}
+
+func EncodingsMapRead(serial string) (enc PayloadEncoding) {
+	EncodingsRWMutex.RLock()
+	enc = Encodings[serial]
+	EncodingsRWMutex.RUnlock()
+	return
+}
+
+/* RECORD THE ENCODING DECLARED IN A STATE RECEIVED FROM THE DEVICE */
+func (device *Device) SetDeviceEncoding(sta State) {
+	EncodingsRWMutex.Lock()
+	defer EncodingsRWMutex.Unlock()
+	enc, ok := Encodings[device.DESDevSerial]
+	if ok && enc.Device == sta.StaEncoding {
+		return
+	}
+	enc.Device = sta.StaEncoding
+	Encodings[device.DESDevSerial] = enc
+	writeEncoding(device.DESDevSerial, enc)
+}
+
+/* SEND COMMANDS TO THE DEVICE AS JSON, REGARDLESS OF WHAT IT SUPPORTS */
+func SetForceJSON(req EncodingRequest) (enc PayloadEncoding) {
+	EncodingsRWMutex.Lock()
+	defer EncodingsRWMutex.Unlock()
+	enc = Encodings[req.DESDevSerial]
+	enc.ForceJSON = req.ForceJSON
+	Encodings[req.DESDevSerial] = enc
+	writeEncoding(req.DESDevSerial, enc)
+	return
+}
+
+/* CALLER MUST HOLD EncodingsRWMutex */
+func writeEncoding(serial string, enc PayloadEncoding) {
+	rec := pkg.DESDevEncoding{
+		DESDevEncSerial:    serial,
+		DESDevEncDevice:    enc.Device,
+		DESDevEncForceJSON: enc.ForceJSON,
+	}
+	if err := pkg.WriteDESDevEncoding(&rec); err != nil {
+		pkg.LogErr(err)
+	}
+}
+
+/* LOAD THE STORED ENCODINGS; CALLED BY DeviceClient_ConnectAll */
+func LoadEncodings() {
+
+	recs, err := pkg.GetDESDevEncodings()
+	if err != nil {
+		pkg.LogErr(err)
+		return
+	}
+
+	EncodingsRWMutex.Lock()
+	defer EncodingsRWMutex.Unlock()
+	for _, rec := range recs {
+		Encodings[rec.DESDevEncSerial] = PayloadEncoding{
+			Device:    rec.DESDevEncDevice,
+			ForceJSON: rec.DESDevEncForceJSON,
+		}
+	}
+}
+
+/* THE ENCODING OF COMMANDS SENT TO THIS DEVICE */
+func (device *Device) CMDEncoding() int32 {
+	enc := EncodingsMapRead(device.DESDevSerial)
+	if enc.ForceJSON || enc.Device < ENCODING_BIN {
+		return ENCODING_JSON
+	}
+	return ENCODING_BIN
+}
+
+/* ENCODE A SIG / CMD MODEL AS AN MQTTPublication.Message */
+func EncodePayload(enc int32, mod interface{}) (msg string, err error) {
+	if enc == ENCODING_BIN {
+		b, err := pkg.EncodeBinaryPayload(BIN_SCHEMA, mod)
+		return string(b), err
+	}
+	return pkg.ModelToJSONString(mod)
+}
+
+/* ENCODE A COMMAND TO THIS DEVICE */
+func (device *Device) EncodeCMD(mod interface{}) (msg string, err error) {
+	return EncodePayload(device.CMDEncoding(), mod)
+}
+
+/* DECODE A SIG / CMD PAYLOAD, JSON OR BINARY */
+func DecodePayload(payload []byte, mod interface{}) (err error) {
+	if pkg.IsBinaryPayload(payload) {
+		return pkg.DecodeBinaryPayload(payload, BIN_SCHEMA, mod)
+	}
+	return json.Unmarshal(payload, mod)
+}
@@ -0,0 +1,92 @@
+package c001v001
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/leehayford/des/pkg"
+)
+
+func testStartJob() StartJob {
+	return StartJob{
+		ADM: Admin{
+			AdmTime: 1700000000000, AdmAddr: "SN0001", AdmUserID: "user", AdmApp: "app",
+			AdmDefHost: "127.0.0.1", AdmDefPort: 1883, AdmOpHost: "127.0.0.2", AdmOpPort: 8883,
+			AdmBatHiAmp: 2.5, AdmBatLoVolt: 10.5, AdmMotHiAmp: 0.8,
+			AdmPress: 6991.3, AdmPressMin: 689.5, AdmPressMax: 6991.3,
+			AdmHFSFlow: 200, AdmHFSFlowMin: 150, AdmHFSFlowMax: 250,
+			AdmLFSFlow: 1.85, AdmLFSFlowMin: 0.5, AdmLFSFlowMax: 2,
+			AdmLFSDiffMax: 68.9,
+		},
+		STA: State{
+			StaTime: 1700000000001, StaAddr: "SN0001", StaUserID: "user", StaApp: "app",
+			StaSerial: "SN0001", StaVersion: DEVICE_VERSION, StaClass: DEVICE_CLASS,
+			StaLogFw: "00.0.000", StaModFw: "00.0.000", StaLogging: OP_CODE_JOB_STARTED, StaJobName: "SN0001_0000000001",
+			StaStmUID1: -1, StaStmUID2: 2, StaStmUID3: 3, StaEncoding: ENCODING_BIN,
+		},
+		HDR: Header{
+			HdrTime: 1700000000002, HdrAddr: "SN0001", HdrUserID: "user", HdrApp: "app",
+			HdrJobStart: 1700000000000, HdrWellCo: "co", HdrWellName: "well", HdrWellLic: "lic",
+			HdrGeoLng: -114.0719, HdrGeoLat: 51.0447,
+		},
+		CFG: Config{
+			CfgTime: 1700000000003, CfgAddr: "SN0001", CfgUserID: "user", CfgApp: "app",
+			CfgSCVD: 596.8, CfgSCVDMult: 10.5, CfgSSPRate: 1.95, CfgSSPDur: 6000, CfgHiSCVF: 201,
+			CfgFlowTog: 1.85, CfgSSCVFDur: 6000, CfgVlvTgt: MODE_BUILD, CfgVlvPos: MODE_BUILD,
+			CfgOpSample: 1000, CfgOpLog: 1000, CfgOpTrans: 1000,
+			CfgDiagSample: 10000, CfgDiagLog: 100000, CfgDiagTrans: 600000,
+		},
+		EVT: Event{
+			EvtTime: 1700000000004, EvtAddr: "SN0001", EvtUserID: "user", EvtApp: "app",
+			EvtCode: OP_CODE_JOB_START_REQ, EvtTitle: "title", EvtMsg: "msg",
+		},
+	}
+}
+
+func TestPayloadRoundTrip(t *testing.T) {
+
+	in := testStartJob()
+	for _, enc := range []int32{ENCODING_JSON, ENCODING_BIN} {
+
+		models := []struct{ in, out interface{} }{
+			{&in.ADM, &Admin{}},
+			{&in.STA, &State{}},
+			{&in.HDR, &Header{}},
+			{&in.CFG, &Config{}},
+			{&in.EVT, &Event{}},
+			{&in, &StartJob{}},
+		}
+		for _, m := range models {
+			msg, err := EncodePayload(enc, m.in)
+			if err != nil {
+				t.Fatalf("encoding %d: %T: %s", enc, m.in, err)
+			}
+			if pkg.IsBinaryPayload([]byte(msg)) != (enc == ENCODING_BIN) {
+				t.Fatalf("encoding %d: %T: wrong payload format", enc, m.in)
+			}
+			if err := DecodePayload([]byte(msg), m.out); err != nil {
+				t.Fatalf("encoding %d: %T: %s", enc, m.in, err)
+			}
+			if !reflect.DeepEqual(m.in, m.out) {
+				t.Fatalf("encoding %d: round trip:\n%+v\n%+v", enc, m.in, m.out)
+			}
+		}
+	}
+}
+
+func TestPayloadBinaryTags(t *testing.T) {
+
+	/* TAGS ARE PART OF THE WIRE FORMAT; A FRAME WRITTEN WITH THESE TAGS MUST KEEP DECODING */
+	frame := []byte{pkg.BIN_MAGIC, BIN_SCHEMA,
+		1, 1, 2, // AdmTime = 1
+		2, 2, 'S', 'N', // AdmAddr = "SN"
+		6, 2, 0xB6, 0x1D, // AdmDefPort = 1883 ( zigzag varint )
+	}
+	adm := Admin{}
+	if err := DecodePayload(frame, &adm); err != nil {
+		t.Fatal(err)
+	}
+	if adm.AdmTime != 1 || adm.AdmAddr != "SN" || adm.AdmDefPort != 1883 {
+		t.Fatalf("decoded %+v", adm)
+	}
+}
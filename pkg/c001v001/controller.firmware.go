@@ -0,0 +1,447 @@
+package c001v001
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/leehayford/des/pkg"
+)
+
+/*
+FIRMWARE UPDATES
+
+THE FIRMWARE REGISTRY, INVENTORY AND CAMPAIGNS ARE KEPT BY THE DES ( pkg/des.firmware.go ); THIS FILE DELIVERS IMAGES TO C001V001 DEVICES
+  - A CAMPAIGN RELEASES ITS IMAGE TO A % OF ITS GROUP AT EACH STAGE; RELEASED DEVICES ARE SET TO FW_STATUS_PENDING
+  - PENDING DEVICES ARE SENT THE IMAGE IMMEDIATELY WHERE ONLINE, OTHERWISE WHEN THEY NEXT PUBLISH A STATE
+  - THE IMAGE IS PUBLISHED IN FirmwareChunks TO .../cmd/fw ( QOS 1 ); AN OP_CODE_FW_UPDATE_REQ EVENT IS LOGGED TO THE CMDARCHIVE
+  - THE DEVICE VERIFIES THE IMAGE SHA-256 AND REPORTS PROGRESS / OUTCOME AS EVENTS: OP_CODE_FW_PROGRESS ... OP_CODE_FW_FAILED
+  - FIRMWARE EVENT MESSAGES TAKE THE FORM <fw type>:<value>; SEE FirmwareEventMsg
+  - THE VERSIONS REPORTED IN State ( StaLogFw / StaModFw ) ARE THE DEVICE'S CURRENT VERSIONS
+*/
+const FW_CHUNK_SIZE = 8192 // Image bytes per FirmwareChunk ( before base64 encoding )
+
+/*
+FIRMWARE CHUNK PUBLISHED TO .../cmd/fw
+
+- Seq STARTS AT 0; THE IMAGE IS COMPLETE WHEN Seq = Total - 1 HAS BEEN RECEIVED
+- Data IS THE BASE64URL ENCODED IMAGE BYTES
+- THE DEVICE MUST VERIFY THE REASSEMBLED IMAGE AGAINST Size AND SHA256 BEFORE INSTALLING IT
+- FIELD NUMBERS ( tlv ) ARE PART OF THE DEVICE PROTOCOL; NEVER RENUMBER A FIELD
+*/
+type FirmwareChunk struct {
+	FwID    int64  `json:"fw_id" tlv:"1"`
+	Type    string `json:"typ" tlv:"2"`
+	Release string `json:"release" tlv:"3"`
+	SHA256  string `json:"sha256" tlv:"4"`
+	Size    int64  `json:"size" tlv:"5"`
+	Seq     int32  `json:"seq" tlv:"6"`
+	Total   int32  `json:"total" tlv:"7"`
+	Data    string `json:"data" tlv:"8"`
+}
+
+/* RETURNS THE EvtMsg OF A FIRMWARE EVENT */
+func FirmwareEventMsg(typ, val string) string {
+	return fmt.Sprintf("%s:%s", typ, val)
+}
+
+/* RETURNS THE FIRMWARE TYPE AND VALUE OF A FIRMWARE EVENT'S EvtMsg */
+func ParseFirmwareEventMsg(msg string) (typ, val string) {
+	typ, val, _ = strings.Cut(msg, ":")
+	return strings.TrimSpace(typ), strings.TrimSpace(val)
+}
+
+/* RETURNS TRUE WHERE THE EVENT IS A DEVICE'S FIRMWARE UPDATE REPORT */
+func IsFirmwareEvent(code int32) bool {
+	return code >= OP_CODE_FW_PROGRESS && code <= OP_CODE_FW_FAILED
+}
+
+/* RETURNS THE FIRMWARE VERSION OF THE GIVEN TYPE REPORTED IN THE STATE */
+func (sta State) FirmwareVersion(typ string) string {
+	switch typ {
+	case pkg.FW_TYPE_LOG:
+		return sta.StaLogFw
+	case pkg.FW_TYPE_MOD:
+		return sta.StaModFw
+	}
+	return ""
+}
+
+/*
+	SEND A FIRMWARE IMAGE TO THE DEVICE
+
+- RECORDS THE TARGET VERSION IN THE INVENTORY ( FW_STATUS_SENDING )
+- LOGS AN OP_CODE_FW_UPDATE_REQ EVENT TO THE CMDARCHIVE
+- PUBLISHES THE IMAGE IN A GO ROUTINE
+*/
+func (device *Device) SendFirmware(fw pkg.DESFirmware, campID int64, src, uid string) (err error) {
+
+	/* SYNC DEVICE WITH DevicesMap */
+	d := DevicesMapRead(device.DESDevSerial)
+	if d.DESDevSerial == "" {
+		return fmt.Errorf("Device %s is not connected", device.DESDevSerial)
+	}
+	device = &d
+
+	img, err := fw.Image()
+	if err != nil {
+		return
+	}
+
+	inv, err := pkg.GetFwDevice(device.DESDevSerial, fw.DESFwType)
+	if err != nil {
+		return
+	}
+	inv.DESFwDevTarget = fw.DESFwRelease
+	inv.DESFwDevFwID = fw.DESFwID
+	inv.DESFwDevCampID = campID
+	inv.DESFwDevStatus = pkg.FW_STATUS_SENDING
+	inv.DESFwDevProgress = 0
+	inv.DESFwDevMsg = ""
+	if err = pkg.WriteFwDevice(&inv); err != nil {
+		return
+	}
+
+	/* LOG THE FIRMWARE UPDATE REQUEST TO CMDARCHIVE */
+	evt := Event{
+		EvtTime:   time.Now().UTC().UnixMilli(),
+		EvtAddr:   src,
+		EvtUserID: uid,
+		EvtApp:    device.DESDevRegApp,
+		EvtCode:   OP_CODE_FW_UPDATE_REQ,
+		EvtMsg:    FirmwareEventMsg(fw.DESFwType, fw.DESFwRelease),
+	}
+	evt.Validate()
+	if err = WriteEVT(evt, &device.CmdDBC); err != nil {
+		return fmt.Errorf("SendFirmware CMD DB write failed: %s", err.Error())
+	}
+
+	go device.MQTTPublication_DeviceClient_CMDFirmware(fw, img)
+
+	return
+}
+
+/*
+	RECORD A FIRMWARE EVENT RECEIVED FROM THE DEVICE IN THE INVENTORY
+
+WHERE THE DEVICE'S UPDATE HAS ENDED, CHECKS WHETHER ITS CAMPAIGN IS COMPLETE
+*/
+func (device *Device) HandleFirmwareEvent(evt Event) {
+
+	typ, val := ParseFirmwareEventMsg(evt.EvtMsg)
+	inv, err := pkg.GetFwDevice(device.DESDevSerial, typ)
+	if err != nil {
+		pkg.LogErr(err)
+		return
+	}
+	if inv.DESFwDevID == 0 {
+		pkg.LogErr(fmt.Errorf("HandleFirmwareEvent( ) -> %s: no %s firmware update in progress", device.DESDevSerial, typ))
+		return
+	}
+
+	switch evt.EvtCode {
+
+	case OP_CODE_FW_PROGRESS:
+		if pct, err := strconv.Atoi(val); err == nil && pct >= 0 && pct <= 100 {
+			inv.DESFwDevProgress = int32(pct)
+		}
+		if inv.DESFwDevStatus == pkg.FW_STATUS_RECEIVED {
+			inv.DESFwDevStatus = pkg.FW_STATUS_INSTALLING
+		}
+
+	case OP_CODE_FW_RECEIVED:
+		inv.DESFwDevStatus = pkg.FW_STATUS_RECEIVED
+		inv.DESFwDevProgress = 0
+		inv.DESFwDevMsg = ""
+
+	case OP_CODE_FW_INSTALLED:
+		inv.DESFwDevCurrent = val
+		if val == inv.DESFwDevTarget {
+			inv.DESFwDevStatus = pkg.FW_STATUS_SUCCESS
+			inv.DESFwDevProgress = 100
+			inv.DESFwDevMsg = ""
+		} else {
+			inv.DESFwDevStatus = pkg.FW_STATUS_FAILED
+			inv.DESFwDevMsg = fmt.Sprintf("Installed %s; expected %s", val, inv.DESFwDevTarget)
+		}
+
+	case OP_CODE_FW_FAILED:
+		inv.DESFwDevStatus = pkg.FW_STATUS_FAILED
+		inv.DESFwDevMsg = val
+	}
+
+	if err = pkg.WriteFwDevice(&inv); err != nil {
+		pkg.LogErr(err)
+		return
+	}
+
+	if inv.DESFwDevStatus == pkg.FW_STATUS_SUCCESS || inv.DESFwDevStatus == pkg.FW_STATUS_FAILED {
+		CheckFwCampaignComplete(inv.DESFwDevCampID)
+	}
+}
+
+/*
+	RECORD THE FIRMWARE VERSIONS REPORTED IN A STATE
+
+WHERE THE DEVICE HAS BEEN RELEASED BY AN ACTIVE CAMPAIGN AND NOT YET SENT THE IMAGE, SEND IT NOW
+*/
+func (device *Device) UpdateFirmwareInventory(sta State) {
+
+	for _, typ := range []string{pkg.FW_TYPE_LOG, pkg.FW_TYPE_MOD} {
+
+		ver := sta.FirmwareVersion(typ)
+		if ver == "" {
+			continue
+		}
+
+		inv, err := pkg.UpdateFwDeviceCurrent(device.DESDevSerial, typ, ver)
+		if err != nil {
+			pkg.LogErr(err)
+			continue
+		}
+
+		switch inv.DESFwDevStatus {
+		case pkg.FW_STATUS_SUCCESS:
+			CheckFwCampaignComplete(inv.DESFwDevCampID)
+
+		case pkg.FW_STATUS_PENDING:
+			camp, err := pkg.GetFwCampaign(inv.DESFwDevCampID)
+			if err != nil || camp.DESFwCampStatus != pkg.FW_CAMP_ACTIVE {
+				continue
+			}
+			fw, err := pkg.GetFirmware(camp.DESFwCampFwID)
+			if err != nil {
+				pkg.LogErr(err)
+				continue
+			}
+			if err = device.SendFirmware(fw, camp.DESFwCampID, camp.DESFwCampRegAddr, camp.DESFwCampRegUserID); err != nil {
+				pkg.LogErr(err)
+			}
+		}
+	}
+}
+
+/* FIRMWARE CAMPAIGNS *****************************************************************************/
+
+/* RETURNS THE SERIALS OF EVERY C001V001 DEVICE ON THIS DES */
+func GetFwCampaignGroupAll() (serials []string, err error) {
+	regs, err := GetDeviceList()
+	if err != nil {
+		return
+	}
+	for _, reg := range regs {
+		if reg.DESDevClass == DEVICE_CLASS && reg.DESDevVersion == DEVICE_VERSION {
+			serials = append(serials, reg.DESDevSerial)
+		}
+	}
+	return
+}
+
+/* VALIDATE AND RECORD A NEW CAMPAIGN, THEN RELEASE ITS FIRST STAGE */
+func StartFwCampaign(camp *pkg.DESFwCampaign) (err error) {
+
+	fw, err := pkg.GetFirmware(camp.DESFwCampFwID)
+	if err != nil {
+		return fmt.Errorf("Firmware %d not found", camp.DESFwCampFwID)
+	}
+	if fw.DESFwClass != DEVICE_CLASS || fw.DESFwVersion != DEVICE_VERSION {
+		return fmt.Errorf("Firmware %d is for class %s version %s", fw.DESFwID, fw.DESFwClass, fw.DESFwVersion)
+	}
+	if _, err = camp.StagePercents(); err != nil {
+		return
+	}
+	if camp.DESFwCampGroup == "" {
+		return fmt.Errorf("Campaign group is required")
+	}
+
+	camp.DESFwCampID = 0
+	camp.DESFwCampRegTime = time.Now().UTC().UnixMilli()
+	camp.DESFwCampStage = 0
+	camp.DESFwCampStatus = pkg.FW_CAMP_ACTIVE
+	if err = pkg.WriteFwCampaign(camp); err != nil {
+		return
+	}
+
+	return ReleaseFwCampaignStage(*camp)
+}
+
+/*
+	RELEASE THE CAMPAIGN'S CURRENT STAGE
+
+DEVICES NOT ALREADY RUNNING OR RECEIVING THE CAMPAIGN FIRMWARE ARE SET TO FW_STATUS_PENDING;
+THOSE ONLINE ARE SENT THE IMAGE IMMEDIATELY
+
+DEVICES THIS CAMPAIGN LEFT PENDING ( EX: WHILE PAUSED ) ARE SENT AGAIN WHERE ONLINE
+*/
+func ReleaseFwCampaignStage(camp pkg.DESFwCampaign) (err error) {
+
+	fw, err := pkg.GetFirmware(camp.DESFwCampFwID)
+	if err != nil {
+		return
+	}
+
+	group := camp.GroupSerials()
+	if strings.TrimSpace(camp.DESFwCampGroup) == pkg.FW_CAMP_GROUP_ALL {
+		if group, err = GetFwCampaignGroupAll(); err != nil {
+			return
+		}
+	}
+
+	serials, err := camp.StageSerials(group)
+	if err != nil {
+		return
+	}
+
+	for _, serial := range serials {
+
+		inv, err := pkg.GetFwDevice(serial, fw.DESFwType)
+		if err != nil {
+			pkg.LogErr(err)
+			continue
+		}
+
+		/* ALREADY RUNNING THIS RELEASE */
+		if inv.DESFwDevCurrent == fw.DESFwRelease {
+			continue
+		}
+
+		if inv.DESFwDevCampID == camp.DESFwCampID && inv.DESFwDevStatus != pkg.FW_STATUS_FAILED {
+			/* ALREADY RELEASED BY THIS CAMPAIGN; ONLY DEVICES STILL PENDING ARE QUEUED AGAIN ( EX: ON RESUME ) */
+			if inv.DESFwDevStatus != pkg.FW_STATUS_PENDING {
+				continue
+			}
+		} else {
+			inv.DESFwDevTarget = fw.DESFwRelease
+			inv.DESFwDevFwID = fw.DESFwID
+			inv.DESFwDevCampID = camp.DESFwCampID
+			inv.DESFwDevStatus = pkg.FW_STATUS_PENDING
+			inv.DESFwDevProgress = 0
+			inv.DESFwDevMsg = ""
+			if err = pkg.WriteFwDevice(&inv); err != nil {
+				pkg.LogErr(err)
+				continue
+			}
+		}
+
+		if DevicePingsMapRead(serial).OK {
+			device := DevicesMapRead(serial)
+			if err = device.SendFirmware(fw, camp.DESFwCampID, camp.DESFwCampRegAddr, camp.DESFwCampRegUserID); err != nil {
+				pkg.LogErr(err)
+			}
+		}
+	}
+
+	CheckFwCampaignComplete(camp.DESFwCampID)
+	return
+}
+
+/*
+	RELEASE THE CAMPAIGN'S NEXT STAGE
+
+REFUSED WHILE DEVICES OF THE CURRENT STAGE HAVE FAILED, UNLESS force IS SET
+*/
+func AdvanceFwCampaign(id int64, force bool) (camp pkg.DESFwCampaign, err error) {
+
+	if camp, err = pkg.GetFwCampaign(id); err != nil {
+		return
+	}
+	if camp.DESFwCampStatus != pkg.FW_CAMP_ACTIVE && camp.DESFwCampStatus != pkg.FW_CAMP_PAUSED {
+		return camp, fmt.Errorf("Campaign %d is %s", id, camp.DESFwCampStatus)
+	}
+
+	pcts, err := camp.StagePercents()
+	if err != nil {
+		return
+	}
+	if camp.DESFwCampStage+1 >= len(pcts) {
+		return camp, fmt.Errorf("Campaign %d has released its final stage", id)
+	}
+
+	counts, err := camp.StatusCounts()
+	if err != nil {
+		return
+	}
+	if counts[pkg.FW_STATUS_FAILED] > 0 && !force {
+		return camp, fmt.Errorf("Campaign %d has %d failed devices", id, counts[pkg.FW_STATUS_FAILED])
+	}
+
+	camp.DESFwCampStage++
+	camp.DESFwCampStatus = pkg.FW_CAMP_ACTIVE
+	if err = pkg.WriteFwCampaign(&camp); err != nil {
+		return
+	}
+
+	err = ReleaseFwCampaignStage(camp)
+	return
+}
+
+/*
+	PAUSE, RESUME OR CANCEL A CAMPAIGN
+
+WHILE PAUSED OR CANCELLED, PENDING DEVICES ARE NOT SENT THE IMAGE; TRANSFERS ALREADY UNDER WAY CONTINUE
+*/
+func SetFwCampaignStatus(id int64, status string) (camp pkg.DESFwCampaign, err error) {
+
+	if camp, err = pkg.GetFwCampaign(id); err != nil {
+		return
+	}
+
+	switch status {
+	case pkg.FW_CAMP_ACTIVE, pkg.FW_CAMP_PAUSED, pkg.FW_CAMP_CANCELLED:
+	default:
+		return camp, fmt.Errorf("Invalid campaign status: %s", status)
+	}
+	if camp.DESFwCampStatus == pkg.FW_CAMP_COMPLETE || camp.DESFwCampStatus == pkg.FW_CAMP_CANCELLED {
+		return camp, fmt.Errorf("Campaign %d is %s", id, camp.DESFwCampStatus)
+	}
+
+	camp.DESFwCampStatus = status
+	if err = pkg.WriteFwCampaign(&camp); err != nil {
+		return
+	}
+
+	/* RESUMING; SEND PENDING DEVICES THAT ARE ONLINE */
+	if status == pkg.FW_CAMP_ACTIVE {
+		err = ReleaseFwCampaignStage(camp)
+	}
+	return
+}
+
+/* MARK THE CAMPAIGN COMPLETE WHERE ITS FINAL STAGE IS RELEASED AND NO DEVICE UPDATE REMAINS UNDER WAY */
+func CheckFwCampaignComplete(id int64) {
+
+	if id == 0 {
+		return
+	}
+	camp, err := pkg.GetFwCampaign(id)
+	if err != nil || camp.DESFwCampStatus != pkg.FW_CAMP_ACTIVE {
+		return
+	}
+
+	pcts, err := camp.StagePercents()
+	if err != nil || camp.DESFwCampStage < len(pcts)-1 {
+		return
+	}
+
+	counts, err := camp.StatusCounts()
+	if err != nil {
+		pkg.LogErr(err)
+		return
+	}
+	for _, sts := range []string{
+		pkg.FW_STATUS_PENDING,
+		pkg.FW_STATUS_SENDING,
+		pkg.FW_STATUS_RECEIVED,
+		pkg.FW_STATUS_INSTALLING,
+	} {
+		if counts[sts] > 0 {
+			return
+		}
+	}
+
+	camp.DESFwCampStatus = pkg.FW_CAMP_COMPLETE
+	if err = pkg.WriteFwCampaign(&camp); err != nil {
+		pkg.LogErr(err)
+	}
+}
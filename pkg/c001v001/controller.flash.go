@@ -0,0 +1,750 @@
+package c001v001
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/leehayford/des/pkg"
+)
+
+/*
+DEVICE FLASH BULK UPLOAD
+
+WHILE A DEVICE IS OFFLINE, IT CONTINUES TO LOG TO FLASH; THOSE RECORDS NEVER REACH THE DES
+A FLASH DUMP ( RAW BINARY OR INTEL HEX ) OF EACH RECORD TYPE MAY BE UPLOADED
+  - BY HTTP ( HandleFlashUpload ) OR BY MQTT IN CHUNKS ( MQTTSubscription_DeviceClient_SIGFlash )
+  - EVERY RECORD IS DECODED USING THE XxxFromBytes FUNCTIONS
+  - RECORDS ARE ASSIGNED TO JOBS USING THE STATE RECORDS IN THE DUMP ( StaLogging / StaJobName )
+  - RECORDS ALREADY STORED IN THE JOB DATABASE ARE SKIPPED
+  - JOBS THE DES NEVER SAW ARE REGISTERED AND THEIR DATABASES CREATED
+*/
+const FLASH_ADM_SIZE = 284 // Admin.AdminToBytes
+const FLASH_STA_SIZE = 192 // State.StateToBytes
+const FLASH_HDR_SIZE = 308 // Header.HeaderToBytes
+const FLASH_CFG_SIZE = 176 // Config.ConfigToBytes
+const FLASH_EVT_SIZE = 668 // Event.EventToBytes
+const FLASH_SMP_SIZE = 40  // Sample.SampleToBytes
+
+/*
+FLASH RECORD LAYOUTS, FROM THE flash TAGS OF EACH MODEL ( SEE pkg.FlashLayout )
+
+VERIFIED AT STARTUP; A TAG THAT NO LONGER MATCHES THE RECORD SIZE THE FIRMWARE WRITES STOPS THE DES
+*/
+var FLASH_ADM_LAYOUT = pkg.MustFlashLayout(Admin{}, FLASH_ADM_SIZE)
+var FLASH_STA_LAYOUT = pkg.MustFlashLayout(State{}, FLASH_STA_SIZE)
+var FLASH_HDR_LAYOUT = pkg.MustFlashLayout(Header{}, FLASH_HDR_SIZE)
+var FLASH_CFG_LAYOUT = pkg.MustFlashLayout(Config{}, FLASH_CFG_SIZE)
+var FLASH_EVT_LAYOUT = pkg.MustFlashLayout(Event{}, FLASH_EVT_SIZE)
+var FLASH_SMP_LAYOUT = pkg.MustFlashLayout(Sample{}, FLASH_SMP_SIZE)
+
+const FLASH_TYPE_ADM = "adm"
+const FLASH_TYPE_STA = "sta"
+const FLASH_TYPE_HDR = "hdr"
+const FLASH_TYPE_CFG = "cfg"
+const FLASH_TYPE_EVT = "evt"
+const FLASH_TYPE_SMP = "smp"
+
+var FLASH_TYPES = []string{
+	FLASH_TYPE_ADM,
+	FLASH_TYPE_STA,
+	FLASH_TYPE_HDR,
+	FLASH_TYPE_CFG,
+	FLASH_TYPE_EVT,
+	FLASH_TYPE_SMP,
+}
+
+const FLASH_CHUNK_TIMEOUT int64 = 300000 // 5 minutes; an MQTT transfer with no new chunk for this long is dropped
+
+type FlashRecords struct {
+	ADMs []Admin  `json:"adms"`
+	STAs []State  `json:"stas"`
+	HDRs []Header `json:"hdrs"`
+	CFGs []Config `json:"cfgs"`
+	EVTs []Event  `json:"evts"`
+	SMPs []Sample `json:"smps"`
+}
+
+type FlashCounts struct {
+	ADM int `json:"adm"`
+	STA int `json:"sta"`
+	HDR int `json:"hdr"`
+	CFG int `json:"cfg"`
+	EVT int `json:"evt"`
+	SMP int `json:"smp"`
+}
+
+type FlashJobSummary struct {
+	JobName    string      `json:"job_name"`
+	Created    bool        `json:"created"`    // The DES had no record of this job; it was registered from the flash records
+	Added      FlashCounts `json:"added"`      // Records written to this job's database
+	Duplicates FlashCounts `json:"duplicates"` // Records already in this job's database
+	Err        string      `json:"err,omitempty"`
+}
+
+type FlashUploadSummary struct {
+	DESDevSerial string            `json:"des_dev_serial"`
+	Received     FlashCounts       `json:"received"` // Records decoded from the upload
+	Jobs         []FlashJobSummary `json:"jobs"`
+	Err          string            `json:"err,omitempty"`
+}
+
+/* RETURNS THE NUMBER OF RECORDS OF EACH TYPE */
+func (recs *FlashRecords) Counts() FlashCounts {
+	return FlashCounts{
+		ADM: len(recs.ADMs),
+		STA: len(recs.STAs),
+		HDR: len(recs.HDRs),
+		CFG: len(recs.CFGs),
+		EVT: len(recs.EVTs),
+		SMP: len(recs.SMPs),
+	}
+}
+
+/*
+	DECODES A FLASH DUMP OF ONE RECORD TYPE AND ADDS THE RECORDS TO recs
+
+- buf MAY BE RAW BYTES OR INTEL HEX ( pkg.FlashBytes )
+- ERASED FLASH ( ALL 0xFF ) IS SKIPPED
+*/
+func (recs *FlashRecords) ParseFlash(typ string, buf []byte) (err error) {
+
+	if buf, err = pkg.FlashBytes(buf); err != nil {
+		return
+	}
+
+	size := FlashRecordSize(typ)
+	if size == 0 {
+		return fmt.Errorf("Unknown flash record type: %s", typ)
+	}
+	if len(buf)%size != 0 {
+		return fmt.Errorf("Flash %s: %d bytes is not a multiple of the %d byte record size", typ, len(buf), size)
+	}
+
+	for i := 0; i < len(buf); i += size {
+		b := buf[i : i+size]
+		if FlashErased(b) {
+			continue
+		}
+
+		switch typ {
+		case FLASH_TYPE_ADM:
+			adm := Admin{}
+			adm.AdminFromBytes(b)
+			recs.ADMs = append(recs.ADMs, adm)
+
+		case FLASH_TYPE_STA:
+			sta := State{}
+			sta.StateFromBytes(b)
+			recs.STAs = append(recs.STAs, sta)
+
+		case FLASH_TYPE_HDR:
+			hdr := Header{}
+			hdr.HeaderFromBytes(b)
+			recs.HDRs = append(recs.HDRs, hdr)
+
+		case FLASH_TYPE_CFG:
+			cfg := Config{}
+			cfg.ConfigFromBytes(b)
+			recs.CFGs = append(recs.CFGs, cfg)
+
+		case FLASH_TYPE_EVT:
+			evt := Event{}
+			evt.EventFromBytes(b)
+			recs.EVTs = append(recs.EVTs, evt)
+
+		case FLASH_TYPE_SMP:
+			smp := Sample{}
+			smp.SampleFromBytes(b)
+			recs.SMPs = append(recs.SMPs, smp)
+		}
+	}
+	return
+}
+
+/* RETURNS THE SIZE IN FLASH OF ONE RECORD OF THIS TYPE; 0 IF THE TYPE IS UNKNOWN */
+func FlashRecordSize(typ string) int {
+	switch typ {
+	case FLASH_TYPE_ADM:
+		return FLASH_ADM_SIZE
+	case FLASH_TYPE_STA:
+		return FLASH_STA_SIZE
+	case FLASH_TYPE_HDR:
+		return FLASH_HDR_SIZE
+	case FLASH_TYPE_CFG:
+		return FLASH_CFG_SIZE
+	case FLASH_TYPE_EVT:
+		return FLASH_EVT_SIZE
+	case FLASH_TYPE_SMP:
+		return FLASH_SMP_SIZE
+	}
+	return 0
+}
+
+/* RETURNS TRUE WHERE THE RECORD HAS NEVER BEEN WRITTEN ( ERASED FLASH ) */
+func FlashErased(b []byte) bool {
+	for _, v := range b {
+		if v != 0xFF {
+			return false
+		}
+	}
+	return true
+}
+
+/* RETURNS TRUE WHERE THE DEVICE IS LOGGING TO A JOB IN THIS STATE */
+func StaJobRunning(sta State) bool {
+	switch sta.StaLogging {
+	case OP_CODE_JOB_STARTED, OP_CODE_JOB_END_REQ, OP_CODE_JOB_OFFLINE_START:
+		return true
+	}
+	return false
+}
+
+/*
+	SPLITS THE RECORDS BY THE JOB THE DEVICE WAS RUNNING WHEN EACH RECORD WAS LOGGED
+
+- WHERE jobName IS SET, ALL RECORDS BELONG TO jobName
+- OTHERWISE, THE LAST STATE AT OR BEFORE EACH RECORD DECIDES THE JOB; RECORDS LOGGED WHILE NOT RUNNING A JOB BELONG TO THE CMDARCHIVE
+- ADM, STA, HDR, CFG, AND EVT RECORDS ARE ALSO KEPT IN THE CMDARCHIVE ( AS THEY ARE WHEN RECEIVED BY MQTT )
+
+RETURNS THE JOB NAMES IN ORDER OF FIRST APPEARANCE
+*/
+func (device *Device) SplitFlashByJob(recs FlashRecords, jobName string) (names []string, jobs map[string]*FlashRecords) {
+
+	cmd := device.CmdArchiveName()
+	jobs = make(map[string]*FlashRecords)
+
+	stas := append([]State{}, recs.STAs...)
+	sort.SliceStable(stas, func(i, j int) bool { return stas[i].StaTime < stas[j].StaTime })
+
+	jobAt := func(t int64) string {
+		if jobName != "" {
+			return jobName
+		}
+		name := cmd
+		for _, sta := range stas {
+			if sta.StaTime > t {
+				break
+			}
+			name = cmd
+			if StaJobRunning(sta) && sta.StaJobName != "" {
+				name = sta.StaJobName
+			}
+		}
+		return name
+	}
+
+	get := func(name string) *FlashRecords {
+		if jobs[name] == nil {
+			jobs[name] = &FlashRecords{}
+			names = append(names, name)
+		}
+		return jobs[name]
+	}
+
+	/* CMDARCHIVE FIRST SO NEW JOBS ARE REGISTERED AFTER THE DEVICE DEFAULTS ARE UP TO DATE */
+	if len(recs.ADMs)+len(recs.STAs)+len(recs.HDRs)+len(recs.CFGs)+len(recs.EVTs) > 0 {
+		get(cmd)
+	}
+
+	for _, adm := range recs.ADMs {
+		jobs[cmd].ADMs = append(jobs[cmd].ADMs, adm)
+		if name := jobAt(adm.AdmTime); name != cmd {
+			r := get(name)
+			r.ADMs = append(r.ADMs, adm)
+		}
+	}
+	for _, sta := range recs.STAs {
+		jobs[cmd].STAs = append(jobs[cmd].STAs, sta)
+		/* A JOB'S END STATE BELONGS TO THAT JOB */
+		name := jobAt(sta.StaTime)
+		if name == cmd && jobName == "" && sta.StaJobName != cmd && sta.StaJobName != "" {
+			name = sta.StaJobName
+		}
+		if name != cmd {
+			r := get(name)
+			r.STAs = append(r.STAs, sta)
+		}
+	}
+	for _, hdr := range recs.HDRs {
+		jobs[cmd].HDRs = append(jobs[cmd].HDRs, hdr)
+		if name := jobAt(hdr.HdrTime); name != cmd {
+			r := get(name)
+			r.HDRs = append(r.HDRs, hdr)
+		}
+	}
+	for _, cfg := range recs.CFGs {
+		jobs[cmd].CFGs = append(jobs[cmd].CFGs, cfg)
+		if name := jobAt(cfg.CfgTime); name != cmd {
+			r := get(name)
+			r.CFGs = append(r.CFGs, cfg)
+		}
+	}
+	for _, evt := range recs.EVTs {
+		jobs[cmd].EVTs = append(jobs[cmd].EVTs, evt)
+		if name := jobAt(evt.EvtTime); name != cmd {
+			r := get(name)
+			r.EVTs = append(r.EVTs, evt)
+		}
+	}
+	for _, smp := range recs.SMPs {
+		name := jobAt(smp.SmpTime)
+		smp.SmpJobName = name
+		r := get(name)
+		r.SMPs = append(r.SMPs, smp)
+	}
+	return
+}
+
+/*
+	WRITES THE FLASH RECORDS TO THE CORRECT JOB DATABASES; RETURNS A SUMMARY OF WHAT WAS ADDED
+
+- device MUST BE READ FROM THE DevicesMap SO THE ACTIVE JOB AND CMDARCHIVE CONNECTIONS ARE SHARED
+*/
+func (device *Device) BackfillFlash(recs FlashRecords, jobName string) (sum FlashUploadSummary) {
+
+	sum.DESDevSerial = device.DESDevSerial
+	sum.Received = recs.Counts()
+
+	names, jobs := device.SplitFlashByJob(recs, jobName)
+	for _, name := range names {
+		job, err := device.BackfillFlashJob(name, *jobs[name])
+		if err != nil {
+			job.Err = err.Error()
+			pkg.LogErr(err)
+		}
+		sum.Jobs = append(sum.Jobs, job)
+	}
+	return
+}
+
+/* WRITES THE RECORDS NOT ALREADY STORED IN THIS JOB'S DATABASE */
+func (device *Device) BackfillFlashJob(name string, recs FlashRecords) (sum FlashJobSummary, err error) {
+
+	sum.JobName = name
+
+	/* USE THE DEVICE CLIENT'S CONNECTIONS WHERE THEY EXIST; THEY CARRY THE RWMutex FOR ANY PENDING WRITES */
+	var jdbc *pkg.JobDBClient
+	switch {
+	case name == device.CmdArchiveName() && device.CmdDBC.DB != nil:
+		jdbc = &device.CmdDBC
+
+	case name == device.DESJobName && device.JobDBC.DB != nil:
+		jdbc = &device.JobDBC
+
+	default:
+		if sum.Created, err = device.RegisterFlashJob(name, recs); err != nil {
+			return
+		}
+		dbc, err := pkg.GetJobDBClient(name)
+		if err != nil {
+			return sum, err
+		}
+		if err = dbc.Connect(); err != nil {
+			return sum, err
+		}
+		defer dbc.Disconnect()
+
+		if !dbc.Migrator().HasTable(&Sample{}) {
+			if err = CreateJobDBTables(&dbc); err != nil {
+				return sum, err
+			}
+		}
+		jdbc = &dbc
+	}
+
+	/* ADMIN */
+	keys := FlashStoredKeys(jdbc, "admins", "adm_time", "adm_addr")
+	for _, adm := range recs.ADMs {
+		if keys[FlashKey(adm.AdmTime, adm.AdmAddr)] {
+			sum.Duplicates.ADM++
+			continue
+		}
+		if err = WriteADM(adm, jdbc); err != nil {
+			return
+		}
+		keys[FlashKey(adm.AdmTime, adm.AdmAddr)] = true
+		sum.Added.ADM++
+	}
+
+	/* STATE */
+	keys = FlashStoredKeys(jdbc, "states", "sta_time", "sta_addr")
+	for _, sta := range recs.STAs {
+		if keys[FlashKey(sta.StaTime, sta.StaAddr)] {
+			sum.Duplicates.STA++
+			continue
+		}
+		if err = WriteSTA(sta, jdbc); err != nil {
+			return
+		}
+		keys[FlashKey(sta.StaTime, sta.StaAddr)] = true
+		sum.Added.STA++
+	}
+
+	/* HEADER */
+	keys = FlashStoredKeys(jdbc, "headers", "hdr_time", "hdr_addr")
+	for _, hdr := range recs.HDRs {
+		if keys[FlashKey(hdr.HdrTime, hdr.HdrAddr)] {
+			sum.Duplicates.HDR++
+			continue
+		}
+		if err = WriteHDR(hdr, jdbc); err != nil {
+			return
+		}
+		keys[FlashKey(hdr.HdrTime, hdr.HdrAddr)] = true
+		sum.Added.HDR++
+	}
+
+	/* CONFIG */
+	keys = FlashStoredKeys(jdbc, "configs", "cfg_time", "cfg_addr")
+	for _, cfg := range recs.CFGs {
+		if keys[FlashKey(cfg.CfgTime, cfg.CfgAddr)] {
+			sum.Duplicates.CFG++
+			continue
+		}
+		if err = WriteCFG(cfg, jdbc); err != nil {
+			return
+		}
+		keys[FlashKey(cfg.CfgTime, cfg.CfgAddr)] = true
+		sum.Added.CFG++
+	}
+
+	/* EVENT */
+	keys = FlashStoredKeys(jdbc, "events", "evt_time", "evt_addr")
+	for _, evt := range recs.EVTs {
+		if keys[FlashKey(evt.EvtTime, evt.EvtAddr)] {
+			sum.Duplicates.EVT++
+			continue
+		}
+		if err = WriteEVT(evt, jdbc); err != nil {
+			return
+		}
+		keys[FlashKey(evt.EvtTime, evt.EvtAddr)] = true
+		sum.Added.EVT++
+	}
+
+	/* SAMPLE; ONE SAMPLE PER TIME STAMP */
+	keys = FlashStoredKeys(jdbc, "samples", "smp_time", "")
+	smps := []Sample{}
+	for _, smp := range recs.SMPs {
+		if keys[FlashKey(smp.SmpTime, "")] {
+			sum.Duplicates.SMP++
+			continue
+		}
+		keys[FlashKey(smp.SmpTime, "")] = true
+		smps = append(smps, smp)
+	}
+	if len(smps) > 0 {
+		if err = WriteSMPs(smps, jdbc); err != nil {
+			return
+		}
+		sum.Added.SMP = len(smps)
+	}
+
+	return
+}
+
+/* RETURNS THE DE-DUPLICATION KEY FOR A RECORD */
+func FlashKey(t int64, addr string) string {
+	return fmt.Sprintf("%d|%s", t, addr)
+}
+
+/* RETURNS THE DE-DUPLICATION KEYS OF ALL RECORDS IN table; addrCol MAY BE EMPTY */
+func FlashStoredKeys(jdbc *pkg.JobDBClient, table, timeCol, addrCol string) (keys map[string]bool) {
+
+	keys = make(map[string]bool)
+
+	sel := fmt.Sprintf("%s AS time, '' AS addr", timeCol)
+	if addrCol != "" {
+		sel = fmt.Sprintf("%s AS time, %s AS addr", timeCol, addrCol)
+	}
+
+	rows := []struct {
+		Time int64
+		Addr string
+	}{}
+	jdbc.RWM.Lock()
+	res := jdbc.Table(table).Select(sel).Scan(&rows)
+	jdbc.RWM.Unlock()
+	if res.Error != nil {
+		pkg.LogErr(res.Error)
+	}
+
+	for _, r := range rows {
+		keys[FlashKey(r.Time, r.Addr)] = true
+	}
+	return
+}
+
+/*
+	ENSURES A DES JOB RECORD EXISTS FOR A JOB FOUND IN DEVICE FLASH; RETURNS TRUE IF ONE WAS CREATED
+
+THE JOB RUNS FROM ITS FIRST RUNNING STATE TO THE FIRST STATE THAT ENDS IT,
+OR TO ITS LAST RECORD WHERE THE END WAS NOT UPLOADED
+*/
+func (device *Device) RegisterFlashJob(name string, recs FlashRecords) (created bool, err error) {
+
+	job := pkg.DESJob{}
+	res := pkg.DES.DB.Where("des_job_name = ?", name).Limit(1).Find(&job)
+	if res.Error != nil {
+		return false, res.Error
+	}
+	if res.RowsAffected > 0 {
+		return
+	}
+
+	start, end := int64(0), int64(0)
+	stas := append([]State{}, recs.STAs...)
+	sort.SliceStable(stas, func(i, j int) bool { return stas[i].StaTime < stas[j].StaTime })
+	for _, sta := range stas {
+		if start == 0 && StaJobRunning(sta) {
+			start = sta.StaTime
+		} else if start > 0 && !StaJobRunning(sta) {
+			end = sta.StaTime
+			break
+		}
+	}
+
+	first, last := recs.TimeSpan()
+	if start == 0 {
+		start = first
+	}
+	if end == 0 {
+		end = last
+	}
+	if start == 0 {
+		start = time.Now().UTC().UnixMilli()
+	}
+	if end == 0 {
+		/* A JOB WITH NO END WOULD BE TAKEN AS THE DEVICE'S ACTIVE JOB */
+		end = start
+	}
+
+	hdr := Header{}
+	hdr.DefaultSettings_Header(device.DESRegistration)
+	if len(recs.HDRs) > 0 {
+		hdr = recs.HDRs[len(recs.HDRs)-1]
+	}
+
+	reg := device.DESRegistration
+	reg.DESJob = pkg.DESJob{
+		DESJobRegTime:   start,
+		DESJobRegAddr:   device.DESDevSerial,
+		DESJobRegUserID: device.DESU.GetUUIDString(),
+		DESJobRegApp:    pkg.DES_APP,
+
+		DESJobName:  name,
+		DESJobStart: start,
+		DESJobEnd:   end,
+		DESJobLng:   DEFAULT_GEO_LNG,
+		DESJobLat:   DEFAULT_GEO_LAT,
+		DESJobDevID: device.DESDevID,
+	}
+	if hdr.HdrGeoLng >= DEFAULT_GEO_LNG {
+		reg.DESJobLng = hdr.HdrGeoLng
+		reg.DESJobLat = hdr.HdrGeoLat
+	}
+
+	if err = pkg.WriteDESJob(&reg.DESJob); err != nil {
+		return
+	}
+
+	recs.Create_DESJobSearch(reg, hdr)
+
+	return true, nil
+}
+
+/* CREATE DESJobSearch RECORD FROM THE LAST OF THIS JOB'S RECORDS */
+func (recs *FlashRecords) Create_DESJobSearch(reg pkg.DESRegistration, hdr Header) {
+	d := Device{DESRegistration: reg, HDR: hdr}
+	if len(recs.ADMs) > 0 {
+		d.ADM = recs.ADMs[len(recs.ADMs)-1]
+	}
+	if len(recs.STAs) > 0 {
+		d.STA = recs.STAs[len(recs.STAs)-1]
+	}
+	if len(recs.CFGs) > 0 {
+		d.CFG = recs.CFGs[len(recs.CFGs)-1]
+	}
+	if len(recs.EVTs) > 0 {
+		d.EVT = recs.EVTs[len(recs.EVTs)-1]
+	}
+	d.Create_DESJobSearch(reg)
+}
+
+/* RETURNS THE EARLIEST AND LATEST RECORD TIMES */
+func (recs *FlashRecords) TimeSpan() (first, last int64) {
+	add := func(t int64) {
+		if t <= 0 {
+			return
+		}
+		if first == 0 || t < first {
+			first = t
+		}
+		if t > last {
+			last = t
+		}
+	}
+	for _, r := range recs.ADMs {
+		add(r.AdmTime)
+	}
+	for _, r := range recs.STAs {
+		add(r.StaTime)
+	}
+	for _, r := range recs.HDRs {
+		add(r.HdrTime)
+	}
+	for _, r := range recs.CFGs {
+		add(r.CfgTime)
+	}
+	for _, r := range recs.EVTs {
+		add(r.EvtTime)
+	}
+	for _, r := range recs.SMPs {
+		add(r.SmpTime)
+	}
+	return
+}
+
+/* MQTT CHUNKED TRANSFER *************************************************************************/
+
+/*
+	ONE CHUNK OF A FLASH TRANSFER, PUBLISHED BY THE DEVICE TO .../sig/flash
+
+- Seq STARTS AT 0 FOR EACH TRANSFER AND INCREMENTS BY 1 FOR EVERY CHUNK, ACROSS ALL RECORD TYPES
+- Data IS THE BASE64URL ENCODED FLASH BYTES OF ONE RECORD TYPE
+- THE CHUNK WITH Last = true ENDS THE TRANSFER; THE RECORDS ARE THEN WRITTEN AND THE SUMMARY PUBLISHED TO .../des/flash
+- CHUNKS ARE SENT AT QoS 1; THE DES ACKNOWLEDGES EVERY CHUNK ON .../des/flash_ack ( FlashChunkAck )
+  - THE DEVICE SENDS THE NEXT CHUNK ONLY ONCE THE PREVIOUS CHUNK IS ACKNOWLEDGED
+  - WHERE NO ACK ARRIVES, THE DEVICE RESENDS THE SAME CHUNK
+  - A CHUNK THE DES ALREADY HOLDS IS ACKNOWLEDGED AGAIN, NOT APPENDED
+- FIELD NUMBERS ( tlv ) ARE PART OF THE DEVICE PROTOCOL; NEVER RENUMBER A FIELD
+*/
+type FlashChunk struct {
+	JobName string `json:"job_name" tlv:"1"`
+	Type    string `json:"typ" tlv:"2"`
+	Seq     int32  `json:"seq" tlv:"3"`
+	Last    bool   `json:"last" tlv:"4"`
+	Data    string `json:"data" tlv:"5"`
+}
+
+/*
+	THE DES'S REPLY TO EACH FlashChunk, PUBLISHED TO .../des/flash_ack
+
+- Next IS THE Seq THE DES EXPECTS NEXT; WHERE Err IS SET, THE TRANSFER WAS DROPPED AND THE DEVICE MUST START AGAIN AT Seq 0
+*/
+type FlashChunkAck struct {
+	JobName string `json:"job_name"`
+	Seq     int32  `json:"seq"`
+	Next    int32  `json:"next"`
+	Err     string `json:"err,omitempty"`
+}
+
+type FlashTransfer struct {
+	JobName string
+	Seq     int32
+	Updated int64
+	Done    bool // The last chunk has been received; kept so a resent last chunk is acknowledged, not processed again
+	Bufs    map[string][]byte
+}
+
+var FlashTransfers = make(map[string]FlashTransfer)
+var FlashTransfersRWMutex = sync.RWMutex{}
+
+/* WRITE TO THE FlashTransfers MAP */
+func FlashTransfersMapWrite(serial string, ft FlashTransfer) {
+	FlashTransfersRWMutex.Lock()
+	FlashTransfers[serial] = ft
+	FlashTransfersRWMutex.Unlock()
+}
+
+/* READ FROM THE FlashTransfers MAP; RETURNS FlashTransfer */
+func FlashTransfersMapRead(serial string) (ft FlashTransfer) {
+	FlashTransfersRWMutex.Lock()
+	ft = FlashTransfers[serial]
+	FlashTransfersRWMutex.Unlock()
+	return
+}
+
+/* REMOVE DEVICE FROM FlashTransfers MAP */
+func FlashTransfersMapRemove(serial string) {
+	FlashTransfersRWMutex.Lock()
+	delete(FlashTransfers, serial)
+	FlashTransfersRWMutex.Unlock()
+}
+
+/*
+	ADDS A CHUNK TO THIS DEVICE'S FLASH TRANSFER; RETURNS done WHEN THE LAST CHUNK HAS BEEN RECEIVED
+
+- A RESENT CHUNK ( THE CHUNK BEFORE THE ONE EXPECTED ) IS NOT APPENDED AGAIN; dup IS SET SO IT CAN BE RE-ACKNOWLEDGED
+- A CHUNK OUT OF SEQUENCE ABORTS THE TRANSFER; THE DEVICE MUST START AGAIN AT Seq 0
+*/
+func (device *Device) AppendFlashChunk(chunk FlashChunk) (ft FlashTransfer, done, dup bool, err error) {
+
+	now := time.Now().UTC().UnixMilli()
+	ft = FlashTransfersMapRead(device.DESDevSerial)
+
+	if ft.Bufs != nil && now-ft.Updated <= FLASH_CHUNK_TIMEOUT &&
+		ft.Seq > 0 && chunk.Seq == ft.Seq-1 && chunk.JobName == ft.JobName {
+		return ft, false, true, nil
+	}
+
+	if chunk.Seq == 0 || ft.Bufs == nil || ft.Done || now-ft.Updated > FLASH_CHUNK_TIMEOUT {
+		ft = FlashTransfer{JobName: chunk.JobName, Bufs: make(map[string][]byte)}
+	}
+
+	if chunk.Seq != ft.Seq {
+		FlashTransfersMapRemove(device.DESDevSerial)
+		return ft, false, false, fmt.Errorf("Flash transfer: expected chunk %d, received %d", ft.Seq, chunk.Seq)
+	}
+
+	if chunk.Type != "" {
+		if FlashRecordSize(chunk.Type) == 0 {
+			FlashTransfersMapRemove(device.DESDevSerial)
+			return ft, false, false, fmt.Errorf("Unknown flash record type: %s", chunk.Type)
+		}
+		b, err := pkg.Base64URLToBytes(chunk.Data)
+		if err != nil {
+			FlashTransfersMapRemove(device.DESDevSerial)
+			return ft, false, false, err
+		}
+		ft.Bufs[chunk.Type] = append(ft.Bufs[chunk.Type], b...)
+	}
+
+	ft.Seq++
+	ft.Updated = now
+
+	if chunk.Last {
+		/* KEEP ONLY WHAT IS NEEDED TO RE-ACKNOWLEDGE A RESENT LAST CHUNK */
+		FlashTransfersMapWrite(device.DESDevSerial, FlashTransfer{
+			JobName: ft.JobName,
+			Seq:     ft.Seq,
+			Updated: ft.Updated,
+			Done:    true,
+			Bufs:    make(map[string][]byte),
+		})
+		return ft, true, false, nil
+	}
+
+	FlashTransfersMapWrite(device.DESDevSerial, ft)
+	return
+}
+
+/* DECODES THE COMPLETED TRANSFER AND BACKFILLS THE JOB DATABASES */
+func (device *Device) HandleFlashTransfer(ft FlashTransfer) (sum FlashUploadSummary) {
+
+	recs := FlashRecords{}
+	for _, typ := range FLASH_TYPES {
+		if buf, ok := ft.Bufs[typ]; ok {
+			if err := recs.ParseFlash(typ, buf); err != nil {
+				sum.DESDevSerial = device.DESDevSerial
+				sum.Err = err.Error()
+				return
+			}
+		}
+	}
+
+	d := DevicesMapRead(device.DESDevSerial)
+	return d.BackfillFlash(recs, ft.JobName)
+}
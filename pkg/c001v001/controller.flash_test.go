@@ -0,0 +1,121 @@
+package c001v001
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func testFlashADM(t int64) Admin {
+	return Admin{
+		AdmTime: t, AdmAddr: "SN0001", AdmUserID: "user", AdmApp: "app",
+		AdmDefHost: "127.0.0.1", AdmDefPort: 1883, AdmOpHost: "127.0.0.2", AdmOpPort: 8883,
+		AdmBatHiAmp: 2.5, AdmBatLoVolt: 10.5, AdmMotHiAmp: 0.75,
+		AdmPress: 6991.5, AdmPressMin: 689.5, AdmPressMax: 7000,
+		AdmHFSFlow: 200, AdmHFSFlowMin: 150, AdmHFSFlowMax: 250,
+		AdmHFSPress: 1103, AdmHFSPressMin: 158.5, AdmHFSPressMax: 1379,
+		AdmHFSDiff: 448, AdmHFSDiffMin: 69, AdmHFSDiffMax: 517,
+		AdmLFSFlow: 1.75, AdmLFSFlowMin: 0.5, AdmLFSFlowMax: 2,
+		AdmLFSPress: 413.5, AdmLFSPressMin: 138, AdmLFSPressMax: 551.5,
+		AdmLFSDiff: 62, AdmLFSDiffMin: 20.5, AdmLFSDiffMax: 69,
+	}
+}
+
+func testFlashSTA(t int64, logging int32, job string) State {
+	return State{
+		StaTime: t, StaAddr: "SN0001", StaUserID: "user", StaApp: "app",
+		StaSerial: "SN0001", StaVersion: DEVICE_VERSION, StaClass: DEVICE_CLASS,
+		StaLogFw: "00.0.001", StaModFw: "00.0.002", StaLogging: logging, StaJobName: job,
+		StaStmUID1: -1, StaStmUID2: 2, StaStmUID3: 3,
+	}
+}
+
+func testFlashEVT(t int64, msg string) Event {
+	return Event{
+		EvtTime: t, EvtAddr: "SN0001", EvtUserID: "user", EvtApp: "app",
+		EvtCode: OP_CODE_JOB_START_REQ, EvtTitle: "title", EvtMsg: msg,
+	}
+}
+
+func testFlashSMP(t int64) Sample {
+	return Sample{
+		SmpTime: t, SmpCH4: 97.5, SmpHiFlow: 0.25, SmpLoFlow: 1.5, SmpPress: 689.5,
+		SmpBatAmp: 0.125, SmpBatVolt: 12.75, SmpMotVolt: 11.5, SmpVlvTgt: uint32(MODE_BUILD), SmpVlvPos: uint32(MODE_VENT),
+	}
+}
+
+/* A DUMP OF n RECORDS WITH AN ERASED RECORD AFTER THE FIRST */
+func testFlashDump(size int, recs ...[]byte) (out []byte) {
+	for i, b := range recs {
+		out = append(out, b...)
+		if i == 0 {
+			out = append(out, bytes.Repeat([]byte{0xFF}, size)...)
+		}
+	}
+	return
+}
+
+func TestParseFlashRoundTrip(t *testing.T) {
+
+	adms := []Admin{testFlashADM(1700000000000), testFlashADM(1700000001000)}
+	stas := []State{
+		testFlashSTA(1700000000000, OP_CODE_JOB_STARTED, "SN0001_0000000001"),
+		testFlashSTA(1700000002000, OP_CODE_JOB_ENDED, "SN0001_0000000001"),
+	}
+	evts := []Event{
+		testFlashEVT(1700000000000, ""),
+		testFlashEVT(1700000001000, "a message shorter than the 512 byte flash field"),
+	}
+	smps := []Sample{testFlashSMP(1700000000000), testFlashSMP(1700000001000), testFlashSMP(1700000002000)}
+
+	dumps := map[string][][]byte{}
+	for _, adm := range adms {
+		dumps[FLASH_TYPE_ADM] = append(dumps[FLASH_TYPE_ADM], adm.AdminToBytes())
+	}
+	for _, sta := range stas {
+		dumps[FLASH_TYPE_STA] = append(dumps[FLASH_TYPE_STA], sta.StateToBytes())
+	}
+	for _, evt := range evts {
+		dumps[FLASH_TYPE_EVT] = append(dumps[FLASH_TYPE_EVT], evt.EventToBytes())
+	}
+	for _, smp := range smps {
+		dumps[FLASH_TYPE_SMP] = append(dumps[FLASH_TYPE_SMP], smp.SampleToBytes())
+	}
+
+	recs := FlashRecords{}
+	for _, typ := range []string{FLASH_TYPE_ADM, FLASH_TYPE_STA, FLASH_TYPE_EVT, FLASH_TYPE_SMP} {
+		size := FlashRecordSize(typ)
+		for _, b := range dumps[typ] {
+			if len(b) != size {
+				t.Fatalf("%s: record is %d bytes; flash record size is %d", typ, len(b), size)
+			}
+		}
+		if err := recs.ParseFlash(typ, testFlashDump(size, dumps[typ]...)); err != nil {
+			t.Fatalf("%s: %s", typ, err.Error())
+		}
+	}
+
+	if !reflect.DeepEqual(recs.ADMs, adms) {
+		t.Errorf("ADMs:\n got %+v\nwant %+v", recs.ADMs, adms)
+	}
+	if !reflect.DeepEqual(recs.STAs, stas) {
+		t.Errorf("STAs:\n got %+v\nwant %+v", recs.STAs, stas)
+	}
+	if !reflect.DeepEqual(recs.EVTs, evts) {
+		t.Errorf("EVTs:\n got %+v\nwant %+v", recs.EVTs, evts)
+	}
+	if !reflect.DeepEqual(recs.SMPs, smps) {
+		t.Errorf("SMPs:\n got %+v\nwant %+v", recs.SMPs, smps)
+	}
+}
+
+func TestParseFlashRejectsPartialRecords(t *testing.T) {
+	recs := FlashRecords{}
+	smp := testFlashSMP(1700000000000)
+	if err := recs.ParseFlash(FLASH_TYPE_SMP, smp.SampleToBytes()[:FLASH_SMP_SIZE-1]); err == nil {
+		t.Fatal("expected an error for a partial sample record")
+	}
+	if err := recs.ParseFlash("xyz", nil); err == nil {
+		t.Fatal("expected an error for an unknown record type")
+	}
+}
@@ -0,0 +1,258 @@
+package c001v001
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/leehayford/des/pkg"
+)
+
+/*
+ADM / CFG / HDR CHANGE HISTORY
+
+EVERY CHANGE IS A ROW IN THE JOB DATABASE ( OR CMDARCHIVE ):
+  - REQUESTS: WRITTEN BY Set*Request ( *Addr = THE REQUESTER'S ADDRESS OR pkg.DES_ADDR; *ReqID = THE CMD'S CORRELATION DATA )
+  - DEVICE RECORDS: THE DEVICE'S REPLY ( *RepID = THE *ReqID ANSWERED ) OR ITS OWN CHANGE
+
+EACH REQUEST IS PAIRED WITH THE DEVICE RECORD CARRYING ITS ID:
+  - THE SAME VALUES CONFIRM IT
+  - OTHER VALUES MEAN THE DEVICE OVERRODE THE REQUEST ( HistoryRecord.Overrides )
+  - NO REPLY WITHIN CMD_EXPIRY_SEC MEANS THE DEVICE NEVER REPLIED; IT IS FLAGGED REJECTED
+  - OTHERWISE THE DEVICE HAS NOT YET REPLIED
+
+RECORDS WRITTEN BEFORE REQUEST IDS WERE KEPT ARE PAIRED IN ORDER: EACH DEVICE RECORD ANSWERS THE OLDEST UNANSWERED REQUEST
+*/
+const HIST_SOURCE_REQUEST = "request"
+const HIST_SOURCE_DEVICE = "device"
+
+const HIST_STATUS_PENDING = "pending"       // Request; the device has not yet replied
+const HIST_STATUS_CONFIRMED = "confirmed"   // Request; the device replied with the requested values
+const HIST_STATUS_OVERRIDDEN = "overridden" // Request; the device replied with other values
+const HIST_STATUS_REJECTED = "rejected"     // Request; the device did not reply within CMD_EXPIRY_SEC
+const HIST_STATUS_REPLY = "reply"           // Device record answering a request
+const HIST_STATUS_DEVICE = "device"         // Device record not answering a request
+
+type HistoryRecord struct {
+	Version   int                    `json:"version"` // 1 = oldest
+	Time      int64                  `json:"time"`
+	Addr      string                 `json:"addr"`
+	UserID    string                 `json:"user_id"`
+	App       string                 `json:"app"`
+	Source    string                 `json:"source"`               // HIST_SOURCE_...
+	Status    string                 `json:"status"`               // HIST_STATUS_...
+	Changes   []FieldDiff            `json:"changes"`              // Against the previous version
+	Overrides []FieldDiff            `json:"overrides,omitempty"`  // Request fields the device replied with other values
+	RequestID string                 `json:"request_id,omitempty"` // Request: its *ReqID; reply: the *ReqID answered
+	Reply     int                    `json:"reply,omitempty"`      // Request: the version of the device record answering it
+	Values    map[string]interface{} `json:"values"`
+}
+
+type FieldDiff struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+type HistoryRequest struct {
+	pkg.DESRegistration `json:"reg"` // The job or CMDARCHIVE
+	Type                string       `json:"type"` // adm, cfg, hdr
+	From                int          `json:"from"` // Version; diff only
+	To                  int          `json:"to"`   // Version; diff only
+}
+
+/* RETURNS THE FIELD-LEVEL DIFFERENCES BETWEEN TWO SETS OF VALUES, BY FIELD NAME */
+func DiffFields(from, to map[string]interface{}) (diffs []FieldDiff) {
+
+	fields := make(map[string]bool)
+	for k := range from {
+		fields[k] = true
+	}
+	for k := range to {
+		fields[k] = true
+	}
+
+	for k := range fields {
+		if !reflect.DeepEqual(from[k], to[k]) {
+			diffs = append(diffs, FieldDiff{Field: k, From: from[k], To: to[k]})
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Field < diffs[j].Field })
+	return
+}
+
+/* RETURNS THE RECORD'S VALUES, KEYED BY JSON FIELD NAME, WITHOUT REQ_META_FIELDS */
+func historyValues(rec interface{}) (meta, values map[string]interface{}, err error) {
+
+	js, err := json.Marshal(rec)
+	if err != nil {
+		return
+	}
+	all := make(map[string]interface{})
+	if err = json.Unmarshal(js, &all); err != nil {
+		return
+	}
+
+	meta = make(map[string]interface{})
+	values = make(map[string]interface{})
+	for k, v := range all {
+		if IsReqMetaField(k) {
+			meta[strings.SplitN(k, "_", 2)[1]] = v
+		} else {
+			values[k] = v
+		}
+	}
+	return
+}
+
+/* RETURNS THE JOB'S ADM / CFG / HDR RECORDS, OLDEST FIRST; REQUIRES AN OPEN job.DBC */
+func (job *Job) historyRecords(typ string) (recs []interface{}, err error) {
+
+	switch typ {
+	case FLASH_TYPE_ADM:
+		adms := []Admin{}
+		err = job.DBC.DB.Order("adm_time ASC, adm_id ASC").Find(&adms).Error
+		for _, r := range adms {
+			recs = append(recs, r)
+		}
+	case FLASH_TYPE_CFG:
+		cfgs := []Config{}
+		err = job.DBC.DB.Order("cfg_time ASC, cfg_id ASC").Find(&cfgs).Error
+		for _, r := range cfgs {
+			recs = append(recs, r)
+		}
+	case FLASH_TYPE_HDR:
+		hdrs := []Header{}
+		err = job.DBC.DB.Order("hdr_time ASC, hdr_id ASC").Find(&hdrs).Error
+		for _, r := range hdrs {
+			recs = append(recs, r)
+		}
+	default:
+		err = fmt.Errorf("Unknown history type: %s; expected adm, cfg or hdr", typ)
+	}
+	return
+}
+
+/* RETURNS THE RECORD'S REQUEST ID ( *ReqID ) AND THE REQUEST ID IT ANSWERS ( *RepID ) */
+func historyIDs(rec interface{}) (req, rep string) {
+	switch r := rec.(type) {
+	case Admin:
+		return r.AdmReqID, r.AdmRepID
+	case Config:
+		return r.CfgReqID, r.CfgRepID
+	case Header:
+		return r.HdrReqID, r.HdrRepID
+	}
+	return
+}
+
+/* RETURNS THE JOB'S ADM / CFG / HDR CHANGE HISTORY, OLDEST FIRST; REQUIRES AN OPEN job.DBC */
+func (job *Job) GetHistory(typ string) (hist []HistoryRecord, err error) {
+
+	recs, err := job.historyRecords(typ)
+	if err != nil {
+		return
+	}
+
+	replies := make(map[string]int) // Index of the first device record answering each request ID
+	for i, rec := range recs {
+		meta, values, err := historyValues(rec)
+		if err != nil {
+			return nil, err
+		}
+
+		h := HistoryRecord{
+			Version: i + 1,
+			Values:  values,
+			Source:  HIST_SOURCE_REQUEST,
+		}
+		if t, ok := meta["time"].(float64); ok {
+			h.Time = int64(t)
+		}
+		h.Addr, _ = meta["addr"].(string)
+		h.UserID, _ = meta["user_id"].(string)
+		h.App, _ = meta["app"].(string)
+
+		req, rep := historyIDs(rec)
+		switch {
+		case rep != "":
+			h.Source = HIST_SOURCE_DEVICE
+			h.Status = HIST_STATUS_REPLY
+			h.RequestID = rep
+			if _, ok := replies[rep]; !ok {
+				replies[rep] = i
+			}
+		case req != "":
+			h.RequestID = req
+		case h.Addr == job.DESDevSerial:
+			h.Source = HIST_SOURCE_DEVICE
+		}
+		if i > 0 {
+			h.Changes = DiffFields(hist[i-1].Values, values)
+		}
+		hist = append(hist, h)
+	}
+
+	pair := func(i, j int) {
+		hist[i].Reply = hist[j].Version
+		hist[j].Status = HIST_STATUS_REPLY
+		if hist[i].Overrides = DiffFields(hist[i].Values, hist[j].Values); len(hist[i].Overrides) > 0 {
+			hist[i].Status = HIST_STATUS_OVERRIDDEN
+		} else {
+			hist[i].Status = HIST_STATUS_CONFIRMED
+		}
+	}
+
+	/* PAIR EACH REQUEST WITH THE DEVICE RECORD ANSWERING IT */
+	unanswered := []int{} // Requests recorded without an ID, oldest first
+	for i := range hist {
+		switch {
+		case hist[i].Source == HIST_SOURCE_REQUEST && hist[i].RequestID != "":
+			if j, ok := replies[hist[i].RequestID]; ok {
+				pair(i, j)
+			}
+
+		case hist[i].Source == HIST_SOURCE_REQUEST:
+			unanswered = append(unanswered, i)
+
+		case hist[i].Status == "" && len(unanswered) > 0:
+			pair(unanswered[0], i)
+			unanswered = unanswered[1:]
+		}
+	}
+
+	/* FLAG REQUESTS THE DEVICE HAS NOT ANSWERED, AND DEVICE RECORDS NOT ANSWERING A REQUEST */
+	now := time.Now().UTC().UnixMilli()
+	for i := range hist {
+		switch {
+		case hist[i].Status != "":
+		case hist[i].Source == HIST_SOURCE_DEVICE:
+			hist[i].Status = HIST_STATUS_DEVICE
+		case now-hist[i].Time < CMD_EXPIRY_SEC*1000:
+			hist[i].Status = HIST_STATUS_PENDING
+		default:
+			hist[i].Status = HIST_STATUS_REJECTED
+		}
+	}
+	return
+}
+
+/* RETURNS THE FIELD-LEVEL DIFF BETWEEN TWO VERSIONS OF THE JOB'S ADM / CFG / HDR */
+func (job *Job) DiffHistory(typ string, from, to int) (a, b HistoryRecord, diffs []FieldDiff, err error) {
+
+	hist, err := job.GetHistory(typ)
+	if err != nil {
+		return
+	}
+	if from < 1 || from > len(hist) || to < 1 || to > len(hist) {
+		err = fmt.Errorf("Versions must be between 1 and %d", len(hist))
+		return
+	}
+
+	a, b = hist[from-1], hist[to-1]
+	diffs = DiffFields(a.Values, b.Values)
+	return
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/leehayford/des/pkg"
+	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
 
@@ -23,31 +24,44 @@ type Job struct {
 
 /*************************************************************************************************************************/
 /* AN OPEN Job.DBClient CONNECTION REQUIRED FOR ALL OTHER (job *Job)FUNCTIONS **************************/
+/* CONNECTIONS COME FROM pkg.JOB_POOL; job.DBC.Disconnect() RETURNS THEM */
 func (job *Job) ConnectDBC() (err error) {
 	// job.DBClient = pkg.DBClient{ConnStr: fmt.Sprintf("%s%s", pkg.DB_SERVER, strings.ToLower(job.DESJobName))}
 	// return job.DBClient.Connect()
 
-	job.DBC, err = pkg.GetJobDBClient(job.DESJobName)
-	return job.DBC.Connect()
+	job.DBC, err = pkg.AcquireJobDB(job.DESJobName, false)
+	return
+}
+
+/*
+	AS ConnectDBC, BUT READ-ONLY WHERE THE JOB HAS ENDED; FOR QUERIES
+
+THE END TIME IS READ FROM des_jobs, NOT job, WHICH MAY HAVE COME FROM A REQUEST BODY
+*/
+func (job *Job) ConnectReadOnlyDBC() (err error) {
+	reg := pkg.DESJob{}
+	if res := pkg.DES.DB.Where("des_job_name = ?", job.DESJobName).Limit(1).Find(&reg); res.Error != nil {
+		return res.Error
+	}
+	job.DBC, err = pkg.AcquireJobDB(job.DESJobName, reg.DESJobEnd > 0)
+	return
 }
 
 /*************************************************************************************************************************/
 
 func CreateJobDBTables(dbc *pkg.JobDBClient) (err error) {
 
-	if err := dbc.Migrator().CreateTable(
-		&Admin{},
-		&State{},
-		&Header{},
-		&Config{},
-		&EventTyp{},
-		&Event{},
-		&Sample{},
-		&Report{},
-		&RepSection{},
-		&SecDataset{},
-		&SecAnnotation{},
-	); err != nil {
+	/* OPENING A JOB DATABASE DOES NOT CREATE IT ( SEE pkg.JobStore ) */
+	if err = dbc.CreateJobDB(); err != nil {
+		return pkg.LogErr(err)
+	}
+
+	if err := dbc.Migrator().CreateTable(C001V001{}.JobDBModels()...); err != nil {
+		return pkg.LogErr(err)
+	}
+
+	/* SAMPLES ARE A TIME SERIES ( TIMESCALE JOB STORE ) */
+	if err = dbc.CreateHypertable("samples", "smp_time"); err != nil {
 		return pkg.LogErr(err)
 	}
 
@@ -57,9 +71,47 @@ func CreateJobDBTables(dbc *pkg.JobDBClient) (err error) {
 		}
 	}
 
+	/* NEW JOB DATABASES START AT THE LATEST SCHEMA VERSION */
+	if err = pkg.StampJobDBSchema(dbc, JOB_DB_MIGRATIONS); err != nil {
+		return pkg.LogErr(err)
+	}
+
 	return
 }
 
+/*
+	JOB DATABASE SCHEMA VERSIONS, OLDEST FIRST ( SEE pkg.UpgradeJobDB )
+
+APPEND A MIGRATION WHENEVER A JOB DB MODEL CHANGES; NEVER EDIT OR REORDER ONE ALREADY RELEASED
+*/
+var JOB_DB_MIGRATIONS = []pkg.JobDBSchemaMigration{
+	{
+		/* JOB DATABASES CREATED BEFORE SCHEMA VERSIONS WERE RECORDED:
+		ADD ANY TABLES ( IE: REPORTS ) OR COLUMNS THEY ARE MISSING AND ANY EVENT TYPES NOT YET SEEDED */
+		Version: 1,
+		Name:    "baseline",
+		Up: func(tx *gorm.DB) (err error) {
+			if err = tx.AutoMigrate(C001V001{}.JobDBModels()...); err != nil {
+				return
+			}
+			for _, typ := range EVENT_TYPES {
+				if err = tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&typ).Error; err != nil {
+					return
+				}
+			}
+			return
+		},
+	},
+	{
+		/* ADM / CFG / HDR REQUEST AND REPLY IDS ( SEE GetHistory ) */
+		Version: 2,
+		Name:    "request_ids",
+		Up: func(tx *gorm.DB) (err error) {
+			return tx.AutoMigrate(&Admin{}, &Header{}, &Config{})
+		},
+	},
+}
+
 /* RETURNS ALL DATA FOR THIS JOB */
 func (job *Job) GetJobData() (err error) {
 
@@ -392,10 +444,25 @@ func (job *Job) CreateBuildUpSection(rep *Report, start, end int64, name string,
 	}
 
 	/* CALCULATE SSP
-	GET SSP START / END
-	CREATE EVENT / ANNOTATION SSP START
-	CREATE EVENT / ANNOTATION SSP END
+	WHERE THE DES DETECTED SSP WHILE THE JOB WAS RUNNING, THE SSP EVENT HAS ALREADY BEEN ANNOTATED ABOVE
+	OTHERWISE, RUN THE SAME DETECTION OVER THIS SECTION'S SAMPLES AND CREATE THE SSP EVENT / ANNOTATION
 	*/
+	if _, ok := job.FindEvent(NOTE_SSP_COMMENT, start, end); !ok {
+		if res, ok := job.FindStable(SSP_STABLE, start, end, cfg); ok {
+			evt := Event{
+				EvtTime:   res.End,
+				EvtUserID: job.DESJobRegUserID,
+				EvtApp:    pkg.DES_APP,
+				EvtCode:   NOTE_SSP_COMMENT,
+				EvtTitle:  GetEventTypeByCode(NOTE_SSP_COMMENT),
+				EvtMsg:    res.Message(),
+			}
+			if err := job.NewReportEvent(job.DESDevSerial, &evt); err != nil {
+				pkg.LogErr(err)
+			}
+			job.CreateSecAnnotation(sec, true, true, evt)
+		}
+	}
 	return
 }
 func (job *Job) CreateVentSection(rep *Report, start, end int64, name string, cfg Config) {
@@ -540,10 +607,25 @@ func (job *Job) CreateFlowSection(rep *Report, start, end int64, name string, cf
 	}
 
 	/* CALCULATE SCVF
-	GET SCVF START / END
-	CREATE EVENT / ANNOTATION SCVF START
-	CREATE EVENT / ANNOTATION SCVF END
+	WHERE THE DES DETECTED SCVF WHILE THE JOB WAS RUNNING, THE SSCVF EVENT HAS ALREADY BEEN ANNOTATED ABOVE
+	OTHERWISE, RUN THE SAME DETECTION OVER THIS SECTION'S SAMPLES AND CREATE THE SSCVF EVENT / ANNOTATION
 	*/
+	if _, ok := job.FindEvent(NOTE_SSCVF_COMMENT, start, end); !ok {
+		if res, ok := job.FindStable(SCVF_STABLE, start, end, cfg); ok {
+			evt := Event{
+				EvtTime:   res.End,
+				EvtUserID: job.DESJobRegUserID,
+				EvtApp:    pkg.DES_APP,
+				EvtCode:   NOTE_SSCVF_COMMENT,
+				EvtTitle:  GetEventTypeByCode(NOTE_SSCVF_COMMENT),
+				EvtMsg:    res.Message(),
+			}
+			if err := job.NewReportEvent(job.DESDevSerial, &evt); err != nil {
+				pkg.LogErr(err)
+			}
+			job.CreateSecAnnotation(sec, true, true, evt)
+		}
+	}
 	return
 }
 
@@ -0,0 +1,303 @@
+package c001v001
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/leehayford/des/pkg"
+)
+
+/*
+LOCATION HISTORY AND GEOFENCE
+
+EVERY HEADER THE DEVICE SENDS CARRIES ITS LOCATION ( HdrGeoLng / HdrGeoLat ):
+  - A LOCATION THAT DIFFERS FROM THE LAST ONE IS WRITTEN TO THE DEVICE'S LOCATION HISTORY
+  - THE FIRST HEADER AFTER AN OP_CODE_GPS_ACQ EVENT IS RECORDED AS A GPS FIX
+
+DURING A JOB, EACH LOCATION IS CHECKED AGAINST THE JOB'S GEOFENCE:
+  - WHERE THE JOB HAS NO GEOFENCE, ONE IS CENTRED ON THE JOB'S LOCATION ( DESJobLng / DESJobLat; THE WELL )
+  - WHERE THE JOB HAS NO VALID LOCATION EITHER, THE GEOFENCE MUST BE SET BY A USER ( SEE SetGeofence )
+  - LEAVING THE GEOFENCE LOGS A NOTE_DEVICE_MOVED EVENT; RETURNING LOGS ANOTHER
+
+EACH DEVICE'S LOCATIONS ARE CHECKED IN THE ORDER RECEIVED, BY ONE GOROUTINE PER DEVICE ( SEE QueueDeviceLocation )
+*/
+
+/* TIME OF THE DEVICE'S LAST OP_CODE_GPS_ACQ EVENT, BY SERIAL; CLEARED BY THE NEXT HEADER */
+var GPSAcqs = make(map[string]int64)
+var GPSAcqsRWMutex = sync.RWMutex{}
+
+func GPSAcqsMapWrite(serial string, t int64) {
+	GPSAcqsRWMutex.Lock()
+	GPSAcqs[serial] = t
+	GPSAcqsRWMutex.Unlock()
+}
+
+/* RETURNS TRUE AND CLEARS THE ENTRY WHERE THE DEVICE HAS ACQUIRED GPS SINCE ITS LAST HEADER */
+func GPSAcqsMapTake(serial string) (ok bool) {
+	GPSAcqsRWMutex.Lock()
+	_, ok = GPSAcqs[serial]
+	delete(GPSAcqs, serial)
+	GPSAcqsRWMutex.Unlock()
+	return
+}
+
+/* THE DEVICE'S LAST RECORDED LOCATION, BY SERIAL */
+var Locations = make(map[string]pkg.DESDevLocation)
+var LocationsRWMutex = sync.RWMutex{}
+
+func LocationsMapWrite(loc pkg.DESDevLocation) {
+	LocationsRWMutex.Lock()
+	Locations[loc.DESLocSerial] = loc
+	LocationsRWMutex.Unlock()
+}
+func LocationsMapRead(serial string) (loc pkg.DESDevLocation, ok bool) {
+	LocationsRWMutex.RLock()
+	loc, ok = Locations[serial]
+	LocationsRWMutex.RUnlock()
+	return
+}
+
+/* A HEADER'S LOCATION, WAITING TO BE CHECKED */
+type LocationFix struct {
+	Job    string // The active job or CMDARCHIVE
+	Active bool   // False where the device is not logging ( no geofence check )
+	GPS    bool   // The first header after an OP_CODE_GPS_ACQ event
+	HDR    Header
+}
+
+const LOCATION_QUEUE_SIZE = 64
+
+/* LOCATIONS WAITING TO BE CHECKED, BY SERIAL; EACH QUEUE IS DRAINED, IN ORDER, BY ITS OWN GOROUTINE */
+var LocationQueues = make(map[string]chan LocationFix)
+var LocationQueuesRWMutex = sync.RWMutex{}
+
+/* CLOSES THE DEVICE'S QUEUE; ITS GOROUTINE EXITS ONCE THE LOCATIONS ALREADY QUEUED ARE CHECKED */
+func LocationQueuesMapRemove(serial string) {
+	LocationQueuesRWMutex.Lock()
+	if q, ok := LocationQueues[serial]; ok {
+		close(q)
+		delete(LocationQueues, serial)
+	}
+	LocationQueuesRWMutex.Unlock()
+}
+
+/* SERIALIZES GEOFENCE CHECKS SO THAT EACH CROSSING IS LOGGED ONCE */
+var GeofenceMutex = sync.Mutex{}
+
+type GeofenceRequest struct {
+	DESDevSerial string  `json:"des_dev_serial"`
+	Lng          float64 `json:"lng"`
+	Lat          float64 `json:"lat"`
+	Radius       float64 `json:"radius"` // Metres
+}
+
+/* RETURNS TRUE WHERE THE COORDINATES ARE IN RANGE AND NOT THE DEFAULT ( NO FIX ) LOCATION */
+func ValidLocation(lng, lat float64) bool {
+	if lng == DEFAULT_GEO_LNG && lat == DEFAULT_GEO_LAT {
+		return false
+	}
+	if lng == 0 && lat == 0 {
+		return false
+	}
+	return lng >= -180 && lng <= 180 && lat >= -90 && lat <= 90
+}
+
+/*
+	CALLED WHEN THE DEVICE SENDS A HEADER
+
+job IS THE ACTIVE JOB; active IS FALSE WHERE THE DEVICE IS NOT LOGGING ( NO GEOFENCE CHECK )
+QUEUES THE LOCATION FOR CheckDeviceLocation, STARTING THE DEVICE'S QUEUE WHERE IT HAS NONE
+*/
+func QueueDeviceLocation(serial, job string, active bool, hdr Header) {
+
+	/* TAKEN HERE, IN THE ORDER MESSAGES ARRIVE, RATHER THAN WHEN THE FIX IS CHECKED */
+	fix := LocationFix{Job: job, Active: active, GPS: GPSAcqsMapTake(serial), HDR: hdr}
+
+	LocationQueuesRWMutex.Lock()
+	defer LocationQueuesRWMutex.Unlock()
+
+	q, ok := LocationQueues[serial]
+	if !ok {
+		q = make(chan LocationFix, LOCATION_QUEUE_SIZE)
+		LocationQueues[serial] = q
+		go func() {
+			for fix := range q {
+				CheckDeviceLocation(serial, fix)
+			}
+		}()
+	}
+	q <- fix
+}
+
+/* RECORD THE LOCATION; CHECK THE JOB'S GEOFENCE */
+func CheckDeviceLocation(serial string, fix LocationFix) {
+
+	job, active, gps, hdr := fix.Job, fix.Active, fix.GPS, fix.HDR
+	if !ValidLocation(hdr.HdrGeoLng, hdr.HdrGeoLat) {
+		return
+	}
+
+	GeofenceMutex.Lock()
+	defer GeofenceMutex.Unlock()
+
+	last, ok := LocationsMapRead(serial)
+	if !ok {
+		if locs, err := pkg.GetDESDevLocations(serial, 1); err == nil && len(locs) > 0 {
+			last, ok = locs[0], true
+		}
+	}
+	moved := !ok || last.DESLocLng != hdr.HdrGeoLng || last.DESLocLat != hdr.HdrGeoLat
+	if !moved && !gps && last.DESLocJobName == job {
+		return
+	}
+
+	loc := pkg.DESDevLocation{
+		DESLocSerial:  serial,
+		DESLocJobName: job,
+		DESLocTime:    hdr.HdrTime,
+		DESLocLng:     hdr.HdrGeoLng,
+		DESLocLat:     hdr.HdrGeoLat,
+		DESLocSource:  pkg.LOC_SOURCE_HDR,
+		DESLocDist:    -1,
+	}
+	if gps {
+		loc.DESLocSource = pkg.LOC_SOURCE_GPS
+	}
+
+	if active {
+		if err := checkGeofence(&loc); err != nil {
+			pkg.LogErr(err)
+		}
+	}
+
+	if err := pkg.WriteDESDevLocation(&loc); err != nil {
+		pkg.LogErr(err)
+		return
+	}
+	LocationsMapWrite(loc)
+}
+
+/*
+	SETS loc.DESLocDist / DESLocInside; LOGS AN EVENT WHERE THE DEVICE CROSSED THE FENCE; CALLER MUST HOLD GeofenceMutex
+
+WHERE THE JOB HAS NO GEOFENCE, ONE IS CENTRED ON THE JOB'S LOCATION; WHERE THAT IS NOT VALID, NOTHING IS CHECKED
+*/
+func checkGeofence(loc *pkg.DESDevLocation) (err error) {
+
+	fence, found, err := pkg.GetDESGeofence(loc.DESLocSerial, loc.DESLocJobName)
+	if err != nil {
+		return
+	}
+	if !found {
+		d := DevicesMapRead(loc.DESLocSerial)
+		if d.DESJobName != loc.DESLocJobName || !ValidLocation(d.DESJobLng, d.DESJobLat) {
+			return
+		}
+		fence = pkg.DESGeofence{
+			DESFenceRegTime:   loc.DESLocTime,
+			DESFenceRegAddr:   pkg.DES_ADDR,
+			DESFenceRegUserID: d.DESU.GetUUIDString(),
+			DESFenceSerial:    loc.DESLocSerial,
+			DESFenceJobName:   loc.DESLocJobName,
+			DESFenceLng:       d.DESJobLng,
+			DESFenceLat:       d.DESJobLat,
+			DESFenceRadius:    pkg.GEOFENCE_RADIUS_M,
+			DESFenceSource:    pkg.GEOFENCE_SOURCE_AUTO,
+		}
+		if err = pkg.WriteDESGeofence(&fence); err != nil {
+			return
+		}
+	}
+
+	loc.DESLocDist, loc.DESLocInside = fence.Contains(loc.DESLocLng, loc.DESLocLat)
+
+	switch {
+	case !loc.DESLocInside && !fence.DESFenceOutside:
+		fence.DESFenceOutside = true
+		LogLocationEvent(loc.DESLocSerial, fmt.Sprintf("DEVICE MOVED: %.0f m from the well location ( geofence %.0f m ); now at %.6f, %.6f",
+			loc.DESLocDist, fence.DESFenceRadius, loc.DESLocLng, loc.DESLocLat))
+
+	case loc.DESLocInside && fence.DESFenceOutside:
+		fence.DESFenceOutside = false
+		LogLocationEvent(loc.DESLocSerial, fmt.Sprintf("DEVICE RETURNED: %.0f m from the well location ( geofence %.0f m )",
+			loc.DESLocDist, fence.DESFenceRadius))
+
+	default:
+		return
+	}
+	return pkg.WriteDESGeofence(&fence)
+}
+
+/* LOG A NOTE_DEVICE_MOVED EVENT TO THE DEVICE'S ACTIVE JOB */
+func LogLocationEvent(serial, msg string) {
+
+	d := DevicesMapRead(serial)
+	if d.DESDevSerial == "" {
+		return
+	}
+	d.EVT = Event{
+		EvtUserID: d.DESU.GetUUIDString(),
+		EvtApp:    pkg.DES_APP,
+		EvtCode:   NOTE_DEVICE_MOVED,
+		EvtTitle:  GetEventTypeByCode(NOTE_DEVICE_MOVED),
+		EvtMsg:    msg,
+	}
+	if err := d.SetEventRequest(pkg.DES_ADDR); err != nil {
+		pkg.LogErr(err)
+	}
+}
+
+/*
+	SET THE GEOFENCE FOR THE DEVICE'S ACTIVE JOB
+
+WHERE lng / lat ARE NOT A VALID LOCATION, THE CURRENT CENTRE ( OR THE JOB'S LOCATION ) IS USED
+*/
+func SetGeofence(req GeofenceRequest, src, uid string) (fence pkg.DESGeofence, err error) {
+
+	d := DevicesMapRead(req.DESDevSerial)
+	if d.DESDevSerial == "" {
+		return fence, fmt.Errorf("Device %s is not connected to this DES", req.DESDevSerial)
+	}
+	if d.STA.StaLogging <= OP_CODE_JOB_START_REQ {
+		return fence, fmt.Errorf("Device %s has no active job", req.DESDevSerial)
+	}
+	if req.Radius <= 0 {
+		return fence, fmt.Errorf("Geofence radius must be greater than 0 m")
+	}
+
+	GeofenceMutex.Lock()
+	defer GeofenceMutex.Unlock()
+
+	fence, found, err := pkg.GetDESGeofence(d.DESDevSerial, d.DESJobName)
+	if err != nil {
+		return
+	}
+
+	switch {
+	case ValidLocation(req.Lng, req.Lat):
+		fence.DESFenceLng, fence.DESFenceLat = req.Lng, req.Lat
+	case found:
+	case ValidLocation(d.DESJobLng, d.DESJobLat):
+		fence.DESFenceLng, fence.DESFenceLat = d.DESJobLng, d.DESJobLat
+	default:
+		return fence, fmt.Errorf("Job %s has no valid location; lng / lat are required", d.DESJobName)
+	}
+
+	fence.DESFenceRegTime = time.Now().UTC().UnixMilli()
+	fence.DESFenceRegAddr = src
+	fence.DESFenceRegUserID = uid
+	fence.DESFenceSerial = d.DESDevSerial
+	fence.DESFenceJobName = d.DESJobName
+	fence.DESFenceRadius = req.Radius
+	fence.DESFenceSource = pkg.GEOFENCE_SOURCE_USER
+
+	/* RE-EVALUATE THE DEVICE'S LAST LOCATION AGAINST THE NEW FENCE */
+	if last, ok := LocationsMapRead(d.DESDevSerial); ok {
+		_, inside := fence.Contains(last.DESLocLng, last.DESLocLat)
+		fence.DESFenceOutside = !inside
+	}
+
+	err = pkg.WriteDESGeofence(&fence)
+	return
+}
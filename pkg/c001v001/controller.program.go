@@ -0,0 +1,505 @@
+package c001v001
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/leehayford/des/pkg"
+)
+
+/*
+TEST PROGRAMS
+
+AN ORDERED LIST OF ProgramSteps THE DES RUNS AGAINST A DEVICE DURING A JOB
+  - EACH STEP SETS THE DEVICE'S MODE ( Config.CfgVlvTgt ) AND ANY CONFIG OVERRIDES THROUGH SetConfigRequest
+  - EACH STEP ENDS ON: A FIXED DURATION, SSP ( MODE_BUILD ), STABLE FLOW ( MODE_HI_FLOW / MODE_LO_FLOW ) OR A PRESSURE THRESHOLD
+  - EVERY STEP AND STATUS CHANGE IS LOGGED AS A NOTE_PROGRAM_COMMENT EVENT
+  - A PROGRAM MAY BE PAUSED, RESUMED OR ABORTED; IT IS ABORTED WHEN ITS JOB ENDS
+
+PROGRESS IS KEPT IN pkg.DESProgram; ResumePrograms RELOADS RUNNING / PAUSED PROGRAMS ON STARTUP
+TIME THE DES WAS DOWN COUNTS TOWARD A RUNNING STEP'S DURATION
+*/
+const PROG_END_DURATION = "duration"
+const PROG_END_SSP = "ssp"
+const PROG_END_SCVF = "scvf"
+const PROG_END_PRESSURE = "pressure"
+
+const PROG_TICK_MS = 1000 // Interval at which durations, timeouts and jobs are checked
+
+type ProgramStep struct {
+	Name     string          `json:"name"`
+	Mode     int32           `json:"mode"`               // Config.CfgVlvTgt; MODE_...
+	Config   json.RawMessage `json:"config,omitempty"`   // Config fields to override; ie: { "cfg_ssp_rate": 0.5 }
+	End      string          `json:"end"`                // PROG_END_...
+	Duration int64           `json:"duration,omitempty"` // Milliseconds; PROG_END_DURATION
+	Pressure float32         `json:"pressure,omitempty"` // PROG_END_PRESSURE
+	Rising   bool            `json:"rising,omitempty"`   // PROG_END_PRESSURE: end at or above Pressure; otherwise at or below
+	Timeout  int64           `json:"timeout,omitempty"`  // Milliseconds; fail the program where the step has not ended ( 0 = no limit )
+}
+
+/* RETURNS AN ERROR WHERE THE STEP CAN NOT BE RUN */
+func (step ProgramStep) Validate() (err error) {
+
+	switch step.Mode {
+	case MODE_BUILD, MODE_VENT, MODE_HI_FLOW, MODE_LO_FLOW:
+	default:
+		return fmt.Errorf("Invalid mode: %d", step.Mode)
+	}
+
+	if len(step.Config) > 0 {
+		cfg := Config{}
+		if err = json.Unmarshal(step.Config, &cfg); err != nil {
+			return fmt.Errorf("Invalid config overrides: %s", err.Error())
+		}
+	}
+
+	switch step.End {
+	case PROG_END_DURATION:
+		if step.Duration <= 0 {
+			return fmt.Errorf("A duration step requires a duration")
+		}
+	case PROG_END_SSP:
+		if step.Mode != MODE_BUILD {
+			return fmt.Errorf("SSP can only be reached in build mode")
+		}
+	case PROG_END_SCVF:
+		if step.Mode != MODE_HI_FLOW && step.Mode != MODE_LO_FLOW {
+			return fmt.Errorf("Stable flow can only be reached in a flow mode")
+		}
+	case PROG_END_PRESSURE:
+	default:
+		return fmt.Errorf("Invalid end condition: %s", step.End)
+	}
+
+	if step.Timeout < 0 {
+		return fmt.Errorf("Invalid timeout: %d", step.Timeout)
+	}
+	return
+}
+
+/* DESCRIBES THE STEP'S END CONDITION FOR PROGRAM EVENTS */
+func (step ProgramStep) EndMessage() string {
+	switch step.End {
+	case PROG_END_DURATION:
+		return fmt.Sprintf("ends after %d s", step.Duration/1000)
+	case PROG_END_PRESSURE:
+		if step.Rising {
+			return fmt.Sprintf("ends at pressure >= %.3f", step.Pressure)
+		}
+		return fmt.Sprintf("ends at pressure <= %.3f", step.Pressure)
+	case PROG_END_SSP:
+		return "ends at SSP"
+	case PROG_END_SCVF:
+		return "ends at stable flow"
+	}
+	return ""
+}
+
+type ProgramRequest struct {
+	DESDevSerial string        `json:"des_dev_serial"`
+	Name         string        `json:"name"`
+	Steps        []ProgramStep `json:"steps"`
+}
+
+type ProgramIDRequest struct {
+	DESProgID int64 `json:"des_prog_id"`
+}
+
+/* AN ACTIVE ( RUNNING / PAUSED ) PROGRAM */
+type Program struct {
+	pkg.DESProgram
+	Steps []ProgramStep `json:"steps"`
+}
+
+/* RETURNS THE CURRENT STEP */
+func (prog *Program) Step() ProgramStep {
+	return prog.Steps[prog.DESProgStep]
+}
+
+type ProgramsMap map[string]Program
+
+/* ACTIVE PROGRAMS BY DEVICE SERIAL */
+var Programs = make(ProgramsMap)
+var ProgramsRWMutex = sync.RWMutex{}
+
+/* SERIALIZES PROGRAM STATUS / STEP CHANGES */
+var ProgramsRunMutex = sync.Mutex{}
+
+var programTicker sync.Once
+
+func ProgramsMapWrite(serial string, prog Program) {
+	ProgramsRWMutex.Lock()
+	Programs[serial] = prog
+	ProgramsRWMutex.Unlock()
+}
+func ProgramsMapRead(serial string) (prog Program, ok bool) {
+	ProgramsRWMutex.Lock()
+	prog, ok = Programs[serial]
+	ProgramsRWMutex.Unlock()
+	return
+}
+func ProgramsMapReadAll() (progs []Program) {
+	ProgramsRWMutex.Lock()
+	for _, prog := range Programs {
+		progs = append(progs, prog)
+	}
+	ProgramsRWMutex.Unlock()
+	return
+}
+func ProgramsMapRemove(serial string) {
+	ProgramsRWMutex.Lock()
+	delete(Programs, serial)
+	ProgramsRWMutex.Unlock()
+}
+
+/* START A TEST PROGRAM ON THIS DEVICE'S ACTIVE JOB */
+func (device *Device) StartProgram(req ProgramRequest, src, uid string) (prog Program, err error) {
+
+	if len(req.Steps) == 0 {
+		return prog, fmt.Errorf("A program requires at least one step")
+	}
+	for i, step := range req.Steps {
+		if err = step.Validate(); err != nil {
+			return prog, fmt.Errorf("Step %d: %s", i+1, err.Error())
+		}
+	}
+
+	d := DevicesMapRead(device.DESDevSerial)
+	if d.DESDevSerial == "" {
+		return prog, fmt.Errorf("Device %s is not connected to this DES", device.DESDevSerial)
+	}
+	if d.DESJobName == d.CmdArchiveName() {
+		return prog, fmt.Errorf("Device %s has no active job", device.DESDevSerial)
+	}
+
+	steps, err := json.Marshal(req.Steps)
+	if err != nil {
+		return
+	}
+
+	ProgramsRunMutex.Lock()
+	defer ProgramsRunMutex.Unlock()
+
+	if active, ok := ProgramsMapRead(device.DESDevSerial); ok {
+		return prog, fmt.Errorf("Program %d is already %s on device %s", active.DESProgID, active.DESProgStatus, device.DESDevSerial)
+	}
+
+	prog.DESProgram = pkg.DESProgram{
+		DESProgRegTime:   time.Now().UTC().UnixMilli(),
+		DESProgRegAddr:   src,
+		DESProgRegUserID: uid,
+		DESProgSerial:    d.DESDevSerial,
+		DESProgJobName:   d.DESJobName,
+		DESProgName:      req.Name,
+		DESProgSteps:     string(steps),
+		DESProgStatus:    pkg.PROG_STATUS_RUNNING,
+	}
+	prog.Steps = req.Steps
+	if err = pkg.WriteDESProgram(&prog.DESProgram); err != nil {
+		return
+	}
+
+	prog.LogEvent(fmt.Sprintf("PROGRAM %d STARTED: %s ( %d steps )", prog.DESProgID, prog.DESProgName, len(prog.Steps)))
+	err = prog.StartStep(0)
+	return
+}
+
+/*
+	START STEP i: SEND ITS MODE / CONFIG TO THE DEVICE
+
+WHERE i IS PAST THE LAST STEP, THE PROGRAM IS COMPLETE
+CALLER MUST HOLD ProgramsRunMutex
+*/
+func (prog *Program) StartStep(i int) (err error) {
+
+	if i >= len(prog.Steps) {
+		return prog.Finish(pkg.PROG_STATUS_COMPLETE, "All steps complete")
+	}
+
+	prog.DESProgStep = i
+	prog.DESProgStepStart = time.Now().UTC().UnixMilli()
+	prog.DESProgStepElapsed = 0
+	prog.DESProgMsg = ""
+
+	step := prog.Step()
+	prog.LogEvent(fmt.Sprintf("PROGRAM %d STEP %d / %d: %s; mode %d; %s",
+		prog.DESProgID, i+1, len(prog.Steps), step.Name, step.Mode, step.EndMessage()))
+
+	if err = prog.SendStepConfig(); err != nil {
+		return prog.Finish(pkg.PROG_STATUS_FAILED, err.Error())
+	}
+
+	if err = pkg.WriteDESProgram(&prog.DESProgram); err != nil {
+		pkg.LogErr(err)
+	}
+	ProgramsMapWrite(prog.DESProgSerial, *prog)
+	return
+}
+
+/* APPLY THE CURRENT STEP'S MODE AND OVERRIDES TO THE DEVICE'S CONFIG AND SEND IT */
+func (prog *Program) SendStepConfig() (err error) {
+
+	step := prog.Step()
+
+	d := DevicesMapRead(prog.DESProgSerial)
+	cfg := d.CFG
+	if len(step.Config) > 0 {
+		if err = json.Unmarshal(step.Config, &cfg); err != nil {
+			return
+		}
+	}
+	cfg.CfgVlvTgt = step.Mode
+	cfg.CfgUserID = prog.DESProgRegUserID
+	cfg.CfgApp = pkg.DES_APP
+
+	d.CFG = cfg
+	return d.SetConfigRequest(pkg.DES_ADDR)
+}
+
+/* END THE PROGRAM; CALLER MUST HOLD ProgramsRunMutex */
+func (prog *Program) Finish(status, msg string) (err error) {
+
+	prog.DESProgStepElapsed = prog.StepElapsed(time.Now().UTC().UnixMilli())
+	prog.DESProgStatus = status
+	prog.DESProgMsg = msg
+	ProgramsMapRemove(prog.DESProgSerial)
+
+	prog.LogEvent(fmt.Sprintf("PROGRAM %d %s: %s", prog.DESProgID, status, msg))
+	return pkg.WriteDESProgram(&prog.DESProgram)
+}
+
+/* LOG A NOTE_PROGRAM_COMMENT EVENT TO THE DEVICE'S JOB */
+func (prog *Program) LogEvent(msg string) {
+
+	d := DevicesMapRead(prog.DESProgSerial)
+	if d.DESDevSerial == "" {
+		return
+	}
+	d.EVT = Event{
+		EvtUserID: prog.DESProgRegUserID,
+		EvtApp:    pkg.DES_APP,
+		EvtCode:   NOTE_PROGRAM_COMMENT,
+		EvtTitle:  GetEventTypeByCode(NOTE_PROGRAM_COMMENT),
+		EvtMsg:    msg,
+	}
+	if err := d.SetEventRequest(pkg.DES_ADDR); err != nil {
+		pkg.LogErr(err)
+	}
+}
+
+/* PAUSE / RESUME / ABORT ************************************************************************/
+
+/* RETURNS THE ACTIVE PROGRAM WITH THE GIVEN ID; CALLER MUST HOLD ProgramsRunMutex */
+func getActiveProgram(id int64) (prog Program, err error) {
+
+	rec, err := pkg.GetDESProgram(id)
+	if err != nil {
+		return prog, fmt.Errorf("Program %d not found", id)
+	}
+	prog, ok := ProgramsMapRead(rec.DESProgSerial)
+	if !ok || prog.DESProgID != id {
+		return Program{DESProgram: rec}, fmt.Errorf("Program %d is %s", id, rec.DESProgStatus)
+	}
+	return
+}
+
+/* STOP WATCHING THE CURRENT STEP'S END CONDITION; THE DEVICE IS LEFT IN ITS CURRENT MODE */
+func PauseProgram(id int64, uid string) (prog Program, err error) {
+
+	ProgramsRunMutex.Lock()
+	defer ProgramsRunMutex.Unlock()
+
+	if prog, err = getActiveProgram(id); err != nil {
+		return
+	}
+	if prog.DESProgStatus != pkg.PROG_STATUS_RUNNING {
+		return prog, fmt.Errorf("Program %d is %s", id, prog.DESProgStatus)
+	}
+
+	prog.DESProgStepElapsed = prog.StepElapsed(time.Now().UTC().UnixMilli())
+	prog.DESProgStatus = pkg.PROG_STATUS_PAUSED
+	prog.DESProgMsg = fmt.Sprintf("Paused by %s", uid)
+	if err = pkg.WriteDESProgram(&prog.DESProgram); err != nil {
+		return
+	}
+	ProgramsMapWrite(prog.DESProgSerial, prog)
+
+	prog.LogEvent(fmt.Sprintf("PROGRAM %d PAUSED AT STEP %d", prog.DESProgID, prog.DESProgStep+1))
+	return
+}
+
+/* RESEND THE CURRENT STEP'S MODE / CONFIG AND CONTINUE WATCHING ITS END CONDITION */
+func ResumeProgram(id int64, uid string) (prog Program, err error) {
+
+	ProgramsRunMutex.Lock()
+	defer ProgramsRunMutex.Unlock()
+
+	if prog, err = getActiveProgram(id); err != nil {
+		return
+	}
+	if prog.DESProgStatus != pkg.PROG_STATUS_PAUSED {
+		return prog, fmt.Errorf("Program %d is %s", id, prog.DESProgStatus)
+	}
+
+	prog.DESProgStatus = pkg.PROG_STATUS_RUNNING
+	prog.DESProgStepStart = time.Now().UTC().UnixMilli()
+	prog.DESProgMsg = fmt.Sprintf("Resumed by %s", uid)
+
+	prog.LogEvent(fmt.Sprintf("PROGRAM %d RESUMED AT STEP %d", prog.DESProgID, prog.DESProgStep+1))
+	if err = prog.SendStepConfig(); err != nil {
+		prog.Finish(pkg.PROG_STATUS_FAILED, err.Error())
+		return
+	}
+
+	if err = pkg.WriteDESProgram(&prog.DESProgram); err != nil {
+		return
+	}
+	ProgramsMapWrite(prog.DESProgSerial, prog)
+	return
+}
+
+/* END THE PROGRAM; THE DEVICE IS LEFT IN ITS CURRENT MODE */
+func AbortProgram(id int64, uid string) (prog Program, err error) {
+
+	ProgramsRunMutex.Lock()
+	defer ProgramsRunMutex.Unlock()
+
+	if prog, err = getActiveProgram(id); err != nil {
+		return
+	}
+	err = prog.Finish(pkg.PROG_STATUS_ABORTED, fmt.Sprintf("Aborted by %s at step %d", uid, prog.DESProgStep+1))
+	return
+}
+
+/* END CONDITIONS ********************************************************************************/
+
+/*
+	CALLED WHEN AN SSP / SCVF EVENT IS LOGGED FOR THIS DEVICE
+
+ADVANCES A RUNNING PROGRAM WHOSE CURRENT STEP ENDS ON cond
+*/
+func (device *Device) CheckProgramCondition(cond string) {
+
+	if _, ok := ProgramsMapRead(device.DESDevSerial); !ok {
+		return
+	}
+
+	ProgramsRunMutex.Lock()
+	defer ProgramsRunMutex.Unlock()
+
+	prog, ok := ProgramsMapRead(device.DESDevSerial)
+	if !ok || prog.DESProgStatus != pkg.PROG_STATUS_RUNNING || prog.Step().End != cond {
+		return
+	}
+	if err := prog.StartStep(prog.DESProgStep + 1); err != nil {
+		pkg.LogErr(err)
+	}
+}
+
+/*
+	RETURNS TRUE WHERE A RUNNING PROGRAM'S CURRENT STEP SETS THIS DEVICE'S MODE
+
+THE DES MUST NOT CHANGE THE DEVICE'S MODE ON ITS OWN ( EX: AUTOMATIC FLOW SENSOR CHANGE ) WHILE THIS IS TRUE
+*/
+func (device *Device) ProgramHoldsMode() bool {
+	prog, ok := ProgramsMapRead(device.DESDevSerial)
+	return ok && prog.DESProgStatus == pkg.PROG_STATUS_RUNNING
+}
+
+/* CALLED WHEN A SAMPLE IS WRITTEN TO THE ACTIVE JOB; ADVANCES A STEP WHOSE PRESSURE THRESHOLD IS REACHED */
+func (device *Device) CheckProgramPressure(smp Sample) {
+
+	prog, ok := ProgramsMapRead(device.DESDevSerial)
+	if !ok || prog.DESProgStatus != pkg.PROG_STATUS_RUNNING || prog.Step().End != PROG_END_PRESSURE {
+		return
+	}
+
+	step := prog.Step()
+	if (step.Rising && smp.SmpPress < step.Pressure) || (!step.Rising && smp.SmpPress > step.Pressure) {
+		return
+	}
+	device.CheckProgramCondition(PROG_END_PRESSURE)
+}
+
+/*
+	CHECK ALL ACTIVE PROGRAMS; CALLED EVERY PROG_TICK_MS
+
+- ABORTS PROGRAMS WHOSE JOB HAS ENDED
+- PAUSES RUNNING PROGRAMS WHOSE DEVICE HAS LEFT THE STEP'S MODE ( EX: A USER CHANGED THE MODE )
+- ADVANCES RUNNING STEPS WHOSE DURATION HAS ELAPSED
+- FAILS RUNNING STEPS THAT HAVE TIMED OUT
+*/
+func CheckPrograms() {
+
+	ProgramsRunMutex.Lock()
+	defer ProgramsRunMutex.Unlock()
+
+	now := time.Now().UTC().UnixMilli()
+	for _, prog := range ProgramsMapReadAll() {
+
+		d := DevicesMapRead(prog.DESProgSerial)
+		if d.DESJobName != prog.DESProgJobName {
+			prog.Finish(pkg.PROG_STATUS_ABORTED, fmt.Sprintf("Job %s ended at step %d", prog.DESProgJobName, prog.DESProgStep+1))
+			continue
+		}
+
+		if prog.DESProgStatus != pkg.PROG_STATUS_RUNNING {
+			continue
+		}
+
+		step := prog.Step()
+		elapsed := prog.StepElapsed(now)
+		if d.CFG.CfgVlvTgt != step.Mode {
+			prog.DESProgStepElapsed = elapsed
+			prog.DESProgStatus = pkg.PROG_STATUS_PAUSED
+			prog.DESProgMsg = fmt.Sprintf("Device mode changed to %d; step %d requires mode %d", d.CFG.CfgVlvTgt, prog.DESProgStep+1, step.Mode)
+			if err := pkg.WriteDESProgram(&prog.DESProgram); err != nil {
+				pkg.LogErr(err)
+			}
+			ProgramsMapWrite(prog.DESProgSerial, prog)
+			prog.LogEvent(fmt.Sprintf("PROGRAM %d PAUSED AT STEP %d: %s", prog.DESProgID, prog.DESProgStep+1, prog.DESProgMsg))
+			continue
+		}
+		if step.End == PROG_END_DURATION && elapsed >= step.Duration {
+			if err := prog.StartStep(prog.DESProgStep + 1); err != nil {
+				pkg.LogErr(err)
+			}
+		} else if step.Timeout > 0 && elapsed >= step.Timeout {
+			prog.Finish(pkg.PROG_STATUS_FAILED, fmt.Sprintf("Step %d timed out", prog.DESProgStep+1))
+		}
+	}
+}
+
+func init() { RegisterResume(ResumePrograms) }
+
+/* RELOAD RUNNING / PAUSED PROGRAMS FOR DEVICES CONNECTED BY THIS DES; CALLED ON STARTUP */
+func ResumePrograms() {
+
+	progs, err := pkg.GetDESProgramsByStatus(pkg.PROG_STATUS_RUNNING, pkg.PROG_STATUS_PAUSED)
+	if err != nil {
+		pkg.LogErr(err)
+	}
+
+	for _, rec := range progs {
+		if DevicesMapRead(rec.DESProgSerial).DESDevSerial == "" {
+			continue
+		}
+		prog := Program{DESProgram: rec}
+		if err := json.Unmarshal([]byte(rec.DESProgSteps), &prog.Steps); err != nil || prog.DESProgStep >= len(prog.Steps) {
+			prog.Finish(pkg.PROG_STATUS_FAILED, "Invalid program steps")
+			continue
+		}
+		fmt.Printf("\nResumePrograms( ) -> %s: program %d %s at step %d\n", rec.DESProgSerial, rec.DESProgID, rec.DESProgStatus, rec.DESProgStep+1)
+		ProgramsMapWrite(rec.DESProgSerial, prog)
+	}
+
+	programTicker.Do(func() {
+		go func() {
+			for range time.Tick(time.Millisecond * PROG_TICK_MS) {
+				CheckPrograms()
+			}
+		}()
+	})
+}
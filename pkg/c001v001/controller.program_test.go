@@ -0,0 +1,107 @@
+package c001v001
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/leehayford/des/pkg"
+)
+
+/* A DEVICE IN THE DevicesMap RUNNING job IN mode; NO MQTT OR DATABASE CLIENTS */
+func testConnectedDevice(t *testing.T, serial, job string, mode int32) {
+	t.Helper()
+	device := testDevice(serial)
+	device.DESJobName = job
+	device.CFG.CfgVlvTgt = mode
+	DevicesMapWrite(serial, device)
+	t.Cleanup(func() { DevicesMapRemove(serial) })
+}
+
+func testProgram(t *testing.T, serial, job, status string, stepStart, elapsed int64, steps ...ProgramStep) pkg.DESProgram {
+	t.Helper()
+	js, err := json.Marshal(steps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prog := pkg.DESProgram{
+		DESProgRegTime:     time.Now().UTC().UnixMilli(),
+		DESProgRegUserID:   "user",
+		DESProgSerial:      serial,
+		DESProgJobName:     job,
+		DESProgSteps:       string(js),
+		DESProgStatus:      status,
+		DESProgStepStart:   stepStart,
+		DESProgStepElapsed: elapsed,
+	}
+	if err = pkg.WriteDESProgram(&prog); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ProgramsMapRemove(serial) })
+	return prog
+}
+
+func TestResumePrograms(t *testing.T) {
+	testDESDB(t, &pkg.DESProgram{}, &pkg.DESError{})
+
+	/* NO PROGRAM TICKER; CheckPrograms IS NOT UNDER TEST */
+	programTicker.Do(func() {})
+
+	steps := []ProgramStep{
+		{Name: "build", Mode: MODE_BUILD, End: PROG_END_SSP},
+		{Name: "vent", Mode: MODE_VENT, End: PROG_END_DURATION, Duration: 60000},
+	}
+	now := time.Now().UTC().UnixMilli()
+
+	testConnectedDevice(t, "SN0001", "SN0001_0000000001", MODE_BUILD)
+	testConnectedDevice(t, "SN0002", "SN0002_0000000001", MODE_VENT)
+	running := testProgram(t, "SN0001", "SN0001_0000000001", pkg.PROG_STATUS_RUNNING, now-30000, 5000, steps...)
+	paused := testProgram(t, "SN0002", "SN0002_0000000001", pkg.PROG_STATUS_PAUSED, now-30000, 5000, steps...)
+	testProgram(t, "SN0003", "SN0003_0000000001", pkg.PROG_STATUS_RUNNING, now, 0, steps...) // Not connected by this DES
+	testProgram(t, "SN0001", "SN0001_0000000000", pkg.PROG_STATUS_COMPLETE, now, 0, steps...)
+
+	ResumePrograms()
+
+	prog, ok := ProgramsMapRead("SN0001")
+	if !ok || prog.DESProgID != running.DESProgID || len(prog.Steps) != len(steps) || prog.Step().Name != "build" {
+		t.Fatalf("running program not resumed: %+v, %t", prog, ok)
+	}
+
+	/* TIME THE DES WAS DOWN COUNTS TOWARD A RUNNING STEP; NOT TOWARD A PAUSED STEP */
+	if elapsed := prog.StepElapsed(now); elapsed != 35000 {
+		t.Errorf("running step elapsed %d ms; want 35000", elapsed)
+	}
+	if prog, ok = ProgramsMapRead("SN0002"); !ok || prog.DESProgID != paused.DESProgID {
+		t.Fatalf("paused program not resumed: %+v, %t", prog, ok)
+	}
+	if elapsed := prog.StepElapsed(now); elapsed != 5000 {
+		t.Errorf("paused step elapsed %d ms; want 5000", elapsed)
+	}
+
+	if _, ok = ProgramsMapRead("SN0003"); ok {
+		t.Error("program resumed for a device this DES does not connect")
+	}
+	if len(ProgramsMapReadAll()) != 2 {
+		t.Errorf("%d programs resumed; want 2", len(ProgramsMapReadAll()))
+	}
+}
+
+func TestProgramHoldsMode(t *testing.T) {
+	device := testDevice("SN0001")
+	if device.ProgramHoldsMode() {
+		t.Fatal("mode held without a program")
+	}
+
+	prog := Program{DESProgram: pkg.DESProgram{DESProgSerial: "SN0001", DESProgStatus: pkg.PROG_STATUS_PAUSED}}
+	ProgramsMapWrite("SN0001", prog)
+	t.Cleanup(func() { ProgramsMapRemove("SN0001") })
+	if device.ProgramHoldsMode() {
+		t.Fatal("mode held by a paused program")
+	}
+
+	prog.DESProgStatus = pkg.PROG_STATUS_RUNNING
+	ProgramsMapWrite("SN0001", prog)
+	if !device.ProgramHoldsMode() {
+		t.Fatal("mode not held by a running program")
+	}
+}
@@ -0,0 +1,330 @@
+package c001v001
+
+import (
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/leehayford/des/pkg"
+)
+
+/*
+STABILIZED CONDITIONS: SHUT-IN PRESSURE ( SSP ) AND SURFACE-CASING VENT FLOW ( SCVF )
+
+WHILE A DEVICE IS IN A MONITORED MODE, THE DES KEEPS A ROLLING WINDOW OF SAMPLE VALUES FOR THAT DEVICE
+  - THE StableKind DECIDES WHICH VALUE IS WINDOWED AND WHAT "STABLE" MEANS FOR THAT WINDOW
+  - WHEN THE WINDOW REMAINS STABLE FOR THE KIND'S CONFIGURED DURATION, THE CONDITION IS REACHED
+
+SSP ( MODE_BUILD )
+  - THE PRESSURE RATE ( kPa / hour ) IS THE SLOPE OF THE WINDOW ( pkg.SlopeAndIntercept )
+  - STABLE WHILE THE RATE REMAINS AT OR BELOW Config.CfgSSPRate; REACHED AFTER Config.CfgSSPDur
+
+SCVF ( MODE_HI_FLOW / MODE_LO_FLOW )
+  - MODE_HI_FLOW USES Sample.SmpHiFlow; MODE_LO_FLOW USES Sample.SmpLoFlow
+  - STABLE WHILE THE WINDOW'S STANDARD DEVIATION IS WITHIN SCVF_TOLERANCE OF ITS MEAN ( pkg.MeanStdDev )
+  - REACHED AFTER Config.CfgSSCVFDur
+  - WHERE Config.CfgFlowTog IS SET ( > 0 ), THE DES SWITCHES BETWEEN HIGH AND LOW FLOW SENSORS
+    WHEN THE WINDOW MEAN CROSSES Config.CfgFlowTog
+
+THE SAME StableMonitor IS USED FOR LIVE SAMPLES ( CheckSSPCondition / CheckSCVFCondition )
+AND WHEN GENERATING REPORTS FROM A JOB'S STORED SAMPLES ( FindStable )
+*/
+const STABLE_WINDOW_SPAN int64 = 900000   // 15 minutes; span of the rolling window
+const STABLE_WINDOW_MIN_SAMPLES = 10      // Fewer samples than this do not produce a meaningful result
+const SCVF_TOLERANCE float64 = 0.05       // Flow is stable while std dev <= 5% of the mean...
+const SCVF_MIN_TOLERANCE float64 = 0.01   // ...or while std dev <= 0.01 L/min ( near-zero flow )
+const SCVF_FLOW_TOG_HYSTERESIS = 0.1      // HI -> LO only once the mean falls 10% below CfgFlowTog
+const SCVF_FLOW_TOG_HOLDOFF int64 = 60000 // Minimum time between automatic sensor changes
+
+/* THE PARAMETERS THAT DISTINGUISH ONE STABILIZED CONDITION FROM ANOTHER */
+type StableKind struct {
+	Name     string                                                                           // Used in map keys and log messages
+	Code     int32                                                                            // Event code logged when the condition is reached
+	Value    func(smp Sample, mode int32) float32                                             // The sample value to window
+	Stable   func(times []int64, vals []float32, cfg Config) (level, spread float32, ok bool) // Window level, spread and stability
+	Duration func(cfg Config) int64                                                           // Time the window must remain stable
+	Limit    func(cfg Config) float32                                                         // Level at or above which the result is serious; nil: never
+	Message  func(res StableResult) string                                                    // Event message describing the result
+}
+
+var SSP_STABLE = &StableKind{
+	Name: "SSP",
+	Code: NOTE_SSP_COMMENT,
+	Value: func(smp Sample, mode int32) float32 {
+		return smp.SmpPress
+	},
+	Stable: func(times []int64, vals []float32, cfg Config) (level, spread float32, ok bool) {
+		/* X IN HOURS, RELATIVE TO THE START OF THE WINDOW, SO THE SLOPE IS IN kPa / hour */
+		x := make([]float32, len(times))
+		for j, t := range times {
+			x[j] = float32(t-times[0]) / 3600000
+		}
+		spread, _ = pkg.SlopeAndIntercept(x, vals)
+		level = pkg.MeanFloat32(vals)
+		ok = math.Abs(float64(spread)) <= float64(cfg.CfgSSPRate)
+		return
+	},
+	Duration: func(cfg Config) int64 {
+		return int64(cfg.CfgSSPDur)
+	},
+	Message: func(res StableResult) string {
+		return fmt.Sprintf("SSP: %.2f kPa; rate: %.3f kPa/h; stable for %d min",
+			res.Level, res.Spread, (res.End-res.Start)/60000)
+	},
+}
+
+var SCVF_STABLE = &StableKind{
+	Name:  "SCVF",
+	Code:  NOTE_SSCVF_COMMENT,
+	Value: FlowByMode,
+	Stable: func(times []int64, vals []float32, cfg Config) (level, spread float32, ok bool) {
+		mean, std := pkg.MeanStdDev(vals)
+		ok = std <= math.Max(math.Abs(mean)*SCVF_TOLERANCE, SCVF_MIN_TOLERANCE)
+		return float32(mean), float32(std), ok
+	},
+	Duration: func(cfg Config) int64 {
+		return int64(cfg.CfgSSCVFDur)
+	},
+	Limit: func(cfg Config) float32 {
+		return cfg.CfgHiSCVF
+	},
+	Message: func(res StableResult) string {
+		sensor := "LFS"
+		if res.Mode == MODE_HI_FLOW {
+			sensor = "HFS"
+		}
+		msg := fmt.Sprintf("SCVF: %.3f L/min ( %s ); std dev: %.3f; stable for %d min",
+			res.Level, sensor, res.Spread, (res.End-res.Start)/60000)
+		if res.Serious {
+			msg += "; AT OR ABOVE HIGH SCVF LIMIT"
+		}
+		return msg
+	},
+}
+
+/* RETURNS THE FLOW VALUE MEASURED BY THE SENSOR FOR THIS MODE */
+func FlowByMode(smp Sample, mode int32) float32 {
+	if mode == MODE_HI_FLOW {
+		return smp.SmpHiFlow
+	}
+	return smp.SmpLoFlow
+}
+
+type StableMonitor struct {
+	Kind        *StableKind  `json:"-"`
+	JobName     string       `json:"job_name"`     // Job to which the window belongs; a new job resets the monitor
+	Mode        int32        `json:"mode"`         // Mode being monitored; a mode change resets the monitor
+	PeriodStart int64        `json:"period_start"` // Time of the first sample in this mode
+	StableStart int64        `json:"stable_start"` // Time the window first became stable; 0 while not stable
+	Reached     bool         `json:"reached"`      // The condition has been declared for this period
+	Result      StableResult `json:"result"`       // Set when the condition is reached
+	ToggleTime  int64        `json:"toggle_time"`  // Time of the last automatic sensor change ( SCVF )
+	Times       []int64      `json:"-"`            // Rolling window: sample times
+	Vals        []float32    `json:"-"`            // Rolling window: sample values
+}
+
+type StableResult struct {
+	Start   int64   `json:"start"`   // Start of the stable period
+	End     int64   `json:"end"`     // Time at which the condition was declared
+	Mode    int32   `json:"mode"`    // Mode in which the condition was declared
+	Level   float32 `json:"level"`   // Stabilized value; mean of the final window ( kPa or L/min )
+	Spread  float32 `json:"spread"`  // SSP: rate ( kPa / hour ); SCVF: std dev of the final window
+	Serious bool    `json:"serious"` // Stabilized value is at or above the kind's limit
+	Code    int32   `json:"code"`    // Event code of the kind that produced this result
+	msg     func(res StableResult) string
+}
+
+/* RETURNS THE EVENT MESSAGE DESCRIBING THIS RESULT */
+func (res StableResult) Message() string {
+	if res.msg == nil {
+		return ""
+	}
+	return res.msg(res)
+}
+
+/*
+	ADD A SAMPLE TO THE ROLLING WINDOW AND CHECK FOR THE CONDITION; RETURNS ok ONCE PER PERIOD
+
+- SAMPLES OLDER THAN STABLE_WINDOW_SPAN ARE DROPPED FROM THE WINDOW
+- NOTHING IS CALCULATED UNTIL THE PERIOD HAS RUN FOR A FULL WINDOW
+*/
+func (mon *StableMonitor) AppendSample(smp Sample, cfg Config) (res StableResult, ok bool) {
+
+	if mon.PeriodStart == 0 {
+		mon.PeriodStart = smp.SmpTime
+	}
+
+	mon.Times = append(mon.Times, smp.SmpTime)
+	mon.Vals = append(mon.Vals, mon.Kind.Value(smp, mon.Mode))
+
+	/* DROP SAMPLES THAT HAVE FALLEN OUT OF THE WINDOW */
+	i := 0
+	for i < len(mon.Times) && mon.Times[i] < smp.SmpTime-STABLE_WINDOW_SPAN {
+		i++
+	}
+	mon.Times = mon.Times[i:]
+	mon.Vals = mon.Vals[i:]
+
+	if mon.Reached ||
+		len(mon.Times) < STABLE_WINDOW_MIN_SAMPLES ||
+		smp.SmpTime-mon.PeriodStart < STABLE_WINDOW_SPAN {
+		return
+	}
+
+	level, spread, stable := mon.Kind.Stable(mon.Times, mon.Vals, cfg)
+	if !stable {
+		mon.StableStart = 0
+		return
+	}
+
+	if mon.StableStart == 0 {
+		mon.StableStart = smp.SmpTime
+	}
+
+	if smp.SmpTime-mon.StableStart >= mon.Kind.Duration(cfg) {
+		mon.Reached = true
+		mon.Result = StableResult{
+			Start:   mon.StableStart,
+			End:     smp.SmpTime,
+			Mode:    mon.Mode,
+			Level:   level,
+			Spread:  spread,
+			Serious: mon.Kind.Limit != nil && level >= mon.Kind.Limit(cfg),
+			Code:    mon.Kind.Code,
+			msg:     mon.Kind.Message,
+		}
+		return mon.Result, true
+	}
+
+	return
+}
+
+/*
+	RETURNS THE FLOW MODE THE DEVICE SHOULD BE SWITCHED TO, IF ANY ( SCVF )
+
+- LO -> HI WHEN THE WINDOW MEAN RISES ABOVE Config.CfgFlowTog
+- HI -> LO WHEN THE WINDOW MEAN FALLS BELOW Config.CfgFlowTog LESS SCVF_FLOW_TOG_HYSTERESIS
+- DISABLED WHERE Config.CfgFlowTog <= 0
+*/
+func (mon *StableMonitor) FlowToggle(smp Sample, cfg Config) (mode int32, ok bool) {
+
+	if mon.Kind != SCVF_STABLE ||
+		cfg.CfgFlowTog <= 0 ||
+		len(mon.Times) < STABLE_WINDOW_MIN_SAMPLES ||
+		smp.SmpTime-mon.ToggleTime < SCVF_FLOW_TOG_HOLDOFF {
+		return
+	}
+
+	mean := pkg.MeanFloat32(mon.Vals)
+	switch mon.Mode {
+
+	case MODE_LO_FLOW:
+		if mean > cfg.CfgFlowTog {
+			return MODE_HI_FLOW, true
+		}
+
+	case MODE_HI_FLOW:
+		if mean < cfg.CfgFlowTog*(1-SCVF_FLOW_TOG_HYSTERESIS) {
+			return MODE_LO_FLOW, true
+		}
+	}
+	return
+}
+
+var StableMonitors = make(map[string]StableMonitor)
+var StableMonitorsRWMutex = sync.RWMutex{}
+
+func stableMonitorKey(serial string, kind *StableKind) string {
+	return kind.Name + "/" + serial
+}
+
+/* WRITE TO THE StableMonitors MAP */
+func StableMonitorsMapWrite(serial string, mon StableMonitor) {
+	StableMonitorsRWMutex.Lock()
+	StableMonitors[stableMonitorKey(serial, mon.Kind)] = mon
+	StableMonitorsRWMutex.Unlock()
+}
+
+/* READ FROM THE StableMonitors MAP; RETURNS StableMonitor */
+func StableMonitorsMapRead(serial string, kind *StableKind) (mon StableMonitor) {
+	StableMonitorsRWMutex.Lock()
+	mon = StableMonitors[stableMonitorKey(serial, kind)]
+	StableMonitorsRWMutex.Unlock()
+	return
+}
+
+/* REMOVE DEVICE FROM StableMonitors MAP; ALL KINDS WHERE NONE ARE GIVEN */
+func StableMonitorsMapRemove(serial string, kinds ...*StableKind) {
+	if len(kinds) == 0 {
+		kinds = []*StableKind{SSP_STABLE, SCVF_STABLE}
+	}
+	StableMonitorsRWMutex.Lock()
+	for _, kind := range kinds {
+		delete(StableMonitors, stableMonitorKey(serial, kind))
+	}
+	StableMonitorsRWMutex.Unlock()
+}
+
+/*
+	RETURNS THE DEVICE'S MONITOR OF THIS KIND FOR THIS SAMPLE
+
+A NEW MONITOR IS STARTED WHEN THE DEVICE STARTS A NEW JOB OR CHANGES MODE
+*/
+func (device *Device) StableMonitor(kind *StableKind, smp Sample) (mon StableMonitor) {
+	mon = StableMonitorsMapRead(device.DESDevSerial, kind)
+	if mon.Kind == nil || mon.JobName != smp.SmpJobName || mon.Mode != device.CFG.CfgVlvTgt {
+		mon = StableMonitor{
+			Kind:       kind,
+			JobName:    smp.SmpJobName,
+			Mode:       device.CFG.CfgVlvTgt,
+			ToggleTime: mon.ToggleTime,
+		}
+	}
+	return
+}
+
+/*
+	CREATE A STABILIZED CONDITION EVENT FOR THIS DEVICE
+
+THE EVENT IS ATTRIBUTED TO THE DEVICE USER AND THE DES ( NOT TO ANY OPERATOR )
+*/
+func (device *Device) StableEvent(res StableResult) Event {
+	return Event{
+		EvtTime:   res.End,
+		EvtAddr:   device.DESDevSerial,
+		EvtUserID: device.DESU.GetUUIDString(),
+		EvtApp:    pkg.DES_APP,
+		EvtCode:   res.Code,
+		EvtTitle:  GetEventTypeByCode(res.Code),
+		EvtMsg:    res.Message(),
+	}
+}
+
+/*
+	RUN THE DETECTION FOR THIS KIND OVER THIS JOB'S STORED SAMPLES BETWEEN start AND end
+
+USED BY REPORTS WHEN NO EVENT WAS WRITTEN WHILE THE JOB WAS RUNNING
+*/
+func (job *Job) FindStable(kind *StableKind, start, end int64, cfg Config) (res StableResult, ok bool) {
+
+	mon := StableMonitor{Kind: kind, JobName: job.DESJobName, Mode: cfg.CfgVlvTgt}
+	for _, smp := range job.Samples {
+		if smp.SmpTime < start || smp.SmpTime > end {
+			continue
+		}
+		if res, ok = mon.AppendSample(smp, cfg); ok {
+			return
+		}
+	}
+	return
+}
+
+/* RETURNS THE FIRST OF THIS JOB'S EVENTS WITH THE GIVEN CODE BETWEEN start AND end */
+func (job *Job) FindEvent(code int32, start, end int64) (evt Event, ok bool) {
+	for _, e := range job.Events {
+		if e.EvtCode == code && e.EvtTime >= start && e.EvtTime <= end {
+			return e, true
+		}
+	}
+	return
+}
@@ -0,0 +1,248 @@
+package c001v001
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/leehayford/des/pkg"
+)
+
+/*
+CONFIGURATION TEMPLATES
+
+A TEMPLATE'S SETTINGS ARE A BulkPatch: ONLY THE FIELDS PRESENT ARE APPLIED
+  - WHEN STARTING A JOB: ON TOP OF THE ADM / CFG / HDR IN THE START JOB REQUEST
+  - TO A RUNNING DEVICE: SENT AS Set*Request ( SEE SendBulkRecord )
+
+SETTINGS MUST PASS THE MODEL Validate( ) AND `validate` TAG RULES, STARTING FROM THE DEFAULT SETTINGS
+
+TEMPLATES BELONG TO THE ORGANIZATION OF THE USER'S ACCOUNT ( SEE pkg.GetUserOrg ); org IS NEVER TAKEN FROM THE REQUEST
+*/
+
+/* FIELDS THAT BELONG TO THE DES OR THE JOB RATHER THAN THE WELL; THEY CAN NOT BE TEMPLATED */
+var TPL_EXCLUDED = []string{
+	"adm_def_host", "adm_def_port", "adm_op_host", "adm_op_port",
+	"hdr_job_start", "hdr_job_end",
+}
+
+type TemplateRequest struct {
+	Name     string    `json:"name"`
+	Desc     string    `json:"desc"`
+	Settings BulkPatch `json:"settings"`
+}
+
+type TemplateFromJobRequest struct {
+	pkg.DESRegistration `json:"reg"` // The job whose settings are saved
+	Name                string       `json:"name"`
+	Desc                string       `json:"desc"`
+}
+
+type TemplateApplyRequest struct {
+	DESTplID     int64  `json:"des_tpl_id"`
+	DESDevSerial string `json:"des_dev_serial"`
+}
+
+type TemplateListRequest struct {
+	Name string `json:"name"` // Versions only
+}
+
+/* RETURNS AN ERROR WHERE THE SETTINGS CAN NOT BE TEMPLATED OR FAIL THE MODEL VALIDATION RULES */
+func ValidateTemplateSettings(settings BulkPatch) (err error) {
+
+	if err = settings.Validate(); err != nil {
+		return
+	}
+
+	d := Device{}
+	d.ADM.DefaultSettings_Admin(pkg.DESRegistration{})
+	d.CFG.DefaultSettings_Config(pkg.DESRegistration{})
+	d.HDR.DefaultSettings_Header(pkg.DESRegistration{})
+
+	for typ, raw := range settings.Types() {
+
+		fields := make(map[string]interface{})
+		if err = json.Unmarshal(raw, &fields); err != nil {
+			return
+		}
+		for _, ex := range TPL_EXCLUDED {
+			if _, ok := fields[ex]; ok {
+				return fmt.Errorf("Template %s: %s can not be templated", typ, ex)
+			}
+		}
+
+		/* APPLY THE SETTINGS TO THE DEFAULTS; Validate( ) MUST NOT CHANGE THEM */
+		rec := BulkRecord(typ, d)
+		if err = json.Unmarshal(raw, rec); err != nil {
+			return
+		}
+		_, before, err := historyValues(rec)
+		if err != nil {
+			return err
+		}
+		switch r := rec.(type) {
+		case *Admin:
+			r.Validate()
+		case *Config:
+			r.Validate()
+		case *Header:
+			r.Validate()
+		}
+		_, after, err := historyValues(rec)
+		if err != nil {
+			return err
+		}
+
+		if diffs := DiffFields(before, after); len(diffs) > 0 {
+			msgs := []string{}
+			for _, diff := range diffs {
+				msgs = append(msgs, fmt.Sprintf("%s %v ( must be %v )", diff.Field, diff.From, diff.To))
+			}
+			return fmt.Errorf("Template %s: %s", typ, strings.Join(msgs, ", "))
+		}
+		if err = pkg.ValidateModel(rec); err != nil {
+			return err
+		}
+	}
+	return
+}
+
+/* VALIDATE AND WRITE THE SETTINGS AS THE NEXT VERSION OF THE ORGANIZATION'S TEMPLATE */
+func CreateTemplate(req TemplateRequest, org, src, uid, job string) (tpl pkg.DESTemplate, err error) {
+
+	if err = ValidateTemplateSettings(req.Settings); err != nil {
+		return
+	}
+
+	js, err := json.Marshal(&req.Settings)
+	if err != nil {
+		return
+	}
+
+	tpl = pkg.DESTemplate{
+		DESTplRegAddr:   src,
+		DESTplRegUserID: uid,
+		DESTplOrg:       org,
+		DESTplName:      pkg.ValidateStringLength(req.Name, 32),
+		DESTplDesc:      req.Desc,
+		DESTplClass:     DEVICE_CLASS,
+		DESTplDevVer:    DEVICE_VERSION,
+		DESTplSettings:  string(js),
+		DESTplSource:    job,
+	}
+	err = pkg.WriteDESTemplate(&tpl)
+	return
+}
+
+/*
+	SAVE A JOB'S ADM / CFG / HDR AS A TEMPLATE
+
+USES THE LAST RECORD THE DEVICE REPORTED ( OR THE LAST REQUEST WHERE THE DEVICE NEVER REPORTED )
+*/
+func CreateTemplateFromJob(req TemplateFromJobRequest, org, src, uid string) (tpl pkg.DESTemplate, err error) {
+
+	job := Job{DESRegistration: req.DESRegistration}
+	if err = job.ConnectReadOnlyDBC(); err != nil {
+		return
+	}
+	defer job.DBC.Disconnect()
+
+	settings := BulkPatch{}
+	for _, typ := range []string{FLASH_TYPE_ADM, FLASH_TYPE_CFG, FLASH_TYPE_HDR} {
+
+		hist, err := job.GetHistory(typ)
+		if err != nil {
+			return tpl, err
+		}
+		if len(hist) == 0 {
+			continue
+		}
+
+		last := hist[len(hist)-1]
+		for i := len(hist) - 1; i >= 0; i-- {
+			if hist[i].Source == HIST_SOURCE_DEVICE {
+				last = hist[i]
+				break
+			}
+		}
+		for _, ex := range TPL_EXCLUDED {
+			delete(last.Values, ex)
+		}
+
+		js, err := json.Marshal(last.Values)
+		if err != nil {
+			return tpl, err
+		}
+		switch typ {
+		case FLASH_TYPE_ADM:
+			settings.ADM = js
+		case FLASH_TYPE_CFG:
+			settings.CFG = js
+		case FLASH_TYPE_HDR:
+			settings.HDR = js
+		}
+	}
+
+	return CreateTemplate(TemplateRequest{
+		Name:     req.Name,
+		Desc:     req.Desc,
+		Settings: settings,
+	}, org, src, uid, job.DESJobName)
+}
+
+/* RETURNS THE TEMPLATE AND ITS SETTINGS; THE TEMPLATE MUST BELONG TO org AND TO THIS CLASS / VERSION */
+func GetTemplate(id int64, org string) (tpl pkg.DESTemplate, settings BulkPatch, err error) {
+
+	/* ANOTHER ORGANIZATION'S TEMPLATE IS REPORTED AS NOT FOUND */
+	if tpl, err = pkg.GetDESTemplate(id); err != nil || tpl.DESTplOrg != org {
+		return pkg.DESTemplate{}, settings, fmt.Errorf("Template %d not found", id)
+	}
+	if tpl.DESTplClass != DEVICE_CLASS || tpl.DESTplDevVer != DEVICE_VERSION {
+		return tpl, settings, fmt.Errorf("Template %d belongs to device class %s version %s",
+			id, tpl.DESTplClass, tpl.DESTplDevVer)
+	}
+	err = json.Unmarshal([]byte(tpl.DESTplSettings), &settings)
+	return
+}
+
+/* APPLY THE TEMPLATE TO THE ADM / CFG / HDR OF A START JOB REQUEST; CALL BEFORE StartJobRequest */
+func (device *Device) ApplyTemplate(id int64, org string) (err error) {
+
+	_, settings, err := GetTemplate(id, org)
+	if err != nil {
+		return
+	}
+
+	for typ, raw := range settings.Types() {
+		switch typ {
+		case FLASH_TYPE_ADM:
+			err = json.Unmarshal(raw, &device.ADM)
+		case FLASH_TYPE_CFG:
+			err = json.Unmarshal(raw, &device.CFG)
+		case FLASH_TYPE_HDR:
+			err = json.Unmarshal(raw, &device.HDR)
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+/* SEND THE TEMPLATE'S SETTINGS TO A RUNNING DEVICE */
+func ApplyTemplateToDevice(req TemplateApplyRequest, org, src, uid string) (tpl pkg.DESTemplate, err error) {
+
+	tpl, settings, err := GetTemplate(req.DESTplID, org)
+	if err != nil {
+		return
+	}
+
+	for _, typ := range []string{FLASH_TYPE_ADM, FLASH_TYPE_CFG, FLASH_TYPE_HDR} {
+		if raw, ok := settings.Types()[typ]; ok {
+			if err = SendBulkRecord(req.DESDevSerial, typ, raw, src, uid); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
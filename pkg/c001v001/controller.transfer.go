@@ -0,0 +1,551 @@
+package c001v001
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/leehayford/des/pkg"
+)
+
+/*
+DEVICE TRANSFER BETWEEN DATA EXCHANGE SERVERS
+
+SENDING DES ( TransferDevice )
+ 1. ASKS THE RECEIVING DES TO PREPARE; IT REGISTERS THE DEVICE AND LISTENS FOR IT
+ 2. SENDS THE DEVICE ITS NEW OPERATIONAL BROKER ( ADM AdmOpHost / AdmOpPort ) AND AN OP_CODE_DES_REG_REQ EVENT ( EvtMsg = host:port )
+ 3. POLLS THE RECEIVING DES UNTIL THE DEVICE REPORTS OP_CODE_DES_REGISTERED THERE
+ 4. DISCONNECTS ITS DEVICE CLIENT AND EXPORTS THE DEVICE'S CMDARCHIVE AND JOB DATABASES TO THE RECEIVING DES
+ 5. MARKS THE DEVICE TRANSFERRED; IT IS NO LONGER CONNECTED BY THIS DES
+
+WHERE THE DEVICE HAS NOT REGISTERED BY THE DEADLINE, THE TRANSFER IS ROLLED BACK:
+THE RECEIVING DES DROPS THE DEVICE AND THE DEVICE IS SENT THIS DES'S BROKER
+
+A DEVICE WITH AN ACTIVE JOB CAN NOT BE TRANSFERRED
+*/
+var DEV_XFER_ROUTE = DEVICE_ROUTE + "/device/transfer"
+
+type TransferRequest struct {
+	DESDevSerial string `json:"des_dev_serial"`
+	PeerAPI      string `json:"peer_api"`    // The receiving DES API; ie: https://des2.example.com/api
+	PeerKey      string `json:"peer_key"`    // Bearer token for an admin on the receiving DES
+	Host         string `json:"host"`        // The receiving DES broker host, as the device should reach it
+	Port         int32  `json:"port"`        // The receiving DES broker port
+	TimeoutSec   int64  `json:"timeout_sec"` // Time allowed for the device to reach the receiving DES; DEV_XFER_TIMEOUT_SEC where 0
+}
+
+/* SENT BY THE SENDING DES TO THE RECEIVING DES */
+type TransferPeerRequest struct {
+	DESDev   pkg.DESDev `json:"des_dev"`
+	Host     string     `json:"host"`
+	Port     int32      `json:"port"`
+	Deadline int64      `json:"deadline"`
+}
+
+/* SENDING DES **********************************************************************************/
+
+/* START A TRANSFER OF THIS DEVICE TO ANOTHER DES */
+func (device *Device) TransferDevice(req TransferRequest, src, uid string) (xfer pkg.DESDevTransfer, err error) {
+
+	/* SYNC DEVICE WITH DevicesMap */
+	d := DevicesMapRead(device.DESDevSerial)
+	if d.DESDevSerial == "" {
+		return xfer, fmt.Errorf("Device %s is not connected", device.DESDevSerial)
+	}
+	device = &d
+
+	if StaJobRunning(device.STA) {
+		return xfer, fmt.Errorf("Device %s has an active job; end the job before transferring the device", device.DESDevSerial)
+	}
+	if req.PeerAPI == "" || req.Host == "" || req.Port <= 0 {
+		return xfer, fmt.Errorf("The receiving DES API, broker host and broker port are required")
+	}
+	if prev, err := pkg.GetLatestDESDevTransfer(device.DESDevSerial, pkg.DEV_XFER_OUT); err != nil {
+		return xfer, err
+	} else if prev.Pending() {
+		return xfer, fmt.Errorf("Device %s transfer %d is %s", device.DESDevSerial, prev.DESDevXferID, prev.DESDevXferStatus)
+	}
+	if req.TimeoutSec <= 0 {
+		req.TimeoutSec = pkg.DEV_XFER_TIMEOUT_SEC
+	}
+
+	t := time.Now().UTC().UnixMilli()
+	xfer = pkg.DESDevTransfer{
+		DESDevXferRegTime:   t,
+		DESDevXferRegAddr:   src,
+		DESDevXferRegUserID: uid,
+		DESDevXferSerial:    device.DESDevSerial,
+		DESDevXferDir:       pkg.DEV_XFER_OUT,
+		DESDevXferPeerAPI:   req.PeerAPI,
+		DESDevXferPeerKey:   req.PeerKey,
+		DESDevXferHost:      req.Host,
+		DESDevXferPort:      req.Port,
+		DESDevXferDeadline:  t + req.TimeoutSec*1000,
+		DESDevXferStatus:    pkg.DEV_XFER_STATUS_REQUESTED,
+	}
+
+	/* ASK THE RECEIVING DES TO LISTEN FOR THE DEVICE */
+	if err = xfer.Peer().Post(DEV_XFER_ROUTE+"/prepare", TransferPeerRequest{
+		DESDev:   device.DESDev,
+		Host:     req.Host,
+		Port:     req.Port,
+		Deadline: xfer.DESDevXferDeadline,
+	}, nil); err != nil {
+		return
+	}
+
+	if err = pkg.WriteDESDevTransfer(&xfer); err != nil {
+		return
+	}
+
+	/* SEND THE DEVICE ITS NEW OPERATIONAL BROKER */
+	if err = device.SendOperationalDES(req.Host, req.Port, src, uid); err != nil {
+		xfer.DESDevXferMsg = err.Error()
+		pkg.WriteDESDevTransfer(&xfer)
+		return
+	}
+
+	go WatchDeviceTransfer(xfer.DESDevXferID)
+
+	return
+}
+
+/* SEND THE DEVICE A NEW OPERATIONAL BROKER: ADM AdmOpHost / AdmOpPort AND AN OP_CODE_DES_REG_REQ EVENT */
+func (device *Device) SendOperationalDES(host string, port int32, src, uid string) (err error) {
+
+	d := DevicesMapRead(device.DESDevSerial)
+	d.ADM.AdmOpHost = host
+	d.ADM.AdmOpPort = port
+	if err = d.SetAdminRequest(src); err != nil {
+		return
+	}
+
+	d = DevicesMapRead(device.DESDevSerial)
+	d.EVT = Event{
+		EvtUserID: uid,
+		EvtApp:    pkg.DES_APP,
+		EvtCode:   OP_CODE_DES_REG_REQ,
+		EvtMsg:    fmt.Sprintf("%s:%d", host, port),
+	}
+	return d.SetEventRequest(src)
+}
+
+/* RETURNS THE BROKER HOST AND PORT OF AN OP_CODE_DES_REG_REQ EVENT */
+func ParseOperationalDES(msg string) (host string, port int32, err error) {
+	i := strings.LastIndex(msg, ":")
+	if i < 1 {
+		return "", 0, fmt.Errorf("Invalid DES registration request: %s", msg)
+	}
+	p, err := strconv.Atoi(msg[i+1:])
+	if err != nil {
+		return "", 0, fmt.Errorf("Invalid DES registration request: %s", msg)
+	}
+	return msg[:i], int32(p), nil
+}
+
+/*
+	POLL THE RECEIVING DES UNTIL THE DEVICE REGISTERS THERE OR THE DEADLINE PASSES
+
+ONCE REGISTERED, THE DEVICE'S DATABASES ARE EXPORTED; OTHERWISE THE TRANSFER IS ROLLED BACK
+*/
+func WatchDeviceTransfer(id int64) {
+
+	for {
+		time.Sleep(time.Millisecond * pkg.DEV_XFER_POLL_MS)
+
+		xfer, err := pkg.GetDESDevTransfer(id)
+		if err != nil {
+			pkg.LogErr(err)
+			return
+		}
+		if xfer.DESDevXferStatus != pkg.DEV_XFER_STATUS_REQUESTED {
+			return
+		}
+
+		/* ASK THE RECEIVING DES FOR THE DEVICE */
+		res := struct {
+			Transfer pkg.DESDevTransfer `json:"transfer"`
+		}{}
+		err = xfer.Peer().Post(DEV_XFER_ROUTE+"/peer_status", TransferPeerRequest{DESDev: pkg.DESDev{DESDevSerial: xfer.DESDevXferSerial}}, &res)
+		if err != nil {
+			pkg.LogErr(err)
+		} else if res.Transfer.DESDevXferStatus == pkg.DEV_XFER_STATUS_REGISTERED {
+			xfer.DESDevXferStatus = pkg.DEV_XFER_STATUS_REGISTERED
+			pkg.WriteDESDevTransfer(&xfer)
+			ExportDeviceTransfer(id)
+			return
+		}
+
+		if time.Now().UTC().UnixMilli() > xfer.DESDevXferDeadline {
+			RollBackDeviceTransfer(id, "The device did not register with the receiving DES before the deadline")
+			return
+		}
+	}
+}
+
+/*
+	EXPORT THE DEVICE'S DATABASES TO THE RECEIVING DES AND MARK THE DEVICE TRANSFERRED
+
+WHERE AN EXPORT FAILS, THE TRANSFER REMAINS DEV_XFER_STATUS_EXPORTING AND MAY BE RETRIED;
+THE RECEIVING DES SKIPS RECORDS IT ALREADY HOLDS
+*/
+func ExportDeviceTransfer(id int64) (xfer pkg.DESDevTransfer, err error) {
+
+	if xfer, err = pkg.GetDESDevTransfer(id); err != nil {
+		return
+	}
+	if xfer.DESDevXferDir != pkg.DEV_XFER_OUT ||
+		(xfer.DESDevXferStatus != pkg.DEV_XFER_STATUS_REGISTERED && xfer.DESDevXferStatus != pkg.DEV_XFER_STATUS_EXPORTING) {
+		return xfer, fmt.Errorf("Transfer %d is %s", id, xfer.DESDevXferStatus)
+	}
+
+	fail := func(e error) (pkg.DESDevTransfer, error) {
+		xfer.DESDevXferMsg = e.Error()
+		pkg.WriteDESDevTransfer(&xfer)
+		return xfer, pkg.LogErr(e)
+	}
+
+	xfer.DESDevXferStatus = pkg.DEV_XFER_STATUS_EXPORTING
+	xfer.DESDevXferMsg = ""
+	if err = pkg.WriteDESDevTransfer(&xfer); err != nil {
+		return
+	}
+
+	/* THE DEVICE NOW REPORTS TO THE RECEIVING DES; CLOSE ITS DATABASES HERE */
+	device := DevicesMapRead(xfer.DESDevXferSerial)
+	if device.DESDevSerial != "" {
+		if err = device.DeviceClient_Disconnect(); err != nil {
+			return fail(err)
+		}
+	}
+	if err = device.GetDeviceDESRegistration(xfer.DESDevXferSerial); err != nil {
+		return fail(err)
+	}
+
+	jobs := []pkg.DESJob{}
+	res := pkg.DES.DB.
+		Where("des_job_dev_id = ?", device.DESDevID).
+		Order("des_job_reg_time ASC").
+		Find(&jobs)
+	if res.Error != nil {
+		return fail(res.Error)
+	}
+
+	peer := xfer.Peer()
+	xfer.DESDevXferJobs = 0
+	for _, job := range jobs {
+
+		if !pkg.JOB_STORE.Exists(job.DESJobName) {
+			/* NO DATABASE WAS EVER CREATED FOR THIS JOB */
+			continue
+		}
+		db, temp, err := pkg.ExportJobDB(job.DESJobName, C001V001{})
+		if temp {
+			defer os.Remove(db)
+		}
+		if err != nil {
+			return fail(err)
+		}
+
+		js, err := pkg.ModelToJSONString(job)
+		if err != nil {
+			return fail(err)
+		}
+		fields := map[string]string{
+			"des_dev_serial": xfer.DESDevXferSerial,
+			"des_job":        js,
+		}
+		if err = peer.Upload(DEV_XFER_ROUTE+"/import", fields, "db", db, nil); err != nil {
+			return fail(fmt.Errorf("Export %s failed: %s", job.DESJobName, err.Error()))
+		}
+		xfer.DESDevXferJobs++
+	}
+
+	/* HAND THE DEVICE OVER */
+	if err = peer.Post(DEV_XFER_ROUTE+"/complete", TransferPeerRequest{DESDev: device.DESDev}, nil); err != nil {
+		return fail(err)
+	}
+
+	xfer.DESDevXferStatus = pkg.DEV_XFER_STATUS_COMPLETE
+	err = pkg.WriteDESDevTransfer(&xfer)
+	return
+}
+
+/*
+	TELL THE RECEIVING DES TO SEND THE DEVICE BACK TO THIS DES'S BROKER AND DROP IT
+
+- THE DEVICE MAY ALREADY BE CONNECTED TO THE RECEIVING DES'S BROKER,
+SO THE RECEIVING DES SENDS THE ROLLBACK THROUGH ITS OWN BROKER
+- THIS DES ALSO SENDS IT THROUGH ITS OWN BROKER IN CASE THE DEVICE NEVER LEFT
+*/
+func RollBackDeviceTransfer(id int64, msg string) (xfer pkg.DESDevTransfer, err error) {
+
+	if xfer, err = pkg.GetDESDevTransfer(id); err != nil {
+		return
+	}
+	if xfer.DESDevXferDir != pkg.DEV_XFER_OUT || !xfer.Pending() || xfer.DESDevXferStatus == pkg.DEV_XFER_STATUS_EXPORTING {
+		return xfer, fmt.Errorf("Transfer %d is %s and can not be rolled back", id, xfer.DESDevXferStatus)
+	}
+
+	cancel := TransferPeerRequest{
+		DESDev: pkg.DESDev{DESDevSerial: xfer.DESDevXferSerial},
+		Host:   pkg.MQTT_HOST,
+		Port:   pkg.MQTT_PORT,
+	}
+	if err := xfer.Peer().Post(DEV_XFER_ROUTE+"/cancel", cancel, nil); err != nil {
+		pkg.LogErr(err)
+		msg = fmt.Sprintf("%s; receiving DES did not confirm the rollback: %s", msg, err.Error())
+	}
+
+	device := DevicesMapRead(xfer.DESDevXferSerial)
+	if device.DESDevSerial != "" {
+		if err := device.SendOperationalDES(pkg.MQTT_HOST, pkg.MQTT_PORT, xfer.DESDevXferRegAddr, xfer.DESDevXferRegUserID); err != nil {
+			pkg.LogErr(err)
+		}
+	}
+
+	xfer.DESDevXferStatus = pkg.DEV_XFER_STATUS_ROLLED_BACK
+	xfer.DESDevXferMsg = msg
+	err = pkg.WriteDESDevTransfer(&xfer)
+	return
+}
+
+func init() { RegisterResume(ResumeDeviceTransfers) }
+
+/* RESUME TRANSFERS INTERRUPTED BY A RESTART; CALLED ON SERVER STARTUP */
+func ResumeDeviceTransfers() {
+
+	xfers, err := pkg.GetDESDevTransfersByStatus(pkg.DEV_XFER_OUT,
+		pkg.DEV_XFER_STATUS_REQUESTED,
+		pkg.DEV_XFER_STATUS_REGISTERED,
+		pkg.DEV_XFER_STATUS_EXPORTING,
+	)
+	if err != nil {
+		pkg.LogErr(err)
+		return
+	}
+
+	for _, xfer := range xfers {
+		if xfer.DESDevXferStatus == pkg.DEV_XFER_STATUS_REQUESTED {
+			go WatchDeviceTransfer(xfer.DESDevXferID)
+		} else {
+			go ExportDeviceTransfer(xfer.DESDevXferID)
+		}
+	}
+}
+
+/* RECEIVING DES ********************************************************************************/
+
+/*
+	REGISTER AND CONNECT A DEVICE ANOTHER DES IS TRANSFERRING TO THIS DES
+
+WHERE THE DEVICE WAS REGISTERED HERE BEFORE, ITS EXISTING REGISTRATION IS RECONNECTED
+*/
+func PrepareDeviceTransfer(req TransferPeerRequest, src, uid string) (xfer pkg.DESDevTransfer, err error) {
+
+	serial := req.DESDev.DESDevSerial
+	if DevicesMapRead(serial).DESDevSerial != "" {
+		return xfer, fmt.Errorf("Device %s is already operated by this DES", serial)
+	}
+
+	devs, err := pkg.GetDESDeviceList()
+	if err != nil {
+		return
+	}
+	registered := false
+	for _, dev := range devs {
+		registered = registered || dev.DESDevSerial == serial
+	}
+
+	xfer = pkg.DESDevTransfer{
+		DESDevXferRegTime:   time.Now().UTC().UnixMilli(),
+		DESDevXferRegAddr:   src,
+		DESDevXferRegUserID: uid,
+		DESDevXferSerial:    serial,
+		DESDevXferDir:       pkg.DEV_XFER_IN,
+		DESDevXferHost:      req.Host,
+		DESDevXferPort:      req.Port,
+		DESDevXferDeadline:  req.Deadline,
+		DESDevXferStatus:    pkg.DEV_XFER_STATUS_PREPARED,
+	}
+	if err = pkg.WriteDESDevTransfer(&xfer); err != nil {
+		return
+	}
+
+	device := Device{}
+	if registered {
+		/* THE DEVICE IS NO LONGER AWAY; RECONNECT ITS CURRENT REGISTRATION */
+		regs, e := GetDeviceList()
+		for _, reg := range regs {
+			if reg.DESDevSerial == serial {
+				device.DESRegistration = reg
+			}
+		}
+		if err = e; err == nil {
+			err = device.DeviceClient_Connect()
+		}
+	} else {
+		device.DESDev = req.DESDev
+		device.DESDevID = 0
+		device.DESDevRegUserID = uid
+		err = device.RegisterDevice(src)
+	}
+
+	if err != nil {
+		xfer.DESDevXferStatus = pkg.DEV_XFER_STATUS_ROLLED_BACK
+		xfer.DESDevXferMsg = err.Error()
+		pkg.WriteDESDevTransfer(&xfer)
+	}
+	return
+}
+
+/* RECORD THAT A DEVICE BEING TRANSFERRED TO THIS DES HAS REGISTERED; CALLED ON OP_CODE_DES_REGISTERED */
+func (device *Device) ConfirmDeviceTransfer() {
+
+	xfer, err := pkg.GetLatestDESDevTransfer(device.DESDevSerial, pkg.DEV_XFER_IN)
+	if err != nil {
+		pkg.LogErr(err)
+		return
+	}
+	if xfer.DESDevXferStatus != pkg.DEV_XFER_STATUS_PREPARED {
+		return
+	}
+
+	xfer.DESDevXferStatus = pkg.DEV_XFER_STATUS_REGISTERED
+	if err = pkg.WriteDESDevTransfer(&xfer); err != nil {
+		pkg.LogErr(err)
+	}
+}
+
+/*
+	WRITE A JOB DATABASE EXPORTED BY THE SENDING DES
+
+- db IS THE PATH OF THE UPLOADED ( SQLITE ) DATABASE
+- COMPLETED JOBS ARE REGISTERED WITH THEIR ORIGINAL START / END / LOCATION
+- RECORDS ALREADY HELD ARE SKIPPED; THE CMDARCHIVE IS MERGED WITH THE RECORDS RECEIVED SINCE THE DEVICE ARRIVED
+*/
+func ImportDeviceTransferJob(serial string, job pkg.DESJob, db string) (sum FlashJobSummary, err error) {
+
+	xfer, err := pkg.GetLatestDESDevTransfer(serial, pkg.DEV_XFER_IN)
+	if err != nil {
+		return
+	}
+	if xfer.DESDevXferStatus != pkg.DEV_XFER_STATUS_REGISTERED {
+		return sum, fmt.Errorf("Device %s transfer is %s", serial, xfer.DESDevXferStatus)
+	}
+
+	device := DevicesMapRead(serial)
+	if device.DESDevSerial == "" {
+		return sum, fmt.Errorf("Device %s is not connected", serial)
+	}
+	if !strings.HasPrefix(job.DESJobName, serial) {
+		return sum, fmt.Errorf("Job %s does not belong to device %s", job.DESJobName, serial)
+	}
+
+	jdbc := pkg.JobDBClient{ConnStr: db}
+	if err = jdbc.Connect(); err != nil {
+		return
+	}
+	recs, err := ReadJobDBRecords(&jdbc)
+	jdbc.Disconnect()
+	if err != nil {
+		return
+	}
+
+	/* REGISTER THE COMPLETED JOB AS THE SENDING DES HAD IT */
+	if job.DESJobName != device.CmdArchiveName() {
+		existing := pkg.DESJob{}
+		res := pkg.DES.DB.Where("des_job_name = ?", job.DESJobName).Limit(1).Find(&existing)
+		if res.Error != nil {
+			return sum, res.Error
+		}
+		if res.RowsAffected == 0 {
+			reg := pkg.DESRegistration{DESDev: device.DESDev, DESJob: job}
+			reg.DESJobDevID = device.DESDevID
+			if err = pkg.WriteDESJob(&reg.DESJob); err != nil {
+				return
+			}
+			hdr := Header{}
+			hdr.DefaultSettings_Header(reg)
+			if len(recs.HDRs) > 0 {
+				hdr = recs.HDRs[len(recs.HDRs)-1]
+			}
+			recs.Create_DESJobSearch(reg, hdr)
+			sum.Created = true
+		}
+	}
+
+	created := sum.Created
+	if sum, err = device.BackfillFlashJob(job.DESJobName, recs); err != nil {
+		return
+	}
+	sum.Created = created
+
+	xfer.DESDevXferJobs++
+	err = pkg.WriteDESDevTransfer(&xfer)
+	return
+}
+
+/* RETURNS EVERY ADM, STA, HDR, CFG, EVT AND SMP IN THE JOB DATABASE, IN THE ORDER WRITTEN */
+func ReadJobDBRecords(jdbc *pkg.JobDBClient) (recs FlashRecords, err error) {
+
+	jdbc.RWM.Lock()
+	defer jdbc.RWM.Unlock()
+
+	for _, qry := range []interface{}{&recs.ADMs, &recs.STAs, &recs.HDRs, &recs.CFGs, &recs.EVTs, &recs.SMPs} {
+		if res := jdbc.Order("rowid").Find(qry); res.Error != nil {
+			return recs, res.Error
+		}
+	}
+	return
+}
+
+/* THE SENDING DES HAS HANDED THE DEVICE OVER */
+func CompleteDeviceTransfer(serial string) (xfer pkg.DESDevTransfer, err error) {
+
+	if xfer, err = pkg.GetLatestDESDevTransfer(serial, pkg.DEV_XFER_IN); err != nil {
+		return
+	}
+	if xfer.DESDevXferStatus != pkg.DEV_XFER_STATUS_REGISTERED {
+		return xfer, fmt.Errorf("Device %s transfer is %s", serial, xfer.DESDevXferStatus)
+	}
+
+	xfer.DESDevXferStatus = pkg.DEV_XFER_STATUS_COMPLETE
+	err = pkg.WriteDESDevTransfer(&xfer)
+	return
+}
+
+/*
+	THE SENDING DES HAS ROLLED THE TRANSFER BACK
+
+- SEND THE DEVICE BACK TO THE SENDING DES'S BROKER THROUGH THIS DES'S BROKER, THEN DISCONNECT THE DEVICE
+*/
+func CancelDeviceTransfer(req TransferPeerRequest) (xfer pkg.DESDevTransfer, err error) {
+
+	serial := req.DESDev.DESDevSerial
+	if xfer, err = pkg.GetLatestDESDevTransfer(serial, pkg.DEV_XFER_IN); err != nil {
+		return
+	}
+	if !xfer.Pending() {
+		return xfer, fmt.Errorf("Device %s has no transfer pending", serial)
+	}
+
+	device := DevicesMapRead(serial)
+	if device.DESDevSerial != "" {
+		if req.Host != "" && req.Port > 0 {
+			if err = device.SendOperationalDES(req.Host, req.Port, xfer.DESDevXferRegAddr, xfer.DESDevXferRegUserID); err != nil {
+				return
+			}
+		}
+		if err = device.DeviceClient_Disconnect(); err != nil {
+			return
+		}
+	}
+
+	xfer.DESDevXferStatus = pkg.DEV_XFER_STATUS_ROLLED_BACK
+	xfer.DESDevXferMsg = "Cancelled by the sending DES"
+	err = pkg.WriteDESDevTransfer(&xfer)
+	return
+}
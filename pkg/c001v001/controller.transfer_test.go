@@ -0,0 +1,173 @@
+package c001v001
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/leehayford/des/pkg"
+)
+
+/* POINTS pkg.DES AT A TEMPORARY SQLITE DATABASE HOLDING ONLY THE TABLES OF models */
+func testDESDB(t *testing.T, models ...interface{}) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "des.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AutoMigrate(models...); err != nil {
+		t.Fatal(err)
+	}
+	prev := pkg.DES.DB
+	pkg.DES.DB = db
+	t.Cleanup(func() { pkg.DES.DB = prev })
+}
+
+/* A PEER DES RECORDING THE ROLLBACKS IT RECEIVES; status IS RETURNED FOR EVERY REQUEST */
+type testPeer struct {
+	mtx     sync.Mutex
+	cancels []TransferPeerRequest
+	status  int
+}
+
+func (peer *testPeer) serve(t *testing.T) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == DEV_XFER_ROUTE+"/cancel" {
+			req := TransferPeerRequest{}
+			json.NewDecoder(r.Body).Decode(&req)
+			peer.mtx.Lock()
+			peer.cancels = append(peer.cancels, req)
+			peer.mtx.Unlock()
+		}
+		w.WriteHeader(peer.status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func testTransfer(t *testing.T, serial, dir, status, api string) pkg.DESDevTransfer {
+	t.Helper()
+	xfer := pkg.DESDevTransfer{
+		DESDevXferRegTime:   time.Now().UTC().UnixMilli(),
+		DESDevXferRegUserID: "user",
+		DESDevXferSerial:    serial,
+		DESDevXferDir:       dir,
+		DESDevXferPeerAPI:   api,
+		DESDevXferHost:      "des2.example.com",
+		DESDevXferPort:      1883,
+		DESDevXferStatus:    status,
+	}
+	if err := pkg.WriteDESDevTransfer(&xfer); err != nil {
+		t.Fatal(err)
+	}
+	return xfer
+}
+
+func TestRollBackDeviceTransferSendsThisBroker(t *testing.T) {
+	testDESDB(t, &pkg.DESDevTransfer{}, &pkg.DESError{})
+	peer := &testPeer{status: http.StatusOK}
+	xfer := testTransfer(t, "SN0001", pkg.DEV_XFER_OUT, pkg.DEV_XFER_STATUS_REQUESTED, peer.serve(t))
+
+	got, err := RollBackDeviceTransfer(xfer.DESDevXferID, "timed out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.DESDevXferStatus != pkg.DEV_XFER_STATUS_ROLLED_BACK || got.DESDevXferMsg != "timed out" {
+		t.Fatalf("transfer %s: %s", got.DESDevXferStatus, got.DESDevXferMsg)
+	}
+
+	/* THE RECEIVING DES MUST SEND THE DEVICE BACK TO THIS DES'S BROKER */
+	if len(peer.cancels) != 1 {
+		t.Fatalf("peer received %d rollbacks; want 1", len(peer.cancels))
+	}
+	c := peer.cancels[0]
+	if c.DESDev.DESDevSerial != "SN0001" || c.Host != pkg.MQTT_HOST || c.Port != pkg.MQTT_PORT {
+		t.Fatalf("rollback %+v; want SN0001 -> %s:%d", c, pkg.MQTT_HOST, pkg.MQTT_PORT)
+	}
+
+	saved, err := pkg.GetDESDevTransfer(xfer.DESDevXferID)
+	if err != nil || saved.DESDevXferStatus != pkg.DEV_XFER_STATUS_ROLLED_BACK {
+		t.Fatalf("stored transfer %s, %v", saved.DESDevXferStatus, err)
+	}
+}
+
+func TestRollBackDeviceTransferWithoutPeerConfirmation(t *testing.T) {
+	testDESDB(t, &pkg.DESDevTransfer{}, &pkg.DESError{})
+	peer := &testPeer{status: http.StatusInternalServerError}
+	xfer := testTransfer(t, "SN0001", pkg.DEV_XFER_OUT, pkg.DEV_XFER_STATUS_REGISTERED, peer.serve(t))
+
+	got, err := RollBackDeviceTransfer(xfer.DESDevXferID, "cancelled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.DESDevXferStatus != pkg.DEV_XFER_STATUS_ROLLED_BACK {
+		t.Fatalf("transfer %s; want %s", got.DESDevXferStatus, pkg.DEV_XFER_STATUS_ROLLED_BACK)
+	}
+	if !strings.Contains(got.DESDevXferMsg, "receiving DES did not confirm the rollback") {
+		t.Fatalf("message does not record the failed peer rollback: %s", got.DESDevXferMsg)
+	}
+}
+
+func TestRollBackDeviceTransferRefused(t *testing.T) {
+	testDESDB(t, &pkg.DESDevTransfer{}, &pkg.DESError{})
+	peer := &testPeer{status: http.StatusOK}
+	api := peer.serve(t)
+
+	for _, x := range []struct{ dir, status string }{
+		{pkg.DEV_XFER_OUT, pkg.DEV_XFER_STATUS_EXPORTING},
+		{pkg.DEV_XFER_OUT, pkg.DEV_XFER_STATUS_COMPLETE},
+		{pkg.DEV_XFER_OUT, pkg.DEV_XFER_STATUS_ROLLED_BACK},
+		{pkg.DEV_XFER_IN, pkg.DEV_XFER_STATUS_PREPARED},
+	} {
+		xfer := testTransfer(t, "SN0001", x.dir, x.status, api)
+		if _, err := RollBackDeviceTransfer(xfer.DESDevXferID, "no"); err == nil {
+			t.Errorf("%s %s transfer rolled back", x.dir, x.status)
+		}
+		if saved, _ := pkg.GetDESDevTransfer(xfer.DESDevXferID); saved.DESDevXferStatus != x.status {
+			t.Errorf("%s %s transfer changed to %s", x.dir, x.status, saved.DESDevXferStatus)
+		}
+	}
+	if len(peer.cancels) != 0 {
+		t.Fatalf("peer received %d rollbacks for refused transfers", len(peer.cancels))
+	}
+}
+
+func TestCancelDeviceTransfer(t *testing.T) {
+	testDESDB(t, &pkg.DESDevTransfer{}, &pkg.DESError{})
+
+	req := TransferPeerRequest{DESDev: pkg.DESDev{DESDevSerial: "SN0001"}, Host: "des1.example.com", Port: 1883}
+	if _, err := CancelDeviceTransfer(req); err == nil {
+		t.Fatal("cancelled a transfer that does not exist")
+	}
+
+	testTransfer(t, "SN0001", pkg.DEV_XFER_IN, pkg.DEV_XFER_STATUS_PREPARED, "")
+	got, err := CancelDeviceTransfer(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.DESDevXferStatus != pkg.DEV_XFER_STATUS_ROLLED_BACK {
+		t.Fatalf("transfer %s; want %s", got.DESDevXferStatus, pkg.DEV_XFER_STATUS_ROLLED_BACK)
+	}
+
+	/* THE DEVICE NEVER ARRIVED; IT IS AWAY FROM THIS DES */
+	away, err := pkg.DESDevsAway()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(away) != 1 || away[0] != "SN0001" {
+		t.Fatalf("devices away %v; want [SN0001]", away)
+	}
+
+	if _, err = CancelDeviceTransfer(req); err == nil {
+		t.Fatal("cancelled a transfer that already rolled back")
+	}
+}
@@ -0,0 +1,618 @@
+package c001v001
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/leehayford/des/pkg"
+)
+
+/*
+BUFFERED SAMPLE WRITER
+
+SAMPLES ARE WRITTEN TO THE JOB DATABASE BY ONE SampleWriter PER JOB ( DATABASE NAME )
+  - WriteSample QUEUES THE SAMPLE; THE WRITER COMMITS THE QUEUE IN ONE TRANSACTION
+    EVERY SMP_WRITER_BATCH SAMPLES OR EVERY SMP_WRITER_FLUSH_MS, WHICHEVER COMES FIRST
+  - SAMPLES ARE WRITTEN IN THE ORDER THEY WERE RECEIVED
+  - WHEN THE QUEUE IS FULL, WriteSample WAITS UP TO SMP_WRITER_BLOCK_MS ( BACKPRESSURE ON THE MQTT HANDLER );
+    IF THE DATABASE IS STILL STALLED, SAMPLES ARE SPILLED TO ~/JOB_DBS/<job name>.smp_spill ( SEE FLASH_SMP_LAYOUT )
+    AND WRITTEN TO THE DATABASE, IN ORDER, ONCE THE QUEUE HAS BEEN FLUSHED
+  - THE WRITER IS FLUSHED AND CLOSED BEFORE ITS JOB DATABASE IS DISCONNECTED ( EndJob, StartJob, SHUTDOWN )
+  - A SPILL FILE LEFT BY A RESTART IS WRITTEN ON Resume OR WHEN THE JOB'S WRITER IS NEXT OPENED
+  - HOW MUCH OF THE SPILL FILE HAS BEEN COMMITTED IS KEPT IN <spill file>.off, UPDATED AFTER EACH COMMITTED BATCH;
+    A RESTART RESUMES FROM THERE ( AT MOST THE BATCH BEING COMMITTED WHEN THE DES STOPPED IS WRITTEN AGAIN )
+*/
+const SMP_WRITER_QUEUE = 1000    // Samples
+const SMP_WRITER_BATCH = 100     // Samples per transaction
+const SMP_WRITER_FLUSH_MS = 1000 // Longest a queued sample waits for its transaction
+const SMP_WRITER_BLOCK_MS = 250  // Longest WriteSample waits on a full queue before spilling
+const SMP_SPILL_EXT = ".smp_spill"
+const SMP_SPILL_OFF_EXT = ".off" // Appended to the spill file path
+
+var ErrSampleWriterClosed = errors.New("Sample writer closed")
+
+type SampleWriterStats struct {
+	Name        string  `json:"name"`
+	Depth       int     `json:"depth"`       // Samples waiting in the queue
+	Pending     int     `json:"pending"`     // Samples in the transaction being written
+	Spilling    bool    `json:"spilling"`    // Samples are being written to the spill file
+	SpillDepth  int64   `json:"spill_depth"` // Samples waiting in the spill file
+	Written     int64   `json:"written"`     // Samples committed to the job database
+	Spilled     int64   `json:"spilled"`     // Samples written to the spill file
+	Batches     int64   `json:"batches"`     // Transactions committed
+	LastFlushMS int64   `json:"last_flush_ms"`
+	MaxFlushMS  int64   `json:"max_flush_ms"`
+	AvgFlushMS  float64 `json:"avg_flush_ms"`
+	Errors      int64   `json:"errors"`
+	LastErr     string  `json:"last_err"`
+}
+
+type SampleWriter struct {
+	JDBC pkg.JobDBClient
+
+	queue  chan Sample
+	flush  chan chan error
+	stop   chan chan error
+	exited chan struct{} // Closed when run( ) returns
+
+	/* ORDERS CALLERS OF Write; HELD WHILE Write WAITS ON A FULL QUEUE */
+	writeMtx sync.Mutex
+	space    chan struct{} // Signalled as the writer takes samples from the queue
+
+	/* ORDERS WriteSample AGAINST SPILLING, DRAINING AND CLOSING */
+	mtx      sync.Mutex
+	closed   bool
+	spilling bool
+	spill    string
+	spillOff int64 // Bytes of the spill file already written to the database
+
+	statsMtx sync.Mutex
+	stats    SampleWriterStats
+	flushMS  int64 // Total; for AvgFlushMS
+}
+
+var SampleWriters = make(map[string]*SampleWriter)
+var SampleWritersRWMutex = sync.RWMutex{}
+
+/* RETURNS THE PATH OF THE SPILL FILE FOR THE NAMED JOB */
+func SampleSpillPath(name string) string {
+	return fmt.Sprintf("%s/%s%s", pkg.JOB_DBS, name, SMP_SPILL_EXT)
+}
+
+/* RETURNS THE WRITER FOR THE JOB DATABASE jdbc IS CONNECTED TO, STARTING ONE IF NECESSARY */
+func GetSampleWriter(jdbc *pkg.JobDBClient) (w *SampleWriter) {
+	name := jdbc.GetDBNameFromConnStr()
+
+	SampleWritersRWMutex.Lock()
+	defer SampleWritersRWMutex.Unlock()
+	if w = SampleWriters[name]; w != nil {
+		return
+	}
+
+	w = &SampleWriter{
+		JDBC:   *jdbc,
+		queue:  make(chan Sample, SMP_WRITER_QUEUE),
+		flush:  make(chan chan error),
+		stop:   make(chan chan error),
+		exited: make(chan struct{}),
+		space:  make(chan struct{}, 1),
+		spill:  SampleSpillPath(name),
+	}
+	w.stats.Name = name
+
+	/* PICK UP WHERE A RESTART LEFT OFF */
+	if fi, err := os.Stat(w.spill); err == nil {
+		w.spillOff = w.loadSpillOff(fi.Size())
+		w.spilling = true
+		w.stats.Spilling = true
+		w.stats.SpillDepth = (fi.Size() - w.spillOff) / FLASH_SMP_SIZE
+	}
+
+	SampleWriters[name] = w
+	go w.run()
+	return
+}
+
+/* QUEUES smp FOR THE JOB DATABASE jdbc IS CONNECTED TO */
+func WriteSample(smp Sample, jdbc *pkg.JobDBClient) (err error) {
+	/* A WRITER MAY BE CLOSED BETWEEN GetSampleWriter AND Write; THE NEXT ONE WILL TAKE THE SAMPLE */
+	for i := 0; i < 2; i++ {
+		if err = GetSampleWriter(jdbc).Write(smp); err != ErrSampleWriterClosed {
+			break
+		}
+	}
+	return
+}
+
+/*
+	FLUSHES, STOPS AND REMOVES THE WRITER FOR THE JOB DATABASE jdbc IS CONNECTED TO, IF ANY
+
+CALL BEFORE jdbc.Disconnect()
+*/
+func CloseSampleWriter(jdbc *pkg.JobDBClient) (err error) {
+	name := jdbc.GetDBNameFromConnStr()
+
+	SampleWritersRWMutex.Lock()
+	w := SampleWriters[name]
+	delete(SampleWriters, name)
+	SampleWritersRWMutex.Unlock()
+
+	if w == nil {
+		return
+	}
+	return w.Close()
+}
+
+/* FLUSHES AND STOPS EVERY WRITER; CALLED ON SHUTDOWN */
+func CloseSampleWriters() {
+	SampleWritersRWMutex.Lock()
+	ws := SampleWriters
+	SampleWriters = make(map[string]*SampleWriter)
+	SampleWritersRWMutex.Unlock()
+
+	for _, w := range ws {
+		if err := w.Close(); err != nil {
+			pkg.LogErr(err)
+		}
+	}
+}
+
+/* RETURNS THE STATS OF EVERY OPEN WRITER */
+func GetSampleWriterStats() (stats []SampleWriterStats) {
+	SampleWritersRWMutex.RLock()
+	defer SampleWritersRWMutex.RUnlock()
+	stats = []SampleWriterStats{}
+	for _, w := range SampleWriters {
+		stats = append(stats, w.Stats())
+	}
+	return
+}
+
+/*
+WRITES ANY SAMPLES LEFT IN SPILL FILES BY A RESTART
+  - WHERE THE JOB IS ACTIVE, THE DEVICE'S OWN WRITER IS STARTED AND DRAINS THE FILE
+  - OTHERWISE THE JOB DATABASE IS CONNECTED JUST LONG ENOUGH TO WRITE THE FILE
+*/
+func ResumeSampleWriters() {
+	entries, err := os.ReadDir(pkg.JOB_DBS)
+	if err != nil {
+		return
+	}
+
+	active := make(map[string]pkg.JobDBClient)
+	DevicesRWMutex.RLock()
+	for _, d := range Devices {
+		active[d.JobDBC.GetDBNameFromConnStr()] = d.JobDBC
+		active[d.CmdDBC.GetDBNameFromConnStr()] = d.CmdDBC
+	}
+	DevicesRWMutex.RUnlock()
+
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), SMP_SPILL_EXT) {
+			continue
+		}
+		name := strings.TrimSuffix(e.Name(), SMP_SPILL_EXT)
+		fmt.Printf("\nResumeSampleWriters( ) -> %s\n", name)
+
+		if jdbc, ok := active[name]; ok && jdbc.DB != nil {
+			GetSampleWriter(&jdbc)
+			continue
+		}
+
+		jdbc, err := pkg.GetJobDBClient(name)
+		if err == nil {
+			err = jdbc.Connect()
+		}
+		if err != nil {
+			pkg.LogErr(fmt.Errorf("ResumeSampleWriters( ) -> %s: %s", name, err.Error()))
+			continue
+		}
+		if err = GetSampleWriter(&jdbc).Flush(); err != nil {
+			pkg.LogErr(err)
+		}
+		CloseSampleWriter(&jdbc)
+		jdbc.Disconnect()
+	}
+}
+
+func init() { RegisterResume(ResumeSampleWriters) }
+
+/*
+QUEUES smp IN ORDER
+  - WAITS UP TO SMP_WRITER_BLOCK_MS WHILE THE QUEUE IS FULL, THEN SPILLS TO DISK
+  - ONCE SPILLING, EVERY SAMPLE IS SPILLED UNTIL THE WRITER HAS CAUGHT UP; THIS KEEPS SAMPLES IN ORDER
+  - w.mtx IS NOT HELD WHILE WAITING, SO THE WRITER CAN DRAIN, FLUSH AND CLOSE
+*/
+func (w *SampleWriter) Write(smp Sample) (err error) {
+	w.writeMtx.Lock()
+	defer w.writeMtx.Unlock()
+
+	timer := time.NewTimer(SMP_WRITER_BLOCK_MS * time.Millisecond)
+	defer timer.Stop()
+	for {
+		if done, err := w.enqueue(smp); done || err != nil {
+			return err
+		}
+		select {
+		case <-w.space:
+		case <-timer.C:
+			w.mtx.Lock()
+			defer w.mtx.Unlock()
+			if w.closed {
+				return ErrSampleWriterClosed
+			}
+			if !w.spilling {
+				pkg.LogDESError(w.stats.Name, fmt.Sprintf("Sample queue full; spilling to %s", w.spill), w.Stats())
+			}
+			return w.spillSamples([]Sample{smp}, false)
+		}
+	}
+}
+
+/* QUEUES smp WHERE THERE IS ROOM, OR SPILLS IT WHERE THE WRITER IS SPILLING; done IS FALSE WHERE THE QUEUE IS FULL */
+func (w *SampleWriter) enqueue(smp Sample) (done bool, err error) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	if w.closed {
+		return false, ErrSampleWriterClosed
+	}
+	if w.spilling {
+		return true, w.spillSamples([]Sample{smp}, false)
+	}
+	select {
+	case w.queue <- smp:
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+/* TELLS A WAITING Write THERE IS ROOM IN THE QUEUE */
+func (w *SampleWriter) signalSpace() {
+	select {
+	case w.space <- struct{}{}:
+	default:
+	}
+}
+
+/* COMMITS EVERYTHING QUEUED OR SPILLED SO FAR */
+func (w *SampleWriter) Flush() (err error) {
+	w.mtx.Lock()
+	closed := w.closed
+	w.mtx.Unlock()
+	if closed {
+		return ErrSampleWriterClosed
+	}
+
+	/* THE WRITER MAY BE CLOSED BEFORE IT TAKES THE REQUEST */
+	done := make(chan error)
+	select {
+	case w.flush <- done:
+		return <-done
+	case <-w.exited:
+		return ErrSampleWriterClosed
+	}
+}
+
+/* FLUSHES AND STOPS THE WRITER; SAMPLES THAT CAN NOT BE COMMITTED ARE LEFT IN THE SPILL FILE */
+func (w *SampleWriter) Close() (err error) {
+	w.mtx.Lock()
+	if w.closed {
+		w.mtx.Unlock()
+		return
+	}
+	w.closed = true
+	w.mtx.Unlock()
+
+	done := make(chan error)
+	w.stop <- done
+	return <-done
+}
+
+func (w *SampleWriter) Stats() (stats SampleWriterStats) {
+	w.statsMtx.Lock()
+	stats = w.stats
+	w.statsMtx.Unlock()
+	stats.Depth = len(w.queue)
+	return
+}
+
+/* THE WRITER'S GO ROUTINE; THE ONLY CALLER OF WriteSMPs FOR THIS JOB */
+func (w *SampleWriter) run() {
+	defer close(w.exited)
+
+	ticker := time.NewTicker(SMP_WRITER_FLUSH_MS * time.Millisecond)
+	defer ticker.Stop()
+
+	batch := make([]Sample, 0, SMP_WRITER_BATCH)
+	for {
+		/* STOP TAKING SAMPLES WHILE A FULL BATCH WAITS ON THE DATABASE; THE QUEUE FILLS AND WriteSample BLOCKS */
+		queue := w.queue
+		if len(batch) >= SMP_WRITER_BATCH {
+			queue = nil
+		}
+
+		select {
+		case smp := <-queue:
+			w.signalSpace()
+			batch = append(batch, smp)
+			if len(batch) >= SMP_WRITER_BATCH {
+				batch, _ = w.commit(batch)
+			}
+
+		case <-ticker.C:
+			var err error
+			if batch, err = w.commit(batch); err == nil && len(w.queue) == 0 {
+				w.drainSpill()
+			}
+
+		case done := <-w.flush:
+			var err error
+			if batch, err = w.flushAll(batch); err == nil {
+				err = w.drainSpill()
+			}
+			done <- err
+
+		case done := <-w.stop:
+			var err error
+			if batch, err = w.flushAll(batch); err == nil {
+				err = w.drainSpill()
+			} else {
+				/* KEEP WHAT WE COULD NOT COMMIT AHEAD OF ANYTHING ALREADY SPILLED */
+				w.mtx.Lock()
+				if serr := w.spillSamples(batch, true); serr != nil {
+					err = serr
+				}
+				w.mtx.Unlock()
+			}
+			done <- err
+			return
+		}
+	}
+}
+
+/* COMMITS EVERYTHING IN THE QUEUE ALONG WITH batch; RETURNS WHAT COULD NOT BE COMMITTED */
+func (w *SampleWriter) flushAll(batch []Sample) ([]Sample, error) {
+	for {
+		select {
+		case smp := <-w.queue:
+			w.signalSpace()
+			batch = append(batch, smp)
+			continue
+		default:
+		}
+		break
+	}
+	return w.commit(batch)
+}
+
+/* WRITES batch IN ONE TRANSACTION; ON FAILURE, batch IS RETURNED TO BE RETRIED */
+func (w *SampleWriter) commit(batch []Sample) ([]Sample, error) {
+	if len(batch) == 0 {
+		return batch, nil
+	}
+	w.setPending(len(batch))
+
+	start := time.Now()
+	if err := WriteSMPs(batch, &w.JDBC); err != nil {
+		w.setErr(err)
+		return batch, err
+	}
+	w.setFlushed(int64(len(batch)), time.Since(start).Milliseconds())
+	return batch[:0], nil
+}
+
+/*
+WRITES THE SPILL FILE TO THE DATABASE, SMP_WRITER_BATCH SAMPLES AT A TIME
+  - CALLED ONLY ONCE THE QUEUE HAS BEEN COMMITTED; EVERYTHING IN THE FILE CAME AFTER IT
+  - THE LOCK IS HELD ONLY TO DECIDE WE HAVE CAUGHT UP, SO WriteSample KEEPS SPILLING WHILE WE DRAIN
+*/
+func (w *SampleWriter) drainSpill() (err error) {
+
+	w.mtx.Lock()
+	spilling := w.spilling
+	w.mtx.Unlock()
+	if !spilling {
+		return
+	}
+
+	var f *os.File
+	defer func() {
+		if f != nil {
+			f.Close()
+		}
+	}()
+
+	buf := make([]byte, SMP_WRITER_BATCH*FLASH_SMP_SIZE)
+	for {
+		if f == nil {
+			if f, err = os.Open(w.spill); err != nil && !os.IsNotExist(err) {
+				w.setErr(err)
+				return
+			}
+		}
+
+		n := 0
+		if f != nil {
+			if n, err = f.ReadAt(buf, w.spillOff); err != nil && err != io.EOF {
+				w.setErr(err)
+				return
+			}
+			n -= n % FLASH_SMP_SIZE
+		}
+
+		if n == 0 {
+			/* CAUGHT UP; STOP SPILLING UNLESS WriteSample HAS ADDED TO THE FILE SINCE WE LAST READ IT */
+			w.mtx.Lock()
+			fi, serr := os.Stat(w.spill)
+			if serr == nil && fi.Size()-w.spillOff >= FLASH_SMP_SIZE {
+				w.mtx.Unlock()
+				continue
+			}
+			if serr == nil {
+				if err = os.Remove(w.spill); err != nil {
+					w.mtx.Unlock()
+					w.setErr(err)
+					return
+				}
+			}
+			os.Remove(w.spill + SMP_SPILL_OFF_EXT)
+			w.spilling = false
+			w.spillOff = 0
+			w.mtx.Unlock()
+			w.setSpill(false, 0)
+			return nil
+		}
+
+		smps := make([]Sample, n/FLASH_SMP_SIZE)
+		for i := range smps {
+			if err = FLASH_SMP_LAYOUT.Decode(buf[i*FLASH_SMP_SIZE:(i+1)*FLASH_SMP_SIZE], &smps[i]); err != nil {
+				w.setErr(err)
+				return
+			}
+			smps[i].SmpJobName = w.stats.Name
+		}
+		if _, err = w.commit(smps); err != nil {
+			return
+		}
+		w.mtx.Lock()
+		w.spillOff += int64(n)
+		err = w.saveSpillOff()
+		w.mtx.Unlock()
+		if err != nil {
+			w.setErr(err)
+			return
+		}
+		w.setSpill(true, w.spillDepth())
+	}
+}
+
+/*
+APPENDS smps TO THE SPILL FILE; WHERE first, smps ARE WRITTEN AHEAD OF ANYTHING NOT YET DRAINED
+  - CALLER HOLDS w.mtx
+*/
+func (w *SampleWriter) spillSamples(smps []Sample, first bool) (err error) {
+	if len(smps) == 0 {
+		return
+	}
+
+	b := make([]byte, 0, len(smps)*FLASH_SMP_SIZE)
+	for _, smp := range smps {
+		rec, err := FLASH_SMP_LAYOUT.Encode(smp)
+		if err != nil {
+			return pkg.LogErr(err)
+		}
+		b = append(b, rec...)
+	}
+
+	if err = os.MkdirAll(pkg.JOB_DBS, os.ModePerm); err != nil {
+		return pkg.LogErr(err)
+	}
+
+	if first {
+		if rest, rerr := os.ReadFile(w.spill); rerr == nil && int64(len(rest)) > w.spillOff {
+			b = append(b, rest[w.spillOff:]...)
+		}
+		tmp := w.spill + ".tmp"
+		if err = os.WriteFile(tmp, b, 0644); err != nil {
+			return pkg.LogErr(err)
+		}
+		if err = os.Rename(tmp, w.spill); err != nil {
+			return pkg.LogErr(err)
+		}
+		w.spillOff = 0
+		if err = w.saveSpillOff(); err != nil {
+			return pkg.LogErr(err)
+		}
+	} else {
+		f, err := os.OpenFile(w.spill, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return pkg.LogErr(err)
+		}
+		_, err = f.Write(b)
+		f.Close()
+		if err != nil {
+			return pkg.LogErr(err)
+		}
+	}
+	w.spilling = true
+
+	w.statsMtx.Lock()
+	w.stats.Spilled += int64(len(smps))
+	w.statsMtx.Unlock()
+	w.setSpill(true, w.spillDepth())
+	return
+}
+
+/* RECORDS HOW MUCH OF THE SPILL FILE HAS BEEN COMMITTED; CALLER HOLDS w.mtx */
+func (w *SampleWriter) saveSpillOff() (err error) {
+	tmp := w.spill + SMP_SPILL_OFF_EXT + ".tmp"
+	if err = os.WriteFile(tmp, []byte(strconv.FormatInt(w.spillOff, 10)), 0644); err != nil {
+		return
+	}
+	return os.Rename(tmp, w.spill+SMP_SPILL_OFF_EXT)
+}
+
+/* RETURNS THE COMMITTED OFFSET SAVED FOR A SPILL FILE OF size BYTES; 0 WHERE NONE IS SAVED OR IT DOES NOT FIT THE FILE */
+func (w *SampleWriter) loadSpillOff(size int64) (off int64) {
+	b, err := os.ReadFile(w.spill + SMP_SPILL_OFF_EXT)
+	if err != nil {
+		return 0
+	}
+	off, err = strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+	if err != nil || off < 0 || off > size || off%FLASH_SMP_SIZE != 0 {
+		pkg.LogErr(fmt.Errorf("(*SampleWriter) %s: invalid spill offset %q; writing the whole spill file", w.stats.Name, string(b)))
+		return 0
+	}
+	return
+}
+
+func (w *SampleWriter) spillDepth() int64 {
+	fi, err := os.Stat(w.spill)
+	if err != nil {
+		return 0
+	}
+	return (fi.Size() - w.spillOff) / FLASH_SMP_SIZE
+}
+
+func (w *SampleWriter) setPending(n int) {
+	w.statsMtx.Lock()
+	w.stats.Pending = n
+	w.statsMtx.Unlock()
+}
+
+func (w *SampleWriter) setFlushed(n, ms int64) {
+	w.statsMtx.Lock()
+	w.stats.Pending = 0
+	w.stats.Written += n
+	w.stats.Batches++
+	w.stats.LastFlushMS = ms
+	if ms > w.stats.MaxFlushMS {
+		w.stats.MaxFlushMS = ms
+	}
+	w.flushMS += ms
+	w.stats.AvgFlushMS = float64(w.flushMS) / float64(w.stats.Batches)
+	w.statsMtx.Unlock()
+}
+
+func (w *SampleWriter) setSpill(spilling bool, depth int64) {
+	w.statsMtx.Lock()
+	w.stats.Spilling = spilling
+	w.stats.SpillDepth = depth
+	w.statsMtx.Unlock()
+}
+
+func (w *SampleWriter) setErr(err error) {
+	w.statsMtx.Lock()
+	w.stats.Errors++
+	w.stats.LastErr = err.Error()
+	w.statsMtx.Unlock()
+	pkg.LogErr(fmt.Errorf("(*SampleWriter) %s: %s", w.stats.Name, err.Error()))
+}
@@ -0,0 +1,211 @@
+package c001v001
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/leehayford/des/pkg"
+)
+
+/* A CONNECTED SQLITE JOB DATABASE HOLDING samples; THE TEST RUNS IN AN EMPTY DIRECTORY HOLDING JOB_DBS */
+func testSampleJobDB(t *testing.T, name string) *pkg.JobDBClient {
+	t.Helper()
+	testDESDB(t, &pkg.DESError{})
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err = os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.MkdirAll(pkg.JOB_DBS, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	jdbc := &pkg.JobDBClient{ConnStr: filepath.Join(dir, name+".db"), Name: name, RWM: &sync.RWMutex{}}
+	if err = jdbc.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	if err = jdbc.AutoMigrate(&Sample{}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		CloseSampleWriter(jdbc)
+		jdbc.Disconnect()
+		os.Chdir(wd)
+	})
+	return jdbc
+}
+
+func testSamples(start, n int) (smps []Sample) {
+	for i := 0; i < n; i++ {
+		smps = append(smps, Sample{SmpTime: int64(start + i), SmpCH4: float32(i)})
+	}
+	return
+}
+
+/* FAILS UNLESS THE JOB DATABASE HOLDS SAMPLES from ... to - 1, WRITTEN IN ORDER */
+func testSamplesWritten(t *testing.T, jdbc *pkg.JobDBClient, from, to int) {
+	t.Helper()
+	smps := []Sample{}
+	jdbc.Order("smp_id").Find(&smps)
+	if len(smps) != to-from {
+		t.Fatalf("%d samples written; want %d", len(smps), to-from)
+	}
+	for i, smp := range smps {
+		if smp.SmpTime != int64(from+i) {
+			t.Fatalf("sample %d has time %d; want %d", i, smp.SmpTime, from+i)
+		}
+	}
+}
+
+func TestSampleWriterCommitsFullBatches(t *testing.T) {
+	jdbc := testSampleJobDB(t, "SN0001_0000000001")
+	w := GetSampleWriter(jdbc)
+
+	for _, smp := range testSamples(0, SMP_WRITER_BATCH) {
+		if err := w.Write(smp); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	/* A FULL BATCH IS COMMITTED WITHOUT WAITING FOR SMP_WRITER_FLUSH_MS */
+	deadline := time.Now().Add(SMP_WRITER_FLUSH_MS * time.Millisecond / 2)
+	for w.Stats().Written < SMP_WRITER_BATCH && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if stats := w.Stats(); stats.Written != SMP_WRITER_BATCH || stats.Batches != 1 {
+		t.Fatalf("written %d in %d batches; want %d in 1", stats.Written, stats.Batches, SMP_WRITER_BATCH)
+	}
+
+	/* A PART BATCH WAITS FOR THE TICKER OR A FLUSH */
+	for _, smp := range testSamples(SMP_WRITER_BATCH, 5) {
+		w.Write(smp)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	testSamplesWritten(t, jdbc, 0, SMP_WRITER_BATCH+5)
+}
+
+func TestSampleWriterSpillsWhileStalled(t *testing.T) {
+	jdbc := testSampleJobDB(t, "SN0001_0000000001")
+	w := GetSampleWriter(jdbc)
+
+	/* STALL THE DATABASE; THE WRITER HOLDS ONE BATCH AND THE QUEUE FILLS */
+	jdbc.RWM.Lock()
+	n := SMP_WRITER_BATCH + SMP_WRITER_QUEUE
+	for _, smp := range testSamples(0, n) {
+		if err := w.Write(smp); err != nil {
+			jdbc.RWM.Unlock()
+			t.Fatal(err)
+		}
+	}
+	deadline := time.Now().Add(time.Second)
+	for len(w.queue) < SMP_WRITER_QUEUE && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	/* WAITING ON THE FULL QUEUE DOES NOT HOLD THE WRITER'S LOCK */
+	done := make(chan error)
+	go func() { done <- w.Write(Sample{SmpTime: int64(n)}) }()
+	time.Sleep(SMP_WRITER_BLOCK_MS * time.Millisecond / 2)
+	if !w.mtx.TryLock() {
+		jdbc.RWM.Unlock()
+		t.Fatal("writer locked while Write waits on a full queue")
+	}
+	w.mtx.Unlock()
+
+	if err := <-done; err != nil {
+		jdbc.RWM.Unlock()
+		t.Fatal(err)
+	}
+	for _, smp := range testSamples(n+1, 10) {
+		w.Write(smp)
+	}
+	stats := w.Stats()
+	jdbc.RWM.Unlock()
+	if !stats.Spilling || stats.Spilled != 11 || stats.SpillDepth != 11 {
+		t.Fatalf("spilling %t, spilled %d, depth %d; want 11 samples spilled", stats.Spilling, stats.Spilled, stats.SpillDepth)
+	}
+
+	/* THE QUEUE IS WRITTEN AHEAD OF THE SPILL FILE */
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	testSamplesWritten(t, jdbc, 0, n+11)
+	if _, err := os.Stat(w.spill); !os.IsNotExist(err) {
+		t.Fatal("spill file not removed once written")
+	}
+	if stats = w.Stats(); stats.Spilling {
+		t.Fatal("still spilling once caught up")
+	}
+}
+
+func TestSampleWriterResumesSpillFromOffset(t *testing.T) {
+	jdbc := testSampleJobDB(t, "SN0001_0000000001")
+
+	/* A RESTART LEFT 10 SAMPLES SPILLED, OF WHICH THE FIRST 4 WERE COMMITTED */
+	spill := SampleSpillPath("SN0001_0000000001")
+	b := []byte{}
+	for _, smp := range testSamples(0, 10) {
+		rec, err := FLASH_SMP_LAYOUT.Encode(smp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b = append(b, rec...)
+	}
+	if err := os.WriteFile(spill, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	off := strconv.Itoa(4 * FLASH_SMP_SIZE)
+	if err := os.WriteFile(spill+SMP_SPILL_OFF_EXT, []byte(off), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	w := GetSampleWriter(jdbc)
+	if stats := w.Stats(); !stats.Spilling || stats.SpillDepth != 6 {
+		t.Fatalf("spilling %t, depth %d; want 6 samples waiting", stats.Spilling, stats.SpillDepth)
+	}
+
+	/* NEW SAMPLES FOLLOW THE SPILLED SAMPLES */
+	w.Write(Sample{SmpTime: 10})
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	testSamplesWritten(t, jdbc, 4, 11)
+	for _, path := range []string{spill, spill + SMP_SPILL_OFF_EXT} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s not removed once written", path)
+		}
+	}
+}
+
+func TestCloseSampleWritersDrainsQueues(t *testing.T) {
+	jdbc := testSampleJobDB(t, "SN0001_0000000001")
+	for _, smp := range testSamples(0, 25) {
+		if err := WriteSample(smp, jdbc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w := GetSampleWriter(jdbc)
+
+	CloseSampleWriters()
+	testSamplesWritten(t, jdbc, 0, 25)
+
+	if len(GetSampleWriterStats()) != 0 {
+		t.Fatal("writers open after shutdown")
+	}
+	if err := w.Write(Sample{SmpTime: 25}); err != ErrSampleWriterClosed {
+		t.Fatalf("write to a closed writer: %v; want %v", err, ErrSampleWriterClosed)
+	}
+	if err := w.Flush(); err != ErrSampleWriterClosed {
+		t.Fatalf("flush of a closed writer: %v; want %v", err, ErrSampleWriterClosed)
+	}
+}
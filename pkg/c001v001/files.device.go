@@ -179,13 +179,13 @@ func (device *Device) ReadLastADMFromHEXFile(jobName string, adm Admin) (err err
 	if err != nil {
 		return
 	}
-	b := buf[len(buf)-284:]
+	b := buf[len(buf)-FLASH_ADM_SIZE:]
 	// fmt.Printf("\nadmBytes ( %d ) : %v\n", len(b), b)
 	adm.AdminFromBytes(b)
 	return
 }
 
-/* STA DEMO MEMORY -> 180 BYTES -> HxD 45 x 4 */
+/* STA DEMO MEMORY -> 192 BYTES -> HxD 48 x 4 */
 func (device Device) WriteSTAToHEXFile(jobName string, sta State) (err error) {
 	buf := sta.StateToBytes() // fmt.Printf("\nstaBytes ( %d ) : %x\n", len(buf), buf)
 	return pkg.WriteModelBytesToHEXFile(jobName, "sta", buf)
@@ -196,7 +196,7 @@ func (device *Device) ReadLastSTAFromHEXFile(jobName string, sta State) (err err
 	if err != nil {
 		return
 	}
-	b := buf[len(buf)-180:]
+	b := buf[len(buf)-FLASH_STA_SIZE:]
 	// fmt.Printf("\nstaBytes ( %d ) : %v\n", len(b), b)
 	sta.StateFromBytes(b)
 	return
@@ -213,7 +213,7 @@ func (device *Device) ReadLastHDRFromHEXFile(jobName string, hdr Header) (err er
 	if err != nil {
 		return
 	}
-	b := buf[len(buf)-308:]
+	b := buf[len(buf)-FLASH_HDR_SIZE:]
 	// fmt.Printf("\nhdrBytes ( %d ) : %v\n", len(b), b)
 	hdr.HeaderFromBytes(b)
 	return
@@ -230,7 +230,7 @@ func (device *Device) ReadLastCFGFromHEXFile(jobName string, cfg Config) (err er
 	if err != nil {
 		return
 	}
-	b := buf[len(buf)-176:]
+	b := buf[len(buf)-FLASH_CFG_SIZE:]
 	// fmt.Printf("\ncfgBytes ( %d ) : %v\n", len(b), b)
 	cfg.ConfigFromBytes(b)
 	return
@@ -247,7 +247,7 @@ func (device *Device) ReadLastEVTFromHEXFile(jobName string, evt *Event) (err er
 	if err != nil {
 		return
 	}
-	b := buf[len(buf)-668:]
+	b := buf[len(buf)-FLASH_EVT_SIZE:]
 	// fmt.Printf("\nevtBytes ( %d ) : %v\n", len(b), b)
 	evt.EventFromBytes(b)
 	return
@@ -0,0 +1,165 @@
+package c001v001
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+	"github.com/leehayford/des/pkg"
+)
+
+const BULK_WS_PROGRESS_MS = 1000 // Interval at which progress is streamed to the user
+
+func InitializeBulkRoutes(app, api *fiber.App) (err error) {
+
+	api.Route(DEVICE_ROUTE+"/bulk", func(router fiber.Router) {
+
+		/* OPERATOR */
+		router.Post("/", pkg.DesAuth, HandleStartBulkCommand)
+
+		/* VIEWER */
+		router.Get("/list", pkg.DesAuth, HandleGetBulkCommands)
+		router.Post("/status", pkg.DesAuth, HandleGetBulkCommandStatus)
+		router.Get("/ws", pkg.DesAuth, websocket.New(HandleBulkCommandWS))
+	})
+	return
+}
+
+/*
+	SEND A PARTIAL ADM / CFG / HDR TO EVERY SELECTED DEVICE
+
+BODY: selector ( serials, token, group ), patch ( adm, cfg, hdr )
+RETURNS THE BULK COMMAND; POLL /status OR STREAM /ws FOR PROGRESS
+*/
+func HandleStartBulkCommand(c *fiber.Ctx) (err error) {
+	// fmt.Printf("\nHandleStartBulkCommand( )\n")
+
+	/* CHECK USER PERMISSION */
+	if !pkg.UserRole_Operator(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).
+			SendString(pkg.ERR_AUTH_OPERATOR + ": Send bulk commands")
+	}
+
+	/* PARSE AND VALIDATE REQUEST DATA */
+	req := BulkRequest{}
+	if err = pkg.ParseRequestBody(c, &req); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	bulk, err := StartBulkCommand(req, c.IP(), c.Locals("sub").(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"bulk": &bulk})
+}
+
+/* RETURNS ALL BULK COMMANDS, NEWEST FIRST */
+func HandleGetBulkCommands(c *fiber.Ctx) (err error) {
+
+	/* CHECK USER PERMISSION */
+	if !pkg.UserRole_Viewer(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).
+			SendString(pkg.ERR_AUTH_VIEWER + ": View bulk commands")
+	}
+
+	bulks, err := pkg.GetDESBulkCmds()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"bulks": bulks})
+}
+
+/* RETURNS THE BULK COMMAND'S PROGRESS AND DEVICE RECORDS */
+func HandleGetBulkCommandStatus(c *fiber.Ctx) (err error) {
+
+	/* CHECK USER PERMISSION */
+	if !pkg.UserRole_Viewer(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).
+			SendString(pkg.ERR_AUTH_VIEWER + ": View bulk commands")
+	}
+
+	/* PARSE AND VALIDATE REQUEST DATA */
+	req := BulkIDRequest{}
+	if err = pkg.ParseRequestBody(c, &req); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	bulk, err := pkg.GetDESBulkCmd(req.DESBulkID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(fmt.Sprintf("Bulk command %d not found", req.DESBulkID))
+	}
+	prog, err := bulk.Progress()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+	devs, err := bulk.Devices()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"progress": &prog, "devices": devs})
+}
+
+/*
+	STREAMS THE BULK COMMAND'S PROGRESS ( ?id=<des_bulk_id> ) UNTIL IT IS DONE
+
+SENDS pkg.WSMessage{ Type: "bulk", Data: pkg.DESBulkCmdProgress } EVERY BULK_WS_PROGRESS_MS
+*/
+func HandleBulkCommandWS(ws *websocket.Conn) {
+
+	/* CHECK USER PERMISSION */
+	if !pkg.UserRole_Viewer(ws.Locals("role")) {
+		pkg.SendWSConnectionError(ws, pkg.ERR_AUTH_VIEWER+": View bulk commands")
+		return
+	}
+
+	/* PARSE AND VALIDATE REQUEST DATA */
+	id, err := strconv.ParseInt(ws.Query("id"), 10, 64)
+	if err != nil {
+		pkg.SendWSConnectionError(ws, "Invalid bulk command ID")
+		return
+	}
+	bulk, err := pkg.GetDESBulkCmd(id)
+	if err != nil {
+		pkg.SendWSConnectionError(ws, fmt.Sprintf("Bulk command %d not found", id))
+		return
+	}
+
+	for {
+		prog, err := bulk.Progress()
+		if err != nil {
+			pkg.SendWSConnectionError(ws, err.Error())
+			return
+		}
+
+		/* SEND WSMessage AS JSON STRING */
+		js, err := json.Marshal(&pkg.WSMessage{Type: "bulk", Data: prog})
+		if err != nil {
+			pkg.LogErr(err)
+			return
+		}
+		if err = ws.WriteJSON(string(js)); err != nil {
+			if !strings.Contains(err.Error(), "close sent") {
+				pkg.LogErr(err)
+			}
+			return
+		}
+
+		if prog.Done {
+			ws.Close()
+			return
+		}
+
+		time.Sleep(time.Millisecond * BULK_WS_PROGRESS_MS)
+		if bulk, err = pkg.GetDESBulkCmd(id); err != nil {
+			pkg.SendWSConnectionError(ws, err.Error())
+			return
+		}
+	}
+}
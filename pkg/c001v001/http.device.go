@@ -3,6 +3,7 @@ package c001v001
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/url"
 	"strconv"
 	"strings"
@@ -14,13 +15,15 @@ import (
 )
 
 func InitializeDeviceRoutes(app, api *fiber.App) {
-	api.Route("/001/001/device", func(router fiber.Router) {
+	api.Route(DEVICE_ROUTE+"/device", func(router fiber.Router) {
 
 		/* DEVICE-ADMIN-LEVEL OPERATIONS */
 		router.Post("/register", pkg.DesAuth, HandleRegisterDevice)
 		router.Post("/files", pkg.DesAuth, HandleGetDeviceIntitializationFiles)
 		router.Post("/des_client_refresh", pkg.DesAuth, HandleDESDeviceClientRefresh)
 		router.Post("/des_client_disconnect", pkg.DesAuth, HandleDESDeviceClientDisconnect)
+		router.Post("/broker", pkg.DesAuth, HandleDeviceBrokerStatus)
+		router.Post("/revoke_cert", pkg.DesAuth, HandleRevokeDeviceCert)
 
 		/* DEVICE-OPERATOR-LEVEL OPERATIONS */
 		router.Post("/start", pkg.DesAuth, HandleStartJobRequest)
@@ -31,6 +34,7 @@ func InitializeDeviceRoutes(app, api *fiber.App) {
 		router.Post("/header", pkg.DesAuth, HandleSetHeaderRequest)
 		router.Post("/config", pkg.DesAuth, HandleSetConfigRequest)
 		router.Post("/event", pkg.DesAuth, HandleSetEventRequest)
+		router.Post("/flash", pkg.DesAuth, HandleFlashUpload)
 
 		/* DEVICE-VIEWER-LEVEL OPERATIONS */
 		router.Post("/job_events", pkg.DesAuth, HandleQryActiveJobEvents)
@@ -127,6 +131,8 @@ UPON MQTT MESSAGE AT '.../CMD/EVENT, DEVICE CLIENT PERFORMS
 
 	DES JOB REGISTRATION
 	CLASS/VERSION SPECIFIC JOB START ACTIONS
+
+?tpl=<des_tpl_id> APPLIES A CONFIGURATION TEMPLATE TO THE REQUEST'S ADM / CFG / HDR
 */
 func HandleStartJobRequest(c *fiber.Ctx) (err error) {
 	// fmt.Printf("\nHandleStartJobRequest( )\n")
@@ -148,10 +154,25 @@ func HandleStartJobRequest(c *fiber.Ctx) (err error) {
 		return c.Status(fiber.StatusBadRequest).SendString(pkg.ERR_MQTT_DEVICE_CONN)
 	}
 
+	/* APPLY THE CONFIGURATION TEMPLATE, IF ANY ( ?tpl=<des_tpl_id> ) */
+	if tpl := c.Query("tpl"); tpl != "" {
+		id, err := strconv.ParseInt(tpl, 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString("Invalid template ID")
+		}
+		org, err := pkg.GetUserOrg(c.Locals("sub").(string))
+		if err != nil {
+			return c.Status(fiber.StatusForbidden).SendString(err.Error())
+		}
+		if err = device.ApplyTemplate(id, org); err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+		}
+	}
+
 	/* SEND START JOB REQUEST */
 	uid := (c.Locals("sub").(string))
 	if err = device.StartJobRequest(c.IP(), uid); err != nil {
-		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+		return pkg.SendRequestError(c, fiber.StatusInternalServerError, err)
 	}
 	// pkg.Json("HandleStartJobRequest(): -> device.StartJobRequest(...) -> device", device)
 
@@ -253,7 +274,7 @@ func HandleSetAdminRequest(c *fiber.Ctx) (err error) {
 
 	/* SEND SET ADMIN REQUEST */
 	if err = device.SetAdminRequest(c.IP()); err != nil {
-		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+		return pkg.SendRequestError(c, fiber.StatusInternalServerError, err)
 	} // pkg.Json("HandleSetAdminRequest(): -> device.SetAdminRequest(...) -> device.ADM", device.ADM)
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{"device": &device})
@@ -322,7 +343,7 @@ func HandleSetHeaderRequest(c *fiber.Ctx) (err error) {
 
 	/* SEND SET HEADER REQUEST */
 	if err = device.SetHeaderRequest(c.IP()); err != nil {
-		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+		return pkg.SendRequestError(c, fiber.StatusInternalServerError, err)
 	} // pkg.Json("HandleSetHeaderRequest(): -> device.SetHeaderRequest(...) -> device.HDR", device.HDR)
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{"device": &device})
@@ -355,7 +376,7 @@ func HandleSetConfigRequest(c *fiber.Ctx) (err error) {
 
 	/* SEND SET CONFIG REQUEST */
 	if err = device.SetConfigRequest(c.IP()); err != nil {
-		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+		return pkg.SendRequestError(c, fiber.StatusInternalServerError, err)
 	} // pkg.Json("HandleSetConfigRequest(): -> device.SetConfigRequest(...) -> device.CFG", device.CFG)
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{"device": &device})
@@ -395,6 +416,60 @@ func HandleSetEventRequest(c *fiber.Ctx) (err error) {
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{"device": &device})
 }
 
+/*
+	USED TO BACKFILL JOBS FROM A DEVICE'S FLASH MEMORY
+
+MULTIPART FORM:
+  - des_dev_serial: REQUIRED
+  - des_job_name: OPTIONAL; WHERE SET, ALL RECORDS ARE WRITTEN TO THIS JOB
+  - adm, sta, hdr, cfg, evt, smp: FLASH DUMP FILES ( RAW BINARY OR INTEL HEX ); ANY MAY BE OMITTED
+
+THE DEVICE NEED NOT BE CONNECTED TO THE BROKER
+*/
+func HandleFlashUpload(c *fiber.Ctx) (err error) {
+	// fmt.Printf("\nHandleFlashUpload( )\n")
+
+	/* CHECK USER PERMISSION */
+	if !pkg.UserRole_Operator(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).
+			SendString(pkg.ERR_AUTH_OPERATOR + ": Upload device flash")
+	}
+
+	/* PARSE AND VALIDATE REQUEST DATA */
+	device := DevicesMapRead(c.FormValue("des_dev_serial"))
+	if device.DESDevSerial == "" {
+		return c.Status(fiber.StatusBadRequest).SendString("Device not found")
+	}
+
+	recs := FlashRecords{}
+	for _, typ := range FLASH_TYPES {
+		fh, err := c.FormFile(typ)
+		if err != nil {
+			/* THIS RECORD TYPE WAS NOT UPLOADED */
+			continue
+		}
+
+		f, err := fh.Open()
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+		}
+		buf, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+		}
+
+		if err = recs.ParseFlash(typ, buf); err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+		}
+	}
+
+	/* WRITE THE RECORDS TO THE JOB DATABASES */
+	sum := device.BackfillFlash(recs, c.FormValue("des_job_name"))
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"summary": &sum})
+}
+
 func HandleQryActiveJobEvents(c *fiber.Ctx) (err error) {
 	// fmt.Printf("\nHandleQryActiveJobEvents( )\n")
 
@@ -555,6 +630,35 @@ func HandleDESDeviceClientDisconnect(c *fiber.Ctx) (err error) {
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{"device": &device})
 }
 
+/* RETURNS THE DEVICE'S BROKER SESSIONS AND SUBSCRIPTIONS, CORRELATED WITH THE DEVICE PING */
+func HandleDeviceBrokerStatus(c *fiber.Ctx) (err error) {
+	// fmt.Printf("\nHandleDeviceBrokerStatus( )\n")
+
+	/* CHECK USER PERMISSION */
+	if !pkg.UserRole_Admin(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).
+			SendString(pkg.ERR_AUTH_ADMIN + ": View device broker status")
+	}
+
+	/* PARSE AND VALIDATE REQUEST DATA */
+	device := Device{}
+	if err = ValidatePostRequestBody_Device(c, &device); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	d := DevicesMapRead(device.DESDevSerial)
+	if d.DESDevSerial == "" {
+		return c.Status(fiber.StatusBadRequest).SendString("Device not found")
+	}
+
+	sts, err := d.BrokerStatus()
+	if err != nil {
+		return c.Status(fiber.StatusBadGateway).SendString(err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"broker": sts})
+}
+
 func HandleDESDeviceClientRefresh(c *fiber.Ctx) (err error) {
 	// fmt.Printf("\nHandleCheckDESDeviceClient( )\n")
 
@@ -608,7 +712,69 @@ func HandleGetDeviceIntitializationFiles(c *fiber.Ctx) (err error) {
 		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
 	} // pkg.Json("HandleGetDeviceFiles( ) -> GetDeviceFiles() -> device", device)
 
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{"files": &device})
+	/* MESSAGE SIGNING KEY */
+	sig, err := device.GetSigningKeyPEM()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+
+	/* EMBEDDED BROKER SECRET; ONLY ITS HASH IS KEPT, SO EACH REQUEST REPLACES THE DEVICE'S SECRET */
+	brk, err := device.IssueBrokerSecret()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+
+	/* NO DEVICE CERTIFICATES WITHOUT THE DES CA */
+	if pkg.DESCA == nil {
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{"files": &device, "sig": sig, "broker_pw": brk})
+	}
+
+	crt, err := device.GetDeviceCertFiles()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"files": &device, "crt": crt, "sig": sig, "broker_pw": brk})
+}
+
+/*
+	REVOKES ALL CERTIFICATES ISSUED TO THE DEVICE AND ISSUES A REPLACEMENT
+
+THE REPLACEMENT IS RETURNED HERE AND WITH THE NEXT DEVICE INITIALIZATION FILES
+*/
+func HandleRevokeDeviceCert(c *fiber.Ctx) (err error) {
+	// fmt.Printf("\nHandleRevokeDeviceCert( )\n")
+
+	/* CHECK USER PERMISSION */
+	if !pkg.UserRole_Super(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).
+			SendString(pkg.ERR_AUTH_SUPER + ": Revoke device certificates")
+	}
+
+	if pkg.DESCA == nil {
+		return c.Status(fiber.StatusNotFound).SendString(pkg.ERR_CA_NOT_LOADED)
+	}
+
+	/* PARSE AND VALIDATE REQUEST DATA */
+	req := struct {
+		Serial string `json:"des_dev_serial"`
+		Reason string `json:"reason"`
+	}{}
+	if err = pkg.ParseRequestBody(c, &req); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	device := DevicesMapRead(req.Serial)
+	if device.DESDevSerial == "" {
+		return c.Status(fiber.StatusBadRequest).SendString("Device not found")
+	}
+
+	count, crt, err := device.RevokeDeviceCerts(req.Reason)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"revoked": count, "crt": crt})
 }
 
 /**************************************************************************************************************/
@@ -657,7 +823,7 @@ func HandleSetDebug(c *fiber.Ctx) (err error) {
 }
 
 type MsgLimit struct {
-	Kafka string `json:"kafka"`
+	Kafka string `json:"kafka" tlv:"1"`
 }
 
 func HandleTestMessageLimit(c *fiber.Ctx) (err error) {
@@ -0,0 +1,72 @@
+package c001v001
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/leehayford/des/pkg"
+)
+
+func InitializeEncodingRoutes(app, api *fiber.App) (err error) {
+
+	api.Route(DEVICE_ROUTE+"/encoding", func(router fiber.Router) {
+
+		/* ADMIN */
+		router.Post("/set", pkg.DesAuth, HandleSetEncoding)
+
+		/* VIEWER */
+		router.Post("/", pkg.DesAuth, HandleGetEncoding)
+	})
+	return
+}
+
+/* RETURNS THE ENCODING THE DEVICE DECLARED AND THE ENCODING OF COMMANDS SENT TO IT */
+func HandleGetEncoding(c *fiber.Ctx) (err error) {
+
+	/* CHECK USER PERMISSION */
+	if !pkg.UserRole_Viewer(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).
+			SendString(pkg.ERR_AUTH_VIEWER + ": View device payload encoding")
+	}
+
+	/* PARSE AND VALIDATE REQUEST DATA */
+	device := Device{}
+	if err = ValidatePostRequestBody_Device(c, &device); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"encoding": EncodingsMapRead(device.DESDevSerial),
+		"cmd":      device.CMDEncoding(),
+	})
+}
+
+/*
+	FORCE ( OR STOP FORCING ) JSON COMMANDS TO THE DEVICE
+
+BODY: des_dev_serial, force_json
+*/
+func HandleSetEncoding(c *fiber.Ctx) (err error) {
+
+	/* CHECK USER PERMISSION */
+	if !pkg.UserRole_Admin(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).
+			SendString(pkg.ERR_AUTH_ADMIN + ": Set device payload encoding")
+	}
+
+	/* PARSE AND VALIDATE REQUEST DATA */
+	req := EncodingRequest{}
+	if err = pkg.ParseRequestBody(c, &req); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	if err = pkg.ValidateSerialNumber(req.DESDevSerial); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	enc := SetForceJSON(req)
+	device := Device{}
+	device.DESDevSerial = req.DESDevSerial
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"encoding": enc,
+		"cmd":      device.CMDEncoding(),
+	})
+}
@@ -0,0 +1,244 @@
+package c001v001
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/leehayford/des/pkg"
+)
+
+func InitializeFirmwareRoutes(app, api *fiber.App) (err error) {
+
+	api.Route(DEVICE_ROUTE+"/firmware", func(router fiber.Router) {
+
+		/* ADMIN */
+		router.Post("/upload", pkg.DesAuth, HandleFirmwareUpload)
+		router.Post("/campaign", pkg.DesAuth, HandleStartFwCampaign)
+		router.Post("/campaign/advance", pkg.DesAuth, HandleAdvanceFwCampaign)
+		router.Post("/campaign/status", pkg.DesAuth, HandleSetFwCampaignStatus)
+
+		/* VIEWER */
+		router.Get("/list", pkg.DesAuth, HandleGetFirmwareList)
+		router.Get("/campaigns", pkg.DesAuth, HandleGetFwCampaigns)
+		router.Post("/campaign/devices", pkg.DesAuth, HandleGetFwCampaignDevices)
+		router.Post("/device", pkg.DesAuth, HandleGetDeviceFirmware)
+	})
+	return
+}
+
+/*
+	REGISTER A FIRMWARE IMAGE FOR CLASS 001 VERSION 001 DEVICES
+
+MULTIPART FORM: des_fw_type, des_fw_release, des_fw_notes, image
+*/
+func HandleFirmwareUpload(c *fiber.Ctx) (err error) {
+	// fmt.Printf("\nHandleFirmwareUpload( )\n")
+
+	/* CHECK USER PERMISSION */
+	if !pkg.UserRole_Admin(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).
+			SendString(pkg.ERR_AUTH_ADMIN + ": Upload firmware")
+	}
+
+	/* PARSE AND VALIDATE REQUEST DATA */
+	fh, err := c.FormFile("image")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString("Firmware image is required")
+	}
+	f, err := fh.Open()
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	img, err := io.ReadAll(f)
+	f.Close()
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	fw := pkg.DESFirmware{
+		DESFwRegUserID: c.Locals("sub").(string),
+		DESFwClass:     DEVICE_CLASS,
+		DESFwVersion:   DEVICE_VERSION,
+		DESFwType:      c.FormValue("des_fw_type"),
+		DESFwRelease:   c.FormValue("des_fw_release"),
+		DESFwNotes:     c.FormValue("des_fw_notes"),
+	}
+	if err = pkg.RegisterFirmware(&fw, img); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"firmware": &fw})
+}
+
+/* RETURNS THE FIRMWARE REGISTERED FOR CLASS 001 VERSION 001 DEVICES, NEWEST FIRST */
+func HandleGetFirmwareList(c *fiber.Ctx) (err error) {
+
+	/* CHECK USER PERMISSION */
+	if !pkg.UserRole_Viewer(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).
+			SendString(pkg.ERR_AUTH_VIEWER + ": View firmware list")
+	}
+
+	fws, err := pkg.GetFirmwareList(DEVICE_CLASS, DEVICE_VERSION)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"firmware": fws})
+}
+
+/*
+	CREATE A FIRMWARE UPDATE CAMPAIGN AND RELEASE ITS FIRST STAGE
+
+BODY: des_fw_camp_name, des_fw_camp_fw_id, des_fw_camp_group, des_fw_camp_stages
+*/
+func HandleStartFwCampaign(c *fiber.Ctx) (err error) {
+	// fmt.Printf("\nHandleStartFwCampaign( )\n")
+
+	/* CHECK USER PERMISSION */
+	if !pkg.UserRole_Admin(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).
+			SendString(pkg.ERR_AUTH_ADMIN + ": Start firmware campaigns")
+	}
+
+	/* PARSE AND VALIDATE REQUEST DATA */
+	camp := pkg.DESFwCampaign{}
+	if err = pkg.ParseRequestBody(c, &camp); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	if camp.DESFwCampStages == "" {
+		camp.DESFwCampStages = "100"
+	}
+	camp.DESFwCampRegAddr = c.IP()
+	camp.DESFwCampRegUserID = c.Locals("sub").(string)
+
+	if err = StartFwCampaign(&camp); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"campaign": &camp})
+}
+
+type FwCampaignRequest struct {
+	DESFwCampID int64  `json:"des_fw_camp_id"`
+	Force       bool   `json:"force"`
+	Status      string `json:"status"`
+}
+
+/* RELEASE THE CAMPAIGN'S NEXT STAGE; force RELEASES IT DESPITE FAILED DEVICES */
+func HandleAdvanceFwCampaign(c *fiber.Ctx) (err error) {
+
+	/* CHECK USER PERMISSION */
+	if !pkg.UserRole_Admin(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).
+			SendString(pkg.ERR_AUTH_ADMIN + ": Advance firmware campaigns")
+	}
+
+	/* PARSE AND VALIDATE REQUEST DATA */
+	req := FwCampaignRequest{}
+	if err = pkg.ParseRequestBody(c, &req); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	camp, err := AdvanceFwCampaign(req.DESFwCampID, req.Force)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"campaign": &camp})
+}
+
+/* PAUSE ( paused ), RESUME ( active ) OR CANCEL ( cancelled ) A CAMPAIGN */
+func HandleSetFwCampaignStatus(c *fiber.Ctx) (err error) {
+
+	/* CHECK USER PERMISSION */
+	if !pkg.UserRole_Admin(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).
+			SendString(pkg.ERR_AUTH_ADMIN + ": Change firmware campaign status")
+	}
+
+	/* PARSE AND VALIDATE REQUEST DATA */
+	req := FwCampaignRequest{}
+	if err = pkg.ParseRequestBody(c, &req); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	camp, err := SetFwCampaignStatus(req.DESFwCampID, req.Status)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"campaign": &camp})
+}
+
+/* RETURNS ALL FIRMWARE CAMPAIGNS, NEWEST FIRST */
+func HandleGetFwCampaigns(c *fiber.Ctx) (err error) {
+
+	/* CHECK USER PERMISSION */
+	if !pkg.UserRole_Viewer(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).
+			SendString(pkg.ERR_AUTH_VIEWER + ": View firmware campaigns")
+	}
+
+	camps, err := pkg.GetFwCampaigns()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"campaigns": camps})
+}
+
+/* RETURNS THE INVENTORY RECORDS AND STATUS COUNTS OF THE DEVICES RELEASED BY A CAMPAIGN */
+func HandleGetFwCampaignDevices(c *fiber.Ctx) (err error) {
+
+	/* CHECK USER PERMISSION */
+	if !pkg.UserRole_Viewer(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).
+			SendString(pkg.ERR_AUTH_VIEWER + ": View firmware campaigns")
+	}
+
+	/* PARSE AND VALIDATE REQUEST DATA */
+	req := FwCampaignRequest{}
+	if err = pkg.ParseRequestBody(c, &req); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	camp, err := pkg.GetFwCampaign(req.DESFwCampID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(fmt.Sprintf("Campaign %d not found", req.DESFwCampID))
+	}
+	devs, err := camp.Devices()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+	counts, err := camp.StatusCounts()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"campaign": &camp, "devices": devs, "counts": counts})
+}
+
+/* RETURNS THE DEVICE'S FIRMWARE INVENTORY RECORDS ( CURRENT / TARGET VERSIONS, UPDATE PROGRESS ) */
+func HandleGetDeviceFirmware(c *fiber.Ctx) (err error) {
+
+	/* CHECK USER PERMISSION */
+	if !pkg.UserRole_Viewer(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).
+			SendString(pkg.ERR_AUTH_VIEWER + ": View device firmware")
+	}
+
+	/* PARSE AND VALIDATE REQUEST DATA */
+	device := Device{}
+	if err = ValidatePostRequestBody_Device(c, &device); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	devs, err := pkg.GetFwDevices(device.DESDevSerial)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"firmware": devs})
+}
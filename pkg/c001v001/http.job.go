@@ -9,7 +9,7 @@ import (
 
 func InitializeJobRoutes(app, api *fiber.App) (err error) {
 
-	api.Route("/001/001/job", func(router fiber.Router) {
+	api.Route(DEVICE_ROUTE+"/job", func(router fiber.Router) {
 		router.Get("/event/list", pkg.DesAuth, HandleGetEventTypeLists)
 
 		router.Get("/list", pkg.DesAuth, HandleGetJobList)
@@ -18,6 +18,8 @@ func InitializeJobRoutes(app, api *fiber.App) (err error) {
 		router.Post("/new_header", pkg.DesAuth, HandleJobNewHeader)
 		router.Post("/new_event", pkg.DesAuth, HandleNewReportEvent)
 		router.Post("/event_list", pkg.DesAuth, HandleGetJobEvents)
+		router.Post("/history", pkg.DesAuth, HandleGetJobHistory)
+		router.Post("/history/diff", pkg.DesAuth, HandleDiffJobHistory)
 
 		router.Get("/des_list", pkg.DesAuth, HandleGetAdminJobList)
 	})
@@ -93,7 +95,7 @@ func HandleGetJobData(c *fiber.Ctx) (err error) {
 	} // pkg.Json("HandleGetJobData(): -> c.BodyParser(&job) -> job", job)
 
 	/* OPEN A JOB DATABASE CONNECTION FOR THIS REQUEST */
-	if err = job.ConnectDBC(); err != nil {
+	if err = job.ConnectReadOnlyDBC(); err != nil {
 		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
 	}
 
@@ -191,7 +193,7 @@ func HandleGetJobEvents(c *fiber.Ctx) (err error) {
 	pkg.Json("HandleGetJobEvents(): -> c.BodyParser(&job) -> job.DESRegistration", job.DESRegistration)
 
 	/* OPEN A JOB DATABASE CONNECTION FOR THIS REQUEST */
-	if err = job.ConnectDBC(); err != nil {
+	if err = job.ConnectReadOnlyDBC(); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"status":  "fail",
 			"message": err.Error(),
@@ -287,3 +289,71 @@ func HandleGetAdminJobList(c *fiber.Ctx) (err error) {
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{"jobs": jobs})
 }
+
+/*
+	RETURNS THE JOB'S ADM / CFG / HDR CHANGE HISTORY, OLDEST FIRST
+
+BODY: reg ( the job or CMDARCHIVE ), type ( adm, cfg, hdr )
+*/
+func HandleGetJobHistory(c *fiber.Ctx) (err error) {
+
+	/* CHECK USER PERMISSION */
+	if !pkg.UserRole_Viewer(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).
+			SendString(pkg.ERR_AUTH_VIEWER + ": View job history")
+	}
+
+	/* PARSE AND VALIDATE REQUEST DATA */
+	req := HistoryRequest{}
+	if err = pkg.ParseRequestBody(c, &req); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	/* OPEN A JOB DATABASE CONNECTION FOR THIS REQUEST */
+	job := Job{DESRegistration: req.DESRegistration}
+	if err = job.ConnectReadOnlyDBC(); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	defer job.DBC.Disconnect()
+
+	hist, err := job.GetHistory(req.Type)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"history": hist})
+}
+
+/*
+	RETURNS THE FIELD-LEVEL DIFF BETWEEN TWO VERSIONS OF THE JOB'S ADM / CFG / HDR
+
+BODY: reg, type, from, to ( versions, as numbered by /history )
+*/
+func HandleDiffJobHistory(c *fiber.Ctx) (err error) {
+
+	/* CHECK USER PERMISSION */
+	if !pkg.UserRole_Viewer(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).
+			SendString(pkg.ERR_AUTH_VIEWER + ": View job history")
+	}
+
+	/* PARSE AND VALIDATE REQUEST DATA */
+	req := HistoryRequest{}
+	if err = pkg.ParseRequestBody(c, &req); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	/* OPEN A JOB DATABASE CONNECTION FOR THIS REQUEST */
+	job := Job{DESRegistration: req.DESRegistration}
+	if err = job.ConnectReadOnlyDBC(); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	defer job.DBC.Disconnect()
+
+	from, to, diffs, err := job.DiffHistory(req.Type, req.From, req.To)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"from": &from, "to": &to, "diffs": diffs})
+}
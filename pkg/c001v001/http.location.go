@@ -0,0 +1,127 @@
+package c001v001
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/leehayford/des/pkg"
+)
+
+const LOC_HISTORY_LIMIT = 1000 // Most recent locations returned by /location/history
+
+func InitializeLocationRoutes(app, api *fiber.App) (err error) {
+
+	api.Route(DEVICE_ROUTE+"/location", func(router fiber.Router) {
+
+		/* OPERATOR */
+		router.Post("/geofence/set", pkg.DesAuth, HandleSetGeofence)
+
+		/* VIEWER */
+		router.Post("/history", pkg.DesAuth, HandleGetLocationHistory)
+		router.Post("/geofence", pkg.DesAuth, HandleGetGeofence)
+		router.Post("/track", pkg.DesAuth, HandleGetJobTrack)
+	})
+	return
+}
+
+/* RETURNS THE DEVICE'S MOST RECENT LOCATIONS, NEWEST FIRST */
+func HandleGetLocationHistory(c *fiber.Ctx) (err error) {
+
+	/* CHECK USER PERMISSION */
+	if !pkg.UserRole_Viewer(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).
+			SendString(pkg.ERR_AUTH_VIEWER + ": View device locations")
+	}
+
+	/* PARSE AND VALIDATE REQUEST DATA */
+	device := Device{}
+	if err = ValidatePostRequestBody_Device(c, &device); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	locs, err := pkg.GetDESDevLocations(device.DESDevSerial, LOC_HISTORY_LIMIT)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"locations": locs})
+}
+
+/* RETURNS THE GEOFENCE FOR THE DEVICE'S ACTIVE JOB; geofence IS null WHERE THERE IS NONE */
+func HandleGetGeofence(c *fiber.Ctx) (err error) {
+
+	/* CHECK USER PERMISSION */
+	if !pkg.UserRole_Viewer(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).
+			SendString(pkg.ERR_AUTH_VIEWER + ": View device geofences")
+	}
+
+	/* PARSE AND VALIDATE REQUEST DATA */
+	device := Device{}
+	if err = ValidatePostRequestBody_Device(c, &device); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	d := DevicesMapRead(device.DESDevSerial)
+	fence, found, err := pkg.GetDESGeofence(d.DESDevSerial, d.DESJobName)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+	if !found {
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{"geofence": nil})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"geofence": &fence})
+}
+
+/*
+	SET THE GEOFENCE FOR THE DEVICE'S ACTIVE JOB
+
+BODY: des_dev_serial, radius ( m ), lng, lat ( OPTIONAL; DEFAULTS TO THE CURRENT CENTRE )
+*/
+func HandleSetGeofence(c *fiber.Ctx) (err error) {
+
+	/* CHECK USER PERMISSION */
+	if !pkg.UserRole_Operator(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).
+			SendString(pkg.ERR_AUTH_OPERATOR + ": Set device geofences")
+	}
+
+	/* PARSE AND VALIDATE REQUEST DATA */
+	req := GeofenceRequest{}
+	if err = pkg.ParseRequestBody(c, &req); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	fence, err := SetGeofence(req, c.IP(), c.Locals("sub").(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"geofence": &fence})
+}
+
+/*
+	RETURNS THE JOB'S TRACK AS A GeoJSON FeatureCollection
+
+BODY: reg ( the job )
+*/
+func HandleGetJobTrack(c *fiber.Ctx) (err error) {
+
+	/* CHECK USER PERMISSION */
+	if !pkg.UserRole_Viewer(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).
+			SendString(pkg.ERR_AUTH_VIEWER + ": View job tracks")
+	}
+
+	/* PARSE AND VALIDATE REQUEST DATA */
+	job := Job{}
+	if err = pkg.ParseRequestBody(c, &job); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	track, err := pkg.GetDESJobTrack(job.DESDevSerial, job.DESJobName)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(track)
+}
@@ -0,0 +1,165 @@
+package c001v001
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/leehayford/des/pkg"
+)
+
+func InitializeProgramRoutes(app, api *fiber.App) (err error) {
+
+	api.Route(DEVICE_ROUTE+"/program", func(router fiber.Router) {
+
+		/* OPERATOR */
+		router.Post("/start", pkg.DesAuth, HandleStartProgram)
+		router.Post("/pause", pkg.DesAuth, HandlePauseProgram)
+		router.Post("/resume", pkg.DesAuth, HandleResumeProgram)
+		router.Post("/abort", pkg.DesAuth, HandleAbortProgram)
+
+		/* VIEWER */
+		router.Post("/list", pkg.DesAuth, HandleGetPrograms)
+		router.Post("/active", pkg.DesAuth, HandleGetActiveProgram)
+	})
+	return
+}
+
+/*
+	START A TEST PROGRAM ON THE DEVICE'S ACTIVE JOB
+
+BODY: des_dev_serial, name, steps ( SEE ProgramStep )
+*/
+func HandleStartProgram(c *fiber.Ctx) (err error) {
+	// fmt.Printf("\nHandleStartProgram( )\n")
+
+	/* CHECK USER PERMISSION */
+	if !pkg.UserRole_Operator(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).
+			SendString(pkg.ERR_AUTH_OPERATOR + ": Run test programs")
+	}
+
+	/* PARSE AND VALIDATE REQUEST DATA */
+	req := ProgramRequest{}
+	if err = pkg.ParseRequestBody(c, &req); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	device := Device{}
+	device.DESDevSerial = req.DESDevSerial
+	prog, err := device.StartProgram(req, c.IP(), c.Locals("sub").(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"program": &prog})
+}
+
+func HandlePauseProgram(c *fiber.Ctx) (err error) {
+
+	/* CHECK USER PERMISSION */
+	if !pkg.UserRole_Operator(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).
+			SendString(pkg.ERR_AUTH_OPERATOR + ": Pause test programs")
+	}
+
+	/* PARSE AND VALIDATE REQUEST DATA */
+	req := ProgramIDRequest{}
+	if err = pkg.ParseRequestBody(c, &req); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	prog, err := PauseProgram(req.DESProgID, c.Locals("sub").(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"program": &prog})
+}
+
+func HandleResumeProgram(c *fiber.Ctx) (err error) {
+
+	/* CHECK USER PERMISSION */
+	if !pkg.UserRole_Operator(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).
+			SendString(pkg.ERR_AUTH_OPERATOR + ": Resume test programs")
+	}
+
+	/* PARSE AND VALIDATE REQUEST DATA */
+	req := ProgramIDRequest{}
+	if err = pkg.ParseRequestBody(c, &req); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	prog, err := ResumeProgram(req.DESProgID, c.Locals("sub").(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"program": &prog})
+}
+
+func HandleAbortProgram(c *fiber.Ctx) (err error) {
+
+	/* CHECK USER PERMISSION */
+	if !pkg.UserRole_Operator(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).
+			SendString(pkg.ERR_AUTH_OPERATOR + ": Abort test programs")
+	}
+
+	/* PARSE AND VALIDATE REQUEST DATA */
+	req := ProgramIDRequest{}
+	if err = pkg.ParseRequestBody(c, &req); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	prog, err := AbortProgram(req.DESProgID, c.Locals("sub").(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"program": &prog})
+}
+
+/* RETURNS THE DEVICE'S PROGRAMS, NEWEST FIRST */
+func HandleGetPrograms(c *fiber.Ctx) (err error) {
+
+	/* CHECK USER PERMISSION */
+	if !pkg.UserRole_Viewer(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).
+			SendString(pkg.ERR_AUTH_VIEWER + ": View test programs")
+	}
+
+	/* PARSE AND VALIDATE REQUEST DATA */
+	device := Device{}
+	if err = ValidatePostRequestBody_Device(c, &device); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	progs, err := pkg.GetDESPrograms(device.DESDevSerial)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"programs": progs})
+}
+
+/* RETURNS THE DEVICE'S RUNNING / PAUSED PROGRAM; program IS null WHERE THERE IS NONE */
+func HandleGetActiveProgram(c *fiber.Ctx) (err error) {
+
+	/* CHECK USER PERMISSION */
+	if !pkg.UserRole_Viewer(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).
+			SendString(pkg.ERR_AUTH_VIEWER + ": View test programs")
+	}
+
+	/* PARSE AND VALIDATE REQUEST DATA */
+	device := Device{}
+	if err = ValidatePostRequestBody_Device(c, &device); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	prog, ok := ProgramsMapRead(device.DESDevSerial)
+	if !ok {
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{"program": nil})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"program": &prog})
+}
@@ -0,0 +1,179 @@
+package c001v001
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/leehayford/des/pkg"
+)
+
+func InitializeTemplateRoutes(app, api *fiber.App) (err error) {
+
+	api.Route(DEVICE_ROUTE+"/template", func(router fiber.Router) {
+
+		/* OPERATOR */
+		router.Post("/", pkg.DesAuth, HandleCreateTemplate)
+		router.Post("/from_job", pkg.DesAuth, HandleCreateTemplateFromJob)
+		router.Post("/apply", pkg.DesAuth, HandleApplyTemplate)
+
+		/* VIEWER */
+		router.Post("/list", pkg.DesAuth, HandleGetTemplates)
+		router.Post("/versions", pkg.DesAuth, HandleGetTemplateVersions)
+	})
+	return
+}
+
+/*
+	SAVE A CONFIGURATION TEMPLATE; SAVING AN EXISTING NAME CREATES ITS NEXT VERSION
+
+BODY: name, desc, settings ( adm, cfg, hdr; ONLY THE FIELDS PRESENT ARE APPLIED )
+*/
+func HandleCreateTemplate(c *fiber.Ctx) (err error) {
+
+	/* CHECK USER PERMISSION */
+	if !pkg.UserRole_Operator(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).
+			SendString(pkg.ERR_AUTH_OPERATOR + ": Save configuration templates")
+	}
+
+	/* PARSE AND VALIDATE REQUEST DATA */
+	req := TemplateRequest{}
+	if err = pkg.ParseRequestBody(c, &req); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	/* TEMPLATES BELONG TO THE ORGANIZATION OF THE USER'S ACCOUNT */
+	org, err := pkg.GetUserOrg(c.Locals("sub").(string))
+	if err != nil {
+		return c.Status(fiber.StatusForbidden).SendString(err.Error())
+	}
+
+	tpl, err := CreateTemplate(req, org, c.IP(), c.Locals("sub").(string), "")
+	if err != nil {
+		return pkg.SendRequestError(c, fiber.StatusBadRequest, err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"template": &tpl})
+}
+
+/*
+	SAVE A JOB'S ADM / CFG / HDR AS A CONFIGURATION TEMPLATE
+
+BODY: reg ( the job ), name, desc
+*/
+func HandleCreateTemplateFromJob(c *fiber.Ctx) (err error) {
+
+	/* CHECK USER PERMISSION */
+	if !pkg.UserRole_Operator(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).
+			SendString(pkg.ERR_AUTH_OPERATOR + ": Save configuration templates")
+	}
+
+	/* PARSE AND VALIDATE REQUEST DATA */
+	req := TemplateFromJobRequest{}
+	if err = pkg.ParseRequestBody(c, &req); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	/* TEMPLATES BELONG TO THE ORGANIZATION OF THE USER'S ACCOUNT */
+	org, err := pkg.GetUserOrg(c.Locals("sub").(string))
+	if err != nil {
+		return c.Status(fiber.StatusForbidden).SendString(err.Error())
+	}
+
+	tpl, err := CreateTemplateFromJob(req, org, c.IP(), c.Locals("sub").(string))
+	if err != nil {
+		return pkg.SendRequestError(c, fiber.StatusBadRequest, err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"template": &tpl})
+}
+
+/*
+	SEND A CONFIGURATION TEMPLATE TO A RUNNING DEVICE
+
+BODY: des_tpl_id, des_dev_serial
+*/
+func HandleApplyTemplate(c *fiber.Ctx) (err error) {
+
+	/* CHECK USER PERMISSION */
+	if !pkg.UserRole_Operator(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).
+			SendString(pkg.ERR_AUTH_OPERATOR + ": Apply configuration templates")
+	}
+
+	/* PARSE AND VALIDATE REQUEST DATA */
+	req := TemplateApplyRequest{}
+	if err = pkg.ParseRequestBody(c, &req); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	/* TEMPLATES BELONG TO THE ORGANIZATION OF THE USER'S ACCOUNT */
+	org, err := pkg.GetUserOrg(c.Locals("sub").(string))
+	if err != nil {
+		return c.Status(fiber.StatusForbidden).SendString(err.Error())
+	}
+
+	tpl, err := ApplyTemplateToDevice(req, org, c.IP(), c.Locals("sub").(string))
+	if err != nil {
+		return pkg.SendRequestError(c, fiber.StatusBadRequest, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"template": &tpl})
+}
+
+/* RETURNS THE LATEST VERSION OF EACH OF THE ORGANIZATION'S TEMPLATES */
+func HandleGetTemplates(c *fiber.Ctx) (err error) {
+
+	/* CHECK USER PERMISSION */
+	if !pkg.UserRole_Viewer(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).
+			SendString(pkg.ERR_AUTH_VIEWER + ": View configuration templates")
+	}
+
+	/* PARSE AND VALIDATE REQUEST DATA */
+	req := TemplateListRequest{}
+	if err = pkg.ParseRequestBody(c, &req); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	/* TEMPLATES BELONG TO THE ORGANIZATION OF THE USER'S ACCOUNT */
+	org, err := pkg.GetUserOrg(c.Locals("sub").(string))
+	if err != nil {
+		return c.Status(fiber.StatusForbidden).SendString(err.Error())
+	}
+
+	tpls, err := pkg.GetDESTemplates(org)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"templates": tpls})
+}
+
+/* RETURNS EVERY VERSION OF THE ORGANIZATION'S TEMPLATE, NEWEST FIRST */
+func HandleGetTemplateVersions(c *fiber.Ctx) (err error) {
+
+	/* CHECK USER PERMISSION */
+	if !pkg.UserRole_Viewer(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).
+			SendString(pkg.ERR_AUTH_VIEWER + ": View configuration templates")
+	}
+
+	/* PARSE AND VALIDATE REQUEST DATA */
+	req := TemplateListRequest{}
+	if err = pkg.ParseRequestBody(c, &req); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	/* TEMPLATES BELONG TO THE ORGANIZATION OF THE USER'S ACCOUNT */
+	org, err := pkg.GetUserOrg(c.Locals("sub").(string))
+	if err != nil {
+		return c.Status(fiber.StatusForbidden).SendString(err.Error())
+	}
+
+	tpls, err := pkg.GetDESTemplateVersions(org, req.Name)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"templates": tpls})
+}
@@ -0,0 +1,272 @@
+package c001v001
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/leehayford/des/pkg"
+)
+
+func InitializeTransferRoutes(app, api *fiber.App) (err error) {
+
+	api.Route(DEV_XFER_ROUTE, func(router fiber.Router) {
+
+		/* SENDING DES */
+		router.Post("/", pkg.DesAuth, HandleTransferDevice)
+		router.Post("/retry", pkg.DesAuth, HandleRetryDeviceTransfer)
+		router.Post("/rollback", pkg.DesAuth, HandleRollBackDeviceTransfer)
+		router.Post("/list", pkg.DesAuth, HandleGetDeviceTransfers)
+
+		/* RECEIVING DES; CALLED BY THE SENDING DES */
+		router.Post("/prepare", pkg.DesAuth, HandlePrepareDeviceTransfer)
+		router.Post("/peer_status", pkg.DesAuth, HandleDeviceTransferPeerStatus)
+		router.Post("/import", pkg.DesAuth, HandleImportDeviceTransferJob)
+		router.Post("/complete", pkg.DesAuth, HandleCompleteDeviceTransfer)
+		router.Post("/cancel", pkg.DesAuth, HandleCancelDeviceTransfer)
+	})
+	return
+}
+
+/* SENDING DES **********************************************************************************/
+
+/* START TRANSFERRING A DEVICE TO ANOTHER DES; SEE TransferRequest */
+func HandleTransferDevice(c *fiber.Ctx) (err error) {
+	// fmt.Printf("\nHandleTransferDevice( )\n")
+
+	/* CHECK USER PERMISSION */
+	if !pkg.UserRole_Admin(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).
+			SendString(pkg.ERR_AUTH_ADMIN + ": Transfer devices")
+	}
+
+	/* PARSE AND VALIDATE REQUEST DATA */
+	req := TransferRequest{}
+	if err = pkg.ParseRequestBody(c, &req); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	device := Device{}
+	device.DESDevSerial = req.DESDevSerial
+	xfer, err := device.TransferDevice(req, c.IP(), c.Locals("sub").(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"transfer": &xfer})
+}
+
+type TransferIDRequest struct {
+	DESDevXferID int64 `json:"des_dev_xfer_id"`
+}
+
+/* RETRY A TRANSFER WHOSE EXPORT FAILED */
+func HandleRetryDeviceTransfer(c *fiber.Ctx) (err error) {
+
+	/* CHECK USER PERMISSION */
+	if !pkg.UserRole_Admin(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).
+			SendString(pkg.ERR_AUTH_ADMIN + ": Transfer devices")
+	}
+
+	/* PARSE AND VALIDATE REQUEST DATA */
+	req := TransferIDRequest{}
+	if err = pkg.ParseRequestBody(c, &req); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	xfer, err := ExportDeviceTransfer(req.DESDevXferID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"transfer": &xfer})
+}
+
+/* ROLL BACK A TRANSFER BEFORE ITS DEADLINE */
+func HandleRollBackDeviceTransfer(c *fiber.Ctx) (err error) {
+
+	/* CHECK USER PERMISSION */
+	if !pkg.UserRole_Admin(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).
+			SendString(pkg.ERR_AUTH_ADMIN + ": Transfer devices")
+	}
+
+	/* PARSE AND VALIDATE REQUEST DATA */
+	req := TransferIDRequest{}
+	if err = pkg.ParseRequestBody(c, &req); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	xfer, err := RollBackDeviceTransfer(req.DESDevXferID, fmt.Sprintf("Rolled back by %s", c.Locals("sub").(string)))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"transfer": &xfer})
+}
+
+/* RETURNS THE DEVICE'S TRANSFER HISTORY ON THIS DES, NEWEST FIRST */
+func HandleGetDeviceTransfers(c *fiber.Ctx) (err error) {
+
+	/* CHECK USER PERMISSION */
+	if !pkg.UserRole_Viewer(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).
+			SendString(pkg.ERR_AUTH_VIEWER + ": View device transfers")
+	}
+
+	/* PARSE AND VALIDATE REQUEST DATA */
+	device := Device{}
+	if err = ValidatePostRequestBody_Device(c, &device); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	xfers, err := pkg.GetDESDevTransfers(device.DESDevSerial)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"transfers": xfers})
+}
+
+/* RECEIVING DES ********************************************************************************/
+
+/* REGISTER AND CONNECT A DEVICE ANOTHER DES IS TRANSFERRING HERE */
+func HandlePrepareDeviceTransfer(c *fiber.Ctx) (err error) {
+	// fmt.Printf("\nHandlePrepareDeviceTransfer( )\n")
+
+	/* CHECK USER PERMISSION */
+	if !pkg.UserRole_Admin(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).
+			SendString(pkg.ERR_AUTH_ADMIN + ": Receive device transfers")
+	}
+
+	/* PARSE AND VALIDATE REQUEST DATA */
+	req := TransferPeerRequest{}
+	if err = pkg.ParseRequestBody(c, &req); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	xfer, err := PrepareDeviceTransfer(req, c.IP(), c.Locals("sub").(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"transfer": &xfer})
+}
+
+/* RETURNS THE DEVICE'S LATEST INBOUND TRANSFER */
+func HandleDeviceTransferPeerStatus(c *fiber.Ctx) (err error) {
+
+	/* CHECK USER PERMISSION */
+	if !pkg.UserRole_Admin(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).
+			SendString(pkg.ERR_AUTH_ADMIN + ": Receive device transfers")
+	}
+
+	/* PARSE AND VALIDATE REQUEST DATA */
+	req := TransferPeerRequest{}
+	if err = pkg.ParseRequestBody(c, &req); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	xfer, err := pkg.GetLatestDESDevTransfer(req.DESDev.DESDevSerial, pkg.DEV_XFER_IN)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"transfer": &xfer})
+}
+
+/*
+	WRITE A JOB DATABASE EXPORTED BY THE SENDING DES
+
+MULTIPART FORM: des_dev_serial, des_job ( JSON DESJob ), db ( SQLITE DATABASE )
+*/
+func HandleImportDeviceTransferJob(c *fiber.Ctx) (err error) {
+
+	/* CHECK USER PERMISSION */
+	if !pkg.UserRole_Admin(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).
+			SendString(pkg.ERR_AUTH_ADMIN + ": Receive device transfers")
+	}
+
+	/* PARSE AND VALIDATE REQUEST DATA */
+	job := pkg.DESJob{}
+	if err = json.Unmarshal([]byte(c.FormValue("des_job")), &job); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	fh, err := c.FormFile("db")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString("Job database is required")
+	}
+
+	/* SAVE THE UPLOAD ALONGSIDE THE JOB DATABASES UNTIL IT HAS BEEN READ */
+	dir := fmt.Sprintf("%s/%s", pkg.DATA_DIR, pkg.JOB_DB_DIR)
+	if err = os.MkdirAll(dir, os.ModePerm); err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+	tmp, err := os.CreateTemp(dir, "xfer_*.db")
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	if err = c.SaveFile(fh, tmp.Name()); err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+
+	sum, err := ImportDeviceTransferJob(c.FormValue("des_dev_serial"), job, tmp.Name())
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"summary": &sum})
+}
+
+/* THE SENDING DES HAS HANDED THE DEVICE OVER */
+func HandleCompleteDeviceTransfer(c *fiber.Ctx) (err error) {
+
+	/* CHECK USER PERMISSION */
+	if !pkg.UserRole_Admin(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).
+			SendString(pkg.ERR_AUTH_ADMIN + ": Receive device transfers")
+	}
+
+	/* PARSE AND VALIDATE REQUEST DATA */
+	req := TransferPeerRequest{}
+	if err = pkg.ParseRequestBody(c, &req); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	xfer, err := CompleteDeviceTransfer(req.DESDev.DESDevSerial)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"transfer": &xfer})
+}
+
+/* THE SENDING DES HAS ROLLED THE TRANSFER BACK */
+func HandleCancelDeviceTransfer(c *fiber.Ctx) (err error) {
+
+	/* CHECK USER PERMISSION */
+	if !pkg.UserRole_Admin(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).
+			SendString(pkg.ERR_AUTH_ADMIN + ": Receive device transfers")
+	}
+
+	/* PARSE AND VALIDATE REQUEST DATA */
+	req := TransferPeerRequest{}
+	if err = pkg.ParseRequestBody(c, &req); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	xfer, err := CancelDeviceTransfer(req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"transfer": &xfer})
+}
@@ -0,0 +1,28 @@
+package c001v001
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/leehayford/des/pkg"
+)
+
+func InitializeSampleWriterRoutes(app, api *fiber.App) (err error) {
+
+	api.Route(DEVICE_ROUTE+"/sample_writer", func(router fiber.Router) {
+
+		/* VIEWER */
+		router.Get("/list", pkg.DesAuth, HandleGetSampleWriterStats)
+	})
+	return
+}
+
+/* RETURNS THE QUEUE DEPTH, SPILL DEPTH AND FLUSH LATENCY OF EVERY OPEN SAMPLE WRITER */
+func HandleGetSampleWriterStats(c *fiber.Ctx) (err error) {
+
+	/* CHECK USER PERMISSION */
+	if !pkg.UserRole_Viewer(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).
+			SendString(pkg.ERR_AUTH_VIEWER + ": View sample writers")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"writers": GetSampleWriterStats()})
+}
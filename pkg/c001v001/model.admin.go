@@ -12,27 +12,29 @@ type Admin struct {
 	// AdmID int64 `gorm:"unique; primaryKey" json:"-"` // POSTGRESS
 	AdmID int64 `gorm:"autoIncrement" json:"-"` // SQLITE
 
-	AdmTime   int64  `gorm:"not null" json:"adm_time"`
-	AdmAddr   string `gorm:"varchar(36)" json:"adm_addr"`
-	AdmUserID string `gorm:"not null; varchar(36)" json:"adm_user_id"`
-	AdmApp    string `gorm:"varchar(36)" json:"adm_app"`
+	AdmTime   int64  `gorm:"not null" json:"adm_time" tlv:"1" flash:"0,8"`
+	AdmAddr   string `gorm:"varchar(36)" json:"adm_addr" tlv:"2" flash:"8,36"`
+	AdmUserID string `gorm:"not null; varchar(36)" json:"adm_user_id" tlv:"3" flash:"44,36"`
+	AdmApp    string `gorm:"varchar(36)" json:"adm_app" tlv:"4" flash:"80,36"`
+	AdmReqID  string `gorm:"varchar(36)" json:"-"` // DES requests: the correlation data sent with the CMD
+	AdmRepID  string `gorm:"varchar(36)" json:"-"` // Device replies: the AdmReqID of the request answered
 
 	/*BROKER*/
-	AdmDefHost string `gorm:"varchar(32)" json:"adm_def_host"`
-	AdmDefPort int32  `json:"adm_def_port"`
-	AdmOpHost  string `gorm:"varchar(32)" json:"adm_op_host"`
-	AdmOpPort  int32  `json:"adm_op_port"`
+	AdmDefHost string `gorm:"varchar(32)" json:"adm_def_host" tlv:"5" flash:"116,32" validate:"max=32"`
+	AdmDefPort int32  `json:"adm_def_port" tlv:"6" flash:"148,4" validate:"gte=0,lte=65535"`
+	AdmOpHost  string `gorm:"varchar(32)" json:"adm_op_host" tlv:"7" flash:"152,32" validate:"max=32"`
+	AdmOpPort  int32  `json:"adm_op_port" tlv:"8" flash:"184,4" validate:"gte=0,lte=65535"`
 
 	/*BATTERY ALARMS*/
-	AdmBatHiAmp  float32 `json:"adm_bat_hi_amp"`
-	AdmBatLoVolt float32 `json:"adm_bat_lo_volt"`
+	AdmBatHiAmp  float32 `json:"adm_bat_hi_amp" tlv:"9" flash:"188,4" validate:"gt=0"`
+	AdmBatLoVolt float32 `json:"adm_bat_lo_volt" tlv:"10" flash:"192,4" validate:"gt=0"`
 
 	/*MOTOR ALARMS*/
-	AdmMotHiAmp float32 `json:"adm_mot_hi_amp"`
+	AdmMotHiAmp float32 `json:"adm_mot_hi_amp" tlv:"11" flash:"196,4" validate:"gt=0"`
 
-	AdmPress    float32 `json:"adm_press"`     // 6991.3 kPa (1014 psia)
-	AdmPressMin float32 `json:"adm_press_min"` // 689.5 kPa (100 psia)
-	AdmPressMax float32 `json:"adm_press_max"` // 6991.3 kPa (1014 psia)
+	AdmPress    float32 `json:"adm_press" tlv:"12" flash:"200,4" validate:"gtfield=AdmPressMin,ltefield=AdmPressMax"` // 6991.3 kPa (1014 psia)
+	AdmPressMin float32 `json:"adm_press_min" tlv:"13" flash:"204,4" validate:"gte=0,ltfield=AdmPressMax"`            // 689.5 kPa (100 psia)
+	AdmPressMax float32 `json:"adm_press_max" tlv:"14" flash:"208,4"`                                                 // 6991.3 kPa (1014 psia)
 
 	// /* POSTURE - NOT IMPLEMENTED */
 	// AdmTiltTgt float32 `json:"adm_tilt_tgt"` // 90.0 °
@@ -41,26 +43,26 @@ type Admin struct {
 	// AdmAzimMgn float32 `json:"adm_azim_mgn"` // 3.0 °
 
 	/* HIGH FLOW SENSOR ( HFS )*/
-	AdmHFSFlow     float32 `json:"adm_hfs_flow"`      // 200.0 L/min
-	AdmHFSFlowMin  float32 `json:"adm_hfs_flow_min"`  // 150.0 L/min
-	AdmHFSFlowMax  float32 `json:"adm_hfs_flow_max"`  //  250.0 L/min
-	AdmHFSPress    float32 `json:"adm_hfs_press"`     // 1103.1 kPa (160 psia)
-	AdmHFSPressMin float32 `json:"adm_hfs_press_min"` // 158.6 kPa (23 psia)
-	AdmHFSPressMax float32 `json:"adm_hfs_press_max"` // 1378.9 kPa (200 psia)
-	AdmHFSDiff     float32 `json:"adm_hfs_diff"`      // 448.2 kPa (65 psia)
-	AdmHFSDiffMin  float32 `json:"adm_hfs_diff_min"`  // 68.9 kPa (10 psia)
-	AdmHFSDiffMax  float32 `json:"adm_hfs_diff_max"`  // 517.1 kPa (75 psia)
+	AdmHFSFlow     float32 `json:"adm_hfs_flow" tlv:"15" flash:"212,4" validate:"gtfield=AdmHFSFlowMin,ltefield=AdmHFSFlowMax"`    // 200.0 L/min
+	AdmHFSFlowMin  float32 `json:"adm_hfs_flow_min" tlv:"16" flash:"216,4" validate:"gte=0,ltfield=AdmHFSFlowMax"`                 // 150.0 L/min
+	AdmHFSFlowMax  float32 `json:"adm_hfs_flow_max" tlv:"17" flash:"220,4"`                                                        //  250.0 L/min
+	AdmHFSPress    float32 `json:"adm_hfs_press" tlv:"18" flash:"224,4" validate:"gtfield=AdmHFSPressMin,ltefield=AdmHFSPressMax"` // 1103.1 kPa (160 psia)
+	AdmHFSPressMin float32 `json:"adm_hfs_press_min" tlv:"19" flash:"228,4" validate:"gte=0,ltfield=AdmHFSPressMax"`               // 158.6 kPa (23 psia)
+	AdmHFSPressMax float32 `json:"adm_hfs_press_max" tlv:"20" flash:"232,4"`                                                       // 1378.9 kPa (200 psia)
+	AdmHFSDiff     float32 `json:"adm_hfs_diff" tlv:"21" flash:"236,4" validate:"gtfield=AdmHFSDiffMin,ltefield=AdmHFSDiffMax"`    // 448.2 kPa (65 psia)
+	AdmHFSDiffMin  float32 `json:"adm_hfs_diff_min" tlv:"22" flash:"240,4" validate:"gte=0,ltfield=AdmHFSDiffMax"`                 // 68.9 kPa (10 psia)
+	AdmHFSDiffMax  float32 `json:"adm_hfs_diff_max" tlv:"23" flash:"244,4"`                                                        // 517.1 kPa (75 psia)
 
 	/* LOW FLOW SENSOR ( LFS )*/
-	AdmLFSFlow     float32 `json:"adm_lfs_flow"`      // 1.85 L/min
-	AdmLFSFlowMin  float32 `json:"adm_lfs_flow_min"`  // 0.5 L/min
-	AdmLFSFlowMax  float32 `json:"adm_lfs_flow_max"`  // 2.0 L/min
-	AdmLFSPress    float32 `json:"adm_lfs_press"`     // 413.7 kPa (60 psia)
-	AdmLFSPressMin float32 `json:"adm_lfs_press_min"` // 137.9 kPa (20 psia)
-	AdmLFSPressMax float32 `json:"adm_lfs_press_max"` // 551.5 kPa (80 psia)
-	AdmLFSDiff     float32 `json:"adm_lfs_diff"`      // 62.0 kPa (9 psia)
-	AdmLFSDiffMin  float32 `json:"adm_lfs_diff_min"`  // 13.8 kPa (2 psia)
-	AdmLFSDiffMax  float32 `json:"adm_lfs_diff_max"`  // 68.9 kPa (10 psia)
+	AdmLFSFlow     float32 `json:"adm_lfs_flow" tlv:"24" flash:"248,4" validate:"gtfield=AdmLFSFlowMin,ltefield=AdmLFSFlowMax"`    // 1.85 L/min
+	AdmLFSFlowMin  float32 `json:"adm_lfs_flow_min" tlv:"25" flash:"252,4" validate:"gte=0,ltfield=AdmLFSFlowMax"`                 // 0.5 L/min
+	AdmLFSFlowMax  float32 `json:"adm_lfs_flow_max" tlv:"26" flash:"256,4"`                                                        // 2.0 L/min
+	AdmLFSPress    float32 `json:"adm_lfs_press" tlv:"27" flash:"260,4" validate:"gtfield=AdmLFSPressMin,ltefield=AdmLFSPressMax"` // 413.7 kPa (60 psia)
+	AdmLFSPressMin float32 `json:"adm_lfs_press_min" tlv:"28" flash:"264,4" validate:"gte=0,ltfield=AdmLFSPressMax"`               // 137.9 kPa (20 psia)
+	AdmLFSPressMax float32 `json:"adm_lfs_press_max" tlv:"29" flash:"268,4"`                                                       // 551.5 kPa (80 psia)
+	AdmLFSDiff     float32 `json:"adm_lfs_diff" tlv:"30" flash:"272,4" validate:"gtfield=AdmLFSDiffMin,ltefield=AdmLFSDiffMax"`    // 62.0 kPa (9 psia)
+	AdmLFSDiffMin  float32 `json:"adm_lfs_diff_min" tlv:"31" flash:"276,4" validate:"gte=0,ltfield=AdmLFSDiffMax"`                 // 13.8 kPa (2 psia)
+	AdmLFSDiffMax  float32 `json:"adm_lfs_diff_max" tlv:"32" flash:"280,4"`                                                        // 68.9 kPa (10 psia)
 }
 
 func WriteADM(adm Admin, jdbc *pkg.JobDBClient) (err error) {
@@ -99,92 +101,17 @@ ADMIN - AS STORED IN DEVICE FLASH
 */
 func (adm Admin) AdminToBytes() (out []byte) {
 
-	out = append(out, pkg.Int64ToBytes(adm.AdmTime)...)
-	out = append(out, pkg.StringToNBytes(adm.AdmAddr, 36)...)
-	out = append(out, pkg.StringToNBytes(adm.AdmUserID, 36)...)
-	out = append(out, pkg.StringToNBytes(adm.AdmApp, 36)...)
-
-	out = append(out, pkg.StringToNBytes(adm.AdmDefHost, 32)...)
-	out = append(out, pkg.Int32ToBytes(adm.AdmDefPort)...)
-	out = append(out, pkg.StringToNBytes(adm.AdmOpHost, 32)...)
-	out = append(out, pkg.Int32ToBytes(adm.AdmOpPort)...)
-
-	out = append(out, pkg.Float32ToBytes(adm.AdmBatHiAmp)...)
-	out = append(out, pkg.Float32ToBytes(adm.AdmBatLoVolt)...)
-
-	out = append(out, pkg.Float32ToBytes(adm.AdmMotHiAmp)...)
-
-	out = append(out, pkg.Float32ToBytes(adm.AdmPress)...)
-	out = append(out, pkg.Float32ToBytes(adm.AdmPressMin)...)
-	out = append(out, pkg.Float32ToBytes(adm.AdmPressMax)...)
-
-	out = append(out, pkg.Float32ToBytes(adm.AdmHFSFlow)...)
-	out = append(out, pkg.Float32ToBytes(adm.AdmHFSFlowMin)...)
-	out = append(out, pkg.Float32ToBytes(adm.AdmHFSFlowMax)...)
-	out = append(out, pkg.Float32ToBytes(adm.AdmHFSPress)...)
-	out = append(out, pkg.Float32ToBytes(adm.AdmHFSPressMin)...)
-	out = append(out, pkg.Float32ToBytes(adm.AdmHFSPressMax)...)
-	out = append(out, pkg.Float32ToBytes(adm.AdmHFSDiff)...)
-	out = append(out, pkg.Float32ToBytes(adm.AdmHFSDiffMin)...)
-	out = append(out, pkg.Float32ToBytes(adm.AdmHFSDiffMax)...)
-
-	out = append(out, pkg.Float32ToBytes(adm.AdmLFSFlow)...)
-	out = append(out, pkg.Float32ToBytes(adm.AdmLFSFlowMin)...)
-	out = append(out, pkg.Float32ToBytes(adm.AdmLFSFlowMax)...)
-	out = append(out, pkg.Float32ToBytes(adm.AdmLFSPress)...)
-	out = append(out, pkg.Float32ToBytes(adm.AdmLFSPressMin)...)
-	out = append(out, pkg.Float32ToBytes(adm.AdmLFSPressMax)...)
-	out = append(out, pkg.Float32ToBytes(adm.AdmLFSDiff)...)
-	out = append(out, pkg.Float32ToBytes(adm.AdmLFSDiffMin)...)
-	out = append(out, pkg.Float32ToBytes(adm.AdmLFSDiffMax)...)
-
+	out, err := FLASH_ADM_LAYOUT.Encode(adm)
+	if err != nil {
+		pkg.LogErr(err)
+	}
 	return
 }
 func (adm *Admin) AdminFromBytes(b []byte) {
 
-	adm = &Admin{
-
-		AdmTime:   pkg.BytesToInt64_L(b[0:8]),
-		AdmAddr:   pkg.StrBytesToString(b[8:44]),
-		AdmUserID: pkg.StrBytesToString(b[44:80]),
-		AdmApp:    pkg.StrBytesToString(b[80:116]),
-
-		AdmDefHost: pkg.StrBytesToString(b[116:148]),
-		AdmDefPort: pkg.BytesToInt32_L(b[148:152]),
-		AdmOpHost:  pkg.StrBytesToString(b[152:184]),
-		AdmOpPort:  pkg.BytesToInt32_L(b[184:188]),
-
-		AdmBatHiAmp:  pkg.BytesToFloat32_L(b[188:192]),
-		AdmBatLoVolt: pkg.BytesToFloat32_L(b[192:196]),
-
-		AdmMotHiAmp: pkg.BytesToFloat32_L(b[196:200]),
-
-		AdmPress:    pkg.BytesToFloat32_L(b[196:200]),
-		AdmPressMin: pkg.BytesToFloat32_L(b[200:204]),
-		AdmPressMax: pkg.BytesToFloat32_L(b[204:208]),
-
-		AdmHFSFlow:     pkg.BytesToFloat32_L(b[208:212]),
-		AdmHFSFlowMin:  pkg.BytesToFloat32_L(b[212:216]),
-		AdmHFSFlowMax:  pkg.BytesToFloat32_L(b[216:220]),
-		AdmHFSPress:    pkg.BytesToFloat32_L(b[220:224]),
-		AdmHFSPressMin: pkg.BytesToFloat32_L(b[224:228]),
-		AdmHFSPressMax: pkg.BytesToFloat32_L(b[228:232]),
-		AdmHFSDiff:     pkg.BytesToFloat32_L(b[232:236]),
-		AdmHFSDiffMin:  pkg.BytesToFloat32_L(b[236:240]),
-		AdmHFSDiffMax:  pkg.BytesToFloat32_L(b[244:248]),
-
-		AdmLFSFlow:     pkg.BytesToFloat32_L(b[248:252]),
-		AdmLFSFlowMin:  pkg.BytesToFloat32_L(b[252:256]),
-		AdmLFSFlowMax:  pkg.BytesToFloat32_L(b[256:260]),
-		AdmLFSPress:    pkg.BytesToFloat32_L(b[260:264]),
-		AdmLFSPressMin: pkg.BytesToFloat32_L(b[264:268]),
-		AdmLFSPressMax: pkg.BytesToFloat32_L(b[268:272]),
-		AdmLFSDiff:     pkg.BytesToFloat32_L(b[272:276]),
-		AdmLFSDiffMin:  pkg.BytesToFloat32_L(b[276:280]),
-		AdmLFSDiffMax:  pkg.BytesToFloat32_L(b[280:284]),
+	if err := FLASH_ADM_LAYOUT.Decode(b, adm); err != nil {
+		pkg.LogErr(err)
 	}
-	//  pkg.Json("(demo *DemoDeviceClient)MakeAdmFromBytes() -> adm", adm)
-	return
 }
 
 /*
@@ -271,9 +198,10 @@ func (adm *Admin) CMDValidate(device *Device, uid string) (err error) {
 
 	src := adm.GetMessageSource()
 	dev_src := device.ReferenceSRC()
-	if err = src.ValidateSRC_CMD(dev_src, uid, adm); err != nil {
+	if err = src.ValidateSRC_CMD(dev_src, uid, device.TimePolicy(), adm); err != nil {
 		return
 	}
+	adm.AdmTime = src.Time
 
 	return
 }
@@ -281,13 +209,19 @@ func (adm *Admin) CMDValidate(device *Device, uid string) (err error) {
 /*
 ADMIN - VALIDATE MQTT SIG FROM DEVICE
 */
-func (adm *Admin) SIGValidate(device *Device) (err error) {
+func (adm *Admin) SIGValidate(device *Device, req *pkg.MQTTPendingRequest) (err error) {
 
 	src := adm.GetMessageSource()
 	dev_src := device.ReferenceSRC()
-	if err = src.ValidateSRC_SIG(dev_src, adm); err != nil {
+	if err = src.ValidateSRC_SIG(dev_src, device.TimePolicy(), req, adm); err != nil {
 		return
 	}
+	adm.AdmTime = src.Time
+
+	/* A REPLY IS PAIRED WITH ITS REQUEST BY CORRELATION DATA ( SEE GetHistory ) */
+	if req != nil {
+		adm.AdmRepID = req.CorrelationData
+	}
 
 	adm.Validate()
 
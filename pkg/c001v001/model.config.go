@@ -1,6 +1,7 @@
 package c001v001
 
 import (
+	"fmt"
 	"sync"
 	"github.com/leehayford/des/pkg"
 )
@@ -12,33 +13,40 @@ type Config struct {
 	// CfgID int64 `gorm:"unique; primaryKey" json:"-"`	// POSTGRESS
 	CfgID int64 `gorm:"autoIncrement" json:"-"` // SQLITE
 
-	CfgTime   int64  `gorm:"not null" json:"cfg_time"`
-	CfgAddr   string `gorm:"varchar(36)" json:"cfg_addr"`
-	CfgUserID string `gorm:"not null; varchar(36)" json:"cfg_user_id"`
-	CfgApp    string `gorm:"varchar(36)" json:"cfg_app"`
+	CfgTime   int64  `gorm:"not null" json:"cfg_time" tlv:"1" flash:"0,8"`
+	CfgAddr   string `gorm:"varchar(36)" json:"cfg_addr" tlv:"2" flash:"8,36"`
+	CfgUserID string `gorm:"not null; varchar(36)" json:"cfg_user_id" tlv:"3" flash:"44,36"`
+	CfgApp    string `gorm:"varchar(36)" json:"cfg_app" tlv:"4" flash:"80,36"`
+	CfgReqID  string `gorm:"varchar(36)" json:"-"` // DES requests: the correlation data sent with the CMD
+	CfgRepID  string `gorm:"varchar(36)" json:"-"` // Device replies: the CfgReqID of the request answered
 
 	/*JOB*/
-	CfgSCVD     float32 `json:"cfg_scvd"`
-	CfgSCVDMult float32 `json:"cfg_scvd_mult"`
-	CfgSSPRate  float32 `json:"cfg_ssp_rate"`
-	CfgSSPDur   int32   `json:"cfg_ssp_dur"`
-	CfgHiSCVF   float32 `json:"cfg_hi_scvf"`
-	CfgFlowTog  float32 `json:"cfg_flow_tog"`
-	CfgSSCVFDur int32   `json:"cfg_sscvf_dur"`
+	CfgSCVD     float32 `json:"cfg_scvd" tlv:"5" flash:"116,4" validate:"gt=0"`
+	CfgSCVDMult float32 `json:"cfg_scvd_mult" tlv:"6" flash:"120,4" validate:"gt=0"`
+	CfgSSPRate  float32 `json:"cfg_ssp_rate" tlv:"7" flash:"124,4" validate:"gte=0"`
+	CfgSSPDur   int32   `json:"cfg_ssp_dur" tlv:"8" flash:"128,4" validate:"gtefield=CfgOpLog"`
+	CfgHiSCVF   float32 `json:"cfg_hi_scvf" tlv:"9" flash:"132,4" validate:"gt=0"`
+	CfgFlowTog  float32 `json:"cfg_flow_tog" tlv:"10" flash:"136,4" validate:"gte=0"` // 0: automatic flow sensor change disabled
+	CfgSSCVFDur int32   `json:"cfg_sscvf_dur" tlv:"11" flash:"140,4" validate:"gtefield=CfgOpLog"`
 
 	/*VALVE*/
-	CfgVlvTgt int32 `json:"cfg_vlv_tgt"`
-	CfgVlvPos int32 `json:"cfg_vlv_pos"`
+	CfgVlvTgt int32 `json:"cfg_vlv_tgt" tlv:"12" flash:"144,4" validate:"oneof=0 2 4 6"`
+	CfgVlvPos int32 `json:"cfg_vlv_pos" tlv:"13" flash:"148,4"`
 
 	/*OP PERIODS*/
-	CfgOpSample int32 `json:"cfg_op_sample"`
-	CfgOpLog    int32 `json:"cfg_op_log"`
-	CfgOpTrans  int32 `json:"cfg_op_trans"`
+	CfgOpSample int32 `json:"cfg_op_sample" tlv:"14" flash:"152,4" validate:"min_sample_period"`
+	CfgOpLog    int32 `json:"cfg_op_log" tlv:"15" flash:"156,4" validate:"multiplefield=CfgOpSample"`
+	CfgOpTrans  int32 `json:"cfg_op_trans" tlv:"16" flash:"160,4" validate:"multiplefield=CfgOpSample"`
 
 	/*DIAG PERIODS*/
-	CfgDiagSample int32 `json:"cfg_diag_sample"`
-	CfgDiagLog    int32 `json:"cfg_diag_log"`
-	CfgDiagTrans  int32 `json:"cfg_diag_trans"`
+	CfgDiagSample int32 `json:"cfg_diag_sample" tlv:"17" flash:"164,4" validate:"min_sample_period"`
+	CfgDiagLog    int32 `json:"cfg_diag_log" tlv:"18" flash:"168,4" validate:"multiplefield=CfgDiagSample"`
+	CfgDiagTrans  int32 `json:"cfg_diag_trans" tlv:"19" flash:"172,4" validate:"multiplefield=CfgDiagSample"`
+}
+
+/* min_sample_period: SAMPLE PERIODS OF AT LEAST MIN_SAMPLE_PERIOD */
+func init() {
+	pkg.RegisterValidationAlias("min_sample_period", fmt.Sprintf("gte=%d", MIN_SAMPLE_PERIOD))
 }
 
 func WriteCFG(cfg Config, jdbc *pkg.JobDBClient) (err error) {
@@ -76,62 +84,17 @@ CONFIG - AS STORED IN DEVICE FLASH
 */
 func (cfg Config) ConfigToBytes() (out []byte) {
 
-	out = append(out, pkg.Int64ToBytes(cfg.CfgTime)...)
-	out = append(out, pkg.StringToNBytes(cfg.CfgAddr, 36)...)
-	out = append(out, pkg.StringToNBytes(cfg.CfgUserID, 36)...)
-	out = append(out, pkg.StringToNBytes(cfg.CfgApp, 36)...)
-
-	out = append(out, pkg.Float32ToBytes(cfg.CfgSCVD)...)
-	out = append(out, pkg.Float32ToBytes(cfg.CfgSCVDMult)...)
-	out = append(out, pkg.Float32ToBytes(cfg.CfgSSPRate)...)
-	out = append(out, pkg.Int32ToBytes(cfg.CfgSSPDur)...)
-	out = append(out, pkg.Float32ToBytes(cfg.CfgHiSCVF)...)
-	out = append(out, pkg.Float32ToBytes(cfg.CfgFlowTog)...)
-	out = append(out, pkg.Int32ToBytes(cfg.CfgSSCVFDur)...)
-
-	out = append(out, pkg.Int32ToBytes(cfg.CfgVlvTgt)...)
-	out = append(out, pkg.Int32ToBytes(cfg.CfgVlvPos)...)
-
-	out = append(out, pkg.Int32ToBytes(cfg.CfgOpSample)...)
-	out = append(out, pkg.Int32ToBytes(cfg.CfgOpLog)...)
-	out = append(out, pkg.Int32ToBytes(cfg.CfgOpTrans)...)
-
-	out = append(out, pkg.Int32ToBytes(cfg.CfgDiagSample)...)
-	out = append(out, pkg.Int32ToBytes(cfg.CfgDiagLog)...)
-	out = append(out, pkg.Int32ToBytes(cfg.CfgDiagTrans)...)
-
+	out, err := FLASH_CFG_LAYOUT.Encode(cfg)
+	if err != nil {
+		pkg.LogErr(err)
+	}
 	return
 }
 func (cfg *Config) ConfigFromBytes(b []byte) {
 
-	cfg = &Config{
-
-		CfgTime:   pkg.BytesToInt64_L(b[0:8]),
-		CfgAddr:   pkg.StrBytesToString(b[8:44]),
-		CfgUserID: pkg.StrBytesToString(b[44:80]),
-		CfgApp:    pkg.StrBytesToString(b[80:116]),
-
-		CfgSCVD:     pkg.BytesToFloat32_L(b[116:120]),
-		CfgSCVDMult: pkg.BytesToFloat32_L(b[120:124]),
-		CfgSSPRate:  pkg.BytesToFloat32_L(b[124:128]),
-		CfgSSPDur:   pkg.BytesToInt32_L(b[128:132]),
-		CfgHiSCVF:   pkg.BytesToFloat32_L(b[132:136]),
-		CfgFlowTog:  pkg.BytesToFloat32_L(b[136:140]),
-		CfgSSCVFDur: pkg.BytesToInt32_L(b[140:144]),
-
-		CfgVlvTgt: pkg.BytesToInt32_L(b[144:148]),
-		CfgVlvPos: pkg.BytesToInt32_L(b[148:152]),
-
-		CfgOpSample: pkg.BytesToInt32_L(b[152:156]),
-		CfgOpLog:    pkg.BytesToInt32_L(b[156:160]),
-		CfgOpTrans:  pkg.BytesToInt32_L(b[160:164]),
-
-		CfgDiagSample: pkg.BytesToInt32_L(b[164:168]),
-		CfgDiagLog:    pkg.BytesToInt32_L(b[168:172]),
-		CfgDiagTrans:  pkg.BytesToInt32_L(b[172:176]),
+	if err := FLASH_CFG_LAYOUT.Decode(b, cfg); err != nil {
+		pkg.LogErr(err)
 	}
-	//  pkg.Json("(demo *DemoDeviceClient)MakeCfgFromBytes() -> cfg", cfg)
-	return
 }
 
 /*
@@ -216,21 +179,28 @@ func (cfg *Config) CMDValidate(device *Device, uid string) (err error) {
 
 	src := cfg.GetMessageSource()
 	dev_src := device.ReferenceSRC()
-	if err = src.ValidateSRC_CMD(dev_src, uid, cfg); err != nil {
+	if err = src.ValidateSRC_CMD(dev_src, uid, device.TimePolicy(), cfg); err != nil {
 		return
 	}
+	cfg.CfgTime = src.Time
 
 	return
 }
 
 /* CONFIG - VALIDATE MQTT SIG FROM DEVICE */
-func (cfg *Config) SIGValidate(device *Device) (err error) {
+func (cfg *Config) SIGValidate(device *Device, req *pkg.MQTTPendingRequest) (err error) {
 
 	src := cfg.GetMessageSource()
 	dev_src := device.ReferenceSRC()
-	if err = src.ValidateSRC_SIG(dev_src, cfg); err != nil {
+	if err = src.ValidateSRC_SIG(dev_src, device.TimePolicy(), req, cfg); err != nil {
 		return
 	}
+	cfg.CfgTime = src.Time
+
+	/* A REPLY IS PAIRED WITH ITS REQUEST BY CORRELATION DATA ( SEE GetHistory ) */
+	if req != nil {
+		cfg.CfgRepID = req.CorrelationData
+	}
 
 	cfg.Validate()
 
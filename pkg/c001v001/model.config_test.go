@@ -0,0 +1,93 @@
+package c001v001
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/leehayford/des/pkg"
+)
+
+/* THE FIELDS ( Type.Field ) WHOSE `validate` RULES mod FAILS */
+func testInvalidFields(t *testing.T, mod interface{}) (fields []string) {
+	t.Helper()
+	err := pkg.ValidateModel(mod)
+	if err == nil {
+		return
+	}
+	verrs := pkg.ValidationErrors{}
+	if !errors.As(err, &verrs) {
+		t.Fatalf("%v is not ValidationErrors", err)
+	}
+	for _, e := range verrs {
+		fields = append(fields, e.Field)
+	}
+	return
+}
+
+func TestConfigValidationRules(t *testing.T) {
+	for _, c := range []struct {
+		name  string
+		edit  func(cfg *Config)
+		field string
+	}{
+		{"defaults", func(cfg *Config) {}, ""},
+		{"flow sensor change disabled", func(cfg *Config) { cfg.CfgFlowTog = 0 }, ""},
+		{"negative flow sensor change", func(cfg *Config) { cfg.CfgFlowTog = -1 }, "Config.CfgFlowTog"},
+		{"sample below minimum", func(cfg *Config) { cfg.CfgOpSample = MIN_SAMPLE_PERIOD - 1; cfg.CfgOpLog = 0; cfg.CfgOpTrans = 0 }, "Config.CfgOpSample"},
+		{"log not a multiple of sample", func(cfg *Config) { cfg.CfgOpLog = 1500 }, "Config.CfgOpLog"},
+		{"trans not a multiple of sample", func(cfg *Config) { cfg.CfgDiagTrans = 15000 }, "Config.CfgDiagTrans"},
+		{"SSP duration shorter than log", func(cfg *Config) { cfg.CfgSSPDur = cfg.CfgOpLog - 1 }, "Config.CfgSSPDur"},
+		{"unknown valve target", func(cfg *Config) { cfg.CfgVlvTgt = 3 }, "Config.CfgVlvTgt"},
+	} {
+		cfg := Config{}
+		cfg.DefaultSettings_Config(pkg.DESRegistration{})
+		c.edit(&cfg)
+		fields := testInvalidFields(t, &cfg)
+		if c.field == "" && len(fields) > 0 {
+			t.Errorf("%s: rejected %v", c.name, fields)
+		}
+		if c.field != "" && (len(fields) != 1 || fields[0] != c.field) {
+			t.Errorf("%s: rejected %v; want [%s]", c.name, fields, c.field)
+		}
+	}
+}
+
+func TestAdminValidationRules(t *testing.T) {
+	for _, c := range []struct {
+		name  string
+		edit  func(adm *Admin)
+		field string
+	}{
+		{"defaults", func(adm *Admin) {}, ""},
+		{"pressure at max", func(adm *Admin) { adm.AdmPress = adm.AdmPressMax }, ""},
+		{"pressure above max", func(adm *Admin) { adm.AdmPress = adm.AdmPressMax + 1 }, "Admin.AdmPress"},
+		{"flow at min", func(adm *Admin) { adm.AdmHFSFlow = adm.AdmHFSFlowMin }, "Admin.AdmHFSFlow"},
+		{"port out of range", func(adm *Admin) { adm.AdmOpPort = 65536 }, "Admin.AdmOpPort"},
+	} {
+		adm := Admin{}
+		adm.DefaultSettings_Admin(pkg.DESRegistration{})
+		c.edit(&adm)
+		fields := testInvalidFields(t, &adm)
+		if c.field == "" && len(fields) > 0 {
+			t.Errorf("%s: rejected %v", c.name, fields)
+		}
+		if c.field != "" && (len(fields) != 1 || fields[0] != c.field) {
+			t.Errorf("%s: rejected %v; want [%s]", c.name, fields, c.field)
+		}
+	}
+}
+
+func TestHeaderValidationRules(t *testing.T) {
+	hdr := Header{}
+	hdr.DefaultSettings_Header(pkg.DESRegistration{})
+	if fields := testInvalidFields(t, &hdr); len(fields) > 0 {
+		t.Fatalf("defaults rejected %v", fields)
+	}
+
+	hdr.HdrGeoLat = 91
+	hdr.HdrWellName = "A WELL NAME LONGER THAN THIRTY-TWO CHARACTERS"
+	fields := testInvalidFields(t, &hdr)
+	if len(fields) != 2 || fields[0] != "Header.HdrWellName" || fields[1] != "Header.HdrGeoLat" {
+		t.Fatalf("rejected %v; want [Header.HdrWellName Header.HdrGeoLat]", fields)
+	}
+}
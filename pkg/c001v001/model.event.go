@@ -1,6 +1,7 @@
 package c001v001
 
 import (
+	"fmt"
 	"sync"
 	"github.com/leehayford/des/pkg"
 )
@@ -12,14 +13,14 @@ type Event struct {
 	// EvtID   int64  `gorm:"unique; primaryKey" json:"-"` // POSTGRES
 	EvtID int64 `gorm:"autoIncrement" json:"-"` // SQLITE
 
-	EvtTime   int64  `gorm:"not null" json:"evt_time"`
-	EvtAddr   string `gorm:"varchar(36)" json:"evt_addr"`
-	EvtUserID string `gorm:"not null; varchar(36)" json:"evt_user_id"`
-	EvtApp    string `gorm:"varchar(36)" json:"evt_app"`
+	EvtTime   int64  `gorm:"not null" json:"evt_time" tlv:"1" flash:"0,8"`
+	EvtAddr   string `gorm:"varchar(36)" json:"evt_addr" tlv:"2" flash:"8,36"`
+	EvtUserID string `gorm:"not null; varchar(36)" json:"evt_user_id" tlv:"3" flash:"44,36"`
+	EvtApp    string `gorm:"varchar(36)" json:"evt_app" tlv:"4" flash:"80,36"`
 
-	EvtCode  int32    `json:"evt_code"`
-	EvtTitle string   `gorm:"varchar(36)" json:"evt_title"`
-	EvtMsg   string   `gorm:"varchar(512)" json:"evt_msg"`
+	EvtCode  int32    `json:"evt_code" tlv:"5" flash:"116,4"`
+	EvtTitle string   `gorm:"varchar(36)" json:"evt_title" tlv:"6" flash:"120,36"`
+	EvtMsg   string   `gorm:"varchar(512)" json:"evt_msg" tlv:"7" flash:"156,512"`
 	EvtType  EventTyp `gorm:"foreignKey:EvtCode; references:EvtTypCode" json:"-"`
 }
 
@@ -58,32 +59,17 @@ EVENT - AS STORED IN DEVICE FLASH
 */
 func (evt Event) EventToBytes() (out []byte) {
 
-	out = append(out, pkg.Int64ToBytes(evt.EvtTime)...)
-	out = append(out, pkg.StringToNBytes(evt.EvtAddr, 36)...)
-	out = append(out, pkg.StringToNBytes(evt.EvtUserID, 36)...)
-	out = append(out, pkg.StringToNBytes(evt.EvtApp, 36)...)
-
-	out = append(out, pkg.Int32ToBytes(evt.EvtCode)...)
-	out = append(out, pkg.StringToNBytes(evt.EvtTitle, 36)...)
-	out = append(out, pkg.StringToNBytes(evt.EvtMsg, len(evt.EvtMsg))...)
-
+	out, err := FLASH_EVT_LAYOUT.Encode(evt)
+	if err != nil {
+		pkg.LogErr(err)
+	}
 	return
 }
 func (evt *Event) EventFromBytes(b []byte) {
 
-	evt = &Event{
-
-		EvtTime:   pkg.BytesToInt64_L(b[0:8]),
-		EvtAddr:   pkg.StrBytesToString(b[8:44]),
-		EvtUserID: pkg.StrBytesToString(b[44:80]),
-		EvtApp:    pkg.StrBytesToString(b[80:116]),
-
-		EvtCode:  pkg.BytesToInt32_L(b[116:120]),
-		EvtTitle: pkg.StrBytesToString(b[120:156]),
-		EvtMsg:   pkg.StrBytesToString(b[156:]),
+	if err := FLASH_EVT_LAYOUT.Decode(b, evt); err != nil {
+		pkg.LogErr(err)
 	}
-	//  pkg.Json("(demo *DemoDeviceClient)MakeEvtFromBytes() -> evt", evt)
-	return
 }
 
 /*
@@ -131,18 +117,23 @@ func (evt *Event) CMDValidate(device *Device, uid string) (err error) {
 
 	src := evt.GetMessageSource()
 	dev_src := device.ReferenceSRC()
-	if err = src.ValidateSRC_CMD(dev_src, uid, evt); err != nil {
+	if err = src.ValidateSRC_CMD(dev_src, uid, device.TimePolicy(), evt); err != nil {
 		return
 	}
+	evt.EvtTime = src.Time
 
 	/* USERS CAN NOT SEND RESPONSE CODES TO THE DEVICE */
 	switch evt.EvtCode {
-	case OP_CODE_DES_REGISTERED:
-	case OP_CODE_JOB_ENDED:
-	case OP_CODE_JOB_STARTED:
-	case OP_CODE_GPS_ACQ:
-		_, err = pkg.LogDESError(uid, pkg.ERR_INVALID_SRC_OP_CODE_CMD, evt)
-		return
+	case OP_CODE_DES_REGISTERED,
+		OP_CODE_JOB_ENDED,
+		OP_CODE_JOB_STARTED,
+		OP_CODE_GPS_ACQ,
+		OP_CODE_FW_PROGRESS,
+		OP_CODE_FW_RECEIVED,
+		OP_CODE_FW_INSTALLED,
+		OP_CODE_FW_FAILED:
+		pkg.LogDESError(uid, pkg.ERR_INVALID_SRC_OP_CODE_CMD, evt)
+		return fmt.Errorf(pkg.ERR_INVALID_SRC_OP_CODE_CMD)
 	}
 
 	return
@@ -151,13 +142,14 @@ func (evt *Event) CMDValidate(device *Device, uid string) (err error) {
 /*
 EVENT - VALIDATE MQTT SIG FROM DEVICE
 */
-func (evt *Event) SIGValidate(device *Device) (err error) {
+func (evt *Event) SIGValidate(device *Device, req *pkg.MQTTPendingRequest) (err error) {
 
 	src := evt.GetMessageSource()
 	dev_src := device.ReferenceSRC()
-	if err = src.ValidateSRC_SIG(dev_src, evt); err != nil {
+	if err = src.ValidateSRC_SIG(dev_src, device.TimePolicy(), req, evt); err != nil {
 		return
 	}
+	evt.EvtTime = src.Time
 
 	if evt.EvtCode > MAX_OP_CODE {
 		if (evt.EvtCode <= MAX_STATUS_CODE) && evt.EvtUserID != dev_src.UserID {
@@ -217,6 +209,11 @@ var EVENT_TYPES = []EventTyp{
 	{EvtTypCode: OP_CODE_JOB_OFFLINE_START, EvtTypName: "JOB STARTED OFFLINE"},
 	{EvtTypCode: OP_CODE_JOB_OFFLINE_END, EvtTypName: "JOB ENDED OFFLINE"},
 	{EvtTypCode: OP_CODE_GPS_ACQ, EvtTypName: "DEVICE ACQUIRING GPS"},
+	{EvtTypCode: OP_CODE_FW_UPDATE_REQ, EvtTypName: "FIRMWARE UPDATE REQUESTED"},
+	{EvtTypCode: OP_CODE_FW_PROGRESS, EvtTypName: "FIRMWARE UPDATE PROGRESS"},
+	{EvtTypCode: OP_CODE_FW_RECEIVED, EvtTypName: "FIRMWARE RECEIVED"},
+	{EvtTypCode: OP_CODE_FW_INSTALLED, EvtTypName: "FIRMWARE INSTALLED"},
+	{EvtTypCode: OP_CODE_FW_FAILED, EvtTypName: "FIRMWARE UPDATE FAILED"},
 
 	/* ALARM EVENT TYPES 1000 -1999 */
 	{EvtTypCode: STATUS_BAT_HIGH_AMP, EvtTypName: "ALARM HIGH BATTERY CURRENT"},
@@ -233,6 +230,10 @@ var EVENT_TYPES = []EventTyp{
 	// 	/* ANNOTATION EVENT TYPES 2000 - 65535 */
 	{EvtTypCode: NOTE_OPERATOR_COMMENT, EvtTypName: "OPERATOR COMMENT"},
 	{EvtTypCode: NOTE_REPORT_COMMENT, EvtTypName: "REPORT COMMENT"},
+	{EvtTypCode: NOTE_SSP_COMMENT, EvtTypName: "STABILIZED SHUT-IN PRESSURE"},
+	{EvtTypCode: NOTE_SSCVF_COMMENT, EvtTypName: "STABILIZED SCVF"},
+	{EvtTypCode: NOTE_PROGRAM_COMMENT, EvtTypName: "TEST PROGRAM"},
+	{EvtTypCode: NOTE_DEVICE_MOVED, EvtTypName: "DEVICE MOVED"},
 }
 
 func GetEventTypeByCode(code int32) (name string) {
@@ -13,25 +13,27 @@ type Header struct {
 	// HdrID   int64  `gorm:"unique; primaryKey" json:"-"` // POSTGRES
 	HdrID int64 `gorm:"autoIncrement" json:"-"`
 
-	HdrTime   int64  `gorm:"not null" json:"hdr_time"`
-	HdrAddr   string `gorm:"varchar(36)" json:"hdr_addr"`
-	HdrUserID string `gorm:"not null; varchar(36)"  json:"hdr_user_id"`
-	HdrApp    string `gorm:"varchar(36)" json:"hdr_app"`
+	HdrTime   int64  `gorm:"not null" json:"hdr_time" tlv:"1" flash:"0,8"`
+	HdrAddr   string `gorm:"varchar(36)" json:"hdr_addr" tlv:"2" flash:"8,36"`
+	HdrUserID string `gorm:"not null; varchar(36)"  json:"hdr_user_id" tlv:"3" flash:"44,36"`
+	HdrApp    string `gorm:"varchar(36)" json:"hdr_app" tlv:"4" flash:"80,36"`
+	HdrReqID  string `gorm:"varchar(36)" json:"-"` // DES requests: the correlation data sent with the CMD
+	HdrRepID  string `gorm:"varchar(36)" json:"-"` // Device replies: the HdrReqID of the request answered
 
-	HdrJobStart int64 `json:"hdr_job_start"`
-	HdrJobEnd   int64 `json:"hdr_job_end"`
+	HdrJobStart int64 `json:"hdr_job_start" tlv:"5" flash:"116,8" validate:"gte=0"`
+	HdrJobEnd   int64 `json:"hdr_job_end" tlv:"6" flash:"124,8" validate:"gte=0"`
 
 	/*WELL INFORMATION*/
-	HdrWellCo    string `gorm:"varchar(32)" json:"hdr_well_co"`
-	HdrWellName  string `gorm:"varchar(32)" json:"hdr_well_name"`
-	HdrWellSFLoc string `gorm:"varchar(32)" json:"hdr_well_sf_loc"`
-	HdrWellBHLoc string `gorm:"varchar(32)" json:"hdr_well_bh_loc"`
-	HdrWellLic   string `gorm:"varchar(32)" json:"hdr_well_lic"`
+	HdrWellCo    string `gorm:"varchar(32)" json:"hdr_well_co" tlv:"7" flash:"132,32" validate:"max=32"`
+	HdrWellName  string `gorm:"varchar(32)" json:"hdr_well_name" tlv:"8" flash:"164,32" validate:"max=32"`
+	HdrWellSFLoc string `gorm:"varchar(32)" json:"hdr_well_sf_loc" tlv:"9" flash:"196,32" validate:"max=32"`
+	HdrWellBHLoc string `gorm:"varchar(32)" json:"hdr_well_bh_loc" tlv:"10" flash:"228,32" validate:"max=32"`
+	HdrWellLic   string `gorm:"varchar(32)" json:"hdr_well_lic" tlv:"11" flash:"260,32" validate:"max=32"`
 
 	/* TODO: CHANGE HDR LNG / LAT TO FLOAT32*/
 	/*GEO LOCATION - USED TO POPULATE A GeoJSON OBJECT */
-	HdrGeoLng float64 `json:"hdr_geo_lng"`
-	HdrGeoLat float64 `json:"hdr_geo_lat"`
+	HdrGeoLng float64 `json:"hdr_geo_lng" tlv:"12" flash:"292,8" validate:"gte=-180,lte=180"`
+	HdrGeoLat float64 `json:"hdr_geo_lat" tlv:"13" flash:"300,8" validate:"gte=-90,lte=90"`
 	// HdrGeoLng float32 `json:"hdr_geo_lng"`
 	// HdrGeoLat float32 `json:"hdr_geo_lat"`
 }
@@ -120,9 +122,10 @@ func (hdr *Header) CMDValidate(device *Device, uid string) (err error) {
 
 	src := hdr.GetMessageSource()
 	dev_src := device.ReferenceSRC()
-	if err = src.ValidateSRC_CMD(dev_src, uid, hdr); err != nil {
+	if err = src.ValidateSRC_CMD(dev_src, uid, device.TimePolicy(), hdr); err != nil {
 		return
 	}
+	hdr.HdrTime = src.Time
 
 	return
 }
@@ -130,13 +133,19 @@ func (hdr *Header) CMDValidate(device *Device, uid string) (err error) {
 /*
 HEADER - VALIDATE MQTT SIG FROM DEVICE
 */
-func (hdr *Header) SIGValidate(device *Device) (err error) {
+func (hdr *Header) SIGValidate(device *Device, req *pkg.MQTTPendingRequest) (err error) {
 
 	src := hdr.GetMessageSource()
 	dev_src := device.ReferenceSRC()
-	if err = src.ValidateSRC_SIG(dev_src, hdr); err != nil {
+	if err = src.ValidateSRC_SIG(dev_src, device.TimePolicy(), req, hdr); err != nil {
 		return
 	}
+	hdr.HdrTime = src.Time
+
+	/* A REPLY IS PAIRED WITH ITS REQUEST BY CORRELATION DATA ( SEE GetHistory ) */
+	if req != nil {
+		hdr.HdrRepID = req.CorrelationData
+	}
 
 	hdr.Validate()
 
@@ -163,52 +172,15 @@ HEADER - AS STORED IN DEVICE FLASH
 */
 func (hdr Header) HeaderToBytes() (out []byte) {
 
-	out = append(out, pkg.Int64ToBytes(hdr.HdrTime)...)
-	out = append(out, pkg.StringToNBytes(hdr.HdrAddr, 36)...)
-	out = append(out, pkg.StringToNBytes(hdr.HdrUserID, 36)...)
-	out = append(out, pkg.StringToNBytes(hdr.HdrApp, 36)...)
-
-	out = append(out, pkg.Int64ToBytes(hdr.HdrJobStart)...)
-	out = append(out, pkg.Int64ToBytes(hdr.HdrJobEnd)...)
-
-	out = append(out, pkg.StringToNBytes(hdr.HdrWellCo, 32)...)
-	out = append(out, pkg.StringToNBytes(hdr.HdrWellName, 32)...)
-	out = append(out, pkg.StringToNBytes(hdr.HdrWellSFLoc, 32)...)
-	out = append(out, pkg.StringToNBytes(hdr.HdrWellBHLoc, 32)...)
-	out = append(out, pkg.StringToNBytes(hdr.HdrWellLic, 32)...)
-
-	/* TODO: CHANGE HDR LNG / LAT TO FLOAT32*/
-	out = append(out, pkg.Float64ToBytes(hdr.HdrGeoLng)...)
-	out = append(out, pkg.Float64ToBytes(hdr.HdrGeoLat)...)
-	// out = append(out, pkg.Float32ToBytes(hdr.HdrGeoLng)...)
-	// out = append(out, pkg.Float32ToBytes(hdr.HdrGeoLat)...)
-
+	out, err := FLASH_HDR_LAYOUT.Encode(hdr)
+	if err != nil {
+		pkg.LogErr(err)
+	}
 	return
 }
 func (hdr *Header) HeaderFromBytes(b []byte) {
 
-	hdr = &Header{
-
-		HdrTime:   pkg.BytesToInt64_L(b[0:8]),
-		HdrAddr:   pkg.StrBytesToString(b[8:44]),
-		HdrUserID: pkg.StrBytesToString(b[44:80]),
-		HdrApp:    pkg.StrBytesToString(b[80:116]),
-
-		HdrJobStart: pkg.BytesToInt64_L(b[116:124]),
-		HdrJobEnd:   pkg.BytesToInt64_L(b[124:132]),
-
-		HdrWellCo:    pkg.StrBytesToString(b[132:164]),
-		HdrWellName:  pkg.StrBytesToString(b[164:196]),
-		HdrWellSFLoc: pkg.StrBytesToString(b[196:228]),
-		HdrWellBHLoc: pkg.StrBytesToString(b[228:260]),
-		HdrWellLic:   pkg.StrBytesToString(b[260:292]),
-
-		/* TODO: CHANGE HDR LNG / LAT TO FLOAT32*/
-		HdrGeoLng: pkg.BytesToFloat64_L(b[292:300]),
-		HdrGeoLat: pkg.BytesToFloat64_L(b[300:308]),
-		// HdrGeoLng: pkg.BytesToFloat64_L(b[292:296]),
-		// HdrGeoLat: pkg.BytesToFloat64_L(b[296:300]),
+	if err := FLASH_HDR_LAYOUT.Decode(b, hdr); err != nil {
+		pkg.LogErr(err)
 	}
-	//  pkg.Json("(demo *DemoDeviceClient)HeaderFromBytes() -> hdr", hdr)
-	return
 }
@@ -11,19 +11,19 @@ import (
 SAMPLE - AS WRITTEN TO JOB DATABASE
 */
 type Sample struct {
-	// SmpID int64 `gorm:"unique; primaryKey" json:"-"` // POSTGRESS
-	SmpID int64 `gorm:"autoIncrement" json:"-"` // SQLITE
-
-	SmpTime    int64   `gorm:"not null" json:"smp_time"`
-	SmpCH4     float32 `json:"smp_ch4"`
-	SmpHiFlow  float32 `json:"smp_hi_flow"`
-	SmpLoFlow  float32 `json:"smp_lo_flow"`
-	SmpPress   float32 `json:"smp_press"`
-	SmpBatAmp  float32 `json:"smp_bat_amp"`
-	SmpBatVolt float32 `json:"smp_bat_volt"`
-	SmpMotVolt float32 `json:"smp_mot_volt"`
-	SmpVlvTgt  uint32  `json:"smp_vlv_tgt"`
-	SmpVlvPos  uint32  `json:"smp_vlv_pos"`
+	/* NOT UNIQUE IN POSTGRES; A TIMESCALE HYPERTABLE REQUIRES smp_time IN EVERY UNIQUE INDEX ( SEE JobStore.CreateHypertable ) */
+	SmpID int64 `gorm:"autoIncrement" json:"-"`
+
+	SmpTime    int64   `gorm:"not null" json:"smp_time" flash:"0,8"`
+	SmpCH4     float32 `json:"smp_ch4" flash:"8,4"`
+	SmpHiFlow  float32 `json:"smp_hi_flow" flash:"12,4"`
+	SmpLoFlow  float32 `json:"smp_lo_flow" flash:"16,4"`
+	SmpPress   float32 `json:"smp_press" flash:"20,4"`
+	SmpBatAmp  float32 `json:"smp_bat_amp" flash:"24,4"`
+	SmpBatVolt float32 `json:"smp_bat_volt" flash:"28,4"`
+	SmpMotVolt float32 `json:"smp_mot_volt" flash:"32,4"`
+	SmpVlvTgt  uint32  `json:"smp_vlv_tgt" flash:"36,2"`
+	SmpVlvPos  uint32  `json:"smp_vlv_pos" flash:"38,2"`
 	SmpJobName string  `json:"smp_job_name"`
 }
 
@@ -42,6 +42,22 @@ func WriteSMP(smp Sample, jdbc *pkg.JobDBClient) (err error) {
 
 	return res.Error
 }
+
+/* WRITES SAMPLES IN BATCHES; USED WHEN BACKFILLING FROM DEVICE FLASH */
+func WriteSMPs(smps []Sample, jdbc *pkg.JobDBClient) (err error) {
+
+	if jdbc.RWM == nil {
+		jdbc.RWM = &sync.RWMutex{}
+	}
+	for i := range smps {
+		smps[i].SmpID = 0
+	}
+	jdbc.RWM.Lock()
+	res := jdbc.CreateInBatches(&smps, 500)
+	jdbc.RWM.Unlock()
+
+	return res.Error
+}
 func ReadLastSMP(smp *Sample, jdbc *pkg.JobDBClient) (err error) {
 	
 	/* WHEN Read IS CALLED IN A GO ROUTINE, SEVERAL TRANSACTIONS MAY BE PENDING
@@ -62,43 +78,25 @@ SAMPLE - AS STORED IN DEVICE FLASH
 */
 func (smp *Sample) SampleToBytes() (out []byte) {
 
-	out = append(out, pkg.Int64ToBytes(smp.SmpTime)...)
-	out = append(out, pkg.Float32ToBytes(smp.SmpCH4)...)
-	out = append(out, pkg.Float32ToBytes(smp.SmpHiFlow)...)
-	out = append(out, pkg.Float32ToBytes(smp.SmpLoFlow)...)
-	out = append(out, pkg.Float32ToBytes(smp.SmpPress)...)
-	out = append(out, pkg.Float32ToBytes(smp.SmpBatAmp)...)
-	out = append(out, pkg.Float32ToBytes(smp.SmpBatVolt)...)
-	out = append(out, pkg.Float32ToBytes(smp.SmpMotVolt)...)
-	out = append(out, pkg.Int16ToBytes(int16(smp.SmpVlvTgt))...)
-	out = append(out, pkg.Int16ToBytes(int16(smp.SmpVlvPos))...)
-
+	out, err := FLASH_SMP_LAYOUT.Encode(smp)
+	if err != nil {
+		pkg.LogErr(err)
+	}
 	return
 }
-func (smp *Sample) SampleFromBytes(bytes []byte) {
-
-	smp = &Sample{
-		SmpTime:    pkg.BytesToInt64_L(bytes[0:8]),
-		SmpCH4:     pkg.BytesToFloat32_L(bytes[8:12]),
-		SmpHiFlow:  pkg.BytesToFloat32_L(bytes[12:16]),
-		SmpLoFlow:  pkg.BytesToFloat32_L(bytes[16:20]),
-		SmpPress:   pkg.BytesToFloat32_L(bytes[20:24]),
-		SmpBatAmp:  pkg.BytesToFloat32_L(bytes[24:28]),
-		SmpBatVolt: pkg.BytesToFloat32_L(bytes[28:32]),
-		SmpMotVolt: pkg.BytesToFloat32_B(bytes[32:36]),
-		SmpVlvTgt:  pkg.BytesToUInt32_L(bytes[36:38]),
-		SmpVlvPos:  pkg.BytesToUInt32_L(bytes[38:40]),
+func (smp *Sample) SampleFromBytes(b []byte) {
+
+	if err := FLASH_SMP_LAYOUT.Decode(b, smp); err != nil {
+		pkg.LogErr(err)
 	}
-	// pkg.Json("(smp *Sample) SampleFromBytes(...) ->  smp:", smp)
-	return
 }
 
 /*
 SAMPLE - MQTT MESSAGE STRUCTURE
 */
 type MQTT_Sample struct {
-	DesJobName string `json:"des_job_name"`
-	Data       string `json:"data"`
+	DesJobName string `json:"des_job_name" tlv:"1"`
+	Data       string `json:"data" tlv:"2"`
 }
 
 // func (job *Job) WriteMQTTSample(msg []byte, smp Sample) (err error) {
@@ -134,21 +132,16 @@ func (smp *Sample) DecodeMQTTSample(b64 string) (err error) {
 		return pkg.LogErr(err)
 	}
 
-	expected := 40
-	if len(bytes) != expected {
-		return fmt.Errorf("DecodeMQTTSample: Expected %d bytes; received %d", expected, len(bytes))
+	if len(bytes) != FLASH_SMP_SIZE {
+		return fmt.Errorf("DecodeMQTTSample: Expected %d bytes; received %d", FLASH_SMP_SIZE, len(bytes))
 	}
 
-	smp.SmpTime = pkg.BytesToInt64_L(bytes[0:8])
-	smp.SmpCH4 = pkg.BytesToFloat32_L(bytes[8:12])
-	smp.SmpHiFlow = pkg.BytesToFloat32_L(bytes[12:16])
-	smp.SmpLoFlow = pkg.BytesToFloat32_L(bytes[16:20])
-	smp.SmpPress = pkg.BytesToFloat32_L(bytes[20:24])
-	smp.SmpBatAmp = pkg.BytesToFloat32_L(bytes[24:28])
-	smp.SmpBatVolt = pkg.BytesToFloat32_L(bytes[28:32])
-	smp.SmpMotVolt = pkg.BytesToFloat32_L(bytes[32:36])
-	smp.SmpVlvTgt = pkg.BytesToUInt32_L(bytes[36:38])
-	smp.SmpVlvPos = pkg.BytesToUInt32_L(bytes[38:40])
+	/* THE JOB NAME IS NOT PART OF THE FLASH RECORD */
+	job := smp.SmpJobName
+	if err = FLASH_SMP_LAYOUT.Decode(bytes, smp); err != nil {
+		return fmt.Errorf("DecodeMQTTSample: %s", err.Error())
+	}
+	smp.SmpJobName = job
 
 	// pkg.Json("DecodeMQTTSampleData(...) ->  smp:", smp)
 
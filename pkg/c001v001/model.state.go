@@ -13,28 +13,31 @@ type State struct {
 	// StaID int64 `gorm:"unique; primaryKey" json:"-"` // POSTGRESS
 	StaID int64 `gorm:"autoIncrement" json:"-"` // SQLITE
 
-	StaTime   int64  `gorm:"not null" json:"sta_time"`
-	StaAddr   string `gorm:"not null; varchar(36)" json:"sta_addr"`
-	StaUserID string `gorm:"not null; varchar(36)" json:"sta_user_id"`
-	StaApp    string `gorm:"not null; varchar(36)" json:"sta_app"`
+	StaTime   int64  `gorm:"not null" json:"sta_time" tlv:"1" flash:"0,8"`
+	StaAddr   string `gorm:"not null; varchar(36)" json:"sta_addr" tlv:"2" flash:"8,36"`
+	StaUserID string `gorm:"not null; varchar(36)" json:"sta_user_id" tlv:"3" flash:"44,36"`
+	StaApp    string `gorm:"not null; varchar(36)" json:"sta_app" tlv:"4" flash:"80,36"`
 
 	/*DEVICE*/
-	StaSerial  string `gorm:"not null; varchar(10)" json:"sta_serial"`
-	StaVersion string `gorm:"not null; varchar(3)" json:"sta_version"`
-	StaClass   string `gorm:"not null; varchar(3)" json:"sta_class"`
+	StaSerial  string `gorm:"not null; varchar(10)" json:"sta_serial" tlv:"5" flash:"116,10"`
+	StaVersion string `gorm:"not null; varchar(3)" json:"sta_version" tlv:"6" flash:"126,3"`
+	StaClass   string `gorm:"not null; varchar(3)" json:"sta_class" tlv:"7" flash:"129,3"`
 
 	/* FW VERSIONS */
-	StaLogFw string `gorm:"not null; varchar(10)" json:"sta_log_fw"`
-	StaModFw string `gorm:"not null; varchar(10)" json:"sta_mod_fw"`
+	StaLogFw string `gorm:"not null; varchar(10)" json:"sta_log_fw" tlv:"8" flash:"132,10"`
+	StaModFw string `gorm:"not null; varchar(10)" json:"sta_mod_fw" tlv:"9" flash:"142,10"`
 
 	/* LOGGING STATE */
-	StaLogging int32  `json:"sta_logging"`
-	StaJobName string `gorm:"not null; varchar(24)" json:"sta_job_name"`
+	StaLogging int32  `json:"sta_logging" tlv:"10" flash:"152,4"`
+	StaJobName string `gorm:"not null; varchar(24)" json:"sta_job_name" tlv:"11" flash:"156,24"`
 
 	/* CHIP UID (STMicro) */
-	StaStmUID1 int32 `json:"sta_stm_uid1"`
-	StaStmUID2 int32 `json:"sta_stm_uid2"`
-	StaStmUID3 int32 `json:"sta_stm_uid3"`
+	StaStmUID1 int32 `json:"sta_stm_uid1" tlv:"12" flash:"180,4"`
+	StaStmUID2 int32 `json:"sta_stm_uid2" tlv:"13" flash:"184,4"`
+	StaStmUID3 int32 `json:"sta_stm_uid3" tlv:"14" flash:"188,4"`
+
+	/* PAYLOAD ENCODING ( ENCODING_... ) SUPPORTED BY THE FIRMWARE; NOT STORED */
+	StaEncoding int32 `gorm:"-" json:"sta_encoding" tlv:"15"`
 }
 
 func WriteSTA(sta State, jdbc *pkg.JobDBClient) (err error) {
@@ -72,51 +75,17 @@ STATE AS STORED IN DEVICE FLASH ( HEX )
 */
 func (sta State) StateToBytes() (out []byte) {
 
-	out = append(out, pkg.Int64ToBytes(sta.StaTime)...)
-	out = append(out, pkg.StringToNBytes(sta.StaAddr, 36)...)
-	out = append(out, pkg.StringToNBytes(sta.StaUserID, 36)...)
-	out = append(out, pkg.StringToNBytes(sta.StaApp, 36)...)
-
-	out = append(out, pkg.StringToNBytes(sta.StaSerial, 10)...)
-	out = append(out, pkg.StringToNBytes(sta.StaVersion, 3)...)
-	out = append(out, pkg.StringToNBytes(sta.StaClass, 3)...)
-
-	out = append(out, pkg.StringToNBytes(sta.StaLogFw, 10)...)
-	out = append(out, pkg.StringToNBytes(sta.StaModFw, 10)...)
-
-	out = append(out, pkg.Int32ToBytes(sta.StaLogging)...)
-	out = append(out, pkg.StringToNBytes(sta.StaJobName, 24)...)
-
-	out = append(out, pkg.Int32ToBytes(sta.StaStmUID1)...)
-	out = append(out, pkg.Int32ToBytes(sta.StaStmUID2)...)
-	out = append(out, pkg.Int32ToBytes(sta.StaStmUID3)...)
-
+	out, err := FLASH_STA_LAYOUT.Encode(sta)
+	if err != nil {
+		pkg.LogErr(err)
+	}
 	return
 }
-func (sta State) StateFromBytes(b []byte) {
+func (sta *State) StateFromBytes(b []byte) {
 
-	sta = State{
-
-		StaTime:   pkg.BytesToInt64_L(b[0:8]),
-		StaAddr:   pkg.StrBytesToString(b[8:44]),
-		StaUserID: pkg.StrBytesToString(b[44:80]),
-		StaApp:    pkg.StrBytesToString(b[80:116]),
-
-		StaSerial:  pkg.StrBytesToString(b[116:126]),
-		StaVersion: pkg.StrBytesToString(b[126:129]),
-		StaClass:   pkg.StrBytesToString(b[129:132]),
-
-		StaLogFw: pkg.StrBytesToString(b[132:142]),
-		StaModFw: pkg.StrBytesToString(b[142:152]),
-
-		StaLogging: pkg.BytesToInt32_L(b[152:156]),
-		StaJobName: pkg.StrBytesToString(b[156:180]),
-
-		StaStmUID1: pkg.BytesToInt32_L(b[180:184]),
-		StaStmUID2: pkg.BytesToInt32_L(b[184:188]),
-		StaStmUID3: pkg.BytesToInt32_L(b[188:192]),
+	if err := FLASH_STA_LAYOUT.Decode(b, sta); err != nil {
+		pkg.LogErr(err)
 	}
-	//  pkg.Json("(demo *DemoDeviceClient)StateFromBytes() -> sta", sta)
 }
 
 /*
@@ -170,13 +139,14 @@ func (sta *State) CMDValidate(device *Device, uid string) (err error) {
 
 	src := sta.GetMessageSource()
 	dev_src := device.ReferenceSRC()
-	if err = src.ValidateSRC_CMD(dev_src, uid, sta); err != nil {
+	if err = src.ValidateSRC_CMD(dev_src, uid, device.TimePolicy(), sta); err != nil {
 		return
 	}
+	sta.StaTime = src.Time
 
 	if sta.StaLogging > MAX_OP_CODE {
-		_, err = pkg.LogDESError(uid, pkg.ERR_INVALID_SRC_OP_CODE_CMD, sta)
-		return
+		pkg.LogDESError(uid, pkg.ERR_INVALID_SRC_OP_CODE_CMD, sta)
+		return fmt.Errorf(pkg.ERR_INVALID_SRC_OP_CODE_CMD)
 	}
 
 	return
@@ -185,13 +155,14 @@ func (sta *State) CMDValidate(device *Device, uid string) (err error) {
 /*
 STATE - VALIDATE MQTT SIG FROM DEVICE
 */
-func (sta *State) SIGValidate(device *Device) (err error) {
+func (sta *State) SIGValidate(device *Device, req *pkg.MQTTPendingRequest) (err error) {
 
 	src := sta.GetMessageSource()
 	dev_src := device.ReferenceSRC()
-	if err = src.ValidateSRC_SIG(dev_src, sta); err != nil {
+	if err = src.ValidateSRC_SIG(dev_src, device.TimePolicy(), req, sta); err != nil {
 		return
 	}
+	sta.StaTime = src.Time
 
 	if sta.StaApp != dev_src.App {
 		pkg.LogDESError(device.DESDevSerial, pkg.ERR_INVALID_SRC_SIG, sta)
@@ -1,10 +1,11 @@
 package c001v001
 
 import (
-	"encoding/json"
+	"encoding/base64"
 	"fmt"
 	"math"
 	"math/rand"
+	"net/url"
 
 	"sync"
 
@@ -43,6 +44,7 @@ type DemoDeviceClient struct {
 	TZero chan time.Time
 	GPS   chan bool
 	Live  bool
+	FwImg []byte // Firmware image received so far ( SIM 'RAM' )
 }
 
 type DemoDeviceClientsMap map[string]DemoDeviceClient
@@ -88,6 +90,7 @@ func GetDemoDeviceList() (demos []pkg.DESRegistration, err error) {
 		Joins(`JOIN ( ? ) j ON des_jobs.des_job_dev_id = j.des_job_dev_id AND des_job_reg_time = j.max_time`, subQryLatestJob).
 		Joins("JOIN des_devs ON des_devs.des_dev_id = j.des_job_dev_id").
 		Where("des_devs.des_dev_serial LIKE 'DEMO%' ").
+		Where("des_devs.des_dev_class = ? AND des_devs.des_dev_version = ?", DEVICE_CLASS, DEVICE_VERSION).
 		Order("des_devs.des_dev_serial DESC")
 
 	res := qry.Scan(&demos)
@@ -95,6 +98,27 @@ func GetDemoDeviceList() (demos []pkg.DESRegistration, err error) {
 	return
 }
 
+/* THE PAYLOAD ENCODING DEMO DEVICE FIRMWARE SUPPORTS; DECLARED IN EVERY State IT SENDS */
+const DEMO_ENCODING = ENCODING_BIN
+
+/* SIGNS DEMO DEVICE SIGNALS USING THE KEY IN THE DEMO DEVICE'S FILES, BY SERIAL */
+var DemoSigners = make(map[string]*pkg.DESDevSigner)
+var DemoSignersRWMutex = sync.RWMutex{}
+
+/* RETURNS THE DEMO DEVICE'S SIGNER; nil WHERE NO SIGNING KEY WAS ISSUED ( UNSIGNED SIGNALS ) */
+func (demo *DemoDeviceClient) DemoSigner() (s *pkg.DESDevSigner) {
+	DemoSignersRWMutex.Lock()
+	defer DemoSignersRWMutex.Unlock()
+
+	if s = DemoSigners[demo.DESDevSerial]; s == nil {
+		if key, err := pkg.ReadDeviceSigningKeyFile(demo.CmdArchiveName()); err == nil {
+			s = &pkg.DESDevSigner{Key: key}
+			DemoSigners[demo.DESDevSerial] = s
+		}
+	}
+	return
+}
+
 /* CALLED ON SERVER STARTUP */
 func DemoDeviceClient_ConnectAll() {
 
@@ -244,6 +268,7 @@ func (demo *DemoDeviceClient) MQTTDemoDeviceClient_Connect() (err error) {
 	demo.MQTTSubscription_DemoDeviceClient_CMDHeader().Sub(demo.DESMQTTClient)
 	demo.MQTTSubscription_DemoDeviceClient_CMDConfig().Sub(demo.DESMQTTClient)
 	demo.MQTTSubscription_DemoDeviceClient_CMDEvent().Sub(demo.DESMQTTClient)
+	demo.MQTTSubscription_DemoDeviceClient_CMDFirmware().Sub(demo.DESMQTTClient)
 
 	/* MESSAGE LIMIT TEST ***TODO: REMOVE AFTER DEVELOPMENT*** */
 	demo.MQTTSubscription_DemoDeviceClient_CMDMsgLimit().Sub(demo.DESMQTTClient)
@@ -263,6 +288,7 @@ func (demo *DemoDeviceClient) MQTTDemoDeviceClient_Disconnect() (err error) {
 		demo.MQTTSubscription_DemoDeviceClient_CMDHeader().UnSub(demo.DESMQTTClient)
 		demo.MQTTSubscription_DemoDeviceClient_CMDConfig().UnSub(demo.DESMQTTClient)
 		demo.MQTTSubscription_DemoDeviceClient_CMDEvent().UnSub(demo.DESMQTTClient)
+	demo.MQTTSubscription_DemoDeviceClient_CMDFirmware().UnSub(demo.DESMQTTClient)
 
 		/* MESSAGE LIMIT TEST ***TODO: REMOVE AFTER DEVELOPMENT*** */
 		demo.MQTTSubscription_DemoDeviceClient_CMDMsgLimit().UnSub(demo.DESMQTTClient)
@@ -287,7 +313,7 @@ func (demo *DemoDeviceClient) MQTTSubscription_DemoDeviceClient_CMDStartJob() pk
 
 			/* PARSE / STORE THE ADMIN IN CMDARCHIVE */
 			start := StartJob{}
-			if err := json.Unmarshal(msg.Payload(), &start); err != nil {
+			if err := DecodePayload(msg.Payload(), &start); err != nil {
 				pkg.LogErr(err)
 			}
 
@@ -306,7 +332,7 @@ func (demo *DemoDeviceClient) MQTTSubscription_DemoDeviceClient_CMDEndJob() pkg.
 
 			/* PARSE / STORE THE ADMIN IN CMDARCHIVE */
 			evt := Event{}
-			if err := json.Unmarshal(msg.Payload(), &evt); err != nil {
+			if err := DecodePayload(msg.Payload(), &evt); err != nil {
 				pkg.LogErr(err)
 			}
 
@@ -359,7 +385,7 @@ func (demo *DemoDeviceClient) MQTTSubscription_DemoDeviceClient_CMDAdmin() pkg.M
 
 			/* PARSE / STORE THE ADMIN IN CMDARCHIVE */
 			adm := Admin{}
-			if err := json.Unmarshal(msg.Payload(), &adm); err != nil {
+			if err := DecodePayload(msg.Payload(), &adm); err != nil {
 				pkg.LogErr(err)
 			}
 
@@ -402,7 +428,7 @@ func (demo *DemoDeviceClient) MQTTSubscription_DemoDeviceClient_CMDState() pkg.M
 
 			/* PARSE / STORE THE ADMIN IN CMDARCHIVE */
 			sta := State{}
-			if err := json.Unmarshal(msg.Payload(), &sta); err != nil {
+			if err := DecodePayload(msg.Payload(), &sta); err != nil {
 				pkg.LogErr(err)
 			}
 
@@ -454,7 +480,7 @@ func (demo *DemoDeviceClient) MQTTSubscription_DemoDeviceClient_CMDHeader() pkg.
 
 			/* PARSE / STORE THE ADMIN IN CMDARCHIVE */
 			hdr := Header{}
-			if err := json.Unmarshal(msg.Payload(), &hdr); err != nil {
+			if err := DecodePayload(msg.Payload(), &hdr); err != nil {
 				pkg.LogErr(err)
 			}
 
@@ -500,7 +526,7 @@ func (demo *DemoDeviceClient) MQTTSubscription_DemoDeviceClient_CMDConfig() pkg.
 
 			/* PARSE / STORE THE ADMIN IN CMDARCHIVE */
 			cfg := Config{}
-			if err := json.Unmarshal(msg.Payload(), &cfg); err != nil {
+			if err := DecodePayload(msg.Payload(), &cfg); err != nil {
 				pkg.LogErr(err)
 			}
 
@@ -554,7 +580,7 @@ func (demo *DemoDeviceClient) MQTTSubscription_DemoDeviceClient_CMDEvent() pkg.M
 
 			/* PARSE / STORE THE EVENT IN CMDARCHIVE */
 			evt := Event{}
-			if err := json.Unmarshal(msg.Payload(), &evt); err != nil {
+			if err := DecodePayload(msg.Payload(), &evt); err != nil {
 				pkg.LogErr(err)
 			}
 
@@ -583,6 +609,64 @@ func (demo *DemoDeviceClient) MQTTSubscription_DemoDeviceClient_CMDEvent() pkg.M
 
 			/* SEND CONFIRMATION */
 			go demo.MQTTPublication_DemoDeviceClient_SIGEvent(evt)
+
+			/* MOVE TO THE NEW OPERATIONAL DES */
+			if evt.EvtCode == OP_CODE_DES_REG_REQ {
+				go demo.Demo_ChangeDES(evt)
+			}
+		},
+	}
+}
+
+/* SUBSCRIPTIONS -> FIRMWARE -> UPON RECEIPT, REASSEMBLE THE IMAGE, VERIFY, SIMULATE INSTALLATION & REPLY TO .../sig/event */
+func (demo *DemoDeviceClient) MQTTSubscription_DemoDeviceClient_CMDFirmware() pkg.MQTTSubscription {
+	return pkg.MQTTSubscription{
+
+		Qos:   1,
+		Topic: demo.MQTTTopic_CMDFirmware(),
+		Handler: func(c phao.Client, msg phao.Message) {
+
+			chunk := FirmwareChunk{}
+			if err := DecodePayload(msg.Payload(), &chunk); err != nil {
+				pkg.LogErr(err)
+				return
+			}
+
+			data, err := base64.URLEncoding.DecodeString(chunk.Data)
+			if err != nil {
+				demo.Demo_FirmwareEvent(OP_CODE_FW_FAILED, chunk.Type, err.Error())
+				return
+			}
+
+			if chunk.Seq == 0 {
+				demo.FwImg = nil
+			}
+			if int64(chunk.Seq)*FW_CHUNK_SIZE != int64(len(demo.FwImg)) {
+				demo.FwImg = nil
+				demo.Demo_FirmwareEvent(OP_CODE_FW_FAILED, chunk.Type, fmt.Sprintf("chunk %d out of sequence", chunk.Seq))
+				return
+			}
+			demo.FwImg = append(demo.FwImg, data...)
+
+			/* REPORT RECEIPT PROGRESS EVERY ~25% */
+			if chunk.Total > 4 && (chunk.Seq+1)%(chunk.Total/4) == 0 && chunk.Seq+1 < chunk.Total {
+				demo.Demo_FirmwareEvent(OP_CODE_FW_PROGRESS, chunk.Type, fmt.Sprint((chunk.Seq+1)*100/chunk.Total))
+			}
+
+			if chunk.Seq+1 < chunk.Total {
+				return
+			}
+
+			/* VERIFY THE IMAGE */
+			img := demo.FwImg
+			demo.FwImg = nil
+			if int64(len(img)) != chunk.Size || pkg.FirmwareSHA256(img) != chunk.SHA256 {
+				demo.Demo_FirmwareEvent(OP_CODE_FW_FAILED, chunk.Type, "checksum mismatch")
+				return
+			}
+			demo.Demo_FirmwareEvent(OP_CODE_FW_RECEIVED, chunk.Type, chunk.Release)
+
+			go demo.Demo_FirmwareInstall(chunk)
 		},
 	}
 }
@@ -597,7 +681,7 @@ func (demo *DemoDeviceClient) MQTTSubscription_DemoDeviceClient_CMDMsgLimit() pk
 
 			/* PARSE MsgLimit IN CMDARCHIVE */
 			kafka := MsgLimit{}
-			if err := json.Unmarshal(msg.Payload(), &kafka); err != nil {
+			if err := DecodePayload(msg.Payload(), &kafka); err != nil {
 				pkg.LogErr(err)
 			} // pkg.Json("MQTTSubscription_DemoDeviceClient_CMDMsgLimit(): -> kafka", kafka)
 
@@ -625,6 +709,20 @@ func (demo *DemoDeviceClient) MQTTSubscription_DemoDeviceClient_CMDTestOLS() pkg
 
 /* PUBLICATIONS ******************************************************************************************/
 
+/* SIGN ( WHERE THE DEMO DEVICE HAS A SIGNING KEY ) AND PUBLISH A SIGNAL */
+func (demo *DemoDeviceClient) PubSIG(sig pkg.MQTTPublication) {
+
+	if s := demo.DemoSigner(); s != nil {
+		payload, err := s.Sign(sig.Topic, []byte(sig.Message))
+		if err != nil {
+			pkg.LogErr(err)
+			return
+		}
+		sig.Message = string(payload)
+	}
+	sig.Pub(demo.DESMQTTClient)
+}
+
 /* MQTTPublication_DemoDeviceClient_SIGStartJob */
 
 /* PUBLICATION -> START JOB -> SIMULATED JOB STARTED RESPONSE */
@@ -633,7 +731,8 @@ func (demo *DemoDeviceClient) MQTTPublication_DemoDeviceClient_SIGStartJob(start
 	PREVENT BLOCKING WHEN PUBLISH IS CALLED IN A MESSAGE HANDLER
 	*/
 
-	json, err := pkg.ModelToJSONString(start)
+	start.STA.StaEncoding = DEMO_ENCODING
+	json, err := EncodePayload(DEMO_ENCODING, start)
 	if err != nil {
 		pkg.LogErr(err)
 	}
@@ -647,7 +746,7 @@ func (demo *DemoDeviceClient) MQTTPublication_DemoDeviceClient_SIGStartJob(start
 		Qos:      0,
 	}
 
-	sig.Pub(demo.DESMQTTClient)
+	demo.PubSIG(sig)
 }
 
 /* PUBLICATION -> END JOB -> SIMULATED JOB STARTED RESPONSE */
@@ -656,7 +755,8 @@ func (demo *DemoDeviceClient) MQTTPublication_DemoDeviceClient_SIGEndJob(sta Sta
 	PREVENT BLOCKING WHEN PUBLISH IS CALLED IN A MESSAGE HANDLER
 	*/
 
-	json, err := pkg.ModelToJSONString(sta)
+	sta.StaEncoding = DEMO_ENCODING
+	json, err := EncodePayload(DEMO_ENCODING, sta)
 	if err != nil {
 		pkg.LogErr(err)
 	}
@@ -670,7 +770,7 @@ func (demo *DemoDeviceClient) MQTTPublication_DemoDeviceClient_SIGEndJob(sta Sta
 		Qos:      0,
 	}
 
-	sig.Pub(demo.DESMQTTClient)
+	demo.PubSIG(sig)
 }
 
 /* PUBLICATION -> PING -> SIMULATED ADMINS */
@@ -679,7 +779,7 @@ func (demo *DemoDeviceClient) MQTTPublication_DemoDeviceClient_SIGPing() {
 	PREVENT BLOCKING WHEN PUBLISH IS CALLED IN A MESSAGE HANDLER
 	*/
 
-	json, err := pkg.ModelToJSONString(pkg.Ping{Time: time.Now().UTC().UnixMilli(), OK: true})
+	json, err := EncodePayload(DEMO_ENCODING, pkg.Ping{Time: time.Now().UTC().UnixMilli(), OK: true})
 	if err != nil {
 		pkg.LogErr(err)
 	}
@@ -693,7 +793,7 @@ func (demo *DemoDeviceClient) MQTTPublication_DemoDeviceClient_SIGPing() {
 		Qos:      0,
 	}
 
-	sig.Pub(demo.DESMQTTClient)
+	demo.PubSIG(sig)
 }
 
 /* PUBLICATION -> ADMIN -> SIMULATED ADMINS */
@@ -702,7 +802,7 @@ func (demo *DemoDeviceClient) MQTTPublication_DemoDeviceClient_SIGAdmin(adm Admi
 	PREVENT BLOCKING WHEN PUBLISH IS CALLED IN A MESSAGE HANDLER
 	*/
 
-	json, err := pkg.ModelToJSONString(adm)
+	json, err := EncodePayload(DEMO_ENCODING, adm)
 	if err != nil {
 		pkg.LogErr(err)
 	}
@@ -716,7 +816,7 @@ func (demo *DemoDeviceClient) MQTTPublication_DemoDeviceClient_SIGAdmin(adm Admi
 		Qos:      0,
 	}
 
-	sig.Pub(demo.DESMQTTClient)
+	demo.PubSIG(sig)
 }
 
 /* PUBLICATION -> STATE  -> SIMULATED STATE */
@@ -725,7 +825,8 @@ func (demo *DemoDeviceClient) MQTTPublication_DemoDeviceClient_SIGState(sta Stat
 	PREVENT BLOCKING WHEN PUBLISH IS CALLED IN A MESSAGE HANDLER
 	*/
 
-	json, err := pkg.ModelToJSONString(sta)
+	sta.StaEncoding = DEMO_ENCODING
+	json, err := EncodePayload(DEMO_ENCODING, sta)
 	if err != nil {
 		pkg.LogErr(err)
 	}
@@ -739,7 +840,7 @@ func (demo *DemoDeviceClient) MQTTPublication_DemoDeviceClient_SIGState(sta Stat
 		Qos:      0,
 	}
 
-	sig.Pub(demo.DESMQTTClient)
+	demo.PubSIG(sig)
 }
 
 /* PUBLICATION -> HEADER -> SIMULATED HEADERS */
@@ -748,7 +849,7 @@ func (demo *DemoDeviceClient) MQTTPublication_DemoDeviceClient_SIGHeader(hdr Hea
 	PREVENT BLOCKING WHEN PUBLISH IS CALLED IN A MESSAGE HANDLER
 	*/
 
-	json, err := pkg.ModelToJSONString(hdr)
+	json, err := EncodePayload(DEMO_ENCODING, hdr)
 	if err != nil {
 		pkg.LogErr(err)
 	}
@@ -762,7 +863,7 @@ func (demo *DemoDeviceClient) MQTTPublication_DemoDeviceClient_SIGHeader(hdr Hea
 		Qos:      0,
 	}
 
-	sig.Pub(demo.DESMQTTClient)
+	demo.PubSIG(sig)
 }
 
 /* PUBLICATION -> CONFIG -> SIMULATED CONFIGS */
@@ -771,7 +872,7 @@ func (demo *DemoDeviceClient) MQTTPublication_DemoDeviceClient_SIGConfig(cfg Con
 	PREVENT BLOCKING WHEN PUBLISH IS CALLED IN A MESSAGE HANDLER
 	*/
 
-	json, err := pkg.ModelToJSONString(cfg)
+	json, err := EncodePayload(DEMO_ENCODING, cfg)
 	if err != nil {
 		pkg.LogErr(err)
 	}
@@ -785,7 +886,7 @@ func (demo *DemoDeviceClient) MQTTPublication_DemoDeviceClient_SIGConfig(cfg Con
 		Qos:      0,
 	}
 
-	sig.Pub(demo.DESMQTTClient)
+	demo.PubSIG(sig)
 }
 
 /* PUBLICATION -> EVENT -> SIMULATED EVENTS */
@@ -794,7 +895,7 @@ func (demo *DemoDeviceClient) MQTTPublication_DemoDeviceClient_SIGEvent(evt Even
 	PREVENT BLOCKING WHEN PUBLISH IS CALLED IN A MESSAGE HANDLER
 	*/
 
-	json, err := pkg.ModelToJSONString(evt)
+	json, err := EncodePayload(DEMO_ENCODING, evt)
 	if err != nil {
 		pkg.LogErr(err)
 	}
@@ -808,13 +909,13 @@ func (demo *DemoDeviceClient) MQTTPublication_DemoDeviceClient_SIGEvent(evt Even
 		Qos:      0,
 	}
 
-	sig.Pub(demo.DESMQTTClient)
+	demo.PubSIG(sig)
 }
 
 /* PUBLICATION -> SAMPLE -> SIMULATED SAMPLES */
 func (demo *DemoDeviceClient) MQTTPublication_DemoDeviceClient_SIGSample(mqtts MQTT_Sample) {
 
-	b64, err := json.Marshal(mqtts)
+	b64, err := EncodePayload(DEMO_ENCODING, mqtts)
 	if err != nil {
 		pkg.LogErr(err)
 	} // pkg.Json("MQTT_Sample:", b64)
@@ -825,13 +926,13 @@ func (demo *DemoDeviceClient) MQTTPublication_DemoDeviceClient_SIGSample(mqtts M
 	sig := pkg.MQTTPublication{
 
 		Topic:    demo.MQTTTopic_SIGSample(),
-		Message:  string(b64),
+		Message:  b64,
 		Retained: false,
 		WaitMS:   0,
 		Qos:      0,
 	}
 
-	sig.Pub(demo.DESMQTTClient)
+	demo.PubSIG(sig)
 }
 
 /* PUBLICATION -> MESSAGE LIMIT TEST ***TODO: REMOVE AFTER DEVELOPMENT***  */
@@ -840,7 +941,7 @@ func (demo *DemoDeviceClient) MQTTPublication_DemoDeviceClient_SIGMsgLimit(msg M
 	PREVENT BLOCKING WHEN PUBLISH IS CALLED IN A MESSAGE HANDLER
 	*/
 
-	json, err := pkg.ModelToJSONString(msg)
+	json, err := EncodePayload(DEMO_ENCODING, msg)
 	if err != nil {
 		pkg.LogErr(err)
 	}
@@ -854,11 +955,90 @@ func (demo *DemoDeviceClient) MQTTPublication_DemoDeviceClient_SIGMsgLimit(msg M
 		Qos:      0,
 	}
 
-	sig.Pub(demo.DESMQTTClient)
+	demo.PubSIG(sig)
 }
 
 /* SIMULATIONS *******************************************************************************************/
 
+/* RECONNECT TO THE BROKER IN AN OP_CODE_DES_REG_REQ EVENT; REPORT OP_CODE_DES_REGISTERED TO THE NEW DES */
+func (demo *DemoDeviceClient) Demo_ChangeDES(req Event) {
+
+	host, port, err := ParseOperationalDES(req.EvtMsg)
+	if err != nil {
+		pkg.LogErr(err)
+		return
+	}
+
+	/* LET THE CONFIRMATION REACH THE CURRENT DES */
+	time.Sleep(time.Millisecond * 500)
+	demo.MQTTDemoDeviceClient_Disconnect()
+
+	u, err := url.Parse(pkg.MQTTBrokerURL())
+	if err != nil {
+		pkg.LogErr(err)
+		return
+	}
+	u.Host = fmt.Sprintf("%s:%d", host, port)
+	demo.DESMQTTClient.Broker = u.String()
+	if err = demo.MQTTDemoDeviceClient_Connect(); err != nil {
+		pkg.LogErr(err)
+		return
+	}
+	fmt.Printf("\n(*DemoDeviceClient) Demo_ChangeDES( %s ) -> connected to %s\n", demo.DESDevSerial, demo.DESMQTTClient.Broker)
+
+	src := demo.ReferenceSRC()
+	evt := Event{
+		EvtTime:   src.Time,
+		EvtAddr:   src.Addr,
+		EvtUserID: src.UserID,
+		EvtApp:    src.App,
+		EvtCode:   OP_CODE_DES_REGISTERED,
+		EvtMsg:    req.EvtMsg,
+	}
+	evt.Validate()
+	demo.EVT = evt
+	demo.MQTTPublication_DemoDeviceClient_SIGEvent(evt)
+}
+
+/* PUBLISH A FIRMWARE EVENT; SEE FirmwareEventMsg */
+func (demo *DemoDeviceClient) Demo_FirmwareEvent(code int32, typ, val string) {
+	src := demo.ReferenceSRC()
+	evt := Event{
+		EvtTime:   src.Time,
+		EvtAddr:   src.Addr,
+		EvtUserID: src.UserID,
+		EvtApp:    src.App,
+		EvtCode:   code,
+		EvtMsg:    FirmwareEventMsg(typ, val),
+	}
+	evt.Validate()
+	demo.MQTTPublication_DemoDeviceClient_SIGEvent(evt)
+}
+
+/* SIMULATE INSTALLING A VERIFIED FIRMWARE IMAGE; REPORT THE NEW VERSION IN State */
+func (demo *DemoDeviceClient) Demo_FirmwareInstall(chunk FirmwareChunk) {
+
+	for _, pct := range []int{25, 50, 75, 100} {
+		time.Sleep(time.Millisecond * 500)
+		demo.Demo_FirmwareEvent(OP_CODE_FW_PROGRESS, chunk.Type, fmt.Sprint(pct))
+	}
+
+	switch chunk.Type {
+	case pkg.FW_TYPE_LOG:
+		demo.STA.StaLogFw = chunk.Release
+	case pkg.FW_TYPE_MOD:
+		demo.STA.StaModFw = chunk.Release
+	default:
+		demo.Demo_FirmwareEvent(OP_CODE_FW_FAILED, chunk.Type, "unknown firmware type")
+		return
+	}
+	demo.Demo_FirmwareEvent(OP_CODE_FW_INSTALLED, chunk.Type, chunk.Release)
+
+	demo.STA.StaTime = time.Now().UTC().UnixMilli()
+	demo.STA.StaAddr = demo.DESDevSerial
+	demo.MQTTPublication_DemoDeviceClient_SIGState(demo.STA)
+}
+
 func (demo *DemoDeviceClient) StartDemoJob(start StartJob, offline bool) {
 	fmt.Printf("\n(*DemoDeviceClient) StartDemoJob( %s )...\n", demo.DESDevSerial)
 
@@ -1,7 +1,7 @@
 package c001v001
 
 import (
-	"encoding/json"
+	"encoding/base64"
 	"fmt"
 	"time"
 
@@ -39,16 +39,9 @@ func (device *Device) MQTTDeviceClient_Connect() (err error) {
 	}
 
 	/* SUBSCRIBE TO ALL MQTTSubscriptions */
-	device.MQTTSubscription_DeviceClient_SIGStartJob().Sub(device.DESMQTTClient)
-	device.MQTTSubscription_DeviceClient_SIGEndJob().Sub(device.DESMQTTClient)
-	device.MQTTSubscription_DeviceClient_SIGDevicePing().Sub(device.DESMQTTClient)
-	device.MQTTSubscription_DeviceClient_SIGAdmin().Sub(device.DESMQTTClient)
-	device.MQTTSubscription_DeviceClient_SIGState().Sub(device.DESMQTTClient)
-	device.MQTTSubscription_DeviceClient_SIGHeader().Sub(device.DESMQTTClient)
-	device.MQTTSubscription_DeviceClient_SIGConfig().Sub(device.DESMQTTClient)
-	device.MQTTSubscription_DeviceClient_SIGEvent().Sub(device.DESMQTTClient)
-	device.MQTTSubscription_DeviceClient_SIGSample().Sub(device.DESMQTTClient)
-	// device.MQTTSubscription_DeviceClient_SIGDiagSample() //.Sub(device.DESMQTTClient)
+	for _, sub := range device.MQTTSubscriptions_DeviceClient() {
+		sub.Sub(device.DESMQTTClient)
+	}
 
 	return err
 }
@@ -56,16 +49,9 @@ func (device *Device) MQTTDeviceClient_Disconnect() (err error) {
 
 	if device.DESMQTTClient.Client != nil {
 		/* UNSUBSCRIBE FROM ALL MQTTSubscriptions */
-		device.MQTTSubscription_DeviceClient_SIGStartJob().UnSub(device.DESMQTTClient)
-		device.MQTTSubscription_DeviceClient_SIGEndJob().UnSub(device.DESMQTTClient)
-		device.MQTTSubscription_DeviceClient_SIGDevicePing().UnSub(device.DESMQTTClient)
-		device.MQTTSubscription_DeviceClient_SIGAdmin().UnSub(device.DESMQTTClient)
-		device.MQTTSubscription_DeviceClient_SIGState().UnSub(device.DESMQTTClient)
-		device.MQTTSubscription_DeviceClient_SIGHeader().UnSub(device.DESMQTTClient)
-		device.MQTTSubscription_DeviceClient_SIGConfig().UnSub(device.DESMQTTClient)
-		device.MQTTSubscription_DeviceClient_SIGEvent().UnSub(device.DESMQTTClient)
-		device.MQTTSubscription_DeviceClient_SIGSample().UnSub(device.DESMQTTClient)
-		// device.MQTTSubscription_DeviceClient_SIGDiagSample() //.UnSub(device.DESMQTTClient)
+		for _, sub := range device.MQTTSubscriptions_DeviceClient() {
+			sub.UnSub(device.DESMQTTClient)
+		}
 	}
 	/* DISCONNECT THE DESMQTTCLient */
 	device.DESMQTTClient_Disconnect()
@@ -74,8 +60,65 @@ func (device *Device) MQTTDeviceClient_Disconnect() (err error) {
 	return
 }
 
+/*
+	EMBEDDED BROKER ACL FOR THIS DEVICE
+
+THE DEVICE CONNECTS AS ITS SERIAL NUMBER, USING ITS OWN BROKER SECRET ( SEE IssueBrokerSecret )
+  - ITS CLIENT ID IS ITS SERIAL NUMBER OR <class>-<version>-<serial>
+  - PUBLISHES ONLY TO ITS OWN SIGNAL TOPICS
+  - SUBSCRIBES ONLY TO ITS OWN COMMAND TOPICS
+*/
+func (device *Device) MQTTBrokerACL() pkg.MQTTBrokerACL {
+	return pkg.MQTTBrokerACL{
+		ClientIDs: []string{
+			device.DESDevSerial,
+			fmt.Sprintf("%s-%s-%s", device.DESDevClass, device.DESDevVersion, device.DESDevSerial),
+		},
+		Pub: []string{fmt.Sprintf("%s/#", device.MQTTTopic_SIGRoot())},
+		Sub: []string{fmt.Sprintf("%s/#", device.MQTTTopic_CMDRoot())},
+	}
+}
+
+/*
+	RETURNS THE BODY OF A MESSAGE FROM THE DEVICE ( SEE pkg.VerifyDeviceMessage )
+
+UNSIGNED, FORGED, DUPLICATE AND REPLAYED MESSAGES ARE DEAD-LETTERED ( SEE pkg.DeadLetter )
+*/
+func (device *Device) SIGPayload(msg phao.Message) (payload []byte, ok bool) {
+
+	var err error
+	if r, ok := msg.(*pkg.DESReplayMessage); ok {
+		/* A DEAD LETTER MUST STILL PASS THE SIGNATURE AND SEQUENCE CHECKS ( SEE pkg.VerifyDeviceReplay ) */
+		payload, err = pkg.VerifyDeviceReplay(device.DESDevSerial, r.DL)
+	} else {
+		payload, err = pkg.VerifyDeviceMessage(device.DESDevSerial, msg.Topic(), msg.Payload())
+	}
+	if err != nil {
+		pkg.DeadLetter(device.DESDevSerial, msg, err)
+		return nil, false
+	}
+	return payload, true
+}
+
 /* SUBSCRIPTIONS ****************************************************************************************/
 
+/* ALL SUBSCRIPTIONS OF THE DES DEVICE CLIENT */
+func (device *Device) MQTTSubscriptions_DeviceClient() []pkg.MQTTSubscription {
+	return []pkg.MQTTSubscription{
+		device.MQTTSubscription_DeviceClient_SIGStartJob(),
+		device.MQTTSubscription_DeviceClient_SIGEndJob(),
+		device.MQTTSubscription_DeviceClient_SIGDevicePing(),
+		device.MQTTSubscription_DeviceClient_SIGAdmin(),
+		device.MQTTSubscription_DeviceClient_SIGState(),
+		device.MQTTSubscription_DeviceClient_SIGHeader(),
+		device.MQTTSubscription_DeviceClient_SIGConfig(),
+		device.MQTTSubscription_DeviceClient_SIGEvent(),
+		device.MQTTSubscription_DeviceClient_SIGSample(),
+		device.MQTTSubscription_DeviceClient_SIGFlash(),
+		// device.MQTTSubscription_DeviceClient_SIGDiagSample(),
+	}
+}
+
 /* SUBSCRIPTION -> START JOB  -> UPON RECEIPT, WRITE TO JOB DATABASE */
 func (device *Device) MQTTSubscription_DeviceClient_SIGStartJob() pkg.MQTTSubscription {
 	return pkg.MQTTSubscription{
@@ -84,17 +127,25 @@ func (device *Device) MQTTSubscription_DeviceClient_SIGStartJob() pkg.MQTTSubscr
 		Topic: device.MQTTTopic_SIGStartJob(),
 		Handler: func(c phao.Client, msg phao.Message) {
 
+			/* VERIFY THE DEVICE'S SIGNATURE AND SEQUENCE */
+			payload, ok := device.SIGPayload(msg)
+			if !ok {
+				return
+			}
+
 			/* PARSE / STORE THE ADMIN IN CMDARCHIVE */
 			start := StartJob{}
-			if err := json.Unmarshal(msg.Payload(), &start); err != nil {
-				pkg.LogErr(err)
+			if err := DecodePayload(payload, &start); err != nil {
+				pkg.DeadLetter(device.DESDevSerial, msg, err)
+				return
 			}
 			/* VALIDATE */
-			if err := start.SIGValidate(device); err != nil { 
-				go pkg.LogDESError(device.DESDevSerial, err.Error(), start)
+			if err := start.SIGValidate(device, pkg.MQTTMessageRequest(msg)); err != nil { 
+				pkg.DeadLetter(device.DESDevSerial, msg, err)
 			} else {
+				device.SetDeviceEncoding(start.STA)
 				if err := device.StartJob(start); err != nil {
-					go pkg.LogDESError(device.DESDevSerial, err.Error(), start)
+					pkg.DeadLetter(device.DESDevSerial, msg, err)
 				}
 			} 
 		},
@@ -109,16 +160,24 @@ func (device *Device) MQTTSubscription_DeviceClient_SIGEndJob() pkg.MQTTSubscrip
 		Topic: device.MQTTTopic_SIGEndJob(),
 		Handler: func(c phao.Client, msg phao.Message) {
 
+			/* VERIFY THE DEVICE'S SIGNATURE AND SEQUENCE */
+			payload, ok := device.SIGPayload(msg)
+			if !ok {
+				return
+			}
+
 			/* PARSE / STORE THE ADMIN IN CMDARCHIVE */
 			sta := State{}
-			if err := json.Unmarshal(msg.Payload(), &sta); err != nil {
-				pkg.LogErr(err)
+			if err := DecodePayload(payload, &sta); err != nil {
+				pkg.DeadLetter(device.DESDevSerial, msg, err)
+				return
 			}
 
 			/* VALIDATE */
-			if err := sta.SIGValidate(device); err != nil { 
-				go pkg.LogDESError(device.DESDevSerial, err.Error(), sta)
+			if err := sta.SIGValidate(device, pkg.MQTTMessageRequest(msg)); err != nil { 
+				pkg.DeadLetter(device.DESDevSerial, msg, err)
 			} else { 
+				device.SetDeviceEncoding(sta)
 				device.EndJob(sta)
 			}
 
@@ -134,18 +193,30 @@ func (device *Device) MQTTSubscription_DeviceClient_SIGDevicePing() pkg.MQTTSubs
 		Topic: device.MQTTTopic_SIGDevicePing(),
 		Handler: func(c phao.Client, msg phao.Message) {
 
-			/* TODO : PARSE THE PING MESSAGE
-			TODO : CHECK LATENCEY BETWEEN DEVICE PING TIME AND SERVER TIME
-			- IGNORE THE RECEIVED DEVICE TIME FOR NOW,
-			- WE DON'T REALLY CARE FOR KEEP-ALIVE PURPOSES
-
-			// if err := json.Unmarshal(msg.Payload(), &ping); err != nil {
-			// 	pkg.LogErr(err)
-			// }
-			*/
-			ping := pkg.Ping{
-				Time: time.Now().UTC().UnixMilli(),
-				OK:   true,
+			/* VERIFY THE DEVICE'S SIGNATURE AND SEQUENCE */
+			payload, ok := device.SIGPayload(msg)
+			if !ok {
+				return
+			}
+
+			/* PARSE THE PING */
+			ping := pkg.Ping{}
+			if err := DecodePayload(payload, &ping); err != nil {
+				pkg.DeadLetter(device.DESDevSerial, msg, err)
+				return
+			}
+
+			if !pkg.IsReplayMessage(msg) {
+				/* TODO : CHECK LATENCEY BETWEEN DEVICE PING TIME AND SERVER TIME
+				- IGNORE THE RECEIVED DEVICE TIME FOR NOW,
+				- WE DON'T REALLY CARE FOR KEEP-ALIVE PURPOSES
+				*/
+				ping.Time = time.Now().UTC().UnixMilli()
+				ping.OK = true
+
+			} else if ping.Time <= DevicePingsMapRead(device.DESDevSerial).Time {
+				/* A REPLAYED PING OLDER THAN THE LAST PING DOES NOT CHANGE THE DEVICE STATUS */
+				return
 			}
 
 			/* UPDATE THE DevicesPingMap - DO NOT CALL IN GOROUTINE */
@@ -162,15 +233,22 @@ func (device *Device) MQTTSubscription_DeviceClient_SIGAdmin() pkg.MQTTSubscript
 		Topic: device.MQTTTopic_SIGAdmin(),
 		Handler: func(c phao.Client, msg phao.Message) {
 
+			/* VERIFY THE DEVICE'S SIGNATURE AND SEQUENCE */
+			payload, ok := device.SIGPayload(msg)
+			if !ok {
+				return
+			}
+
 			/* PARSE / STORE THE ADMIN IN CMDARCHIVE */
 			adm := Admin{}
-			if err := json.Unmarshal(msg.Payload(), &adm); err != nil {
-				pkg.LogErr(err)
+			if err := DecodePayload(payload, &adm); err != nil {
+				pkg.DeadLetter(device.DESDevSerial, msg, err)
+				return
 			}
 
 			/* VALIDATE */
-			if err := adm.SIGValidate(device); err != nil { 
-				go pkg.LogDESError(device.DESDevSerial, err.Error(), adm)
+			if err := adm.SIGValidate(device, pkg.MQTTMessageRequest(msg)); err != nil { 
+				pkg.DeadLetter(device.DESDevSerial, msg, err)
 			} else {
 				/* CALL DB WRITE IN GOROUTINE */
 				go WriteADM(adm, &device.CmdDBC)
@@ -186,6 +264,9 @@ func (device *Device) MQTTSubscription_DeviceClient_SIGAdmin() pkg.MQTTSubscript
 
 				/* UPDATE THE DevicesMap - DO NOT CALL IN GOROUTINE  */
 				device.UpdateMappedADM()
+
+				/* ACKNOWLEDGE PENDING BULK COMMANDS */
+				go device.CheckBulkAck(FLASH_TYPE_ADM, adm)
 			}
 		},
 	}
@@ -199,15 +280,22 @@ func (device *Device) MQTTSubscription_DeviceClient_SIGState() pkg.MQTTSubscript
 		Topic: device.MQTTTopic_SIGState(),
 		Handler: func(c phao.Client, msg phao.Message) {
 
+			/* VERIFY THE DEVICE'S SIGNATURE AND SEQUENCE */
+			payload, ok := device.SIGPayload(msg)
+			if !ok {
+				return
+			}
+
 			/* PARSE / STORE THE STATE IN CMDARCHIVE */
 			sta := State{}
-			if err := json.Unmarshal(msg.Payload(), &sta); err != nil {
-				pkg.LogErr(err)
+			if err := DecodePayload(payload, &sta); err != nil {
+				pkg.DeadLetter(device.DESDevSerial, msg, err)
+				return
 			}
 
 			/* VALIDATE */
-			if err := sta.SIGValidate(device); err != nil { 
-				go pkg.LogDESError(device.DESDevSerial, err.Error(), sta)
+			if err := sta.SIGValidate(device, pkg.MQTTMessageRequest(msg)); err != nil { 
+				pkg.DeadLetter(device.DESDevSerial, msg, err)
 			} else {
 				/* CALL DB WRITE IN GOROUTINE */
 				go WriteSTA(sta, &device.CmdDBC)
@@ -219,9 +307,13 @@ func (device *Device) MQTTSubscription_DeviceClient_SIGState() pkg.MQTTSubscript
 				}
 
 				device.STA = sta
+				device.SetDeviceEncoding(sta)
 
 				/* UPDATE THE DevicesMap - DO NOT CALL IN GOROUTINE  */
 				device.UpdateMappedSTA()
+
+				/* RECORD REPORTED FIRMWARE VERSIONS; SEND PENDING FIRMWARE */
+				go device.UpdateFirmwareInventory(sta)
 			}
 		},
 	}
@@ -235,15 +327,22 @@ func (device *Device) MQTTSubscription_DeviceClient_SIGHeader() pkg.MQTTSubscrip
 		Topic: device.MQTTTopic_SIGHeader(),
 		Handler: func(c phao.Client, msg phao.Message) {
 
+			/* VERIFY THE DEVICE'S SIGNATURE AND SEQUENCE */
+			payload, ok := device.SIGPayload(msg)
+			if !ok {
+				return
+			}
+
 			/* PARSE / STORE THE HEADER IN CMDARCHIVE */
 			hdr := Header{}
-			if err := json.Unmarshal(msg.Payload(), &hdr); err != nil {
-				pkg.LogErr(err)
+			if err := DecodePayload(payload, &hdr); err != nil {
+				pkg.DeadLetter(device.DESDevSerial, msg, err)
+				return
 			}
 
 			/* VALIDATE */
-			if err := hdr.SIGValidate(device); err != nil { 
-				go pkg.LogDESError(device.DESDevSerial, err.Error(), hdr)
+			if err := hdr.SIGValidate(device, pkg.MQTTMessageRequest(msg)); err != nil { 
+				pkg.DeadLetter(device.DESDevSerial, msg, err)
 			} else {
 				/* CALL DB WRITE IN GOROUTINE */
 				go WriteHDR(hdr, &device.CmdDBC)
@@ -264,6 +363,16 @@ func (device *Device) MQTTSubscription_DeviceClient_SIGHeader() pkg.MQTTSubscrip
 
 				/* UPDATE THE DevicesMap - DO NOT CALL IN GOROUTINE  */
 				device.UpdateMappedHDR()
+
+				/* ACKNOWLEDGE PENDING BULK COMMANDS */
+				go device.CheckBulkAck(FLASH_TYPE_HDR, hdr)
+
+				/* RECORD THE LOCATION; CHECK THE JOB'S GEOFENCE */
+				if active := device.STA.StaLogging > OP_CODE_JOB_START_REQ; active {
+					QueueDeviceLocation(device.DESDevSerial, device.DESJobName, active, hdr)
+				} else {
+					QueueDeviceLocation(device.DESDevSerial, device.CmdArchiveName(), active, hdr)
+				}
 			}
 		},
 	}
@@ -277,15 +386,22 @@ func (device *Device) MQTTSubscription_DeviceClient_SIGConfig() pkg.MQTTSubscrip
 		Topic: device.MQTTTopic_SIGConfig(),
 		Handler: func(c phao.Client, msg phao.Message) {
 
+			/* VERIFY THE DEVICE'S SIGNATURE AND SEQUENCE */
+			payload, ok := device.SIGPayload(msg)
+			if !ok {
+				return
+			}
+
 			/* PARSE / STORE THE CONFIG IN CMDARCHIVE */
 			cfg := Config{}
-			if err := json.Unmarshal(msg.Payload(), &cfg); err != nil {
-				pkg.LogErr(err)
+			if err := DecodePayload(payload, &cfg); err != nil {
+				pkg.DeadLetter(device.DESDevSerial, msg, err)
+				return
 			}
 
 			/* VALIDATE */
-			if err := cfg.SIGValidate(device); err != nil { 
-				go pkg.LogDESError(device.DESDevSerial, err.Error(), cfg)
+			if err := cfg.SIGValidate(device, pkg.MQTTMessageRequest(msg)); err != nil { 
+				pkg.DeadLetter(device.DESDevSerial, msg, err)
 			} else {
 				/* CALL DB WRITE IN GOROUTINE */
 				go WriteCFG(cfg, &device.CmdDBC)
@@ -301,6 +417,9 @@ func (device *Device) MQTTSubscription_DeviceClient_SIGConfig() pkg.MQTTSubscrip
 
 				/* UPDATE THE DevicesMap - DO NOT CALL IN GOROUTINE  */
 				device.UpdateMappedCFG()
+
+				/* ACKNOWLEDGE PENDING BULK COMMANDS */
+				go device.CheckBulkAck(FLASH_TYPE_CFG, cfg)
 			}
 		},
 	}
@@ -314,16 +433,23 @@ func (device *Device) MQTTSubscription_DeviceClient_SIGEvent() pkg.MQTTSubscript
 		Topic: device.MQTTTopic_SIGEvent(),
 		Handler: func(c phao.Client, msg phao.Message) {
 
+			/* VERIFY THE DEVICE'S SIGNATURE AND SEQUENCE */
+			payload, ok := device.SIGPayload(msg)
+			if !ok {
+				return
+			}
+
 			/* PARSE / STORE THE EVENT IN CMDARCHIVE */
 			evt := Event{}
 
-			if err := json.Unmarshal(msg.Payload(), &evt); err != nil {
-				pkg.LogErr(err)
+			if err := DecodePayload(payload, &evt); err != nil {
+				pkg.DeadLetter(device.DESDevSerial, msg, err)
+				return
 			}
 
 			/* VALIDATE */
-			if err := evt.SIGValidate(device); err != nil { 
-				go pkg.LogDESError(device.DESDevSerial, err.Error(), evt)
+			if err := evt.SIGValidate(device, pkg.MQTTMessageRequest(msg)); err != nil { 
+				pkg.DeadLetter(device.DESDevSerial, msg, err)
 			} else {
 				/* CALL DB WRITE IN GOROUTINE */
 				go WriteEVT(evt, &device.CmdDBC)
@@ -339,6 +465,21 @@ func (device *Device) MQTTSubscription_DeviceClient_SIGEvent() pkg.MQTTSubscript
 
 				/* UPDATE THE DevicesMap - DO NOT CALL IN GOROUTINE  */
 				device.UpdateMappedEVT()
+
+				/* RECORD FIRMWARE UPDATE PROGRESS / OUTCOME */
+				if IsFirmwareEvent(evt.EvtCode) {
+					go device.HandleFirmwareEvent(evt)
+				}
+
+				/* THE NEXT HEADER CARRIES A GPS FIX */
+				if evt.EvtCode == OP_CODE_GPS_ACQ {
+					GPSAcqsMapWrite(device.DESDevSerial, evt.EvtTime)
+				}
+
+				/* A DEVICE TRANSFERRED FROM ANOTHER DES HAS ARRIVED */
+				if evt.EvtCode == OP_CODE_DES_REGISTERED {
+					go device.ConfirmDeviceTransfer()
+				}
 			}
 		},
 	}
@@ -352,13 +493,79 @@ func (device *Device) MQTTSubscription_DeviceClient_SIGSample() pkg.MQTTSubscrip
 		Topic: device.MQTTTopic_SIGSample(),
 		Handler: func(c phao.Client, msg phao.Message) {
 
+			/* VERIFY THE DEVICE'S SIGNATURE AND SEQUENCE */
+			payload, ok := device.SIGPayload(msg)
+			if !ok {
+				return
+			}
+
 			/* DECODE THE PAYLOAD INTO AN MQTT_Sample */
 			mqtts := MQTT_Sample{}
-			if err := json.Unmarshal(msg.Payload(), &mqtts); err != nil {
-				pkg.LogErr(err)
+			if err := DecodePayload(payload, &mqtts); err != nil {
+				pkg.DeadLetter(device.DESDevSerial, msg, err)
+				return
 			} // pkg.Json("MQTTSubscription_DeviceClient_SIGSample(...) ->  mqtts :", mqtts)
 
-			device.HandleMQTTSample(mqtts)
+			if err := device.HandleMQTTSample(mqtts); err != nil {
+				pkg.DeadLetter(device.DESDevSerial, msg, err)
+			}
+		},
+	}
+}
+
+/*
+	SUBSCRIPTION -> FLASH -> UPON RECEIPT, ADD THE CHUNK TO THE DEVICE'S FLASH TRANSFER
+
+EVERY CHUNK IS ACKNOWLEDGED ( MQTTPublication_DeviceClient_DESFlashAck ) BEFORE THE DEVICE SENDS THE NEXT
+WHEN THE LAST CHUNK IS RECEIVED, BACKFILL THE JOB DATABASES AND PUBLISH THE SUMMARY
+*/
+func (device *Device) MQTTSubscription_DeviceClient_SIGFlash() pkg.MQTTSubscription {
+	return pkg.MQTTSubscription{
+
+		Qos:   1,
+		Topic: device.MQTTTopic_SIGFlash(),
+		Handler: func(c phao.Client, msg phao.Message) {
+
+			/* VERIFY THE DEVICE'S SIGNATURE AND SEQUENCE */
+			payload, ok := device.SIGPayload(msg)
+			if !ok {
+				return
+			}
+
+			/* DECODE THE PAYLOAD INTO A FlashChunk */
+			chunk := FlashChunk{}
+			if err := DecodePayload(payload, &chunk); err != nil {
+				pkg.DeadLetter(device.DESDevSerial, msg, err)
+				return
+			}
+
+			ft, done, dup, err := device.AppendFlashChunk(chunk)
+			if err != nil {
+				pkg.LogErr(err)
+				device.MQTTPublication_DeviceClient_DESFlashAck(FlashChunkAck{
+					JobName: chunk.JobName,
+					Seq:     chunk.Seq,
+					Err:     err.Error(),
+				})
+				device.MQTTPublication_DeviceClient_DESFlash(FlashUploadSummary{
+					DESDevSerial: device.DESDevSerial,
+					Err:          err.Error(),
+				})
+				return
+			}
+
+			device.MQTTPublication_DeviceClient_DESFlashAck(FlashChunkAck{
+				JobName: ft.JobName,
+				Seq:     chunk.Seq,
+				Next:    ft.Seq,
+			})
+
+			if done && !dup {
+				/* DB WRITES MAY TAKE A WHILE; DON'T BLOCK THE CLIENT */
+				go func() {
+					device.MQTTPublication_DeviceClient_DESFlash(device.HandleFlashTransfer(ft))
+				}()
+			}
 		},
 	}
 }
@@ -430,8 +637,61 @@ func (device *Device) MQTTPublication_DeviceClient_DESDevicePing(ping pkg.Ping)
 }
 
 
+/*
+	DES PUBLICATION -> FLASH UPLOAD SUMMARY
+
+SENT BY THE DES TO THE DEVICE AND USER CLIENTS (WS) WHEN A FLASH TRANSFER HAS BEEN PROCESSED
+*/
+func (device *Device) MQTTPublication_DeviceClient_DESFlash(sum FlashUploadSummary) {
+
+	json, err := pkg.ModelToJSONString(sum)
+	if err != nil {
+		pkg.LogErr(err)
+	}
+
+	des := pkg.MQTTPublication{
+		Topic:    device.MQTTTopic_DESFlash(),
+		Message:  json,
+		Retained: false,
+		WaitMS:   0,
+		Qos:      0,
+	}
+
+	des.Pub(device.DESMQTTClient)
+}
+
+/*
+	DES PUBLICATION -> FLASH CHUNK ACK
+
+SENT BY THE DES TO THE DEVICE FOR EVERY FLASH CHUNK RECEIVED; QoS 1 SO THE DEVICE IS NOT LEFT WAITING ON A LOST ACK
+*/
+func (device *Device) MQTTPublication_DeviceClient_DESFlashAck(ack FlashChunkAck) {
+
+	json, err := pkg.ModelToJSONString(ack)
+	if err != nil {
+		pkg.LogErr(err)
+	}
+
+	des := pkg.MQTTPublication{
+		Topic:    device.MQTTTopic_DESFlashAck(),
+		Message:  json,
+		Retained: false,
+		WaitMS:   0,
+		Qos:      1,
+	}
+
+	des.Pub(device.DESMQTTClient)
+}
+
 /* CMD PUBLICATIONS **************************************************************************************/
 
+/*
+	COMMANDS EXPIRE ON THE BROKER IF NOT DELIVERED WITHIN CMD_EXPIRY_SEC ( MQTT 5 )
+
+A DEVICE THAT RECONNECTS LATER MUST NOT ACT ON A STALE COMMAND
+*/
+const CMD_EXPIRY_SEC = 60
+
 /* PUBLICATION -> START JOB */
 func (device *Device) MQTTPublication_DeviceClient_CMDStartJob() {
 
@@ -443,17 +703,19 @@ func (device *Device) MQTTPublication_DeviceClient_CMDStartJob() {
 		EVT: device.EVT,
 	}
 
-	json, err := pkg.ModelToJSONString(start)
+	json, err := device.EncodeCMD(start)
 	if err != nil {
 		pkg.LogErr(err)
 	}
 
 	cmd := pkg.MQTTPublication{
-		Topic:    device.MQTTTopic_CMDStartJob(),
-		Message:  json,
-		Retained: false,
-		WaitMS:   0,
-		Qos:      0,
+		Topic:         device.MQTTTopic_CMDStartJob(),
+		Message:       json,
+		Retained:      false,
+		WaitMS:        0,
+		Qos:           0,
+		ResponseTopic: device.MQTTTopic_SIGStartJob(),
+		ExpirySec:     CMD_EXPIRY_SEC,
 	} // pkg.Json("(dev *Device) MQTTPublication_DeviceClient_CMDAdmin(): -> cmd", cmd)
 
 	cmd.Pub(device.DESMQTTClient)
@@ -462,17 +724,19 @@ func (device *Device) MQTTPublication_DeviceClient_CMDStartJob() {
 /* PUBLICATION -> END JOB */
 func (device *Device) MQTTPublication_DeviceClient_CMDEndJob(evt Event) {
 
-	json, err := pkg.ModelToJSONString(evt)
+	json, err := device.EncodeCMD(evt)
 	if err != nil {
 		pkg.LogErr(err)
 	}
 
 	cmd := pkg.MQTTPublication{
-		Topic:    device.MQTTTopic_CMDEndJob(),
-		Message:  json,
-		Retained: false,
-		WaitMS:   0,
-		Qos:      0,
+		Topic:         device.MQTTTopic_CMDEndJob(),
+		Message:       json,
+		Retained:      false,
+		WaitMS:        0,
+		Qos:           0,
+		ResponseTopic: device.MQTTTopic_SIGEndJob(),
+		ExpirySec:     CMD_EXPIRY_SEC,
 	} // pkg.Json("(dev *Device) MQTTPublication_DeviceClient_CMDEndJob(): -> cmd", cmd)
 
 	cmd.Pub(device.DESMQTTClient)
@@ -495,17 +759,20 @@ func (device *Device) MQTTPublication_DeviceClient_CMDReport() {
 /* PUBLICATION -> ADMINISTRATION */
 func (device *Device) MQTTPublication_DeviceClient_CMDAdmin(adm Admin) {
 
-	json, err := pkg.ModelToJSONString(adm)
+	json, err := device.EncodeCMD(adm)
 	if err != nil {
 		pkg.LogErr(err)
 	}
 
 	cmd := pkg.MQTTPublication{
-		Topic:    device.MQTTTopic_CMDAdmin(),
-		Message:  json,
-		Retained: false,
-		WaitMS:   0,
-		Qos:      0,
+		Topic:           device.MQTTTopic_CMDAdmin(),
+		Message:         json,
+		Retained:        false,
+		WaitMS:          0,
+		Qos:             0,
+		ResponseTopic:   device.MQTTTopic_SIGAdmin(),
+		CorrelationData: adm.AdmReqID,
+		ExpirySec:       CMD_EXPIRY_SEC,
 	} // pkg.Json("(dev *Device) MQTTPublication_DeviceClient_CMDAdmin(): -> cmd", cmd)
 
 	cmd.Pub(device.DESMQTTClient)
@@ -514,17 +781,19 @@ func (device *Device) MQTTPublication_DeviceClient_CMDAdmin(adm Admin) {
 /* PUBLICATION -> STATE */
 func (device *Device) MQTTPublication_DeviceClient_CMDState(sta State) {
 
-	json, err := pkg.ModelToJSONString(sta)
+	json, err := device.EncodeCMD(sta)
 	if err != nil {
 		pkg.LogErr(err)
 	}
 
 	cmd := pkg.MQTTPublication{
-		Topic:    device.MQTTTopic_CMDState(),
-		Message:  json,
-		Retained: false,
-		WaitMS:   0,
-		Qos:      0,
+		Topic:         device.MQTTTopic_CMDState(),
+		Message:       json,
+		Retained:      false,
+		WaitMS:        0,
+		Qos:           0,
+		ResponseTopic: device.MQTTTopic_SIGState(),
+		ExpirySec:     CMD_EXPIRY_SEC,
 	} // pkg.Json("(dev *Device) MQTTPublication_DeviceClient_CMDState(): -> sta", sta)
 
 	cmd.Pub(device.DESMQTTClient)
@@ -533,17 +802,20 @@ func (device *Device) MQTTPublication_DeviceClient_CMDState(sta State) {
 /* PUBLICATION -> HEADER */
 func (device *Device) MQTTPublication_DeviceClient_CMDHeader(hdr Header) {
 
-	json, err := pkg.ModelToJSONString(hdr)
+	json, err := device.EncodeCMD(hdr)
 	if err != nil {
 		pkg.LogErr(err)
 	}
 
 	cmd := pkg.MQTTPublication{
-		Topic:    device.MQTTTopic_CMDHeader(),
-		Message:  json,
-		Retained: false,
-		WaitMS:   0,
-		Qos:      0,
+		Topic:           device.MQTTTopic_CMDHeader(),
+		Message:         json,
+		Retained:        false,
+		WaitMS:          0,
+		Qos:             0,
+		ResponseTopic:   device.MQTTTopic_SIGHeader(),
+		CorrelationData: hdr.HdrReqID,
+		ExpirySec:       CMD_EXPIRY_SEC,
 	}
 
 	cmd.Pub(device.DESMQTTClient)
@@ -552,17 +824,20 @@ func (device *Device) MQTTPublication_DeviceClient_CMDHeader(hdr Header) {
 /* PUBLICATION -> CONFIGURATION */
 func (device *Device) MQTTPublication_DeviceClient_CMDConfig(cfg Config) {
 
-	json, err := pkg.ModelToJSONString(cfg)
+	json, err := device.EncodeCMD(cfg)
 	if err != nil {
 		pkg.LogErr(err)
 	}
 
 	cmd := pkg.MQTTPublication{
-		Topic:    device.MQTTTopic_CMDConfig(),
-		Message:  json,
-		Retained: false,
-		WaitMS:   0,
-		Qos:      0,
+		Topic:           device.MQTTTopic_CMDConfig(),
+		Message:         json,
+		Retained:        false,
+		WaitMS:          0,
+		Qos:             0,
+		ResponseTopic:   device.MQTTTopic_SIGConfig(),
+		CorrelationData: cfg.CfgReqID,
+		ExpirySec:       CMD_EXPIRY_SEC,
 	}
 
 	cmd.Pub(device.DESMQTTClient)
@@ -571,36 +846,86 @@ func (device *Device) MQTTPublication_DeviceClient_CMDConfig(cfg Config) {
 /* PUBLICATION -> EVENT */
 func (device *Device) MQTTPublication_DeviceClient_CMDEvent(evt Event) {
 
-	json, err := pkg.ModelToJSONString(evt)
+	json, err := device.EncodeCMD(evt)
 	if err != nil {
 		pkg.LogErr(err)
 	}
 
 	cmd := pkg.MQTTPublication{
-		Topic:    device.MQTTTopic_CMDEvent(),
-		Message:  json,
-		Retained: false,
-		WaitMS:   0,
-		Qos:      0,
+		Topic:         device.MQTTTopic_CMDEvent(),
+		Message:       json,
+		Retained:      false,
+		WaitMS:        0,
+		Qos:           0,
+		ResponseTopic: device.MQTTTopic_SIGEvent(),
+		ExpirySec:     CMD_EXPIRY_SEC,
 	}
 
 	cmd.Pub(device.DESMQTTClient)
 }
 
+/* PUBLICATION -> FIRMWARE IMAGE IN FirmwareChunks; QOS 1 SO EACH CHUNK IS ACKNOWLEDGED BEFORE THE NEXT IS SENT */
+func (device *Device) MQTTPublication_DeviceClient_CMDFirmware(fw pkg.DESFirmware, img []byte) {
+
+	total := int32((len(img) + FW_CHUNK_SIZE - 1) / FW_CHUNK_SIZE)
+	for seq := int32(0); seq < total; seq++ {
+
+		end := int(seq+1) * FW_CHUNK_SIZE
+		if end > len(img) {
+			end = len(img)
+		}
+
+		chunk := FirmwareChunk{
+			FwID:    fw.DESFwID,
+			Type:    fw.DESFwType,
+			Release: fw.DESFwRelease,
+			SHA256:  fw.DESFwSHA256,
+			Size:    fw.DESFwSize,
+			Seq:     seq,
+			Total:   total,
+			Data:    base64.URLEncoding.EncodeToString(img[int(seq)*FW_CHUNK_SIZE : end]),
+		}
+
+		json, err := device.EncodeCMD(chunk)
+		if err != nil {
+			pkg.LogErr(err)
+			return
+		}
+
+		cmd := pkg.MQTTPublication{
+			Topic:    device.MQTTTopic_CMDFirmware(),
+			Message:  json,
+			Retained: false,
+			WaitMS:   0,
+			Qos:      1,
+		}
+
+		/* THE LAST CHUNK EXPECTS OP_CODE_FW_RECEIVED OR OP_CODE_FW_FAILED */
+		if seq == total-1 {
+			cmd.ResponseTopic = device.MQTTTopic_SIGEvent()
+			cmd.ExpirySec = CMD_EXPIRY_SEC
+		}
+
+		cmd.Pub(device.DESMQTTClient)
+	}
+}
+
 /* PUBLICATION -> MESSAGE LIMIT TEST ***TODO: REMOVE AFTER DEVELOPMENT*** */
 func (device *Device) MQTTPublication_DeviceClient_CMDMsgLimit(msg MsgLimit) {
 
-	json, err := pkg.ModelToJSONString(msg)
+	json, err := device.EncodeCMD(msg)
 	if err != nil {
 		pkg.LogErr(err)
 	}
 
 	cmd := pkg.MQTTPublication{
-		Topic:    device.MQTTTopic_CMDMsgLimit(),
-		Message:  json,
-		Retained: false,
-		WaitMS:   0,
-		Qos:      0,
+		Topic:         device.MQTTTopic_CMDMsgLimit(),
+		Message:       json,
+		Retained:      false,
+		WaitMS:        0,
+		Qos:           0,
+		ResponseTopic: device.MQTTTopic_SIGMsgLimit(),
+		ExpirySec:     CMD_EXPIRY_SEC,
 	}
 
 	cmd.Pub(device.DESMQTTClient)
@@ -93,7 +93,12 @@ func (duc *DeviceUserClient) MQTTSubscription_DeviceUserClient_StartJob(topic st
 
 			/* DECODE MESSAGE PAYLOAD TO Admin STRUCT */
 			start := StartJob{}
-			if err := json.Unmarshal(msg.Payload(), &start); err != nil {
+			/* UNWRAP SIGNED DEVICE MESSAGES; FORGERIES ARE RECORDED BY THE DES DEVICE CLIENT */
+			payload, err := pkg.OpenDeviceMessage(duc.DESDevSerial, msg.Topic(), msg.Payload())
+			if err != nil {
+				return
+			}
+			if err := DecodePayload(payload, &start); err != nil {
 				pkg.LogErr(err)
 			}
 
@@ -119,7 +124,12 @@ func (duc *DeviceUserClient) MQTTSubscription_DeviceUserClient_SIGEndJob() pkg.M
 
 			/* DECODE MESSAGE PAYLOAD TO Admin STRUCT */
 			sta := State{}
-			if err := json.Unmarshal(msg.Payload(), &sta); err != nil {
+			/* UNWRAP SIGNED DEVICE MESSAGES; FORGERIES ARE RECORDED BY THE DES DEVICE CLIENT */
+			payload, err := pkg.OpenDeviceMessage(duc.DESDevSerial, msg.Topic(), msg.Payload())
+			if err != nil {
+				return
+			}
+			if err := DecodePayload(payload, &sta); err != nil {
 				pkg.LogErr(err)
 			}
 
@@ -145,7 +155,12 @@ func (duc *DeviceUserClient) MQTTSubscription_DeviceUserClient_CMDEndJob() pkg.M
 
 			/* DECODE MESSAGE PAYLOAD TO Admin STRUCT */
 			evt := Event{}
-			if err := json.Unmarshal(msg.Payload(), &evt); err != nil {
+			/* UNWRAP SIGNED DEVICE MESSAGES; FORGERIES ARE RECORDED BY THE DES DEVICE CLIENT */
+			payload, err := pkg.OpenDeviceMessage(duc.DESDevSerial, msg.Topic(), msg.Payload())
+			if err != nil {
+				return
+			}
+			if err := DecodePayload(payload, &evt); err != nil {
 				pkg.LogErr(err)
 			}
 
@@ -173,7 +188,12 @@ func (duc *DeviceUserClient) MQTTSubscription_DeviceUserClient_DESDeviceClientPi
 
 			/* DECODE MESSAGE PAYLOAD TO Ping STRUCT */
 			ping := pkg.Ping{}
-			if err := json.Unmarshal(msg.Payload(), &ping); err != nil {
+			/* UNWRAP SIGNED DEVICE MESSAGES; FORGERIES ARE RECORDED BY THE DES DEVICE CLIENT */
+			payload, err := pkg.OpenDeviceMessage(duc.DESDevSerial, msg.Topic(), msg.Payload())
+			if err != nil {
+				return
+			}
+			if err := DecodePayload(payload, &ping); err != nil {
 				pkg.LogErr(err)
 			}
 
@@ -200,7 +220,12 @@ func (duc *DeviceUserClient) MQTTSubscription_DeviceUserClient_DESDevicePing( /*
 
 			/* DECODE MESSAGE PAYLOAD TO Ping STRUCT */
 			ping := pkg.Ping{}
-			if err := json.Unmarshal(msg.Payload(), &ping); err != nil {
+			/* UNWRAP SIGNED DEVICE MESSAGES; FORGERIES ARE RECORDED BY THE DES DEVICE CLIENT */
+			payload, err := pkg.OpenDeviceMessage(duc.DESDevSerial, msg.Topic(), msg.Payload())
+			if err != nil {
+				return
+			}
+			if err := DecodePayload(payload, &ping); err != nil {
 				pkg.LogErr(err)
 			}
 
@@ -227,7 +252,12 @@ func (duc *DeviceUserClient) MQTTSubscription_DeviceUserClient_SIGAdmin( /* TODO
 
 			/* DECODE MESSAGE PAYLOAD TO Admin STRUCT */
 			adm := Admin{}
-			if err := json.Unmarshal(msg.Payload(), &adm); err != nil {
+			/* UNWRAP SIGNED DEVICE MESSAGES; FORGERIES ARE RECORDED BY THE DES DEVICE CLIENT */
+			payload, err := pkg.OpenDeviceMessage(duc.DESDevSerial, msg.Topic(), msg.Payload())
+			if err != nil {
+				return
+			}
+			if err := DecodePayload(payload, &adm); err != nil {
 				pkg.LogErr(err)
 			}
 
@@ -254,7 +284,12 @@ func (duc *DeviceUserClient) MQTTSubscription_DeviceUserClient_SIGState( /* TODO
 
 			/* DECODE MESSAGE PAYLOAD TO State STRUCT */
 			sta := State{}
-			if err := json.Unmarshal(msg.Payload(), &sta); err != nil {
+			/* UNWRAP SIGNED DEVICE MESSAGES; FORGERIES ARE RECORDED BY THE DES DEVICE CLIENT */
+			payload, err := pkg.OpenDeviceMessage(duc.DESDevSerial, msg.Topic(), msg.Payload())
+			if err != nil {
+				return
+			}
+			if err := DecodePayload(payload, &sta); err != nil {
 				pkg.LogErr(err)
 			}
 
@@ -281,7 +316,12 @@ func (duc *DeviceUserClient) MQTTSubscription_DeviceUserClient_SIGHeader( /* TOD
 
 			/* DECODE MESSAGE PAYLOAD TO Header STRUCT */
 			hdr := Header{}
-			if err := json.Unmarshal(msg.Payload(), &hdr); err != nil {
+			/* UNWRAP SIGNED DEVICE MESSAGES; FORGERIES ARE RECORDED BY THE DES DEVICE CLIENT */
+			payload, err := pkg.OpenDeviceMessage(duc.DESDevSerial, msg.Topic(), msg.Payload())
+			if err != nil {
+				return
+			}
+			if err := DecodePayload(payload, &hdr); err != nil {
 				pkg.LogErr(err)
 			}
 
@@ -308,7 +348,12 @@ func (duc *DeviceUserClient) MQTTSubscription_DeviceUserClient_SIGConfig( /* TOD
 
 			/* DECODE MESSAGE PAYLOAD TO Config STRUCT */
 			cfg := Config{}
-			if err := json.Unmarshal(msg.Payload(), &cfg); err != nil {
+			/* UNWRAP SIGNED DEVICE MESSAGES; FORGERIES ARE RECORDED BY THE DES DEVICE CLIENT */
+			payload, err := pkg.OpenDeviceMessage(duc.DESDevSerial, msg.Topic(), msg.Payload())
+			if err != nil {
+				return
+			}
+			if err := DecodePayload(payload, &cfg); err != nil {
 				pkg.LogErr(err)
 			}
 
@@ -335,7 +380,12 @@ func (duc *DeviceUserClient) MQTTSubscription_DeviceUserClient_SIGEvent( /* TODO
 
 			/* DECODE MESSAGE PAYLOAD TO Event STRUCT */
 			evt := Event{}
-			if err := json.Unmarshal(msg.Payload(), &evt); err != nil {
+			/* UNWRAP SIGNED DEVICE MESSAGES; FORGERIES ARE RECORDED BY THE DES DEVICE CLIENT */
+			payload, err := pkg.OpenDeviceMessage(duc.DESDevSerial, msg.Topic(), msg.Payload())
+			if err != nil {
+				return
+			}
+			if err := DecodePayload(payload, &evt); err != nil {
 				pkg.LogErr(err)
 			}
 
@@ -362,7 +412,12 @@ func (duc *DeviceUserClient) MQTTSubscription_DeviceUserClient_SIGSample( /* TOD
 
 			/* DECODE THE PAYLOAD INTO AN MQTT_Sample */
 			mqtts := MQTT_Sample{}
-			if err := json.Unmarshal(msg.Payload(), &mqtts); err != nil {
+			/* UNWRAP SIGNED DEVICE MESSAGES; FORGERIES ARE RECORDED BY THE DES DEVICE CLIENT */
+			payload, err := pkg.OpenDeviceMessage(duc.DESDevSerial, msg.Topic(), msg.Payload())
+			if err != nil {
+				return
+			}
+			if err := DecodePayload(payload, &mqtts); err != nil {
 				pkg.LogErr(err)
 			} // pkg.Json("MQTTSubscription_DeviceUserClient_SIGSample(...) ->  mqtts :", mqtts)
 
@@ -412,7 +467,12 @@ func (duc *DeviceUserClient) MQTTSubscription_DeviceUserClient_SIGMsgLimit() pkg
 
 			/* PARSE MsgLimit IN CMDARCHIVE */
 			kafka := MsgLimit{}
-			if err := json.Unmarshal(msg.Payload(), &kafka); err != nil {
+			/* UNWRAP SIGNED DEVICE MESSAGES; FORGERIES ARE RECORDED BY THE DES DEVICE CLIENT */
+			payload, err := pkg.OpenDeviceMessage(duc.DESDevSerial, msg.Topic(), msg.Payload())
+			if err != nil {
+				return
+			}
+			if err := DecodePayload(payload, &kafka); err != nil {
 				pkg.LogErr(err)
 			}
 
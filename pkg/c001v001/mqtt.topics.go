@@ -49,6 +49,9 @@ func (device *Device) MQTTTopic_SIGSample() (topic string) {
 func (device *Device) MQTTTopic_SIGDiagSample() (topic string) {
 	return fmt.Sprintf("%s/diag_sample", device.MQTTTopic_SIGRoot())
 }
+func (device *Device) MQTTTopic_SIGFlash() (topic string) {
+	return fmt.Sprintf("%s/flash", device.MQTTTopic_SIGRoot())
+}
 
 /* DEVELOPMENT TOPIC ***TODO: REMOVE AFTER DEVELOPMENT*** */
 func (device *Device) MQTTTopic_SIGMsgLimit() (topc string) {
@@ -92,6 +95,9 @@ func (device *Device) MQTTTopic_CMDSample() (topic string) {
 func (device *Device) MQTTTopic_CMDDiagSample() (topic string) {
 	return fmt.Sprintf("%s/diag_sample", device.MQTTTopic_CMDRoot())
 }
+func (device *Device) MQTTTopic_CMDFirmware() (topic string) {
+	return fmt.Sprintf("%s/fw", device.MQTTTopic_CMDRoot())
+}
 
 /* DEVELOPMENT TOPIC ***TODO: REMOVE AFTER DEVELOPMENT*** */
 func (device *Device) MQTTTopic_CMDMsgLimit() (topc string) {
@@ -112,3 +118,11 @@ func (device *Device) MQTTTopic_DESDeviceClientPing() (topic string) {
 func (device *Device) MQTTTopic_DESDevicePing() (topic string) {
 	return fmt.Sprintf("%s/ping", device.MQTTTopic_DESRoot())
 }
+
+func (device *Device) MQTTTopic_DESFlash() (topic string) {
+	return fmt.Sprintf("%s/flash", device.MQTTTopic_DESRoot())
+}
+
+func (device *Device) MQTTTopic_DESFlashAck() (topic string) {
+	return fmt.Sprintf("%s/flash_ack", device.MQTTTopic_DESRoot())
+}
@@ -2,6 +2,7 @@ package c001v001
 
 import (
 	"fmt"
+	"strings"
 	"sync"
 
 	"github.com/leehayford/des/pkg"
@@ -10,6 +11,9 @@ import (
 const DEVICE_CLASS = "001"
 const DEVICE_VERSION = "001"
 
+/* API ROUTE ROOT OF ALL C001V001 ROUTES; ie: /001/001 */
+var DEVICE_ROUTE = pkg.DeviceClassRoute(DEVICE_CLASS, DEVICE_VERSION)
+
 const DEFAULT_GEO_LNG = -180 // TODO: TEST -999.25
 const DEFAULT_GEO_LAT = 90   // TODO: TEST -999.25
 
@@ -23,6 +27,11 @@ const OP_CODE_JOB_END_REQ int32 = 5       // USER REQUEST -> END JOB
 const OP_CODE_JOB_OFFLINE_START int32 = 6 // JOB WAS STARTED OFFLINE BY OPERATOR ON SITE
 const OP_CODE_JOB_OFFLINE_END int32 = 7   // JOB WAS ENDED OFFLINE BY OPERATOR ON SITE
 const OP_CODE_GPS_ACQ int32 = 8           // DEVICE NOTIFICATION -> LTE DISABLED FOR GPS AQUISITION
+const OP_CODE_FW_UPDATE_REQ int32 = 9     // DES REQUEST -> FIRMWARE IMAGE SENT TO .../cmd/fw ( EvtMsg = <type>:<release> )
+const OP_CODE_FW_PROGRESS int32 = 10      // DEVICE NOTIFICATION -> FIRMWARE RECEIVE / INSTALL PROGRESS ( EvtMsg = <type>:<%> )
+const OP_CODE_FW_RECEIVED int32 = 11      // DEVICE RESPONSE -> FIRMWARE IMAGE RECEIVED, CHECKSUM VERIFIED ( EvtMsg = <type>:<release> )
+const OP_CODE_FW_INSTALLED int32 = 12     // DEVICE RESPONSE -> FIRMWARE INSTALLED ( EvtMsg = <type>:<release> )
+const OP_CODE_FW_FAILED int32 = 13        // DEVICE RESPONSE -> FIRMWARE UPDATE FAILED ( EvtMsg = <type>:<reason> )
 
 const MAX_OP_CODE int32 = 999
 
@@ -49,6 +58,8 @@ const NOTE_OPERATOR_COMMENT int32 = 2000
 const NOTE_REPORT_COMMENT int32 = 2001
 const NOTE_SSP_COMMENT int32 = 2002
 const NOTE_SSCVF_COMMENT int32 = 2003
+const NOTE_PROGRAM_COMMENT int32 = 2004 // TEST PROGRAM STEP / STATUS CHANGE
+const NOTE_DEVICE_MOVED int32 = 2005    // DEVICE LEFT / RETURNED TO ITS JOB'S GEOFENCE
 
 /* END ANNOTATION ( NOTE ) CODES ( Event.EvtCode ) **************************************************************/
 
@@ -81,8 +92,18 @@ func GetDeviceList() (regs []pkg.DESRegistration, err error) {
 		Table("des_devs").Select("des_devs.*, des_jobs.*").
 		Joins("JOIN des_jobs ON des_jobs.des_job_dev_id = des_devs.des_dev_id").
 		Joins(`JOIN ( ? ) j ON des_jobs.des_job_dev_id = j.des_job_dev_id AND des_jobs.des_job_reg_time = j.max_time`, subQryLatestJob).
+		Where("des_devs.des_dev_class = ? AND des_devs.des_dev_version = ?", DEVICE_CLASS, DEVICE_VERSION).
 		Order("j.max_time DESC")
 
+	/* EXCLUDE DEVICES TRANSFERRED TO ANOTHER DES */
+	away, err := pkg.DESDevsAway()
+	if err != nil {
+		return
+	}
+	if len(away) > 0 {
+		qry = qry.Where("des_devs.des_dev_serial NOT IN ?", away)
+	}
+
 	res := qry.Scan(&regs)
 	if res.Error != nil {
 		err = fmt.Errorf("Failed to retrieve devices from database: %s", res.Error.Error())
@@ -106,6 +127,9 @@ func GetDevices(regs []pkg.DESRegistration) (devices []Device) {
 /* CONNECT DB AND MQTT CLIENTS FOR ALL DEVICES; CALLED ON SERVER STARTUP */
 func DeviceClient_ConnectAll() {
 
+	/* COMMANDS SENT ON CONNECT MUST USE THE ENCODING THE DEVICE LAST DECLARED */
+	LoadEncodings()
+
 	regs, err := GetDeviceList()
 	if err != nil {
 		pkg.LogErr(err)
@@ -129,6 +153,9 @@ func DeviceClient_DisconnectAll() {
 	for _, d := range Devices {
 		d.DeviceClient_Disconnect()
 	}
+
+	/* COMMIT ANY SAMPLES QUEUED FOR JOBS NOT HELD BY A CONNECTED DEVICE */
+	CloseSampleWriters()
 }
 
 /*
@@ -407,9 +434,15 @@ func (device *Device) UpdateDevicePing(ping pkg.Ping) {
 	*/
 
 	if !ping.OK || ping.Time == 0 {
-		ping = DevicePingsMapRead(device.DESDevSerial)
+		last := DevicePingsMapRead(device.DESDevSerial)
+		ping = last
 		ping.OK = false
 		// fmt.Printf("\n%s -> UpdateDevicePing( ) -> Timeout.", device.DESDevSerial )
+
+		/* PING JUST TIMED OUT; CHECK WHETHER THE BROKER AGREES */
+		if last.OK {
+			go device.CorrelateBrokerSession()
+		}
 	}
 
 	/* UPDATE device.PING AND DevicePings MAP */
@@ -418,3 +451,86 @@ func (device *Device) UpdateDevicePing(ping pkg.Ping) {
 	/* CALL IN GO ROUTINE  *** DES TOPIC *** - ALERT USER CLIENTS */
 	go device.MQTTPublication_DeviceClient_DESDevicePing(ping)
 }
+
+/* BROKER SESSION CORRELATION ********************************************************/
+
+const BROKER_AGREE_ONLINE = "online"   // Device is pinging and holds a broker session
+const BROKER_AGREE_OFFLINE = "offline" // Device is not pinging and holds no broker session
+const BROKER_AGREE_SILENT = "silent"   // Device holds a broker session but is not pinging ( firmware / publish fault )
+const BROKER_AGREE_STALE = "stale"     // Device ping is OK but the broker holds no session for it ( ping not yet timed out )
+
+type DeviceBrokerStatus struct {
+	DESDevSerial   string                 `json:"des_dev_serial"`
+	DevicePing     pkg.Ping               `json:"device_ping"`     // Last ping received from the device
+	DESClientPing  pkg.Ping               `json:"des_client_ping"` // Last ping from this DES's device client
+	DESSession     pkg.EMQXSession        `json:"des_session"`     // Broker session of this DES's device client
+	DeviceSessions []pkg.EMQXSession      `json:"device_sessions"` // Broker sessions opened by the device itself
+	Subscriptions  []pkg.EMQXSubscription `json:"subscriptions"`   // Subscriptions of this DES's device client
+	BrokerOnline   bool                   `json:"broker_online"`   // The device holds a connected broker session
+	Agreement      string                 `json:"agreement"`       // BROKER_AGREE_...
+}
+
+/*
+	RETURNS THIS DEVICE'S BROKER SESSIONS AND SUBSCRIPTIONS, CORRELATED WITH THE DEVICE PING
+
+A DEVICE SESSION IS ANY SESSION OTHER THAN THE DES DEVICE CLIENT'S WHERE BOTH
+  - THE CLIENT ID IS <Serial> OR STARTS WITH <Class>-<Version>-<Serial>
+  - AND THE BROKER USER NAME IS THE DEVICE SERIAL
+
+like_clientid ONLY NARROWS THE QUERY; A SESSION WITH A MATCHING CLIENT ID AND ANOTHER USER NAME IS NOT THE DEVICE
+*/
+func (device *Device) BrokerStatus() (sts DeviceBrokerStatus, err error) {
+
+	sts.DESDevSerial = device.DESDevSerial
+	sts.DevicePing = DevicePingsMapRead(device.DESDevSerial)
+	sts.DESClientPing = DESDeviceClientPingsMapRead(device.DESDevSerial)
+
+	sessions, err := pkg.EMQX.Sessions(device.DESDevSerial)
+	if err != nil {
+		return
+	}
+
+	prefix := fmt.Sprintf("%s-%s-%s", device.DESDevClass, device.DESDevVersion, device.DESDevSerial)
+	desID := prefix + "-DES"
+	for _, s := range sessions {
+		if s.ClientID == desID {
+			sts.DESSession = s
+		} else if (s.ClientID == device.DESDevSerial || strings.HasPrefix(s.ClientID, prefix)) &&
+			s.Username == device.DESDevSerial {
+			sts.DeviceSessions = append(sts.DeviceSessions, s)
+			if s.Connected {
+				sts.BrokerOnline = true
+			}
+		}
+	}
+
+	if sts.Subscriptions, err = pkg.EMQX.Subscriptions(desID); err != nil {
+		return
+	}
+
+	switch {
+	case sts.DevicePing.OK && sts.BrokerOnline:
+		sts.Agreement = BROKER_AGREE_ONLINE
+	case !sts.DevicePing.OK && !sts.BrokerOnline:
+		sts.Agreement = BROKER_AGREE_OFFLINE
+	case sts.BrokerOnline:
+		sts.Agreement = BROKER_AGREE_SILENT
+	default:
+		sts.Agreement = BROKER_AGREE_STALE
+	}
+	return
+}
+
+/* LOGS A DES ERROR WHERE THE DEVICE PING AND THE BROKER DISAGREE ON WHETHER THE DEVICE IS ONLINE */
+func (device *Device) CorrelateBrokerSession() {
+
+	sts, err := device.BrokerStatus()
+	if err != nil {
+		/* NO EMQX API ( EMBEDDED BROKER ) OR EMQX UNAVAILABLE; NOTHING TO CORRELATE */
+		return
+	}
+
+	if sts.Agreement == BROKER_AGREE_SILENT || sts.Agreement == BROKER_AGREE_STALE {
+		pkg.LogDESError(device.DESDevSerial, fmt.Sprintf("Device ping and broker session disagree: %s", sts.Agreement), sts)
+	}
+}
@@ -0,0 +1,81 @@
+package c001v001
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/leehayford/des/pkg"
+)
+
+/* POINTS pkg.EMQX AT A LOCAL HTTP STAND-IN RETURNING sessions FROM /clients */
+func standInEMQX(t *testing.T, sessions []pkg.EMQXSession) {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v5/clients", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": sessions})
+	})
+	mux.HandleFunc("/api/v5/subscriptions", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": []pkg.EMQXSubscription{}})
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	api := pkg.EMQX
+	t.Cleanup(func() { pkg.EMQX = api })
+	pkg.EMQX = pkg.EMQXClient{URL: srv.URL + "/api/v5/", HTTP: srv.Client()}
+}
+
+func testDevice(serial string) (device Device) {
+	device.DESDevClass = DEVICE_CLASS
+	device.DESDevVersion = DEVICE_VERSION
+	device.DESDevSerial = serial
+	return
+}
+
+func TestBrokerStatusRequiresClientIDAndUsername(t *testing.T) {
+	device := testDevice("SN0001")
+	prefix := DEVICE_CLASS + "-" + DEVICE_VERSION + "-SN0001"
+
+	standInEMQX(t, []pkg.EMQXSession{
+		{ClientID: prefix + "-DES", Username: pkg.MQTT_USER, Connected: true},
+		{ClientID: prefix + "-DEMO", Username: pkg.MQTT_USER, Connected: true}, // Client ID matches; user name does not
+		{ClientID: "SN0001-viewer", Username: "SN0001", Connected: true},       // User name matches; client ID does not
+	})
+
+	sts, err := device.BrokerStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sts.DESSession.ClientID != prefix+"-DES" {
+		t.Fatalf("DES session not found: %+v", sts.DESSession)
+	}
+	if len(sts.DeviceSessions) != 0 || sts.BrokerOnline {
+		t.Fatalf("sessions matching only one of client ID / user name were counted: %+v", sts.DeviceSessions)
+	}
+	if sts.Agreement != BROKER_AGREE_OFFLINE {
+		t.Fatalf("agreement = %s", sts.Agreement)
+	}
+}
+
+func TestBrokerStatusDeviceSession(t *testing.T) {
+	device := testDevice("SN0002")
+
+	standInEMQX(t, []pkg.EMQXSession{
+		{ClientID: "SN0002", Username: "SN0002", Connected: true},
+	})
+
+	sts, err := device.BrokerStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sts.DeviceSessions) != 1 || !sts.BrokerOnline {
+		t.Fatalf("device session not found: %+v", sts)
+	}
+
+	/* NO PING HAS BEEN RECEIVED; THE BROKER SAYS ONLINE */
+	if sts.Agreement != BROKER_AGREE_SILENT {
+		t.Fatalf("agreement = %s", sts.Agreement)
+	}
+}
@@ -0,0 +1,138 @@
+/* Data Exchange Server (DES) is a component of the Datacan Data2Desk (D2D) Platform.
+License:
+
+	[PROPER LEGALESE HERE...]
+
+	INTERIM LICENSE DESCRIPTION:
+	In spirit, this license:
+	1. Allows <Third Party> to use, modify, and / or distributre this software in perpetuity so long as <Third Party> understands:
+		a. The software is porvided as is without guarantee of additional support from DataCan in any form.
+		b. The software is porvided as is without guarantee of exclusivity.
+
+	2. Prohibits <Third Party> from taking any action which might interfere with DataCan's right to use, modify and / or distributre this software in perpetuity.
+*/
+
+package pkg
+
+import (
+	"time"
+)
+
+/*
+FLEET-WIDE BULK COMMANDS
+
+  - DESBulkCmd: A PARTIAL ADMIN / CONFIG / HEADER PATCH SENT TO EVERY DEVICE MATCHED BY A SELECTOR
+  - DESBulkCmdDevice: PER DEVICE, PER RECORD TYPE, THE DELIVERY / ACKNOWLEDGEMENT STATUS
+
+A DEVICE ACKNOWLEDGES BY ECHOING THE RECORD ON ITS SIGNAL TOPIC WITH THE PATCHED VALUES
+SELECTION, DELIVERY AND ACKNOWLEDGEMENT ARE CLASS / VERSION SPECIFIC; SEE <class>/<version>/controller.bulk.go
+*/
+const BULK_GROUP_ALL = "*" // Every registered device of the class / version
+
+/* DESBulkCmd.DESBulkStatus */
+const BULK_STATUS_RUNNING = "running"
+const BULK_STATUS_COMPLETE = "complete" // Every device has acknowledged, failed, been rejected or timed out
+
+/* DESBulkCmdDevice.DESBulkDevStatus */
+const BULK_DEV_PENDING = "pending"   // Not yet sent
+const BULK_DEV_SENT = "sent"         // Sent; waiting for the device to acknowledge
+const BULK_DEV_ACKED = "acked"       // Device echoed the patched values
+const BULK_DEV_REJECTED = "rejected" // Device replied with other values ( ie: clamped by the device ) and did not acknowledge in time
+const BULK_DEV_FAILED = "failed"     // Could not be sent ( ie: device not connected )
+const BULK_DEV_TIMEOUT = "timeout"   // Device did not reply in time
+
+const BULK_ACK_TIMEOUT_SEC int64 = 120
+const BULK_TICK_MS = 5000 // Interval at which timeouts are checked
+
+type DESBulkCmd struct {
+	DESBulkID        int64  `gorm:"unique; primaryKey" json:"des_bulk_id"`
+	DESBulkRegTime   int64  `gorm:"not null" json:"des_bulk_reg_time"`
+	DESBulkRegAddr   string `gorm:"varchar(36)" json:"des_bulk_reg_addr"`
+	DESBulkRegUserID string `gorm:"not null; varchar(36)" json:"des_bulk_reg_user_id"`
+
+	DESBulkClass    string `gorm:"not null; varchar(3)" json:"des_bulk_class"`
+	DESBulkVersion  string `gorm:"not null; varchar(3)" json:"des_bulk_version"`
+	DESBulkSelector string `json:"des_bulk_selector"` // JSON; as requested
+	DESBulkPatch    string `json:"des_bulk_patch"`    // JSON; class / version specific
+	DESBulkDevices  int    `json:"des_bulk_devices"`  // Devices selected
+	DESBulkStatus   string `json:"des_bulk_status"`   // BULK_STATUS_...
+	DESBulkUpdated  int64  `json:"des_bulk_updated"`
+}
+
+type DESBulkCmdDevice struct {
+	DESBulkDevID      int64  `gorm:"unique; primaryKey" json:"des_bulk_dev_id"`
+	DESBulkDevBulkID  int64  `gorm:"not null" json:"des_bulk_dev_bulk_id"`
+	DESBulkDevSerial  string `gorm:"not null; varchar(10)" json:"des_bulk_dev_serial"`
+	DESBulkDevType    string `gorm:"not null; varchar(3)" json:"des_bulk_dev_type"` // ie: adm, cfg, hdr
+	DESBulkDevStatus  string `json:"des_bulk_dev_status"`                           // BULK_DEV_...
+	DESBulkDevSent    int64  `json:"des_bulk_dev_sent"`
+	DESBulkDevAcked   int64  `json:"des_bulk_dev_acked"`
+	DESBulkDevMsg     string `json:"des_bulk_dev_msg"`
+	DESBulkDevUpdated int64  `json:"des_bulk_dev_updated"`
+}
+
+func WriteDESBulkCmd(bulk *DESBulkCmd) (err error) {
+	bulk.DESBulkUpdated = time.Now().UTC().UnixMilli()
+	res := DES.DB.Save(bulk)
+	return res.Error
+}
+
+func GetDESBulkCmd(id int64) (bulk DESBulkCmd, err error) {
+	res := DES.DB.First(&bulk, id)
+	return bulk, res.Error
+}
+
+/* RETURNS ALL BULK COMMANDS, NEWEST FIRST */
+func GetDESBulkCmds() (bulks []DESBulkCmd, err error) {
+	res := DES.DB.Order("des_bulk_reg_time DESC").Find(&bulks)
+	return bulks, res.Error
+}
+
+func WriteDESBulkCmdDevice(dev *DESBulkCmdDevice) (err error) {
+	dev.DESBulkDevUpdated = time.Now().UTC().UnixMilli()
+	res := DES.DB.Save(dev)
+	return res.Error
+}
+
+/* RETURNS THE BULK COMMAND'S DEVICE RECORDS, BY SERIAL */
+func (bulk DESBulkCmd) Devices() (devs []DESBulkCmdDevice, err error) {
+	res := DES.DB.
+		Where("des_bulk_dev_bulk_id = ?", bulk.DESBulkID).
+		Order("des_bulk_dev_serial, des_bulk_dev_type").
+		Find(&devs)
+	return devs, res.Error
+}
+
+/* RETURNS DEVICE RECORDS WITH THE GIVEN STATUS ACROSS ALL BULK COMMANDS, OLDEST FIRST */
+func GetDESBulkCmdDevicesByStatus(status string) (devs []DESBulkCmdDevice, err error) {
+	res := DES.DB.
+		Where("des_bulk_dev_status = ?", status).
+		Order("des_bulk_dev_sent ASC").
+		Find(&devs)
+	return devs, res.Error
+}
+
+type DESBulkCmdProgress struct {
+	DESBulkCmd `json:"bulk"`
+	Counts     map[string]int `json:"counts"` // Device records by BULK_DEV_...
+	Total      int            `json:"total"`
+	Done       bool           `json:"done"`
+}
+
+/* RETURNS THE BULK COMMAND'S DEVICE RECORD COUNTS BY STATUS */
+func (bulk DESBulkCmd) Progress() (prog DESBulkCmdProgress, err error) {
+
+	prog.DESBulkCmd = bulk
+	prog.Counts = make(map[string]int)
+
+	devs, err := bulk.Devices()
+	if err != nil {
+		return
+	}
+	for _, dev := range devs {
+		prog.Counts[dev.DESBulkDevStatus]++
+	}
+	prog.Total = len(devs)
+	prog.Done = prog.Counts[BULK_DEV_PENDING] == 0 && prog.Counts[BULK_DEV_SENT] == 0
+	return
+}
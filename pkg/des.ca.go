@@ -0,0 +1,350 @@
+/* Data Exchange Server (DES) is a component of the Datacan Data2Desk (D2D) Platform.
+License:
+
+	[PROPER LEGALESE HERE...]
+
+	INTERIM LICENSE DESCRIPTION:
+	In spirit, this license:
+	1. Allows <Third Party> to use, modify, and / or distributre this software in perpetuity so long as <Third Party> understands:
+		a. The software is porvided as is without guarantee of additional support from DataCan in any form.
+		b. The software is porvided as is without guarantee of exclusivity.
+
+	2. Prohibits <Third Party> from taking any action which might interfere with DataCan's right to use, modify and / or distributre this software in perpetuity.
+*/
+
+package pkg
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"time"
+)
+
+/*
+DES CERTIFICATE AUTHORITY
+
+ISSUES AN X.509 CLIENT CERTIFICATE TO EACH DEVICE AT REGISTRATION
+  - THE CERTIFICATE ( CN = DEVICE SERIAL ), ITS KEY AND THE CA CERTIFICATE ARE DELIVERED IN THE DEVICE INITIALIZATION FILES
+  - EVERY ISSUED CERTIFICATE IS RECORDED IN des_dev_certs; REVOKED CERTIFICATES ARE PUBLISHED IN THE CA's CRL
+  - THE EMBEDDED BROKER REFUSES REVOKED CERTIFICATES DURING THE TLS HANDSHAKE
+
+THE CA KEY PAIR IS CREATED ON FIRST USE IN ~/DATA_DIR/DES_CA_DIR
+*/
+const DES_CA_DIR = "ca"
+const DES_CA_CERT_FILE = "des_ca.crt"
+const DES_CA_KEY_FILE = "des_ca.key"
+const DES_CA_VALID_YEARS = 20
+const DES_DEV_CERT_VALID_DAYS = 825
+
+const PEM_CERTIFICATE = "CERTIFICATE"
+const PEM_EC_PRIVATE_KEY = "EC PRIVATE KEY"
+const PEM_X509_CRL = "X509 CRL"
+
+type DESCertAuthority struct {
+	Cert    *x509.Certificate
+	Key     *ecdsa.PrivateKey
+	CertPEM []byte
+}
+
+/* THE CA OF THIS DES; nil UNTIL LoadDESCA( ) */
+var DESCA *DESCertAuthority
+
+/* A CERTIFICATE ISSUED TO A DEVICE; ONLY THE PUBLIC PART IS STORED IN THE DES DATABASE */
+type DESDevCert struct {
+	DESDevCertID        int64  `gorm:"unique; primaryKey" json:"des_dev_cert_id"`
+	DESDevCertSerial    string `gorm:"not null; unique" json:"des_dev_cert_serial"` // Hex certificate serial number
+	DESDevCertDevSerial string `gorm:"not null; varchar(10)" json:"des_dev_cert_dev_serial"`
+	DESDevCertIssued    int64  `gorm:"not null" json:"des_dev_cert_issued"`
+	DESDevCertNotAfter  int64  `gorm:"not null" json:"des_dev_cert_not_after"`
+	DESDevCertRevoked   int64  `json:"des_dev_cert_revoked"` // 0 = NOT REVOKED
+	DESDevCertReason    string `json:"des_dev_cert_reason"`
+	DESDevCertPEM       string `json:"des_dev_cert_pem"`
+}
+
+/* DEVICE CERTIFICATE FILES AS DELIVERED TO THE DEVICE */
+type DESDevCertFiles struct {
+	CertPEM string `json:"cert_pem"`
+	KeyPEM  string `json:"key_pem"`
+	CAPEM   string `json:"ca_pem"`
+}
+
+/* LOADS THE DES CA FROM ~/DATA_DIR/DES_CA_DIR; CREATES IT WHERE IT DOES NOT EXIST */
+func LoadDESCA() (err error) {
+
+	dir := fmt.Sprintf("%s/%s", DATA_DIR, DES_CA_DIR)
+	certPath := fmt.Sprintf("%s/%s", dir, DES_CA_CERT_FILE)
+	keyPath := fmt.Sprintf("%s/%s", dir, DES_CA_KEY_FILE)
+
+	if _, err = os.Stat(certPath); os.IsNotExist(err) {
+		if err = CreateDESCA(dir, certPath, keyPath); err != nil {
+			return LogErr(err)
+		}
+	}
+
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return LogErr(err)
+	}
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return LogErr(err)
+	}
+
+	ca := &DESCertAuthority{CertPEM: certPEM}
+	blk, _ := pem.Decode(certPEM)
+	if blk == nil {
+		return LogErr(fmt.Errorf("Invalid DES CA certificate: %s", certPath))
+	}
+	if ca.Cert, err = x509.ParseCertificate(blk.Bytes); err != nil {
+		return LogErr(err)
+	}
+	blk, _ = pem.Decode(keyPEM)
+	if blk == nil {
+		return LogErr(fmt.Errorf("Invalid DES CA key: %s", keyPath))
+	}
+	if ca.Key, err = x509.ParseECPrivateKey(blk.Bytes); err != nil {
+		return LogErr(err)
+	}
+
+	DESCA = ca
+	fmt.Printf("\nDES CA loaded: %s\n", ca.Cert.Subject.CommonName)
+	return
+}
+
+/* CREATES A SELF-SIGNED CA KEY PAIR */
+func CreateDESCA(dir, certPath, keyPath string) (err error) {
+
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return
+	}
+
+	sn, err := NewCertSerial()
+	if err != nil {
+		return
+	}
+	now := time.Now().UTC()
+	tmpl := &x509.Certificate{
+		SerialNumber:          sn,
+		Subject:               pkix.Name{CommonName: "DES CA", Organization: []string{"DataCan"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.AddDate(DES_CA_VALID_YEARS, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return
+	}
+
+	if err = os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: PEM_CERTIFICATE, Bytes: der}), 0644); err != nil {
+		return
+	}
+	return os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: PEM_EC_PRIVATE_KEY, Bytes: keyDER}), 0600)
+}
+
+/* RETURNS A RANDOM 128 BIT CERTIFICATE SERIAL NUMBER */
+func NewCertSerial() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+/* SIGNS A CERTIFICATE FOR A NEW P-256 KEY; RETURNS THE CERTIFICATE AND KEY AS PEM */
+func (ca *DESCertAuthority) issue(tmpl *x509.Certificate) (cert *x509.Certificate, certPEM, keyPEM []byte, err error) {
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return
+	}
+	if tmpl.SerialNumber, err = NewCertSerial(); err != nil {
+		return
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.Cert, &key.PublicKey, ca.Key)
+	if err != nil {
+		return
+	}
+	if cert, err = x509.ParseCertificate(der); err != nil {
+		return
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return
+	}
+
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: PEM_CERTIFICATE, Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: PEM_EC_PRIVATE_KEY, Bytes: keyDER})
+	return
+}
+
+/* ISSUES A CLIENT CERTIFICATE ( CN = serial ) AND RECORDS IT IN des_dev_certs */
+func (ca *DESCertAuthority) IssueDeviceCert(serial string) (files DESDevCertFiles, err error) {
+
+	now := time.Now().UTC()
+	cert, certPEM, keyPEM, err := ca.issue(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: serial, Organization: []string{"DataCan"}},
+		NotBefore:   now.Add(-time.Hour),
+		NotAfter:    now.AddDate(0, 0, DES_DEV_CERT_VALID_DAYS),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		return
+	}
+
+	rec := DESDevCert{
+		DESDevCertSerial:    cert.SerialNumber.Text(16),
+		DESDevCertDevSerial: serial,
+		DESDevCertIssued:    now.UnixMilli(),
+		DESDevCertNotAfter:  cert.NotAfter.UnixMilli(),
+		DESDevCertPEM:       string(certPEM),
+	}
+	if res := DES.DB.Create(&rec); res.Error != nil {
+		return files, res.Error
+	}
+
+	files = DESDevCertFiles{
+		CertPEM: string(certPEM),
+		KeyPEM:  string(keyPEM),
+		CAPEM:   string(ca.CertPEM),
+	}
+	return
+}
+
+/* ISSUES A SERVER CERTIFICATE FOR THE EMBEDDED BROKER; NOT RECORDED */
+func (ca *DESCertAuthority) IssueServerCert(hosts []string) (crt tls.Certificate, err error) {
+
+	now := time.Now().UTC()
+	tmpl := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: hosts[0], Organization: []string{"DataCan"}},
+		NotBefore:   now.Add(-time.Hour),
+		NotAfter:    now.AddDate(0, 0, DES_DEV_CERT_VALID_DAYS),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+
+	_, certPEM, keyPEM, err := ca.issue(tmpl)
+	if err != nil {
+		return
+	}
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
+
+/* RETURNS A CERTIFICATE POOL CONTAINING ONLY THE DES CA */
+func (ca *DESCertAuthority) Pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Cert)
+	return pool
+}
+
+/* RETURNS THE CERTIFICATE REVOCATION LIST AS PEM */
+func (ca *DESCertAuthority) CRL() (crlPEM []byte, err error) {
+
+	revoked := []DESDevCert{}
+	if res := DES.DB.Where("des_dev_cert_revoked > 0").Find(&revoked); res.Error != nil {
+		return nil, res.Error
+	}
+
+	entries := []x509.RevocationListEntry{}
+	for _, r := range revoked {
+		sn, ok := new(big.Int).SetString(r.DESDevCertSerial, 16)
+		if !ok {
+			continue
+		}
+		entries = append(entries, x509.RevocationListEntry{
+			SerialNumber:   sn,
+			RevocationTime: time.UnixMilli(r.DESDevCertRevoked).UTC(),
+		})
+	}
+
+	now := time.Now().UTC()
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:                    big.NewInt(now.UnixMilli()),
+		ThisUpdate:                now,
+		NextUpdate:                now.Add(time.Hour * 24),
+		RevokedCertificateEntries: entries,
+	}, ca.Cert, ca.Key)
+	if err != nil {
+		return
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: PEM_X509_CRL, Bytes: der}), nil
+}
+
+/* REVOKES ALL UNREVOKED CERTIFICATES ISSUED TO THE DEVICE; RETURNS THE NUMBER REVOKED */
+func RevokeDeviceCerts(serial, reason string) (count int64, err error) {
+	res := DES.DB.Model(&DESDevCert{}).
+		Where("des_dev_cert_dev_serial = ? AND des_dev_cert_revoked = 0", serial).
+		Updates(map[string]interface{}{
+			"des_dev_cert_revoked": time.Now().UTC().UnixMilli(),
+			"des_dev_cert_reason":  reason,
+		})
+	return res.RowsAffected, res.Error
+}
+
+/* RETURNS TRUE WHERE THE CERTIFICATE HAS BEEN REVOKED OR WAS NOT ISSUED BY THIS DES */
+func DeviceCertRevoked(cert *x509.Certificate) bool {
+	rec := DESDevCert{}
+	res := DES.DB.Where("des_dev_cert_serial = ?", cert.SerialNumber.Text(16)).Limit(1).Find(&rec)
+	return res.Error != nil || res.RowsAffected == 0 || rec.DESDevCertRevoked > 0
+}
+
+/* RETURNS THE CERTIFICATES ISSUED TO THE DEVICE, NEWEST FIRST */
+func GetDeviceCerts(serial string) (certs []DESDevCert, err error) {
+	res := DES.DB.Where("des_dev_cert_dev_serial = ?", serial).Order("des_dev_cert_issued DESC").Find(&certs)
+	return certs, res.Error
+}
+
+/*
+	TLS SERVER CONFIG FOR THE EMBEDDED BROKER
+
+- CLIENT CERTIFICATES ARE OPTIONAL ( THE DES USER CONNECTS WITH A PASSWORD )
+- WHERE GIVEN, THEY MUST BE SIGNED BY THE DES CA AND MUST NOT BE REVOKED
+*/
+func (ca *DESCertAuthority) BrokerTLSConfig(hosts []string) (cfg *tls.Config, err error) {
+
+	crt, err := ca.IssueServerCert(hosts)
+	if err != nil {
+		return
+	}
+
+	cfg = &tls.Config{
+		Certificates: []tls.Certificate{crt},
+		ClientCAs:    ca.Pool(),
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+		MinVersion:   tls.VersionTLS12,
+		VerifyPeerCertificate: func(raw [][]byte, chains [][]*x509.Certificate) error {
+			if len(chains) == 0 || len(chains[0]) == 0 {
+				return nil
+			}
+			if DeviceCertRevoked(chains[0][0]) {
+				return fmt.Errorf("Device certificate %s is revoked", chains[0][0].SerialNumber.Text(16))
+			}
+			return nil
+		},
+	}
+	return
+}
@@ -132,6 +132,30 @@ func GetUserByID(uid string) (user User, err error) {
 	return
 }
 
+/* RETURNS THE ORGANIZATION OF THE USER'S ACCOUNT; AN ERROR WHERE THE USER HAS NONE */
+func GetUserOrg(uid string) (org string, err error) {
+
+	user, err := GetUserByID(uid)
+	if err != nil {
+		return
+	}
+	if user.Org == "" {
+		return "", fmt.Errorf(ERR_AUTH_NO_ORG)
+	}
+	return user.Org, nil
+}
+
+/* ASSIGN THE USER'S ACCOUNT TO AN ORGANIZATION */
+func SetUserOrg(uid, org string) (user User, err error) {
+
+	if user, err = GetUserByID(uid); err != nil {
+		return
+	}
+	user.Org = ValidateStringLength(strings.TrimSpace(org), 32)
+	err = DES.DB.Model(&user).Update("org", user.Org).Error
+	return
+}
+
 func GetUserReferenceSRC(uid string) (src DESMessageSource, err error) {
 	//ERR_USER_NOT_FOUND
 	user, err := GetUserByID(uid)
@@ -190,6 +190,22 @@ func (des DESDatabase) CreateDESTables(exists bool) (err error) {
 			&DESJob{},
 			&DESJobSearch{},
 			&DESError{},
+			&DESDevCert{},
+			&DESDevSecret{},
+			&DESFirmware{},
+			&DESFwDevice{},
+			&DESFwCampaign{},
+			&DESDevTransfer{},
+			&DESProgram{},
+			&DESBulkCmd{},
+			&DESBulkCmdDevice{},
+			&DESTemplate{},
+			&DESDevLocation{},
+			&DESGeofence{},
+			&DESDevKey{},
+			&DESTimePolicy{},
+			&DESDeadLetter{},
+			&DESDevEncoding{},
 		)
 	} else {
 		// fmt.Printf("\nCreating DES Tables: %s\n", DES.ConnStr)
@@ -199,6 +215,22 @@ func (des DESDatabase) CreateDESTables(exists bool) (err error) {
 			&DESJob{},
 			&DESJobSearch{},
 			&DESError{},
+			&DESDevCert{},
+			&DESDevSecret{},
+			&DESFirmware{},
+			&DESFwDevice{},
+			&DESFwCampaign{},
+			&DESDevTransfer{},
+			&DESProgram{},
+			&DESBulkCmd{},
+			&DESBulkCmdDevice{},
+			&DESTemplate{},
+			&DESDevLocation{},
+			&DESGeofence{},
+			&DESDevKey{},
+			&DESTimePolicy{},
+			&DESDeadLetter{},
+			&DESDevEncoding{},
 		); err != nil {
 			return err
 		}
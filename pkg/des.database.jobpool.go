@@ -0,0 +1,307 @@
+/* Data Exchange Server (DES) is a component of the Datacan Data2Desk (D2D) Platform.
+License:
+
+	[PROPER LEGALESE HERE...]
+
+	INTERIM LICENSE DESCRIPTION:
+	In spirit, this license:
+	1. Allows <Third Party> to use, modify, and / or distributre this software in perpetuity so long as <Third Party> understands:
+		a. The software is porvided as is without guarantee of additional support from DataCan in any form.
+		b. The software is porvided as is without guarantee of exclusivity.
+
+	2. Prohibits <Third Party> from taking any action which might interfere with DataCan's right to use, modify and / or distributre this software in perpetuity.
+*/
+
+package pkg
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"time"
+)
+
+/*
+JOB DATABASE CONNECTION POOL
+
+HISTORICAL JOB DATABASES ARE OPENED ON DEMAND AND SHARED BY EVERY REQUEST THAT READS THEM
+  - AcquireJobDB RETURNS AN OPEN CLIENT; ITS Disconnect RETURNS IT TO THE POOL ( REFERENCE COUNTED )
+  - A HANDLE IS NEVER CLOSED WHILE A REQUEST HOLDS IT
+  - IDLE HANDLES ARE CLOSED AFTER JOB_POOL_IDLE_MS; BEYOND JOB_POOL_MAX, THE LEAST RECENTLY USED IDLE HANDLE IS CLOSED
+  - ENDED JOBS ARE OPENED READ-ONLY ( SQLITE: query_only; POSTGRES: default_transaction_read_only )
+  - ACTIVE DEVICES KEEP THEIR OWN CmdDBC / JobDBC; READ-WRITE SQLITE HANDLES USE WAL SO READERS DON'T BLOCK THEM
+*/
+const JOB_POOL_MAX = 64         // Open handles
+const JOB_POOL_IDLE_MS = 300000 // Unused handles are closed after
+const JOB_POOL_SWEEP_MS = 30000
+
+type JobDBHandleStats struct {
+	Name     string `json:"name"`
+	ReadOnly bool   `json:"read_only"`
+	Refs     int    `json:"refs"`
+	Uses     int64  `json:"uses"`
+	Opened   int64  `json:"opened"`    // Unix milliseconds
+	LastUsed int64  `json:"last_used"` // Unix milliseconds
+}
+
+type JobDBPoolStats struct {
+	Max        int                `json:"max"`
+	IdleMS     int64              `json:"idle_ms"`
+	Open       int                `json:"open"`
+	InUse      int                `json:"in_use"`
+	Hits       int64              `json:"hits"`
+	Misses     int64              `json:"misses"`
+	Errors     int64              `json:"errors"`
+	Evicted    int64              `json:"evicted"`     // Closed to stay within Max
+	IdleClosed int64              `json:"idle_closed"` // Closed after IdleMS unused
+	Overflow   int64              `json:"overflow"`    // Opened beyond Max because every handle was in use
+	Handles    []JobDBHandleStats `json:"handles"`     // Most recently used first
+}
+
+type jobDBHandle struct {
+	pool  *JobDBPool
+	key   string
+	jdbc  JobDBClient
+	refs  int
+	uses  int64
+	stale bool // Closed when released; no longer handed out
+	open  time.Time
+	used  time.Time
+	elem  *list.Element
+}
+
+type JobDBPool struct {
+	Max  int
+	Idle time.Duration
+
+	mtx     sync.Mutex
+	handles map[string]*jobDBHandle
+	lru     *list.List // Front: most recently used
+	stats   JobDBPoolStats
+	sweep   sync.Once
+}
+
+var JOB_POOL = NewJobDBPool(JOB_POOL_MAX, JOB_POOL_IDLE_MS*time.Millisecond)
+
+func NewJobDBPool(max int, idle time.Duration) *JobDBPool {
+	return &JobDBPool{
+		Max:     max,
+		Idle:    idle,
+		handles: make(map[string]*jobDBHandle),
+		lru:     list.New(),
+	}
+}
+
+/* RETURNS AN OPEN CLIENT FOR THE JOB DATABASE FROM JOB_POOL; CALL Disconnect WHEN DONE WITH IT */
+func AcquireJobDB(db_name string, readOnly bool) (JobDBClient, error) {
+	return JOB_POOL.Acquire(db_name, readOnly)
+}
+
+func jobPoolKey(db_name string, readOnly bool) string {
+	if readOnly {
+		return db_name + ":ro"
+	}
+	return db_name + ":rw"
+}
+
+func (pool *JobDBPool) Acquire(db_name string, readOnly bool) (jdbc JobDBClient, err error) {
+	pool.sweep.Do(func() { go pool.sweeper() })
+
+	/* OLDER JOB DATABASES ARE UPGRADED BEFORE THEY ARE FIRST OPENED;
+	A FAILED UPGRADE LEAVES THE JOB READABLE AS IT WAS, BUT NOT WRITABLE */
+	if err = EnsureJobDBSchema(db_name); err != nil && !readOnly {
+		pool.mtx.Lock()
+		pool.stats.Errors++
+		pool.mtx.Unlock()
+		return
+	}
+	err = nil
+
+	key := jobPoolKey(db_name, readOnly)
+
+	pool.mtx.Lock()
+	if h := pool.handles[key]; h != nil {
+		pool.stats.Hits++
+		jdbc = pool.use(h)
+		pool.mtx.Unlock()
+		return
+	}
+	pool.stats.Misses++
+	pool.mtx.Unlock()
+
+	/* CONNECT WITHOUT THE LOCK; A SLOW DATABASE DOES NOT HOLD UP REQUESTS FOR OTHER JOBS */
+	if jdbc, err = GetJobDBClient(db_name); err == nil {
+		jdbc.ReadOnly = readOnly
+		err = jdbc.Connect()
+	}
+
+	pool.mtx.Lock()
+	defer pool.mtx.Unlock()
+
+	if err != nil {
+		pool.stats.Errors++
+		return
+	}
+
+	/* ANOTHER REQUEST OPENED THE JOB WHILE WE CONNECTED; SHARE ITS HANDLE */
+	if h := pool.handles[key]; h != nil {
+		if err := jdbc.Disconnect(); err != nil {
+			LogErr(fmt.Errorf("(*JobDBPool) Acquire( ) -> %s: %s", key, err.Error()))
+		}
+		return pool.use(h), nil
+	}
+
+	h := &jobDBHandle{pool: pool, key: key, jdbc: jdbc, open: time.Now()}
+	h.elem = pool.lru.PushFront(h)
+	pool.handles[key] = h
+	jdbc = pool.use(h)
+	pool.evict()
+	return
+}
+
+/* HANDS OUT A REFERENCE TO h; CALLER HOLDS pool.mtx */
+func (pool *JobDBPool) use(h *jobDBHandle) (jdbc JobDBClient) {
+	pool.lru.MoveToFront(h.elem)
+	h.refs++
+	h.uses++
+	h.used = time.Now()
+
+	jdbc = h.jdbc
+	jdbc.handle = h
+	return
+}
+
+/* RETURNS A CLIENT TO THE POOL ( SEE JobDBClient.Disconnect ); EACH COPY RELEASES ONCE */
+func (pool *JobDBPool) Release(jdbc *JobDBClient) {
+	h := jdbc.handle
+	if h == nil || jdbc.released {
+		return
+	}
+	jdbc.released = true
+
+	pool.mtx.Lock()
+	defer pool.mtx.Unlock()
+
+	h.refs--
+	h.used = time.Now()
+	if h.refs > 0 {
+		return
+	}
+	if h.stale {
+		pool.close(h)
+		return
+	}
+	pool.evict()
+}
+
+/*
+	CLOSES THE JOB DATABASE'S HANDLES; CALL BEFORE THE DATABASE IS MOVED, REPLACED OR DROPPED
+
+HANDLES IN USE ARE CLOSED WHEN RELEASED; THE NEXT Acquire OPENS A NEW ONE
+*/
+func (pool *JobDBPool) Close(db_name string) {
+	pool.mtx.Lock()
+	defer pool.mtx.Unlock()
+
+	for _, ro := range []bool{false, true} {
+		if h := pool.handles[jobPoolKey(db_name, ro)]; h != nil {
+			pool.retire(h)
+		}
+	}
+}
+
+/* CLOSES EVERY HANDLE; CALLED ON SHUTDOWN */
+func (pool *JobDBPool) CloseAll() {
+	pool.mtx.Lock()
+	defer pool.mtx.Unlock()
+
+	for _, h := range pool.handles {
+		pool.retire(h)
+	}
+}
+
+func (pool *JobDBPool) Stats() (stats JobDBPoolStats) {
+	pool.mtx.Lock()
+	defer pool.mtx.Unlock()
+
+	stats = pool.stats
+	stats.Max = pool.Max
+	stats.IdleMS = pool.Idle.Milliseconds()
+	stats.Open = len(pool.handles)
+	stats.Handles = []JobDBHandleStats{}
+	for e := pool.lru.Front(); e != nil; e = e.Next() {
+		h := e.Value.(*jobDBHandle)
+		if h.refs > 0 {
+			stats.InUse++
+		}
+		stats.Handles = append(stats.Handles, JobDBHandleStats{
+			Name:     h.jdbc.Name,
+			ReadOnly: h.jdbc.ReadOnly,
+			Refs:     h.refs,
+			Uses:     h.uses,
+			Opened:   h.open.UnixMilli(),
+			LastUsed: h.used.UnixMilli(),
+		})
+	}
+	return
+}
+
+/* CLOSES LEAST RECENTLY USED IDLE HANDLES UNTIL THE POOL IS WITHIN Max; CALLER HOLDS pool.mtx */
+func (pool *JobDBPool) evict() {
+	for e := pool.lru.Back(); e != nil && pool.lru.Len() > pool.Max; {
+		h := e.Value.(*jobDBHandle)
+		e = e.Prev()
+		if h.refs == 0 {
+			pool.close(h)
+			pool.stats.Evicted++
+		}
+	}
+	if pool.lru.Len() > pool.Max {
+		pool.stats.Overflow++
+	}
+}
+
+/* TAKES THE HANDLE OUT OF SERVICE, CLOSING IT NOW IF IDLE; CALLER HOLDS pool.mtx */
+func (pool *JobDBPool) retire(h *jobDBHandle) {
+	if h.refs == 0 {
+		pool.close(h)
+		return
+	}
+	h.stale = true
+	pool.remove(h)
+}
+
+/* CALLER HOLDS pool.mtx */
+func (pool *JobDBPool) close(h *jobDBHandle) {
+	pool.remove(h)
+	if err := h.jdbc.Disconnect(); err != nil {
+		LogErr(fmt.Errorf("(*JobDBPool) close( ) -> %s: %s", h.key, err.Error()))
+	}
+}
+
+/* CALLER HOLDS pool.mtx */
+func (pool *JobDBPool) remove(h *jobDBHandle) {
+	if h.elem != nil {
+		pool.lru.Remove(h.elem)
+		h.elem = nil
+	}
+	if pool.handles[h.key] == h {
+		delete(pool.handles, h.key)
+	}
+}
+
+/* CLOSES HANDLES UNUSED FOR LONGER THAN pool.Idle */
+func (pool *JobDBPool) sweeper() {
+	for range time.Tick(JOB_POOL_SWEEP_MS * time.Millisecond) {
+		pool.mtx.Lock()
+		for e := pool.lru.Back(); e != nil; {
+			h := e.Value.(*jobDBHandle)
+			e = e.Prev()
+			if h.refs == 0 && time.Since(h.used) > pool.Idle {
+				pool.close(h)
+				pool.stats.IdleClosed++
+			}
+		}
+		pool.mtx.Unlock()
+	}
+}
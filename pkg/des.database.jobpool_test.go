@@ -0,0 +1,181 @@
+package pkg
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+/* A POOL OF max HANDLES OVER THE SQLITE JOBS SN0001_A, _B AND _C; NO IDLE SWEEP */
+func testJobPool(t *testing.T, max int) *JobDBPool {
+	t.Helper()
+	testJobDirs(t)
+	testJobDevice(t)
+	JOB_STORE = SQLiteJobStore{}
+	for _, name := range []string{"SN0001_A", "SN0001_B", "SN0001_C"} {
+		testJobDB(t, JOB_STORE.Client(name), testJobClass{}, testJobRows...)
+	}
+
+	pool := NewJobDBPool(max, time.Hour)
+	pool.sweep.Do(func() {})
+	t.Cleanup(pool.CloseAll)
+	return pool
+}
+
+func testAcquire(t *testing.T, pool *JobDBPool, name string, readOnly bool) JobDBClient {
+	t.Helper()
+	jdbc, err := pool.Acquire(name, readOnly)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return jdbc
+}
+
+/* RETURNS THE NAMES OF THE POOL'S HANDLES, MOST RECENTLY USED FIRST, AND THE REFERENCES HELD ON EACH */
+func testPoolHandles(pool *JobDBPool) (names []string, refs map[string]int) {
+	refs = make(map[string]int)
+	for _, h := range pool.Stats().Handles {
+		names = append(names, h.Name)
+		refs[h.Name] = h.Refs
+	}
+	return
+}
+
+func TestJobDBPoolCountsReferences(t *testing.T) {
+	pool := testJobPool(t, 2)
+
+	a1 := testAcquire(t, pool, "SN0001_A", false)
+	a2 := testAcquire(t, pool, "SN0001_A", false)
+	if a1.DB != a2.DB {
+		t.Fatal("second request for a job opened another handle")
+	}
+	if stats := pool.Stats(); stats.Open != 1 || stats.Hits != 1 || stats.Misses != 1 {
+		t.Fatalf("open %d, hits %d, misses %d; want 1, 1, 1", stats.Open, stats.Hits, stats.Misses)
+	}
+
+	/* EACH COPY RELEASES ONCE */
+	a1.Disconnect()
+	a1.Disconnect()
+	if _, refs := testPoolHandles(pool); refs["SN0001_A"] != 1 {
+		t.Fatalf("%d references after one release; want 1", refs["SN0001_A"])
+	}
+
+	/* THE HANDLE STAYS OPEN FOR THE NEXT REQUEST */
+	a2.Disconnect()
+	if stats := pool.Stats(); stats.Open != 1 || stats.InUse != 0 {
+		t.Fatalf("open %d, in use %d; want 1 idle handle", stats.Open, stats.InUse)
+	}
+	var n int64
+	if err := a2.Model(&testJobRow{}).Count(&n).Error; err != nil || n != 2 {
+		t.Fatalf("released handle closed: %d rows, %v", n, err)
+	}
+}
+
+func TestJobDBPoolEvictsLeastRecentlyUsed(t *testing.T) {
+	pool := testJobPool(t, 2)
+
+	for _, name := range []string{"SN0001_A", "SN0001_B", "SN0001_A"} {
+		jdbc := testAcquire(t, pool, name, false)
+		jdbc.Disconnect()
+	}
+	c := testAcquire(t, pool, "SN0001_C", false)
+	if names, _ := testPoolHandles(pool); len(names) != 2 || names[0] != "SN0001_C" || names[1] != "SN0001_A" {
+		t.Fatalf("handles %v; want [SN0001_C SN0001_A]", names)
+	}
+	if stats := pool.Stats(); stats.Evicted != 1 {
+		t.Fatalf("%d evicted; want 1", stats.Evicted)
+	}
+
+	/* HANDLES IN USE ARE NEVER CLOSED; THE POOL GROWS AND SHRINKS BACK WHEN THEY ARE RELEASED */
+	a := testAcquire(t, pool, "SN0001_A", false)
+	b := testAcquire(t, pool, "SN0001_B", false)
+	if stats := pool.Stats(); stats.Open != 3 || stats.Overflow == 0 {
+		t.Fatalf("open %d, overflow %d; want 3 open beyond max", stats.Open, stats.Overflow)
+	}
+	a.Disconnect()
+	if names, _ := testPoolHandles(pool); len(names) != 2 || names[0] != "SN0001_B" || names[1] != "SN0001_C" {
+		t.Fatalf("handles %v; want [SN0001_B SN0001_C]", names)
+	}
+	b.Disconnect()
+	c.Disconnect()
+}
+
+func TestJobDBPoolReadOnlyHandles(t *testing.T) {
+	pool := testJobPool(t, 4)
+
+	ro := testAcquire(t, pool, "SN0001_A", true)
+	defer ro.Disconnect()
+	if err := ro.Create(&testJobRow{ID: 10}).Error; err == nil {
+		t.Fatal("wrote through a read-only handle")
+	}
+	var n int64
+	if err := ro.Model(&testJobRow{}).Count(&n).Error; err != nil || n != 2 {
+		t.Fatalf("read-only handle read %d rows, %v; want 2", n, err)
+	}
+
+	/* A READ-WRITE REQUEST FOR THE SAME JOB GETS ITS OWN HANDLE */
+	rw := testAcquire(t, pool, "SN0001_A", false)
+	defer rw.Disconnect()
+	if rw.DB == ro.DB {
+		t.Fatal("read-write request shares the read-only handle")
+	}
+	if err := rw.Create(&testJobRow{ID: 10}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stats := pool.Stats(); stats.Open != 2 {
+		t.Fatalf("%d handles open; want 2", stats.Open)
+	}
+}
+
+func TestJobDBPoolConcurrentAcquire(t *testing.T) {
+	pool := testJobPool(t, 4)
+
+	/* REQUESTS RACING TO OPEN A JOB SHARE ONE HANDLE */
+	jdbcs := make([]JobDBClient, 8)
+	wg := sync.WaitGroup{}
+	for i := range jdbcs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			jdbcs[i], _ = pool.Acquire("SN0001_A", true)
+		}(i)
+	}
+	wg.Wait()
+
+	if _, refs := testPoolHandles(pool); len(refs) != 1 || refs["SN0001_A"] != len(jdbcs) {
+		t.Fatalf("references %v; want %d on one handle", refs, len(jdbcs))
+	}
+	for i := range jdbcs {
+		if jdbcs[i].DB != jdbcs[0].DB {
+			t.Fatal("racing requests got different handles")
+		}
+		jdbcs[i].Disconnect()
+	}
+}
+
+func TestJobDBPoolCloseWaitsForRelease(t *testing.T) {
+	pool := testJobPool(t, 4)
+
+	a := testAcquire(t, pool, "SN0001_A", false)
+	pool.Close("SN0001_A")
+	if stats := pool.Stats(); stats.Open != 0 {
+		t.Fatalf("%d handles open after Close; want 0", stats.Open)
+	}
+
+	/* STILL USABLE BY THE REQUEST HOLDING IT */
+	var n int64
+	if err := a.Model(&testJobRow{}).Count(&n).Error; err != nil {
+		t.Fatalf("handle in use closed: %v", err)
+	}
+
+	/* THE NEXT REQUEST OPENS A NEW HANDLE */
+	b := testAcquire(t, pool, "SN0001_A", false)
+	defer b.Disconnect()
+	if b.DB == a.DB {
+		t.Fatal("closed handle handed out again")
+	}
+	a.Disconnect()
+	if err := a.Model(&testJobRow{}).Count(&n).Error; err == nil {
+		t.Fatal("closed handle still open once released")
+	}
+}
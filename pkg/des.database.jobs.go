@@ -23,7 +23,6 @@ import (
 	/* https://gorm.io/docs/ */
 	"gorm.io/gorm" // go get gorm.io/gorm
 	// "github.com/glebarez/sqlite" // go get github.com/glebarez/sqlite
-	"gorm.io/driver/sqlite" // go get gorm.io/driver/sqlite
 	"gorm.io/gorm/logger"
 )
 
@@ -33,16 +32,33 @@ type JobDBClient struct {
 
 	/* MUTEXT TO PREVENT RACE ON WRITE TO DB */
 	RWM *sync.RWMutex
+
+	/* THE JOB ( DATABASE ) NAME AND THE STORE IT IS KEPT IN; A CLIENT WITH NO Store OPENS ConnStr AS AN SQLITE FILE */
+	Name  string
+	Store JobStore
+
+	/* OPEN WITHOUT WRITE ACCESS ( SEE JobStore.Open ); SET BEFORE Connect */
+	ReadOnly bool
+
+	/* SET WHERE THE CLIENT CAME FROM A JobDBPool; Disconnect RETURNS IT TO THE POOL ( SEE des.database.jobpool.go ) */
+	handle   *jobDBHandle
+	released bool
 }
 
+/* RETURNS A CLIENT FOR THE JOB DATABASE IN THE CONFIGURED JOB_STORE ( SEE des.database.jobstore.go ) */
 func GetJobDBClient(db_name string) (jdbc JobDBClient, err error) {
-	jdbc = JobDBClient{
-		ConnStr: fmt.Sprintf("%s/%s/%s", DATA_DIR, JOB_DB_DIR, db_name),
-		RWM: &sync.RWMutex{},
-	}
+	jdbc = JOB_STORE.Client(db_name)
 	return
 }
 
+/* RETURNS THE JOB_STORE IN WHICH THIS CLIENT'S DATABASE IS KEPT */
+func (jdbc *JobDBClient) store() JobStore {
+	if jdbc.Store == nil {
+		return SQLiteJobStore{}
+	}
+	return jdbc.Store
+}
+
 func (jdbc *JobDBClient) Connect() (err error) {
 
 	if jdbc.ConnStr == "" {
@@ -56,7 +72,7 @@ func (jdbc *JobDBClient) Connect() (err error) {
 	}
 
 	jdbc.RWM.Lock()
-	if jdbc.DB, err = gorm.Open(sqlite.Open(jdbc.ConnStr), &gorm.Config{}); err != nil {
+	if jdbc.DB, err = jdbc.store().Open(jdbc); err != nil {
 		// fmt.Printf("\n(*JobDBClient) Connect() -> %s -> FAILED! \n", jdbc.GetDBName())
 		return LogErr(err)
 	}
@@ -69,6 +85,12 @@ func (jdbc *JobDBClient) Connect() (err error) {
 }
 func (jdbc *JobDBClient) Disconnect() (err error) {
 
+	/* A POOLED CLIENT IS RELEASED; THE POOL DECIDES WHEN TO CLOSE THE CONNECTION */
+	if jdbc.handle != nil {
+		jdbc.handle.pool.Release(jdbc)
+		return
+	}
+
 	/* THIS JobDBClient SHOULD ALREADY HAVE A RWMutex 
 	BUT WE'LL JUST MAKE SURE BEFORE TRYING TO LOCK IT */
 	if jdbc.RWM != nil {
@@ -91,6 +113,9 @@ func (jdbc *JobDBClient) Disconnect() (err error) {
 	return
 }
 func (jdbc *JobDBClient) GetDBNameFromConnStr() string {
+	if jdbc.Name != "" {
+		return jdbc.Name
+	}
 	str := strings.Split(jdbc.ConnStr, "/")
 	if len(str) == 3 {
 		/* THIS IS A VALID CONNECTION STRING */
@@ -0,0 +1,266 @@
+/* Data Exchange Server (DES) is a component of the Datacan Data2Desk (D2D) Platform.
+License:
+
+	[PROPER LEGALESE HERE...]
+
+	INTERIM LICENSE DESCRIPTION:
+	In spirit, this license:
+	1. Allows <Third Party> to use, modify, and / or distributre this software in perpetuity so long as <Third Party> understands:
+		a. The software is porvided as is without guarantee of additional support from DataCan in any form.
+		b. The software is porvided as is without guarantee of exclusivity.
+
+	2. Prohibits <Third Party> from taking any action which might interfere with DataCan's right to use, modify and / or distributre this software in perpetuity.
+*/
+
+package pkg
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+/*
+JOB DATABASE SCHEMA VERSIONS
+
+EACH DEVICE CLASS LISTS THE MIGRATIONS OF ITS JOB DATABASES, OLDEST FIRST ( DeviceClass.JobDBSchemaMigrations )
+  - THE VERSIONS APPLIED TO A JOB DATABASE ARE RECORDED IN ITS OWN job_schema TABLE
+  - A NEW JOB DATABASE IS CREATED AT THE LATEST VERSION ( StampJobDBSchema )
+  - AN OLDER ONE IS UPGRADED THE FIRST TIME IT IS OPENED ( EnsureJobDBSchema ), OR IN BULK ( UpgradeJobDBs, -upgrade_jobs )
+  - BEFORE UPGRADING, THE JOB DATABASE IS BACKED UP ( JobStore.Backup )
+  - EACH MIGRATION RUNS IN A TRANSACTION WITH THE RECORD OF ITS VERSION;
+    AN INTERRUPTED UPGRADE RESUMES FROM THE LAST VERSION RECORDED
+  - MIGRATIONS MUST ALSO BE SAFE TO RUN AGAINST A DATABASE THEY HAVE ALREADY ( PARTLY ) CHANGED
+*/
+type JobDBSchemaMigration struct {
+	Version int64
+	Name    string
+	Up      func(tx *gorm.DB) error
+}
+
+type JobDBSchemaVersion struct {
+	Version int64  `gorm:"primaryKey; autoIncrement:false" json:"version"`
+	Name    string `json:"name"`
+	Applied int64  `json:"applied"` // Unix milliseconds
+	Backup  string `json:"backup"`  // Where the job database was copied before this version was applied
+}
+
+func (JobDBSchemaVersion) TableName() string { return "job_schema" }
+
+type JobDBUpgrade struct {
+	Job    string `json:"job"`
+	Class  string `json:"class"`
+	From   int64  `json:"from"`
+	To     int64  `json:"to"`
+	Backup string `json:"backup"`
+	Status string `json:"status"` // upgraded, current, failed
+	Err    string `json:"err"`
+}
+
+/* RETURNS THE HIGHEST VERSION RECORDED IN THE JOB DATABASE; 0 WHERE NONE IS */
+func (jdbc *JobDBClient) SchemaVersion() (version int64, err error) {
+	if !jdbc.Migrator().HasTable(&JobDBSchemaVersion{}) {
+		return
+	}
+	err = jdbc.Model(&JobDBSchemaVersion{}).Select("COALESCE( MAX( version ), 0 )").Scan(&version).Error
+	return
+}
+
+/* RECORDS EVERY MIGRATION AS APPLIED; CALLED WHEN THE TABLES OF A NEW JOB DATABASE ARE CREATED */
+func StampJobDBSchema(jdbc *JobDBClient, migs []JobDBSchemaMigration) (err error) {
+	if err = jdbc.Migrator().AutoMigrate(&JobDBSchemaVersion{}); err != nil {
+		return
+	}
+	now := time.Now().UTC().UnixMilli()
+	for _, mig := range migs {
+		if err = jdbc.Save(&JobDBSchemaVersion{Version: mig.Version, Name: mig.Name, Applied: now}).Error; err != nil {
+			return
+		}
+	}
+	return
+}
+
+/* APPLIES THE MIGRATIONS NOT YET RECORDED IN THE JOB DATABASE, BACKING IT UP FIRST */
+func UpgradeJobDB(jdbc *JobDBClient, migs []JobDBSchemaMigration) (upg JobDBUpgrade, err error) {
+
+	upg.Job = jdbc.GetDBNameFromConnStr()
+	if upg.From, err = jdbc.SchemaVersion(); err != nil {
+		return
+	}
+	upg.To, upg.Status = upg.From, "current"
+
+	pending := []JobDBSchemaMigration{}
+	for _, mig := range migs {
+		if mig.Version > upg.From {
+			pending = append(pending, mig)
+		}
+	}
+	if len(pending) == 0 {
+		return
+	}
+
+	if err = jdbc.Migrator().AutoMigrate(&JobDBSchemaVersion{}); err != nil {
+		return
+	}
+
+	tag := fmt.Sprintf("v%d_%d", upg.From, time.Now().UTC().UnixMilli())
+	if upg.Backup, err = jdbc.store().Backup(jdbc, tag); err != nil {
+		return upg, fmt.Errorf("Backup %s: %s", upg.Job, err.Error())
+	}
+
+	for _, mig := range pending {
+		err = jdbc.Transaction(func(tx *gorm.DB) error {
+			if err := mig.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&JobDBSchemaVersion{
+				Version: mig.Version,
+				Name:    mig.Name,
+				Applied: time.Now().UTC().UnixMilli(),
+				Backup:  upg.Backup,
+			}).Error
+		})
+		if err != nil {
+			return upg, fmt.Errorf("Upgrade %s to version %d ( %s ): %s", upg.Job, mig.Version, mig.Name, err.Error())
+		}
+		upg.To = mig.Version
+	}
+	upg.Status = "upgraded"
+	return
+}
+
+const JOB_SCHEMA_CHECKED_MAX = 4096 // Jobs remembered as up to date; beyond this the list is cleared and jobs are checked again
+
+/* JOB DATABASES THIS PROCESS HAS FOUND ( OR BROUGHT ) UP TO DATE */
+var JobDBSchemasChecked = make(map[string]bool)
+var JobDBSchemasCheckedMutex = sync.Mutex{}
+
+/* ONE LOCK PER JOB DATABASE; AN UPGRADE HOLDS UP ONLY THOSE OPENING THE SAME JOB. A LOCK IS REMOVED WHEN NO ONE HOLDS OR WAITS ON IT */
+type jobDBSchemaLock struct {
+	sync.Mutex
+	refs int
+}
+
+var JobDBSchemaLocks = make(map[string]*jobDBSchemaLock)
+
+/* LOCKS THE JOB'S SCHEMA; CALL THE RETURNED unlock WHEN DONE */
+func lockJobDBSchema(db_name string) (unlock func()) {
+	JobDBSchemasCheckedMutex.Lock()
+	lk := JobDBSchemaLocks[db_name]
+	if lk == nil {
+		lk = &jobDBSchemaLock{}
+		JobDBSchemaLocks[db_name] = lk
+	}
+	lk.refs++
+	JobDBSchemasCheckedMutex.Unlock()
+
+	lk.Lock()
+	return func() {
+		lk.Unlock()
+		JobDBSchemasCheckedMutex.Lock()
+		if lk.refs--; lk.refs == 0 {
+			delete(JobDBSchemaLocks, db_name)
+		}
+		JobDBSchemasCheckedMutex.Unlock()
+	}
+}
+
+func jobDBSchemaChecked(db_name string) bool {
+	JobDBSchemasCheckedMutex.Lock()
+	defer JobDBSchemasCheckedMutex.Unlock()
+	return JobDBSchemasChecked[db_name]
+}
+
+func setJobDBSchemaChecked(db_name string) {
+	JobDBSchemasCheckedMutex.Lock()
+	if len(JobDBSchemasChecked) >= JOB_SCHEMA_CHECKED_MAX {
+		JobDBSchemasChecked = make(map[string]bool)
+	}
+	JobDBSchemasChecked[db_name] = true
+	JobDBSchemasCheckedMutex.Unlock()
+}
+
+/*
+	UPGRADES THE JOB DATABASE, IF NECESSARY, THE FIRST TIME THIS PROCESS OPENS IT
+
+JOB DATABASES THAT DO NOT YET EXIST ARE LEFT TO BE CREATED ( AND STAMPED ) BY THEIR DEVICE CLASS
+*/
+func EnsureJobDBSchema(db_name string) (err error) {
+
+	if jobDBSchemaChecked(db_name) {
+		return
+	}
+
+	/* OTHER CALLERS FOR THIS JOB WAIT RATHER THAN OPEN THE DATABASE MID-UPGRADE */
+	unlock := lockJobDBSchema(db_name)
+	defer unlock()
+
+	if jobDBSchemaChecked(db_name) || !JOB_STORE.Exists(db_name) {
+		return
+	}
+
+	/* A FAILED JOB IS NOT MARKED; IT IS TRIED AGAIN THE NEXT TIME IT IS OPENED */
+	upg := upgradeJobDB(db_name)
+	if upg.Err != "" {
+		return LogErr(fmt.Errorf("EnsureJobDBSchema( ): %s", upg.Err))
+	}
+	setJobDBSchemaChecked(db_name)
+	return
+}
+
+/* UPGRADES EVERY JOB DATABASE REGISTERED IN des_jobs */
+func UpgradeJobDBs() (upgs []JobDBUpgrade, err error) {
+
+	names := []string{}
+	if err = DES.DB.Table("des_jobs").Distinct("des_job_name").Order("des_job_name").Pluck("des_job_name", &names).Error; err != nil {
+		return
+	}
+
+	for _, name := range names {
+		unlock := lockJobDBSchema(name)
+		if !JOB_STORE.Exists(name) {
+			unlock()
+			continue
+		}
+		upg := upgradeJobDB(name)
+		if upg.Err == "" {
+			setJobDBSchemaChecked(name)
+		}
+		unlock()
+		fmt.Printf("\nUpgradeJobDBs( ): %s -> %s %s\n", name, upg.Status, upg.Err)
+		upgs = append(upgs, upg)
+	}
+	return
+}
+
+func upgradeJobDB(db_name string) (upg JobDBUpgrade) {
+
+	upg.Job = db_name
+	fail := func(err error) JobDBUpgrade {
+		upg.Status, upg.Err = "failed", err.Error()
+		return upg
+	}
+
+	dc, err := JobDeviceClass(db_name)
+	if err != nil {
+		return fail(err)
+	}
+
+	jdbc, err := GetJobDBClient(db_name)
+	if err != nil {
+		return fail(err)
+	}
+	if err = jdbc.Connect(); err != nil {
+		return fail(err)
+	}
+	defer jdbc.Disconnect()
+
+	class := DeviceClassKey(dc.Class(), dc.Version())
+	if upg, err = UpgradeJobDB(&jdbc, dc.JobDBSchemaMigrations()); err != nil {
+		upg = fail(err)
+	}
+	upg.Class = class
+	return
+}
@@ -0,0 +1,204 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+/* ADDED BY VERSION 2 OF testJobSchema */
+type testJobNote struct {
+	ID   int64 `gorm:"primaryKey"`
+	Note string
+}
+
+/*
+	THE SQLITE JOB SN0001_0000000001, CREATED BEFORE SCHEMA VERSIONS WERE RECORDED, AND TWO MIGRATIONS FOR IT
+
+ups COUNTS THE RUNS OF EACH VERSION; v2 IS CALLED AS VERSION 2 RUNS ( IN ITS TRANSACTION )
+*/
+func testJobSchema(t *testing.T, v2 func(tx *gorm.DB) error) (jdbc JobDBClient, ups map[int64]int) {
+	t.Helper()
+	testJobDirs(t)
+	testJobDevice(t)
+	JOB_STORE = SQLiteJobStore{}
+	jdbc = *testJobDB(t, JOB_STORE.Client("SN0001_0000000001"), testJobClass{}, testJobRows...)
+
+	mtx := sync.Mutex{}
+	ups = make(map[int64]int)
+	up := func(version int64, fn func(tx *gorm.DB) error) func(tx *gorm.DB) error {
+		return func(tx *gorm.DB) error {
+			mtx.Lock()
+			ups[version]++
+			mtx.Unlock()
+			return fn(tx)
+		}
+	}
+	testJobMigrations = []JobDBSchemaMigration{
+		{Version: 1, Name: "baseline", Up: up(1, func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&testJobRow{}, &testJobSeed{})
+		})},
+		{Version: 2, Name: "notes", Up: up(2, func(tx *gorm.DB) error {
+			if err := tx.AutoMigrate(&testJobNote{}); err != nil {
+				return err
+			}
+			if v2 != nil {
+				return v2(tx)
+			}
+			return nil
+		})},
+	}
+
+	t.Cleanup(func() {
+		testJobMigrations = nil
+		JobDBSchemasCheckedMutex.Lock()
+		JobDBSchemasChecked = make(map[string]bool)
+		JobDBSchemasCheckedMutex.Unlock()
+	})
+	return
+}
+
+func TestUpgradeJobDBFromUnversioned(t *testing.T) {
+	jdbc, ups := testJobSchema(t, nil)
+
+	upg, err := UpgradeJobDB(&jdbc, testJobMigrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if upg.Status != "upgraded" || upg.From != 0 || upg.To != 2 {
+		t.Fatalf("%s from %d to %d; want upgraded from 0 to 2", upg.Status, upg.From, upg.To)
+	}
+	if _, err = os.Stat(upg.Backup); err != nil {
+		t.Fatalf("backup %q: %v", upg.Backup, err)
+	}
+	if !jdbc.Migrator().HasTable(&testJobNote{}) {
+		t.Fatal("version 2 not applied")
+	}
+	versions := []JobDBSchemaVersion{}
+	jdbc.Order("version").Find(&versions)
+	if len(versions) != 2 || versions[0].Name != "baseline" || versions[1].Backup != upg.Backup {
+		t.Fatalf("versions recorded %+v", versions)
+	}
+
+	/* NOTHING LEFT TO APPLY */
+	if upg, err = UpgradeJobDB(&jdbc, testJobMigrations); err != nil || upg.Status != "current" || upg.Backup != "" {
+		t.Fatalf("second upgrade %+v, %v; want current without a backup", upg, err)
+	}
+	if ups[1] != 1 || ups[2] != 1 {
+		t.Fatalf("migrations run %v; want each once", ups)
+	}
+}
+
+func TestUpgradeJobDBResumesFromRecordedVersion(t *testing.T) {
+	jdbc, ups := testJobSchema(t, nil)
+	if err := StampJobDBSchema(&jdbc, testJobMigrations[:1]); err != nil {
+		t.Fatal(err)
+	}
+
+	upg, err := UpgradeJobDB(&jdbc, testJobMigrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if upg.From != 1 || upg.To != 2 {
+		t.Fatalf("from %d to %d; want 1 to 2", upg.From, upg.To)
+	}
+	if ups[1] != 0 || ups[2] != 1 {
+		t.Fatalf("migrations run %v; want only version 2", ups)
+	}
+}
+
+func TestUpgradeJobDBLeavesFailedMigrationUnrecorded(t *testing.T) {
+	jdbc, _ := testJobSchema(t, func(tx *gorm.DB) error { return errors.New("no") })
+
+	upg, err := UpgradeJobDB(&jdbc, testJobMigrations)
+	if err == nil {
+		t.Fatal("failed migration reported as applied")
+	}
+	if upg.To != 1 {
+		t.Fatalf("upgraded to %d; want 1", upg.To)
+	}
+	if v, _ := jdbc.SchemaVersion(); v != 1 {
+		t.Fatalf("version %d recorded; want 1", v)
+	}
+	if jdbc.Migrator().HasTable(&testJobNote{}) {
+		t.Fatal("failed migration not rolled back")
+	}
+
+	/* NOT MARKED AS CHECKED; TRIED AGAIN THE NEXT TIME THE JOB IS OPENED */
+	if err = EnsureJobDBSchema("SN0001_0000000001"); err == nil || jobDBSchemaChecked("SN0001_0000000001") {
+		t.Fatalf("failed job marked as checked: %v", err)
+	}
+}
+
+func TestEnsureJobDBSchemaLocksEachJob(t *testing.T) {
+	block, blocked := make(chan struct{}), make(chan struct{})
+	first := true
+	testJobSchema(t, func(tx *gorm.DB) (err error) {
+		/* THE FIRST UPGRADE WAITS UNTIL RELEASED; THE OTHERS START ONLY ONCE IT HAS BLOCKED */
+		if first {
+			first = false
+			close(blocked)
+			<-block
+		}
+		return
+	})
+	testJobDB(t, JOB_STORE.Client("SN0001_0000000002"), testJobClass{}, testJobRows...)
+
+	upgrade := make(chan error)
+	go func() { upgrade <- EnsureJobDBSchema("SN0001_0000000001") }()
+	<-blocked
+
+	/* ANOTHER CALLER FOR THE SAME JOB WAITS FOR THE UPGRADE */
+	second := make(chan error)
+	go func() { second <- EnsureJobDBSchema("SN0001_0000000001") }()
+
+	/* OTHER JOBS ARE NOT HELD UP */
+	if err := EnsureJobDBSchema("SN0001_0000000002"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-second:
+		t.Fatal("job opened mid-upgrade")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(block)
+	for _, c := range []chan error{upgrade, second} {
+		if err := <-c; err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"SN0001_0000000001", "SN0001_0000000002"} {
+		if !jobDBSchemaChecked(name) {
+			t.Errorf("%s not marked as checked", name)
+		}
+	}
+	JobDBSchemasCheckedMutex.Lock()
+	locks := len(JobDBSchemaLocks)
+	JobDBSchemasCheckedMutex.Unlock()
+	if locks != 0 {
+		t.Fatalf("%d job locks kept after the upgrades", locks)
+	}
+}
+
+func TestJobDBSchemasCheckedIsBounded(t *testing.T) {
+	t.Cleanup(func() {
+		JobDBSchemasCheckedMutex.Lock()
+		JobDBSchemasChecked = make(map[string]bool)
+		JobDBSchemasCheckedMutex.Unlock()
+	})
+	for i := 0; i <= JOB_SCHEMA_CHECKED_MAX; i++ {
+		setJobDBSchemaChecked(fmt.Sprintf("SN0001_%010d", i))
+	}
+	JobDBSchemasCheckedMutex.Lock()
+	n := len(JobDBSchemasChecked)
+	JobDBSchemasCheckedMutex.Unlock()
+	if n > JOB_SCHEMA_CHECKED_MAX {
+		t.Fatalf("%d jobs remembered; want at most %d", n, JOB_SCHEMA_CHECKED_MAX)
+	}
+}
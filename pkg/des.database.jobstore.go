@@ -0,0 +1,639 @@
+/* Data Exchange Server (DES) is a component of the Datacan Data2Desk (D2D) Platform.
+License:
+
+	[PROPER LEGALESE HERE...]
+
+	INTERIM LICENSE DESCRIPTION:
+	In spirit, this license:
+	1. Allows <Third Party> to use, modify, and / or distributre this software in perpetuity so long as <Third Party> understands:
+		a. The software is porvided as is without guarantee of additional support from DataCan in any form.
+		b. The software is porvided as is without guarantee of exclusivity.
+
+	2. Prohibits <Third Party> from taking any action which might interfere with DataCan's right to use, modify and / or distributre this software in perpetuity.
+*/
+
+package pkg
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+/*
+JOB STORES
+
+WHERE JOB DATABASES ARE KEPT; EVERY JobDBClient IS OPENED THROUGH THE JOB_STORE:
+  - sqlite ( DEFAULT ): ONE SQLITE FILE PER JOB UNDER JOB_DBS
+  - postgres: ONE SCHEMA PER JOB ( job_<job name> ) IN A SINGLE POSTGRES DATABASE
+  - timescale: AS postgres; TABLES THE DEVICE CLASS MARKS AS TIME SERIES ( SEE CreateHypertable ) ARE HYPERTABLES
+
+THE JOB MODELS, WriteXXX / ReadLastXXX FUNCTIONS AND QUERIES ARE THE SAME IN EVERY STORE;
+A POSTGRES JOB CONNECTION SETS search_path TO THE JOB'S SCHEMA, SO UNQUALIFIED TABLE NAMES RESOLVE TO THE JOB
+
+OPENING A JOB DATABASE NEVER CREATES IT; THE DEVICE CLASS ( CreateJobDBTables ) AND MigrateJobDBs CALL JobDBClient.CreateJobDB FIRST
+*/
+const JOB_STORE_SQLITE = "sqlite"
+const JOB_STORE_POSTGRES = "postgres"
+const JOB_STORE_TIMESCALE = "timescale"
+
+const JOB_STORE_DB = "des_jobs"             // The Postgres database used where no connection string is given
+const JOB_SCHEMA_PREFIX = "job_"            // Postgres schema of a job: job_<job name>
+const JOB_STORE_MAX_CONNS = 4               // Per job connection pool size ( Postgres )
+const JOB_HYPERTABLE_CHUNK = 86400000       // 1 day in milliseconds; time columns are Unix milliseconds
+const JOB_DBS_MIGRATED = "job_dbs_migrated" // Under ARCHIVE_DIR; SQLite files moved to another store
+const JOB_DBS_BACKUP = "job_dbs_backup"     // Under ARCHIVE_DIR; SQLite copies taken before a schema upgrade
+const SQLITE_BUSY_TIMEOUT_MS = 5000         // Wait on a locked SQLite job database before failing
+
+type JobStore interface {
+	Kind() string                                                // JOB_STORE_...
+	Client(db_name string) JobDBClient                           // A client ( not connected ) for the job database
+	Open(jdbc *JobDBClient) (db *gorm.DB, err error)             // Opens the job database; SQLite creates the file where it does not exist
+	CreateJobDB(jdbc *JobDBClient) error                         // Creates the ( empty ) job database; called before its tables are created
+	Exists(db_name string) bool                                  // True where the job database has been created
+	Drop(db_name string) error                                   // Removes the job database
+	CreateHypertable(jdbc *JobDBClient, table, col string) error // Time series table; ignored except by timescale
+	Backup(jdbc *JobDBClient, tag string) (string, error)        // Copies the job database aside; returns where it was copied
+}
+
+/* THE STORE IN WHICH ALL NEW JOB CONNECTIONS ARE OPENED; SET ONCE AT STARTUP ( SEE ConfigureJobStore ) */
+var JOB_STORE JobStore = SQLiteJobStore{}
+
+/*
+	SELECT THE JOB STORE
+
+kind IS ONE OF JOB_STORE_...; conn IS THE POSTGRES CONNECTION STRING OF THE JOB DATABASE
+WHERE conn IS EMPTY, THE JOB_STORE_DB DATABASE ON THE DES DATABASE SERVER IS USED ( AND CREATED WHERE IT DOES NOT EXIST )
+*/
+func ConfigureJobStore(kind, conn string) (err error) {
+
+	switch kind {
+	case "", JOB_STORE_SQLITE:
+		JOB_STORE = SQLiteJobStore{}
+		return
+
+	case JOB_STORE_POSTGRES, JOB_STORE_TIMESCALE:
+		if conn == "" {
+			if !ADB.CheckDatabaseExists(JOB_STORE_DB) {
+				if err = ADB.CreateDatabase(JOB_STORE_DB); err != nil {
+					return LogErr(err)
+				}
+			}
+			conn = strings.TrimSuffix(DES_DB_CONNECTION_STRING, DES_DB) + JOB_STORE_DB
+		}
+
+		pg := &PostgresJobStore{
+			Timescale: kind == JOB_STORE_TIMESCALE,
+			DBClient:  DBClient{ConnStr: conn},
+		}
+		if err = pg.Connect(); err != nil {
+			return
+		}
+		if pg.Timescale {
+			if res := pg.DB.Exec("CREATE EXTENSION IF NOT EXISTS timescaledb"); res.Error != nil {
+				return LogErr(res.Error)
+			}
+		}
+		JOB_STORE = pg
+		return
+	}
+	return fmt.Errorf("Unknown job store: %s", kind)
+}
+
+/* SQLITE *****************************************************************************************/
+
+type SQLiteJobStore struct{}
+
+func (SQLiteJobStore) Kind() string { return JOB_STORE_SQLITE }
+
+func (store SQLiteJobStore) Client(db_name string) JobDBClient {
+	return JobDBClient{
+		ConnStr: store.Path(db_name),
+		RWM:     &sync.RWMutex{},
+		Name:    db_name,
+		Store:   store,
+	}
+}
+
+/* RETURNS THE PATH OF THE JOB'S SQLITE FILE */
+func (SQLiteJobStore) Path(db_name string) string {
+	return fmt.Sprintf("%s/%s/%s", DATA_DIR, JOB_DB_DIR, db_name)
+}
+
+/* READ-WRITE CONNECTIONS USE WAL SO READERS DON'T BLOCK THE WRITER; READ-ONLY CONNECTIONS REFUSE CHANGES */
+func (SQLiteJobStore) Open(jdbc *JobDBClient) (db *gorm.DB, err error) {
+	dsn := fmt.Sprintf("%s?_busy_timeout=%d", jdbc.ConnStr, SQLITE_BUSY_TIMEOUT_MS)
+	if jdbc.ReadOnly {
+		dsn += "&_query_only=1"
+	} else {
+		dsn += "&_journal_mode=WAL"
+	}
+	return gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+}
+
+/* THE FILE IS CREATED WHEN IT IS OPENED */
+func (SQLiteJobStore) CreateJobDB(jdbc *JobDBClient) error { return nil }
+
+func (store SQLiteJobStore) Exists(db_name string) bool {
+	_, err := os.Stat(store.Path(db_name))
+	return err == nil
+}
+
+func (store SQLiteJobStore) Drop(db_name string) error {
+	JOB_POOL.Close(db_name)
+	os.Remove(store.Path(db_name) + "-wal")
+	os.Remove(store.Path(db_name) + "-shm")
+	return os.Remove(store.Path(db_name))
+}
+
+/* WRITES THE JOB'S WAL INTO ITS SQLITE FILE SO THE FILE CAN BE COPIED ON ITS OWN */
+func (store SQLiteJobStore) Checkpoint(db_name string) (err error) {
+	jdbc := store.Client(db_name)
+	if err = jdbc.Connect(); err != nil {
+		return
+	}
+	defer jdbc.Disconnect()
+	return jdbc.Exec("PRAGMA wal_checkpoint(TRUNCATE)").Error
+}
+
+func (SQLiteJobStore) CreateHypertable(jdbc *JobDBClient, table, col string) error { return nil }
+
+/* COPIES THE JOB DATABASE TO ARCHIVE_DIR/JOB_DBS_BACKUP/<job>_<tag>; VACUUM INTO IS CONSISTENT WHILE OTHER CONNECTIONS ARE OPEN */
+func (SQLiteJobStore) Backup(jdbc *JobDBClient, tag string) (path string, err error) {
+
+	dir := fmt.Sprintf("%s/%s", ARCHIVE_DIR, JOB_DBS_BACKUP)
+	if err = ConfirmDirectory(dir); err != nil {
+		return
+	}
+	path = fmt.Sprintf("%s/%s_%s", dir, jdbc.Name, tag)
+
+	/* WRITE TO A TEMPORARY FILE SO AN INTERRUPTED BACKUP IS NEVER MISTAKEN FOR A COMPLETE ONE */
+	tmp := path + ".tmp"
+	os.Remove(tmp)
+	if err = jdbc.DB.Exec("VACUUM INTO ?", tmp).Error; err != nil {
+		return
+	}
+	return path, os.Rename(tmp, path)
+}
+
+/* RETURNS THE NAMES OF ALL JOB DATABASES IN JOB_DBS */
+func (SQLiteJobStore) Jobs() (names []string, err error) {
+
+	entries, err := os.ReadDir(JOB_DBS)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		/* SKIP TRANSFER UPLOADS ( xfer_*.db ) AND SQLITE SIDE FILES ( *-wal, *-shm, *-journal ) */
+		if e.IsDir() || strings.Contains(e.Name(), ".") ||
+			strings.HasSuffix(e.Name(), "-wal") || strings.HasSuffix(e.Name(), "-shm") || strings.HasSuffix(e.Name(), "-journal") {
+			continue
+		}
+		names = append(names, e.Name())
+	}
+	return
+}
+
+/* POSTGRES / TIMESCALE ***************************************************************************/
+
+type PostgresJobStore struct {
+	Timescale bool
+	DBClient  // Store connection; used to create / drop job schemas
+}
+
+func (store *PostgresJobStore) Kind() string {
+	if store.Timescale {
+		return JOB_STORE_TIMESCALE
+	}
+	return JOB_STORE_POSTGRES
+}
+
+/* RETURNS THE SCHEMA OF THE JOB; JOB NAMES ARE <serial>_<...>, SO ONLY CASE AND STRAY CHARACTERS CHANGE */
+func JobSchemaName(db_name string) string {
+	return JOB_SCHEMA_PREFIX + regexp.MustCompile(`[^a-z0-9_]`).ReplaceAllString(strings.ToLower(db_name), "_")
+}
+
+func (store *PostgresJobStore) Client(db_name string) JobDBClient {
+
+	sep := "?"
+	if strings.Contains(store.ConnStr, "?") {
+		sep = "&"
+	}
+	return JobDBClient{
+		ConnStr: fmt.Sprintf("%s%ssearch_path=%s", store.ConnStr, sep, JobSchemaName(db_name)),
+		RWM:     &sync.RWMutex{},
+		Name:    db_name,
+		Store:   store,
+	}
+}
+
+/* THE SCHEMA NEED NOT EXIST; search_path IS RESOLVED BY EACH QUERY */
+func (store *PostgresJobStore) Open(jdbc *JobDBClient) (db *gorm.DB, err error) {
+
+	dsn := jdbc.ConnStr
+	if jdbc.ReadOnly {
+		dsn += "&default_transaction_read_only=on"
+	}
+	if db, err = gorm.Open(postgres.Open(dsn), &gorm.Config{}); err != nil {
+		return
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return
+	}
+	sqlDB.SetMaxOpenConns(JOB_STORE_MAX_CONNS)
+	return
+}
+
+func (store *PostgresJobStore) CreateJobDB(jdbc *JobDBClient) error {
+	return store.DB.Exec(fmt.Sprintf(`CREATE SCHEMA IF NOT EXISTS "%s"`, JobSchemaName(jdbc.Name))).Error
+}
+
+func (store *PostgresJobStore) Exists(db_name string) (exists bool) {
+	store.DB.Raw(`SELECT EXISTS ( SELECT 1 FROM information_schema.schemata WHERE schema_name = ? )`,
+		JobSchemaName(db_name)).Scan(&exists)
+	return
+}
+
+func (store *PostgresJobStore) Drop(db_name string) error {
+	return store.DB.Exec(fmt.Sprintf(`DROP SCHEMA IF EXISTS "%s" CASCADE`, JobSchemaName(db_name))).Error
+}
+
+/* COPIES EVERY TABLE OF THE JOB'S SCHEMA INTO A NEW SCHEMA, <job schema>_bk_<tag> */
+func (store *PostgresJobStore) Backup(jdbc *JobDBClient, tag string) (bk string, err error) {
+
+	schema := JobSchemaName(jdbc.Name)
+	bk = fmt.Sprintf("%s_bk_%s", schema, tag)
+
+	tables := []string{}
+	if err = store.DB.Raw(`SELECT table_name FROM information_schema.tables WHERE table_schema = ? AND table_type = 'BASE TABLE'`,
+		schema).Scan(&tables).Error; err != nil {
+		return
+	}
+
+	err = store.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(fmt.Sprintf(`CREATE SCHEMA "%s"`, bk)).Error; err != nil {
+			return err
+		}
+		for _, t := range tables {
+			if err := tx.Exec(fmt.Sprintf(`CREATE TABLE "%s"."%s" AS TABLE "%s"."%s"`, bk, t, schema, t)).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return
+}
+
+/*
+	CONVERTS THE ( EMPTY ) TABLE TO A HYPERTABLE PARTITIONED ON col ( UNIX MILLISECONDS )
+
+TIMESCALE REQUIRES col IN EVERY UNIQUE INDEX OF A HYPERTABLE;
+A PRIMARY KEY OR UNIQUE CONSTRAINT WITHOUT col IS REPLACED BY ONE OVER ( <its columns>, col )
+*/
+func (store *PostgresJobStore) CreateHypertable(jdbc *JobDBClient, table, col string) (err error) {
+	if !store.Timescale {
+		return nil
+	}
+
+	cons := []struct {
+		Name string
+		Type string
+		Cols string
+	}{}
+	if err = jdbc.DB.Raw(`SELECT con.conname AS name, con.contype AS type, string_agg( att.attname, ',' ORDER BY array_position( con.conkey, att.attnum ) ) AS cols
+		FROM pg_constraint con
+		JOIN pg_attribute att ON att.attrelid = con.conrelid AND att.attnum = ANY( con.conkey )
+		WHERE con.conrelid = ?::regclass AND con.contype IN ( 'p', 'u' )
+		GROUP BY con.conname, con.contype`,
+		fmt.Sprintf("%s.%s", JobSchemaName(jdbc.Name), table)).Scan(&cons).Error; err != nil {
+		return
+	}
+	for _, con := range cons {
+		cols := strings.Split(con.Cols, ",")
+		if slices.Contains(cols, col) {
+			continue
+		}
+		key := "UNIQUE"
+		if con.Type == "p" {
+			key = "PRIMARY KEY"
+		}
+		if err = jdbc.DB.Exec(fmt.Sprintf(`ALTER TABLE "%s" DROP CONSTRAINT "%s", ADD CONSTRAINT "%s" %s ( "%s", "%s" )`,
+			table, con.Name, con.Name, key, strings.Join(cols, `", "`), col)).Error; err != nil {
+			return
+		}
+	}
+
+	return jdbc.DB.Exec(`SELECT create_hypertable( ?, ?, chunk_time_interval => ?::bigint, if_not_exists => TRUE )`,
+		fmt.Sprintf("%s.%s", JobSchemaName(jdbc.Name), table), col, JOB_HYPERTABLE_CHUNK).Error
+}
+
+/* CREATES THIS JOB DATABASE IN ITS STORE ( SEE JobStore.CreateJobDB ); SAFE TO CALL WHERE IT EXISTS */
+func (jdbc *JobDBClient) CreateJobDB() error {
+	return jdbc.store().CreateJobDB(jdbc)
+}
+
+/* MARKS A TIME SERIES TABLE OF THIS JOB DATABASE ( SEE JobStore.CreateHypertable ) */
+func (jdbc *JobDBClient) CreateHypertable(table, col string) error {
+	return jdbc.store().CreateHypertable(jdbc, table, col)
+}
+
+/* COPY / MIGRATE *********************************************************************************/
+
+/*
+	COPY EVERY ROW OF EVERY MODEL FROM src TO dst; RETURNS THE ROW COUNT OF EACH TABLE COPIED
+
+THE dst TABLES MUST EXIST; TABLES THAT ALREADY HOLD ROWS IN dst ( IE: SEEDED WHEN THE TABLES WERE CREATED ) ARE NOT COPIED
+*/
+func CopyJobDB(src, dst *JobDBClient, models []interface{}) (counts map[string]int64, err error) {
+
+	counts = make(map[string]int64)
+	for _, mod := range models {
+
+		stmt := &gorm.Statement{DB: dst.DB}
+		if err = stmt.Parse(mod); err != nil {
+			return
+		}
+		table := stmt.Schema.Table
+
+		var n int64
+		if err = dst.DB.Model(mod).Count(&n).Error; err != nil {
+			return
+		}
+		if n > 0 {
+			continue
+		}
+
+		rows := reflect.New(reflect.SliceOf(reflect.TypeOf(mod).Elem()))
+		if err = src.DB.Model(mod).Find(rows.Interface()).Error; err != nil {
+			return
+		}
+		if rows.Elem().Len() == 0 {
+			counts[table] = 0
+			continue
+		}
+		if err = dst.DB.Omit(clause.Associations).CreateInBatches(rows.Interface(), 500).Error; err != nil {
+			return counts, fmt.Errorf("Copy %s.%s: %s", dst.Name, table, err.Error())
+		}
+		counts[table] = int64(rows.Elem().Len())
+	}
+
+	/* ROWS KEEP THEIR IDS; MOVE POSTGRES SEQUENCES PAST THEM */
+	if dst.DB.Dialector.Name() == "postgres" {
+		seqs := []struct {
+			Table  string
+			Column string
+		}{}
+		dst.DB.Raw(`SELECT table_name AS "table", column_name AS "column" FROM information_schema.columns
+			WHERE table_schema = current_schema() AND column_default LIKE 'nextval%'`).Scan(&seqs)
+		for _, seq := range seqs {
+			if err = dst.DB.Exec(fmt.Sprintf(`SELECT setval( pg_get_serial_sequence( '%s', '%s' ), COALESCE( MAX( "%s" ), 0 ) + 1, false ) FROM "%s"`,
+				seq.Table, seq.Column, seq.Column, seq.Table)).Error; err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+/*
+	WRITTEN TO A JOB DATABASE BY MigrateJobDBs BEFORE ITS ROWS ARE COPIED; Migrated IS SET ONCE THEY ARE VERIFIED
+
+A JOB DATABASE IN THE JOB_STORE WITH Migrated = 0 WAS LEFT BY AN INTERRUPTED MIGRATION
+*/
+type JobDBMigrated struct {
+	Source   string `gorm:"primaryKey" json:"source"` // The SQLite file copied
+	Started  int64  `json:"started"`
+	Migrated int64  `json:"migrated"` // Unix milliseconds; 0 until the copy is verified
+}
+
+func (JobDBMigrated) TableName() string { return "job_migrated" }
+
+type JobDBMigration struct {
+	Job    string           `json:"job"`
+	Class  string           `json:"class"`
+	Counts map[string]int64 `json:"counts"`
+	Status string           `json:"status"` // migrated, skipped, failed
+	Err    string           `json:"err"`
+}
+
+/*
+		MOVE EVERY SQLITE JOB DATABASE IN JOB_DBS INTO THE JOB_STORE
+
+	  - THE JOB'S TABLES ARE CREATED BY ITS DEVICE CLASS, THEN EVERY ROW IS COPIED
+	  - THE COPY IS VERIFIED BY ROW COUNT; THE SQLITE FILE IS THEN MOVED TO ARCHIVE_DIR/JOB_DBS_MIGRATED
+	  - JOBS WHOSE MIGRATION COMPLETED ( job_migrated ) ARE SKIPPED; AN INTERRUPTED MIGRATION IS DROPPED AND RUN AGAIN
+	  - A JOB CREATED IN THE JOB_STORE BY THE DES ITSELF IS NOT OVERWRITTEN; IT FAILS AND ITS FILE IS KEPT
+	  - A FAILED JOB IS DROPPED FROM THE JOB_STORE AND ITS FILE IS KEPT
+*/
+func MigrateJobDBs() (migs []JobDBMigration, err error) {
+
+	if JOB_STORE.Kind() == JOB_STORE_SQLITE {
+		return nil, fmt.Errorf("The job store is %s; select a Postgres job store to migrate to", JOB_STORE_SQLITE)
+	}
+
+	names, err := SQLiteJobStore{}.Jobs()
+	if err != nil {
+		return
+	}
+
+	arc := fmt.Sprintf("%s/%s", ARCHIVE_DIR, JOB_DBS_MIGRATED)
+	if err = ConfirmDirectory(arc); err != nil {
+		return
+	}
+
+	for _, name := range names {
+
+		mig := JobDBMigration{Job: name, Status: "migrated"}
+		if err := migrateJobDB(&mig, arc); err != nil {
+			mig.Status, mig.Err = "failed", err.Error()
+			LogErr(err)
+		}
+		fmt.Printf("\nMigrateJobDBs( ): %s -> %s %s\n", name, mig.Status, mig.Err)
+		migs = append(migs, mig)
+	}
+	return
+}
+
+/* RETURNS THE MIGRATION RECORD OF A JOB DATABASE IN THE JOB_STORE; ok IS FALSE WHERE IT WAS NOT CREATED BY MigrateJobDBs */
+func jobDBMigrated(db_name string) (mark JobDBMigrated, ok bool, err error) {
+
+	jdbc := JOB_STORE.Client(db_name)
+	jdbc.ReadOnly = true
+	if err = jdbc.Connect(); err != nil {
+		return
+	}
+	defer jdbc.Disconnect()
+
+	if !jdbc.Migrator().HasTable(&JobDBMigrated{}) {
+		return
+	}
+	res := jdbc.Limit(1).Find(&mark)
+	return mark, res.RowsAffected > 0, res.Error
+}
+
+func migrateJobDB(mig *JobDBMigration, arc string) (err error) {
+
+	if JOB_STORE.Exists(mig.Job) {
+		mark, ok, err := jobDBMigrated(mig.Job)
+		switch {
+		case err != nil:
+			return err
+		case !ok:
+			return fmt.Errorf("Migrate %s: the job already exists in the %s job store", mig.Job, JOB_STORE.Kind())
+		case mark.Migrated > 0:
+			mig.Status = "skipped"
+			return nil
+		}
+		/* INTERRUPTED; START AGAIN */
+		if err = JOB_STORE.Drop(mig.Job); err != nil {
+			return err
+		}
+	}
+
+	dc, err := JobDeviceClass(mig.Job)
+	if err != nil {
+		return
+	}
+	mig.Class = DeviceClassKey(dc.Class(), dc.Version())
+
+	JOB_POOL.Close(mig.Job)
+	if err = (SQLiteJobStore{}).Checkpoint(mig.Job); err != nil {
+		return
+	}
+
+	src := SQLiteJobStore{}.Client(mig.Job)
+	if err = src.Connect(); err != nil {
+		return
+	}
+	/* DISCONNECTED BEFORE ITS FILE IS ARCHIVED; A CLIENT IS NOT DISCONNECTED TWICE */
+	open := true
+	defer func() {
+		if open {
+			src.Disconnect()
+		}
+	}()
+
+	/* BRING THE SOURCE UP TO THE SCHEMA THE TARGET IS CREATED WITH */
+	if _, err = UpgradeJobDB(&src, dc.JobDBSchemaMigrations()); err != nil {
+		return
+	}
+
+	dst := JOB_STORE.Client(mig.Job)
+	if err = dst.Connect(); err != nil {
+		return
+	}
+	defer dst.Disconnect()
+
+	fail := func(err error) error {
+		if e := JOB_STORE.Drop(mig.Job); e != nil {
+			LogErr(e)
+		}
+		return err
+	}
+
+	if err = dst.CreateJobDB(); err != nil {
+		return fail(err)
+	}
+	mark := JobDBMigrated{
+		Source:  SQLiteJobStore{}.Path(mig.Job),
+		Started: time.Now().UTC().UnixMilli(),
+	}
+	if err = dst.Migrator().AutoMigrate(&JobDBMigrated{}); err != nil {
+		return fail(err)
+	}
+	if err = dst.Create(&mark).Error; err != nil {
+		return fail(err)
+	}
+
+	if err = dc.CreateJobDBTables(&dst); err != nil {
+		return fail(err)
+	}
+	if mig.Counts, err = CopyJobDB(&src, &dst, dc.JobDBModels()); err != nil {
+		return fail(err)
+	}
+
+	/* VERIFY */
+	for table, n := range mig.Counts {
+		var m int64
+		if err = dst.DB.Table(table).Count(&m).Error; err != nil {
+			return fail(err)
+		}
+		if m != n {
+			return fail(fmt.Errorf("Migrate %s: %s has %d rows; expected %d", mig.Job, table, m, n))
+		}
+	}
+
+	mark.Migrated = time.Now().UTC().UnixMilli()
+	if err = dst.Save(&mark).Error; err != nil {
+		return fail(err)
+	}
+
+	src.Disconnect()
+	open = false
+	return os.Rename(SQLiteJobStore{}.Path(mig.Job), filepath.Join(arc, fmt.Sprintf("%s_%d", mig.Job, time.Now().UTC().UnixMilli())))
+}
+
+/* RETURNS THE DEVICE CLASS OF THE JOB ( des_jobs ), OR OF THE DEVICE WHOSE SERIAL PREFIXES THE JOB NAME */
+func JobDeviceClass(db_name string) (dc DeviceClass, err error) {
+
+	reg := DESRegistration{}
+	res := DES.DB.Table("des_jobs").
+		Select("des_devs.*, des_jobs.*").
+		Joins("JOIN des_devs ON des_devs.des_dev_id = des_jobs.des_job_dev_id").
+		Where("des_jobs.des_job_name = ?", db_name).
+		Limit(1).
+		Scan(&reg)
+	if res.Error == nil && res.RowsAffected > 0 {
+		return GetDeviceClass(reg.DESDevClass, reg.DESDevVersion)
+	}
+	return GetDeviceClassBySerial(strings.SplitN(db_name, "_", 2)[0])
+}
+
+/*
+	RETURNS THE PATH OF AN SQLITE COPY OF THE JOB DATABASE ( IE: TO SEND TO ANOTHER DES )
+
+WHERE THE JOB_STORE IS SQLITE, THIS IS THE JOB'S OWN FILE; OTHERWISE A TEMPORARY FILE THE CALLER MUST REMOVE ( temp )
+*/
+func ExportJobDB(db_name string, dc DeviceClass) (path string, temp bool, err error) {
+
+	if JOB_STORE.Kind() == JOB_STORE_SQLITE {
+		return SQLiteJobStore{}.Path(db_name), false, SQLiteJobStore{}.Checkpoint(db_name)
+	}
+
+	f, err := os.CreateTemp(JOB_DBS, "xfer_*.db")
+	if err != nil {
+		return
+	}
+	f.Close()
+	path, temp = f.Name(), true
+
+	src := JOB_STORE.Client(db_name)
+	if err = src.Connect(); err != nil {
+		return
+	}
+	defer src.Disconnect()
+
+	dst := JobDBClient{ConnStr: path, Name: db_name}
+	if err = dst.Connect(); err != nil {
+		return
+	}
+	defer dst.Disconnect()
+
+	if err = dc.CreateJobDBTables(&dst); err != nil {
+		return
+	}
+	_, err = CopyJobDB(&src, &dst, dc.JobDBModels())
+	return
+}
@@ -0,0 +1,272 @@
+package pkg
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+/* A JOB STORE OTHER THAN SQLITE ( AS MigrateJobDBs REQUIRES ), KEEPING EACH JOB IN AN SQLITE FILE UNDER dir */
+type testJobStore struct{ dir string }
+
+func (store testJobStore) Kind() string { return "test" }
+
+func (store testJobStore) Client(db_name string) JobDBClient {
+	return JobDBClient{
+		ConnStr: filepath.Join(store.dir, db_name),
+		RWM:     &sync.RWMutex{},
+		Name:    db_name,
+		Store:   store,
+	}
+}
+
+func (store testJobStore) Open(jdbc *JobDBClient) (*gorm.DB, error) {
+	return gorm.Open(sqlite.Open(jdbc.ConnStr), &gorm.Config{})
+}
+
+func (store testJobStore) CreateJobDB(jdbc *JobDBClient) error { return nil }
+
+func (store testJobStore) Exists(db_name string) bool {
+	_, err := os.Stat(filepath.Join(store.dir, db_name))
+	return err == nil
+}
+
+func (store testJobStore) Drop(db_name string) error {
+	return os.Remove(filepath.Join(store.dir, db_name))
+}
+
+func (store testJobStore) CreateHypertable(jdbc *JobDBClient, table, col string) error { return nil }
+
+func (store testJobStore) Backup(jdbc *JobDBClient, tag string) (string, error) {
+	return SQLiteJobStore{}.Backup(jdbc, tag)
+}
+
+type testJobRow struct {
+	ID   int64 `gorm:"primaryKey"`
+	Time int64
+	Val  string
+}
+
+/* SEEDED WHEN THE TABLES ARE CREATED ( AS EVENT TYPES ARE ) */
+type testJobSeed struct {
+	ID   int64 `gorm:"primaryKey"`
+	Name string
+}
+
+/* A DEVICE CLASS WHOSE JOB DATABASES HOLD testJobRow AND A SEEDED testJobSeed */
+type testJobClass struct{ testDeviceClass }
+
+func (dc testJobClass) JobDBModels() []interface{} {
+	return []interface{}{&testJobRow{}, &testJobSeed{}}
+}
+
+/* NONE, EXCEPT WHERE SET BY A SCHEMA TEST ( SEE des.database.jobschema_test.go ) */
+var testJobMigrations []JobDBSchemaMigration
+
+func (dc testJobClass) JobDBSchemaMigrations() []JobDBSchemaMigration { return testJobMigrations }
+
+func (dc testJobClass) CreateJobDBTables(jdbc *JobDBClient) (err error) {
+	if err = jdbc.CreateJobDB(); err != nil {
+		return
+	}
+	if err = jdbc.Migrator().CreateTable(dc.JobDBModels()...); err != nil {
+		return
+	}
+	return jdbc.Create(&testJobSeed{ID: 1, Name: "seed"}).Error
+}
+
+/* RUNS THE TEST IN AN EMPTY DIRECTORY HOLDING JOB_DBS AND ARCHIVE_DIR; RESTORES THE JOB_STORE */
+func testJobDirs(t *testing.T) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	prev := JOB_STORE
+	t.Cleanup(func() {
+		JOB_STORE = prev
+		os.Chdir(wd)
+	})
+	for _, dir := range []string{JOB_DBS, ARCHIVE_DIR} {
+		if err = os.MkdirAll(dir, os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+/* A CONNECTED JOB DATABASE CREATED BY dc, HOLDING rows */
+func testJobDB(t *testing.T, jdbc JobDBClient, dc DeviceClass, rows ...testJobRow) *JobDBClient {
+	t.Helper()
+	if err := jdbc.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { jdbc.Disconnect() })
+	if err := dc.CreateJobDBTables(&jdbc); err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) > 0 {
+		if err := jdbc.Create(&rows).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &jdbc
+}
+
+/* REGISTERS testJobClass AS 997/001 AND DEVICE SN0001 OF THAT CLASS */
+func testJobDevice(t *testing.T) testJobClass {
+	t.Helper()
+	testDESDB(t, &testDESDevRow{}, &DESError{})
+	dc := testJobClass{testDeviceClass{class: "997", version: "001"}}
+	if err := RegisterDeviceClass(dc); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		DeviceClassesRWMutex.Lock()
+		delete(DeviceClasses, DeviceClassKey("997", "001"))
+		DeviceClassesRWMutex.Unlock()
+	})
+	if err := DES.DB.Create(&testDESDevRow{DESDevSerial: "SN0001", DESDevClass: "997", DESDevVersion: "001"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	return dc
+}
+
+var testJobRows = []testJobRow{{ID: 7, Time: 1000, Val: "a"}, {ID: 9, Time: 2000, Val: "b"}}
+
+func TestCopyJobDBSkipsSeededTables(t *testing.T) {
+	dir := t.TempDir()
+	dc := testJobClass{}
+	src := testJobDB(t, testJobStore{dir}.Client("src"), dc, testJobRows...)
+	src.Create(&testJobSeed{ID: 2, Name: "src only"})
+	dst := testJobDB(t, testJobStore{dir}.Client("dst"), dc)
+
+	counts, err := CopyJobDB(src, dst, dc.JobDBModels())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts["test_job_rows"] != 2 {
+		t.Errorf("copied %d rows; want 2", counts["test_job_rows"])
+	}
+	if _, ok := counts["test_job_seeds"]; ok {
+		t.Error("copied a table seeded in the destination")
+	}
+
+	/* ROWS KEEP THEIR IDS */
+	got := []testJobRow{}
+	dst.Order("id").Find(&got)
+	if len(got) != 2 || got[0] != testJobRows[0] || got[1] != testJobRows[1] {
+		t.Errorf("destination rows %+v; want %+v", got, testJobRows)
+	}
+	var seeds int64
+	dst.Model(&testJobSeed{}).Count(&seeds)
+	if seeds != 1 {
+		t.Errorf("destination holds %d seeds; want 1", seeds)
+	}
+}
+
+func TestExportJobDB(t *testing.T) {
+	testJobDirs(t)
+	dc := testJobClass{}
+
+	/* SQLITE: THE JOB'S OWN FILE */
+	JOB_STORE = SQLiteJobStore{}
+	path, temp, err := ExportJobDB("SN0001_0000000001", dc)
+	if err != nil || temp || path != (SQLiteJobStore{}).Path("SN0001_0000000001") {
+		t.Fatalf("export %s, temp %t, %v; want the job's file", path, temp, err)
+	}
+
+	/* OTHER STORES: A TEMPORARY SQLITE COPY */
+	store := testJobStore{t.TempDir()}
+	JOB_STORE = store
+	testJobDB(t, store.Client("SN0001_0000000001"), dc, testJobRows...)
+
+	if path, temp, err = ExportJobDB("SN0001_0000000001", dc); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(path)
+	if !temp || filepath.Dir(path) != JOB_DBS {
+		t.Fatalf("export %s, temp %t; want a temporary file in %s", path, temp, JOB_DBS)
+	}
+	cp, err := gorm.Open(sqlite.Open(path), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []testJobRow{}
+	cp.Order("id").Find(&got)
+	if db, err := cp.DB(); err == nil {
+		db.Close()
+	}
+	if len(got) != 2 || got[1] != testJobRows[1] {
+		t.Errorf("exported rows %+v; want %+v", got, testJobRows)
+	}
+}
+
+func TestMigrateJobDBs(t *testing.T) {
+	testJobDirs(t)
+	dc := testJobDevice(t)
+
+	JOB_STORE = SQLiteJobStore{}
+	if _, err := MigrateJobDBs(); err == nil {
+		t.Fatal("migrated into the SQLite job store")
+	}
+
+	store := testJobStore{t.TempDir()}
+	lite := SQLiteJobStore{}
+	testJobDB(t, lite.Client("SN0001_0000000001"), dc, testJobRows...)
+	testJobDB(t, lite.Client("SN0001_0000000002"), dc, testJobRows...)
+
+	/* CREATED IN THE STORE BY THE DES; NOT OVERWRITTEN */
+	testJobDB(t, store.Client("SN0001_0000000002"), dc)
+
+	JOB_STORE = store
+	migs, err := MigrateJobDBs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migs) != 2 {
+		t.Fatalf("%d migrations; want 2", len(migs))
+	}
+	for _, mig := range migs {
+		switch mig.Job {
+		case "SN0001_0000000001":
+			if mig.Status != "migrated" || mig.Counts["test_job_rows"] != 2 || mig.Class != DeviceClassKey("997", "001") {
+				t.Errorf("%s: %+v", mig.Job, mig)
+			}
+			if lite.Exists(mig.Job) {
+				t.Errorf("%s: SQLite file not archived", mig.Job)
+			}
+		case "SN0001_0000000002":
+			if mig.Status != "failed" || !strings.Contains(mig.Err, "already exists") {
+				t.Errorf("%s: %+v; want failed", mig.Job, mig)
+			}
+			if !lite.Exists(mig.Job) || !store.Exists(mig.Job) {
+				t.Errorf("%s: file or existing job removed", mig.Job)
+			}
+		}
+	}
+
+	jdbc := store.Client("SN0001_0000000001")
+	if err = jdbc.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer jdbc.Disconnect()
+	var n int64
+	jdbc.Model(&testJobRow{}).Count(&n)
+	if n != 2 {
+		t.Errorf("migrated job holds %d rows; want 2", n)
+	}
+	if mark, ok, _ := jobDBMigrated("SN0001_0000000001"); !ok || mark.Migrated == 0 {
+		t.Errorf("migration not marked complete: %+v", mark)
+	}
+	if archived, _ := os.ReadDir(filepath.Join(ARCHIVE_DIR, JOB_DBS_MIGRATED)); len(archived) != 1 {
+		t.Errorf("%d files archived; want 1", len(archived))
+	}
+}
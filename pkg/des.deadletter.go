@@ -0,0 +1,180 @@
+/* Data Exchange Server (DES) is a component of the Datacan Data2Desk (D2D) Platform.
+License:
+
+	[PROPER LEGALESE HERE...]
+
+	INTERIM LICENSE DESCRIPTION:
+	In spirit, this license:
+	1. Allows <Third Party> to use, modify, and / or distributre this software in perpetuity so long as <Third Party> understands:
+		a. The software is porvided as is without guarantee of additional support from DataCan in any form.
+		b. The software is porvided as is without guarantee of exclusivity.
+
+	2. Prohibits <Third Party> from taking any action which might interfere with DataCan's right to use, modify and / or distributre this software in perpetuity.
+*/
+
+package pkg
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	phao "github.com/eclipse/paho.mqtt.golang"
+)
+
+/*
+DEAD-LETTER STORE
+
+A DEVICE MESSAGE THE DES COULD NOT PROCESS ( INVALID SIGNATURE, UNREADABLE PAYLOAD, FAILED VALIDATION... )
+IS STORED IN des_dead_letters AS RECEIVED, ALONG WITH THE REASON IT WAS REFUSED
+
+ONCE THE CAUSE HAS BEEN FIXED, AN ADMIN CAN REPLAY IT THROUGH THE SAME SUBSCRIPTION HANDLER ( DeviceClass.ReplayMessage ):
+  - THE HANDLER RECEIVES A *DESReplayMessage; FAILURES ARE REPORTED ON THE MESSAGE RATHER THAN DEAD-LETTERED AGAIN
+  - THE RESULT OF EACH REPLAY IS RECORDED; A SUCCESSFUL REPLAY RESOLVES THE ENTRY
+  - A RESOLVED ENTRY IS NOT REPLAYED AGAIN
+  - AN ENTRY REFUSED AS A DUPLICATE SEQUENCE ( ERR_SIG_REPLAY ) IS NEVER REPLAYED; THE MESSAGE WAS ALREADY PROCESSED
+*/
+const DEAD_LETTER_LIMIT = 1000
+
+const DEAD_LETTER_REPLAY_OK = "ok"
+
+const ERR_DEAD_LETTER_RESOLVED string = "Dead letter was already replayed successfully"
+
+/* ONE REPLAY AT A TIME, SO THE SAME DEAD LETTER CANNOT BE PROCESSED TWICE */
+var DeadLetterReplayMutex = sync.Mutex{}
+
+type DESDeadLetter struct {
+	DESDeadID           int64  `gorm:"unique; primaryKey" json:"des_dead_id"`
+	DESDeadTime         int64  `gorm:"not null" json:"des_dead_time"` // Received
+	DESDeadSerial       string `gorm:"not null; varchar(10); index" json:"des_dead_serial"`
+	DESDeadTopic        string `gorm:"not null" json:"des_dead_topic"`
+	DESDeadQos          byte   `json:"des_dead_qos"`
+	DESDeadPayload      []byte `json:"des_dead_payload"` // As received
+	DESDeadReason       string `json:"des_dead_reason"`
+	DESDeadReplays      int64  `json:"des_dead_replays"`
+	DESDeadReplayTime   int64  `json:"des_dead_replay_time"`
+	DESDeadReplayUser   string `json:"des_dead_replay_user"`
+	DESDeadReplayResult string `json:"des_dead_replay_result"` // DEAD_LETTER_REPLAY_OK OR THE REASON THE REPLAY FAILED
+	DESDeadResolved     bool   `json:"des_dead_resolved"`
+}
+
+type DESDeadLetterFilter struct {
+	Serial     string `json:"des_dead_serial"`
+	Topic      string `json:"des_dead_topic"`
+	Unresolved bool   `json:"unresolved"`
+	Limit      int    `json:"limit"`
+}
+
+/* A DEAD LETTER BEING REPLAYED; IMPLEMENTS phao.Message */
+type DESReplayMessage struct {
+	DL  DESDeadLetter
+	Err error // Set by DeadLetter( ) WHERE THE HANDLER REFUSES THE MESSAGE AGAIN
+}
+
+func (msg *DESReplayMessage) Duplicate() bool   { return true }
+func (msg *DESReplayMessage) Qos() byte         { return msg.DL.DESDeadQos }
+func (msg *DESReplayMessage) Retained() bool    { return false }
+func (msg *DESReplayMessage) Topic() string     { return msg.DL.DESDeadTopic }
+func (msg *DESReplayMessage) MessageID() uint16 { return 0 }
+func (msg *DESReplayMessage) Payload() []byte   { return msg.DL.DESDeadPayload }
+func (msg *DESReplayMessage) Ack()              {}
+
+/* RETURNS TRUE WHERE THE MESSAGE IS A DEAD LETTER BEING REPLAYED */
+func IsReplayMessage(msg phao.Message) bool {
+	_, ok := msg.(*DESReplayMessage)
+	return ok
+}
+
+/*
+	CALLED BY A SUBSCRIPTION HANDLER THAT REFUSES A MESSAGE FROM THE DEVICE
+
+STORES THE MESSAGE IN des_dead_letters; WHERE THE MESSAGE IS BEING REPLAYED, RECORDS THE REASON ON IT
+AND IN THE DES ERROR LOG INSTEAD
+*/
+func DeadLetter(serial string, msg phao.Message, reason error) {
+
+	if r, ok := msg.(*DESReplayMessage); ok {
+		r.Err = reason
+		LogDESError(serial, fmt.Sprintf("Dead letter %d replay refused: %s", r.DL.DESDeadID, reason.Error()), r.DL)
+		return
+	}
+
+	dl := DESDeadLetter{
+		DESDeadTime:    time.Now().UTC().UnixMilli(),
+		DESDeadSerial:  serial,
+		DESDeadTopic:   msg.Topic(),
+		DESDeadQos:     msg.Qos(),
+		DESDeadPayload: msg.Payload(),
+		DESDeadReason:  reason.Error(),
+	}
+	if res := DES.DB.Create(&dl); res.Error != nil {
+		LogErr(res.Error)
+	}
+}
+
+/* RETURNS DEAD LETTERS MATCHING THE FILTER, NEWEST FIRST */
+func GetDESDeadLetters(f DESDeadLetterFilter) (dls []DESDeadLetter, err error) {
+
+	if f.Limit <= 0 || f.Limit > DEAD_LETTER_LIMIT {
+		f.Limit = DEAD_LETTER_LIMIT
+	}
+
+	qry := DES.DB.Order("des_dead_time DESC").Limit(f.Limit)
+	if f.Serial != "" {
+		qry = qry.Where("des_dead_serial = ?", f.Serial)
+	}
+	if f.Topic != "" {
+		qry = qry.Where("des_dead_topic = ?", f.Topic)
+	}
+	if f.Unresolved {
+		qry = qry.Where("des_dead_resolved = ?", false)
+	}
+	res := qry.Find(&dls)
+	return dls, res.Error
+}
+
+/*
+	REPLAYS THE DEAD LETTER THROUGH ITS DEVICE CLASS SUBSCRIPTION HANDLER AND RECORDS THE RESULT
+
+err IS RETURNED ONLY WHERE THE DEAD LETTER COULD NOT BE REPLAYED; A REFUSED REPLAY IS RECORDED IN dl.DESDeadReplayResult
+*/
+func ReplayDESDeadLetter(id int64, uid string) (dl DESDeadLetter, err error) {
+
+	DeadLetterReplayMutex.Lock()
+	defer DeadLetterReplayMutex.Unlock()
+
+	if res := DES.DB.First(&dl, id); res.Error != nil {
+		return dl, fmt.Errorf("Dead letter %d not found", id)
+	}
+	if dl.DESDeadResolved {
+		return dl, fmt.Errorf("%s", ERR_DEAD_LETTER_RESOLVED)
+	}
+
+	msg := &DESReplayMessage{DL: dl}
+	if strings.HasPrefix(dl.DESDeadReason, ERR_SIG_REPLAY) {
+		/* THE DEVICE'S SEQUENCE WAS ALREADY PROCESSED; DO NOT HAND IT TO THE HANDLER */
+		DeadLetter(dl.DESDeadSerial, msg, fmt.Errorf("%s", dl.DESDeadReason))
+
+	} else {
+		dc, err := GetDeviceClassBySerial(dl.DESDeadSerial)
+		if err != nil {
+			return dl, err
+		}
+		if err = dc.ReplayMessage(dl.DESDeadSerial, msg); err != nil {
+			return dl, err
+		}
+	}
+
+	dl.DESDeadReplays++
+	dl.DESDeadReplayTime = time.Now().UTC().UnixMilli()
+	dl.DESDeadReplayUser = uid
+	dl.DESDeadReplayResult = DEAD_LETTER_REPLAY_OK
+	if msg.Err != nil {
+		dl.DESDeadReplayResult = msg.Err.Error()
+	}
+	dl.DESDeadResolved = msg.Err == nil
+
+	res := DES.DB.Save(&dl)
+	return dl, res.Error
+}
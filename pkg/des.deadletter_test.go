@@ -0,0 +1,182 @@
+package pkg
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+/* A MESSAGE AS RECEIVED FROM THE BROKER; IMPLEMENTS phao.Message */
+type testMQTTMessage struct {
+	topic   string
+	payload []byte
+}
+
+func (msg *testMQTTMessage) Duplicate() bool   { return false }
+func (msg *testMQTTMessage) Qos() byte         { return 0 }
+func (msg *testMQTTMessage) Retained() bool    { return false }
+func (msg *testMQTTMessage) Topic() string     { return msg.topic }
+func (msg *testMQTTMessage) MessageID() uint16 { return 0 }
+func (msg *testMQTTMessage) Payload() []byte   { return msg.payload }
+func (msg *testMQTTMessage) Ack()              {}
+
+/* THE des_devs COLUMNS GetDeviceClassBySerial READS; DESDev REFERENCES users, WHICH SQLITE CAN NOT CREATE */
+type testDESDevRow struct {
+	DESDevID      int64 `gorm:"primaryKey"`
+	DESDevRegTime int64
+	DESDevSerial  string
+	DESDevVersion string
+	DESDevClass   string
+}
+
+func (testDESDevRow) TableName() string { return "des_devs" }
+
+/* A DEVICE CLASS WHOSE SUBSCRIPTION HANDLER VERIFIES THE MESSAGE, THEN REFUSES IT WHERE refuse IS SET */
+type testReplayClass struct {
+	testDeviceClass
+	refuse  error
+	handled int
+}
+
+func (dc *testReplayClass) ReplayMessage(serial string, msg *DESReplayMessage) error {
+	dc.handled++
+	_, err := VerifyDeviceReplay(serial, msg.DL)
+	if err == nil {
+		err = dc.refuse
+	}
+	if err != nil {
+		DeadLetter(serial, msg, err)
+	}
+	return nil
+}
+
+/* A SIGNED DEVICE SN0001 OF A testReplayClass; REFUSES ITS FIRST MESSAGES WITH refuse */
+func testDeadLetterDevice(t *testing.T, refuse error) (*testReplayClass, ed25519.PrivateKey) {
+	t.Helper()
+	priv := testSigningKey(t, "SN0001")
+	if err := DES.DB.AutoMigrate(&DESDeadLetter{}, &testDESDevRow{}); err != nil {
+		t.Fatal(err)
+	}
+
+	dc := &testReplayClass{testDeviceClass: testDeviceClass{class: "998", version: "001"}, refuse: refuse}
+	if err := RegisterDeviceClass(dc); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		DeviceClassesRWMutex.Lock()
+		delete(DeviceClasses, DeviceClassKey("998", "001"))
+		DeviceClassesRWMutex.Unlock()
+	})
+
+	dev := testDESDevRow{DESDevRegTime: time.Now().UTC().UnixMilli(), DESDevSerial: "SN0001", DESDevClass: "998", DESDevVersion: "001"}
+	if res := DES.DB.Create(&dev); res.Error != nil {
+		t.Fatal(res.Error)
+	}
+	return dc, priv
+}
+
+/* RECEIVES A MESSAGE SIGNED WITH key AS THE DES DEVICE CLIENT WOULD; RETURNS THE DEAD LETTER WHERE IT WAS REFUSED */
+func testReceive(t *testing.T, dc *testReplayClass, key ed25519.PrivateKey, seq int64) (dl DESDeadLetter, refused bool) {
+	t.Helper()
+	payload, err := SignDeviceMessage(key, testSigTopic, seq, []byte(`{"evt_code":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := &testMQTTMessage{topic: testSigTopic, payload: payload}
+	if _, err = VerifyDeviceMessage("SN0001", msg.Topic(), msg.Payload()); err == nil {
+		err = dc.refuse
+	}
+	if err == nil {
+		return
+	}
+	DeadLetter("SN0001", msg, err)
+	if res := DES.DB.Order("des_dead_id DESC").First(&dl); res.Error != nil {
+		t.Fatal(res.Error)
+	}
+	return dl, true
+}
+
+func TestReplayDESDeadLetterResolvesOnce(t *testing.T) {
+	dc, priv := testDeadLetterDevice(t, fmt.Errorf("invalid event"))
+	dl, refused := testReceive(t, dc, priv, 10)
+	if !refused || dl.DESDeadReason != "invalid event" {
+		t.Fatalf("dead letter %+v, %t", dl, refused)
+	}
+
+	/* STILL REFUSED; THE RESULT IS RECORDED, NOT DEAD-LETTERED AGAIN */
+	got, err := ReplayDESDeadLetter(dl.DESDeadID, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.DESDeadResolved || got.DESDeadReplayResult != "invalid event" || got.DESDeadReplays != 1 {
+		t.Fatalf("refused replay recorded as %+v", got)
+	}
+	count := int64(0)
+	DES.DB.Model(&DESDeadLetter{}).Count(&count)
+	if count != 1 {
+		t.Fatalf("%d dead letters; want 1", count)
+	}
+
+	/* THE CAUSE IS FIXED; THE SEQUENCE WAS RECEIVED, SO THE REPLAY IS ACCEPTED ONCE */
+	dc.refuse = nil
+	if got, err = ReplayDESDeadLetter(dl.DESDeadID, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	if !got.DESDeadResolved || got.DESDeadReplayResult != DEAD_LETTER_REPLAY_OK || got.DESDeadReplayUser != "admin" || got.DESDeadReplays != 2 {
+		t.Fatalf("replay recorded as %+v", got)
+	}
+	if _, err = ReplayDESDeadLetter(dl.DESDeadID, "admin"); err == nil || err.Error() != ERR_DEAD_LETTER_RESOLVED {
+		t.Fatalf("resolved dead letter replayed: %v", err)
+	}
+	if dc.handled != 2 {
+		t.Fatalf("handler called %d times; want 2", dc.handled)
+	}
+}
+
+func TestReplayDESDeadLetterRefusesDuplicateSequences(t *testing.T) {
+	dc, priv := testDeadLetterDevice(t, nil)
+	if _, refused := testReceive(t, dc, priv, 10); refused {
+		t.Fatal("first message refused")
+	}
+	dl, refused := testReceive(t, dc, priv, 10)
+	if !refused || !strings.HasPrefix(dl.DESDeadReason, ERR_SIG_REPLAY) {
+		t.Fatalf("duplicate dead-lettered as %+v, %t", dl, refused)
+	}
+
+	got, err := ReplayDESDeadLetter(dl.DESDeadID, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.DESDeadResolved || !strings.HasPrefix(got.DESDeadReplayResult, ERR_SIG_REPLAY) {
+		t.Fatalf("duplicate replay recorded as %+v", got)
+	}
+	if dc.handled != 0 {
+		t.Fatal("duplicate handed to the subscription handler")
+	}
+}
+
+func TestReplayDESDeadLetterChecksSignatureAndSequence(t *testing.T) {
+	dc, priv := testDeadLetterDevice(t, nil)
+	_, forged, _ := ed25519.GenerateKey(nil)
+
+	/* A FORGED MESSAGE IS VERIFIED AS IF NEW, AND REFUSED AGAIN */
+	dl, refused := testReceive(t, dc, forged, 20)
+	if !refused || dl.DESDeadReason != ERR_SIG_INVALID {
+		t.Fatalf("forged message dead-lettered as %+v, %t", dl, refused)
+	}
+	if got, _ := ReplayDESDeadLetter(dl.DESDeadID, "admin"); got.DESDeadResolved || got.DESDeadReplayResult != ERR_SIG_INVALID {
+		t.Fatalf("forged replay recorded as %+v", got)
+	}
+
+	/* A DEAD LETTER CLAIMING A SEQUENCE THE DES NEVER RECEIVED */
+	payload, _ := SignDeviceMessage(priv, testSigTopic, 30, []byte(`{"evt_code":1}`))
+	DeadLetter("SN0001", &testMQTTMessage{topic: testSigTopic, payload: payload}, fmt.Errorf("invalid event"))
+	unseen := DESDeadLetter{}
+	DES.DB.Order("des_dead_id DESC").First(&unseen)
+	got, _ := ReplayDESDeadLetter(unseen.DESDeadID, "admin")
+	if got.DESDeadResolved || !strings.HasPrefix(got.DESDeadReplayResult, ERR_SIG_NOT_RECEIVED) {
+		t.Fatalf("never-received replay recorded as %+v", got)
+	}
+}
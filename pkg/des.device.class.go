@@ -0,0 +1,191 @@
+/* Data Exchange Server (DES) is a component of the Datacan Data2Desk (D2D) Platform.
+License:
+
+	[PROPER LEGALESE HERE...]
+
+	INTERIM LICENSE DESCRIPTION:
+	In spirit, this license:
+	1. Allows <Third Party> to use, modify, and / or distributre this software in perpetuity so long as <Third Party> understands:
+		a. The software is porvided as is without guarantee of additional support from DataCan in any form.
+		b. The software is porvided as is without guarantee of exclusivity.
+
+	2. Prohibits <Third Party> from taking any action which might interfere with DataCan's right to use, modify and / or distributre this software in perpetuity.
+*/
+
+package pkg
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+/*
+DEVICE CLASS REGISTRY
+
+EACH <class>/<version> PACKAGE IMPLEMENTS DeviceClass AND REGISTERS ITSELF IN ITS init( ):
+
+	func init() {
+		if err := pkg.RegisterDeviceClass(C001V001{}); err != nil {
+			pkg.LogErr(err)
+		}
+	}
+
+THE DES THEN DISPATCHES BY des_devs.des_dev_class / des_devs.des_dev_version;
+MAIN NEED ONLY IMPORT THE PACKAGE:
+
+	import _ "github.com/leehayford/des/pkg/c001v001"
+*/
+type DeviceClass interface {
+	Class() string   // ie: 001
+	Version() string // ie: 001
+
+	/* CONNECTIONS */
+	RegisterDevice(dev DESDev, src string) (reg DESRegistration, err error) // Register and connect a new device of this class / version
+	ConnectAll()                                                            // Connect the DES device client of every registered device of this class / version
+	DisconnectAll()
+	ConnectDemos() // NOT FOR PRODUCTION
+	DisconnectDemos()
+	Resume() // Resume work interrupted by a restart; called after ConnectAll
+
+	/* HTTP; ROUTES ARE MOUNTED UNDER DeviceClassRoute( class, version ) */
+	InitializeRoutes(app, api *fiber.App) error
+
+	/* MQTT */
+	MQTTTopicRoot(serial string) string                       // ie: 001/001/<serial>
+	MQTTBrokerACL(serial string) MQTTBrokerACL                // Topics the device may use on the embedded broker
+	ReplayMessage(serial string, msg *DESReplayMessage) error // Pass a dead letter to the device client subscription handler of its topic
+
+	/* MODELS / CODECS */
+	JobDBModels() []interface{}                                       // Tables created in each job database
+	CreateJobDBTables(jdbc *JobDBClient) error                        // Create ( and seed ) the tables of a new job database
+	JobDBSchemaMigrations() []JobDBSchemaMigration                    // Job database schema versions, oldest first ( see des.database.jobschema.go )
+	RecordTypes() []string                                            // Binary record types; ie: adm, sta, hdr...
+	DecodeRecords(typ string, b []byte) (recs interface{}, err error) // Binary ( flash ) records of one type
+	EncodeRecord(rec interface{}) (b []byte, err error)               // A single record in binary ( flash ) form
+
+	/* REPORTS */
+	GenerateReport(reg DESRegistration, uid, title string) (rep interface{}, err error) // The default report of a job
+}
+
+var DeviceClasses = make(map[string]DeviceClass)
+var DeviceClassesRWMutex = sync.RWMutex{}
+
+/* RETURNS THE DeviceClasses MAP KEY; ie: 001/001 */
+func DeviceClassKey(class, version string) string {
+	return fmt.Sprintf("%s/%s", class, version)
+}
+
+/* RETURNS THE API ROUTE ROOT OF A CLASS / VERSION; ie: /001/001 */
+func DeviceClassRoute(class, version string) string {
+	return fmt.Sprintf("/%s", DeviceClassKey(class, version))
+}
+
+/* ADD A DEVICE CLASS TO THE REGISTRY; THE FIRST CLASS REGISTERED FOR A CLASS / VERSION IS KEPT */
+func RegisterDeviceClass(dc DeviceClass) (err error) {
+	key := DeviceClassKey(dc.Class(), dc.Version())
+	DeviceClassesRWMutex.Lock()
+	defer DeviceClassesRWMutex.Unlock()
+	if _, ok := DeviceClasses[key]; ok {
+		return fmt.Errorf("Device class %s is already registered", key)
+	}
+	DeviceClasses[key] = dc
+	return
+}
+
+/* RETURNS THE REGISTERED DEVICE CLASS */
+func GetDeviceClass(class, version string) (dc DeviceClass, err error) {
+	DeviceClassesRWMutex.RLock()
+	dc, ok := DeviceClasses[DeviceClassKey(class, version)]
+	DeviceClassesRWMutex.RUnlock()
+	if !ok {
+		err = fmt.Errorf("Device class %s is not supported by this DES", DeviceClassKey(class, version))
+	}
+	return
+}
+
+/* RETURNS THE DEVICE CLASS OF A REGISTERED DEVICE ( des_devs ) */
+func GetDeviceClassBySerial(serial string) (dc DeviceClass, err error) {
+	dev := DESDev{}
+	res := DES.DB.Order("des_dev_reg_time desc").Limit(1).Find(&dev, "des_dev_serial = ?", serial)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, fmt.Errorf("Device %s is not registered", serial)
+	}
+	return GetDeviceClass(dev.DESDevClass, dev.DESDevVersion)
+}
+
+/* RETURNS THE REGISTERED DEVICE CLASSES, ORDERED BY CLASS / VERSION */
+func GetDeviceClasses() (dcs []DeviceClass) {
+	DeviceClassesRWMutex.RLock()
+	for _, dc := range DeviceClasses {
+		dcs = append(dcs, dc)
+	}
+	DeviceClassesRWMutex.RUnlock()
+	sort.Slice(dcs, func(i, j int) bool {
+		return DeviceClassKey(dcs[i].Class(), dcs[i].Version()) < DeviceClassKey(dcs[j].Class(), dcs[j].Version())
+	})
+	return
+}
+
+/* CONNECT ALL DEVICES OF ALL CLASSES; CALLED ON SERVER STARTUP */
+func DeviceClasses_ConnectAll() {
+	for _, dc := range GetDeviceClasses() {
+		fmt.Printf("\n\nConnecting all C%sV%s Device Clients...\n", dc.Class(), dc.Version())
+		dc.ConnectAll()
+		dc.Resume()
+	}
+}
+
+func DeviceClasses_DisconnectAll() {
+	for _, dc := range GetDeviceClasses() {
+		dc.DisconnectAll()
+	}
+}
+
+/* DEMO DEVICES -> NOT FOR PRODUCTION */
+func DeviceClasses_ConnectDemos() {
+	for _, dc := range GetDeviceClasses() {
+		fmt.Printf("\n\nConnecting all C%sV%s MQTT DemoDevice Clients...\n", dc.Class(), dc.Version())
+		dc.ConnectDemos()
+	}
+}
+
+func DeviceClasses_DisconnectDemos() {
+	for _, dc := range GetDeviceClasses() {
+		dc.DisconnectDemos()
+	}
+}
+
+/* INITIALIZE THE ROUTES OF ALL CLASSES */
+func DeviceClasses_InitializeRoutes(app, api *fiber.App) (err error) {
+	for _, dc := range GetDeviceClasses() {
+		if err = dc.InitializeRoutes(app, api); err != nil {
+			return
+		}
+	}
+	return
+}
+
+/* DESCRIBES A REGISTERED DEVICE CLASS TO API CLIENTS */
+type DeviceClassInfo struct {
+	Class     string   `json:"class"`
+	Version   string   `json:"version"`
+	Route     string   `json:"route"`
+	Records   []string `json:"records"`
+	TopicRoot string   `json:"topic_root"` // With <serial> in place of a serial number
+}
+
+func GetDeviceClassInfo(dc DeviceClass) DeviceClassInfo {
+	return DeviceClassInfo{
+		Class:     dc.Class(),
+		Version:   dc.Version(),
+		Route:     DeviceClassRoute(dc.Class(), dc.Version()),
+		Records:   dc.RecordTypes(),
+		TopicRoot: dc.MQTTTopicRoot("<serial>"),
+	}
+}
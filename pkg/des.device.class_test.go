@@ -0,0 +1,38 @@
+package pkg
+
+import "testing"
+
+/* A DEVICE CLASS THAT ONLY NAMES ITSELF */
+type testDeviceClass struct {
+	DeviceClass
+	class, version string
+	name           string
+}
+
+func (dc testDeviceClass) Class() string   { return dc.class }
+func (dc testDeviceClass) Version() string { return dc.version }
+
+func TestRegisterDeviceClassRefusesDuplicates(t *testing.T) {
+	key := DeviceClassKey("999", "001")
+	t.Cleanup(func() {
+		DeviceClassesRWMutex.Lock()
+		delete(DeviceClasses, key)
+		DeviceClassesRWMutex.Unlock()
+	})
+
+	first := testDeviceClass{class: "999", version: "001", name: "first"}
+	if err := RegisterDeviceClass(first); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterDeviceClass(testDeviceClass{class: "999", version: "001", name: "second"}); err == nil {
+		t.Fatal("expected an error registering a class / version twice")
+	}
+
+	dc, err := GetDeviceClass("999", "001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dc != DeviceClass(first) {
+		t.Fatal("the first class registered was replaced")
+	}
+}
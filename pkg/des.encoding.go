@@ -0,0 +1,52 @@
+/* Data Exchange Server (DES) is a component of the Datacan Data2Desk (D2D) Platform.
+License:
+
+	[PROPER LEGALESE HERE...]
+
+	INTERIM LICENSE DESCRIPTION:
+	In spirit, this license:
+	1. Allows <Third Party> to use, modify, and / or distributre this software in perpetuity so long as <Third Party> understands:
+		a. The software is porvided as is without guarantee of additional support from DataCan in any form.
+		b. The software is porvided as is without guarantee of exclusivity.
+
+	2. Prohibits <Third Party> from taking any action which might interfere with DataCan's right to use, modify and / or distributre this software in perpetuity.
+*/
+
+package pkg
+
+import (
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+/*
+DEVICE PAYLOAD ENCODINGS
+
+THE SIG / CMD PAYLOAD ENCODING LAST DECLARED BY EACH DEVICE, AND WHETHER AN ADMINISTRATOR HAS FORCED JSON,
+SO THAT COMMANDS ARE SENT IN THE SAME ENCODING AFTER A DES RESTART
+ENCODING VALUES ARE CLASS / VERSION SPECIFIC; SEE <class>/<version>/controller.encoding.go
+*/
+type DESDevEncoding struct {
+	DESDevEncID        int64  `gorm:"unique; primaryKey" json:"des_dev_enc_id"`
+	DESDevEncSerial    string `gorm:"not null; varchar(10); uniqueIndex" json:"des_dev_enc_serial"`
+	DESDevEncDevice    int32  `json:"des_dev_enc_device"`     // Declared by the device
+	DESDevEncForceJSON bool   `json:"des_dev_enc_force_json"` // Set by an administrator
+	DESDevEncUpdated   int64  `json:"des_dev_enc_updated"`
+}
+
+/* RETURNS ALL DEVICE ENCODING RECORDS */
+func GetDESDevEncodings() (encs []DESDevEncoding, err error) {
+	res := DES.DB.Find(&encs)
+	return encs, res.Error
+}
+
+/* INSERTS OR UPDATES THE DEVICE'S ENCODING RECORD */
+func WriteDESDevEncoding(enc *DESDevEncoding) (err error) {
+	enc.DESDevEncUpdated = time.Now().UTC().UnixMilli()
+	res := DES.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "des_dev_enc_serial"}},
+		DoUpdates: clause.AssignmentColumns([]string{"des_dev_enc_device", "des_dev_enc_force_json", "des_dev_enc_updated"}),
+	}).Create(enc)
+	return res.Error
+}
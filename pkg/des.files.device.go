@@ -15,6 +15,10 @@ License:
 package pkg
 
 import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -125,3 +129,141 @@ func ReadModelBytesFromHEXFile(dirName, fileName string) (buf []byte, arr error)
 	f.Close()
 	return
 }
+
+/*
+	RETURNS THE RAW BYTES OF A DEVICE FLASH DUMP
+
+- AN INTEL HEX FILE ( FIRST NON-WHITESPACE CHARACTER IS ':' ) IS DECODED; DATA RECORDS ARE RETURNED IN FILE ORDER
+- ANYTHING ELSE IS TREATED AS A RAW BINARY DUMP AND RETURNED AS IS
+*/
+func FlashBytes(buf []byte) (out []byte, err error) {
+
+	txt := strings.TrimSpace(string(buf))
+	if !strings.HasPrefix(txt, ":") {
+		return buf, nil
+	}
+
+	for n, line := range strings.Split(txt, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		rec, err := hex.DecodeString(strings.TrimPrefix(line, ":"))
+		if err != nil || len(rec) < 5 || len(rec) != int(rec[0])+5 {
+			return nil, LogErr(fmt.Errorf("%s: line %d", ERR_FILE_HEX_RECORD, n+1))
+		}
+
+		/* THE SUM OF ALL RECORD BYTES, INCLUDING THE CHECKSUM, IS ZERO */
+		var sum byte
+		for _, b := range rec {
+			sum += b
+		}
+		if sum != 0 {
+			return nil, LogErr(fmt.Errorf("%s: line %d checksum", ERR_FILE_HEX_RECORD, n+1))
+		}
+
+		switch rec[3] {
+		case 0x00: /* DATA */
+			out = append(out, rec[4:len(rec)-1]...)
+		case 0x01: /* END OF FILE */
+			return out, nil
+		}
+		/* EXTENDED SEGMENT / LINEAR ADDRESS RECORDS ARE IGNORED; FLASH DUMPS ARE CONTIGUOUS */
+	}
+	return
+}
+
+/* CERTIFICATE FILES *****************************************************************************/
+
+const DEVICE_CERT_FILE = "device.crt"
+const DEVICE_KEY_FILE = "device.key"
+const DEVICE_CA_FILE = "des_ca.crt"
+
+/* WRITES ( OVERWRITES ) THE DEVICE CERTIFICATE, KEY AND CA CERTIFICATE TO ~/DES_DEVICE_FILES/dirName/ */
+func WriteDeviceCertFiles(dirName string, files DESDevCertFiles) (err error) {
+	dir := fmt.Sprintf("%s/%s/%s", DATA_DIR, DEVICE_FILE_DIR, dirName)
+	if err = os.MkdirAll(dir, os.ModePerm); err != nil {
+		return LogErr(err)
+	}
+	if err = os.WriteFile(fmt.Sprintf("%s/%s", dir, DEVICE_CERT_FILE), []byte(files.CertPEM), 0644); err != nil {
+		return LogErr(err)
+	}
+	if err = os.WriteFile(fmt.Sprintf("%s/%s", dir, DEVICE_KEY_FILE), []byte(files.KeyPEM), 0600); err != nil {
+		return LogErr(err)
+	}
+	if err = os.WriteFile(fmt.Sprintf("%s/%s", dir, DEVICE_CA_FILE), []byte(files.CAPEM), 0644); err != nil {
+		return LogErr(err)
+	}
+	return
+}
+
+/* READS THE DEVICE CERTIFICATE, KEY AND CA CERTIFICATE FROM ~/DES_DEVICE_FILES/dirName/ */
+func ReadDeviceCertFiles(dirName string) (files DESDevCertFiles, err error) {
+	dir := fmt.Sprintf("%s/%s/%s", DATA_DIR, DEVICE_FILE_DIR, dirName)
+	crt, err := os.ReadFile(fmt.Sprintf("%s/%s", dir, DEVICE_CERT_FILE))
+	if err != nil {
+		return
+	}
+	key, err := os.ReadFile(fmt.Sprintf("%s/%s", dir, DEVICE_KEY_FILE))
+	if err != nil {
+		return
+	}
+	ca, err := os.ReadFile(fmt.Sprintf("%s/%s", dir, DEVICE_CA_FILE))
+	if err != nil {
+		return
+	}
+	files = DESDevCertFiles{CertPEM: string(crt), KeyPEM: string(key), CAPEM: string(ca)}
+	return
+}
+
+/* SIGNING KEY FILE *****************************************************************************/
+
+const DEVICE_SIG_KEY_FILE = "device_sig.key"
+
+/* ENCODES THE DEVICE'S PRIVATE SIGNING KEY AS A PKCS #8 PEM */
+func DeviceSigningKeyPEM(key ed25519.PrivateKey) (keyPEM string, err error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: PEM_PRIVATE_KEY, Bytes: der})), nil
+}
+
+/* WRITES ( OVERWRITES ) THE DEVICE'S PRIVATE SIGNING KEY TO ~/DES_DEVICE_FILES/dirName/ */
+func WriteDeviceSigningKeyFile(dirName string, key ed25519.PrivateKey) (err error) {
+	dir := fmt.Sprintf("%s/%s/%s", DATA_DIR, DEVICE_FILE_DIR, dirName)
+	if err = os.MkdirAll(dir, os.ModePerm); err != nil {
+		return LogErr(err)
+	}
+	keyPEM, err := DeviceSigningKeyPEM(key)
+	if err != nil {
+		return LogErr(err)
+	}
+	if err = os.WriteFile(fmt.Sprintf("%s/%s", dir, DEVICE_SIG_KEY_FILE), []byte(keyPEM), 0600); err != nil {
+		return LogErr(err)
+	}
+	return
+}
+
+/* READS THE DEVICE'S PRIVATE SIGNING KEY FROM ~/DES_DEVICE_FILES/dirName/ */
+func ReadDeviceSigningKeyFile(dirName string) (key ed25519.PrivateKey, err error) {
+	dir := fmt.Sprintf("%s/%s/%s", DATA_DIR, DEVICE_FILE_DIR, dirName)
+	b, err := os.ReadFile(fmt.Sprintf("%s/%s", dir, DEVICE_SIG_KEY_FILE))
+	if err != nil {
+		return
+	}
+	block, _ := pem.Decode(b)
+	if block == nil || block.Type != PEM_PRIVATE_KEY {
+		return nil, fmt.Errorf("Invalid signing key file: %s", dir)
+	}
+	k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return
+	}
+	key, ok := k.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("Invalid signing key file: %s", dir)
+	}
+	return
+}
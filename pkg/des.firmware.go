@@ -0,0 +1,314 @@
+/* Data Exchange Server (DES) is a component of the Datacan Data2Desk (D2D) Platform.
+License:
+
+	[PROPER LEGALESE HERE...]
+
+	INTERIM LICENSE DESCRIPTION:
+	In spirit, this license:
+	1. Allows <Third Party> to use, modify, and / or distributre this software in perpetuity so long as <Third Party> understands:
+		a. The software is porvided as is without guarantee of additional support from DataCan in any form.
+		b. The software is porvided as is without guarantee of exclusivity.
+
+	2. Prohibits <Third Party> from taking any action which might interfere with DataCan's right to use, modify and / or distributre this software in perpetuity.
+*/
+
+package pkg
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+/*
+FIRMWARE REGISTRY
+
+  - DESFirmware: AN UPLOADED FIRMWARE IMAGE; STORED IN ~/DATA_DIR/FW_DIR/<des_fw_id>.bin
+  - DESFwDevice: PER DEVICE, PER FIRMWARE TYPE, THE CURRENT ( REPORTED ) AND TARGET ( ASSIGNED ) VERSIONS
+  - DESFwCampaign: ROLLS A FIRMWARE IMAGE OUT TO A GROUP OF DEVICES IN STAGES ( % OF THE GROUP )
+
+DELIVERY AND DEVICE PROGRESS ARE CLASS / VERSION SPECIFIC; SEE <class>/<version>/controller.firmware.go
+*/
+const FW_DIR = "firmware"
+
+const FW_TYPE_LOG = "log" // Logger firmware ( State.StaLogFw )
+const FW_TYPE_MOD = "mod" // Modem firmware ( State.StaModFw )
+
+/* DESFwDevice.DESFwDevStatus */
+const FW_STATUS_CURRENT = "current"   // Current == Target
+const FW_STATUS_PENDING = "pending"   // Target assigned; not yet sent
+const FW_STATUS_SENDING = "sending"   // DES is sending the image
+const FW_STATUS_RECEIVED = "received" // Device verified the image checksum
+const FW_STATUS_INSTALLING = "installing"
+const FW_STATUS_SUCCESS = "success" // Device reports the target version installed
+const FW_STATUS_FAILED = "failed"
+
+/* DESFwCampaign.DESFwCampStatus */
+const FW_CAMP_ACTIVE = "active"
+const FW_CAMP_PAUSED = "paused"
+const FW_CAMP_COMPLETE = "complete"
+const FW_CAMP_CANCELLED = "cancelled"
+
+const FW_CAMP_GROUP_ALL = "*" // Every registered device of the firmware's class / version
+
+type DESFirmware struct {
+	DESFwID        int64  `gorm:"unique; primaryKey" json:"des_fw_id"`
+	DESFwRegTime   int64  `gorm:"not null" json:"des_fw_reg_time"`
+	DESFwRegUserID string `gorm:"not null; varchar(36)" json:"des_fw_reg_user_id"`
+	DESFwClass     string `gorm:"not null; varchar(3)" json:"des_fw_class"`
+	DESFwVersion   string `gorm:"not null; varchar(3)" json:"des_fw_version"`
+	DESFwType      string `gorm:"not null; varchar(3)" json:"des_fw_type"`     // FW_TYPE_...
+	DESFwRelease   string `gorm:"not null; varchar(10)" json:"des_fw_release"` // ie: 01.002.003 as reported in State
+	DESFwSize      int64  `gorm:"not null" json:"des_fw_size"`
+	DESFwSHA256    string `gorm:"not null; varchar(64)" json:"des_fw_sha256"`
+	DESFwNotes     string `json:"des_fw_notes"`
+}
+
+/* RETURNS THE PATH OF THE STORED FIRMWARE IMAGE */
+func (fw DESFirmware) Path() string {
+	return fmt.Sprintf("%s/%s/%d.bin", DATA_DIR, FW_DIR, fw.DESFwID)
+}
+
+/* RETURNS THE HEX SHA-256 OF img */
+func FirmwareSHA256(img []byte) string {
+	sum := sha256.Sum256(img)
+	return hex.EncodeToString(sum[:])
+}
+
+/* RECORDS fw AND STORES img; SIZE AND CHECKSUM ARE TAKEN FROM img */
+func RegisterFirmware(fw *DESFirmware, img []byte) (err error) {
+
+	if len(img) == 0 {
+		return fmt.Errorf("Firmware image is empty")
+	}
+	if fw.DESFwType != FW_TYPE_LOG && fw.DESFwType != FW_TYPE_MOD {
+		return fmt.Errorf("Invalid firmware type: %s", fw.DESFwType)
+	}
+	if fw.DESFwRelease == "" {
+		return fmt.Errorf("Firmware release is required")
+	}
+
+	fw.DESFwID = 0
+	fw.DESFwRegTime = time.Now().UTC().UnixMilli()
+	fw.DESFwSize = int64(len(img))
+	fw.DESFwSHA256 = FirmwareSHA256(img)
+
+	if err = os.MkdirAll(fmt.Sprintf("%s/%s", DATA_DIR, FW_DIR), os.ModePerm); err != nil {
+		return LogErr(err)
+	}
+	if res := DES.DB.Create(fw); res.Error != nil {
+		return res.Error
+	}
+	if err = os.WriteFile(fw.Path(), img, 0644); err != nil {
+		DES.DB.Delete(fw)
+		return LogErr(err)
+	}
+	return
+}
+
+/* RETURNS THE STORED IMAGE; FAILS WHERE THE IMAGE NO LONGER MATCHES ITS CHECKSUM */
+func (fw DESFirmware) Image() (img []byte, err error) {
+	if img, err = os.ReadFile(fw.Path()); err != nil {
+		return
+	}
+	if FirmwareSHA256(img) != fw.DESFwSHA256 {
+		return nil, fmt.Errorf("Firmware image %d failed checksum verification", fw.DESFwID)
+	}
+	return
+}
+
+func GetFirmware(id int64) (fw DESFirmware, err error) {
+	res := DES.DB.First(&fw, id)
+	return fw, res.Error
+}
+
+/* RETURNS REGISTERED FIRMWARE FOR THE CLASS / VERSION, NEWEST FIRST */
+func GetFirmwareList(class, version string) (fws []DESFirmware, err error) {
+	res := DES.DB.
+		Where("des_fw_class = ? AND des_fw_version = ?", class, version).
+		Order("des_fw_reg_time DESC").
+		Find(&fws)
+	return fws, res.Error
+}
+
+/* FIRMWARE INVENTORY *****************************************************************************/
+
+type DESFwDevice struct {
+	DESFwDevID       int64  `gorm:"unique; primaryKey" json:"des_fw_dev_id"`
+	DESFwDevSerial   string `gorm:"not null; varchar(10); uniqueIndex:idx_fw_dev" json:"des_fw_dev_serial"`
+	DESFwDevType     string `gorm:"not null; varchar(3); uniqueIndex:idx_fw_dev" json:"des_fw_dev_type"`
+	DESFwDevCurrent  string `gorm:"varchar(10)" json:"des_fw_dev_current"` // Last reported by the device
+	DESFwDevTarget   string `gorm:"varchar(10)" json:"des_fw_dev_target"`  // Assigned by a campaign
+	DESFwDevFwID     int64  `json:"des_fw_dev_fw_id"`                      // Firmware being delivered
+	DESFwDevCampID   int64  `json:"des_fw_dev_camp_id"`
+	DESFwDevStatus   string `json:"des_fw_dev_status"` // FW_STATUS_...
+	DESFwDevProgress int32  `json:"des_fw_dev_progress"`
+	DESFwDevMsg      string `json:"des_fw_dev_msg"`
+	DESFwDevUpdated  int64  `json:"des_fw_dev_updated"`
+}
+
+/* RETURNS THE INVENTORY RECORD; A NEW ( UNSAVED ) RECORD WHERE NONE EXISTS */
+func GetFwDevice(serial, typ string) (dev DESFwDevice, err error) {
+	res := DES.DB.Where("des_fw_dev_serial = ? AND des_fw_dev_type = ?", serial, typ).Limit(1).Find(&dev)
+	if res.RowsAffected == 0 {
+		dev = DESFwDevice{DESFwDevSerial: serial, DESFwDevType: typ}
+	}
+	return dev, res.Error
+}
+
+/* RETURNS ALL INVENTORY RECORDS FOR THE DEVICE */
+func GetFwDevices(serial string) (devs []DESFwDevice, err error) {
+	res := DES.DB.Where("des_fw_dev_serial = ?", serial).Find(&devs)
+	return devs, res.Error
+}
+
+/* INSERTS OR UPDATES THE INVENTORY RECORD */
+func WriteFwDevice(dev *DESFwDevice) (err error) {
+	dev.DESFwDevUpdated = time.Now().UTC().UnixMilli()
+	res := DES.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "des_fw_dev_serial"}, {Name: "des_fw_dev_type"}},
+		UpdateAll: true,
+	}).Create(dev)
+	return res.Error
+}
+
+/*
+	RECORDS THE FIRMWARE VERSION REPORTED BY A DEVICE
+
+WHERE THE DEVICE NOW REPORTS ITS TARGET VERSION, THE UPDATE HAS SUCCEEDED
+*/
+func UpdateFwDeviceCurrent(serial, typ, current string) (dev DESFwDevice, err error) {
+
+	if dev, err = GetFwDevice(serial, typ); err != nil {
+		return
+	}
+	if dev.DESFwDevCurrent == current && dev.DESFwDevID != 0 {
+		return
+	}
+
+	dev.DESFwDevCurrent = current
+	if dev.DESFwDevTarget == "" || dev.DESFwDevTarget == current {
+		if dev.DESFwDevTarget == current && dev.DESFwDevStatus != FW_STATUS_CURRENT {
+			dev.DESFwDevStatus = FW_STATUS_SUCCESS
+			dev.DESFwDevProgress = 100
+		} else {
+			dev.DESFwDevStatus = FW_STATUS_CURRENT
+		}
+	}
+	err = WriteFwDevice(&dev)
+	return
+}
+
+/* FIRMWARE CAMPAIGNS *****************************************************************************/
+
+type DESFwCampaign struct {
+	DESFwCampID        int64  `gorm:"unique; primaryKey" json:"des_fw_camp_id"`
+	DESFwCampName      string `gorm:"not null" json:"des_fw_camp_name"`
+	DESFwCampRegTime   int64  `gorm:"not null" json:"des_fw_camp_reg_time"`
+	DESFwCampRegAddr   string `gorm:"varchar(36)" json:"des_fw_camp_reg_addr"`
+	DESFwCampRegUserID string `gorm:"not null; varchar(36)" json:"des_fw_camp_reg_user_id"`
+	DESFwCampFwID      int64  `gorm:"not null" json:"des_fw_camp_fw_id"`
+	DESFwCampGroup     string `gorm:"not null" json:"des_fw_camp_group"`  // Comma separated serials or FW_CAMP_GROUP_ALL
+	DESFwCampStages    string `gorm:"not null" json:"des_fw_camp_stages"` // Comma separated cumulative % of the group; ie: 10,50,100
+	DESFwCampStage     int    `json:"des_fw_camp_stage"`                  // Index into DESFwCampStages of the stage released
+	DESFwCampStatus    string `json:"des_fw_camp_status"`                 // FW_CAMP_...
+	DESFwCampUpdated   int64  `json:"des_fw_camp_updated"`
+}
+
+/* RETURNS THE CUMULATIVE STAGE PERCENTAGES; VALIDATES THEY ARE ASCENDING, 1 : 100, ENDING AT 100 */
+func (camp DESFwCampaign) StagePercents() (pcts []int, err error) {
+	for _, s := range strings.Split(camp.DESFwCampStages, ",") {
+		p, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid campaign stage: %s", s)
+		}
+		if p < 1 || p > 100 || (len(pcts) > 0 && p <= pcts[len(pcts)-1]) {
+			return nil, fmt.Errorf("Campaign stages must ascend from 1 to 100: %s", camp.DESFwCampStages)
+		}
+		pcts = append(pcts, p)
+	}
+	if len(pcts) == 0 || pcts[len(pcts)-1] != 100 {
+		return nil, fmt.Errorf("The last campaign stage must be 100")
+	}
+	return
+}
+
+/*
+	RETURNS THE SERIALS RELEASED UP TO AND INCLUDING THE CURRENT STAGE
+
+group IS ORDERED BY A HASH OF CAMPAIGN ID AND SERIAL SO EACH CAMPAIGN SAMPLES THE GROUP DIFFERENTLY,
+BUT A DEVICE RELEASED IN ONE STAGE IS ALWAYS RELEASED IN EVERY LATER STAGE
+*/
+func (camp DESFwCampaign) StageSerials(group []string) (serials []string, err error) {
+
+	pcts, err := camp.StagePercents()
+	if err != nil {
+		return
+	}
+	if camp.DESFwCampStage >= len(pcts) {
+		return nil, fmt.Errorf("Campaign has no stage %d", camp.DESFwCampStage)
+	}
+
+	ordered := append([]string{}, group...)
+	key := func(s string) string { return FirmwareSHA256([]byte(fmt.Sprintf("%d/%s", camp.DESFwCampID, s))) }
+	sort.Slice(ordered, func(i, j int) bool { return key(ordered[i]) < key(ordered[j]) })
+
+	n := int(math.Ceil(float64(len(ordered)) * float64(pcts[camp.DESFwCampStage]) / 100))
+	return ordered[:n], nil
+}
+
+/* RETURNS THE SERIALS LISTED IN THE CAMPAIGN GROUP; nil WHERE THE GROUP IS FW_CAMP_GROUP_ALL */
+func (camp DESFwCampaign) GroupSerials() (serials []string) {
+	if strings.TrimSpace(camp.DESFwCampGroup) == FW_CAMP_GROUP_ALL {
+		return nil
+	}
+	for _, s := range strings.Split(camp.DESFwCampGroup, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			serials = append(serials, s)
+		}
+	}
+	return
+}
+
+func WriteFwCampaign(camp *DESFwCampaign) (err error) {
+	camp.DESFwCampUpdated = time.Now().UTC().UnixMilli()
+	res := DES.DB.Save(camp)
+	return res.Error
+}
+
+func GetFwCampaign(id int64) (camp DESFwCampaign, err error) {
+	res := DES.DB.First(&camp, id)
+	return camp, res.Error
+}
+
+func GetFwCampaigns() (camps []DESFwCampaign, err error) {
+	res := DES.DB.Order("des_fw_camp_reg_time DESC").Find(&camps)
+	return camps, res.Error
+}
+
+/* RETURNS THE INVENTORY RECORDS OF DEVICES RELEASED BY THE CAMPAIGN */
+func (camp DESFwCampaign) Devices() (devs []DESFwDevice, err error) {
+	res := DES.DB.Where("des_fw_dev_camp_id = ?", camp.DESFwCampID).Order("des_fw_dev_serial").Find(&devs)
+	return devs, res.Error
+}
+
+/* COUNTS CAMPAIGN DEVICES BY FW_STATUS_... */
+func (camp DESFwCampaign) StatusCounts() (counts map[string]int, err error) {
+	devs, err := camp.Devices()
+	if err != nil {
+		return
+	}
+	counts = make(map[string]int)
+	for _, d := range devs {
+		counts[d.DESFwDevStatus]++
+	}
+	return
+}
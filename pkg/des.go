@@ -28,6 +28,9 @@ import (
 
 const DES_APP = "DES v0.0.0"
 
+/* *Addr OF REQUESTS THE DES MAKES ON ITS OWN ( IE: SSP / SCVF EVENTS, FLOW SENSOR CHANGES, TEST PROGRAM STEPS, DEVICE MOVED EVENTS ) */
+const DES_ADDR = "DES"
+
 const ROLE_SUPER = "super"
 const ROLE_ADMIN = "admin"
 const ROLE_OPERATOR = "operator"
@@ -229,8 +232,8 @@ type WSMessage struct {
 }
 
 type Ping struct {
-	Time int64 `json:"time"`
-	OK   bool  `json:"ok"`
+	Time int64 `json:"time" tlv:"1"`
+	OK   bool  `json:"ok" tlv:"2"`
 }
 
 func (p *Ping) LatencyCheck() (ms int64, err error) {
@@ -0,0 +1,113 @@
+package pkg
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+func InitializeDESBrokerRoutes(app, api *fiber.App) {
+	api.Route("/broker", func(router fiber.Router) {
+
+		/* DES-ADMIN-LEVEL OPERATIONS */
+		router.Get("/status", DesAuth, HandleGetBrokerStatus)
+		router.Get("/alarms", DesAuth, HandleGetBrokerAlarms)
+		router.Post("/subscriptions", DesAuth, HandleGetBrokerSubscriptions)
+		router.Get("/topic_metrics", DesAuth, HandleGetBrokerTopicMetrics)
+		router.Post("/topic_metrics", DesAuth, HandleAddBrokerTopicMetrics)
+
+	})
+}
+
+/* RETURNS THE BROKER NODE STATUS */
+func HandleGetBrokerStatus(c *fiber.Ctx) (err error) {
+
+	/* CHECK USER PERMISSION */
+	if !UserRole_Admin(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).SendString(ERR_AUTH_ADMIN + ": View broker status")
+	}
+
+	sts, err := EMQX.Status()
+	if err != nil {
+		return c.Status(fiber.StatusBadGateway).SendString(err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": sts})
+}
+
+/* RETURNS ACTIVE BROKER ALARMS; ?activated=false RETURNS HISTORICAL ALARMS */
+func HandleGetBrokerAlarms(c *fiber.Ctx) (err error) {
+
+	/* CHECK USER PERMISSION */
+	if !UserRole_Admin(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).SendString(ERR_AUTH_ADMIN + ": View broker alarms")
+	}
+
+	alarms, err := EMQX.Alarms(c.Query("activated", "true") != "false")
+	if err != nil {
+		return c.Status(fiber.StatusBadGateway).SendString(err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"alarms": alarms})
+}
+
+/* RETURNS THE SUBSCRIPTIONS OF THE REQUESTED CLIENT; ALL SUBSCRIPTIONS WHERE clientid IS EMPTY */
+func HandleGetBrokerSubscriptions(c *fiber.Ctx) (err error) {
+
+	/* CHECK USER PERMISSION */
+	if !UserRole_Admin(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).SendString(ERR_AUTH_ADMIN + ": View broker subscriptions")
+	}
+
+	/* PARSE AND VALIDATE REQUEST DATA */
+	qry := struct {
+		ClientID string `json:"clientid"`
+	}{}
+	if err = ParseRequestBody(c, &qry); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	subs, err := EMQX.Subscriptions(qry.ClientID)
+	if err != nil {
+		return c.Status(fiber.StatusBadGateway).SendString(err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"subscriptions": subs})
+}
+
+/* RETURNS MESSAGE COUNTS AND RATES FOR ALL TOPICS REGISTERED WITH EMQX TOPIC METRICS */
+func HandleGetBrokerTopicMetrics(c *fiber.Ctx) (err error) {
+
+	/* CHECK USER PERMISSION */
+	if !UserRole_Admin(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).SendString(ERR_AUTH_ADMIN + ": View broker topic metrics")
+	}
+
+	metrics, err := EMQX.TopicMetrics()
+	if err != nil {
+		return c.Status(fiber.StatusBadGateway).SendString(err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"metrics": metrics})
+}
+
+/* REGISTERS A TOPIC WITH EMQX TOPIC METRICS */
+func HandleAddBrokerTopicMetrics(c *fiber.Ctx) (err error) {
+
+	/* CHECK USER PERMISSION */
+	if !UserRole_Admin(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).SendString(ERR_AUTH_ADMIN + ": Add broker topic metrics")
+	}
+
+	/* PARSE AND VALIDATE REQUEST DATA */
+	qry := struct {
+		Topic string `json:"topic"`
+	}{}
+	if err = ParseRequestBody(c, &qry); err != nil || qry.Topic == "" {
+		return c.Status(fiber.StatusBadRequest).SendString("A topic is required")
+	}
+
+	if err = EMQX.AddTopicMetrics(qry.Topic); err != nil {
+		return c.Status(fiber.StatusBadGateway).SendString(err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"topic": qry.Topic})
+}
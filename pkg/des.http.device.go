@@ -2,6 +2,8 @@ package pkg
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -11,6 +13,25 @@ func InitializeDESDeviceRoutes(app, api *fiber.App) {
 
 		router.Post("/validate_serial", DesAuth, HandleValidateSerialNumber)
 
+		/* DES CA */
+		router.Get("/ca", DesAuth, HandleGetDESCACert)
+		router.Get("/crl", DesAuth, HandleGetDESCACRL)
+		router.Post("/certs", DesAuth, HandleGetDeviceCerts)
+
+		/* DEVICE CLASSES */
+		router.Get("/classes", DesAuth, HandleGetDeviceClasses)
+		router.Post("/class", DesAuth, HandleGetDeviceClassBySerial)
+		router.Post("/register", DesAuth, HandleRegisterClassDevice)
+
+		/* MESSAGE TIME POLICY */
+		router.Post("/time_policy", DesAuth, HandleGetTimePolicy)
+		router.Post("/time_policy/set", DesAuth, HandleSetTimePolicy)
+		router.Post("/time_policy/reset_stats", DesAuth, HandleResetTimeStats)
+
+		/* DEAD LETTERS */
+		router.Post("/dead_letters", DesAuth, HandleGetDeadLetters)
+		router.Post("/dead_letters/replay", DesAuth, HandleReplayDeadLetters)
+
 	})
 }
 
@@ -111,3 +132,269 @@ func HandleGetDESDeviceBySerial(c *fiber.Ctx) (err error) {
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{"device": reg})
 }
+
+/* DES CA *****************************************************************************************/
+
+/* RETURNS THE DES CA CERTIFICATE ( PEM ) */
+func HandleGetDESCACert(c *fiber.Ctx) (err error) {
+
+	/* CHECK USER PERMISSION */
+	if !UserRole_Viewer(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).SendString(ERR_AUTH_VIEWER + ": View DES CA")
+	}
+
+	if DESCA == nil {
+		return c.Status(fiber.StatusNotFound).SendString(ERR_CA_NOT_LOADED)
+	}
+
+	c.Set(fiber.HeaderContentType, "application/x-pem-file")
+	return c.Status(fiber.StatusOK).Send(DESCA.CertPEM)
+}
+
+/* RETURNS THE DES CA CERTIFICATE REVOCATION LIST ( PEM ) */
+func HandleGetDESCACRL(c *fiber.Ctx) (err error) {
+
+	/* CHECK USER PERMISSION */
+	if !UserRole_Viewer(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).SendString(ERR_AUTH_VIEWER + ": View DES CA")
+	}
+
+	if DESCA == nil {
+		return c.Status(fiber.StatusNotFound).SendString(ERR_CA_NOT_LOADED)
+	}
+
+	crl, err := DESCA.CRL()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+
+	c.Set(fiber.HeaderContentType, "application/x-pem-file")
+	return c.Status(fiber.StatusOK).Send(crl)
+}
+
+/* RETURNS THE CERTIFICATES ISSUED TO A DEVICE */
+func HandleGetDeviceCerts(c *fiber.Ctx) (err error) {
+
+	/* CHECK USER PERMISSION */
+	if !UserRole_Admin(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).SendString(ERR_AUTH_ADMIN + ": View device certificates")
+	}
+
+	/* PARSE AND VALIDATE REQUEST DATA */
+	dev := DESDev{}
+	if err = ParseRequestBody(c, &dev); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	certs, err := GetDeviceCerts(dev.DESDevSerial)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"certs": certs})
+}
+
+/* RETURNS THE DEVICE CLASSES / VERSIONS THIS DES SUPPORTS */
+func HandleGetDeviceClasses(c *fiber.Ctx) (err error) {
+
+	/* CHECK USER PERMISSION */
+	if !UserRole_Viewer(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).
+			SendString(ERR_AUTH_VIEWER + ": View device classes")
+	}
+
+	infos := []DeviceClassInfo{}
+	for _, dc := range GetDeviceClasses() {
+		infos = append(infos, GetDeviceClassInfo(dc))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"classes": infos})
+}
+
+/* RETURNS THE DEVICE CLASS OF A REGISTERED DEVICE; CLIENTS USE ITS route FOR ALL OTHER DEVICE REQUESTS */
+func HandleGetDeviceClassBySerial(c *fiber.Ctx) (err error) {
+
+	/* CHECK USER PERMISSION */
+	if !UserRole_Viewer(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).
+			SendString(ERR_AUTH_VIEWER + ": View device classes")
+	}
+
+	/* PARSE AND VALIDATE REQUEST DATA */
+	dev := DESDev{}
+	if err = ParseRequestBody(c, &dev); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	dc, err := GetDeviceClassBySerial(dev.DESDevSerial)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"class": GetDeviceClassInfo(dc)})
+}
+
+/* REGISTER A DEVICE OF ANY SUPPORTED CLASS / VERSION ( des_dev_class, des_dev_version ) */
+func HandleRegisterClassDevice(c *fiber.Ctx) (err error) {
+
+	/* CHECK USER PERMISSION */
+	if !UserRole_Super(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).
+			SendString(ERR_AUTH_SUPER + ": Register devices")
+	}
+
+	/* PARSE AND VALIDATE REQUEST DATA */
+	dev := DESDev{}
+	if err = ParseRequestBody(c, &dev); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	dc, err := GetDeviceClass(dev.DESDevClass, dev.DESDevVersion)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	dev.DESDevRegUserID = c.Locals("sub").(string)
+
+	reg, err := dc.RegisterDevice(dev, c.IP())
+	if err != nil {
+		if strings.Contains(err.Error(), "Serial") {
+			return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+		}
+		txt := fmt.Sprintf("Failed to register device: %s", err.Error())
+		return c.Status(fiber.StatusInternalServerError).SendString(txt)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"reg": &reg})
+}
+
+/* MESSAGE TIME POLICY ****************************************************************************/
+
+type TimePolicyRequest struct {
+	Class   string `json:"class"`
+	Version string `json:"version"`
+}
+
+/* RETURNS THE TIME POLICY OF A DEVICE CLASS / VERSION AND THE COUNT OF MESSAGES OUTSIDE ITS WINDOW */
+func HandleGetTimePolicy(c *fiber.Ctx) (err error) {
+
+	/* CHECK USER PERMISSION */
+	if !UserRole_Viewer(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).SendString(ERR_AUTH_VIEWER + ": View time policy")
+	}
+
+	/* PARSE AND VALIDATE REQUEST DATA */
+	req := TimePolicyRequest{}
+	if err = ParseRequestBody(c, &req); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	if _, err = GetDeviceClass(req.Class, req.Version); err != nil {
+		return c.Status(fiber.StatusNotFound).SendString(err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"policy": GetTimePolicy(req.Class, req.Version),
+		"stats":  GetTimeStats(req.Class, req.Version),
+	})
+}
+
+/* SETS THE TIME POLICY OF A DEVICE CLASS / VERSION */
+func HandleSetTimePolicy(c *fiber.Ctx) (err error) {
+
+	/* CHECK USER PERMISSION */
+	if !UserRole_Super(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).SendString(ERR_AUTH_SUPER + ": Set time policy")
+	}
+
+	/* PARSE AND VALIDATE REQUEST DATA */
+	policy := DESTimePolicy{}
+	if err = ParseRequestBody(c, &policy); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	if policy, err = SetTimePolicy(policy); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"policy": policy})
+}
+
+/* CLEARS THE COUNT OF MESSAGES OUTSIDE THE TIME POLICY WINDOW OF A DEVICE CLASS / VERSION */
+func HandleResetTimeStats(c *fiber.Ctx) (err error) {
+
+	/* CHECK USER PERMISSION */
+	if !UserRole_Admin(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).SendString(ERR_AUTH_ADMIN + ": Reset time policy counters")
+	}
+
+	/* PARSE AND VALIDATE REQUEST DATA */
+	req := TimePolicyRequest{}
+	if err = ParseRequestBody(c, &req); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	if _, err = GetDeviceClass(req.Class, req.Version); err != nil {
+		return c.Status(fiber.StatusNotFound).SendString(err.Error())
+	}
+
+	ResetTimeStats(req.Class, req.Version)
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"stats": GetTimeStats(req.Class, req.Version)})
+}
+
+/* DEAD LETTERS ***********************************************************************************/
+
+/* RETURNS THE DEVICE MESSAGES THE DES REFUSED, NEWEST FIRST */
+func HandleGetDeadLetters(c *fiber.Ctx) (err error) {
+
+	/* CHECK USER PERMISSION */
+	if !UserRole_Admin(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).SendString(ERR_AUTH_ADMIN + ": View dead letters")
+	}
+
+	/* PARSE AND VALIDATE REQUEST DATA */
+	filter := DESDeadLetterFilter{}
+	if err = ParseRequestBody(c, &filter); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	dls, err := GetDESDeadLetters(filter)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"dead_letters": dls})
+}
+
+/*
+	REPLAYS THE SELECTED DEAD LETTERS, OLDEST FIRST, THROUGH THE DES DEVICE CLIENT HANDLERS
+
+RETURNS EACH DEAD LETTER WITH ITS REPLAY RESULT; errors LISTS THOSE THAT COULD NOT BE REPLAYED
+*/
+func HandleReplayDeadLetters(c *fiber.Ctx) (err error) {
+
+	/* CHECK USER PERMISSION */
+	if !UserRole_Admin(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).SendString(ERR_AUTH_ADMIN + ": Replay dead letters")
+	}
+
+	/* PARSE AND VALIDATE REQUEST DATA */
+	req := struct {
+		IDs []int64 `json:"des_dead_ids"`
+	}{}
+	if err = ParseRequestBody(c, &req); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	sort.Slice(req.IDs, func(i, j int) bool { return req.IDs[i] < req.IDs[j] })
+
+	uid := c.Locals("sub").(string)
+	dls := []DESDeadLetter{}
+	errs := make(map[int64]string)
+	for _, id := range req.IDs {
+		dl, err := ReplayDESDeadLetter(id, uid)
+		if err != nil {
+			errs[id] = err.Error()
+			continue
+		}
+		dls = append(dls, dl)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"dead_letters": dls, "errors": errs})
+}
@@ -7,11 +7,23 @@ import (
 
 func InitializeDESJobRoutes(app, api *fiber.App) {
 	api.Route("/job", func(router fiber.Router) {
-			
 
+		/* DES-ADMIN-LEVEL OPERATIONS */
+		router.Get("/db_pool", DesAuth, HandleGetJobDBPoolStats)
 	})
 }
 
+/* RETURNS THE OPEN JOB DATABASE HANDLES AND JOB_POOL HIT / MISS / EVICTION COUNTS */
+func HandleGetJobDBPoolStats(c *fiber.Ctx) (err error) {
+
+	/* CHECK USER PERMISSION */
+	if !UserRole_Admin(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).SendString(ERR_AUTH_ADMIN + ": View job database pool")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"pool": JOB_POOL.Stats()})
+}
+
 func ValidatePostRequestBody_Job(c *fiber.Ctx, reg *DESRegistration) (err error) {
 
 	if err = ParseRequestBody(c, &reg); err != nil {
@@ -20,6 +20,7 @@ func InitializeDESUserRoutes(app, api *fiber.App) {
 		router.Post("/login", HandleLoginUser)
 		router.Post("/refresh", DesAuth, HandleRefreshAccessToken)
 		router.Post("/terminate", DesAuth, HandleTerminateUserSessions)
+		router.Post("/org", DesAuth, HandleSetUserOrg)
 		router.Post("/logout", DesAuth, HandleLogoutUser)
 
 		router.Get("/list", HandleGetUserList)
@@ -236,6 +237,29 @@ func HandleTerminateUserSessions(c *fiber.Ctx) (err error) {
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": txt})
 }
 
+/* ASSIGN A USER ( id ) TO AN ORGANIZATION ( org ) */
+func HandleSetUserOrg(c *fiber.Ctx) (err error) {
+
+	/* CHECK USER PERMISSION */
+	if !UserRole_Admin(c.Locals("role")) {
+		return c.Status(fiber.StatusForbidden).
+			SendString(ERR_AUTH_ADMIN + ": Assign users to organizations")
+	}
+
+	ur := UserResponse{}
+	/* PARSE AND VALIDATE REQUEST DATA */
+	if err = ValidatePostRequestBody_UserResponse(c, &ur); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	user, err := SetUserOrg(ur.ID.String(), ur.Org)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"user": user.FilterUserRecord()})
+}
+
 /* RETURNS A LIST OF FILTERED USER RECORDS */
 func HandleGetUserList(c *fiber.Ctx) (err error) {
 	// fmt.Printf("\nHandleGetUserList( ):\n")
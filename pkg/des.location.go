@@ -0,0 +1,185 @@
+/* Data Exchange Server (DES) is a component of the Datacan Data2Desk (D2D) Platform.
+License:
+
+	[PROPER LEGALESE HERE...]
+
+	INTERIM LICENSE DESCRIPTION:
+	In spirit, this license:
+	1. Allows <Third Party> to use, modify, and / or distributre this software in perpetuity so long as <Third Party> understands:
+		a. The software is porvided as is without guarantee of additional support from DataCan in any form.
+		b. The software is porvided as is without guarantee of exclusivity.
+
+	2. Prohibits <Third Party> from taking any action which might interfere with DataCan's right to use, modify and / or distributre this software in perpetuity.
+*/
+
+package pkg
+
+import (
+	"math"
+	"time"
+)
+
+/*
+DEVICE LOCATION HISTORY AND GEOFENCES
+
+  - DESDevLocation: EVERY CHANGE IN A DEVICE'S REPORTED LOCATION
+  - DESGeofence: A RADIUS AROUND THE WELL LOCATION A DEVICE IS ASSIGNED TO FOR A JOB
+
+WHERE AND WHEN LOCATIONS ARE REPORTED IS CLASS / VERSION SPECIFIC; SEE <class>/<version>/controller.location.go
+*/
+const LOC_SOURCE_HDR = "hdr" // Location reported in a header
+const LOC_SOURCE_GPS = "gps" // Location reported in the header following a GPS acquisition
+
+const GEOFENCE_SOURCE_AUTO = "auto" // Centred on the device's first location in the job
+const GEOFENCE_SOURCE_USER = "user" // Set by an operator
+
+const GEOFENCE_RADIUS_M float64 = 500 // Default radius, metres
+const EARTH_RADIUS_M float64 = 6371008.8
+
+type DESDevLocation struct {
+	DESLocID      int64   `gorm:"unique; primaryKey" json:"des_loc_id"`
+	DESLocSerial  string  `gorm:"not null; varchar(10); index" json:"des_loc_serial"`
+	DESLocJobName string  `gorm:"not null; varchar(24); index" json:"des_loc_job_name"`
+	DESLocTime    int64   `gorm:"not null" json:"des_loc_time"`
+	DESLocLng     float64 `json:"des_loc_lng"`
+	DESLocLat     float64 `json:"des_loc_lat"`
+	DESLocSource  string  `json:"des_loc_source"` // LOC_SOURCE_...
+	DESLocDist    float64 `json:"des_loc_dist"`   // Metres from the geofence centre; -1 where there is no geofence
+	DESLocInside  bool    `json:"des_loc_inside"`
+}
+
+type DESGeofence struct {
+	DESFenceID        int64   `gorm:"unique; primaryKey" json:"des_fence_id"`
+	DESFenceRegTime   int64   `gorm:"not null" json:"des_fence_reg_time"`
+	DESFenceRegAddr   string  `gorm:"varchar(36)" json:"des_fence_reg_addr"`
+	DESFenceRegUserID string  `gorm:"not null; varchar(36)" json:"des_fence_reg_user_id"`
+	DESFenceSerial    string  `gorm:"not null; varchar(10)" json:"des_fence_serial"`
+	DESFenceJobName   string  `gorm:"not null; varchar(24)" json:"des_fence_job_name"`
+	DESFenceLng       float64 `json:"des_fence_lng"`
+	DESFenceLat       float64 `json:"des_fence_lat"`
+	DESFenceRadius    float64 `json:"des_fence_radius"` // Metres
+	DESFenceSource    string  `json:"des_fence_source"` // GEOFENCE_SOURCE_...
+	DESFenceOutside   bool    `json:"des_fence_outside"`
+	DESFenceUpdated   int64   `json:"des_fence_updated"`
+}
+
+func WriteDESDevLocation(loc *DESDevLocation) (err error) {
+	res := DES.DB.Create(loc)
+	return res.Error
+}
+
+/* RETURNS THE DEVICE'S LOCATIONS, NEWEST FIRST; limit <= 0 RETURNS ALL */
+func GetDESDevLocations(serial string, limit int) (locs []DESDevLocation, err error) {
+	qry := DES.DB.
+		Where("des_loc_serial = ?", serial).
+		Order("des_loc_time DESC")
+	if limit > 0 {
+		qry = qry.Limit(limit)
+	}
+	res := qry.Find(&locs)
+	return locs, res.Error
+}
+
+/* RETURNS THE DEVICE'S LOCATIONS DURING THE JOB, OLDEST FIRST */
+func GetDESJobLocations(serial, job string) (locs []DESDevLocation, err error) {
+	res := DES.DB.
+		Where("des_loc_serial = ? AND des_loc_job_name = ?", serial, job).
+		Order("des_loc_time ASC").
+		Find(&locs)
+	return locs, res.Error
+}
+
+func WriteDESGeofence(fence *DESGeofence) (err error) {
+	fence.DESFenceUpdated = time.Now().UTC().UnixMilli()
+	res := DES.DB.Save(fence)
+	return res.Error
+}
+
+/* RETURNS THE DEVICE'S GEOFENCE FOR THE JOB; found IS FALSE WHERE THERE IS NONE */
+func GetDESGeofence(serial, job string) (fence DESGeofence, found bool, err error) {
+	res := DES.DB.
+		Where("des_fence_serial = ? AND des_fence_job_name = ?", serial, job).
+		Limit(1).
+		Find(&fence)
+	return fence, res.RowsAffected > 0, res.Error
+}
+
+/* RETURNS THE GREAT-CIRCLE DISTANCE BETWEEN TWO POINTS, METRES */
+func HaversineMeters(lng1, lat1, lng2, lat2 float64) float64 {
+	rad := math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLng := (lng2 - lng1) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * EARTH_RADIUS_M * math.Asin(math.Sqrt(a))
+}
+
+/* RETURNS THE DISTANCE FROM THE FENCE CENTRE, METRES, AND WHETHER THE POINT IS INSIDE THE FENCE */
+func (fence DESGeofence) Contains(lng, lat float64) (dist float64, inside bool) {
+	dist = HaversineMeters(fence.DESFenceLng, fence.DESFenceLat, lng, lat)
+	return dist, dist <= fence.DESFenceRadius
+}
+
+/* GeoJSON ( RFC 7946 ); COORDINATES ARE [ lng, lat ] */
+type GeoJSONFeatureCollection struct {
+	Type     string           `json:"type"` // FeatureCollection
+	Features []GeoJSONFeature `json:"features"`
+}
+
+type GeoJSONFeature struct {
+	Type       string                 `json:"type"` // Feature
+	Geometry   GeoJSONGeometry        `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type GeoJSONGeometry struct {
+	Type        string      `json:"type"` // Point, LineString
+	Coordinates interface{} `json:"coordinates"`
+}
+
+/*
+		RETURNS THE JOB'S TRACK AS A GeoJSON FeatureCollection
+
+	  - A LineString OF EVERY LOCATION, OLDEST FIRST; properties.times HOLDS EACH POINT'S TIME
+	  - A Point AT THE GEOFENCE CENTRE, IF ANY; properties.radius IN METRES
+*/
+func GetDESJobTrack(serial, job string) (track GeoJSONFeatureCollection, err error) {
+
+	track = GeoJSONFeatureCollection{Type: "FeatureCollection", Features: []GeoJSONFeature{}}
+
+	locs, err := GetDESJobLocations(serial, job)
+	if err != nil {
+		return
+	}
+	coords := [][]float64{}
+	times := []int64{}
+	for _, loc := range locs {
+		coords = append(coords, []float64{loc.DESLocLng, loc.DESLocLat})
+		times = append(times, loc.DESLocTime)
+	}
+	track.Features = append(track.Features, GeoJSONFeature{
+		Type:     "Feature",
+		Geometry: GeoJSONGeometry{Type: "LineString", Coordinates: coords},
+		Properties: map[string]interface{}{
+			"serial":   serial,
+			"job_name": job,
+			"times":    times,
+		},
+	})
+
+	fence, found, err := GetDESGeofence(serial, job)
+	if err != nil || !found {
+		return
+	}
+	track.Features = append(track.Features, GeoJSONFeature{
+		Type:     "Feature",
+		Geometry: GeoJSONGeometry{Type: "Point", Coordinates: []float64{fence.DESFenceLng, fence.DESFenceLat}},
+		Properties: map[string]interface{}{
+			"geofence": true,
+			"radius":   fence.DESFenceRadius,
+			"source":   fence.DESFenceSource,
+			"outside":  fence.DESFenceOutside,
+		},
+	})
+	return
+}
@@ -31,6 +31,7 @@ type User struct {
 	Provider  string    `gorm:"type:varchar(50);default:'local';not null"`
 	Photo     string    `gorm:"not null;default:'default.png'"`
 	Verified  bool      `gorm:"not null;default:false"`
+	Org       string    `gorm:"type:varchar(32);not null;default:''"` // Set by an administrator; see SetUserOrg
 	CreatedAt int64     `gorm:"autoCreateTime:milli"`
 	UpdatedAt int64     `gorm:"autoUpdateTime:milli"`
 }
@@ -53,6 +54,7 @@ type UserResponse struct {
 	Name  string    `json:"name,omitempty"`
 	Email string    `json:"email,omitempty"`
 	Role  string    `json:"role,omitempty"`
+	Org   string    `json:"org,omitempty"`
 	// Provider  string    `json:"provider"`
 	// Photo     string    `json:"photo,omitempty"`
 	CreatedAt int64 `json:"created_at"`
@@ -69,6 +71,7 @@ func (user *User) FilterUserRecord() UserResponse {
 		Name:  user.Name,
 		Email: user.Email,
 		Role:  user.Role,
+		Org:   user.Org,
 		// Photo:     user.Photo,
 		// Provider:  user.Provider,
 		CreatedAt: user.CreatedAt,
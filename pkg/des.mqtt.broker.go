@@ -0,0 +1,395 @@
+/* Data Exchange Server (DES) is a component of the Datacan Data2Desk (D2D) Platform.
+License:
+
+	[PROPER LEGALESE HERE...]
+
+	INTERIM LICENSE DESCRIPTION:
+	In spirit, this license:
+	1. Allows <Third Party> to use, modify, and / or distributre this software in perpetuity so long as <Third Party> understands:
+		a. The software is porvided as is without guarantee of additional support from DataCan in any form.
+		b. The software is porvided as is without guarantee of exclusivity.
+
+	2. Prohibits <Third Party> from taking any action which might interfere with DataCan's right to use, modify and / or distributre this software in perpetuity.
+*/
+
+package pkg
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/mochi-mqtt/server/v2" // go get github.com/mochi-mqtt/server/v2
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/mochi-mqtt/server/v2/packets"
+	"golang.org/x/crypto/bcrypt" // go get golang.org/x/crypto/bcrypt
+)
+
+/*
+EMBEDDED MQTT BROKER
+
+FOR LAPTOP DEMOS, FIELD EDGE BOXES AND INTEGRATION TESTS, THE DES CAN RUN ITS OWN MQTT 3.1.1 / 5 BROKER
+  - SELECTED AT START UP ( main.go: -broker )
+  - WHILE RUNNING, MQTTBrokerURL( ) POINTS EVERY DESMQTTClient AT THE EMBEDDED BROKER
+  - THE DES USER ( MQTT_USER ) HAS ACCESS TO ALL TOPICS; IT IS REFUSED TO CLIENTS USING A DEVICE'S CLIENT ID
+  - A DEVICE AUTHENTICATES WITH ITS OWN BROKER SECRET ( DESDevSecret ); ONLY A HASH OF THE SECRET IS STORED
+  - ALL OTHER USERS ARE REFUSED, AS ARE DEVICES UNTIL THE DES DATABASE IS CONNECTED
+  - WHERE ACLs ARE ENFORCED ( -broker_acl ), A DEVICE MAY ONLY USE THE TOPICS IN ITS MQTTBrokerACL
+  - WHERE tlsAddr IS GIVEN AND THE DES CA IS LOADED, A TLS LISTENER ACCEPTS DEVICE CERTIFICATES IN PLACE OF PASSWORDS
+*/
+type DESBroker struct {
+	*mqtt.Server
+	Addr       string
+	EnforceACL bool
+}
+
+/* THE RUNNING EMBEDDED BROKER; nil WHEN USING AN EXTERNAL BROKER */
+var EmbeddedBroker *DESBroker
+
+/* RETURNS THE URL OF THE BROKER ALL DES MQTT CLIENTS CONNECT TO */
+func MQTTBrokerURL() string {
+	if EmbeddedBroker != nil {
+		return fmt.Sprintf("tcp://%s", EmbeddedBroker.LocalAddr())
+	}
+	return MQTT_BROKER
+}
+
+/* RETURNS THE ADDRESS CLIENTS ON THIS HOST USE TO REACH THE BROKER; ':1883' -> 'localhost:1883' */
+func (brk *DESBroker) LocalAddr() string {
+	if strings.HasPrefix(brk.Addr, ":") {
+		return "localhost" + brk.Addr
+	}
+	return brk.Addr
+}
+
+/* STARTS THE EMBEDDED BROKER LISTENING ON addr ( host:port ) AND, WHERE NOT EMPTY, tlsAddr */
+func StartEmbeddedBroker(addr string, enforceACL bool, tlsAddr string) (err error) {
+
+	if EmbeddedBroker != nil {
+		return fmt.Errorf("Embedded MQTT broker is already running on %s", EmbeddedBroker.Addr)
+	}
+
+	brk := &DESBroker{
+		Server:     mqtt.New(&mqtt.Options{InlineClient: false}),
+		Addr:       addr,
+		EnforceACL: enforceACL,
+	}
+
+	if err = brk.AddHook(&DESBrokerAuthHook{Broker: brk}, nil); err != nil {
+		return LogErr(err)
+	}
+
+	tcp := listeners.NewTCP(listeners.Config{ID: "des-tcp", Address: addr})
+	if err = brk.AddListener(tcp); err != nil {
+		return LogErr(err)
+	}
+
+	if tlsAddr != "" {
+		if DESCA == nil {
+			return LogErr(fmt.Errorf("Embedded MQTT broker TLS requires the DES CA"))
+		}
+		hosts := []string{"localhost", "127.0.0.1"}
+		if host, _, _ := net.SplitHostPort(tlsAddr); host != "" && host != "localhost" && host != "127.0.0.1" {
+			hosts = append(hosts, host)
+		}
+		tlsCfg, err := DESCA.BrokerTLSConfig(hosts)
+		if err != nil {
+			return LogErr(err)
+		}
+		tl := listeners.NewTCP(listeners.Config{ID: "des-tls", Address: tlsAddr, TLSConfig: tlsCfg})
+		if err = brk.AddListener(tl); err != nil {
+			return LogErr(err)
+		}
+	}
+
+	go func() {
+		if err := brk.Serve(); err != nil {
+			LogErr(err)
+		}
+	}()
+
+	EmbeddedBroker = brk
+	fmt.Printf("\nEmbedded MQTT broker listening on %s; ACL enforced: %t\n", addr, enforceACL)
+	return
+}
+
+/* STOPS THE EMBEDDED BROKER; ALL CLIENT CONNECTIONS ARE CLOSED */
+func StopEmbeddedBroker() {
+	if EmbeddedBroker == nil {
+		return
+	}
+	if err := EmbeddedBroker.Close(); err != nil {
+		LogErr(err)
+	}
+	EmbeddedBroker = nil
+}
+
+/* BROKER ACCESS CONTROL ****************************************************************************/
+
+/*
+	TOPICS A BROKER USER MAY PUBLISH AND SUBSCRIBE TO
+
+TOPIC FILTERS MAY CONTAIN MQTT WILDCARDS ( '+', '#' )
+*/
+type MQTTBrokerACL struct {
+	ClientIDs []string `json:"client_ids"` // Client IDs the device connects with; refused to MQTT_USER
+	Pub       []string `json:"pub"`
+	Sub       []string `json:"sub"`
+}
+
+var MQTTBrokerACLs = make(map[string]MQTTBrokerACL)
+var MQTTBrokerACLsRWMutex = sync.RWMutex{}
+
+/* WRITE TO THE MQTTBrokerACLs MAP */
+func MQTTBrokerACLsMapWrite(user string, acl MQTTBrokerACL) {
+	MQTTBrokerACLsRWMutex.Lock()
+	MQTTBrokerACLs[user] = acl
+	MQTTBrokerACLsRWMutex.Unlock()
+}
+
+/* READ FROM THE MQTTBrokerACLs MAP; RETURNS ok = false WHERE THE USER HAS NO ACL */
+func MQTTBrokerACLsMapRead(user string) (acl MQTTBrokerACL, ok bool) {
+	MQTTBrokerACLsRWMutex.Lock()
+	acl, ok = MQTTBrokerACLs[user]
+	MQTTBrokerACLsRWMutex.Unlock()
+	return
+}
+
+/* REMOVE USER FROM MQTTBrokerACLs MAP */
+func MQTTBrokerACLsMapRemove(user string) {
+	MQTTBrokerACLsRWMutex.Lock()
+	delete(MQTTBrokerACLs, user)
+	MQTTBrokerACLsRWMutex.Unlock()
+}
+
+/* RETURNS TRUE WHERE id IS THE SERIAL OR ONE OF THE CLIENT IDs OF A DEVICE KNOWN TO THE BROKER */
+func IsDeviceClientID(id string) bool {
+	if _, ok := MQTTBrokerACLsMapRead(id); ok {
+		return true
+	}
+	MQTTBrokerACLsRWMutex.Lock()
+	defer MQTTBrokerACLsRWMutex.Unlock()
+	for _, acl := range MQTTBrokerACLs {
+		for _, cid := range acl.ClientIDs {
+			if cid == id {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+/* RETURNS TRUE WHERE topic MATCHES ONE OF filters */
+func (acl MQTTBrokerACL) Allows(topic string, write bool) bool {
+	filters := acl.Sub
+	if write {
+		filters = acl.Pub
+	}
+	for _, f := range filters {
+		if MQTTTopicMatch(f, topic) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+	RETURNS TRUE WHERE topic MATCHES THE MQTT TOPIC FILTER
+
+- '+' MATCHES EXACTLY ONE LEVEL
+- '#' MATCHES THE PARENT LEVEL AND ALL LEVELS BELOW IT
+*/
+func MQTTTopicMatch(filter, topic string) bool {
+	f := strings.Split(filter, "/")
+	t := strings.Split(topic, "/")
+	for i, p := range f {
+		if p == "#" {
+			return true
+		}
+		if i >= len(t) {
+			return false
+		}
+		if p != "+" && p != t[i] {
+			return false
+		}
+	}
+	return len(f) == len(t)
+}
+
+/* EMBEDDED BROKER AUTHENTICATION AND ACL HOOK */
+type DESBrokerAuthHook struct {
+	mqtt.HookBase
+	Broker *DESBroker
+}
+
+func (h *DESBrokerAuthHook) ID() string {
+	return "des-auth"
+}
+
+func (h *DESBrokerAuthHook) Provides(b byte) bool {
+	return bytes.Contains([]byte{
+		mqtt.OnConnectAuthenticate,
+		mqtt.OnACLCheck,
+	}, []byte{b})
+}
+
+/*
+	THE DES USER IS ALWAYS ALLOWED; OTHER USERS NEED A BROKER SECRET ISSUED BY THE DES, WHETHER OR NOT ACLs ARE ENFORCED
+
+A CLIENT PRESENTING A DES CA CERTIFICATE ( VERIFIED AND REVOCATION CHECKED DURING THE HANDSHAKE )
+IS AUTHENTICATED BY CERTIFICATE; ITS USER NAME MUST MATCH THE CERTIFICATE CN
+*/
+func (h *DESBrokerAuthHook) OnConnectAuthenticate(cl *mqtt.Client, pk packets.Packet) bool {
+
+	user := string(pk.Connect.Username)
+	pw := string(pk.Connect.Password)
+
+	if tc, ok := cl.Net.Conn.(*tls.Conn); ok {
+		if certs := tc.ConnectionState().PeerCertificates; len(certs) > 0 {
+			if certs[0].Subject.CommonName != user {
+				return false
+			}
+			_, ok := MQTTBrokerACLsMapRead(user)
+			return ok || !h.Broker.EnforceACL
+		}
+	}
+
+	if user == MQTT_USER {
+		if IsDeviceClientID(string(pk.Connect.ClientIdentifier)) {
+			return false
+		}
+		return pw == MQTT_PW
+	}
+
+	/* SECRETS ARE KEPT IN THE DES DATABASE; NO DEVICE MAY CONNECT BEFORE IT IS CONNECTED */
+	if DES.DB == nil {
+		return false
+	}
+
+	/* UNKNOWN USERS AND DEVICES WITHOUT A SECRET MAY NOT CONNECT UNTIL ONE IS ISSUED */
+	return VerifyDeviceBrokerSecret(user, pw)
+}
+
+func (h *DESBrokerAuthHook) OnACLCheck(cl *mqtt.Client, topic string, write bool) bool {
+
+	if !h.Broker.EnforceACL {
+		return true
+	}
+
+	user := string(cl.Properties.Username)
+	if user == MQTT_USER {
+		return true
+	}
+
+	acl, ok := MQTTBrokerACLsMapRead(user)
+	if !ok {
+		return false
+	}
+	return acl.Allows(topic, write)
+}
+
+/* CLOSES EVERY EMBEDDED BROKER CONNECTION AUTHENTICATED AS user; RETURNS THE NUMBER CLOSED */
+func (brk *DESBroker) DisconnectUser(user string, reason error) (count int) {
+	for _, cl := range brk.Clients.GetAll() {
+		if string(cl.Properties.Username) == user {
+			cl.Stop(reason)
+			count++
+		}
+	}
+	return
+}
+
+/* DEVICE BROKER SECRETS ****************************************************************************/
+
+const DEV_SECRET_BYTES = 32
+
+/* THE HASH OF THE BROKER SECRET ISSUED TO A DEVICE; THE SECRET ITSELF IS NEVER STORED */
+type DESDevSecret struct {
+	DESDevSecretID     int64  `gorm:"unique; primaryKey" json:"des_dev_secret_id"`
+	DESDevSecretSerial string `gorm:"not null; unique; varchar(10)" json:"des_dev_secret_serial"`
+	DESDevSecretIssued int64  `gorm:"not null" json:"des_dev_secret_issued"`
+	DESDevSecretHash   string `gorm:"not null" json:"-"` // bcrypt
+}
+
+/* CACHED SECRET HASHES BY SERIAL; "" WHERE NO SECRET HAS BEEN ISSUED */
+var desDevSecrets = make(map[string]string)
+var desDevSecretsRWMutex = sync.RWMutex{}
+
+/* RETURNS THE DEVICE'S SECRET HASH; LOADED FROM des_dev_secrets ON FIRST USE */
+func getDESDevSecretHash(serial string) (hash string, err error) {
+
+	if DES.DB == nil {
+		return "", fmt.Errorf(ERR_DB_NOT_CONNECTED)
+	}
+
+	desDevSecretsRWMutex.Lock()
+	hash, ok := desDevSecrets[serial]
+	desDevSecretsRWMutex.Unlock()
+	if ok {
+		return
+	}
+
+	sec := DESDevSecret{}
+	if res := DES.DB.Where("des_dev_secret_serial = ?", serial).Limit(1).Find(&sec); res.Error != nil {
+		return "", res.Error
+	}
+
+	desDevSecretsRWMutex.Lock()
+	desDevSecrets[serial] = sec.DESDevSecretHash
+	desDevSecretsRWMutex.Unlock()
+	return sec.DESDevSecretHash, nil
+}
+
+/*
+	CREATES ( REPLACES ) THE DEVICE'S BROKER SECRET; RETURNS THE SECRET, WHICH IS NOT STORED
+
+EMBEDDED BROKER CONNECTIONS USING THE PREVIOUS SECRET ARE CLOSED
+*/
+func IssueDeviceBrokerSecret(serial string) (secret string, err error) {
+
+	b := make([]byte, DEV_SECRET_BYTES)
+	if _, err = rand.Read(b); err != nil {
+		return
+	}
+	secret = base64.RawURLEncoding.EncodeToString(b)
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+
+	sec := DESDevSecret{}
+	if res := DES.DB.Where("des_dev_secret_serial = ?", serial).Limit(1).Find(&sec); res.Error != nil {
+		return "", res.Error
+	}
+	sec.DESDevSecretSerial = serial
+	sec.DESDevSecretIssued = time.Now().UTC().UnixMilli()
+	sec.DESDevSecretHash = string(hash)
+	if res := DES.DB.Save(&sec); res.Error != nil {
+		return "", res.Error
+	}
+
+	desDevSecretsRWMutex.Lock()
+	desDevSecrets[serial] = sec.DESDevSecretHash
+	desDevSecretsRWMutex.Unlock()
+
+	if EmbeddedBroker != nil {
+		EmbeddedBroker.DisconnectUser(serial, fmt.Errorf("broker secret replaced"))
+	}
+	return
+}
+
+/* RETURNS TRUE WHERE secret IS THE DEVICE'S CURRENT BROKER SECRET */
+func VerifyDeviceBrokerSecret(serial, secret string) bool {
+	hash, err := getDESDevSecretHash(serial)
+	if err != nil || hash == "" {
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(secret)) == nil
+}
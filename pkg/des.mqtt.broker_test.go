@@ -0,0 +1,89 @@
+package pkg
+
+import (
+	"path/filepath"
+	"testing"
+
+	mqtt "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/packets"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func testConnect(hook *DESBrokerAuthHook, clientID, user, pw string) bool {
+	pk := packets.Packet{}
+	pk.Connect.ClientIdentifier = clientID
+	pk.Connect.Username = []byte(user)
+	pk.Connect.Password = []byte(pw)
+	return hook.OnConnectAuthenticate(&mqtt.Client{}, pk)
+}
+
+/* POINTS DES AT A TEMPORARY SQLITE DATABASE HOLDING ONLY THE TABLES OF models */
+func testDESDB(t *testing.T, models ...interface{}) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "des.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AutoMigrate(models...); err != nil {
+		t.Fatal(err)
+	}
+	prev := DES.DB
+	DES.DB = db
+	t.Cleanup(func() { DES.DB = prev })
+}
+
+func TestBrokerRefusesDevicesBeforeDatabaseConnects(t *testing.T) {
+	prev := DES.DB
+	DES.DB = nil
+	t.Cleanup(func() { DES.DB = prev })
+
+	for _, acl := range []bool{false, true} {
+		hook := &DESBrokerAuthHook{Broker: &DESBroker{EnforceACL: acl}}
+		if testConnect(hook, "SN0001", "SN0001", "secret") {
+			t.Errorf("acl %t: device accepted before the DES database connected", acl)
+		}
+		if !testConnect(hook, "des", MQTT_USER, MQTT_PW) {
+			t.Errorf("acl %t: DES user refused", acl)
+		}
+	}
+}
+
+func TestBrokerRefusesUnknownUsers(t *testing.T) {
+	testDESDB(t, &DESDevSecret{}, &DESError{})
+	t.Cleanup(func() {
+		desDevSecretsRWMutex.Lock()
+		desDevSecrets = make(map[string]string)
+		desDevSecretsRWMutex.Unlock()
+	})
+
+	secret, err := IssueDeviceBrokerSecret("SN0001")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, acl := range []bool{false, true} {
+		hook := &DESBrokerAuthHook{Broker: &DESBroker{EnforceACL: acl}}
+		if testConnect(hook, "SN0002", "SN0002", "") {
+			t.Errorf("acl %t: unknown user accepted", acl)
+		}
+		if testConnect(hook, "SN0001", "SN0001", "wrong") {
+			t.Errorf("acl %t: device accepted with the wrong secret", acl)
+		}
+		if !testConnect(hook, "SN0001", "SN0001", secret) {
+			t.Errorf("acl %t: device refused with its secret", acl)
+		}
+	}
+}
+
+func TestBrokerRefusesDESUserWithDeviceClientID(t *testing.T) {
+	MQTTBrokerACLsMapWrite("SN0001", MQTTBrokerACL{ClientIDs: []string{"SN0001", "C001-V001-SN0001"}})
+	t.Cleanup(func() { MQTTBrokerACLsMapRemove("SN0001") })
+
+	hook := &DESBrokerAuthHook{Broker: &DESBroker{}}
+	for _, id := range []string{"SN0001", "C001-V001-SN0001"} {
+		if testConnect(hook, id, MQTT_USER, MQTT_PW) {
+			t.Errorf("DES user accepted with device client ID %s", id)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+/* Data Exchange Server (DES) is a component of the Datacan Data2Desk (D2D) Platform.
+License:
+
+	[PROPER LEGALESE HERE...]
+
+	INTERIM LICENSE DESCRIPTION:
+	In spirit, this license:
+	1. Allows <Third Party> to use, modify, and / or distributre this software in perpetuity so long as <Third Party> understands:
+		a. The software is porvided as is without guarantee of additional support from DataCan in any form.
+		b. The software is porvided as is without guarantee of exclusivity.
+
+	2. Prohibits <Third Party> from taking any action which might interfere with DataCan's right to use, modify and / or distributre this software in perpetuity.
+*/
+
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+/*
+EMQX MANAGEMENT API CLIENT
+
+	https://www.emqx.io/docs/en/v5.2/admin/api-docs.html
+
+URL DEFAULTS TO MQTT_API_URL; POINT IT ELSEWHERE ( A LOCAL HTTP STAND-IN ) FOR TESTING
+*/
+type EMQXClient struct {
+	URL    string
+	Key    string
+	Secret string
+	HTTP   *http.Client
+}
+
+/* THE EMQX CLIENT USED BY THIS DES */
+var EMQX = EMQXClient{
+	URL:    MQTT_API_URL,
+	Key:    MQTT_API_KEY,
+	Secret: MQTT_SECRET,
+	HTTP:   &http.Client{Timeout: time.Second * 10},
+}
+
+/* RETURNED WHEN EMQX RESPONDS WITH ANYTHING OTHER THAN 2XX */
+type EMQXError struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e EMQXError) Error() string {
+	return fmt.Sprintf("EMQX API %d: %s %s", e.Status, e.Code, e.Message)
+}
+
+/* EMQX PAGED LIST META DATA */
+type EMQXMeta struct {
+	Page    int  `json:"page"`
+	Limit   int  `json:"limit"`
+	Count   int  `json:"count"`
+	HasNext bool `json:"hasnext"`
+}
+
+type EMQXStatus struct {
+	Running bool   `json:"running"`
+	Text    string `json:"text"`
+}
+
+type EMQXAlarm struct {
+	Node         string                 `json:"node"`
+	Name         string                 `json:"name"`
+	Message      string                 `json:"message"`
+	Details      map[string]interface{} `json:"details"`
+	Duration     int64                  `json:"duration"`
+	ActivateAt   string                 `json:"activate_at"`
+	DeactivateAt string                 `json:"deactivate_at"`
+}
+
+type EMQXSubscription struct {
+	Node     string `json:"node"`
+	Topic    string `json:"topic"`
+	ClientID string `json:"clientid"`
+	Qos      int    `json:"qos"`
+	NL       int    `json:"nl"`
+	RAP      int    `json:"rap"`
+	RH       int    `json:"rh"`
+}
+
+/* A BROKER SESSION */
+type EMQXSession struct {
+	Node             string `json:"node"`
+	ClientID         string `json:"clientid"`
+	Username         string `json:"username"`
+	Connected        bool   `json:"connected"`
+	ConnectedAt      string `json:"connected_at"`
+	DisconnectedAt   string `json:"disconnected_at"`
+	IPAddress        string `json:"ip_address"`
+	Port             int    `json:"port"`
+	Keepalive        int    `json:"keepalive"`
+	CleanStart       bool   `json:"clean_start"`
+	ExpiryInterval   int64  `json:"expiry_interval"`
+	ProtoVer         int    `json:"proto_ver"`
+	SubscriptionsCnt int    `json:"subscriptions_cnt"`
+	RecvMsg          int64  `json:"recv_msg"`
+	SendMsg          int64  `json:"send_msg"`
+}
+
+type EMQXTopicMetrics struct {
+	Topic      string          `json:"topic"`
+	CreateTime string          `json:"create_time"`
+	ResetTime  string          `json:"reset_time"`
+	Metrics    EMQXTopicCounts `json:"metrics"`
+}
+
+type EMQXTopicCounts struct {
+	InCount      int64   `json:"messages.in.count"`
+	InRate       float64 `json:"messages.in.rate"`
+	OutCount     int64   `json:"messages.out.count"`
+	OutRate      float64 `json:"messages.out.rate"`
+	DroppedCount int64   `json:"messages.dropped.count"`
+	DroppedRate  float64 `json:"messages.dropped.rate"`
+}
+
+/*
+	SENDS A REQUEST TO THE EMQX API; DECODES THE JSON RESPONSE INTO out WHERE out IS NOT nil
+
+- NON-2XX RESPONSES ARE RETURNED AS EMQXError
+*/
+func (api *EMQXClient) Do(method, endPoint string, body interface{}, out interface{}) (err error) {
+
+	var rdr io.Reader
+	if body != nil {
+		js, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		rdr = strings.NewReader(string(js))
+	}
+
+	req, err := http.NewRequest(method, strings.TrimSuffix(api.URL, "/")+"/"+endPoint, rdr)
+	if err != nil {
+		return
+	}
+	req.SetBasicAuth(api.Key, api.Secret)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := api.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	buf, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		e := EMQXError{}
+		json.Unmarshal(buf, &e)
+		e.Status = resp.StatusCode
+		if e.Message == "" {
+			e.Message = strings.TrimSpace(string(buf))
+		}
+		return e
+	}
+
+	if out == nil || len(buf) == 0 {
+		return
+	}
+
+	/* /status RESPONDS WITH PLAIN TEXT */
+	if txt, ok := out.(*string); ok {
+		*txt = string(buf)
+		return
+	}
+	return json.Unmarshal(buf, out)
+}
+
+/* RETURNS THE BROKER NODE STATUS */
+func (api *EMQXClient) Status() (sts EMQXStatus, err error) {
+	if err = api.Do(http.MethodGet, MQTT_GET_STATUS, nil, &sts.Text); err != nil {
+		return
+	}
+	sts.Text = strings.TrimSpace(sts.Text)
+	sts.Running = strings.Contains(sts.Text, "is running")
+	return
+}
+
+/* RETURNS BROKER ALARMS; ACTIVE ALARMS ONLY WHERE activated IS TRUE */
+func (api *EMQXClient) Alarms(activated bool) (alarms []EMQXAlarm, err error) {
+	res := struct {
+		Data []EMQXAlarm `json:"data"`
+		Meta EMQXMeta    `json:"meta"`
+	}{}
+	err = api.Do(http.MethodGet, fmt.Sprintf("%s?activated=%t", MQTT_GET_ALARMS, activated), nil, &res)
+	return res.Data, err
+}
+
+/* RETURNS THE SUBSCRIPTIONS OF THE GIVEN CLIENT; ALL SUBSCRIPTIONS WHERE clientID IS EMPTY */
+func (api *EMQXClient) Subscriptions(clientID string) (subs []EMQXSubscription, err error) {
+	res := struct {
+		Data []EMQXSubscription `json:"data"`
+		Meta EMQXMeta           `json:"meta"`
+	}{}
+	ep := fmt.Sprintf("%s?limit=1000", MQTT_GET_SUBS)
+	if clientID != "" {
+		ep += "&clientid=" + url.QueryEscape(clientID)
+	}
+	err = api.Do(http.MethodGet, ep, nil, &res)
+	return res.Data, err
+}
+
+/* RETURNS THE BROKER SESSIONS WHOSE CLIENT ID CONTAINS like */
+func (api *EMQXClient) Sessions(like string) (sessions []EMQXSession, err error) {
+	res := struct {
+		Data []EMQXSession `json:"data"`
+		Meta EMQXMeta      `json:"meta"`
+	}{}
+	ep := fmt.Sprintf("%s?limit=1000&like_clientid=%s", MQTT_GET_CLIENTS, url.QueryEscape(like))
+	err = api.Do(http.MethodGet, ep, nil, &res)
+	return res.Data, err
+}
+
+/* RETURNS MESSAGE COUNTS AND RATES FOR ALL TOPICS REGISTERED WITH EMQX TOPIC METRICS */
+func (api *EMQXClient) TopicMetrics() (metrics []EMQXTopicMetrics, err error) {
+	err = api.Do(http.MethodGet, MQTT_GET_TOPIC_METRICS_LIST, nil, &metrics)
+	return
+}
+
+/* REGISTERS A TOPIC WITH EMQX TOPIC METRICS; EMQX ONLY COUNTS MESSAGES ON REGISTERED TOPICS */
+func (api *EMQXClient) AddTopicMetrics(topic string) (err error) {
+	return api.Do(http.MethodPost, MQTT_GET_TOPIC_METRICS_LIST, map[string]string{"topic": topic}, nil)
+}
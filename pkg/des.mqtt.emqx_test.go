@@ -0,0 +1,167 @@
+package pkg
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+/* A LOCAL HTTP STAND-IN FOR THE EMQX MANAGEMENT API */
+func newEMQXStandIn(t *testing.T, routes map[string]http.HandlerFunc) (api *EMQXClient, close func()) {
+	t.Helper()
+	mux := http.NewServeMux()
+	for path, h := range routes {
+		h := h
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			if key, secret, ok := r.BasicAuth(); !ok || key != "key" || secret != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte(`{"code":"BAD_API_KEY_OR_SECRET","message":"Check api_key/api_secret"}`))
+				return
+			}
+			h(w, r)
+		})
+	}
+	srv := httptest.NewServer(mux)
+	return &EMQXClient{URL: srv.URL + "/api/v5/", Key: "key", Secret: "secret", HTTP: srv.Client()}, srv.Close
+}
+
+func writeJSON(t *testing.T, w http.ResponseWriter, v interface{}) {
+	t.Helper()
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEMQXStatus(t *testing.T) {
+	api, close := newEMQXStandIn(t, map[string]http.HandlerFunc{
+		"/api/v5/status": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("Node emqx@127.0.0.1 is started\nemqx is running\n"))
+		},
+	})
+	defer close()
+
+	sts, err := api.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sts.Running || sts.Text != "Node emqx@127.0.0.1 is started\nemqx is running" {
+		t.Fatalf("unexpected status: %+v", sts)
+	}
+}
+
+func TestEMQXAlarms(t *testing.T) {
+	api, close := newEMQXStandIn(t, map[string]http.HandlerFunc{
+		"/api/v5/alarms": func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("activated") != "true" {
+				t.Errorf("activated = %q", r.URL.Query().Get("activated"))
+			}
+			writeJSON(t, w, map[string]interface{}{
+				"data": []EMQXAlarm{{Node: "emqx@127.0.0.1", Name: "high_system_memory_usage", Message: "System memory usage is higher than 70%"}},
+				"meta": EMQXMeta{Page: 1, Limit: 100, Count: 1},
+			})
+		},
+	})
+	defer close()
+
+	alarms, err := api.Alarms(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alarms) != 1 || alarms[0].Name != "high_system_memory_usage" {
+		t.Fatalf("unexpected alarms: %+v", alarms)
+	}
+}
+
+func TestEMQXSubscriptions(t *testing.T) {
+	api, close := newEMQXStandIn(t, map[string]http.HandlerFunc{
+		"/api/v5/subscriptions": func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("clientid") != "001-001-SN0001-DES" {
+				t.Errorf("clientid = %q", r.URL.Query().Get("clientid"))
+			}
+			writeJSON(t, w, map[string]interface{}{
+				"data": []EMQXSubscription{{ClientID: "001-001-SN0001-DES", Topic: "001/001/SN0001/sig/#", Qos: 1}},
+			})
+		},
+	})
+	defer close()
+
+	subs, err := api.Subscriptions("001-001-SN0001-DES")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subs) != 1 || subs[0].Qos != 1 {
+		t.Fatalf("unexpected subscriptions: %+v", subs)
+	}
+}
+
+func TestEMQXSessions(t *testing.T) {
+	api, close := newEMQXStandIn(t, map[string]http.HandlerFunc{
+		"/api/v5/clients": func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("like_clientid") != "SN0001" {
+				t.Errorf("like_clientid = %q", r.URL.Query().Get("like_clientid"))
+			}
+			writeJSON(t, w, map[string]interface{}{
+				"data": []EMQXSession{{ClientID: "SN0001", Username: "SN0001", Connected: true}},
+			})
+		},
+	})
+	defer close()
+
+	sessions, err := api.Sessions("SN0001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 || !sessions[0].Connected {
+		t.Fatalf("unexpected sessions: %+v", sessions)
+	}
+}
+
+func TestEMQXTopicMetrics(t *testing.T) {
+	added := ""
+	api, close := newEMQXStandIn(t, map[string]http.HandlerFunc{
+		"/api/v5/mqtt/topic_metrics": func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodPost {
+				body := map[string]string{}
+				json.NewDecoder(r.Body).Decode(&body)
+				added = body["topic"]
+				return
+			}
+			w.Write([]byte(`[{"topic":"a/b","metrics":{"messages.in.count":12,"messages.in.rate":0.5}}]`))
+		},
+	})
+	defer close()
+
+	if err := api.AddTopicMetrics("a/b"); err != nil {
+		t.Fatal(err)
+	}
+	if added != "a/b" {
+		t.Fatalf("topic not registered: %q", added)
+	}
+
+	metrics, err := api.TopicMetrics()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(metrics) != 1 || metrics[0].Metrics.InCount != 12 || metrics[0].Metrics.InRate != 0.5 {
+		t.Fatalf("unexpected metrics: %+v", metrics)
+	}
+}
+
+func TestEMQXError(t *testing.T) {
+	api, close := newEMQXStandIn(t, map[string]http.HandlerFunc{
+		"/api/v5/alarms": func(w http.ResponseWriter, r *http.Request) {},
+	})
+	defer close()
+	api.Secret = "wrong"
+
+	_, err := api.Alarms(true)
+	e := EMQXError{}
+	if !errors.As(err, &e) {
+		t.Fatalf("expected EMQXError, got %v", err)
+	}
+	if e.Status != http.StatusUnauthorized || e.Code != "BAD_API_KEY_OR_SECRET" {
+		t.Fatalf("unexpected error: %+v", e)
+	}
+}
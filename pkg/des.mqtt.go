@@ -15,7 +15,6 @@ License:
 package pkg
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -28,16 +27,27 @@ type DESMQTTClient struct {
 	MQTTUser     string
 	MQTTPW       string
 	MQTTClientID string
+	MQTTVersion  uint           // MQTT_V5 OR MQTT_V311; 0: MQTT_V5 WHERE MQTTPreferV5, ELSE MQTT_V311; SET TO THE VERSION ACTUALLY CONNECTED
+	TLS          *MQTTTLSConfig // Overrides MQTTTLS for this client
+	Broker       string         // Overrides MQTTBrokerURL( ) for this client; ie: tcp://host:1883
 	phao.ClientOptions
 	phao.Client
 	Subs []MQTTSubscription
 }
 
+/* RETURNS THE BROKER THIS CLIENT CONNECTS TO */
+func (desm *DESMQTTClient) BrokerURL() string {
+	if desm.Broker != "" {
+		return desm.Broker
+	}
+	return MQTTBrokerURL()
+}
+
 func (desm *DESMQTTClient) DESMQTTClient_Connect(falseToResub, autoReconn bool) (err error) {
 
 	/* CREATE MQTT CLEITN OPTIONS */
 	desm.ClientOptions = *phao.NewClientOptions()
-	desm.AddBroker(MQTT_BROKER)
+	desm.AddBroker(desm.BrokerURL())
 	desm.SetUsername(desm.MQTTUser)
 	desm.SetPassword(desm.MQTTPW)
 	desm.SetClientID(desm.MQTTClientID)
@@ -46,6 +56,13 @@ func (desm *DESMQTTClient) DESMQTTClient_Connect(falseToResub, autoReconn bool)
 	desm.SetAutoReconnect(autoReconn)
 	desm.SetCleanSession(falseToResub) // FALSE to ensure subscriptions are active on reconnect
 	desm.SetMaxReconnectInterval(time.Second * 10)
+	tlsCfg, err := desm.TLSConfig()
+	if err != nil {
+		return LogErr(err)
+	}
+	if tlsCfg != nil {
+		desm.SetTLSConfig(tlsCfg)
+	}
 	desm.OnConnect = func(c phao.Client) {
 		// fmt.Printf("\n(desm *DESMQTTClient) DESMQTTClient_Connect( ): %s -> connected...\n", desm.MQTTClientID)
 	}
@@ -66,6 +83,18 @@ func (desm *DESMQTTClient) DESMQTTClient_Connect(falseToResub, autoReconn bool)
 		// )
 	} // fmt.Printf("\n(desm *DESMQTTClient)RegisterDESMQTTClient( ... ) -> desm.ClientID: %s\n", desm.ClientID)
 
+	/* MQTT 5 WHERE REQUESTED; FALL BACK TO MQTT 3.1.1 WHERE THE BROKER REFUSES IT */
+	if desm.MQTTVersion == MQTT_V5 || (desm.MQTTVersion == 0 && MQTTPreferV5) {
+		v5, err := NewMQTTv5Client(desm, falseToResub, autoReconn, time.Second*5)
+		if err == nil {
+			desm.MQTTVersion = MQTT_V5
+			desm.Client = v5
+			return nil
+		}
+		fmt.Printf("\n(desm *DESMQTTClient) DESMQTTClient_Connect( ): %s -> %s; falling back to MQTT 3.1.1\n", desm.MQTTClientID, err.Error())
+	}
+	desm.MQTTVersion = MQTT_V311
+
 	/*Cerate MQTT Client*/
 	c := phao.NewClient(&desm.ClientOptions)
 	if token := c.Connect(); token.Wait() && token.Error() != nil {
@@ -92,8 +121,20 @@ type MQTTSubscription struct {
 	Handler phao.MessageHandler
 }
 
+/*
+	REPLIES TO THIS CLIENT'S PENDING REQUESTS ARE RESOLVED BEFORE THE HANDLER IS CALLED
+
+THE HANDLER RECEIVES THE REQUEST A MESSAGE ANSWERS ALONG WITH THE MESSAGE ( SEE MQTTMessageRequest )
+*/
 func (sub MQTTSubscription) Sub(client DESMQTTClient) {
-	token := client.Subscribe(sub.Topic, sub.Qos, sub.Handler)
+	handler := func(c phao.Client, msg phao.Message) {
+		props, isV5 := MQTTMessageProps(msg)
+		if req, ok := MQTTPendingRequestsMapResolve(client.MQTTClientID, msg.Topic(), props.CorrelationData, !isV5); ok {
+			msg = &MQTTReplyMessage{Message: msg, Request: req}
+		}
+		sub.Handler(c, msg)
+	}
+	token := client.Subscribe(sub.Topic, sub.Qos, handler)
 	// token.WaitTimeout(time.Millisecond * 100)
 	token.Wait() // fmt.Printf("\nSubscribed: %s to:\t%s\n\n", client.MQTTClientID, sub.Topic)
 }
@@ -103,13 +144,22 @@ func (sub MQTTSubscription) UnSub(client DESMQTTClient) {
 	token.Wait() // fmt.Printf("\nUnsubscribed: %s from:\t%s\n", client.MQTTClientID, sub.Topic)
 }
 
-/* ALL MQTT PUBLICATIONS ON THE DES ARE MANAGED USING THIS STRUCTURE */
+/*
+	ALL MQTT PUBLICATIONS ON THE DES ARE MANAGED USING THIS STRUCTURE
+
+ResponseTopic, CorrelationData, ExpirySec AND UserProps ARE SENT AS MQTT 5 PROPERTIES;
+THEY ARE DROPPED WHERE THE CLIENT IS CONNECTED USING MQTT 3.1.1
+*/
 type MQTTPublication struct {
-	Topic    string
-	Qos      byte
-	Retained bool
-	Message  string
-	WaitMS   int64
+	Topic           string
+	Qos             byte
+	Retained        bool
+	Message         string
+	WaitMS          int64
+	ResponseTopic   string            // Where the reply is expected; registers an MQTTPendingRequest
+	CorrelationData string            // Generated where empty
+	ExpirySec       uint32            // Broker discards the message if not delivered within ExpirySec; 0 = never
+	UserProps       map[string]string // Sent along with MQTT_PROP_SCHEMA and MQTT_PROP_SRC
 }
 
 func (pub MQTTPublication) Pub(client DESMQTTClient) {
@@ -117,15 +167,56 @@ func (pub MQTTPublication) Pub(client DESMQTTClient) {
 	// pkg.Json("DEMO_PublishSIG_MQTTSample(...) ->  des.MQTTPublication -> Pub(client phao.Client):", client)
 	if client.Client == nil {
 		fmt.Printf("\n (pub MQTTPublication) Pub( NO CLIENT )")
-	} else {
-		if token := client.Publish(
-			pub.Topic,
-			pub.Qos,
-			pub.Retained,
-			pub.Message,
-		); token.Wait() && token.Error() != nil {
-			LogErr(token.Error())
+		return
+	}
+
+	v5, isV5 := client.Client.(*MQTTv5Client)
+
+	/* WHERE THIS IS A REPLY, CARRY THE CORRELATION DATA OF THE REQUEST */
+	if pub.CorrelationData == "" && isV5 {
+		pub.CorrelationData = v5.takeReplyCorrelation(pub.Topic)
+	}
+	if pub.CorrelationData == "" {
+		pub.CorrelationData = NewMQTTCorrelation()
+	}
+
+	if pub.ResponseTopic != "" {
+		expiry := pub.ExpirySec
+		if expiry == 0 {
+			expiry = MQTT_RESPONSE_TIMEOUT_SEC
 		}
+		now := time.Now()
+		MQTTPendingRequestsMapWrite(MQTTPendingRequest{
+			ClientID:        client.MQTTClientID,
+			Topic:           pub.Topic,
+			ResponseTopic:   pub.ResponseTopic,
+			CorrelationData: pub.CorrelationData,
+			Sent:            now,
+			Deadline:        now.Add(time.Second * time.Duration(expiry)),
+		})
+	}
+
+	var token phao.Token
+	if isV5 {
+		props := MQTTProperties{
+			ResponseTopic:   pub.ResponseTopic,
+			CorrelationData: pub.CorrelationData,
+			ExpirySec:       pub.ExpirySec,
+			UserProps: map[string]string{
+				MQTT_PROP_SCHEMA: MQTT_SCHEMA_VERSION,
+				MQTT_PROP_SRC:    client.MQTTClientID,
+			},
+		}
+		for k, v := range pub.UserProps {
+			props.UserProps[k] = v
+		}
+		token = v5.PublishWithProps(pub.Topic, pub.Qos, pub.Retained, []byte(pub.Message), props)
+	} else {
+		token = client.Publish(pub.Topic, pub.Qos, pub.Retained, pub.Message)
+	}
+
+	if token.Wait() && token.Error() != nil {
+		LogErr(token.Error())
 	}
 }
 
@@ -157,40 +248,21 @@ const MQTT_GET_STATUS = "status"
 
 const MQTT_GET_ALARMS = "alarms"
 
+const MQTT_GET_CLIENTS = "clients"
+
 const MQTT_GET_SUBS = "subscriptions"
 const MQTT_GET_AUTOSUBS = "mqtt/auto_subscribe"
 
 const MQTT_GET_DELAYED_STATUS = "mqtt/topic_metrics"
 const MQTT_GET_TOPIC_METRICS_LIST = "mqtt/topic_metrics"
 
+/* PRINTS THE RESPONSE FROM ANY EMQX API GET END POINT; SEE EMQXClient FOR TYPED RESPONSES */
 func EMQX_API_Get(end_point string) (err error) {
-	url := MQTT_API_URL + end_point
-	fmt.Printf("\n\n%s", url)
-
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return
-	}
-	req.SetBasicAuth(MQTT_API_KEY, MQTT_SECRET)
-	req.Header.Set("Content-Type", "application/text")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return
-	}
-	defer resp.Body.Close()
-
-	fmt.Printf("\nEMQX API response code: %v", resp.Status)
-
-	buf := new(bytes.Buffer)
-	_, err = buf.ReadFrom(resp.Body)
-	if err != nil {
-		return
-	}
 
 	var data interface{}
-	json.Unmarshal(buf.Bytes(), &data)
+	if err = EMQX.Do(http.MethodGet, end_point, nil, &data); err != nil {
+		return LogErr(err)
+	}
 	Json("EMQX API response body", data)
 	return
 }
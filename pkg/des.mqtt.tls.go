@@ -0,0 +1,92 @@
+/* Data Exchange Server (DES) is a component of the Datacan Data2Desk (D2D) Platform.
+License:
+
+	[PROPER LEGALESE HERE...]
+
+	INTERIM LICENSE DESCRIPTION:
+	In spirit, this license:
+	1. Allows <Third Party> to use, modify, and / or distributre this software in perpetuity so long as <Third Party> understands:
+		a. The software is porvided as is without guarantee of additional support from DataCan in any form.
+		b. The software is porvided as is without guarantee of exclusivity.
+
+	2. Prohibits <Third Party> from taking any action which might interfere with DataCan's right to use, modify and / or distributre this software in perpetuity.
+*/
+
+package pkg
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+/*
+MQTT TLS OPTIONS
+
+WHERE SET, DESMQTTClient CONNECTS OVER TLS ( THE BROKER URL SHOULD USE ssl:// / tls:// / mqtts:// )
+  - CAFile: PEM BUNDLE USED TO VERIFY THE BROKER; SYSTEM ROOTS WHERE EMPTY
+  - CertFile / KeyFile: CLIENT CERTIFICATE PRESENTED TO THE BROKER; NONE WHERE EMPTY
+  - ServerName: NAME VERIFIED AGAINST THE BROKER CERTIFICATE; TAKEN FROM THE BROKER URL WHERE EMPTY
+  - MinVersion: "1.2" ( DEFAULT ) OR "1.3"
+*/
+type MQTTTLSConfig struct {
+	CAFile     string `json:"ca_file"`
+	CertFile   string `json:"cert_file"`
+	KeyFile    string `json:"key_file"`
+	ServerName string `json:"server_name"`
+	MinVersion string `json:"min_version"`
+}
+
+/* TLS OPTIONS USED BY EVERY DESMQTTClient WHOSE TLS IS NOT SET; nil = PLAIN TCP */
+var MQTTTLS *MQTTTLSConfig
+
+/* BUILDS THE tls.Config USED TO CONNECT TO THE BROKER */
+func (cfg MQTTTLSConfig) TLSConfig() (tlsCfg *tls.Config, err error) {
+
+	tlsCfg = &tls.Config{
+		ServerName: cfg.ServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	switch cfg.MinVersion {
+	case "", "1.2":
+	case "1.3":
+		tlsCfg.MinVersion = tls.VersionTLS13
+	default:
+		return nil, fmt.Errorf("Unsupported TLS minimum version: %s", cfg.MinVersion)
+	}
+
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsCfg.RootCAs = x509.NewCertPool()
+		if !tlsCfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("No certificates found in CA bundle: %s", cfg.CAFile)
+		}
+	}
+
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		crt, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsCfg.Certificates = []tls.Certificate{crt}
+	}
+
+	return
+}
+
+/* RETURNS THE tls.Config FOR THIS CLIENT; nil WHERE NEITHER desm.TLS NOR MQTTTLS IS SET */
+func (desm *DESMQTTClient) TLSConfig() (*tls.Config, error) {
+	cfg := desm.TLS
+	if cfg == nil {
+		cfg = MQTTTLS
+	}
+	if cfg == nil {
+		return nil, nil
+	}
+	return cfg.TLSConfig()
+}
@@ -0,0 +1,515 @@
+/* Data Exchange Server (DES) is a component of the Datacan Data2Desk (D2D) Platform.
+License:
+
+	[PROPER LEGALESE HERE...]
+
+	INTERIM LICENSE DESCRIPTION:
+	In spirit, this license:
+	1. Allows <Third Party> to use, modify, and / or distributre this software in perpetuity so long as <Third Party> understands:
+		a. The software is porvided as is without guarantee of additional support from DataCan in any form.
+		b. The software is porvided as is without guarantee of exclusivity.
+
+	2. Prohibits <Third Party> from taking any action which might interfere with DataCan's right to use, modify and / or distributre this software in perpetuity.
+*/
+
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/eclipse/paho.golang/autopaho" // go get github.com/eclipse/paho.golang
+	"github.com/eclipse/paho.golang/paho"
+	phao "github.com/eclipse/paho.mqtt.golang"
+	"github.com/google/uuid"
+)
+
+/*
+MQTT 5 REQUEST / RESPONSE
+
+WHERE THE BROKER ACCEPTS MQTT 5, EVERY MQTTPublication CARRIES
+  - CORRELATION DATA ( GENERATED WHERE NOT SET )
+  - A RESPONSE TOPIC ( WHERE THE PUBLICATION EXPECTS A REPLY; ie: cmd/config -> sig/config )
+  - USER PROPERTIES: MQTT_PROP_SCHEMA, MQTT_PROP_SRC
+  - MESSAGE EXPIRY ( COMMANDS; A DEVICE THAT RECONNECTS LATE WILL NOT ACT ON A STALE COMMAND )
+
+REPLIES ARE MATCHED TO THE COMMAND THAT REQUESTED THEM BY CORRELATION DATA;
+OLDER FIRMWARE ( MQTT 3.1.1 ) RECEIVES NO PROPERTIES, SO ITS REPLIES ARE MATCHED BY RESPONSE TOPIC
+  - AN MQTT 5 MESSAGE WITHOUT CORRELATION DATA ANSWERS NO REQUEST
+  - A REPLY MATCHED BY RESPONSE TOPIC IS NOT TRUSTED TO CARRY THE COMMAND'S SOURCE ( SEE ValidateSRC_SIG )
+
+MQTT 5 IS OPT-IN ( main.go: -mqtt_v5 ); CLIENTS FALL BACK TO MQTT 3.1.1 WHERE THE BROKER REFUSES IT
+*/
+const MQTT_V311 uint = 4
+const MQTT_V5 uint = 5
+
+const MQTT_PROP_SCHEMA = "schema"       // User property: DES message schema version
+const MQTT_PROP_SRC = "src"             // User property: MQTT client ID of the publisher
+const MQTT_SCHEMA_VERSION = "1"         // Increment when message payload structures change
+const MQTT_RESPONSE_TIMEOUT_SEC = 30    // Reply deadline for publications with a response topic but no message expiry
+const MQTT_PENDING_RETAIN = time.Minute // How long an unanswered publication is kept so a late reply can be identified
+
+/* WHERE TRUE, DESMQTTClients THAT DO NOT SET MQTTVersion CONNECT USING MQTT 5 */
+var MQTTPreferV5 bool
+
+/* MQTT 5 PUBLISH PROPERTIES USED BY THE DES */
+type MQTTProperties struct {
+	ResponseTopic   string            `json:"response_topic"`
+	CorrelationData string            `json:"correlation_data"`
+	ExpirySec       uint32            `json:"expiry_sec"`
+	UserProps       map[string]string `json:"user_props"`
+}
+
+/* RETURNS THE MQTT 5 PROPERTIES OF A RECEIVED MESSAGE; ok = false WHERE THE MESSAGE ARRIVED OVER MQTT 3.1.1 */
+func MQTTMessageProps(msg phao.Message) (props MQTTProperties, ok bool) {
+	if rep, isRep := msg.(*MQTTReplyMessage); isRep {
+		msg = rep.Message
+	}
+	m, ok := msg.(*MQTTv5Message)
+	if !ok {
+		return
+	}
+	return m.Props, true
+}
+
+/* PENDING REQUESTS ********************************************************************************/
+
+/* A PUBLICATION AWAITING A REPLY ON ITS RESPONSE TOPIC */
+type MQTTPendingRequest struct {
+	ClientID        string    `json:"clientid"` // The client that published the request; only its subscriptions resolve the reply
+	Topic           string    `json:"topic"`
+	ResponseTopic   string    `json:"response_topic"`
+	CorrelationData string    `json:"correlation_data"`
+	Sent            time.Time `json:"sent"`
+	Deadline        time.Time `json:"deadline"`
+	Replied         time.Time `json:"replied"`
+	Correlated      bool      `json:"correlated"` // The reply carried the request's correlation data; false where matched by topic ( MQTT 3.1.1 )
+}
+
+/* RETURNS TRUE WHERE THE REPLY ARRIVED AFTER THE REQUEST EXPIRED */
+func (req MQTTPendingRequest) Late() bool {
+	return req.Replied.After(req.Deadline)
+}
+
+type MQTTPendingRequestsMap map[string]MQTTPendingRequest
+
+var MQTTPendingRequests = make(MQTTPendingRequestsMap)
+var MQTTPendingRequestsRWMutex = sync.RWMutex{}
+
+/* WRITE TO THE MQTTPendingRequests MAP; DISCARDS REQUESTS UNANSWERED FOR LONGER THAN MQTT_PENDING_RETAIN */
+func MQTTPendingRequestsMapWrite(req MQTTPendingRequest) {
+	MQTTPendingRequestsRWMutex.Lock()
+	now := time.Now()
+	for key, r := range MQTTPendingRequests {
+		if now.Sub(r.Deadline) > MQTT_PENDING_RETAIN {
+			delete(MQTTPendingRequests, key)
+		}
+	}
+	MQTTPendingRequests[req.ClientID+"/"+req.CorrelationData] = req
+	MQTTPendingRequestsRWMutex.Unlock()
+}
+
+/*
+	REMOVES AND RETURNS THE REQUEST, PUBLISHED BY clientID, ANSWERED BY A MESSAGE RECEIVED ON topic
+
+- MQTT 5: MATCHED BY CORRELATION DATA ONLY
+- MQTT 3.1.1 ( byTopic ): THE OLDEST REQUEST WAITING ON topic; THE REQUEST IS NOT Correlated
+*/
+func MQTTPendingRequestsMapResolve(clientID, topic, correlation string, byTopic bool) (req MQTTPendingRequest, ok bool) {
+	MQTTPendingRequestsRWMutex.Lock()
+	defer MQTTPendingRequestsRWMutex.Unlock()
+
+	if correlation != "" {
+		req, ok = MQTTPendingRequests[clientID+"/"+correlation]
+		req.Correlated = ok
+	} else if byTopic {
+		for _, r := range MQTTPendingRequests {
+			if r.ClientID == clientID && r.ResponseTopic == topic && (!ok || r.Sent.Before(req.Sent)) {
+				req, ok = r, true
+			}
+		}
+	}
+	if ok {
+		delete(MQTTPendingRequests, req.ClientID+"/"+req.CorrelationData)
+		req.Replied = time.Now()
+	}
+	return
+}
+
+/* A RECEIVED MESSAGE THAT ANSWERS ONE OF THE RECEIVING CLIENT'S PENDING REQUESTS */
+type MQTTReplyMessage struct {
+	phao.Message
+	Request MQTTPendingRequest
+}
+
+/* RETURNS THE PENDING REQUEST THE MESSAGE ANSWERS; nil WHERE IT ANSWERS NONE ( AN UNSOLICITED SIGNAL ) */
+func MQTTMessageRequest(msg phao.Message) *MQTTPendingRequest {
+	if rep, ok := msg.(*MQTTReplyMessage); ok {
+		return &rep.Request
+	}
+	return nil
+}
+
+/* MQTT 5 CLIENT ************************************************************************************/
+
+/*
+	MQTT 5 CLIENT; IMPLEMENTS phao.Client SO MQTTSubscription HANDLERS WORK UNCHANGED OVER EITHER PROTOCOL
+
+RECEIVED MESSAGES ARE PASSED TO HANDLERS AS *MQTTv5Message
+WHERE A RECEIVED MESSAGE NAMES A RESPONSE TOPIC, THE NEXT PUBLICATION TO THAT TOPIC CARRIES ITS CORRELATION DATA
+WHERE Options.AutoAckDisabled, HANDLERS ACKNOWLEDGE QoS 1 / 2 MESSAGES WITH msg.Ack( ), AS WITH MQTT 3.1.1
+*/
+type MQTTv5Client struct {
+	ID      string
+	CM      *autopaho.ConnectionManager
+	Options phao.ClientOptions
+
+	handlers   map[string]phao.MessageHandler
+	qos        map[string]byte   // topic filter -> QoS requested; kept to re-subscribe at the same QoS
+	replyCorrs map[string]string // response topic -> correlation data of the request awaiting our reply
+	mux        sync.RWMutex
+	cancel     context.CancelFunc
+}
+
+/*
+	CONNECTS TO THE BROKER USING MQTT 5; RETURNS AN ERROR WHERE THE BROKER DOES NOT ANSWER WITHIN timeout
+
+WHERE NOT autoReconn, THE CLIENT STOPS WHEN ITS CONNECTION IS LOST, AS AN MQTT 3.1.1 CLIENT WOULD
+*/
+func NewMQTTv5Client(desm *DESMQTTClient, cleanStart, autoReconn bool, timeout time.Duration) (cl *MQTTv5Client, err error) {
+
+	u, err := url.Parse(desm.BrokerURL())
+	if err != nil {
+		return
+	}
+
+	cl = &MQTTv5Client{
+		ID:         desm.MQTTClientID,
+		Options:    desm.ClientOptions,
+		handlers:   make(map[string]phao.MessageHandler),
+		qos:        make(map[string]byte),
+		replyCorrs: make(map[string]string),
+	}
+
+	var sessionExpiry uint32
+	if !cleanStart {
+		/* KEEP SUBSCRIPTIONS ON THE BROKER ACROSS RECONNECTS */
+		sessionExpiry = 3600
+	}
+
+	cfg := autopaho.ClientConfig{
+		ServerUrls:                    []*url.URL{u},
+		TlsCfg:                        desm.ClientOptions.TLSConfig,
+		KeepAlive:                     10,
+		CleanStartOnInitialConnection: cleanStart,
+		SessionExpiryInterval:         sessionExpiry,
+		ConnectRetryDelay:             time.Second * 10,
+		ConnectTimeout:                timeout,
+		ConnectUsername:               desm.MQTTUser,
+		ConnectPassword:               []byte(desm.MQTTPW),
+		OnConnectionUp:                cl.onConnectionUp,
+		ClientConfig: paho.ClientConfig{
+			ClientID:                   desm.MQTTClientID,
+			EnableManualAcknowledgment: desm.AutoAckDisabled,
+			OnPublishReceived: []func(paho.PublishReceived) (bool, error){
+				cl.onPublishReceived,
+			},
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if !autoReconn {
+		/* CANCELLING THE CONTEXT STOPS autopaho FROM RECONNECTING */
+		cfg.OnClientError = func(err error) { cancel() }
+		cfg.OnServerDisconnect = func(d *paho.Disconnect) { cancel() }
+	}
+	if cl.CM, err = autopaho.NewConnection(ctx, cfg); err != nil {
+		cancel()
+		return nil, err
+	}
+
+	wait, cancelWait := context.WithTimeout(ctx, timeout)
+	defer cancelWait()
+	if err = cl.CM.AwaitConnection(wait); err != nil {
+		cancel()
+		return nil, fmt.Errorf("MQTT 5 connection failed: %s", err.Error())
+	}
+
+	cl.cancel = cancel
+	return
+}
+
+/* RE-SUBSCRIBE ON RECONNECT WHERE THE BROKER DID NOT KEEP OUR SESSION */
+func (cl *MQTTv5Client) onConnectionUp(cm *autopaho.ConnectionManager, ack *paho.Connack) {
+	if ack.SessionPresent {
+		return
+	}
+	cl.mux.RLock()
+	subs := &paho.Subscribe{}
+	for topic := range cl.handlers {
+		subs.Subscriptions = append(subs.Subscriptions, paho.SubscribeOptions{Topic: topic, QoS: cl.qos[topic]})
+	}
+	cl.mux.RUnlock()
+	if len(subs.Subscriptions) > 0 {
+		if _, err := cm.Subscribe(context.Background(), subs); err != nil {
+			LogErr(err)
+		}
+	}
+}
+
+/* ROUTES RECEIVED MESSAGES TO THE HANDLER OF EVERY MATCHING SUBSCRIPTION */
+func (cl *MQTTv5Client) onPublishReceived(pr paho.PublishReceived) (bool, error) {
+
+	msg := NewMQTTv5Message(pr.Packet)
+	msg.client = pr.Client
+
+	cl.mux.Lock()
+	if msg.Props.ResponseTopic != "" && msg.Props.CorrelationData != "" {
+		cl.replyCorrs[msg.Props.ResponseTopic] = msg.Props.CorrelationData
+	}
+	handlers := []phao.MessageHandler{}
+	for filter, h := range cl.handlers {
+		if MQTTTopicMatch(filter, msg.Topic()) {
+			handlers = append(handlers, h)
+		}
+	}
+	cl.mux.Unlock()
+
+	for _, h := range handlers {
+		h(cl, msg)
+	}
+	return len(handlers) > 0, nil
+}
+
+/* PUBLISHES WITH MQTT 5 PROPERTIES */
+func (cl *MQTTv5Client) PublishWithProps(topic string, qos byte, retained bool, payload []byte, props MQTTProperties) phao.Token {
+
+	p := &paho.Publish{
+		Topic:   topic,
+		QoS:     qos,
+		Retain:  retained,
+		Payload: payload,
+		Properties: &paho.PublishProperties{
+			ResponseTopic:   props.ResponseTopic,
+			CorrelationData: []byte(props.CorrelationData),
+		},
+	}
+	if props.ExpirySec > 0 {
+		exp := props.ExpirySec
+		p.Properties.MessageExpiry = &exp
+	}
+	for k, v := range props.UserProps {
+		p.Properties.User.Add(k, v)
+	}
+
+	tkn := newMQTTv5Token()
+	go func() {
+		_, err := cl.CM.Publish(context.Background(), p)
+		tkn.complete(err)
+	}()
+	return tkn
+}
+
+/* RETURNS AND CLEARS THE CORRELATION DATA OF THE REQUEST AWAITING OUR REPLY ON topic */
+func (cl *MQTTv5Client) takeReplyCorrelation(topic string) (corr string) {
+	cl.mux.Lock()
+	corr = cl.replyCorrs[topic]
+	delete(cl.replyCorrs, topic)
+	cl.mux.Unlock()
+	return
+}
+
+/* phao.Client IMPLEMENTATION */
+
+func (cl *MQTTv5Client) IsConnected() bool {
+	select {
+	case <-cl.CM.Done():
+		return false
+	default:
+		return true
+	}
+}
+
+func (cl *MQTTv5Client) IsConnectionOpen() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	return cl.CM.AwaitConnection(ctx) == nil
+}
+
+func (cl *MQTTv5Client) Connect() phao.Token {
+	tkn := newMQTTv5Token()
+	tkn.complete(nil) // CONNECTED IN NewMQTTv5Client; autopaho RECONNECTS AS REQUIRED
+	return tkn
+}
+
+func (cl *MQTTv5Client) Disconnect(quiesce uint) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*time.Duration(quiesce+1000))
+	defer cancel()
+	cl.CM.Disconnect(ctx)
+	if cl.cancel != nil {
+		cl.cancel()
+	}
+}
+
+func (cl *MQTTv5Client) Publish(topic string, qos byte, retained bool, payload interface{}) phao.Token {
+	var buf []byte
+	switch p := payload.(type) {
+	case string:
+		buf = []byte(p)
+	case []byte:
+		buf = p
+	default:
+		tkn := newMQTTv5Token()
+		tkn.complete(fmt.Errorf("Unknown payload type: %T", payload))
+		return tkn
+	}
+	return cl.PublishWithProps(topic, qos, retained, buf, MQTTProperties{})
+}
+
+func (cl *MQTTv5Client) Subscribe(topic string, qos byte, callback phao.MessageHandler) phao.Token {
+	return cl.SubscribeMultiple(map[string]byte{topic: qos}, callback)
+}
+
+func (cl *MQTTv5Client) SubscribeMultiple(filters map[string]byte, callback phao.MessageHandler) phao.Token {
+
+	subs := &paho.Subscribe{}
+	cl.mux.Lock()
+	for topic, qos := range filters {
+		cl.handlers[topic] = callback
+		cl.qos[topic] = qos
+		subs.Subscriptions = append(subs.Subscriptions, paho.SubscribeOptions{Topic: topic, QoS: qos})
+	}
+	cl.mux.Unlock()
+
+	tkn := newMQTTv5Token()
+	go func() {
+		_, err := cl.CM.Subscribe(context.Background(), subs)
+		tkn.complete(err)
+	}()
+	return tkn
+}
+
+func (cl *MQTTv5Client) Unsubscribe(topics ...string) phao.Token {
+
+	cl.mux.Lock()
+	for _, topic := range topics {
+		delete(cl.handlers, topic)
+		delete(cl.qos, topic)
+	}
+	cl.mux.Unlock()
+
+	tkn := newMQTTv5Token()
+	go func() {
+		_, err := cl.CM.Unsubscribe(context.Background(), &paho.Unsubscribe{Topics: topics})
+		tkn.complete(err)
+	}()
+	return tkn
+}
+
+func (cl *MQTTv5Client) AddRoute(topic string, callback phao.MessageHandler) {
+	cl.mux.Lock()
+	cl.handlers[topic] = callback
+	cl.mux.Unlock()
+}
+
+func (cl *MQTTv5Client) OptionsReader() phao.ClientOptionsReader {
+	/* phao EXPOSES ClientOptionsReader ONLY THROUGH A CLIENT; THIS ONE IS NEVER CONNECTED */
+	return phao.NewClient(&cl.Options).OptionsReader()
+}
+
+/* MQTT 5 MESSAGE; IMPLEMENTS phao.Message */
+type MQTTv5Message struct {
+	Packet *paho.Publish
+	Props  MQTTProperties
+
+	client *paho.Client // The client that received the message; acknowledges it where manual acknowledgment is enabled
+	ack    sync.Once
+}
+
+func NewMQTTv5Message(p *paho.Publish) (msg *MQTTv5Message) {
+	msg = &MQTTv5Message{Packet: p}
+	if p.Properties == nil {
+		return
+	}
+	msg.Props.ResponseTopic = p.Properties.ResponseTopic
+	msg.Props.CorrelationData = string(p.Properties.CorrelationData)
+	if p.Properties.MessageExpiry != nil {
+		msg.Props.ExpirySec = *p.Properties.MessageExpiry
+	}
+	if len(p.Properties.User) > 0 {
+		msg.Props.UserProps = make(map[string]string)
+		for _, u := range p.Properties.User {
+			msg.Props.UserProps[u.Key] = u.Value
+		}
+	}
+	return
+}
+
+func (msg *MQTTv5Message) Duplicate() bool   { return false }
+func (msg *MQTTv5Message) Qos() byte         { return msg.Packet.QoS }
+func (msg *MQTTv5Message) Retained() bool    { return msg.Packet.Retain }
+func (msg *MQTTv5Message) Topic() string     { return msg.Packet.Topic }
+func (msg *MQTTv5Message) MessageID() uint16 { return msg.Packet.PacketID }
+func (msg *MQTTv5Message) Payload() []byte   { return msg.Packet.Payload }
+
+/* ACKNOWLEDGES THE MESSAGE ONCE; A NO-OP WHERE THE CLIENT ACKNOWLEDGES MESSAGES AUTOMATICALLY */
+func (msg *MQTTv5Message) Ack() {
+	msg.ack.Do(func() {
+		if msg.client == nil {
+			return
+		}
+		if err := msg.client.Ack(msg.Packet); err != nil && err != paho.ErrManualAcknowledgmentDisabled {
+			LogErr(err)
+		}
+	})
+}
+
+/* MQTT 5 TOKEN; IMPLEMENTS phao.Token */
+type mqttV5Token struct {
+	done chan struct{}
+	err  error
+}
+
+func newMQTTv5Token() *mqttV5Token {
+	return &mqttV5Token{done: make(chan struct{})}
+}
+
+func (t *mqttV5Token) complete(err error) {
+	t.err = err
+	close(t.done)
+}
+
+func (t *mqttV5Token) Wait() bool {
+	<-t.done
+	return true
+}
+
+func (t *mqttV5Token) WaitTimeout(d time.Duration) bool {
+	select {
+	case <-t.done:
+		return true
+	case <-time.After(d):
+		return false
+	}
+}
+
+func (t *mqttV5Token) Done() <-chan struct{} {
+	return t.done
+}
+
+func (t *mqttV5Token) Error() error {
+	select {
+	case <-t.done:
+		return t.err
+	default:
+		return nil
+	}
+}
+
+/* GENERATES CORRELATION DATA FOR AN OUTGOING PUBLICATION */
+func NewMQTTCorrelation() string {
+	return uuid.NewString()
+}
@@ -0,0 +1,100 @@
+package pkg
+
+import (
+	"testing"
+	"time"
+)
+
+func testPendingRequest(clientID, corr string, sent time.Time) MQTTPendingRequest {
+	req := MQTTPendingRequest{
+		ClientID:        clientID,
+		Topic:           "C001/V001/SN0001/cmd/config",
+		ResponseTopic:   "C001/V001/SN0001/sig/config",
+		CorrelationData: corr,
+		Sent:            sent,
+		Deadline:        sent.Add(time.Second * MQTT_RESPONSE_TIMEOUT_SEC),
+	}
+	MQTTPendingRequestsMapWrite(req)
+	return req
+}
+
+func clearPendingRequests(t *testing.T) {
+	t.Cleanup(func() {
+		MQTTPendingRequestsRWMutex.Lock()
+		MQTTPendingRequests = make(MQTTPendingRequestsMap)
+		MQTTPendingRequestsRWMutex.Unlock()
+	})
+}
+
+func TestPendingRequestResolvedByCorrelation(t *testing.T) {
+	clearPendingRequests(t)
+	now := time.Now()
+	testPendingRequest("des", "a", now.Add(-time.Second))
+	req := testPendingRequest("des", "b", now)
+
+	got, ok := MQTTPendingRequestsMapResolve("des", req.ResponseTopic, "b", false)
+	if !ok || got.CorrelationData != "b" || !got.Correlated {
+		t.Fatalf("resolved %+v, %t; want correlated request b", got, ok)
+	}
+	if _, ok = MQTTPendingRequestsMapResolve("des", req.ResponseTopic, "b", false); ok {
+		t.Fatal("request b resolved twice")
+	}
+	if _, ok = MQTTPendingRequestsMapResolve("other", req.ResponseTopic, "a", false); ok {
+		t.Fatal("request resolved for a client that did not publish it")
+	}
+}
+
+func TestPendingRequestNotResolvedWithoutCorrelationOverMQTT5(t *testing.T) {
+	clearPendingRequests(t)
+	req := testPendingRequest("des", "a", time.Now())
+
+	if got, ok := MQTTPendingRequestsMapResolve("des", req.ResponseTopic, "", false); ok {
+		t.Fatalf("MQTT 5 message without correlation data resolved %+v", got)
+	}
+	if _, ok := MQTTPendingRequestsMapResolve("des", req.ResponseTopic, "unknown", true); ok {
+		t.Fatal("unknown correlation data fell back to a topic match")
+	}
+}
+
+func TestPendingRequestResolvedByTopicOverMQTT311(t *testing.T) {
+	clearPendingRequests(t)
+	now := time.Now()
+	testPendingRequest("des", "new", now)
+	testPendingRequest("des", "old", now.Add(-time.Second))
+
+	got, ok := MQTTPendingRequestsMapResolve("des", "C001/V001/SN0001/sig/config", "", true)
+	if !ok || got.CorrelationData != "old" {
+		t.Fatalf("resolved %+v, %t; want the oldest request", got, ok)
+	}
+	if got.Correlated {
+		t.Fatal("request matched by topic marked as correlated")
+	}
+}
+
+func TestValidateSRC_SIGChecksAddressUnlessCorrelated(t *testing.T) {
+	testDESDB(t, &DESError{})
+	dev := DESMessageSource{Time: time.Now().UTC().UnixMilli(), Addr: "SN0001", UserID: "SN0001"}
+
+	cases := []struct {
+		name string
+		req  *MQTTPendingRequest
+		addr string
+	}{
+		{"unsolicited", nil, dev.Addr},
+		{"matched by topic", &MQTTPendingRequest{Correlated: false}, dev.Addr},
+		{"correlated reply", &MQTTPendingRequest{Correlated: true}, "10.0.0.1"},
+	}
+	for _, c := range cases {
+		src := DESMessageSource{Time: dev.Time, Addr: "10.0.0.1", UserID: "user"}
+		if c.req != nil {
+			c.req.Replied = time.Now()
+			c.req.Deadline = c.req.Replied.Add(time.Second)
+		}
+		if err := src.ValidateSRC_SIG(dev, DEFAULT_TIME_POLICY, c.req, nil); err != nil {
+			t.Fatalf("%s: %s", c.name, err.Error())
+		}
+		if src.Addr != c.addr {
+			t.Errorf("%s: src.Addr = %s; want %s", c.name, src.Addr, c.addr)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+/* Data Exchange Server (DES) is a component of the Datacan Data2Desk (D2D) Platform.
+License:
+
+	[PROPER LEGALESE HERE...]
+
+	INTERIM LICENSE DESCRIPTION:
+	In spirit, this license:
+	1. Allows <Third Party> to use, modify, and / or distributre this software in perpetuity so long as <Third Party> understands:
+		a. The software is porvided as is without guarantee of additional support from DataCan in any form.
+		b. The software is porvided as is without guarantee of exclusivity.
+
+	2. Prohibits <Third Party> from taking any action which might interfere with DataCan's right to use, modify and / or distributre this software in perpetuity.
+*/
+
+package pkg
+
+import (
+	"time"
+)
+
+/*
+DEVICE TEST PROGRAMS
+
+AN ORDERED LIST OF STEPS RUN AGAINST A DEVICE BY THE DES; EACH STEP SETS THE DEVICE'S MODE / CONFIG
+AND ENDS ON A CONDITION ( DURATION, SSP, SCVF, PRESSURE )
+
+THE DESProgram RECORD HOLDS THE PROGRAM AND ITS PROGRESS SO THAT A RUNNING PROGRAM SURVIVES A DES RESTART
+STEPS AND THEIR EXECUTION ARE CLASS / VERSION SPECIFIC; SEE <class>/<version>/controller.program.go
+*/
+const PROG_STATUS_RUNNING = "running"
+const PROG_STATUS_PAUSED = "paused"
+const PROG_STATUS_COMPLETE = "complete"
+const PROG_STATUS_ABORTED = "aborted"
+const PROG_STATUS_FAILED = "failed" // A step timed out or could not be sent to the device
+
+type DESProgram struct {
+	DESProgID        int64  `gorm:"unique; primaryKey" json:"des_prog_id"`
+	DESProgRegTime   int64  `gorm:"not null" json:"des_prog_reg_time"`
+	DESProgRegAddr   string `gorm:"varchar(36)" json:"des_prog_reg_addr"`
+	DESProgRegUserID string `gorm:"not null; varchar(36)" json:"des_prog_reg_user_id"`
+
+	DESProgSerial  string `gorm:"not null; varchar(10)" json:"des_prog_serial"`
+	DESProgJobName string `gorm:"not null; varchar(24)" json:"des_prog_job_name"` // The program ends with this job
+	DESProgName    string `json:"des_prog_name"`
+	DESProgSteps   string `json:"des_prog_steps"` // JSON; class / version specific steps
+
+	DESProgStatus      string `json:"des_prog_status"`       // PROG_STATUS_...
+	DESProgStep        int    `json:"des_prog_step"`         // Index of the current step
+	DESProgStepStart   int64  `json:"des_prog_step_start"`   // When the current step started or was last resumed
+	DESProgStepElapsed int64  `json:"des_prog_step_elapsed"` // Milliseconds the current step ran before it was last paused
+	DESProgMsg         string `json:"des_prog_msg"`
+	DESProgUpdated     int64  `json:"des_prog_updated"`
+}
+
+func WriteDESProgram(prog *DESProgram) (err error) {
+	prog.DESProgUpdated = time.Now().UTC().UnixMilli()
+	res := DES.DB.Save(prog)
+	return res.Error
+}
+
+func GetDESProgram(id int64) (prog DESProgram, err error) {
+	res := DES.DB.First(&prog, id)
+	return prog, res.Error
+}
+
+/* RETURNS THE DEVICE'S PROGRAMS, NEWEST FIRST */
+func GetDESPrograms(serial string) (progs []DESProgram, err error) {
+	res := DES.DB.
+		Where("des_prog_serial = ?", serial).
+		Order("des_prog_reg_time DESC").
+		Find(&progs)
+	return progs, res.Error
+}
+
+/* RETURNS PROGRAMS WITH ANY OF THE GIVEN STATUSES, OLDEST FIRST */
+func GetDESProgramsByStatus(statuses ...string) (progs []DESProgram, err error) {
+	res := DES.DB.
+		Where("des_prog_status IN ?", statuses).
+		Order("des_prog_reg_time ASC").
+		Find(&progs)
+	return progs, res.Error
+}
+
+/* RETURNS TRUE WHERE THE PROGRAM IS RUNNING OR PAUSED */
+func (prog DESProgram) Active() bool {
+	return prog.DESProgStatus == PROG_STATUS_RUNNING || prog.DESProgStatus == PROG_STATUS_PAUSED
+}
+
+/* RETURNS THE MILLISECONDS THE CURRENT STEP HAS RUN, EXCLUDING TIME SPENT PAUSED */
+func (prog DESProgram) StepElapsed(now int64) int64 {
+	if prog.DESProgStatus != PROG_STATUS_RUNNING {
+		return prog.DESProgStepElapsed
+	}
+	return prog.DESProgStepElapsed + now - prog.DESProgStepStart
+}
@@ -0,0 +1,406 @@
+/* Data Exchange Server (DES) is a component of the Datacan Data2Desk (D2D) Platform.
+License:
+
+	[PROPER LEGALESE HERE...]
+
+	INTERIM LICENSE DESCRIPTION:
+	In spirit, this license:
+	1. Allows <Third Party> to use, modify, and / or distributre this software in perpetuity so long as <Third Party> understands:
+		a. The software is porvided as is without guarantee of additional support from DataCan in any form.
+		b. The software is porvided as is without guarantee of exclusivity.
+
+	2. Prohibits <Third Party> from taking any action which might interfere with DataCan's right to use, modify and / or distributre this software in perpetuity.
+*/
+
+package pkg
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+SIGNED DEVICE MESSAGES
+
+EACH DEVICE IS ISSUED AN ED25519 KEY PAIR AT REGISTRATION
+  - THE PRIVATE KEY IS DELIVERED IN THE DEVICE INITIALIZATION FILES; ONLY THE PUBLIC KEY IS STORED IN des_dev_keys
+  - THE DEVICE WRAPS EVERY SIGNAL IN A DESSignedMessage: { "seq": <seq>, "sig": <signature>, "body": <payload> }
+    ( OR ITS BINARY EQUIVALENT WHERE THE PAYLOAD IS BINARY; SEE SignDeviceMessage )
+  - THE SIGNATURE COVERS THE TOPIC, THE SEQUENCE AND THE BODY ( SEE SignedBytes )
+  - SEQUENCES MUST INCREASE; A MESSAGE IS ACCEPTED ONCE, AND ONLY WHERE IT IS NEWER THAN THE LAST
+    SIG_WINDOW SEQUENCES THE DES HAS SEEN ( MESSAGES ON DIFFERENT TOPICS MAY ARRIVE OUT OF ORDER )
+
+DEVICES REGISTERED BEFORE SIGNING WAS INTRODUCED HAVE NO KEY; THEIR UNSIGNED MESSAGES ARE ACCEPTED
+UNTIL A KEY IS ISSUED ( RE-REGISTRATION OR THE NEXT DEVICE INITIALIZATION FILES )
+*/
+const SIG_WINDOW = 64
+
+/*
+HOW OFTEN THE HIGHEST SEQUENCE RECEIVED FROM EACH DEVICE IS SAVED TO des_dev_keys ( SEE SaveDeviceSequences )
+
+MESSAGES RECEIVED IN THE LAST SIG_SEQ_SAVE_MS BEFORE THE DES STOPS MAY BE ACCEPTED AGAIN AFTER IT RESTARTS
+*/
+const SIG_SEQ_SAVE_MS = 5000
+
+const PEM_PRIVATE_KEY = "PRIVATE KEY"
+
+const SIG_BIN_HEADER_SIZE = 2 + 8 + ed25519.SignatureSize
+
+const ERR_SIG_MISSING string = "Device message is not signed"
+const ERR_SIG_NO_KEY string = "Device message is signed but no signing key was issued to this device"
+const ERR_SIG_INVALID string = "Device message signature is invalid"
+const ERR_SIG_REPLAY string = "Device message sequence was already received; duplicate or replay"
+const ERR_SIG_NOT_RECEIVED string = "Dead letter sequence was never received from the device"
+
+/* THE PUBLIC SIGNING KEY ISSUED TO A DEVICE, AND THE HIGHEST SEQUENCE RECEIVED */
+type DESDevKey struct {
+	DESDevKeyID      int64  `gorm:"unique; primaryKey" json:"des_dev_key_id"`
+	DESDevKeySerial  string `gorm:"not null; unique; varchar(10)" json:"des_dev_key_serial"`
+	DESDevKeyIssued  int64  `gorm:"not null" json:"des_dev_key_issued"`
+	DESDevKeyPublic  string `gorm:"not null" json:"des_dev_key_public"` // Base64 Ed25519 public key
+	DESDevKeyLastSeq int64  `json:"des_dev_key_last_seq"`
+}
+
+type DESSignedMessage struct {
+	Seq  int64           `json:"seq"`
+	Sig  string          `json:"sig"` // Base64 Ed25519 signature of SignedBytes( topic, seq, body )
+	Body json.RawMessage `json:"body"`
+}
+
+/* THE BYTES A DEVICE SIGNS: <topic>\n<seq>\n<body> */
+func SignedBytes(topic string, seq int64, body []byte) []byte {
+	b := bytes.Buffer{}
+	b.WriteString(topic)
+	b.WriteByte('\n')
+	b.WriteString(strconv.FormatInt(seq, 10))
+	b.WriteByte('\n')
+	b.Write(body)
+	return b.Bytes()
+}
+
+/* RETURNS THE SIGNED MESSAGE WHERE THE PAYLOAD IS A DESSignedMessage ( JSON OR BINARY ) */
+func ParseSignedMessage(payload []byte) (msg DESSignedMessage, signed bool) {
+
+	if IsBinaryPayload(payload) {
+		if payload[1] != BIN_SCHEMA_SIGNED || len(payload) <= SIG_BIN_HEADER_SIZE {
+			return msg, false
+		}
+		msg.Seq = int64(binary.LittleEndian.Uint64(payload[2:10]))
+		msg.Sig = base64.StdEncoding.EncodeToString(payload[10:SIG_BIN_HEADER_SIZE])
+		msg.Body = payload[SIG_BIN_HEADER_SIZE:]
+		return msg, true
+	}
+
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		return msg, false
+	}
+	return msg, msg.Sig != "" && len(msg.Body) > 0
+}
+
+/*
+	WRAPS THE BODY IN A DESSignedMessage
+
+A BINARY BODY IS WRAPPED IN A BINARY ENVELOPE:
+
+	[ BIN_MAGIC ][ BIN_SCHEMA_SIGNED ][ seq ( int64 LE ) ][ signature ( 64 ) ][ body ]
+*/
+func SignDeviceMessage(key ed25519.PrivateKey, topic string, seq int64, body []byte) (payload []byte, err error) {
+
+	sig := ed25519.Sign(key, SignedBytes(topic, seq, body))
+
+	if IsBinaryPayload(body) {
+		payload = append([]byte{BIN_MAGIC, BIN_SCHEMA_SIGNED}, binary.LittleEndian.AppendUint64(nil, uint64(seq))...)
+		payload = append(payload, sig...)
+		return append(payload, body...), nil
+	}
+
+	msg := DESSignedMessage{
+		Seq:  seq,
+		Sig:  base64.StdEncoding.EncodeToString(sig),
+		Body: body,
+	}
+	return json.Marshal(&msg)
+}
+
+/*
+	SIGNS MESSAGES ON BEHALF OF A DEVICE ( DEMO DEVICES )
+
+SEQUENCES ARE TAKEN FROM THE CLOCK ( MICROSECONDS ) SO THAT THEY KEEP INCREASING ACROSS RESTARTS
+*/
+type DESDevSigner struct {
+	Key ed25519.PrivateKey
+	seq int64
+	mux sync.Mutex
+}
+
+func (s *DESDevSigner) Sign(topic string, body []byte) (payload []byte, err error) {
+	s.mux.Lock()
+	seq := time.Now().UTC().UnixMicro()
+	if seq <= s.seq {
+		seq = s.seq + 1
+	}
+	s.seq = seq
+	s.mux.Unlock()
+	return SignDeviceMessage(s.Key, topic, seq, body)
+}
+
+/* DEVICE SIGNING KEYS **************************************************************************/
+
+/* THE PUBLIC KEY AND ANTI-REPLAY WINDOW OF A DEVICE; Public IS nil WHERE NO KEY WAS ISSUED */
+type desDevVerifier struct {
+	Public  ed25519.PublicKey
+	LastSeq int64
+	Window  uint64 // Bit n SET: LastSeq - n WAS RECEIVED
+	unsaved bool   // LastSeq HAS NOT BEEN SAVED TO des_dev_keys
+	mux     sync.Mutex
+}
+
+var DESDevVerifiers = make(map[string]*desDevVerifier)
+var DESDevVerifiersRWMutex = sync.RWMutex{}
+
+var sigSeqSaver sync.Once
+
+func desDevVerifiersMapRead(serial string) (v *desDevVerifier, ok bool) {
+	DESDevVerifiersRWMutex.RLock()
+	v, ok = DESDevVerifiers[serial]
+	DESDevVerifiersRWMutex.RUnlock()
+	return
+}
+func desDevVerifiersMapWrite(serial string, v *desDevVerifier) {
+	DESDevVerifiersRWMutex.Lock()
+	DESDevVerifiers[serial] = v
+	DESDevVerifiersRWMutex.Unlock()
+}
+
+/* RETURNS THE DEVICE'S VERIFIER; LOADED FROM des_dev_keys ON FIRST USE */
+func getDESDevVerifier(serial string) (v *desDevVerifier, err error) {
+
+	if v, ok := desDevVerifiersMapRead(serial); ok {
+		return v, nil
+	}
+
+	key := DESDevKey{}
+	res := DES.DB.Where("des_dev_key_serial = ?", serial).Limit(1).Find(&key)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	v = &desDevVerifier{}
+	if res.RowsAffected > 0 {
+		pub, err := base64.StdEncoding.DecodeString(key.DESDevKeyPublic)
+		if err != nil || len(pub) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("Invalid signing key for device %s", serial)
+		}
+		v.Public = ed25519.PublicKey(pub)
+		v.LastSeq = key.DESDevKeyLastSeq
+		if v.LastSeq > 0 {
+			v.Window = ^uint64(0) // What was received before the DES restarted is unknown
+		}
+	}
+	desDevVerifiersMapWrite(serial, v)
+	return
+}
+
+/* CREATES ( REPLACES ) THE DEVICE'S SIGNING KEY PAIR; RETURNS THE PRIVATE KEY, WHICH IS NOT STORED */
+func IssueDeviceSigningKey(serial string) (priv ed25519.PrivateKey, err error) {
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return
+	}
+
+	key := DESDevKey{}
+	if res := DES.DB.Where("des_dev_key_serial = ?", serial).Limit(1).Find(&key); res.Error != nil {
+		return nil, res.Error
+	}
+	key.DESDevKeySerial = serial
+	key.DESDevKeyIssued = time.Now().UTC().UnixMilli()
+	key.DESDevKeyPublic = base64.StdEncoding.EncodeToString(pub)
+	key.DESDevKeyLastSeq = 0
+	if res := DES.DB.Save(&key); res.Error != nil {
+		return nil, res.Error
+	}
+
+	desDevVerifiersMapWrite(serial, &desDevVerifier{Public: pub})
+	return
+}
+
+/* RETURNS TRUE WHERE A SIGNING KEY HAS BEEN ISSUED TO THE DEVICE */
+func DeviceSigningKeyIssued(serial string) bool {
+	v, err := getDESDevVerifier(serial)
+	return err == nil && v.Public != nil
+}
+
+/*
+		VERIFIES A MESSAGE RECEIVED FROM THE DEVICE ON topic AND RETURNS ITS BODY
+
+	  - THE SIGNATURE MUST BE VALID FOR THE DEVICE'S KEY
+	  - THE SEQUENCE MUST NOT HAVE BEEN RECEIVED BEFORE; THE HIGHEST SEQUENCE IS SAVED EVERY SIG_SEQ_SAVE_MS
+
+UNSIGNED MESSAGES ARE RETURNED AS IS WHERE NO KEY WAS ISSUED TO THE DEVICE
+*/
+func VerifyDeviceMessage(serial, topic string, payload []byte) (body []byte, err error) {
+
+	v, msg, err := checkDeviceMessage(serial, topic, payload)
+	if err != nil || v.Public == nil {
+		return msg.Body, err
+	}
+
+	sigSeqSaver.Do(func() {
+		go func() {
+			for range time.Tick(time.Millisecond * SIG_SEQ_SAVE_MS) {
+				SaveDeviceSequences()
+			}
+		}()
+	})
+
+	v.mux.Lock()
+	defer v.mux.Unlock()
+
+	switch diff := msg.Seq - v.LastSeq; {
+
+	case diff > 0: /* NEWER THAN ANY RECEIVED; SLIDE THE WINDOW */
+		if diff >= SIG_WINDOW {
+			v.Window = 1
+		} else {
+			v.Window = v.Window<<uint64(diff) | 1
+		}
+		v.LastSeq = msg.Seq
+		v.unsaved = true
+
+	case -diff < SIG_WINDOW && v.Window&(1<<uint64(-diff)) == 0: /* OUT OF ORDER, NOT YET RECEIVED */
+		v.Window |= 1 << uint64(-diff)
+
+	default:
+		return nil, fmt.Errorf("%s: seq %d", ERR_SIG_REPLAY, msg.Seq)
+	}
+
+	return msg.Body, nil
+}
+
+/* SAVES THE HIGHEST SEQUENCE OF EACH DEVICE THAT SENT A NEWER MESSAGE SINCE IT WAS LAST SAVED */
+func SaveDeviceSequences() {
+
+	DESDevVerifiersRWMutex.RLock()
+	verifiers := make(map[string]*desDevVerifier, len(DESDevVerifiers))
+	for serial, v := range DESDevVerifiers {
+		verifiers[serial] = v
+	}
+	DESDevVerifiersRWMutex.RUnlock()
+
+	for serial, v := range verifiers {
+
+		v.mux.Lock()
+		seq, unsaved := v.LastSeq, v.unsaved
+		v.unsaved = false
+		v.mux.Unlock()
+
+		/* A KEY ISSUED SINCE STARTS OVER; DON'T SAVE THE OLD KEY'S SEQUENCE */
+		if cur, ok := desDevVerifiersMapRead(serial); !unsaved || !ok || cur != v {
+			continue
+		}
+
+		res := DES.DB.Model(&DESDevKey{}).
+			Where("des_dev_key_serial = ?", serial).
+			Update("des_dev_key_last_seq", seq)
+		if res.Error != nil {
+			LogErr(res.Error)
+			v.mux.Lock()
+			v.unsaved = true
+			v.mux.Unlock()
+		}
+	}
+}
+
+/*
+	VERIFIES A DEAD LETTER BEING REPLAYED ( SEE ReplayDESDeadLetter ) AND RETURNS ITS BODY
+
+- A MESSAGE REFUSED AS A DUPLICATE ( ERR_SIG_REPLAY ) IS REFUSED AGAIN; ITS SEQUENCE WAS PROCESSED
+- A MESSAGE REFUSED BY THE SIGNATURE CHECK NEVER HAD ITS SEQUENCE RECORDED; IT IS VERIFIED AS IF NEW ( VerifyDeviceMessage )
+- ANY OTHER DEAD LETTER WAS REFUSED AFTER ITS SEQUENCE WAS RECORDED; THE SIGNATURE MUST BE VALID AND THE SEQUENCE MUST HAVE BEEN RECEIVED
+*/
+func VerifyDeviceReplay(serial string, dl DESDeadLetter) (body []byte, err error) {
+
+	switch {
+	case strings.HasPrefix(dl.DESDeadReason, ERR_SIG_REPLAY):
+		return nil, fmt.Errorf("%s", dl.DESDeadReason)
+
+	case dl.DESDeadReason == ERR_SIG_MISSING,
+		dl.DESDeadReason == ERR_SIG_NO_KEY,
+		dl.DESDeadReason == ERR_SIG_INVALID:
+		return VerifyDeviceMessage(serial, dl.DESDeadTopic, dl.DESDeadPayload)
+	}
+
+	v, msg, err := checkDeviceMessage(serial, dl.DESDeadTopic, dl.DESDeadPayload)
+	if err != nil || v.Public == nil {
+		return msg.Body, err
+	}
+
+	v.mux.Lock()
+	defer v.mux.Unlock()
+
+	if !v.received(msg.Seq) {
+		return nil, fmt.Errorf("%s: seq %d", ERR_SIG_NOT_RECEIVED, msg.Seq)
+	}
+	return msg.Body, nil
+}
+
+/* RETURNS TRUE WHERE seq WAS RECEIVED; SEQUENCES OLDER THAN THE WINDOW ARE TREATED AS RECEIVED; CALLER MUST HOLD v.mux */
+func (v *desDevVerifier) received(seq int64) bool {
+	diff := v.LastSeq - seq
+	return diff >= 0 && (diff >= SIG_WINDOW || v.Window&(1<<uint64(diff)) != 0)
+}
+
+/*
+	RETURNS THE BODY OF A MESSAGE PUBLISHED ON ONE OF THE DEVICE'S TOPICS, WITHOUT CHECKING ITS SEQUENCE
+
+FOR CLIENTS THAT OBSERVE DEVICE MESSAGES; ONLY THE DES DEVICE CLIENT CALLS VerifyDeviceMessage.
+UNSIGNED MESSAGES ( INCLUDING COMMANDS ) ARE RETURNED AS IS
+*/
+func OpenDeviceMessage(serial, topic string, payload []byte) (body []byte, err error) {
+
+	msg, signed := ParseSignedMessage(payload)
+	if !signed {
+		return payload, nil
+	}
+	_, msg, err = checkDeviceMessage(serial, topic, payload)
+	return msg.Body, err
+}
+
+/* CHECKS THE SIGNATURE; msg.Body IS THE PAYLOAD WHERE THE MESSAGE IS UNSIGNED AND NO KEY WAS ISSUED */
+func checkDeviceMessage(serial, topic string, payload []byte) (v *desDevVerifier, msg DESSignedMessage, err error) {
+
+	if v, err = getDESDevVerifier(serial); err != nil {
+		return
+	}
+
+	msg, signed := ParseSignedMessage(payload)
+	switch {
+	case !signed && v.Public == nil:
+		msg = DESSignedMessage{Body: payload}
+		return
+
+	case !signed:
+		err = fmt.Errorf("%s", ERR_SIG_MISSING)
+		return
+
+	case v.Public == nil:
+		err = fmt.Errorf("%s", ERR_SIG_NO_KEY)
+		return
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(msg.Sig)
+	if err != nil || !ed25519.Verify(v.Public, SignedBytes(topic, msg.Seq, msg.Body), sig) {
+		err = fmt.Errorf("%s", ERR_SIG_INVALID)
+	}
+	return
+}
@@ -0,0 +1,138 @@
+package pkg
+
+import (
+	"crypto/ed25519"
+	"strings"
+	"testing"
+)
+
+const testSigTopic = "C001/V001/SN0001/sig/event"
+
+/* ISSUES A SIGNING KEY TO serial; THE SEQUENCE SAVER IS NOT STARTED ( SaveDeviceSequences IS CALLED BY THE TEST ) */
+func testSigningKey(t *testing.T, serial string) ed25519.PrivateKey {
+	t.Helper()
+	testDESDB(t, &DESDevKey{}, &DESError{})
+	sigSeqSaver.Do(func() {})
+	t.Cleanup(func() {
+		DESDevVerifiersRWMutex.Lock()
+		DESDevVerifiers = make(map[string]*desDevVerifier)
+		DESDevVerifiersRWMutex.Unlock()
+	})
+	priv, err := IssueDeviceSigningKey(serial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return priv
+}
+
+func testVerify(t *testing.T, priv ed25519.PrivateKey, seq int64) error {
+	t.Helper()
+	payload, err := SignDeviceMessage(priv, testSigTopic, seq, []byte(`{"evt_code":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = VerifyDeviceMessage("SN0001", testSigTopic, payload)
+	return err
+}
+
+func TestVerifyDeviceMessageWindow(t *testing.T) {
+	priv := testSigningKey(t, "SN0001")
+
+	for _, c := range []struct {
+		seq int64
+		ok  bool
+	}{
+		{100, true},
+		{100, false}, // Duplicate
+		{102, true},
+		{101, true}, // Out of order, not yet received
+		{101, false},
+		{102 - SIG_WINDOW + 1, true}, // Oldest in the window
+		{102 - SIG_WINDOW, false},    // Older than the window
+		{102 + SIG_WINDOW, true},     // Slides the whole window
+		{102, false},
+		{102 + SIG_WINDOW - 1, true},
+	} {
+		err := testVerify(t, priv, c.seq)
+		if (err == nil) != c.ok {
+			t.Fatalf("seq %d: error %v; want ok = %t", c.seq, err, c.ok)
+		}
+		if err != nil && !strings.HasPrefix(err.Error(), ERR_SIG_REPLAY) {
+			t.Fatalf("seq %d: %s; want %s", c.seq, err.Error(), ERR_SIG_REPLAY)
+		}
+	}
+}
+
+func TestVerifyDeviceMessageRefusesForgedAndUnsigned(t *testing.T) {
+	testSigningKey(t, "SN0001")
+	_, forged, _ := ed25519.GenerateKey(nil)
+
+	if err := testVerify(t, forged, 1); err == nil || err.Error() != ERR_SIG_INVALID {
+		t.Fatalf("forged message: %v; want %s", err, ERR_SIG_INVALID)
+	}
+	if _, err := VerifyDeviceMessage("SN0001", testSigTopic, []byte(`{"evt_code":1}`)); err == nil || err.Error() != ERR_SIG_MISSING {
+		t.Fatalf("unsigned message: %v; want %s", err, ERR_SIG_MISSING)
+	}
+}
+
+func TestVerifyDeviceMessageAfterRestart(t *testing.T) {
+	priv := testSigningKey(t, "SN0001")
+	for _, seq := range []int64{10, 12} {
+		if err := testVerify(t, priv, seq); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	/* NOTHING IS SAVED UNTIL SaveDeviceSequences RUNS */
+	key := DESDevKey{}
+	DES.DB.Where("des_dev_key_serial = ?", "SN0001").First(&key)
+	if key.DESDevKeyLastSeq != 0 {
+		t.Fatalf("last seq %d saved per message", key.DESDevKeyLastSeq)
+	}
+	SaveDeviceSequences()
+	DES.DB.Where("des_dev_key_serial = ?", "SN0001").First(&key)
+	if key.DESDevKeyLastSeq != 12 {
+		t.Fatalf("saved last seq %d; want 12", key.DESDevKeyLastSeq)
+	}
+
+	/* THE DES RESTARTS; WHAT WAS RECEIVED AT OR BELOW THE SAVED SEQUENCE IS UNKNOWN, SO ALL OF IT IS REFUSED */
+	DESDevVerifiersRWMutex.Lock()
+	DESDevVerifiers = make(map[string]*desDevVerifier)
+	DESDevVerifiersRWMutex.Unlock()
+
+	for _, c := range []struct {
+		seq int64
+		ok  bool
+	}{
+		{11, false}, // Never received, but no longer known
+		{12, false},
+		{14, true},
+		{13, true}, // Above the saved sequence; not yet received
+		{13, false},
+	} {
+		if err := testVerify(t, priv, c.seq); (err == nil) != c.ok {
+			t.Fatalf("seq %d: error %v; want ok = %t", c.seq, err, c.ok)
+		}
+	}
+}
+
+func TestSaveDeviceSequencesSkipsReissuedKeys(t *testing.T) {
+	priv := testSigningKey(t, "SN0001")
+	if err := testVerify(t, priv, 50); err != nil {
+		t.Fatal(err)
+	}
+	v, _ := desDevVerifiersMapRead("SN0001")
+
+	/* A NEW KEY IS ISSUED BEFORE THE OLD KEY'S SEQUENCE IS SAVED */
+	if _, err := IssueDeviceSigningKey("SN0001"); err != nil {
+		t.Fatal(err)
+	}
+	desDevVerifiersMapWrite("SN0002", v)
+	SaveDeviceSequences()
+
+	key := DESDevKey{}
+	DES.DB.Where("des_dev_key_serial = ?", "SN0001").First(&key)
+	if key.DESDevKeyLastSeq != 0 {
+		t.Fatalf("new key's last seq %d; want 0", key.DESDevKeyLastSeq)
+	}
+}
@@ -0,0 +1,130 @@
+/* Data Exchange Server (DES) is a component of the Datacan Data2Desk (D2D) Platform.
+License:
+
+	[PROPER LEGALESE HERE...]
+
+	INTERIM LICENSE DESCRIPTION:
+	In spirit, this license:
+	1. Allows <Third Party> to use, modify, and / or distributre this software in perpetuity so long as <Third Party> understands:
+		a. The software is porvided as is without guarantee of additional support from DataCan in any form.
+		b. The software is porvided as is without guarantee of exclusivity.
+
+	2. Prohibits <Third Party> from taking any action which might interfere with DataCan's right to use, modify and / or distributre this software in perpetuity.
+*/
+
+package pkg
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+/*
+CONFIGURATION TEMPLATES
+
+NAMED, PARTIAL ADMIN / CONFIG / HEADER SETTINGS SHARED BY AN ORGANIZATION;
+APPLIED WHEN STARTING A JOB OR TO A RUNNING DEVICE
+
+A TEMPLATE'S ORGANIZATION IS THAT OF THE ACCOUNT WHICH SAVED IT ( SEE GetUserOrg );
+ONLY USERS OF THE SAME ORGANIZATION CAN SEE OR APPLY IT
+
+EACH SAVE UNDER AN EXISTING ORGANIZATION / NAME CREATES THE NEXT VERSION; OLD VERSIONS ARE KEPT
+THE SETTINGS AND THEIR VALIDATION ARE CLASS / VERSION SPECIFIC; SEE <class>/<version>/controller.template.go
+*/
+type DESTemplate struct {
+	DESTplID        int64  `gorm:"unique; primaryKey" json:"des_tpl_id"`
+	DESTplRegTime   int64  `gorm:"not null" json:"des_tpl_reg_time"`
+	DESTplRegAddr   string `gorm:"varchar(36)" json:"des_tpl_reg_addr"`
+	DESTplRegUserID string `gorm:"not null; varchar(36)" json:"des_tpl_reg_user_id"`
+
+	DESTplOrg      string `gorm:"not null; varchar(32); uniqueIndex:idx_des_tpl_version" json:"des_tpl_org"`
+	DESTplName     string `gorm:"not null; varchar(32); uniqueIndex:idx_des_tpl_version" json:"des_tpl_name"`
+	DESTplVersion  int    `gorm:"not null; uniqueIndex:idx_des_tpl_version" json:"des_tpl_version"` // 1 = first save
+	DESTplDesc     string `json:"des_tpl_desc"`
+	DESTplClass    string `gorm:"not null; varchar(3)" json:"des_tpl_class"`
+	DESTplDevVer   string `gorm:"not null; varchar(3)" json:"des_tpl_dev_ver"`
+	DESTplSettings string `json:"des_tpl_settings"` // JSON; class / version specific
+	DESTplSource   string `json:"des_tpl_source"`   // The job it was saved from, if any
+}
+
+const DES_TPL_WRITE_ATTEMPTS = 5 // Saves of the same organization / name racing for the next version
+
+/*
+	WRITES THE TEMPLATE AS THE NEXT VERSION OF ITS ORGANIZATION / NAME
+
+WHERE ANOTHER SAVE TAKES THE VERSION FIRST ( idx_des_tpl_version ), RETRIES WITH THE VERSION AFTER IT
+*/
+func WriteDESTemplate(tpl *DESTemplate) (err error) {
+
+	if tpl.DESTplOrg == "" || tpl.DESTplName == "" {
+		return fmt.Errorf("Templates require an organization and a name")
+	}
+
+	for i := 0; i < DES_TPL_WRITE_ATTEMPTS; i++ {
+
+		last := DESTemplate{}
+		res := DES.DB.
+			Where("des_tpl_org = ? AND des_tpl_name = ?", tpl.DESTplOrg, tpl.DESTplName).
+			Order("des_tpl_version DESC").
+			Limit(1).
+			Find(&last)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected > 0 && (last.DESTplClass != tpl.DESTplClass || last.DESTplDevVer != tpl.DESTplDevVer) {
+			return fmt.Errorf("Template %s / %s belongs to device class %s version %s",
+				tpl.DESTplOrg, tpl.DESTplName, last.DESTplClass, last.DESTplDevVer)
+		}
+
+		tpl.DESTplID = 0
+		tpl.DESTplVersion = last.DESTplVersion + 1
+		tpl.DESTplRegTime = time.Now().UTC().UnixMilli()
+		if err = DES.DB.Create(tpl).Error; err == nil || !isUniqueViolation(err) {
+			return
+		}
+	}
+	return fmt.Errorf("Template %s / %s: version %d was taken by another save; try again",
+		tpl.DESTplOrg, tpl.DESTplName, tpl.DESTplVersion)
+}
+
+/* RETURNS TRUE WHERE THE WRITE FAILED ON A UNIQUE INDEX ( POSTGRES OR SQLITE ) */
+func isUniqueViolation(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "duplicate key value violates unique") ||
+		strings.Contains(msg, "UNIQUE constraint failed")
+}
+
+func GetDESTemplate(id int64) (tpl DESTemplate, err error) {
+	res := DES.DB.First(&tpl, id)
+	return tpl, res.Error
+}
+
+/* RETURNS THE LATEST VERSION OF EACH OF THE ORGANIZATION'S TEMPLATES, BY NAME */
+func GetDESTemplates(org string) (tpls []DESTemplate, err error) {
+
+	all := []DESTemplate{}
+	res := DES.DB.
+		Where("des_tpl_org = ?", org).
+		Order("des_tpl_name ASC, des_tpl_version DESC").
+		Find(&all)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	for _, tpl := range all {
+		if len(tpls) == 0 || tpls[len(tpls)-1].DESTplName != tpl.DESTplName {
+			tpls = append(tpls, tpl)
+		}
+	}
+	return
+}
+
+/* RETURNS EVERY VERSION OF THE TEMPLATE, NEWEST FIRST */
+func GetDESTemplateVersions(org, name string) (tpls []DESTemplate, err error) {
+	res := DES.DB.
+		Where("des_tpl_org = ? AND des_tpl_name = ?", org, name).
+		Order("des_tpl_version DESC").
+		Find(&tpls)
+	return tpls, res.Error
+}
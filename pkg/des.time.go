@@ -0,0 +1,205 @@
+/* Data Exchange Server (DES) is a component of the Datacan Data2Desk (D2D) Platform.
+License:
+
+	[PROPER LEGALESE HERE...]
+
+	INTERIM LICENSE DESCRIPTION:
+	In spirit, this license:
+	1. Allows <Third Party> to use, modify, and / or distributre this software in perpetuity so long as <Third Party> understands:
+		a. The software is porvided as is without guarantee of additional support from DataCan in any form.
+		b. The software is porvided as is without guarantee of exclusivity.
+
+	2. Prohibits <Third Party> from taking any action which might interfere with DataCan's right to use, modify and / or distributre this software in perpetuity.
+*/
+
+package pkg
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+/*
+MESSAGE TIME POLICY
+
+THE TIME OF EACH DEVICE SIGNAL, SAMPLE AND USER COMMAND ( DESMessageSource.Time, Sample.SmpTime ) MUST FALL WITHIN
+[ server time - PastMS, server time + FutureMS ] AND NOT BEFORE MIN_TIME; WHERE IT DOES NOT, THE POLICY ACTION IS TAKEN:
+  - TIME_ACTION_REJECT:  THE MESSAGE IS REFUSED ( ERR_SRC_TIME_PAST / ERR_SRC_TIME_FUTURE )
+  - TIME_ACTION_CLAMP:   THE TIME IS MOVED TO THE NEAREST EDGE OF THE WINDOW
+  - TIME_ACTION_RESTAMP: THE TIME IS REPLACED WITH THE SERVER TIME
+
+PastMS = 0 LEAVES ONLY THE MIN_TIME BOUND
+
+DEFAULT_TIME_POLICY ACCEPTS WHAT WAS ACCEPTED BEFORE POLICIES EXISTED: ANY TIME AFTER MIN_TIME, UP TO A YEAR AHEAD;
+SET A TIGHTER POLICY FOR THE CLASS / VERSION TO REFUSE DEVICES WITH A DRIFTING CLOCK
+
+EACH DEVICE CLASS / VERSION HAS ITS OWN POLICY ( DEFAULT_TIME_POLICY UNTIL SET ), STORED IN des_time_policies;
+EVERY MESSAGE OUTSIDE THE WINDOW IS COUNTED IN DESTimeStats
+*/
+const TIME_ACTION_REJECT = "reject"
+const TIME_ACTION_CLAMP = "clamp"
+const TIME_ACTION_RESTAMP = "restamp"
+
+const MIN_TIME int64 = 946684800000 // 2000-01-01T00:00:00Z, Unix milli
+
+const ERR_TIME_POLICY_ACTION string = "Time policy action must be one of: reject, clamp, restamp"
+const ERR_TIME_POLICY_WINDOW string = "Time policy future tolerance must be greater than 0; past tolerance must be 0 ( none ) or greater"
+
+type DESTimePolicy struct {
+	DESTimeID       int64  `gorm:"unique; primaryKey" json:"des_time_id"`
+	DESTimeClass    string `gorm:"not null; varchar(3)" json:"des_time_class"`
+	DESTimeVersion  string `gorm:"not null; varchar(3)" json:"des_time_version"`
+	DESTimePastMS   int64  `json:"des_time_past_ms"`   // How far behind server time a message may be; 0: any time after MIN_TIME
+	DESTimeFutureMS int64  `json:"des_time_future_ms"` // How far ahead of server time a message may be
+	DESTimeAction   string `json:"des_time_action"`    // TIME_ACTION_...
+}
+
+var DEFAULT_TIME_POLICY = DESTimePolicy{
+	DESTimePastMS:   0,
+	DESTimeFutureMS: 365 * 24 * time.Hour.Milliseconds(),
+	DESTimeAction:   TIME_ACTION_REJECT,
+}
+
+/* MESSAGES OUTSIDE THE WINDOW, BY DEVICE CLASS / VERSION, SINCE Since */
+type DESTimeStats struct {
+	Since     int64 `json:"since"`
+	Past      int64 `json:"past"`   // Older than the window
+	Future    int64 `json:"future"` // Newer than the window
+	Rejected  int64 `json:"rejected"`
+	Clamped   int64 `json:"clamped"`
+	Restamped int64 `json:"restamped"`
+	Last      int64 `json:"last"` // Server time of the last message outside the window
+}
+
+var TimePolicies = make(map[string]DESTimePolicy)
+var TimeStats = make(map[string]DESTimeStats)
+var TimePoliciesRWMutex = sync.RWMutex{}
+
+/* RETURNS THE POLICY OF THE DEVICE CLASS / VERSION; LOADED FROM des_time_policies ON FIRST USE */
+func GetTimePolicy(class, version string) (p DESTimePolicy) {
+
+	key := DeviceClassKey(class, version)
+	TimePoliciesRWMutex.RLock()
+	p, ok := TimePolicies[key]
+	TimePoliciesRWMutex.RUnlock()
+	if ok {
+		return
+	}
+
+	p = DEFAULT_TIME_POLICY
+	if DES.DB != nil {
+		rec := DESTimePolicy{}
+		res := DES.DB.Where("des_time_class = ? AND des_time_version = ?", class, version).Limit(1).Find(&rec)
+		if res.Error != nil {
+			LogErr(res.Error)
+		} else if res.RowsAffected > 0 {
+			p = rec
+		}
+	}
+	p.DESTimeClass, p.DESTimeVersion = class, version
+
+	TimePoliciesRWMutex.Lock()
+	TimePolicies[key] = p
+	TimePoliciesRWMutex.Unlock()
+	return
+}
+
+/* VALIDATES AND STORES THE POLICY OF p.DESTimeClass / p.DESTimeVersion */
+func SetTimePolicy(p DESTimePolicy) (out DESTimePolicy, err error) {
+
+	if _, err = GetDeviceClass(p.DESTimeClass, p.DESTimeVersion); err != nil {
+		return
+	}
+	switch p.DESTimeAction {
+	case TIME_ACTION_REJECT, TIME_ACTION_CLAMP, TIME_ACTION_RESTAMP:
+	default:
+		return out, fmt.Errorf("%s", ERR_TIME_POLICY_ACTION)
+	}
+	if p.DESTimePastMS < 0 || p.DESTimeFutureMS <= 0 {
+		return out, fmt.Errorf("%s", ERR_TIME_POLICY_WINDOW)
+	}
+
+	rec := DESTimePolicy{}
+	res := DES.DB.Where("des_time_class = ? AND des_time_version = ?", p.DESTimeClass, p.DESTimeVersion).Limit(1).Find(&rec)
+	if res.Error != nil {
+		return out, res.Error
+	}
+	p.DESTimeID = rec.DESTimeID
+	if res = DES.DB.Save(&p); res.Error != nil {
+		return out, res.Error
+	}
+
+	TimePoliciesRWMutex.Lock()
+	TimePolicies[DeviceClassKey(p.DESTimeClass, p.DESTimeVersion)] = p
+	TimePoliciesRWMutex.Unlock()
+	return p, nil
+}
+
+/* RETURNS THE COUNTERS OF THE DEVICE CLASS / VERSION */
+func GetTimeStats(class, version string) (stats DESTimeStats) {
+	TimePoliciesRWMutex.RLock()
+	stats = TimeStats[DeviceClassKey(class, version)]
+	TimePoliciesRWMutex.RUnlock()
+	return
+}
+
+/* CLEARS THE COUNTERS OF THE DEVICE CLASS / VERSION */
+func ResetTimeStats(class, version string) {
+	TimePoliciesRWMutex.Lock()
+	TimeStats[DeviceClassKey(class, version)] = DESTimeStats{Since: time.Now().UTC().UnixMilli()}
+	TimePoliciesRWMutex.Unlock()
+}
+
+/*
+	APPLIES THE POLICY TO A MESSAGE TIME ( UNIX MILLI )
+
+RETURNS THE TIME TO USE; err WHERE THE TIME IS OUTSIDE THE WINDOW AND THE POLICY IS TIME_ACTION_REJECT
+*/
+func (p DESTimePolicy) Apply(t int64) (out int64, err error) {
+
+	now := time.Now().UTC().UnixMilli()
+	min := MIN_TIME
+	if p.DESTimePastMS > 0 && now-p.DESTimePastMS > min {
+		min = now - p.DESTimePastMS
+	}
+	max := now + p.DESTimeFutureMS
+
+	stats := DESTimeStats{}
+	switch {
+	case t < min:
+		stats.Past, out, err = 1, min, fmt.Errorf("%s: %d", ERR_SRC_TIME_PAST, t)
+	case t > max:
+		stats.Future, out, err = 1, max, fmt.Errorf("%s: %d", ERR_SRC_TIME_FUTURE, t)
+	default:
+		return t, nil
+	}
+
+	switch p.DESTimeAction {
+	case TIME_ACTION_CLAMP:
+		stats.Clamped, err = 1, nil
+	case TIME_ACTION_RESTAMP:
+		stats.Restamped, out, err = 1, now, nil
+	default:
+		stats.Rejected, out = 1, t
+	}
+	p.countTimeStats(stats, now)
+	return
+}
+
+func (p DESTimePolicy) countTimeStats(add DESTimeStats, now int64) {
+	key := DeviceClassKey(p.DESTimeClass, p.DESTimeVersion)
+	TimePoliciesRWMutex.Lock()
+	stats := TimeStats[key]
+	if stats.Since == 0 {
+		stats.Since = now
+	}
+	stats.Past += add.Past
+	stats.Future += add.Future
+	stats.Rejected += add.Rejected
+	stats.Clamped += add.Clamped
+	stats.Restamped += add.Restamped
+	stats.Last = now
+	TimeStats[key] = stats
+	TimePoliciesRWMutex.Unlock()
+}
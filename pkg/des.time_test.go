@@ -0,0 +1,55 @@
+package pkg
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDefaultTimePolicyKeepsTheOldRule(t *testing.T) {
+	now := time.Now().UTC()
+	p := DEFAULT_TIME_POLICY
+	p.DESTimeClass, p.DESTimeVersion = "999", "001"
+
+	for _, c := range []struct {
+		name string
+		t    int64
+		ok   bool
+	}{
+		{"now", now.UnixMilli(), true},
+		{"11 months ahead", now.AddDate(0, 11, 0).UnixMilli(), true},
+		{"2 years ahead", now.AddDate(2, 0, 0).UnixMilli(), false},
+		{"10 years ago", now.AddDate(-10, 0, 0).UnixMilli(), true},
+		{"before MIN_TIME", MIN_TIME - 1, false},
+	} {
+		if _, err := p.Apply(c.t); (err == nil) != c.ok {
+			t.Errorf("%s: error %v; want ok = %t", c.name, err, c.ok)
+		}
+	}
+}
+
+func TestTimePolicyActions(t *testing.T) {
+	now := time.Now().UTC().UnixMilli()
+	ahead := now + time.Hour.Milliseconds()
+	p := DESTimePolicy{DESTimeClass: "999", DESTimeVersion: "001", DESTimeFutureMS: time.Minute.Milliseconds()}
+	ResetTimeStats(p.DESTimeClass, p.DESTimeVersion)
+
+	p.DESTimeAction = TIME_ACTION_REJECT
+	if _, err := p.Apply(ahead); err == nil {
+		t.Fatal("time an hour ahead accepted")
+	}
+
+	p.DESTimeAction = TIME_ACTION_CLAMP
+	if out, err := p.Apply(ahead); err != nil || out < now+p.DESTimeFutureMS || out >= ahead {
+		t.Fatalf("clamped to %d, %v; want the edge of the window", out, err)
+	}
+
+	p.DESTimeAction = TIME_ACTION_RESTAMP
+	if out, err := p.Apply(ahead); err != nil || out < now || out > now+p.DESTimeFutureMS {
+		t.Fatalf("restamped to %d, %v; want the server time", out, err)
+	}
+
+	stats := GetTimeStats(p.DESTimeClass, p.DESTimeVersion)
+	if stats.Future != 3 || stats.Rejected != 1 || stats.Clamped != 1 || stats.Restamped != 1 {
+		t.Fatalf("stats %+v", stats)
+	}
+}
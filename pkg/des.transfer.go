@@ -0,0 +1,239 @@
+/* Data Exchange Server (DES) is a component of the Datacan Data2Desk (D2D) Platform.
+License:
+
+	[PROPER LEGALESE HERE...]
+
+	INTERIM LICENSE DESCRIPTION:
+	In spirit, this license:
+	1. Allows <Third Party> to use, modify, and / or distributre this software in perpetuity so long as <Third Party> understands:
+		a. The software is porvided as is without guarantee of additional support from DataCan in any form.
+		b. The software is porvided as is without guarantee of exclusivity.
+
+	2. Prohibits <Third Party> from taking any action which might interfere with DataCan's right to use, modify and / or distributre this software in perpetuity.
+*/
+
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+/*
+DEVICE TRANSFER BETWEEN DATA EXCHANGE SERVERS
+
+EACH DES RECORDS ITS SIDE OF A TRANSFER IN A DESDevTransfer
+  - out: THIS DES IS HANDING THE DEVICE TO A PEER DES
+  - in: A PEER DES IS HANDING THE DEVICE TO THIS DES
+
+WHILE A DEVICE IS AWAY ( SEE DESDevsAway ) THIS DES DOES NOT CONNECT ITS DEVICE CLIENT
+THE WORKFLOW IS CLASS / VERSION SPECIFIC; SEE <class>/<version>/controller.transfer.go
+*/
+const DEV_XFER_OUT = "out"
+const DEV_XFER_IN = "in"
+
+const DEV_XFER_STATUS_PREPARED = "prepared"       // in: Registered here; waiting for the device
+const DEV_XFER_STATUS_REQUESTED = "requested"     // out: New broker sent to the device; waiting for the peer to confirm
+const DEV_XFER_STATUS_REGISTERED = "registered"   // Device has reported OP_CODE_DES_REGISTERED to the receiving DES
+const DEV_XFER_STATUS_EXPORTING = "exporting"     // out: Job databases are being sent to the peer
+const DEV_XFER_STATUS_COMPLETE = "complete"       // The receiving DES owns the device
+const DEV_XFER_STATUS_ROLLED_BACK = "rolled_back" // The device never reached the receiving DES; it remains with the sending DES
+
+const DEV_XFER_TIMEOUT_SEC int64 = 600 // Default time allowed for the device to reach the receiving DES
+const DEV_XFER_POLL_MS = 5000          // Interval at which the sending DES asks the peer for the device
+
+type DESDevTransfer struct {
+	DESDevXferID        int64  `gorm:"unique; primaryKey" json:"des_dev_xfer_id"`
+	DESDevXferRegTime   int64  `gorm:"not null" json:"des_dev_xfer_reg_time"`
+	DESDevXferRegAddr   string `gorm:"varchar(36)" json:"des_dev_xfer_reg_addr"`
+	DESDevXferRegUserID string `gorm:"not null; varchar(36)" json:"des_dev_xfer_reg_user_id"`
+
+	DESDevXferSerial   string `gorm:"not null; varchar(10)" json:"des_dev_xfer_serial"`
+	DESDevXferDir      string `gorm:"not null; varchar(3)" json:"des_dev_xfer_dir"` // DEV_XFER_OUT / DEV_XFER_IN
+	DESDevXferPeerAPI  string `json:"des_dev_xfer_peer_api"`                        // out: The receiving DES API; ie: https://des2.example.com/api
+	DESDevXferPeerKey  string `json:"-"`                                            // out: Bearer token for the receiving DES API
+	DESDevXferHost     string `json:"des_dev_xfer_host"`                            // Receiving DES broker host sent to the device
+	DESDevXferPort     int32  `json:"des_dev_xfer_port"`                            // Receiving DES broker port sent to the device
+	DESDevXferDeadline int64  `json:"des_dev_xfer_deadline"`                        // Roll back where the device has not registered by this time
+	DESDevXferStatus   string `json:"des_dev_xfer_status"`                          // DEV_XFER_STATUS_...
+	DESDevXferJobs     int    `json:"des_dev_xfer_jobs"`                            // Job databases exported / imported
+	DESDevXferMsg      string `json:"des_dev_xfer_msg"`
+	DESDevXferUpdated  int64  `json:"des_dev_xfer_updated"`
+}
+
+func WriteDESDevTransfer(xfer *DESDevTransfer) (err error) {
+	xfer.DESDevXferUpdated = time.Now().UTC().UnixMilli()
+	res := DES.DB.Save(xfer)
+	return res.Error
+}
+
+func GetDESDevTransfer(id int64) (xfer DESDevTransfer, err error) {
+	res := DES.DB.First(&xfer, id)
+	return xfer, res.Error
+}
+
+/* RETURNS THE DEVICE'S TRANSFER HISTORY ON THIS DES, NEWEST FIRST */
+func GetDESDevTransfers(serial string) (xfers []DESDevTransfer, err error) {
+	res := DES.DB.
+		Where("des_dev_xfer_serial = ?", serial).
+		Order("des_dev_xfer_reg_time DESC").
+		Find(&xfers)
+	return xfers, res.Error
+}
+
+/* RETURNS THE DEVICE'S LATEST TRANSFER IN THE GIVEN DIRECTION; DESDevXferID = 0 WHERE THERE IS NONE */
+func GetLatestDESDevTransfer(serial, dir string) (xfer DESDevTransfer, err error) {
+	res := DES.DB.
+		Where("des_dev_xfer_serial = ? AND des_dev_xfer_dir = ?", serial, dir).
+		Order("des_dev_xfer_reg_time DESC").
+		Limit(1).
+		Find(&xfer)
+	return xfer, res.Error
+}
+
+/* RETURNS TRANSFERS IN THE GIVEN DIRECTION WITH ANY OF THE GIVEN STATUSES */
+func GetDESDevTransfersByStatus(dir string, statuses ...string) (xfers []DESDevTransfer, err error) {
+	res := DES.DB.
+		Where("des_dev_xfer_dir = ? AND des_dev_xfer_status IN ?", dir, statuses).
+		Order("des_dev_xfer_reg_time ASC").
+		Find(&xfers)
+	return xfers, res.Error
+}
+
+/* RETURNS TRUE WHERE THE TRANSFER HAS NOT YET COMPLETED OR ROLLED BACK */
+func (xfer DESDevTransfer) Pending() bool {
+	return xfer.DESDevXferID != 0 &&
+		xfer.DESDevXferStatus != DEV_XFER_STATUS_COMPLETE &&
+		xfer.DESDevXferStatus != DEV_XFER_STATUS_ROLLED_BACK
+}
+
+/*
+	RETURNS THE SERIALS OF DEVICES REGISTERED HERE THAT THIS DES DOES NOT CURRENTLY OPERATE
+
+BY THE DEVICE'S LATEST TRANSFER:
+  - out, COMPLETE: THE DEVICE NOW BELONGS TO ANOTHER DES
+  - in, ROLLED BACK: THE DEVICE NEVER ARRIVED; IT REMAINS WITH THE SENDING DES
+*/
+func DESDevsAway() (serials []string, err error) {
+
+	xfers := []DESDevTransfer{}
+	res := DES.DB.Order("des_dev_xfer_reg_time ASC").Find(&xfers)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	latest := make(map[string]DESDevTransfer)
+	for _, x := range xfers {
+		latest[x.DESDevXferSerial] = x
+	}
+	for serial, x := range latest {
+		if (x.DESDevXferDir == DEV_XFER_OUT && x.DESDevXferStatus == DEV_XFER_STATUS_COMPLETE) ||
+			(x.DESDevXferDir == DEV_XFER_IN && x.DESDevXferStatus == DEV_XFER_STATUS_ROLLED_BACK) {
+			serials = append(serials, serial)
+		}
+	}
+	return
+}
+
+/* PEER DES API CLIENT ****************************************************************************/
+
+/* A PEER DES; Key IS A BEARER TOKEN ISSUED BY THE PEER */
+type DESPeer struct {
+	API  string
+	Key  string
+	HTTP *http.Client
+}
+
+func (xfer DESDevTransfer) Peer() DESPeer {
+	return DESPeer{
+		API:  xfer.DESDevXferPeerAPI,
+		Key:  xfer.DESDevXferPeerKey,
+		HTTP: &http.Client{Timeout: time.Second * 60},
+	}
+}
+
+/*
+	POSTS body AS JSON TO THE PEER; DECODES THE JSON RESPONSE INTO out WHERE out IS NOT nil
+
+NON-2XX RESPONSES ARE RETURNED AS ERRORS CARRYING THE RESPONSE TEXT
+*/
+func (peer DESPeer) Post(endPoint string, body interface{}, out interface{}) (err error) {
+
+	js, err := json.Marshal(body)
+	if err != nil {
+		return
+	}
+	return peer.do(endPoint, "application/json", bytes.NewReader(js), out)
+}
+
+/* POSTS A MULTIPART FORM CARRYING fields AND THE FILE AT path AS fileField */
+func (peer DESPeer) Upload(endPoint string, fields map[string]string, fileField, path string, out interface{}) (err error) {
+
+	buf := &bytes.Buffer{}
+	mw := multipart.NewWriter(buf)
+	for k, v := range fields {
+		if err = mw.WriteField(k, v); err != nil {
+			return
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	fw, err := mw.CreateFormFile(fileField, filepath.Base(path))
+	if err != nil {
+		return
+	}
+	if _, err = io.Copy(fw, f); err != nil {
+		return
+	}
+	if err = mw.Close(); err != nil {
+		return
+	}
+
+	return peer.do(endPoint, mw.FormDataContentType(), buf, out)
+}
+
+func (peer DESPeer) do(endPoint, contentType string, body io.Reader, out interface{}) (err error) {
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(peer.API, "/")+"/"+strings.TrimPrefix(endPoint, "/"), body)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Authorization", "Bearer "+peer.Key)
+	req.Header.Set("Content-Type", contentType)
+
+	client := peer.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	buf, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("Peer DES %s %d: %s", endPoint, resp.StatusCode, strings.TrimSpace(string(buf)))
+	}
+
+	if out == nil || len(buf) == 0 {
+		return
+	}
+	return json.Unmarshal(buf, out)
+}
@@ -0,0 +1,237 @@
+/* Data Exchange Server (DES) is a component of the Datacan Data2Desk (D2D) Platform.
+License:
+
+	[PROPER LEGALESE HERE...]
+
+	INTERIM LICENSE DESCRIPTION:
+	In spirit, this license:
+	1. Allows <Third Party> to use, modify, and / or distributre this software in perpetuity so long as <Third Party> understands:
+		a. The software is porvided as is without guarantee of additional support from DataCan in any form.
+		b. The software is porvided as is without guarantee of exclusivity.
+
+	2. Prohibits <Third Party> from taking any action which might interfere with DataCan's right to use, modify and / or distributre this software in perpetuity.
+*/
+
+package pkg
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+/*
+COMPACT BINARY PAYLOADS ( TLV )
+
+AN ALTERNATIVE TO JSON FOR SIG / CMD MESSAGES ON METERED LINKS:
+
+	[ BIN_MAGIC ][ schema version ][ field ][ field ]...
+
+EACH field IS: [ tag ( uvarint ) ][ length ( uvarint ) ][ value ]
+  - tag IS THE FIELD'S tlv STRUCT TAG ( tlv:"n", n > 0 ); FIELDS WITHOUT ONE ARE NOT SENT
+  - ZERO VALUES ARE NOT SENT; UNKNOWN TAGS ARE SKIPPED
+  - INTEGERS ARE ZIGZAG VARINTS; FLOATS ARE IEEE 754 LITTLE-ENDIAN; STRINGS ARE UTF-8; STRUCTS ARE NESTED fields
+
+TAGS ARE PART OF THE WIRE FORMAT: ADD NEW FIELDS WITH NEW TAGS; NEVER RENUMBER OR REUSE THE TAG OF A REMOVED FIELD.
+THE SCHEMA VERSION IS SET BY THE DEVICE CLASS AND MUST CHANGE WHENEVER THE MEANING OF A TAG DOES
+*/
+const BIN_MAGIC byte = 0xD5
+
+/* SCHEMA VERSION 0 IS RESERVED FOR SIGNED ENVELOPES ( SEE des.signing.go ) */
+const BIN_SCHEMA_SIGNED byte = 0x00
+
+/* RETURNS TRUE WHERE THE PAYLOAD IS A BINARY FRAME RATHER THAN JSON */
+func IsBinaryPayload(b []byte) bool {
+	return len(b) > 1 && b[0] == BIN_MAGIC
+}
+
+/* ENCODES THE STRUCT AS A BINARY FRAME */
+func EncodeBinaryPayload(schema byte, v interface{}) (b []byte, err error) {
+
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("EncodeBinaryPayload: %T is not a struct", v)
+	}
+	body, err := encodeTLVStruct(rv)
+	if err != nil {
+		return
+	}
+	return append([]byte{BIN_MAGIC, schema}, body...), nil
+}
+
+/* DECODES A BINARY FRAME INTO THE STRUCT v POINTS TO; THE FRAME MUST BE OF THE GIVEN SCHEMA VERSION */
+func DecodeBinaryPayload(b []byte, schema byte, v interface{}) (err error) {
+
+	if !IsBinaryPayload(b) {
+		return fmt.Errorf("DecodeBinaryPayload: not a binary payload")
+	}
+	if b[1] != schema {
+		return fmt.Errorf("DecodeBinaryPayload: schema version %d; expected %d", b[1], schema)
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("DecodeBinaryPayload: %T is not a pointer to a struct", v)
+	}
+	return decodeTLVStruct(b[2:], rv.Elem())
+}
+
+type tlvField struct {
+	Tag   uint64
+	Index int // Of the field in its struct
+}
+
+/* THE FIELDS OF A STRUCT THAT ARE ENCODED ( THOSE WITH A tlv TAG ), IN TAG ORDER */
+func tlvFields(t reflect.Type) (fields []tlvField, err error) {
+
+	names := make(map[uint64]string)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		s, ok := f.Tag.Lookup("tlv")
+		if !ok {
+			continue
+		}
+		tag, err := strconv.ParseUint(s, 10, 64)
+		if err != nil || tag == 0 || !f.IsExported() {
+			return nil, fmt.Errorf("TLV: %s.%s: invalid tag %q", t.Name(), f.Name, s)
+		}
+		if name, dup := names[tag]; dup {
+			return nil, fmt.Errorf("TLV: %s: tag %d is used by %s and %s", t.Name(), tag, name, f.Name)
+		}
+		names[tag] = f.Name
+		fields = append(fields, tlvField{Tag: tag, Index: i})
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("TLV: %s has no tlv tags", t.Name())
+	}
+
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Tag < fields[j].Tag })
+	return
+}
+
+func encodeTLVStruct(rv reflect.Value) (out []byte, err error) {
+
+	fields, err := tlvFields(rv.Type())
+	if err != nil {
+		return
+	}
+
+	for _, tf := range fields {
+
+		i := tf.Index
+		fv := rv.Field(i)
+		if fv.IsZero() {
+			continue
+		}
+
+		var val []byte
+		switch fv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			val = binary.AppendVarint(nil, fv.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			val = binary.AppendUvarint(nil, fv.Uint())
+		case reflect.Float32:
+			val = binary.LittleEndian.AppendUint32(nil, math.Float32bits(float32(fv.Float())))
+		case reflect.Float64:
+			val = binary.LittleEndian.AppendUint64(nil, math.Float64bits(fv.Float()))
+		case reflect.Bool:
+			val = []byte{1}
+		case reflect.String:
+			val = []byte(fv.String())
+		case reflect.Slice:
+			if fv.Type().Elem().Kind() != reflect.Uint8 {
+				return nil, fmt.Errorf("TLV: %s: unsupported type %s", rv.Type().Field(i).Name, fv.Type())
+			}
+			val = fv.Bytes()
+		case reflect.Struct:
+			if val, err = encodeTLVStruct(fv); err != nil {
+				return
+			}
+		default:
+			return nil, fmt.Errorf("TLV: %s: unsupported type %s", rv.Type().Field(i).Name, fv.Type())
+		}
+
+		out = binary.AppendUvarint(out, tf.Tag)
+		out = binary.AppendUvarint(out, uint64(len(val)))
+		out = append(out, val...)
+	}
+	return
+}
+
+func decodeTLVStruct(b []byte, rv reflect.Value) (err error) {
+
+	fields, err := tlvFields(rv.Type())
+	if err != nil {
+		return
+	}
+	index := make(map[uint64]int)
+	for _, tf := range fields {
+		index[tf.Tag] = tf.Index
+	}
+
+	for len(b) > 0 {
+
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			return fmt.Errorf("TLV: invalid tag")
+		}
+		b = b[n:]
+		size, n := binary.Uvarint(b)
+		if n <= 0 || uint64(len(b)-n) < size {
+			return fmt.Errorf("TLV: invalid length; tag %d", tag)
+		}
+		val := b[n : n+int(size)]
+		b = b[n+int(size):]
+
+		/* A FIELD ADDED BY NEWER FIRMWARE */
+		i, ok := index[tag]
+		if !ok {
+			continue
+		}
+
+		fv := rv.Field(i)
+		name := rv.Type().Field(i).Name
+		switch fv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			x, n := binary.Varint(val)
+			if n <= 0 || fv.OverflowInt(x) {
+				return fmt.Errorf("TLV: %s: invalid integer", name)
+			}
+			fv.SetInt(x)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			x, n := binary.Uvarint(val)
+			if n <= 0 || fv.OverflowUint(x) {
+				return fmt.Errorf("TLV: %s: invalid integer", name)
+			}
+			fv.SetUint(x)
+		case reflect.Float32:
+			if len(val) != 4 {
+				return fmt.Errorf("TLV: %s: invalid float32", name)
+			}
+			fv.SetFloat(float64(math.Float32frombits(binary.LittleEndian.Uint32(val))))
+		case reflect.Float64:
+			if len(val) != 8 {
+				return fmt.Errorf("TLV: %s: invalid float64", name)
+			}
+			fv.SetFloat(math.Float64frombits(binary.LittleEndian.Uint64(val)))
+		case reflect.Bool:
+			fv.SetBool(len(val) > 0 && val[0] != 0)
+		case reflect.String:
+			fv.SetString(string(val))
+		case reflect.Slice:
+			if fv.Type().Elem().Kind() != reflect.Uint8 {
+				return fmt.Errorf("TLV: %s: unsupported type %s", name, fv.Type())
+			}
+			fv.SetBytes(append([]byte{}, val...))
+		case reflect.Struct:
+			if err = decodeTLVStruct(val, fv); err != nil {
+				return
+			}
+		default:
+			return fmt.Errorf("TLV: %s: unsupported type %s", name, fv.Type())
+		}
+	}
+	return
+}
@@ -0,0 +1,106 @@
+package pkg
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+type tlvInner struct {
+	Code int32  `tlv:"1"`
+	Msg  string `tlv:"2"`
+}
+
+type tlvOuter struct {
+	ID    int64    `json:"-"` // Not sent
+	Time  int64    `json:"t" tlv:"1"`
+	Name  string   `json:"n" tlv:"3"` // Tag 2 retired
+	Rate  float32  `json:"r" tlv:"4"`
+	Geo   float64  `json:"g" tlv:"5"`
+	OK    bool     `json:"ok" tlv:"6"`
+	Count uint16   `json:"c" tlv:"7"`
+	Raw   []byte   `json:"raw" tlv:"8"`
+	Inner tlvInner `json:"inner" tlv:"9"`
+}
+
+func TestBinaryPayloadRoundTrip(t *testing.T) {
+
+	in := tlvOuter{
+		ID:    42,
+		Time:  1700000000000,
+		Name:  "SN0001",
+		Rate:  -1.5,
+		Geo:   53.5461,
+		OK:    true,
+		Count: 65535,
+		Raw:   []byte{0, 1, 2},
+		Inner: tlvInner{Code: -7, Msg: "ok"},
+	}
+	b, err := EncodeBinaryPayload(1, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := tlvOuter{}
+	if err := DecodeBinaryPayload(b, 1, &out); err != nil {
+		t.Fatal(err)
+	}
+	in.ID = 0
+	if !reflect.DeepEqual(in, out) {
+		t.Fatalf("round trip:\n%+v\n%+v", in, out)
+	}
+
+	if err := DecodeBinaryPayload(b, 2, &out); err == nil {
+		t.Fatal("decoded a frame of another schema version")
+	}
+}
+
+func TestBinaryPayloadTags(t *testing.T) {
+
+	/* THE TAG ON THE WIRE IS THE FIELD'S tlv TAG, NOT ITS POSITION */
+	b, err := EncodeBinaryPayload(1, tlvOuter{Name: "A"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{BIN_MAGIC, 1, 3, 1, 'A'}; !reflect.DeepEqual(b, want) {
+		t.Fatalf("frame = %v; want %v", b, want)
+	}
+
+	/* UNKNOWN ( NEWER ) TAGS ARE SKIPPED */
+	b = binary.AppendUvarint(b, 99)
+	b = binary.AppendUvarint(b, 2)
+	b = append(b, 0xFF, 0xFF)
+	b = append(b, 1, 1, 2) // Time = 1
+	out := tlvOuter{}
+	if err := DecodeBinaryPayload(b, 1, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Name != "A" || out.Time != 1 {
+		t.Fatalf("decoded %+v", out)
+	}
+}
+
+func TestBinaryPayloadInvalidTags(t *testing.T) {
+
+	type dup struct {
+		A int32 `tlv:"1"`
+		B int32 `tlv:"1"`
+	}
+	if _, err := EncodeBinaryPayload(1, dup{A: 1}); err == nil {
+		t.Fatal("encoded a struct with a duplicate tag")
+	}
+
+	type zero struct {
+		A int32 `tlv:"0"`
+	}
+	if _, err := EncodeBinaryPayload(1, zero{A: 1}); err == nil {
+		t.Fatal("encoded a struct with tag 0")
+	}
+
+	type none struct {
+		A int32 `json:"a"`
+	}
+	if _, err := EncodeBinaryPayload(1, none{A: 1}); err == nil {
+		t.Fatal("encoded a struct without tlv tags")
+	}
+}
@@ -182,13 +182,9 @@ func Float64ToBytes(in float64) []byte {
 // 	return
 // }
 
+/* FIXED-LENGTH STRINGS ARE PADDED WITH SPACES ( StringToNBytes ); STRIP THE PADDING, KEEP INNER SPACES */
 func StrBytesToString(b []byte) (out string) {
-	for i := range b {
-		if b[i] == 32 {
-			return string(b[:i])
-		}
-	}
-	return
+	return strings.TrimRight(string(b), " \x00")
 }
 
 /* STRING INPUT */
@@ -312,9 +308,12 @@ func SlopeAndIntercept(x []float32, y []float32) (float32, float32) {
 	My := MeanFloat32(y)
 
 	for i, val := range x {
-		SP += val * y[i]
+		SP += (val - Mx) * (y[i] - My)
 		SSx += (val - Mx) * (val - Mx)
 	}
+	if SSx == 0 {
+		return 0, My
+	}
 	m = SP / SSx
 	b = My - (m * Mx)
 	return m, b
@@ -0,0 +1,309 @@
+/* Data Exchange Server (DES) is a component of the Datacan Data2Desk (D2D) Platform.
+License:
+
+	[PROPER LEGALESE HERE...]
+
+	INTERIM LICENSE DESCRIPTION:
+	In spirit, this license:
+	1. Allows <Third Party> to use, modify, and / or distributre this software in perpetuity so long as <Third Party> understands:
+		a. The software is porvided as is without guarantee of additional support from DataCan in any form.
+		b. The software is porvided as is without guarantee of exclusivity.
+
+	2. Prohibits <Third Party> from taking any action which might interfere with DataCan's right to use, modify and / or distributre this software in perpetuity.
+*/
+
+package pkg
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+/*
+DEVICE FLASH LAYOUTS
+
+A MODEL'S FLASH RECORD IS DESCRIBED BY flash TAGS ON ITS FIELDS:
+
+		`flash:"<offset>,<width>[,be]"`
+
+	  - offset AND width ARE IN BYTES; FIELDS WITHOUT A flash TAG ARE NOT STORED IN FLASH
+	  - INTEGERS ARE 1, 2, 4 OR 8 BYTES ( NARROWER THAN THE GO TYPE IS ALLOWED ); SIGNED INTEGERS ARE SIGN-EXTENDED
+	  - FLOATS ARE IEEE 754; A float64 MAY BE STORED IN 4 BYTES ( AS A float32 )
+	  - STRINGS ARE FIXED LENGTH ( width ), PADDED WITH SPACES ( SEE StringToNBytes )
+	  - LITTLE-ENDIAN UNLESS be IS GIVEN
+
+NewFlashLayout VERIFIES THE TAGS AGAINST THE RECORD SIZE THE FIRMWARE WRITES:
+  - NO FIELD MAY OVERLAP ANOTHER OR RUN PAST THE END OF THE RECORD; EVERY BYTE MUST BELONG TO A FIELD
+  - A PROBE RECORD MUST SURVIVE bytes -> model -> bytes -> model UNCHANGED
+*/
+const FLASH_TAG = "flash"
+
+type FlashField struct {
+	Name   string
+	Index  int
+	Offset int
+	Width  int
+	Order  binary.ByteOrder
+}
+
+type FlashLayout struct {
+	Model  string
+	Size   int
+	Fields []FlashField
+	typ    reflect.Type
+}
+
+/* BUILDS AND VERIFIES THE FLASH LAYOUT OF THE MODEL ( A STRUCT ) FROM ITS flash TAGS */
+func NewFlashLayout(model interface{}, size int) (l *FlashLayout, err error) {
+
+	t := reflect.TypeOf(model)
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("Flash layout: %T is not a struct", model)
+	}
+	l = &FlashLayout{Model: t.Name(), Size: size, typ: t}
+
+	owner := make([]string, size)
+	for i := 0; i < t.NumField(); i++ {
+
+		sf := t.Field(i)
+		tag, ok := sf.Tag.Lookup(FLASH_TAG)
+		if !ok || tag == "-" {
+			continue
+		}
+
+		f, err := parseFlashTag(sf, tag)
+		if err != nil {
+			return nil, fmt.Errorf("Flash layout %s: %s", l.Model, err.Error())
+		}
+		f.Index = i
+
+		if f.Offset < 0 || f.Offset+f.Width > size {
+			return nil, fmt.Errorf("Flash layout %s: %s [ %d : %d ] is outside the %d byte record",
+				l.Model, f.Name, f.Offset, f.Offset+f.Width, size)
+		}
+		for b := f.Offset; b < f.Offset+f.Width; b++ {
+			if owner[b] != "" {
+				return nil, fmt.Errorf("Flash layout %s: %s overlaps %s at byte %d", l.Model, f.Name, owner[b], b)
+			}
+			owner[b] = f.Name
+		}
+		l.Fields = append(l.Fields, f)
+	}
+
+	for b := range owner {
+		if owner[b] == "" {
+			return nil, fmt.Errorf("Flash layout %s: byte %d of the %d byte record belongs to no field", l.Model, b, size)
+		}
+	}
+
+	if err = l.Verify(); err != nil {
+		return nil, err
+	}
+	return
+}
+
+/* AS NewFlashLayout; PANICS WHERE THE LAYOUT IS INVALID ( FOR PACKAGE LEVEL LAYOUTS ) */
+func MustFlashLayout(model interface{}, size int) *FlashLayout {
+	l, err := NewFlashLayout(model, size)
+	if err != nil {
+		panic(err.Error())
+	}
+	return l
+}
+
+func parseFlashTag(sf reflect.StructField, tag string) (f FlashField, err error) {
+
+	f.Name = sf.Name
+	f.Order = binary.LittleEndian
+
+	parts := strings.Split(tag, ",")
+	if len(parts) < 2 || len(parts) > 3 {
+		return f, fmt.Errorf("%s: flash tag must be \"<offset>,<width>[,be]\"; got %q", sf.Name, tag)
+	}
+	if f.Offset, err = strconv.Atoi(strings.TrimSpace(parts[0])); err != nil {
+		return f, fmt.Errorf("%s: invalid offset %q", sf.Name, parts[0])
+	}
+	if f.Width, err = strconv.Atoi(strings.TrimSpace(parts[1])); err != nil {
+		return f, fmt.Errorf("%s: invalid width %q", sf.Name, parts[1])
+	}
+	if len(parts) == 3 {
+		switch strings.TrimSpace(parts[2]) {
+		case "be":
+			f.Order = binary.BigEndian
+		case "le":
+		default:
+			return f, fmt.Errorf("%s: invalid byte order %q", sf.Name, parts[2])
+		}
+	}
+
+	switch sf.Type.Kind() {
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Int,
+		reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uint:
+		if !(f.Width == 1 || f.Width == 2 || f.Width == 4 || f.Width == 8) || f.Width > int(sf.Type.Size()) {
+			return f, fmt.Errorf("%s: a %s can not be stored in %d bytes", sf.Name, sf.Type, f.Width)
+		}
+	case reflect.Float32:
+		if f.Width != 4 {
+			return f, fmt.Errorf("%s: a float32 is stored in 4 bytes; got %d", sf.Name, f.Width)
+		}
+	case reflect.Float64:
+		if f.Width != 4 && f.Width != 8 {
+			return f, fmt.Errorf("%s: a float64 is stored in 4 or 8 bytes; got %d", sf.Name, f.Width)
+		}
+	case reflect.String:
+		if f.Width < 1 {
+			return f, fmt.Errorf("%s: a string must be at least 1 byte", sf.Name)
+		}
+	default:
+		return f, fmt.Errorf("%s: %s can not be stored in flash", sf.Name, sf.Type)
+	}
+	return
+}
+
+/* RETURNS THE FLASH RECORD OF THE MODEL ( OR POINTER TO THE MODEL ) */
+func (l *FlashLayout) Encode(model interface{}) (b []byte, err error) {
+
+	rv := reflect.Indirect(reflect.ValueOf(model))
+	if rv.Type() != l.typ {
+		return nil, fmt.Errorf("Flash layout %s: can not encode %T", l.Model, model)
+	}
+
+	b = make([]byte, l.Size)
+	for _, f := range l.Fields {
+		v := rv.Field(f.Index)
+		out := b[f.Offset : f.Offset+f.Width]
+
+		switch v.Kind() {
+		case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Int:
+			putFlashUint(out, f.Order, uint64(v.Int()))
+		case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uint:
+			putFlashUint(out, f.Order, v.Uint())
+		case reflect.Float32, reflect.Float64:
+			if f.Width == 4 {
+				putFlashUint(out, f.Order, uint64(math.Float32bits(float32(v.Float()))))
+			} else {
+				putFlashUint(out, f.Order, math.Float64bits(v.Float()))
+			}
+		case reflect.String:
+			copy(out, StringToNBytes(v.String(), f.Width))
+		}
+	}
+	return
+}
+
+/* DECODES THE FLASH RECORD INTO THE MODEL model POINTS TO; FIELDS NOT STORED IN FLASH ARE CLEARED */
+func (l *FlashLayout) Decode(b []byte, model interface{}) (err error) {
+
+	rv := reflect.ValueOf(model)
+	if rv.Kind() != reflect.Pointer || rv.Elem().Type() != l.typ {
+		return fmt.Errorf("Flash layout %s: can not decode into %T", l.Model, model)
+	}
+	if len(b) < l.Size {
+		return fmt.Errorf("Flash layout %s: expected %d bytes; received %d", l.Model, l.Size, len(b))
+	}
+
+	rv = rv.Elem()
+	rv.Set(reflect.Zero(l.typ))
+	for _, f := range l.Fields {
+		v := rv.Field(f.Index)
+		in := b[f.Offset : f.Offset+f.Width]
+
+		switch v.Kind() {
+		case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Int:
+			shift := 64 - 8*f.Width
+			v.SetInt(int64(flashUint(in, f.Order)<<shift) >> shift)
+		case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uint:
+			v.SetUint(flashUint(in, f.Order))
+		case reflect.Float32, reflect.Float64:
+			if f.Width == 4 {
+				v.SetFloat(float64(math.Float32frombits(uint32(flashUint(in, f.Order)))))
+			} else {
+				v.SetFloat(math.Float64frombits(flashUint(in, f.Order)))
+			}
+		case reflect.String:
+			v.SetString(StrBytesToString(in))
+		}
+	}
+	return
+}
+
+/*
+	ROUND-TRIP VERIFICATION
+
+FILLS EACH FIELD OF A PROBE RECORD WITH ITS OWN PATTERN, THEN CHECKS THAT
+bytes -> model -> bytes RETURNS THE PROBE AND bytes -> model -> bytes -> model RETURNS THE SAME MODEL
+*/
+func (l *FlashLayout) Verify() (err error) {
+
+	probe := make([]byte, l.Size)
+	for i, f := range l.Fields {
+		for k := 0; k < f.Width; k++ {
+			probe[f.Offset+k] = byte('A' + (i*7+k)%26)
+		}
+	}
+
+	m1 := reflect.New(l.typ)
+	if err = l.Decode(probe, m1.Interface()); err != nil {
+		return
+	}
+	b, err := l.Encode(m1.Interface())
+	if err != nil {
+		return
+	}
+	for i := range probe {
+		if b[i] != probe[i] {
+			return fmt.Errorf("Flash layout %s: round trip changed byte %d ( %s )", l.Model, i, l.fieldAt(i))
+		}
+	}
+
+	m2 := reflect.New(l.typ)
+	if err = l.Decode(b, m2.Interface()); err != nil {
+		return
+	}
+	for _, f := range l.Fields {
+		if !reflect.DeepEqual(m1.Elem().Field(f.Index).Interface(), m2.Elem().Field(f.Index).Interface()) {
+			return fmt.Errorf("Flash layout %s: round trip changed %s", l.Model, f.Name)
+		}
+	}
+	return
+}
+
+func (l *FlashLayout) fieldAt(b int) string {
+	for _, f := range l.Fields {
+		if b >= f.Offset && b < f.Offset+f.Width {
+			return f.Name
+		}
+	}
+	return "no field"
+}
+
+func putFlashUint(b []byte, order binary.ByteOrder, u uint64) {
+	switch len(b) {
+	case 1:
+		b[0] = byte(u)
+	case 2:
+		order.PutUint16(b, uint16(u))
+	case 4:
+		order.PutUint32(b, uint32(u))
+	case 8:
+		order.PutUint64(b, u)
+	}
+}
+
+func flashUint(b []byte, order binary.ByteOrder) uint64 {
+	switch len(b) {
+	case 1:
+		return uint64(b[0])
+	case 2:
+		return uint64(order.Uint16(b))
+	case 4:
+		return uint64(order.Uint32(b))
+	case 8:
+		return order.Uint64(b)
+	}
+	return 0
+}
@@ -22,8 +22,10 @@ import (
 )
 
 const ERR_DB_EXISTS string = "Database already exists"
+const ERR_DB_NOT_CONNECTED string = "Database is not connected"
 
 const ERR_FILE_NAME_EMPTY string = "File name is empty"
+const ERR_FILE_HEX_RECORD string = "Invalid Intel HEX record"
 
 const ERR_AUTH string = ""
 const ERR_AUTH_INVALID_SESSION string = "Invalid user session ID"
@@ -33,6 +35,7 @@ const ERR_AUTH_ADMIN string = "You must be an administrator to perform this acti
 const ERR_AUTH_OPERATOR string = "You must be an operator to perform this action"
 const ERR_AUTH_VIEWER string = "You must be a viewer to perform this action"
 const ERR_AUTH_USER_NOT_FOUND string = "User not found"
+const ERR_AUTH_NO_ORG string = "Your account does not belong to an organization"
 
 const ERR_SRC_TIME_PAST string = "Invalid message source; time has too long since passed"
 const ERR_SRC_TIME_FUTURE string = "Invalid message source; time has not yet come to pass"
@@ -41,6 +44,9 @@ const ERR_INVALID_SRC_CMD string = "Invalid user message source data"
 const ERR_INVALID_SRC_OP_CODE_CMD string = "Invalid user message op code"
 
 const ERR_MQTT_DEVICE_CONN string = "Device not connected to broker"
+const ERR_MQTT_LATE_REPLY string = "Device replied after the command expired"
+
+const ERR_CA_NOT_LOADED string = "DES CA not loaded"
 
 type DESError struct {
 	DESErrID   int64  `gorm:"unique; primaryKey" json:"des_dev_err_id"`
@@ -126,15 +132,20 @@ type DESMessageSource struct {
 	App    string `json:"app"`
 }
 
-func (src *DESMessageSource) ValidateSRC_CMD(dev_src DESMessageSource, uid string, mod interface{}) (err error) {
+/*
+	VALIDATE THE SOURCE OF A USER COMMAND
+
+src.Time IS CHECKED ( AND MAY BE CHANGED ) ACCORDING TO THE DEVICE CLASS TIME POLICY
+*/
+func (src *DESMessageSource) ValidateSRC_CMD(dev_src DESMessageSource, uid string, policy DESTimePolicy, mod interface{}) (err error) {
 
 	usrc, err := GetUserReferenceSRC(uid)
 	if err != nil {
 		return
 	}
 
-	if err = ValidateUnixMilli(src.Time); err != nil {
-		_, err = LogDESError(usrc.UserID, err.Error(), mod)
+	if src.Time, err = policy.Apply(src.Time); err != nil {
+		LogDESError(usrc.UserID, err.Error(), mod)
 		return
 	}
 
@@ -159,40 +170,30 @@ func (src *DESMessageSource) ValidateSRC_CMD(dev_src DESMessageSource, uid strin
 
 	return
 }
-func (src *DESMessageSource) ValidateSRC_SIG(dev_src DESMessageSource, mod interface{}) (err error) {
 
-	if err = ValidateUnixMilli(src.Time); err != nil {
-		_, err = LogDESError(dev_src.UserID, err.Error(), mod)
+/*
+	VALIDATE THE SOURCE OF A DEVICE SIGNAL
+
+src.Time IS CHECKED ( AND MAY BE CHANGED ) ACCORDING TO THE DEVICE CLASS TIME POLICY
+
+req IS THE DES COMMAND THE SIGNAL ANSWERS ( SEE MQTTMessageRequest ); nil FOR AN UNSOLICITED SIGNAL
+  - A REPLY CARRYING THE COMMAND'S CORRELATION DATA CARRIES THE SOURCE OF THE COMMAND IT ANSWERS
+  - ANY OTHER SIGNAL, INCLUDING A REPLY MATCHED BY TOPIC ( MQTT 3.1.1 ), MUST COME FROM THE DEVICE
+  - A REPLY RECEIVED AFTER THE COMMAND EXPIRED IS LOGGED
+*/
+func (src *DESMessageSource) ValidateSRC_SIG(dev_src DESMessageSource, policy DESTimePolicy, req *MQTTPendingRequest, mod interface{}) (err error) {
+
+	if src.Time, err = policy.Apply(src.Time); err != nil {
+		LogDESError(dev_src.UserID, err.Error(), mod)
 		return
 	}
-	if src.Addr != dev_src.Addr {
+	if req != nil && req.Late() {
+		LogDESError(dev_src.UserID, ERR_MQTT_LATE_REPLY, mod)
+	}
+	if (req == nil || !req.Correlated) && src.Addr != dev_src.Addr {
 		LogDESError(dev_src.UserID, ERR_INVALID_SRC_SIG, mod)
 		src.Addr = dev_src.Addr
 	}
 
 	return
 }
-
-/* VALIDATE UNIX MILLI */
-const MIN_TIME = 946710000
-
-func ValidateUnixMilli(t int64) (err error) {
-	now := time.Now().UTC()
-	y := now.Year()
-	m := now.Month()
-	// d := now.Day( )
-
-	test := time.UnixMilli(t)
-	ty := test.Year()
-	tm := test.Month()
-	// td := test.Day()
-
-	if t < MIN_TIME {
-		return fmt.Errorf(ERR_SRC_TIME_PAST)
-	} else if (ty - y) > 1 {
-		return fmt.Errorf(ERR_SRC_TIME_FUTURE)
-	} else if (ty-y) > 0 && (tm-m+12) > 0 {
-		return fmt.Errorf(ERR_SRC_TIME_FUTURE)
-	}
-	return
-}
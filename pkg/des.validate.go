@@ -0,0 +1,93 @@
+/* Data Exchange Server (DES) is a component of the Datacan Data2Desk (D2D) Platform.
+License:
+
+	[PROPER LEGALESE HERE...]
+
+	INTERIM LICENSE DESCRIPTION:
+	In spirit, this license:
+	1. Allows <Third Party> to use, modify, and / or distributre this software in perpetuity so long as <Third Party> understands:
+		a. The software is porvided as is without guarantee of additional support from DataCan in any form.
+		b. The software is porvided as is without guarantee of exclusivity.
+
+	2. Prohibits <Third Party> from taking any action which might interfere with DataCan's right to use, modify and / or distributre this software in perpetuity.
+*/
+
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+/*
+COMMAND MODEL VALIDATION
+
+RULES ARE DECLARED AS `validate:"..."` TAGS ON THE MODELS AND CHECKED BY ValidateStruct
+IN ADDITION TO THE validator/v10 BUILT-IN TAGS ( gtfield, ltefield, min, max, oneof, ... ):
+  - multiplefield=<Field>: AN INTEGER THAT IS A WHOLE MULTIPLE OF <Field>
+  - ANY ALIAS A CLASS / VERSION REGISTERS WITH RegisterValidationAlias
+
+A COMMAND THAT FAILS IS REJECTED WITH ValidationErrors BEFORE IT IS LOGGED OR PUBLISHED
+*/
+func init() {
+	validate.RegisterValidation("multiplefield", validateMultipleField)
+}
+
+func validateMultipleField(fl validator.FieldLevel) bool {
+
+	other, kind, _, ok := fl.GetStructFieldOKAdvanced2(fl.Parent(), fl.Param())
+	if !ok || kind != fl.Field().Kind() {
+		return false
+	}
+
+	switch fl.Field().Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return other.Int() != 0 && fl.Field().Int()%other.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return other.Uint() != 0 && fl.Field().Uint()%other.Uint() == 0
+	}
+	return false
+}
+
+/* NAMES A RULE BUILT FROM CLASS / VERSION CONSTANTS; ie: RegisterValidationAlias("min_sample_period", "gte=1000") */
+func RegisterValidationAlias(alias, tags string) {
+	validate.RegisterAlias(alias, tags)
+}
+
+/* THE FIELD ERRORS RETURNED BY ValidateStruct, AS AN error */
+type ValidationErrors []*ErrorResponse
+
+func (errs ValidationErrors) Error() string {
+	txt := []string{}
+	for _, e := range errs {
+		txt = append(txt, strings.TrimSpace(fmt.Sprintf("%s: %s %s", e.Field, e.Tag, e.Value)))
+	}
+	return fmt.Sprintf("Invalid request body: %s", strings.Join(txt, "; "))
+}
+
+/* RETURNS ValidationErrors WHERE THE MODEL FAILS ITS `validate` RULES */
+func ValidateModel(mod interface{}) error {
+	if errs := ValidateStruct(mod); errs != nil {
+		return ValidationErrors(errs)
+	}
+	return nil
+}
+
+/*
+	SEND A FAILED REQUEST'S ERROR TO THE HTTP CALLER
+
+ValidationErrors: 400 WITH { "errors": [ ErrorResponse, ... ] }
+OTHERWISE: status WITH THE ERROR TEXT
+*/
+func SendRequestError(c *fiber.Ctx, status int, err error) error {
+	verrs := ValidationErrors{}
+	if errors.As(err, &verrs) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": verrs})
+	}
+	return c.Status(status).SendString(err.Error())
+}